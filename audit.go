@@ -0,0 +1,242 @@
+package pop
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/storeutil"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipld/go-ipld-prime"
+	dagpb "github.com/ipld/go-ipld-prime-proto"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// AuditTimeout bounds how long we wait for a cache to send its offer and the sampled blocks
+const AuditTimeout = 30 * time.Second
+
+// maxAuditDepth is how many links we follow at most when sampling a path of a DAG
+const maxAuditDepth = 8
+
+// AuditResult is the outcome of retrieving a sample of a content from a cache claiming to hold it
+type AuditResult struct {
+	Root     cid.Cid
+	Cache    peer.ID
+	Duration time.Duration
+	// Err is empty when the cache served the sample
+	Err  string
+	Time time.Time
+}
+
+// Failed returns whether the cache failed to serve the sample
+func (r AuditResult) Failed() bool {
+	return r.Err != ""
+}
+
+// Audit retrieves a small random sample of a content we published from a cache claiming to hold it
+// and records the outcome in the cache scores
+func (e *Exchange) Audit(ctx context.Context, root cid.Cid, cache peer.ID) AuditResult {
+	start := time.Now()
+	err := e.audit(ctx, root, cache)
+	res := AuditResult{
+		Root:     root,
+		Cache:    cache,
+		Duration: time.Since(start),
+		Time:     start,
+	}
+	if err != nil {
+		res.Err = err.Error()
+		e.log.Warn().Err(err).Str("root", root.String()).Str("cache", cache.String()).Msg("cache failed audit")
+		err = e.supply.Scores().RecordFailure(cache, err)
+	} else {
+		err = e.supply.Scores().RecordSuccess(cache)
+	}
+	if err != nil {
+		e.log.Error().Err(err).Msg("failed to record audit")
+	}
+	return res
+}
+
+func (e *Exchange) audit(ctx context.Context, root cid.Cid, cache peer.ID) error {
+	ctx, cancel := context.WithTimeout(ctx, AuditTimeout)
+	defer cancel()
+
+	session, err := e.NewSession(ctx, root)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	// The sample is only kept until we checked it
+	defer e.multiStore.Delete(session.StoreID())
+
+	var bs blockstore.Blockstore
+	if store, err := e.supply.GetStore(root); err == nil {
+		bs = store.Bstore
+	}
+	session.SetSelector(samplePath(ctx, bs, root, maxAuditDepth))
+
+	offer, err := session.QueryProvider(ctx, cache)
+	if err != nil {
+		return fmt.Errorf("no offer: %w", err)
+	}
+	if err := session.SyncBlocks(ctx, offer); err != nil {
+		return err
+	}
+	select {
+	case err := <-session.Done():
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// AuditAll audits a random cache of each content we published
+func (e *Exchange) AuditAll(ctx context.Context) ([]AuditResult, error) {
+	roots, err := e.supply.DispatchedRoots()
+	if err != nil {
+		return nil, err
+	}
+	var results []AuditResult
+	for _, root := range roots {
+		caches, err := e.supply.Caches(root)
+		if err != nil || len(caches) == 0 {
+			continue
+		}
+		results = append(results, e.Audit(ctx, root, caches[rand.Intn(len(caches))]))
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+	}
+	return results, nil
+}
+
+// startAudits audits the caches holding our content on an interval
+func (e *Exchange) startAudits(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			results, err := e.AuditAll(ctx)
+			if err != nil && ctx.Err() == nil {
+				e.log.Error().Err(err).Msg("failed to audit caches")
+			}
+			failed := 0
+			for _, r := range results {
+				if r.Failed() {
+					failed++
+				}
+			}
+			e.log.Info().Int("audits", len(results)).Int("failed", failed).Msg("audited caches")
+		}
+	}()
+}
+
+// pathSegment is a step to a link inside a block
+type pathSegment struct {
+	field string
+	index int64
+	list  bool
+}
+
+// collectLinks appends the path to every link in a node
+func collectLinks(n ipld.Node, prefix []pathSegment, paths *[][]pathSegment, links *[]ipld.Link) {
+	switch n.Kind() {
+	case ipld.Kind_Link:
+		lnk, err := n.AsLink()
+		if err != nil {
+			return
+		}
+		*paths = append(*paths, append([]pathSegment(nil), prefix...))
+		*links = append(*links, lnk)
+	case ipld.Kind_Map:
+		it := n.MapIterator()
+		for !it.Done() {
+			k, v, err := it.Next()
+			if err != nil {
+				return
+			}
+			field, err := k.AsString()
+			if err != nil {
+				continue
+			}
+			collectLinks(v, append(prefix, pathSegment{field: field}), paths, links)
+		}
+	case ipld.Kind_List:
+		it := n.ListIterator()
+		for !it.Done() {
+			i, v, err := it.Next()
+			if err != nil {
+				return
+			}
+			collectLinks(v, append(prefix, pathSegment{index: i, list: true}), paths, links)
+		}
+	}
+}
+
+// samplePath follows random links from the root of a DAG we hold and returns a selector reaching the
+// blocks along the path. Without a local copy of the DAG only the root block is sampled.
+func samplePath(ctx context.Context, bs blockstore.Blockstore, root cid.Cid, depth int) ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	if bs == nil {
+		return ssb.Matcher().Node()
+	}
+	chooser := dagpb.AddDagPBSupportToChooser(func(ipld.Link, ipld.LinkContext) (ipld.NodePrototype, error) {
+		return basicnode.Prototype.Any, nil
+	})
+	bsLoader := storeutil.LoaderForBlockstore(bs)
+	// Link contexts have no context in go-ipld-prime v0.7.0, stop loading blocks once ours is cancelled
+	loader := func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return bsLoader(lnk, lnkCtx)
+	}
+
+	var path []pathSegment
+	var lnk ipld.Link = cidlink.Link{Cid: root}
+	for i := 0; i < depth; i++ {
+		lnkCtx := ipld.LinkContext{}
+		proto, err := chooser(lnk, lnkCtx)
+		if err != nil {
+			break
+		}
+		nb := proto.NewBuilder()
+		if err := lnk.Load(ctx, lnkCtx, nb, loader); err != nil {
+			break
+		}
+		var paths [][]pathSegment
+		var links []ipld.Link
+		collectLinks(nb.Build(), nil, &paths, &links)
+		if len(links) == 0 {
+			break
+		}
+		j := rand.Intn(len(links))
+		path = append(path, paths[j]...)
+		lnk = links[j]
+	}
+
+	// Build the selector from the last block back to the root
+	sel := ssb.Matcher()
+	for i := len(path) - 1; i >= 0; i-- {
+		seg, next := path[i], sel
+		if seg.list {
+			sel = ssb.ExploreIndex(seg.index, next)
+			continue
+		}
+		sel = ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+			efsb.Insert(seg.field, next)
+		})
+	}
+	return sel.Node()
+}
@@ -0,0 +1,42 @@
+package pop
+
+import (
+	"context"
+	"testing"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSamplePath(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	n := testutil.NewTestNode(mn, t)
+
+	fname := n.CreateRandomFile(t, 256000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+	store, err := n.Ms.Get(storeID)
+	require.NoError(t, err)
+
+	all, err := DAGStat(ctx, store.Bstore, root, AllSelector())
+	require.NoError(t, err)
+
+	// The sample is a single path from the root to a leaf
+	sample, err := DAGStat(ctx, store.Bstore, root, samplePath(ctx, store.Bstore, root, maxAuditDepth))
+	require.NoError(t, err)
+	require.Greater(t, sample.NumBlocks, 1)
+	require.Less(t, sample.NumBlocks, all.NumBlocks)
+
+	// The depth bounds the path
+	sample, err = DAGStat(ctx, store.Bstore, root, samplePath(ctx, store.Bstore, root, 1))
+	require.NoError(t, err)
+	require.Equal(t, 2, sample.NumBlocks)
+
+	// Without a local copy only the root is sampled
+	sample, err = DAGStat(ctx, store.Bstore, root, samplePath(ctx, nil, root, maxAuditDepth))
+	require.NoError(t, err)
+	require.Equal(t, 1, sample.NumBlocks)
+}
@@ -0,0 +1,110 @@
+// Package build exposes the version of the pop binary
+package build
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Version is the current version of pop. It can be overridden when building:
+// go build -ldflags "-X github.com/myelnet/pop/build.Version=x.y.z"
+var Version = "0.1.0"
+
+// AgentPrefix prefixes the version we advertise to other peers via libp2p identify
+const AgentPrefix = "pop/"
+
+// UserAgent returns the agent version advertised to other peers
+func UserAgent() string {
+	return AgentPrefix + Version
+}
+
+// AgentVersion returns the pop version from the agent advertised by a peer if it is a pop node
+func AgentVersion(agent string) (string, bool) {
+	if !strings.HasPrefix(agent, AgentPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(agent, AgentPrefix), true
+}
+
+// Semver is a parsed semantic version
+type Semver struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+// ParseVersion parses a major.minor.patch version with an optional v prefix and pre-release suffix
+func ParseVersion(v string) (Semver, error) {
+	v = strings.TrimPrefix(v, "v")
+	if i := strings.IndexAny(v, "-+"); i != -1 {
+		v = v[:i]
+	}
+	parts := strings.Split(v, ".")
+	if len(parts) != 3 {
+		return Semver{}, fmt.Errorf("invalid version %s", v)
+	}
+	var nums [3]int
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return Semver{}, fmt.Errorf("invalid version %s: %w", v, err)
+		}
+		nums[i] = n
+	}
+	return Semver{nums[0], nums[1], nums[2]}, nil
+}
+
+func (v Semver) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Less checks if the version is older than the other one
+func (v Semver) Less(o Semver) bool {
+	if v.Major != o.Major {
+		return v.Major < o.Major
+	}
+	if v.Minor != o.Minor {
+		return v.Minor < o.Minor
+	}
+	return v.Patch < o.Patch
+}
+
+// MinorsBehind returns how many minor versions we lag behind the other version.
+// A different major version always counts as lagging more than any number of minors.
+func (v Semver) MinorsBehind(o Semver) int {
+	if v.Major < o.Major {
+		return int(^uint(0) >> 1)
+	}
+	if v.Major > o.Major || v.Minor >= o.Minor {
+		return 0
+	}
+	return o.Minor - v.Minor
+}
+
+// LatestRelease fetches the latest released version from a release endpoint returning a JSON object
+// with a tag_name field such as the GitHub releases API.
+func LatestRelease(ctx context.Context, endpoint string) (Semver, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return Semver{}, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Semver{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return Semver{}, fmt.Errorf("release endpoint returned %s", res.Status)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&release); err != nil {
+		return Semver{}, err
+	}
+	return ParseVersion(release.TagName)
+}
@@ -0,0 +1,44 @@
+package build
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersions(t *testing.T) {
+	v, ok := AgentVersion(UserAgent())
+	require.True(t, ok)
+	require.Equal(t, Version, v)
+
+	_, ok = AgentVersion("go-ipfs/0.8.0")
+	require.False(t, ok)
+
+	cur, err := ParseVersion("v0.3.1-rc1")
+	require.NoError(t, err)
+	require.Equal(t, Semver{0, 3, 1}, cur)
+
+	_, err = ParseVersion("0.3")
+	require.Error(t, err)
+
+	require.Equal(t, 2, cur.MinorsBehind(Semver{0, 5, 0}))
+	require.Equal(t, 0, cur.MinorsBehind(Semver{0, 3, 9}))
+	require.Equal(t, 0, cur.MinorsBehind(Semver{0, 1, 0}))
+	require.Greater(t, cur.MinorsBehind(Semver{1, 0, 0}), 100)
+	require.True(t, cur.Less(Semver{0, 3, 2}))
+}
+
+func TestLatestRelease(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"tag_name":"v0.4.2","name":"pop v0.4.2"}`)
+	}))
+	defer srv.Close()
+
+	v, err := LatestRelease(context.Background(), srv.URL)
+	require.NoError(t, err)
+	require.Equal(t, Semver{0, 4, 2}, v)
+}
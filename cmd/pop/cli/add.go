@@ -13,6 +13,13 @@ import (
 
 var addArgs struct {
 	chunkSize int
+	chunker   string
+	layout    string
+	codec     string
+	hash      string
+	cidV      int
+	workdag   string
+	cancel    bool
 }
 
 var addCmd = &ffcli.Command{
@@ -23,41 +30,84 @@ var addCmd = &ffcli.Command{
 
 The 'pop add' command opens a given file, chunks it, links it as an ipld DAG and 
 stores the blocks in the block store. The DAG is then staged in the workdag index.
+With '--codec dag-cbor' the file is read as dag-json and stored as a single dag-cbor
+object, useful for application state or NFT metadata. Blocks are addressed with CIDv1
+by default, '--cid-version 0' builds legacy links for sha2-256 UnixFS DAGs.
+
+Files are cut in chunks of '--chunk-size' bytes by default. Content defined chunkers
+such as '--chunker rabin' or '--chunker buzhash' cut where the content is the same so
+versions of a file share most of their blocks. '--layout trickle' links the chunks
+in a DAG suited to streaming the file from the start, their adds cannot be resumed.
+
+Large files are chunked in the background with their progress saved as they go.
+'pop add --cancel <file-path>' stops an add in progress and adding the same file
+again resumes where it stopped as long as the file didn't change.
 
 `),
 	Exec: runAdd,
 	FlagSet: (func() *flag.FlagSet {
 		fs := flag.NewFlagSet("add", flag.ExitOnError)
 		fs.IntVar(&addArgs.chunkSize, "chunk-size", 1024, "chunk size in bytes")
+		fs.StringVar(&addArgs.chunker, "chunker", "", "chunker: size-<bytes>, rabin[-<min>-<avg>-<max>] or buzhash, defaults to chunks of chunk-size")
+		fs.StringVar(&addArgs.layout, "layout", "balanced", "layout of the file DAG: balanced or trickle")
+		fs.StringVar(&addArgs.codec, "codec", "unixfs", "root codec: unixfs, dag-cbor (from a dag-json file) or raw")
+		fs.StringVar(&addArgs.hash, "hash", "blake2b-256", "hash function: blake2b-256, sha2-256 or blake3")
+		fs.IntVar(&addArgs.cidV, "cid-version", 1, "CID version: 1 or 0 (sha2-256 unixfs only)")
+		fs.StringVar(&addArgs.workdag, "workdag", "", "name of the workdag to stage the file in instead of the checked out one")
+		fs.BoolVar(&addArgs.cancel, "cancel", false, "stop adding the file, adding it again resumes where it stopped")
 		return fs
 	})(),
 }
 
 func runAdd(ctx context.Context, args []string) error {
+	if addArgs.cidV != 0 && addArgs.cidV != 1 {
+		return fmt.Errorf("unknown CID version %d", addArgs.cidV)
+	}
 	c, cc, ctx, cancel := connect(ctx)
 	defer cancel()
 
 	arc := make(chan *node.AddResult, 1)
+	prc := make(chan *node.ProgressResult, 16)
 	cc.SetNotifyCallback(func(n node.Notify) {
 		if ar := n.AddResult; ar != nil {
 			arc <- ar
 		}
+		if pr := n.ProgressResult; pr != nil {
+			prc <- pr
+		}
 	})
 	go receive(ctx, cc, c)
 
 	cc.Add(&node.AddArgs{
 		Path:      args[0],
 		ChunkSize: addArgs.chunkSize,
+		Chunker:   addArgs.chunker,
+		Layout:    addArgs.layout,
+		Codec:     addArgs.codec,
+		HashFunc:  addArgs.hash,
+		CidV0:     addArgs.cidV == 0,
+		Workdag:   addArgs.workdag,
+		Cancel:    addArgs.cancel,
 	})
-	select {
-	case ar := <-arc:
-		if ar.Err != "" {
-			return errors.New(ar.Err)
+	var bar progressBar
+	for {
+		select {
+		case pr := <-prc:
+			bar.print(pr)
+		case ar := <-arc:
+			bar.clear()
+			if ar.Err != "" {
+				return errors.New(ar.Err)
+			}
+			if ar.Canceled {
+				fmt.Printf("==> Canceled add of %s, add it again to resume\n", args[0])
+				return nil
+			}
+			fmt.Printf("==> Added new file to workdag\n")
+			fmt.Printf("%s  %s  %s  %d blk\n", args[0], ar.Cid, ar.Size, ar.NumBlocks)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-		fmt.Printf("==> Added new file to workdag\n")
-		fmt.Printf("%s  %s  %s  %d blk\n", args[0], ar.Cid, ar.Size, ar.NumBlocks)
-		return nil
-	case <-ctx.Done():
-		return ctx.Err()
 	}
 }
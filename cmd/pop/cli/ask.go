@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var askSetArgs struct {
+	price            string
+	unsealPrice      string
+	interval         uint64
+	intervalIncrease uint64
+}
+
+var askCmd = &ffcli.Command{
+	Name:       "ask",
+	ShortUsage: "ask <subcommand>",
+	ShortHelp:  "Manage the prices we offer for retrievals",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop ask' commands manage the price and payment terms we answer to clients querying our content.
+The default ask applies to all content, overrides apply to a content root or to the content with a
+label given as <key>=<value>, for instance publisher=<peer id>. Root overrides come before labels.
+Without any ask we charge the price of the region the query comes from. Without subcommand it lists
+our asks.
+
+`),
+	Subcommands: []*ffcli.Command{
+		askSetCmd,
+		askRemoveCmd,
+	},
+	Exec: func(ctx context.Context, args []string) error {
+		return runAsk(ctx, &node.AskArgs{})
+	},
+}
+
+var askSetCmd = &ffcli.Command{
+	Name:       "set",
+	ShortUsage: "ask set [flags] <default|cid|key=value>",
+	ShortHelp:  "Set the ask of all content, a content root or a label",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop ask set' command sets the ask of a target. Terms left out keep the terms of the ask
+currently applying to the target. The unseal price is only charged for content we must unseal from
+the sectors of our miner.
+
+`),
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("set", flag.ExitOnError)
+		fs.StringVar(&askSetArgs.price, "price", "", "price per byte in FIL")
+		fs.StringVar(&askSetArgs.unsealPrice, "unseal-price", "", "price in FIL to unseal content from a sector")
+		fs.Uint64Var(&askSetArgs.interval, "payment-interval", 0, "bytes we send before requesting a payment")
+		fs.Uint64Var(&askSetArgs.intervalIncrease, "payment-interval-increase", 0, "bytes the payment interval grows by after each payment")
+		return fs
+	})(),
+	Exec: func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return flag.ErrHelp
+		}
+		return runAsk(ctx, &node.AskArgs{
+			Target:                  args[0],
+			Set:                     true,
+			PricePerByte:            askSetArgs.price,
+			UnsealPrice:             askSetArgs.unsealPrice,
+			PaymentInterval:         askSetArgs.interval,
+			PaymentIntervalIncrease: askSetArgs.intervalIncrease,
+		})
+	},
+}
+
+var askRemoveCmd = &ffcli.Command{
+	Name:       "remove",
+	ShortUsage: "ask remove <default|cid|key=value>",
+	ShortHelp:  "Remove the ask of a target",
+	Exec: func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return flag.ErrHelp
+		}
+		return runAsk(ctx, &node.AskArgs{Target: args[0], Remove: true})
+	},
+}
+
+func runAsk(ctx context.Context, args *node.AskArgs) error {
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	arc := make(chan *node.AskResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if ar := n.AskResult; ar != nil {
+			arc <- ar
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Ask(args)
+	select {
+	case ar := <-arc:
+		if ar.Err != "" {
+			return errors.New(ar.Err)
+		}
+		if len(ar.Asks) == 0 {
+			fmt.Printf("No asks, charging the price of our regions.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Target\tPrice/byte\tUnseal price\tPayment interval\tInterval increase\n")
+		for _, a := range ar.Asks {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\n", a.Target, a.PricePerByte, a.UnsealPrice, a.PaymentInterval, a.PaymentIntervalIncrease)
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
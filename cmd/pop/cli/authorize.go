@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/paychmgr"
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/myelnet/pop/wallet"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var authorizeArgs struct {
+	limit    string
+	expires  time.Duration
+	out      string
+	payer    string
+	keystore string
+}
+
+var authorizeCmd = &ffcli.Command{
+	Name:       "authorize",
+	ShortUsage: "authorize -limit <fil> -out <file> <client-address>",
+	ShortHelp:  "Authorize a node to pay for retrievals with our funds",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop authorize' command signs an authorization for the node with the given default address to pay
+for its retrievals with the payment channels of our address, up to a limit in FIL. Applications can
+sponsor the retrievals of their users: the user node is started with 'pop start -payer-auth <file>'
+and a -payer-wallet signing with our key, for instance a 'pop signer' we run.
+
+`),
+	Exec: runAuthorize,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("authorize", flag.ExitOnError)
+		fs.StringVar(&authorizeArgs.limit, "limit", "", "most the client can spend in FIL")
+		fs.DurationVar(&authorizeArgs.expires, "expires", 30*24*time.Hour, "how long the authorization is valid")
+		fs.StringVar(&authorizeArgs.out, "out", "", "file to write the authorization to")
+		fs.StringVar(&authorizeArgs.payer, "payer", "", "address paying for the retrievals, defaults to the keystore default address")
+		fs.StringVar(&authorizeArgs.keystore, "keystore", "", "keystore directory, defaults to the repo keystore")
+		return fs
+	})(),
+}
+
+func runAuthorize(ctx context.Context, args []string) error {
+	if len(args) != 1 || authorizeArgs.limit == "" || authorizeArgs.out == "" {
+		return flag.ErrHelp
+	}
+	client, err := address.NewFromString(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid client address: %w", err)
+	}
+	limit, err := filecoin.ParseFIL(authorizeArgs.limit)
+	if err != nil {
+		return fmt.Errorf("invalid limit: %w", err)
+	}
+	dir := authorizeArgs.keystore
+	if dir == "" {
+		path, err := utils.FullPath(utils.RepoPath())
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(path, "keystore")
+	}
+	ks, err := keystore.NewFSKeystore(dir)
+	if err != nil {
+		return err
+	}
+	w := wallet.NewIPFS(ks, nil)
+	payer := w.DefaultAddress()
+	if authorizeArgs.payer != "" {
+		payer, err = address.NewFromString(authorizeArgs.payer)
+		if err != nil {
+			return fmt.Errorf("invalid payer address: %w", err)
+		}
+	}
+	if payer == address.Undef {
+		return fmt.Errorf("no key in keystore %s", dir)
+	}
+
+	sa, err := paychmgr.Authorize(ctx, w, paychmgr.Authorization{
+		Payer:      payer,
+		Client:     client,
+		Limit:      abi.TokenAmount(limit),
+		Expiration: time.Now().Add(authorizeArgs.expires).UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(sa, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(authorizeArgs.out, b, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("==> Authorized %s to spend %s from %s until %s\n", client, limit, payer, sa.Expiration.Local().Format("2006-01-02 15:04"))
+	return nil
+}
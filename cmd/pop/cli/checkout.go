@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var checkoutCmd = &ffcli.Command{
+	Name:       "checkout",
+	ShortUsage: "checkout [<name>]",
+	ShortHelp:  "Switch the workdag files are staged in",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop checkout' command switches the workdag 'pop add', 'pop status' and 'pop pack' operate on
+so files can be staged for several pushes at once. A workdag is created the first time it is checked
+out. Without a name it lists the workdags, the checked out one marked with a '*'.
+
+`),
+	Exec: runCheckout,
+}
+
+func runCheckout(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return flag.ErrHelp
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	crc := make(chan *node.CheckoutResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if cr := n.CheckoutResult; cr != nil {
+			crc <- cr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	var name string
+	if len(args) == 1 {
+		name = args[0]
+	}
+	cc.Checkout(&node.CheckoutArgs{Name: name})
+	select {
+	case cr := <-crc:
+		if cr.Err != "" {
+			return errors.New(cr.Err)
+		}
+		if name != "" {
+			fmt.Printf("==> Switched to workdag %s\n", cr.Name)
+			return nil
+		}
+		for _, w := range cr.Workdags {
+			if w == cr.Name {
+				fmt.Printf("* %s\n", w)
+				continue
+			}
+			fmt.Printf("  %s\n", w)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -7,14 +7,22 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2"
 	"github.com/peterbourgon/ff/v2/ffcli"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
 
+var rootArgs struct {
+	maxMessageSize uint
+	socket         string
+}
+
 // Run runs the CLI. The args do not include the binary name.
 func Run(args []string) error {
 	if len(args) == 1 && (args[0] == "-V" || args[0] == "--version") {
@@ -23,6 +31,8 @@ func Run(args []string) error {
 	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
 
 	rootfs := flag.NewFlagSet("pop", flag.ExitOnError)
+	rootfs.StringVar(&rootArgs.socket, "socket", "", "unix socket or Windows named pipe of the daemon, the local tcp port if empty")
+	rootfs.UintVar(&rootArgs.maxMessageSize, "max-message-size", node.MaxMessageSize, "largest message in bytes exchanged with the daemon, negotiated when connecting")
 
 	rootCmd := &ffcli.Command{
 		Name:       "pop",
@@ -30,18 +40,39 @@ func Run(args []string) error {
 		ShortHelp:  "Manage your Myel point of presence from the command line",
 		LongHelp: strings.TrimSpace(`
 This CLI is still under active development. Commands and flags will
-change in the future. To get started run 'pop start'.
+change in the future. To get started run 'pop init' then 'pop start'.
 `),
 		Subcommands: []*ffcli.Command{
+			initCmd,
 			startCmd,
 			pingCmd,
 			addCmd,
 			statusCmd,
 			packCmd,
+			checkoutCmd,
+			quoteCmd,
 			pushCmd,
 			getCmd,
+			marketCmd,
+			listCmd,
+			regionCmd,
+			inspectCmd,
+			dealsCmd,
+			fundsCmd,
+			costCmd,
+			receiptsCmd,
+			schemaCmd,
+			rulesCmd,
+			askCmd,
+			retrievalsCmd,
+			findCmd,
+			doctorCmd,
+			signerCmd,
+			authorizeCmd,
+			versionCmd,
 		},
 		FlagSet: rootfs,
+		Options: []ff.Option{ff.WithEnvVarPrefix("POP")},
 		Exec:    func(context.Context, []string) error { return flag.ErrHelp },
 	}
 
@@ -57,17 +88,44 @@ change in the future. To get started run 'pop start'.
 }
 
 func connect(ctx context.Context) (net.Conn, *node.CommandClient, context.Context, context.CancelFunc) {
-	c, err := node.SocketConnect()
+	c, err := node.SocketConnect(rootArgs.socket)
 	if err != nil {
 		log.Fatal().Msg("Unable to connect")
 	}
 
+	hello, err := node.Hello(c, uint32(rootArgs.maxMessageSize))
+	if err != nil {
+		log.Fatal().Err(err).Msg("Unable to negotiate message size")
+	}
+
+	var cc *node.CommandClient
+	var wmu sync.Mutex
 	clientToServer := func(b []byte) {
-		node.WriteMsg(c, b)
+		wmu.Lock()
+		defer wmu.Unlock()
+		if err := node.WriteMsgLimit(c, b, cc.MaxMessageSize()); err != nil {
+			log.Error().Err(err).Msg("WriteMsg")
+		}
 	}
 
 	ctx, cancel := context.WithCancel(ctx)
 
+	if hello.IdleTimeout > 0 {
+		// Keep the connection open while we wait for long commands
+		go func() {
+			ticker := time.NewTicker(hello.IdleTimeout / 2)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					clientToServer(nil)
+				}
+			}
+		}()
+	}
+
 	go func() {
 		interrupt := make(chan os.Signal, 1)
 		signal.Notify(interrupt, syscall.SIGINT, syscall.SIGTERM)
@@ -76,7 +134,8 @@ func connect(ctx context.Context) (net.Conn, *node.CommandClient, context.Contex
 		cancel()
 	}()
 
-	cc := node.NewCommandClient(clientToServer)
+	cc = node.NewCommandClient(clientToServer)
+	cc.SetMaxMessageSize(hello.MaxMessageSize)
 	return c, cc, ctx, cancel
 }
 
@@ -84,7 +143,7 @@ func connect(ctx context.Context) (net.Conn, *node.CommandClient, context.Contex
 func receive(ctx context.Context, cc *node.CommandClient, conn net.Conn) {
 	defer conn.Close()
 	for ctx.Err() == nil {
-		msg, err := node.ReadMsg(conn)
+		msg, err := node.ReadMsgLimit(conn, cc.MaxMessageSize())
 		if err != nil {
 			if ctx.Err() != nil {
 				return
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var costArgs struct {
+	period string
+}
+
+var costCmd = &ffcli.Command{
+	Name:       "cost",
+	ShortUsage: "cost <cid>",
+	ShortHelp:  "Print what we spent to store and retrieve a content",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop cost' command prints what we spent on a content root: the price of its storage deals for
+their whole duration, the payments for its retrievals and the gas of the payment channel messages.
+Spending is grouped by the day, week or month it happened in.
+
+`),
+	Exec: runCost,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("cost", flag.ExitOnError)
+		fs.StringVar(&costArgs.period, "period", "day", "group spending by day, week or month")
+		return fs
+	})(),
+}
+
+func runCost(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	crc := make(chan *node.CostResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if cr := n.CostResult; cr != nil {
+			crc <- cr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Cost(&node.CostArgs{Root: args[0], Period: costArgs.period})
+	select {
+	case cr := <-crc:
+		if cr.Err != "" {
+			return errors.New(cr.Err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Period\tStorage\tRetrieval\tGas\tTotal\n")
+		for _, p := range cr.Periods {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.Start.Format("2006-01-02"), p.Storage, p.Retrieval, p.Gas, p.Total)
+		}
+		t := cr.Total
+		fmt.Fprintf(w, "Total\t%s\t%s\t%s\t%s\n", t.Storage, t.Retrieval, t.Gas, t.Total)
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
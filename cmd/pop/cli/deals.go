@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var dealsArgs struct {
+	phase string
+}
+
+var dealsCmd = &ffcli.Command{
+	Name:       "deals",
+	ShortUsage: "deals [<proposal-cid>]",
+	ShortHelp:  "List the storage deals we proposed",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop deals' command lists the Filecoin storage deals our node proposed with their current state,
+most recently updated first. Deals are either active while the miner is receiving and sealing the
+content, sealed once proven on chain, expired or failed.
+
+Given a proposal CID it prints the history of the deal.
+
+`),
+	Exec: runDeals,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("deals", flag.ExitOnError)
+		fs.StringVar(&dealsArgs.phase, "phase", "", "only list deals in this phase: active, sealed, expired or failed")
+		return fs
+	})(),
+}
+
+func runDeals(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return flag.ErrHelp
+	}
+	switch dealsArgs.phase {
+	case "", "active", "sealed", "expired", "failed":
+	default:
+		return fmt.Errorf("unknown deal phase %q", dealsArgs.phase)
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	drc := make(chan *node.DealsResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if dr := n.DealsResult; dr != nil {
+			drc <- dr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	dargs := &node.DealsArgs{Phase: dealsArgs.phase}
+	if len(args) == 1 {
+		dargs.Proposal = args[0]
+	}
+	cc.Deals(dargs)
+	select {
+	case dr := <-drc:
+		if dr.Err != "" {
+			return errors.New(dr.Err)
+		}
+		if dargs.Proposal != "" && len(dr.Deals) == 1 {
+			return printDeal(dr.Deals[0])
+		}
+		if len(dr.Deals) == 0 {
+			fmt.Printf("No deals found.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Proposal\tMiner\tDeal ID\tPhase\tState\tSize\tPrice/epoch\tUpdated\n")
+		for _, d := range dr.Deals {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+				d.ProposalCid, d.Miner, d.DealID, d.Phase, d.State, d.PieceSize, d.Price,
+				d.Updated.Local().Format("2006-01-02 15:04:05"))
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func printDeal(d node.DealEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Proposal\t%s\n", d.ProposalCid)
+	if d.Root != "" {
+		fmt.Fprintf(w, "Root\t%s\n", d.Root)
+	}
+	fmt.Fprintf(w, "Miner\t%s\n", d.Miner)
+	if d.DealID > 0 {
+		fmt.Fprintf(w, "Deal ID\t%d\n", d.DealID)
+	}
+	fmt.Fprintf(w, "Phase\t%s\n", d.Phase)
+	fmt.Fprintf(w, "State\t%s\n", d.State)
+	fmt.Fprintf(w, "Size\t%s\n", d.PieceSize)
+	fmt.Fprintf(w, "Price/epoch\t%s\n", d.Price)
+	if d.Message != "" {
+		fmt.Fprintf(w, "Message\t%s\n", d.Message)
+	}
+	if d.PieceCheck != "" {
+		fmt.Fprintf(w, "Piece check\t%s\n", d.PieceCheck)
+	}
+	for _, t := range d.Transitions {
+		line := fmt.Sprintf("%s\t%s", t.Time.Local().Format("2006-01-02 15:04:05"), t.State)
+		if t.Message != "" {
+			line += ": " + t.Message
+		}
+		fmt.Fprintf(w, "%s\n", line)
+	}
+	return w.Flush()
+}
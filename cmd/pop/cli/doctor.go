@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var doctorArgs struct {
+	bootstrap    string
+	filEndpoint  string
+	filToken     string
+	filTokenType string
+	timeout      time.Duration
+}
+
+var doctorCmd = &ffcli.Command{
+	Name:      "doctor",
+	ShortHelp: "Check the health of the repo and network",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop doctor' command checks the repo permissions, datastore integrity, keys, clock skew,
+connectivity to bootstrap peers and the Filecoin API. It suggests a fix for each failed check.
+The configuration is read from the repo like 'pop start' does and can run without the daemon.
+
+`),
+	Exec: runDoctor,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+		fs.StringVar(&doctorArgs.bootstrap, "bootstrap", "", "bootstrap peer to discover others")
+		fs.StringVar(&doctorArgs.filEndpoint, "fil-endpoint", "", "endpoint to reach a filecoin api")
+		fs.StringVar(&doctorArgs.filToken, "fil-token", "", "token to authorize filecoin api access")
+		fs.StringVar(&doctorArgs.filTokenType, "fil-token-type", "Bearer", "auth token type")
+		fs.DurationVar(&doctorArgs.timeout, "timeout", 10*time.Second, "timeout of each network check")
+		return fs
+	})(),
+	Options: (func() []ff.Option {
+		path, err := utils.FullPath(utils.RepoPath())
+		if err != nil {
+			path = ""
+		}
+		return []ff.Option{
+			ff.WithConfigFile(filepath.Join(path, "PopConfig.json")),
+			ff.WithConfigFileParser(ff.JSONParser),
+			ff.WithAllowMissingConfigFile(true),
+			// Only the network configs are relevant
+			ff.WithIgnoreUndefined(true),
+		}
+	})(),
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	path, err := utils.FullPath(utils.RepoPath())
+	if err != nil {
+		return err
+	}
+
+	var bAddrs []string
+	if doctorArgs.bootstrap != "" {
+		bAddrs = append(bAddrs, doctorArgs.bootstrap)
+	}
+
+	diags := node.Doctor(ctx, node.DoctorOptions{
+		RepoPath:       path,
+		SocketPath:     rootArgs.socket,
+		BootstrapPeers: bAddrs,
+		FilEndpoint:    doctorArgs.filEndpoint,
+		FilToken:       utils.FormatToken(doctorArgs.filToken, doctorArgs.filTokenType),
+		Timeout:        doctorArgs.timeout,
+	})
+
+	failed := 0
+	for _, d := range diags {
+		status := "ok"
+		switch {
+		case d.Skipped:
+			status = "skip"
+		case !d.Ok:
+			status = "fail"
+			failed++
+		}
+		fmt.Printf("[%s] %s: %s\n", status, d.Check, d.Message)
+		if d.Fix != "" && !d.Ok {
+			fmt.Printf("       fix: %s\n", d.Fix)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	fmt.Printf("==> All checks passed\n")
+	return nil
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var findArgs struct {
+	providers int
+	wait      time.Duration
+	timeout   time.Duration
+}
+
+var findCmd = &ffcli.Command{
+	Name:       "find",
+	ShortUsage: "find <cid>",
+	ShortHelp:  "Find the caches serving a content and rank their offers",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop find' command queries the network for caches holding the given content and lists their offers
+best first. Offers are ranked from their price and the round trip time, throughput and reliability we
+measured in past retrievals from each provider. Providers we never retrieved from are ranked by price.
+
+`),
+	Exec: runFind,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("find", flag.ExitOnError)
+		fs.IntVar(&findArgs.providers, "providers", node.DefaultFindProviders, "maximum number of offers to collect")
+		fs.DurationVar(&findArgs.wait, "wait", node.DefaultFindWait, "how long to wait for more offers after the first one")
+		fs.DurationVar(&findArgs.timeout, "timeout", node.DefaultFindTimeout, "how long to wait for a first offer")
+		return fs
+	})(),
+}
+
+func runFind(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: find <cid>")
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	frc := make(chan *node.FindResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if fr := n.FindResult; fr != nil {
+			frc <- fr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Find(&node.FindArgs{
+		Cid:       args[0],
+		Providers: findArgs.providers,
+		Wait:      findArgs.wait,
+		Timeout:   findArgs.timeout,
+	})
+	select {
+	case fr := <-frc:
+		if fr.Err != "" {
+			return errors.New(fr.Err)
+		}
+		if len(fr.Offers) == 0 {
+			fmt.Printf("No offers.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Provider\tPrice\tPrice/Byte\tSize\tRTT\tThroughput\tReliability\tScore\n")
+		for _, o := range fr.Offers {
+			rtt, tp := "-", "-"
+			if o.RTT > 0 {
+				rtt = o.RTT.Round(time.Millisecond).String()
+			}
+			if o.Throughput > 0 {
+				tp = fil.SizeStr(fil.NewInt(uint64(o.Throughput))) + "/s"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%.2f\t%.2f\n",
+				o.Provider, o.Price, o.PricePerByte, o.Size, rtt, tp, o.Reliability, o.Score)
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var fundsArgs struct {
+	withdraw string
+}
+
+var fundsCmd = &ffcli.Command{
+	Name:       "funds",
+	ShortUsage: "funds",
+	ShortHelp:  "Print our funds in the storage market",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop funds' command prints the funds our wallet deposited in the Filecoin storage market.
+Part of the escrow is locked on chain for the payment and collateral of published deals, part is
+reserved for the deals not published yet and the rest is available.
+
+The -withdraw flag moves an amount of the available funds, or all of them, back to our wallet.
+
+`),
+	Exec: runFunds,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("funds", flag.ExitOnError)
+		fs.StringVar(&fundsArgs.withdraw, "withdraw", "", "amount in FIL or 'all' to withdraw the available funds to our wallet")
+		return fs
+	})(),
+}
+
+func runFunds(ctx context.Context, args []string) error {
+	if len(args) > 0 {
+		return flag.ErrHelp
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	frc := make(chan *node.FundsResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if fr := n.FundsResult; fr != nil {
+			frc <- fr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Funds(&node.FundsArgs{Withdraw: fundsArgs.withdraw})
+	select {
+	case fr := <-frc:
+		if fr.Err != "" {
+			return errors.New(fr.Err)
+		}
+		if fr.WithdrawMsg != "" {
+			fmt.Printf("Withdrawal sent in message %s\n", fr.WithdrawMsg)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Address\t%s\n", fr.Address)
+		fmt.Fprintf(w, "Escrow\t%s\n", fr.Escrow)
+		fmt.Fprintf(w, "Locked\t%s\n", fr.Locked)
+		fmt.Fprintf(w, "Reserved\t%s\n", fr.Reserved)
+		fmt.Fprintf(w, "Available\t%s\n", fr.Available)
+		if fr.PendingMsg != "" {
+			fmt.Fprintf(w, "Pending message\t%s\n", fr.PendingMsg)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(fr.Reservations) == 0 {
+			return nil
+		}
+		fmt.Printf("\nReservations:\n")
+		w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Proposal\tMiner\tAmount\tState\n")
+		for _, r := range fr.Reservations {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ProposalCid, r.Miner, r.Amount, r.State)
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,10 +1,12 @@
 package cli
 
 import (
+	"bufio"
 	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/myelnet/pop/node"
@@ -12,60 +14,112 @@ import (
 )
 
 var getArgs struct {
-	selector string
-	output   string
-	timeout  int
-	verbose  bool
-	miner    string
+	selector  string
+	output    string
+	timeout   int
+	verbose   bool
+	miner     string
+	providers int
+	race      int
+	variant   string
+	group     string
+	batch     string
+	maxSpend  string
+	maxBytes  uint64
+	workers   int
 }
 
 var getCmd = &ffcli.Command{
 	Name:       "get",
-	ShortUsage: "get <cid>",
+	ShortUsage: "get <cid|name@version> | get -batch <file>",
 	ShortHelp:  "Retrieve content from the network",
 	LongHelp: strings.TrimSpace(`
 
 The 'pop get' command retrieves blocks with a given root cid and an optional selector
-(defaults retrieves all the linked blocks). Passing an output flag with a path will write the
+(defaults retrieves all the linked blocks). A path after the root such as <cid>/dir/file.png only
+retrieves the DAG of that entry. The selector flag accepts a range of entries as <start>:<end> or a
+selector serialized as dag-json. Passing an output flag with a path will write the
 data to disk. Adding a miner flag will fallback to miner if content is not available on the secondary market.
+A prior version of a publication can be retrieved with <name>@<version> where name is either a publication
+we packed or the root of a later version.
+
+The providers flag compares the offers of several caches and retrieves from the cheapest one. The race
+flag starts the transfer with the cheapest caches at once and keeps the first one to send the first
+blocks, cancelling the others.
+
+The group flag shares the providers and payment channels of related retrievals e.g. all the assets of
+a web page. Retrievals of the same group prefer the caches which served the previous ones and draw from
+funds reserved once in their payment channel instead of adding funds on chain for each retrieval.
+
+The batch flag retrieves all the contents listed one per line in a file as a single session, with the
+output flag as the directory they are written to. The max-spend and max-bytes flags bound the price and
+bytes of the whole batch, contents which would go over the budget are skipped. Each content is reported
+as it completes followed by the totals.
 
 `),
 	Exec: runGet,
 	FlagSet: (func() *flag.FlagSet {
 		fs := flag.NewFlagSet("get", flag.ExitOnError)
-		fs.StringVar(&getArgs.selector, "selector", "all", "select blocks to retrieve for a root cid")
+		fs.StringVar(&getArgs.selector, "selector", "all", "all, a range of entries as <start>:<end> or a dag-json selector")
 		fs.StringVar(&getArgs.output, "output", "", "write the file to the path")
 		fs.IntVar(&getArgs.timeout, "timeout", 60, "timeout before the request should be cancelled by the node (in minutes)")
 		fs.BoolVar(&getArgs.verbose, "verbose", false, "print the state transitions")
 		fs.StringVar(&getArgs.miner, "miner", "", "ask storage miner and use as fallback if network does not have the content")
+		fs.IntVar(&getArgs.providers, "providers", 1, "number of cache offers to compare before retrieving from the cheapest")
+		fs.IntVar(&getArgs.race, "race", 0, "number of caches to start the transfer with, keeping the fastest")
+		fs.StringVar(&getArgs.variant, "variant", "", "retrieve a variant of the file the path points to e.g. gzip")
+		fs.StringVar(&getArgs.group, "group", "", "name of a group of related retrievals sharing providers and payment channels")
+		fs.StringVar(&getArgs.batch, "batch", "", "file listing a content to retrieve per line, retrieved as a single session")
+		fs.StringVar(&getArgs.maxSpend, "max-spend", "", "most FIL a batch may spend, no limit when empty")
+		fs.Uint64Var(&getArgs.maxBytes, "max-bytes", 0, "most bytes a batch may retrieve, 0 for no limit")
+		fs.IntVar(&getArgs.workers, "workers", node.DefaultBatchWorkers, "number of contents of a batch retrieved at once")
 		return fs
 	})(),
 }
 
 func runGet(ctx context.Context, args []string) error {
+	if getArgs.batch != "" {
+		return runBatchGet(ctx)
+	}
+	if len(args) != 1 {
+		return errors.New("usage: get <cid|name@version>")
+	}
+
 	c, cc, ctx, cancel := connect(ctx)
 	defer cancel()
 
 	grc := make(chan *node.GetResult)
+	prc := make(chan *node.ProgressResult, 16)
 	cc.SetNotifyCallback(func(n node.Notify) {
 		if gr := n.GetResult; gr != nil {
 			grc <- gr
 		}
+		if pr := n.ProgressResult; pr != nil {
+			prc <- pr
+		}
 	})
 	go receive(ctx, cc, c)
 
 	cc.Get(&node.GetArgs{
-		Cid:     args[0],
-		Timeout: getArgs.timeout,
-		Sel:     getArgs.selector,
-		Out:     getArgs.output,
-		Verbose: getArgs.verbose,
-		Miner:   getArgs.miner,
+		Cid:       args[0],
+		Timeout:   getArgs.timeout,
+		Sel:       getArgs.selector,
+		Out:       getArgs.output,
+		Verbose:   getArgs.verbose,
+		Miner:     getArgs.miner,
+		Providers: getArgs.providers,
+		Race:      getArgs.race,
+		Variant:   getArgs.variant,
+		Group:     getArgs.group,
 	})
 
+	var bar progressBar
 	for {
 		select {
+		case pr := <-prc:
+			bar.print(pr)
 		case gr := <-grc:
+			bar.clear()
 			if gr.Err != "" {
 				return errors.New(gr.Err)
 			}
@@ -96,3 +150,82 @@ func runGet(ctx context.Context, args []string) error {
 		}
 	}
 }
+
+// readBatch returns the refs listed in a batch file skipping blank lines and # comments
+func readBatch(name string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var refs []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	return refs, s.Err()
+}
+
+func runBatchGet(ctx context.Context) error {
+	refs, err := readBatch(getArgs.batch)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		return errors.New("nothing to retrieve in the batch file")
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	brc := make(chan *node.BatchGetResult)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if br := n.BatchGetResult; br != nil {
+			brc <- br
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.BatchGet(&node.BatchGetArgs{
+		Refs:      refs,
+		Sel:       getArgs.selector,
+		Out:       getArgs.output,
+		Timeout:   getArgs.timeout,
+		Providers: getArgs.providers,
+		Workers:   getArgs.workers,
+		MaxSpend:  getArgs.maxSpend,
+		MaxBytes:  getArgs.maxBytes,
+		Group:     getArgs.group,
+	})
+
+	for {
+		select {
+		case br := <-brc:
+			if br.Err != "" {
+				return errors.New(br.Err)
+			}
+			if it := br.Item; it != nil {
+				switch {
+				case it.Err != "":
+					fmt.Printf("==> Failed %s: %s\n", it.Ref, it.Err)
+				case it.Local:
+					fmt.Printf("==> Already had %s\n", it.Ref)
+				default:
+					fmt.Printf("==> Retrieved %s (%s) for %s\n", it.Ref, it.Size, it.TotalPrice)
+				}
+				continue
+			}
+			fmt.Printf("==> Completed %d, failed %d, spent %s for %s\n", br.Completed, br.Failed, br.TotalSpent, br.TotalBytes)
+			if br.Failed > 0 {
+				return fmt.Errorf("failed to retrieve %d of %d contents", br.Failed, len(refs))
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("Get operation timed out")
+		}
+	}
+}
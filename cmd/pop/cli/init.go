@@ -0,0 +1,178 @@
+package cli
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/filecoin-project/go-address"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/myelnet/pop/wallet"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var initCmd = &ffcli.Command{
+	Name:      "init",
+	ShortHelp: "Setup a new pop repo",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop init' command walks through the configuration of a new repo: the regions to join,
+the Filecoin API, the storage capacity to advertise and the wallet used for payments. The configuration
+is written to PopConfig.json in the repo and used by 'pop start'. Running it again on an existing
+repo updates the configuration.
+
+`),
+	Exec:    runInit,
+	FlagSet: flag.NewFlagSet("init", flag.ExitOnError),
+}
+
+func runInit(ctx context.Context, args []string) error {
+	path, err := utils.FullPath(utils.RepoPath())
+	if err != nil {
+		return err
+	}
+	exists, err := utils.RepoExists(path)
+	if err != nil {
+		return err
+	}
+	if exists {
+		update := false
+		survey.AskOne(&survey.Confirm{
+			Message: fmt.Sprintf("A repo already exists in %s, update its configuration?", path),
+		}, &update)
+		if !update {
+			return nil
+		}
+		// Start from the current configuration
+		if data, err := os.ReadFile(filepath.Join(path, "PopConfig.json")); err == nil {
+			json.Unmarshal(data, &startArgs)
+		}
+	}
+
+	startArgs.Regions = strings.Join(setupRegions(), ",")
+
+	if err := survey.Ask(filecoinQuestions(), &startArgs); err != nil {
+		return err
+	}
+
+	var capacity string
+	err = survey.AskOne(&survey.Input{
+		Message: "Storage capacity to advertise in GiB (0 to only cache content we retrieve)",
+		Default: strconv.FormatUint(startArgs.Capacity>>30, 10),
+	}, &capacity, survey.WithValidator(func(ans interface{}) error {
+		_, err := strconv.ParseUint(ans.(string), 10, 64)
+		return err
+	}))
+	if err != nil {
+		return err
+	}
+	gib, _ := strconv.ParseUint(capacity, 10, 64)
+	startArgs.Capacity = gib << 30
+
+	if err := writeConfig(path); err != nil {
+		return err
+	}
+
+	var api fil.API
+	if startArgs.FilEndpoint != "" {
+		api, err = fil.NewLotusRPC(ctx, startArgs.FilEndpoint, http.Header{
+			"Authorization": []string{utils.FormatToken(startArgs.FilToken, startArgs.FilTokenType)},
+		})
+		if err != nil {
+			fmt.Printf("==> Failed to connect to the Filecoin API: %v\n", err)
+			api = nil
+		} else {
+			defer api.Close()
+		}
+	}
+
+	kspath := filepath.Join(path, "keystore")
+	// Keys must only be readable by the user running the node
+	if err := os.MkdirAll(kspath, 0700); err != nil {
+		return err
+	}
+	ks, err := keystore.NewFSKeystore(kspath)
+	if err != nil {
+		return err
+	}
+	w := wallet.NewIPFS(ks, api)
+	addr, err := setupInitWallet(ctx, w)
+	if err != nil {
+		return err
+	}
+	if api != nil {
+		bal, err := w.Balance(ctx, addr)
+		switch {
+		case err != nil:
+			fmt.Printf("==> Could not check the balance of %s, send FIL to this address to pay for storage and retrievals\n", addr)
+		case bal.IsZero():
+			fmt.Printf("==> %s has no funds, send FIL to this address to pay for storage and retrievals\n", addr)
+		default:
+			fmt.Printf("==> %s has a balance of %s\n", addr, fil.FIL(bal))
+		}
+	}
+
+	fmt.Printf("==> Initialized pop repo in %s, run 'pop start' to start your node\n", path)
+	return nil
+}
+
+// setupInitWallet makes sure the wallet has a default address, generating or importing one
+func setupInitWallet(ctx context.Context, w wallet.Driver) (address.Address, error) {
+	if addr := w.DefaultAddress(); addr != address.Undef {
+		fmt.Printf("==> Using default address %s\n", addr)
+		return addr, nil
+	}
+
+	var a int
+	survey.AskOne(&survey.Select{
+		Message: "Setup wallet",
+		Options: []string{
+			"Generate a default address",
+			"Import a new address",
+		},
+	}, &a)
+	if a == 0 {
+		addr, err := w.NewKey(ctx, wallet.KTSecp256k1)
+		if err != nil {
+			return address.Undef, err
+		}
+		fmt.Printf("==> Generated default address %s\n", addr)
+		return addr, nil
+	}
+
+	var kpath string
+	survey.AskOne(&survey.Input{
+		Message: "Path to hex encoded key file",
+	}, &kpath, survey.WithValidator(survey.Required))
+	fdata, err := os.ReadFile(kpath)
+	if err != nil {
+		return address.Undef, err
+	}
+	data, err := hex.DecodeString(strings.TrimSpace(string(fdata)))
+	if err != nil {
+		return address.Undef, err
+	}
+	var iki wallet.KeyInfo
+	if err := json.Unmarshal(data, &iki); err != nil {
+		return address.Undef, err
+	}
+	addr, err := w.ImportKey(ctx, &iki)
+	if err != nil {
+		return address.Undef, err
+	}
+	if err := w.SetDefaultAddress(addr); err != nil {
+		return address.Undef, err
+	}
+	fmt.Printf("==> Imported private key for %s\n", addr)
+	return addr, nil
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var inspectCmd = &ffcli.Command{
+	Name:       "inspect",
+	ShortUsage: "inspect <cid>",
+	ShortHelp:  "Inspect the record of a content we provide",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop inspect' command prints the record our node keeps for a content root: the store holding
+its blocks, its size, the region we received it for and all its labels.
+
+`),
+	Exec: runInspect,
+}
+
+func runInspect(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return flag.ErrHelp
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	irc := make(chan *node.InspectResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if ir := n.InspectResult; ir != nil {
+			irc <- ir
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Inspect(&node.InspectArgs{Ref: args[0]})
+	select {
+	case ir := <-irc:
+		if ir.Err != "" {
+			return errors.New(ir.Err)
+		}
+		e := ir.Content
+		region := e.Region
+		if region == "" {
+			region = "local"
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Root\t%s\n", e.Root)
+		fmt.Fprintf(w, "Store\t%d\n", e.StoreID)
+		fmt.Fprintf(w, "Size\t%s\n", e.Size)
+		fmt.Fprintf(w, "Region\t%s\n", region)
+		if !e.ReceivedAt.IsZero() && e.ReceivedAt.Unix() > 0 {
+			fmt.Fprintf(w, "Received\t%s\n", e.ReceivedAt.Local().Format("2006-01-02 15:04:05"))
+		}
+		keys := make([]string, 0, len(e.Labels))
+		for k := range e.Labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "Label\t%s=%s\n", k, e.Labels[k])
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var listArgs struct {
+	offset int
+	limit  int
+	labels string
+}
+
+var listCmd = &ffcli.Command{
+	Name:       "list",
+	ShortUsage: "list",
+	ShortHelp:  "List the content our node is providing",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop list' command lists the content our node is currently caching or providing, most recently
+received first. Results can be filtered by record labels such as region or store.
+
+Examples:
+  pop list --limit 10
+  pop list --labels region=Europe
+  pop list --labels pinned
+
+`),
+	Exec: runList,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("list", flag.ExitOnError)
+		fs.IntVar(&listArgs.offset, "offset", 0, "number of entries to skip")
+		fs.IntVar(&listArgs.limit, "limit", 20, "maximum number of entries to list, 0 for all")
+		fs.StringVar(&listArgs.labels, "labels", "", "comma separated labels to filter by as key=value or key")
+		return fs
+	})(),
+}
+
+// parseLabels parses a comma separated list of key=value pairs. Keys without a value match any value.
+func parseLabels(s string) map[string]string {
+	if s == "" {
+		return nil
+	}
+	labels := make(map[string]string)
+	for _, kv := range strings.Split(s, ",") {
+		sp := strings.SplitN(kv, "=", 2)
+		if len(sp) == 2 {
+			labels[sp[0]] = sp[1]
+			continue
+		}
+		labels[sp[0]] = ""
+	}
+	return labels
+}
+
+func runList(ctx context.Context, args []string) error {
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	lrc := make(chan *node.ListResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if lr := n.ListResult; lr != nil {
+			lrc <- lr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.List(&node.ListArgs{
+		Offset: listArgs.offset,
+		Limit:  listArgs.limit,
+		Labels: parseLabels(listArgs.labels),
+	})
+	select {
+	case lr := <-lrc:
+		if lr.Err != "" {
+			return errors.New(lr.Err)
+		}
+		if len(lr.Entries) == 0 {
+			fmt.Printf("No content found.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Root\tSize\tStore\tRegion\tReceived\n")
+		for _, e := range lr.Entries {
+			region := e.Region
+			if region == "" {
+				region = "local"
+			}
+			received := "-"
+			if !e.ReceivedAt.IsZero() && e.ReceivedAt.Unix() > 0 {
+				received = e.ReceivedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", e.Root, e.Size, e.StoreID, region, received)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("==> Showing %d-%d of %d\n", listArgs.offset+1, listArgs.offset+len(lr.Entries), lr.Total)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var marketProvidersArgs struct {
+	region      string
+	minCapacity uint64
+	maxPrice    string
+}
+
+var marketCmd = &ffcli.Command{
+	Name:       "market",
+	ShortUsage: "market <subcommand>",
+	ShortHelp:  "Browse the cache capacity market",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop market' commands give access to the listings caches publish in our regions to advertise
+their available capacity and price.
+
+`),
+	Subcommands: []*ffcli.Command{
+		marketProvidersCmd,
+	},
+	Exec: func(context.Context, []string) error { return flag.ErrHelp },
+}
+
+var marketProvidersCmd = &ffcli.Command{
+	Name:       "providers",
+	ShortUsage: "market providers",
+	ShortHelp:  "List cache providers matching our needs",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop market providers' command lists the caches currently advertising capacity in our regions,
+cheapest first.
+
+`),
+	Exec: runMarketProviders,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("providers", flag.ExitOnError)
+		fs.StringVar(&marketProvidersArgs.region, "region", "", "only list providers in this region")
+		fs.Uint64Var(&marketProvidersArgs.minCapacity, "min-capacity", 0, "minimum available capacity in bytes")
+		fs.StringVar(&marketProvidersArgs.maxPrice, "max-price", "", "maximum price per byte in FIL")
+		return fs
+	})(),
+}
+
+func runMarketProviders(ctx context.Context, args []string) error {
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	mrc := make(chan *node.MarketResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if mr := n.MarketResult; mr != nil {
+			mrc <- mr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Market(&node.MarketArgs{
+		Region:      marketProvidersArgs.region,
+		MinCapacity: marketProvidersArgs.minCapacity,
+		MaxPrice:    marketProvidersArgs.maxPrice,
+	})
+	select {
+	case mr := <-mrc:
+		if mr.Err != "" {
+			return errors.New(mr.Err)
+		}
+		if len(mr.Providers) == 0 {
+			fmt.Printf("No providers found.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Provider\tRegion\tCapacity\tPrice/byte\n")
+		for _, p := range mr.Providers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.Provider, p.Region, p.Capacity, p.PricePerByte)
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
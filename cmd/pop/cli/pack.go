@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"strings"
 	"text/tabwriter"
@@ -13,16 +14,34 @@ import (
 	"github.com/peterbourgon/ff/v2/ffcli"
 )
 
+var packArgs struct {
+	name       string
+	hash       string
+	transforms string
+	workdag    string
+}
+
 var packCmd = &ffcli.Command{
 	Name:      "pack",
 	ShortHelp: "Pack the current index into a DAG archive",
 	LongHelp: strings.TrimSpace(`
 
 The 'pop pack' command creates a single DAG with the current index of staged DAGs. 
-It archives it into a CAR file ready for storage.
+It archives it into a CAR file ready for storage. Each pack is a new version of a publication
+linking to the previous one so prior versions can be retrieved with 'pop get <name>@<version>'.
+Transforms derive variants of the staged files such as gzip precompressed assets which are
+recorded in the manifest and retrieved with 'pop get -variant gzip <ref>/<file>'.
 
 `),
 	Exec: runCommit,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("pack", flag.ExitOnError)
+		fs.StringVar(&packArgs.name, "name", "", "name of the publication the pack is a new version of")
+		fs.StringVar(&packArgs.hash, "hash", "blake2b-256", "hash function of the root: blake2b-256, sha2-256 or blake3")
+		fs.StringVar(&packArgs.transforms, "transforms", "", "transforms deriving variants of the staged files separated by commas e.g. gzip")
+		fs.StringVar(&packArgs.workdag, "workdag", "", "name of the workdag to pack instead of the checked out one")
+		return fs
+	})(),
 }
 
 func runCommit(ctx context.Context, args []string) error {
@@ -37,7 +56,16 @@ func runCommit(ctx context.Context, args []string) error {
 	})
 	go receive(ctx, cc, c)
 
-	cc.Pack(&node.PackArgs{})
+	var transforms []string
+	if packArgs.transforms != "" {
+		transforms = strings.Split(packArgs.transforms, ",")
+	}
+	cc.Pack(&node.PackArgs{
+		Name:       packArgs.name,
+		HashFunc:   packArgs.hash,
+		Transforms: transforms,
+		Workdag:    packArgs.workdag,
+	})
 	select {
 	case pr := <-prc:
 		if pr.Err != "" {
@@ -45,6 +73,11 @@ func runCommit(ctx context.Context, args []string) error {
 		}
 		buf := bytes.NewBuffer(nil)
 		fmt.Fprintf(buf, "==> Packed workdag into single dag for transport\n")
+		if pr.Name != "" {
+			fmt.Fprintf(buf, "==> Version %d of %s\n", pr.Version, pr.Name)
+		} else {
+			fmt.Fprintf(buf, "==> Version %d\n", pr.Version)
+		}
 		w := new(tabwriter.Writer)
 		w.Init(buf, 0, 4, 2, ' ', 0)
 		fmt.Fprintf(
@@ -59,6 +92,7 @@ func runCommit(ctx context.Context, args []string) error {
 			pr.PieceCID,
 			filecoin.SizeStr(filecoin.NewInt(uint64(pr.PieceSize))),
 		)
+		fmt.Fprintf(w, "Store\t%d\t\n", pr.StoreID)
 		w.Flush()
 		fmt.Printf(buf.String())
 		return nil
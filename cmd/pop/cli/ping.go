@@ -59,7 +59,15 @@ PeerID         %s
 Addresses      %s
 Peers          %s
 Latency (s)    %f
-		`, pr.ID, pr.Addrs, pr.Peers, pr.LatencySeconds)
+Version        %s
+		`, pr.ID, pr.Addrs, pr.Peers, pr.LatencySeconds, pr.Version)
+		if len(pr.Regions) > 0 {
+			fmt.Printf("\nRegions        %s", pr.Regions)
+		}
+		if pr.DetectedRegion != "" {
+			fmt.Printf("\nDetected       %s (from IP geolocation)", pr.DetectedRegion)
+		}
+		fmt.Printf("\n")
 
 	case <-ctx.Done():
 		return ctx.Err()
@@ -0,0 +1,57 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/node"
+)
+
+// progressWidth is the number of characters of a progress bar
+const progressWidth = 30
+
+// progressBar renders the progress of transfers on the current line of the terminal
+type progressBar struct {
+	// open is set while the line of a bar isn't terminated
+	open bool
+}
+
+// print redraws the bar with the progress of a transfer and terminates its line once it's done
+func (b *progressBar) print(p *node.ProgressResult) {
+	size := fil.SizeStr(fil.NewInt(p.Bytes))
+	bar := ""
+	if p.Total > 0 {
+		ratio := float64(p.Bytes) / float64(p.Total)
+		if ratio > 1 {
+			ratio = 1
+		}
+		n := int(ratio * progressWidth)
+		bar = fmt.Sprintf("[%s%s] %3.0f%% ", strings.Repeat("=", n), strings.Repeat(" ", progressWidth-n), ratio*100)
+		size += "/" + fil.SizeStr(fil.NewInt(p.Total))
+	}
+	peer := p.Peer
+	if len(peer) > 8 {
+		peer = "…" + peer[len(peer)-8:]
+	}
+	line := fmt.Sprintf("%s %s%s", peer, bar, size)
+	if p.Blocks > 0 {
+		line += fmt.Sprintf(", %d blocks", p.Blocks)
+	}
+	if p.Status != "" {
+		line += " - " + p.Status
+	}
+	fmt.Printf("\r%-100s", line)
+	b.open = !p.Done
+	if p.Done {
+		fmt.Printf("\n")
+	}
+}
+
+// clear terminates the line of an unfinished bar so we can print below it
+func (b *progressBar) clear() {
+	if b.open {
+		fmt.Printf("\n")
+		b.open = false
+	}
+}
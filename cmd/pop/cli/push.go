@@ -6,22 +6,33 @@ import (
 	"flag"
 	"fmt"
 	"net"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/AlecAivazis/survey/v2"
 	fil "github.com/myelnet/pop/filecoin"
 	"github.com/myelnet/pop/node"
+	"github.com/myelnet/pop/supply"
 	"github.com/peterbourgon/ff/v2/ffcli"
 )
 
 var pushArgs struct {
-	noCache   bool
-	cacheOnly bool
-	cacheRF   int
-	storageRF int
-	duration  time.Duration
-	maxPrice  uint64
+	noCache    bool
+	cacheOnly  bool
+	cacheRF    int
+	storageRF  int
+	duration   time.Duration
+	maxPrice   uint64
+	announce   bool
+	regionRF   string
+	queue      bool
+	label      string
+	cachePrice string
+	verified   bool
+	offline    bool
+	pieceDir   string
+	refresh    bool
 }
 
 var pushCmd = &ffcli.Command{
@@ -42,8 +53,17 @@ with a default level of cashing. By default it will attempt multiple storage dea
 		fs.DurationVar(&pushArgs.duration, "duration", 24*time.Hour*time.Duration(180), "duration we need the content stored for")
 		fs.BoolVar(&pushArgs.noCache, "no-cache", false, "prevents node from dispatching content to cache providers")
 		fs.BoolVar(&pushArgs.cacheOnly, "cache-only", false, "only dispatch content for caching")
+		fs.BoolVar(&pushArgs.announce, "announce", false, "announce the content to all the caches in our regions instead of dispatching to connected caches")
+		fs.StringVar(&pushArgs.regionRF, "region-rf", "", "cache replication factor of each region e.g. Europe=5,Asia=3")
+		fs.BoolVar(&pushArgs.queue, "queue", false, "queue the push until the node is online instead of failing when it has no peers or Filecoin API")
 		// MaxStoragePrice is our price ceiling to filter out bad storage miners who charge too much
 		fs.Uint64Var(&pushArgs.maxPrice, "max-storage-price", uint64(20_000_000_000), "maximum price per byte our node is willing to pay for storage")
+		fs.StringVar(&pushArgs.label, "label", "", "label recorded in the storage deal proposals e.g. a project identifier")
+		fs.StringVar(&pushArgs.cachePrice, "cache-price", "", "price per byte in FIL we offer caches to keep the content")
+		fs.BoolVar(&pushArgs.verified, "verified", false, "make verified (FIL+) storage deals paid with the datacap of our wallet")
+		fs.BoolVar(&pushArgs.offline, "offline", false, "propose offline deals and export the piece to a CAR file to ship to the miners")
+		fs.StringVar(&pushArgs.pieceDir, "piece-dir", ".", "directory the CAR file of offline deals is written to")
+		fs.BoolVar(&pushArgs.refresh, "refresh", false, "query all the miners again instead of reusing cached asks")
 		return fs
 	})(),
 }
@@ -53,6 +73,26 @@ func runPush(ctx context.Context, args []string) error {
 		return errors.New("no-cache and cache-only are incompatible")
 	}
 
+	regionRF, err := supply.ParseReplicationPolicy(pushArgs.regionRF)
+	if err != nil {
+		return err
+	}
+	if len(regionRF) > 0 && pushArgs.announce {
+		return errors.New("region-rf and announce are incompatible")
+	}
+
+	pieceDir := ""
+	if pushArgs.offline {
+		if pushArgs.cacheOnly {
+			return errors.New("offline and cache-only are incompatible")
+		}
+		// The daemon may not run in our working directory
+		pieceDir, err = filepath.Abs(pushArgs.pieceDir)
+		if err != nil {
+			return err
+		}
+	}
+
 	ref := ""
 	if len(args) > 0 {
 		ref = args[0]
@@ -62,49 +102,137 @@ func runPush(ctx context.Context, args []string) error {
 	defer cancel()
 
 	prc := make(chan *node.PushResult, 1)
+	progc := make(chan *node.ProgressResult, 16)
 	cc.SetNotifyCallback(func(n node.Notify) {
 		if pr := n.PushResult; pr != nil {
 			prc <- pr
 		}
+		if p := n.ProgressResult; p != nil {
+			progc <- p
+		}
 	})
 	go receive(ctx, cc, c)
 
 	var miners map[string]bool
-	var err error
 
 	// When only pushing content to caches we don't ask for a quote
 	if !pushArgs.cacheOnly {
 		miners, err = runQuote(ctx, c, cc, ref)
+		// Miners are selected from a fresh quote when the queued push runs
+		if err != nil && pushArgs.queue && err.Error() == node.ErrFilecoinRPCOffline.Error() {
+			err = nil
+		}
 		if err != nil {
 			return err
 		}
 	}
 
 	cc.Push(&node.PushArgs{
-		Ref:       ref,
-		NoCache:   pushArgs.noCache,
-		CacheOnly: pushArgs.cacheOnly,
-		CacheRF:   pushArgs.cacheRF,
-		StorageRF: pushArgs.storageRF,
-		Duration:  pushArgs.duration,
-		Miners:    miners,
+		Ref:        ref,
+		NoCache:    pushArgs.noCache,
+		CacheOnly:  pushArgs.cacheOnly,
+		CacheRF:    pushArgs.cacheRF,
+		StorageRF:  pushArgs.storageRF,
+		Duration:   pushArgs.duration,
+		Miners:     miners,
+		Announce:   pushArgs.announce,
+		RegionRF:   regionRF,
+		Queue:      pushArgs.queue,
+		MaxPrice:   pushArgs.maxPrice,
+		Label:      pushArgs.label,
+		CachePrice: pushArgs.cachePrice,
+		Verified:   pushArgs.verified,
+		Offline:    pushArgs.offline,
+		PieceDir:   pieceDir,
 	})
+	caching := !pushArgs.noCache && (pushArgs.cacheRF > 0 || len(regionRF) > 0)
+	// We wait for the data of all our deals to be sent to the miners
+	var deals int
+	settled := make(map[string]bool)
+	uploaded := func() bool {
+		return len(settled) >= deals
+	}
+	var bar progressBar
 	for {
 		select {
+		case p := <-progc:
+			bar.print(p)
 		case pr := <-prc:
+			bar.clear()
 			if pr.Err != "" {
 				return errors.New(pr.Err)
 			}
+			if pr.Queued != "" {
+				fmt.Printf("Node is offline, queued %s until it reconnects\n", pr.Queued)
+				return nil
+			}
+			if t := pr.Transfer; t != nil {
+				printTransfer(t)
+				if t.Done {
+					settled[t.Deal] = true
+				}
+				if deals > 0 && uploaded() && !caching {
+					return nil
+				}
+				continue
+			}
 			if len(pr.Miners) > 0 {
 				fmt.Printf("Started storage deals with %s\n", pr.Miners)
-				if !pushArgs.noCache && pushArgs.cacheRF > 0 {
+				for m, reason := range pr.FailedDeals {
+					fmt.Printf("Failed to start a deal with %s: %s\n", m, reason)
+				}
+				if pr.Label != "" {
+					fmt.Printf("Deals labeled %q\n", pr.Label)
+				}
+				if pr.PieceCID != "" {
+					fmt.Printf("Root %s stored in piece %s (%s padded)\n", pr.Root, pr.PieceCID, fil.SizeStr(fil.NewInt(pr.PieceSize)))
+				}
+				for m, proposal := range pr.Proposals {
+					fmt.Printf("Deal proposal %s with %s\n", proposal, m)
+				}
+				if pr.PieceFile != "" {
+					// No data is sent for offline deals
+					fmt.Printf("Exported piece %s to %s\n", pr.PieceCID, pr.PieceFile)
+					fmt.Printf("Ship the file to the miners so they can import it for the deals %s\n", pr.Deals)
+				} else {
+					deals = len(pr.Deals)
+				}
+				if caching {
 					// Wait for the result of our cache dispatch
 					fmt.Printf("Dispatching to caches...\n")
+				}
+				if caching || !uploaded() {
 					continue
 				}
 			}
-			if len(pr.Caches) > 0 {
-				fmt.Printf("Cached by %s\n", pr.Caches)
+			if pr.CacheAttempted > 0 {
+				fmt.Printf("Cached by %d/%d providers %s\n", len(pr.Caches), pr.CacheAttempted, pr.Caches)
+				if pr.CachePending > 0 {
+					fmt.Printf("%d providers are still pulling the content\n", pr.CachePending)
+				}
+				for p, reason := range pr.CacheFailures {
+					fmt.Printf("Failed to dispatch to %s: %s\n", p, reason)
+				}
+				for region, n := range pr.RegionCaches {
+					fmt.Printf("%s: cached by %d providers\n", region, n)
+				}
+				for region, gw := range pr.Relays {
+					fmt.Printf("%s: relayed through gateway %s\n", region, gw)
+				}
+				for region, missing := range pr.Shortfalls {
+					fmt.Printf("%s: %d providers short of the replication factor\n", region, missing)
+				}
+				if pr.Publication != "" {
+					fmt.Printf("Published %s\n", pr.Publication)
+				}
+				if pr.Previous != "" {
+					fmt.Printf("Sent %d new blocks on top of %s\n", pr.DiffBlocks, pr.Previous)
+				}
+			}
+			caching = false
+			if !uploaded() {
+				fmt.Printf("Uploading to storage miners...\n")
+				continue
 			}
 			return nil
 		case <-ctx.Done():
@@ -113,6 +241,22 @@ func runPush(ctx context.Context, args []string) error {
 	}
 }
 
+// printTransfer prints the progress of the data sent to a storage miner
+func printTransfer(t *node.DealTransfer) {
+	sent := fil.SizeStr(fil.NewInt(t.Sent))
+	if t.Total > 0 {
+		sent += "/" + fil.SizeStr(fil.NewInt(t.Total))
+	}
+	switch {
+	case t.Err != "":
+		fmt.Printf("Failed to send data to %s after %s: %s\n", t.Miner, sent, t.Err)
+	case t.Done:
+		fmt.Printf("Sent %s to %s, transfer complete\n", sent, t.Miner)
+	default:
+		fmt.Printf("Sent %s to %s\n", sent, t.Miner)
+	}
+}
+
 func runQuote(ctx context.Context, c net.Conn, cc *node.CommandClient, ref string) (map[string]bool, error) {
 	qrc := make(chan *node.QuoteResult, 1)
 	cc.SetNotifyCallback(func(n node.Notify) {
@@ -129,6 +273,8 @@ func runQuote(ctx context.Context, c net.Conn, cc *node.CommandClient, ref strin
 		Duration:  pushArgs.duration,
 		StorageRF: pushArgs.storageRF,
 		MaxPrice:  pushArgs.maxPrice,
+		Verified:  pushArgs.verified,
+		Refresh:   pushArgs.refresh,
 	})
 
 	miners := make(map[string]bool)
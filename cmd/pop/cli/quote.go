@@ -0,0 +1,105 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var quoteArgs struct {
+	storageRF  int
+	duration   time.Duration
+	maxPrice   uint64
+	verified   bool
+	refresh    bool
+	budget     string
+	maxLatency time.Duration
+}
+
+var quoteCmd = &ffcli.Command{
+	Name:       "quote",
+	ShortUsage: "quote <archive-cid>",
+	ShortHelp:  "Get the price of storing a DAG archive with Filecoin miners",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop quote' command prints the miners who can store a DAG archive previously generated using 'pop pack'
+and their price. Miner asks are cached until they expire so repeated quotes are instantaneous, pass -refresh
+to query all the miners again. Passing no commit CID will result in selecting the last generated commit.
+
+`),
+	Exec: runQuoteCmd,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("quote", flag.ExitOnError)
+		fs.IntVar(&quoteArgs.storageRF, "storage-rf", 6, "number of storage providers to start deals with")
+		fs.DurationVar(&quoteArgs.duration, "duration", 24*time.Hour*time.Duration(180), "duration we need the content stored for")
+		fs.Uint64Var(&quoteArgs.maxPrice, "max-storage-price", uint64(20_000_000_000), "maximum price per byte our node is willing to pay for storage")
+		fs.BoolVar(&quoteArgs.verified, "verified", false, "quote the price of verified (FIL+) storage deals")
+		fs.BoolVar(&quoteArgs.refresh, "refresh", false, "query all the miners again instead of reusing cached asks")
+		fs.StringVar(&quoteArgs.budget, "budget", "", "most we pay in FIL for all the deals, picks the cheapest miners within the budget")
+		fs.DurationVar(&quoteArgs.maxLatency, "max-latency", 0, "exclude miners slower to answer our pings e.g. 500ms")
+		return fs
+	})(),
+}
+
+func runQuoteCmd(ctx context.Context, args []string) error {
+	ref := ""
+	if len(args) > 0 {
+		ref = args[0]
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	qrc := make(chan *node.QuoteResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if qr := n.QuoteResult; qr != nil {
+			qrc <- qr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Quote(&node.QuoteArgs{
+		Ref:        ref,
+		Duration:   quoteArgs.duration,
+		StorageRF:  quoteArgs.storageRF,
+		MaxPrice:   quoteArgs.maxPrice,
+		Verified:   quoteArgs.verified,
+		Refresh:    quoteArgs.refresh,
+		Budget:     quoteArgs.budget,
+		MaxLatency: quoteArgs.maxLatency,
+	})
+
+	select {
+	case qr := <-qrc:
+		if qr.Err != "" {
+			return errors.New(qr.Err)
+		}
+		var miners []string
+		for m := range qr.Quotes {
+			miners = append(miners, m)
+		}
+		sort.Strings(miners)
+
+		fmt.Printf("Storage quote for %s\n", qr.Ref)
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Miner\tPrice\n")
+		for _, m := range miners {
+			fmt.Fprintf(w, "%s\t%s\n", m, qr.Quotes[m])
+		}
+		if qr.Total != "" {
+			fmt.Fprintf(w, "Total\t%s\n", qr.Total)
+		}
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,66 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var receiptsCmd = &ffcli.Command{
+	Name:       "receipts",
+	ShortUsage: "receipts <cid> [<peer-id>...]",
+	ShortHelp:  "Sum the bytes the caches of a content served to their clients",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop receipts' command asks the caches of a content for the receipts they countersigned. Each
+receipt is issued by the client who received the bytes so caches cannot claim bytes on their own.
+Without peer IDs it asks the caches we dispatched the content to.
+
+`),
+	Exec: runReceipts,
+}
+
+func runReceipts(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return flag.ErrHelp
+	}
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	rrc := make(chan *node.ReceiptsResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if rr := n.ReceiptsResult; rr != nil {
+			rrc <- rr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Receipts(&node.ReceiptsArgs{Root: args[0], Providers: args[1:]})
+	select {
+	case rr := <-rrc:
+		if rr.Err != "" {
+			return errors.New(rr.Err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Provider\tReceipts\tServed\n")
+		for _, p := range rr.Providers {
+			if p.Err != "" {
+				fmt.Fprintf(w, "%s\t-\t%s\n", p.Provider, p.Err)
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", p.Provider, p.Receipts, filecoin.SizeStr(filecoin.NewInt(p.Bytes)))
+		}
+		fmt.Fprintf(w, "Total\t\t%s\n", filecoin.SizeStr(filecoin.NewInt(rr.Bytes)))
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,120 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var regionCmd = &ffcli.Command{
+	Name:       "region",
+	ShortUsage: "region <subcommand>",
+	ShortHelp:  "Manage the regions our node is part of",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop region' commands let a running node join and leave regions without restarting.
+The active regions are remembered across restarts. Without subcommand it lists the regions we are part of.
+
+`),
+	Subcommands: []*ffcli.Command{
+		regionJoinCmd,
+		regionLeaveCmd,
+		regionStatsCmd,
+	},
+	Exec: func(ctx context.Context, args []string) error {
+		return runRegion(ctx, &node.RegionArgs{})
+	},
+}
+
+var regionJoinCmd = &ffcli.Command{
+	Name:       "join",
+	ShortUsage: "region join <region>",
+	ShortHelp:  "Join a region",
+	Exec: func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return flag.ErrHelp
+		}
+		return runRegion(ctx, &node.RegionArgs{Join: args[0]})
+	},
+}
+
+var regionLeaveCmd = &ffcli.Command{
+	Name:       "leave",
+	ShortUsage: "region leave <region>",
+	ShortHelp:  "Leave a region",
+	Exec: func(ctx context.Context, args []string) error {
+		if len(args) != 1 {
+			return flag.ErrHelp
+		}
+		return runRegion(ctx, &node.RegionArgs{Leave: args[0]})
+	},
+}
+
+var regionStatsCmd = &ffcli.Command{
+	Name:       "stats",
+	ShortUsage: "region stats [region]",
+	ShortHelp:  "Show the health of our regions",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop region stats' command aggregates the anonymized stats caches periodically publish in our regions:
+available capacity, hit rate and bytes served.
+
+`),
+	Exec: func(ctx context.Context, args []string) error {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+		return runRegion(ctx, &node.RegionArgs{Stats: true, Name: name})
+	},
+}
+
+func runRegion(ctx context.Context, args *node.RegionArgs) error {
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	rrc := make(chan *node.RegionResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if rr := n.RegionResult; rr != nil {
+			rrc <- rr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Region(args)
+	select {
+	case rr := <-rrc:
+		if rr.Err != "" {
+			return errors.New(rr.Err)
+		}
+		if args.Join != "" {
+			fmt.Printf("Joined %s\n", args.Join)
+		}
+		if args.Leave != "" {
+			fmt.Printf("Left %s\n", args.Leave)
+		}
+		if args.Stats {
+			if len(rr.Health) == 0 {
+				fmt.Printf("No stats received yet.\n")
+				return nil
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintf(w, "Region\tCaches\tCapacity\tQueries\tHit rate\tServed\n")
+			for _, h := range rr.Health {
+				fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%.1f%%\t%s\n", h.Region, h.Caches, h.Capacity, h.Queries, h.HitRate*100, h.BytesServed)
+			}
+			return w.Flush()
+		}
+		fmt.Printf("==> Regions: %s\n", strings.Join(rr.Regions, ", "))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
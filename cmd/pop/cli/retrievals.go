@@ -0,0 +1,110 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var retrievalsArgs struct {
+	since string
+	from  string
+	to    string
+}
+
+var retrievalsCmd = &ffcli.Command{
+	Name:       "retrievals",
+	ShortUsage: "retrievals [flags]",
+	ShortHelp:  "List the retrieval deals we served and made",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop retrievals' command lists the retrieval deals which ended during a time range, oldest first.
+Inbound deals are the content we served to clients and outbound deals the content we retrieved from
+providers. It prints what we earned and spent in total. Dates are given as 2006-01-02 or RFC3339.
+
+`),
+	Exec: runRetrievals,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("retrievals", flag.ExitOnError)
+		fs.StringVar(&retrievalsArgs.since, "since", "", "only list deals which ended during this last duration e.g. 24h")
+		fs.StringVar(&retrievalsArgs.from, "from", "", "only list deals which ended after this date")
+		fs.StringVar(&retrievalsArgs.to, "to", "", "only list deals which ended before this date")
+		return fs
+	})(),
+}
+
+// parseDate parses a day or an RFC3339 time, an empty string is the zero time
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func runRetrievals(ctx context.Context, args []string) error {
+	from, err := parseDate(retrievalsArgs.from)
+	if err != nil {
+		return fmt.Errorf("invalid from date: %w", err)
+	}
+	to, err := parseDate(retrievalsArgs.to)
+	if err != nil {
+		return fmt.Errorf("invalid to date: %w", err)
+	}
+	if retrievalsArgs.since != "" {
+		if !from.IsZero() {
+			return errors.New("cannot use since and from at once")
+		}
+		since, err := time.ParseDuration(retrievalsArgs.since)
+		if err != nil {
+			return fmt.Errorf("invalid since duration: %w", err)
+		}
+		from = time.Now().Add(-since)
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	rrc := make(chan *node.RetrievalsResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if rr := n.RetrievalsResult; rr != nil {
+			rrc <- rr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Retrievals(&node.RetrievalsArgs{From: from, To: to})
+	select {
+	case rr := <-rrc:
+		if rr.Err != "" {
+			return errors.New(rr.Err)
+		}
+		if len(rr.Deals) == 0 {
+			fmt.Printf("No retrieval deals.\n")
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Ended\tDirection\tPeer\tRoot\tBytes\tPaid\tDuration\tStatus\n")
+		for _, d := range rr.Deals {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				d.End.Format("2006-01-02 15:04:05"), d.Direction, d.Peer, d.Root, d.Bytes, d.Paid, d.Duration.Round(time.Millisecond), d.Status)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("\nEarned: %s\nSpent: %s\n", rr.Earned, rr.Spent)
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
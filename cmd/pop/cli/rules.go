@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var rulesArgs struct {
+	maxSize    uint64
+	regions    string
+	publishers string
+	minPrice   string
+	reset      bool
+}
+
+var rulesFlags = (func() *flag.FlagSet {
+	fs := flag.NewFlagSet("rules", flag.ExitOnError)
+	fs.Uint64Var(&rulesArgs.maxSize, "max-size", 0, "largest content in bytes we accept to cache, 0 for no limit")
+	fs.StringVar(&rulesArgs.regions, "regions", "", "regions we accept dispatches for separated by commas")
+	fs.StringVar(&rulesArgs.publishers, "publishers", "", "peer IDs of the publishers we accept content from separated by commas")
+	fs.StringVar(&rulesArgs.minPrice, "min-price", "", "lowest price per byte in FIL publishers must offer")
+	fs.BoolVar(&rulesArgs.reset, "reset", false, "remove all the rules and accept every dispatch")
+	return fs
+})()
+
+var rulesCmd = &ffcli.Command{
+	Name:       "rules",
+	ShortUsage: "rules [flags]",
+	ShortHelp:  "Show or change which dispatches we accept",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop rules' command prints the rules our node evaluates before pulling content publishers dispatch
+to us. Giving any flag replaces all the rules with the new ones: rules left out accept everything.
+Rules are kept across restarts unless the accept options are set in the config.
+
+`),
+	Exec:    runRules,
+	FlagSet: rulesFlags,
+}
+
+func runRules(ctx context.Context, args []string) error {
+	var set *node.RuleSet
+	rulesFlags.Visit(func(f *flag.Flag) {
+		set = &node.RuleSet{}
+	})
+	if set != nil && !rulesArgs.reset {
+		set.MaxSize = rulesArgs.maxSize
+		set.Regions = splitList(rulesArgs.regions)
+		set.Publishers = splitList(rulesArgs.publishers)
+		set.MinPrice = rulesArgs.minPrice
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	rrc := make(chan *node.RulesResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if rr := n.RulesResult; rr != nil {
+			rrc <- rr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Rules(&node.RulesArgs{Set: set})
+	select {
+	case rr := <-rrc:
+		if rr.Err != "" {
+			return errors.New(rr.Err)
+		}
+		r := rr.Rules
+		orAny := func(s string) string {
+			if s == "" {
+				return "any"
+			}
+			return s
+		}
+		maxSize := "no limit"
+		if r.MaxSize > 0 {
+			maxSize = fmt.Sprintf("%d bytes", r.MaxSize)
+		}
+		minPrice := "free"
+		if r.MinPrice != "" {
+			minPrice = r.MinPrice
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(w, "Max size\t%s\n", maxSize)
+		fmt.Fprintf(w, "Regions\t%s\n", orAny(strings.Join(r.Regions, ", ")))
+		fmt.Fprintf(w, "Publishers\t%s\n", orAny(strings.Join(r.Publishers, ", ")))
+		fmt.Fprintf(w, "Min price/byte\t%s\n", minPrice)
+		return w.Flush()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
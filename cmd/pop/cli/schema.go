@@ -0,0 +1,88 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/myelnet/pop/node"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var schemaArgs struct {
+	remove bool
+}
+
+var schemaFlags = (func() *flag.FlagSet {
+	fs := flag.NewFlagSet("schema", flag.ExitOnError)
+	fs.BoolVar(&schemaArgs.remove, "remove", false, "detach the schema from the content")
+	return fs
+})()
+
+var schemaCmd = &ffcli.Command{
+	Name:       "schema",
+	ShortUsage: "schema [flags] <cid> [<schema-file>]",
+	ShortHelp:  "Attach a schema to a content or show the one attached to it",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop schema' command attaches the JSON schema in the given file to a content root. Caches we push
+the content to receive the schema with the dispatch and drop the content if its root doesn't match it.
+Without a file it prints the schema attached to the root.
+
+`),
+	Exec:    runSchema,
+	FlagSet: schemaFlags,
+}
+
+func runSchema(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return flag.ErrHelp
+	}
+	sargs := &node.SchemaArgs{Root: args[0], Remove: schemaArgs.remove}
+	if len(args) > 1 {
+		b, err := ioutil.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		if !json.Valid(b) {
+			return fmt.Errorf("%s is not valid JSON", args[1])
+		}
+		sargs.Set = b
+	}
+
+	c, cc, ctx, cancel := connect(ctx)
+	defer cancel()
+
+	src := make(chan *node.SchemaResult, 1)
+	cc.SetNotifyCallback(func(n node.Notify) {
+		if sr := n.SchemaResult; sr != nil {
+			src <- sr
+		}
+	})
+	go receive(ctx, cc, c)
+
+	cc.Schema(sargs)
+	select {
+	case sr := <-src:
+		if sr.Err != "" {
+			return errors.New(sr.Err)
+		}
+		if len(sr.Schema) == 0 {
+			fmt.Printf("No schema attached to %s\n", sr.Root)
+			return nil
+		}
+		var out bytes.Buffer
+		if err := json.Indent(&out, sr.Schema, "", "  "); err != nil {
+			return err
+		}
+		fmt.Println(out.String())
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/myelnet/pop/wallet"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var signerArgs struct {
+	socket   string
+	keystore string
+}
+
+var signerCmd = &ffcli.Command{
+	Name:       "signer",
+	ShortUsage: "signer -socket <path>",
+	ShortHelp:  "Serve a keystore to remote wallet drivers",
+	LongHelp: strings.TrimSpace(`
+
+The 'pop signer' command holds the keys of a keystore and signs messages for nodes started with
+'pop start -wallet unix://<socket>'. It keeps the private keys out of the node process, for instance
+when the signer runs as a different user. The socket is only accessible to the current user.
+
+`),
+	Exec: runSigner,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("signer", flag.ExitOnError)
+		fs.StringVar(&signerArgs.socket, "socket", "", "unix socket path to listen on")
+		fs.StringVar(&signerArgs.keystore, "keystore", "", "keystore directory, defaults to the repo keystore")
+		return fs
+	})(),
+}
+
+func runSigner(ctx context.Context, args []string) error {
+	if signerArgs.socket == "" {
+		return fmt.Errorf("missing -socket")
+	}
+	dir := signerArgs.keystore
+	if dir == "" {
+		path, err := utils.FullPath(utils.RepoPath())
+		if err != nil {
+			return err
+		}
+		dir = filepath.Join(path, "keystore")
+	}
+	ks, err := keystore.NewFSKeystore(dir)
+	if err != nil {
+		return err
+	}
+
+	// Remove a socket left over by a previous run
+	os.Remove(signerArgs.socket)
+	l, err := net.Listen("unix", signerArgs.socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	if err := os.Chmod(signerArgs.socket, 0600); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-sigs:
+			cancel()
+		case <-ctx.Done():
+		}
+		l.Close()
+	}()
+
+	fmt.Printf("==> Signing with keystore %s on %s\n", dir, signerArgs.socket)
+	err = wallet.ServeSigner(l, wallet.NewIPFS(ks, nil))
+	if ctx.Err() != nil {
+		// We closed the listener ourselves
+		return nil
+	}
+	return err
+}
@@ -9,12 +9,17 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/AlecAivazis/survey/v2"
+	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/filecoin/storage"
 	"github.com/myelnet/pop/internal/utils"
 	"github.com/myelnet/pop/node"
+	"github.com/myelnet/pop/supply"
 	"github.com/peterbourgon/ff/v2"
 	"github.com/peterbourgon/ff/v2/ffcli"
 	"github.com/rs/zerolog/log"
@@ -24,12 +29,101 @@ import (
 type PopConfig struct {
 	temp        bool
 	privKeyPath string
-	regions     string
 	// Exported fields can be set by survey.Ask
+	Regions      string `json:"regions"`
 	Bootstrap    string `json:"bootstrap"`
 	FilEndpoint  string `json:"fil-endpoint"`
 	FilToken     string `json:"fil-token"`
 	FilTokenType string `json:"fil-token-type"`
+	CarStores    bool   `json:"car-stores"`
+	Compression  string `json:"compression"`
+	Capacity     uint64 `json:"capacity"`
+	Replication  string `json:"replication"`
+	Eviction     string `json:"eviction"`
+	// ReleaseEndpoint is checked for new releases when set
+	ReleaseEndpoint string `json:"release-endpoint"`
+	MaxVersionLag   int    `json:"max-version-lag"`
+	// Gateways are comma separated multiaddrs of caches relaying our dispatches to other regions
+	Gateways string `json:"gateways"`
+	Gateway  bool   `json:"gateway"`
+	// DAG limits enforced when pulling or importing content, zero uses the default
+	MaxBlockSize uint64 `json:"max-block-size"`
+	MaxLinks     int    `json:"max-links"`
+	MaxDepth     int    `json:"max-depth"`
+	// MaxPulls is how many dispatched contents we pull at the same time, zero uses the profile default
+	MaxPulls int `json:"max-pulls"`
+	// DispatchRate is how many dispatch requests per minute we accept from a single publisher, zero uses the default
+	DispatchRate int `json:"dispatch-rate"`
+	// PublisherQuota is how many bytes each publisher can cache on our node, zero for no limit
+	PublisherQuota uint64 `json:"publisher-quota"`
+	// Accept rules decide which dispatches we pull, lists are comma separated and empty values accept everything
+	AcceptMaxSize    uint64 `json:"accept-max-size"`
+	AcceptRegions    string `json:"accept-regions"`
+	AcceptPublishers string `json:"accept-publishers"`
+	AcceptMinPrice   string `json:"accept-min-price"`
+	// Free retrievals and bandwidth limits of the provider, lists are comma separated
+	FreePeers     string `json:"free-peers"`
+	FreeRoots     string `json:"free-roots"`
+	DailyQuota    uint64 `json:"daily-quota"`
+	MaxUploadRate uint64 `json:"max-upload-rate"`
+	AuditQuota    uint64 `json:"audit-quota"`
+	// ColdStore is a bucket URL or directory where evicted content is offloaded
+	ColdStore     string `json:"cold-store"`
+	ColdStoreAuth string `json:"cold-store-auth"`
+	// SectorDir is a directory of unsealed pieces our miner exports as <piece cid>.car files
+	SectorDir string `json:"sector-dir"`
+	// HotCapacity is the memory in bytes serving the most retrieved content, zero disables tiering
+	HotCapacity uint64 `json:"hot-capacity"`
+	// ColdAfter is a duration after which content no one retrieved is offloaded to the cold store
+	ColdAfter string `json:"cold-after"`
+	// Region is the home region we join instead of detecting it when no regions are given
+	Region string `json:"region"`
+	// DetectRegion infers our region from our IP address with the GeoDB or GeoService
+	DetectRegion bool   `json:"detect-region"`
+	GeoDB        string `json:"geo-db"`
+	GeoService   string `json:"geo-service"`
+	// RegionRegistry is a file or https endpoint defining the regions and their miners
+	RegionRegistry string `json:"region-registry"`
+	// Deal negotiation retries with storage miners, durations are strings like 30s
+	DealMinBackoff    string  `json:"deal-min-backoff"`
+	DealMaxBackoff    string  `json:"deal-max-backoff"`
+	DealAttempts      float64 `json:"deal-attempts"`
+	DealBackoffFactor float64 `json:"deal-backoff-factor"`
+	DealPollInterval  string  `json:"deal-poll-interval"`
+	DealQueryWorkers  int     `json:"deal-query-workers"`
+	DealQueryTimeout  string  `json:"deal-query-timeout"`
+	// MetricsAddr serves Prometheus metrics on /metrics when set
+	MetricsAddr string `json:"metrics-addr"`
+	// FaultWebhook receives the storage deals of our content slashed or failing after they were sealed
+	FaultWebhook string `json:"fault-webhook"`
+	// Wallet is the URI of the wallet driver holding our keys, defaults to the repo keystore
+	Wallet string `json:"wallet"`
+	// PayerAuth is a JSON file authorizing us to pay for retrievals with the funds of another address
+	PayerAuth string `json:"payer-auth"`
+	// PayerWallet is the URI of the wallet driver holding the payer key, defaults to the repo keystore
+	PayerWallet string `json:"payer-wallet"`
+	// MaxMessageSize is the largest message in bytes exchanged with clients on the command socket
+	MaxMessageSize uint `json:"max-message-size"`
+	// SocketMode is the octal file mode of the unix socket the daemon listens on
+	SocketMode string `json:"socket-mode"`
+	// IdleTimeout closes client connections without any message for this long, 0 keeps them open
+	IdleTimeout string `json:"idle-timeout"`
+	// Profile tunes concurrency and memory for a class of devices, low-power for Raspberry Pi class caches
+	Profile string `json:"profile"`
+	// ReprovideInterval is how often we announce all our content on the DHT, 0 disables DHT content routing
+	ReprovideInterval string `json:"reprovide-interval"`
+	// AuditInterval is how often we audit the caches holding the content we published, 0 disables audits
+	AuditInterval string `json:"audit-interval"`
+	// Indexers are comma separated endpoints of the network indexers we advertise our cached content to
+	Indexers string `json:"indexers"`
+	// HTTPGateway is the address we serve content on over HTTP under /ipfs/<cid>, empty disables the gateway
+	HTTPGateway string `json:"http-gateway"`
+	// EdgeRuntime is the path of the wasmtime executable running the edge functions packed with the content we serve
+	EdgeRuntime string `json:"edge-runtime"`
+	// RPCAddr is the address we serve the JSON-RPC API on, empty disables the API
+	RPCAddr string `json:"rpc-addr"`
+	// RPCToken authenticates the JSON-RPC clients, defaults to a token generated in the repo
+	RPCToken string `json:"rpc-token"`
 }
 
 var startArgs PopConfig
@@ -51,7 +145,64 @@ The 'pop start' command starts a pop daemon service.
 		fs.StringVar(&startArgs.FilToken, "fil-token", "", "token to authorize filecoin api access")
 		fs.StringVar(&startArgs.FilTokenType, "fil-token-type", "Bearer", "auth token type")
 		fs.StringVar(&startArgs.privKeyPath, "privkey", "", "path to private key to use by default")
-		fs.StringVar(&startArgs.regions, "regions", "", "provider regions separated by commas")
+		fs.StringVar(&startArgs.Regions, "regions", "", "provider regions separated by commas")
+		fs.BoolVar(&startArgs.CarStores, "car-stores", false, "store the blocks of each store in a single CAR file")
+		fs.StringVar(&startArgs.Compression, "compression", "none", "block compression codec: none, flate, gzip or zlib")
+		fs.Uint64Var(&startArgs.Capacity, "capacity", 0, "storage capacity in bytes to advertise on the market")
+		fs.StringVar(&startArgs.Replication, "replication", "first", "cache selection strategy: first, random, latency, free-space or region")
+		fs.StringVar(&startArgs.Eviction, "eviction", "lru", "policy evicting cached content when reaching capacity: lru, lfu or none")
+		fs.StringVar(&startArgs.ReleaseEndpoint, "release-endpoint", "", "endpoint returning the latest release to check for updates")
+		fs.IntVar(&startArgs.MaxVersionLag, "max-version-lag", node.DefaultMaxVersionLag, "warn when lagging behind peers by more minor versions")
+		fs.StringVar(&startArgs.Gateways, "gateways", "", "gateway caches relaying our dispatches to regions we have no peers in, separated by commas")
+		fs.BoolVar(&startArgs.Gateway, "gateway", false, "relay dispatches from publishers outside our regions to the caches in our regions")
+		fs.Uint64Var(&startArgs.MaxBlockSize, "max-block-size", supply.DefaultDAGLimits.MaxBlockSize, "maximum size in bytes of the blocks we pull or import")
+		fs.IntVar(&startArgs.MaxLinks, "max-links", supply.DefaultDAGLimits.MaxLinks, "maximum number of links of a node we pull or import")
+		fs.IntVar(&startArgs.MaxDepth, "max-depth", supply.DefaultDAGLimits.MaxDepth, "maximum depth of the DAGs we pull or import")
+		fs.IntVar(&startArgs.MaxPulls, "max-pulls", 0, fmt.Sprintf("maximum number of dispatched contents we pull at the same time, others are queued, 0 uses the profile default (%d)", supply.DefaultMaxPulls))
+		fs.IntVar(&startArgs.DispatchRate, "dispatch-rate", 0, fmt.Sprintf("maximum dispatch requests per minute we accept from a single publisher, others are throttled, 0 uses the default (%d), -1 for no limit", supply.DefaultDispatchRate))
+		fs.Uint64Var(&startArgs.AcceptMaxSize, "accept-max-size", 0, "largest content in bytes we accept to cache, 0 for no limit")
+		fs.StringVar(&startArgs.AcceptRegions, "accept-regions", "", "regions we accept dispatches for separated by commas, all our regions if empty")
+		fs.StringVar(&startArgs.AcceptPublishers, "accept-publishers", "", "peer IDs of the publishers we accept content from separated by commas, anyone if empty")
+		fs.StringVar(&startArgs.AcceptMinPrice, "accept-min-price", "", "lowest price per byte in FIL publishers must offer to cache their content")
+		fs.Uint64Var(&startArgs.PublisherQuota, "publisher-quota", 0, "maximum bytes of content each publisher can cache on our node, 0 for no limit")
+		fs.StringVar(&startArgs.FreePeers, "free-peers", "", "peer IDs retrieving any of our content for free separated by commas")
+		fs.StringVar(&startArgs.FreeRoots, "free-roots", "", "content CIDs anyone can retrieve for free separated by commas")
+		fs.Uint64Var(&startArgs.DailyQuota, "daily-quota", 0, "bytes each peer can retrieve from us per day, 0 for no quota")
+		fs.Uint64Var(&startArgs.MaxUploadRate, "max-upload-rate", 0, "bytes per second we serve to all peers before rejecting new retrievals, 0 for no cap")
+		fs.Uint64Var(&startArgs.AuditQuota, "audit-quota", 0, "bytes publishers can retrieve for free per day to audit the content they published, 0 disables free audits")
+		fs.StringVar(&startArgs.ColdStore, "cold-store", "", "bucket URL or directory where evicted content is offloaded instead of deleted")
+		fs.StringVar(&startArgs.ColdStoreAuth, "cold-store-auth", "", "aws4:<access key>:<secret key>:<region> to sign requests to an S3 bucket or the Authorization header sent to the cold store bucket")
+		fs.StringVar(&startArgs.SectorDir, "sector-dir", "", "directory of unsealed pieces named <piece cid>.car our colocated miner exports, serves their content without a copy")
+		fs.Uint64Var(&startArgs.HotCapacity, "hot-capacity", 0, "memory in bytes serving the most retrieved content, enables tiering")
+		fs.StringVar(&startArgs.ColdAfter, "cold-after", "168h", "offload content no one retrieved for this long to the cold store when tiering")
+		fs.StringVar(&startArgs.Region, "region", "", "home region to join, overrides region detection")
+		fs.BoolVar(&startArgs.DetectRegion, "detect-region", false, "detect our region from our IP address when no regions are given")
+		fs.StringVar(&startArgs.GeoDB, "geo-db", "", "MaxMind country database used to detect our region")
+		fs.StringVar(&startArgs.GeoService, "geo-service", supply.DefaultGeoService, "geolocation service used to detect our region without a geo-db")
+		fs.StringVar(&startArgs.RegionRegistry, "region-registry", "", "JSON or TOML file or https endpoint defining the regions and their miners")
+		fs.StringVar(&startArgs.DealMinBackoff, "deal-min-backoff", storage.DefaultNetworkConfig.MinBackoff.String(), "minimum delay between attempts to reach a storage miner")
+		fs.StringVar(&startArgs.DealMaxBackoff, "deal-max-backoff", storage.DefaultNetworkConfig.MaxBackoff.String(), "maximum delay between attempts to reach a storage miner")
+		fs.Float64Var(&startArgs.DealAttempts, "deal-attempts", storage.DefaultNetworkConfig.Attempts, "number of attempts to reach a storage miner before giving up")
+		fs.Float64Var(&startArgs.DealBackoffFactor, "deal-backoff-factor", storage.DefaultNetworkConfig.BackoffFactor, "factor multiplying the delay after each failed attempt to reach a storage miner")
+		fs.StringVar(&startArgs.DealPollInterval, "deal-poll-interval", storage.DefaultNetworkConfig.PollingInterval.String(), "how often we check the state of our deals with storage miners")
+		fs.IntVar(&startArgs.DealQueryWorkers, "deal-query-workers", 0, fmt.Sprintf("number of storage miners we query asks from at the same time, 0 uses the profile default (%d)", storage.DefaultNetworkConfig.QueryWorkers))
+		fs.StringVar(&startArgs.DealQueryTimeout, "deal-query-timeout", storage.DefaultNetworkConfig.QueryTimeout.String(), "how long we wait for a storage miner to answer a query")
+		fs.StringVar(&startArgs.MetricsAddr, "metrics-addr", "", "address serving Prometheus metrics on /metrics e.g. localhost:9090")
+		fs.StringVar(&startArgs.FaultWebhook, "fault-webhook", "", "URL we post slashed or failed storage deals of our content to as JSON")
+		fs.StringVar(&startArgs.Wallet, "wallet", "", "wallet driver URI such as unix:///run/pop-signer.sock for a remote signer, defaults to the repo keystore")
+		fs.StringVar(&startArgs.PayerAuth, "payer-auth", "", "JSON authorization created with 'pop authorize' to pay for retrievals with the funds of another address")
+		fs.StringVar(&startArgs.PayerWallet, "payer-wallet", "", "wallet driver URI holding the payer key such as the remote signer of the payer, defaults to the repo keystore")
+		fs.UintVar(&startArgs.MaxMessageSize, "max-message-size", node.MaxMessageSize, "largest message in bytes exchanged with clients on the command socket")
+		fs.StringVar(&startArgs.SocketMode, "socket-mode", "0600", "octal file mode of the socket given with the root socket flag")
+		fs.StringVar(&startArgs.IdleTimeout, "idle-timeout", node.DefaultIdleTimeout.String(), "close client connections without any message for this long, 0 keeps them open")
+		fs.StringVar(&startArgs.Profile, "profile", node.ProfileDefault, "tune concurrency and memory for the device: default or low-power for Raspberry Pi class caches")
+		fs.StringVar(&startArgs.ReprovideInterval, "reprovide-interval", pop.DefaultReprovideInterval.String(), "how often we announce all our content on the DHT, 0 disables finding and announcing content on the DHT")
+		fs.StringVar(&startArgs.AuditInterval, "audit-interval", "0", "how often we retrieve a random sample of the content we published from the caches holding it, 0 disables audits")
+		fs.StringVar(&startArgs.Indexers, "indexers", "", "endpoints of the network indexers we advertise our cached content to separated by commas")
+		fs.StringVar(&startArgs.HTTPGateway, "http-gateway", "", "address serving content over HTTP on /ipfs/<cid>[/path] e.g. localhost:8080, retrieving the content we don't have")
+		fs.StringVar(&startArgs.RPCAddr, "rpc-addr", "", "address serving the JSON-RPC API over HTTP and WebSocket on /rpc/v0 e.g. localhost:2002, empty disables the API")
+		fs.StringVar(&startArgs.RPCToken, "rpc-token", "", "bearer token of the JSON-RPC clients, defaults to the token generated in the rpc-token file of the repo")
+		fs.StringVar(&startArgs.EdgeRuntime, "edge-runtime", "", "experimental: path of the wasmtime executable running the edge functions publishers pack with their content, empty disables them")
 
 		return fs
 	})(),
@@ -114,6 +265,39 @@ Manage your Myel point of presence from the command line.
 
 	regions := setupRegions()
 
+	coldAfter, err := time.ParseDuration(startArgs.ColdAfter)
+	if err != nil {
+		return fmt.Errorf("invalid cold-after duration: %w", err)
+	}
+	socketMode, err := strconv.ParseUint(startArgs.SocketMode, 8, 32)
+	if err != nil {
+		return fmt.Errorf("invalid socket-mode: %w", err)
+	}
+	idleTimeout, err := time.ParseDuration(startArgs.IdleTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid idle-timeout duration: %w", err)
+	}
+	if idleTimeout == 0 {
+		// Negative timeouts never close connections
+		idleTimeout = -1
+	}
+	reprovide, err := time.ParseDuration(startArgs.ReprovideInterval)
+	if err != nil {
+		return fmt.Errorf("invalid reprovide-interval duration: %w", err)
+	}
+	if reprovide == 0 {
+		// Negative intervals disable the DHT content routing
+		reprovide = -1
+	}
+	auditInterval, err := time.ParseDuration(startArgs.AuditInterval)
+	if err != nil {
+		return fmt.Errorf("invalid audit-interval duration: %w", err)
+	}
+	dealNet, err := dealNetworkConfig()
+	if err != nil {
+		return err
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 
 	interrupt := make(chan os.Signal, 1)
@@ -136,13 +320,67 @@ Manage your Myel point of presence from the command line.
 		bAddrs = append(bAddrs, startArgs.Bootstrap)
 	}
 
+	var gateways []string
+	if startArgs.Gateways != "" {
+		gateways = strings.Split(startArgs.Gateways, ",")
+	}
+
+	var indexers []string
+	if startArgs.Indexers != "" {
+		indexers = strings.Split(startArgs.Indexers, ",")
+	}
+
 	opts := node.Options{
-		RepoPath:       path,
-		BootstrapPeers: bAddrs,
-		FilEndpoint:    startArgs.FilEndpoint,
-		FilToken:       filToken,
-		PrivKey:        privKey,
-		Regions:        regions,
+		RepoPath:        path,
+		BootstrapPeers:  bAddrs,
+		FilEndpoint:     startArgs.FilEndpoint,
+		FilToken:        filToken,
+		PrivKey:         privKey,
+		Regions:         regions,
+		CarStores:       startArgs.CarStores,
+		Compression:     startArgs.Compression,
+		Capacity:        startArgs.Capacity,
+		Replication:     startArgs.Replication,
+		Eviction:        startArgs.Eviction,
+		ReleaseEndpoint: startArgs.ReleaseEndpoint,
+		MaxVersionLag:   startArgs.MaxVersionLag,
+		Gateways:        gateways,
+		Gateway:         startArgs.Gateway,
+		MaxBlockSize:    startArgs.MaxBlockSize,
+		MaxLinks:        startArgs.MaxLinks,
+		MaxDepth:        startArgs.MaxDepth,
+		MaxPulls:        startArgs.MaxPulls,
+		DispatchRate:    startArgs.DispatchRate,
+		PublisherQuota:  startArgs.PublisherQuota,
+		AcceptRules:     acceptRules(),
+		Policy:          providerPolicy(),
+		ColdStore:       startArgs.ColdStore,
+		ColdStoreAuth:   startArgs.ColdStoreAuth,
+		SectorDir:       startArgs.SectorDir,
+		HotCapacity:     startArgs.HotCapacity,
+		ColdAfter:       coldAfter,
+		RegionRegistry:  startArgs.RegionRegistry,
+		DealNetwork:     dealNet,
+		DetectRegion:    startArgs.DetectRegion,
+		GeoDB:           startArgs.GeoDB,
+		GeoService:      startArgs.GeoService,
+		MetricsAddr:     startArgs.MetricsAddr,
+		FaultWebhook:    startArgs.FaultWebhook,
+		Wallet:          startArgs.Wallet,
+		PayerAuth:       startArgs.PayerAuth,
+		PayerWallet:     startArgs.PayerWallet,
+		MaxMessageSize:  uint32(startArgs.MaxMessageSize),
+		SocketPath:      rootArgs.socket,
+		SocketMode:      os.FileMode(socketMode),
+		IdleTimeout:     idleTimeout,
+		Profile:         startArgs.Profile,
+		ProvideInterval: reprovide,
+		AuditInterval:   auditInterval,
+		Indexers:        indexers,
+		HTTPGateway:     startArgs.HTTPGateway,
+		EdgeRuntime:     startArgs.EdgeRuntime,
+		RPCAddr:         startArgs.RPCAddr,
+		RPCToken:        startArgs.RPCToken,
 	}
 
 	err = node.Run(ctx, opts)
@@ -153,6 +391,42 @@ Manage your Myel point of presence from the command line.
 	return nil
 }
 
+// acceptRules returns the accept rules set in the config or nil to keep the rules set with 'pop rules'
+func acceptRules() *node.RuleSet {
+	if startArgs.AcceptMaxSize == 0 && startArgs.AcceptRegions == "" &&
+		startArgs.AcceptPublishers == "" && startArgs.AcceptMinPrice == "" {
+		return nil
+	}
+	return &node.RuleSet{
+		MaxSize:    startArgs.AcceptMaxSize,
+		Regions:    splitList(startArgs.AcceptRegions),
+		Publishers: splitList(startArgs.AcceptPublishers),
+		MinPrice:   startArgs.AcceptMinPrice,
+	}
+}
+
+// providerPolicy returns the free retrievals and bandwidth limits set in the config
+func providerPolicy() node.ProviderPolicy {
+	return node.ProviderPolicy{
+		FreePeers:     splitList(startArgs.FreePeers),
+		FreeRoots:     splitList(startArgs.FreeRoots),
+		DailyQuota:    startArgs.DailyQuota,
+		MaxUploadRate: startArgs.MaxUploadRate,
+		AuditQuota:    startArgs.AuditQuota,
+	}
+}
+
+// splitList splits a comma separated list ignoring empty values
+func splitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
 // setupRepo will persist our initial configurations so we can remember them when we need to restart the node
 func setupRepo() (string, bool, error) {
 	var err error
@@ -194,7 +468,21 @@ func setupRepo() (string, bool, error) {
 
 	// These prompts are only executed when starting the node for the first time
 	// and creating a new repo. Once done, the configs will be persisted into a JSON config file.
-	qs := []*survey.Question{
+	if err := survey.Ask(filecoinQuestions(), &startArgs); err != nil {
+		return path, false, err
+	}
+
+	if err := writeConfig(path); err != nil {
+		return path, false, err
+	}
+	fmt.Printf("==> Initialized pop repo in %s\n", path)
+
+	return path, true, nil
+}
+
+// filecoinQuestions prompts for the Filecoin API and network configs
+func filecoinQuestions() []*survey.Question {
+	return []*survey.Question{
 		{
 			Name: "filEndpoint",
 			Prompt: &survey.Input{
@@ -225,39 +513,31 @@ func setupRepo() (string, bool, error) {
 			},
 		},
 	}
+}
 
-	if err := survey.Ask(qs, &startArgs); err != nil {
-		return path, false, err
-	}
-
+// writeConfig creates the repo directories if needed and persists our configs into a JSON config file
+func writeConfig(path string) error {
 	// Make our root repo dir and datastore dir
-	err = os.MkdirAll(filepath.Join(path, "datastore"), 0755)
+	err := os.MkdirAll(filepath.Join(path, "datastore"), 0755)
 	if err != nil {
-		return path, false, err
+		return err
 	}
-	// default configs
-	// Regions aren't set in a static config object as we aim to make them
-	// more dynamic in the future
+	// Regions are empty unless chosen with 'pop init' so 'pop start' prompts for them on each run
 	buf := new(bytes.Buffer)
 	e := json.NewEncoder(buf)
 	e.SetIndent("", "    ")
 	if err := e.Encode(startArgs); err != nil {
-		return path, false, err
+		return err
 	}
 	c, err := os.Create(filepath.Join(path, "PopConfig.json"))
 	if err != nil {
-		return path, false, err
+		return err
 	}
 	_, err = c.Write(buf.Bytes())
 	if err != nil {
-		return path, false, err
-	}
-	if err := c.Close(); err != nil {
-		return path, false, err
+		return err
 	}
-	fmt.Printf("==> Initialized pop repo in %s\n", path)
-
-	return path, true, nil
+	return c.Close()
 }
 
 // setupWallet prompts user to import a key or generate a new one
@@ -297,7 +577,14 @@ func setupWallet(init bool) string {
 // setupRegions formats the regions to join from cli flag or user prompt
 func setupRegions() []string {
 	var regions []string
-	if startArgs.regions == "" {
+	if startArgs.Regions == "" && startArgs.Region != "" {
+		return []string{startArgs.Region}
+	}
+	// The node picks our region
+	if startArgs.Regions == "" && startArgs.DetectRegion {
+		return nil
+	}
+	if startArgs.Regions == "" {
 		prompt := &survey.MultiSelect{
 			Message: "Choose regions to join",
 			Options: []string{
@@ -316,8 +603,41 @@ The global region allows free transfers while specific regions offer better perf
 		}
 		survey.AskOne(prompt, &regions, survey.WithValidator(survey.Required))
 	}
-	if startArgs.regions != "" {
-		regions = strings.Split(startArgs.regions, ",")
+	if startArgs.Regions != "" {
+		regions = strings.Split(startArgs.Regions, ",")
 	}
 	return regions
 }
+
+// dealNetworkConfig parses the deal negotiation settings, empty durations use the defaults
+func dealNetworkConfig() (storage.NetworkConfig, error) {
+	cfg := storage.NetworkConfig{
+		Attempts:      startArgs.DealAttempts,
+		BackoffFactor: startArgs.DealBackoffFactor,
+		QueryWorkers:  startArgs.DealQueryWorkers,
+	}
+	durations := []struct {
+		name  string
+		value string
+		dst   *time.Duration
+	}{
+		{"deal-min-backoff", startArgs.DealMinBackoff, &cfg.MinBackoff},
+		{"deal-max-backoff", startArgs.DealMaxBackoff, &cfg.MaxBackoff},
+		{"deal-poll-interval", startArgs.DealPollInterval, &cfg.PollingInterval},
+		{"deal-query-timeout", startArgs.DealQueryTimeout, &cfg.QueryTimeout},
+	}
+	for _, d := range durations {
+		if d.value == "" {
+			continue
+		}
+		v, err := time.ParseDuration(d.value)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid %s duration: %w", d.name, err)
+		}
+		*d.dst = v
+	}
+	if cfg.MinBackoff > 0 && cfg.MaxBackoff > 0 && cfg.MinBackoff > cfg.MaxBackoff {
+		return cfg, fmt.Errorf("deal-min-backoff is greater than deal-max-backoff")
+	}
+	return cfg, nil
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"strings"
 
@@ -10,6 +11,10 @@ import (
 	"github.com/peterbourgon/ff/v2/ffcli"
 )
 
+var statusArgs struct {
+	workdag string
+}
+
 var statusCmd = &ffcli.Command{
 	Name:      "status",
 	ShortHelp: "Print the state of the working DAG",
@@ -20,6 +25,11 @@ been chunked and staged in the blockstore but not yet committed into a Car to be
 
 `),
 	Exec: runStatus,
+	FlagSet: (func() *flag.FlagSet {
+		fs := flag.NewFlagSet("status", flag.ExitOnError)
+		fs.StringVar(&statusArgs.workdag, "workdag", "", "name of the workdag to print instead of the checked out one")
+		return fs
+	})(),
 }
 
 func runStatus(ctx context.Context, args []string) error {
@@ -34,12 +44,21 @@ func runStatus(ctx context.Context, args []string) error {
 	})
 	go receive(ctx, cc, c)
 
-	cc.Status(&node.StatusArgs{})
+	cc.Status(&node.StatusArgs{Workdag: statusArgs.workdag})
 	select {
 	case sr := <-src:
 		if sr.Err != "" {
 			return errors.New(sr.Err)
 		}
+		if sr.VersionWarning != "" {
+			fmt.Printf("Warning: %s\n", sr.VersionWarning)
+		}
+		if sr.Compression != "" {
+			fmt.Printf("Compression %s\n", sr.Compression)
+		}
+		if len(sr.Queued) > 0 {
+			fmt.Printf("Queued until online: %s\n", strings.Join(sr.Queued, ", "))
+		}
 		if sr.Output == "" {
 			fmt.Printf("Nothing to pack, workdag clean.\n")
 			return nil
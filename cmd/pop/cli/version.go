@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/myelnet/pop/build"
+	"github.com/peterbourgon/ff/v2/ffcli"
+)
+
+var versionCmd = &ffcli.Command{
+	Name:      "version",
+	ShortHelp: "Print the pop version",
+	Exec: func(ctx context.Context, args []string) error {
+		fmt.Printf("pop %s\n", build.Version)
+		return nil
+	},
+	FlagSet: flag.NewFlagSet("version", flag.ExitOnError),
+}
@@ -0,0 +1,301 @@
+package pop
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// DefaultProviderHalfLife is how long it takes for the weight of past retrievals from a provider to halve
+const DefaultProviderHalfLife = 7 * 24 * time.Hour
+
+// sampleWeight is the weight of a new RTT or throughput sample in the moving averages
+const sampleWeight = 0.3
+
+// unknownFactor is the factor of providers we never measured so they still get a chance
+const unknownFactor = 0.5
+
+// DiscoveryWeights is how much each criteria counts in the score of an offer. They should add up to 1.
+type DiscoveryWeights struct {
+	Price       float64
+	Throughput  float64
+	RTT         float64
+	Reliability float64
+}
+
+// DefaultDiscoveryWeights favors cheap offers then fast and reliable providers
+var DefaultDiscoveryWeights = DiscoveryWeights{
+	Price:       0.4,
+	Throughput:  0.25,
+	RTT:         0.15,
+	Reliability: 0.2,
+}
+
+// ProviderRecord is what we remember about retrieving content from a provider
+type ProviderRecord struct {
+	Peer peer.ID
+	// RTT is a moving average of how long the provider takes to answer our queries
+	RTT time.Duration
+	// Throughput is a moving average of the bytes per second of our retrievals
+	Throughput float64
+	// Successes and Failures are decayed counts of retrievals
+	Successes float64
+	Failures  float64
+	// LastError describes the last failure
+	LastError string
+	Updated   time.Time
+}
+
+// Score is the likelihood of a retrieval from the provider succeeding from 0 to 1. Providers we know
+// nothing about score 0.5.
+func (r ProviderRecord) Score() float64 {
+	return (r.Successes + 1) / (r.Successes + r.Failures + 2)
+}
+
+// RankedOffer is an offer with what we know about its provider and how it compares to other offers
+type RankedOffer struct {
+	deal.Offer
+	Record ProviderRecord
+	// Score ranks the offer from 0 to 1 given the other offers for the same content
+	Score float64
+}
+
+// Discovery caches the offers we receive for each content and ranks them from their price and the RTT,
+// throughput and reliability of their provider in past retrievals. Records are persisted in the datastore.
+type Discovery struct {
+	// HalfLife is how fast past retrievals lose weight
+	HalfLife time.Duration
+	// Weights of each criteria in the score of an offer
+	Weights DiscoveryWeights
+
+	offers *OfferCache
+	ds     datastore.Batching
+	now    func() time.Time
+
+	mu   sync.Mutex
+	recs map[peer.ID]*ProviderRecord
+	// started is when each of our ongoing deals started transferring
+	started map[deal.ID]time.Time
+}
+
+// NewDiscovery creates a discovery component caching offers in the given cache
+func NewDiscovery(ds datastore.Batching, offers *OfferCache) *Discovery {
+	return &Discovery{
+		HalfLife: DefaultProviderHalfLife,
+		Weights:  DefaultDiscoveryWeights,
+		offers:   offers,
+		ds:       namespace.Wrap(ds, datastore.NewKey("/retrieval-providers")),
+		now:      time.Now,
+		recs:     make(map[peer.ID]*ProviderRecord),
+		started:  make(map[deal.ID]time.Time),
+	}
+}
+
+// decay reduces the weight of past retrievals since the last update
+func (d *Discovery) decay(r *ProviderRecord, now time.Time) {
+	if !r.Updated.IsZero() && d.HalfLife > 0 {
+		elapsed := now.Sub(r.Updated)
+		if elapsed > 0 {
+			f := math.Pow(0.5, float64(elapsed)/float64(d.HalfLife))
+			r.Successes *= f
+			r.Failures *= f
+		}
+	}
+	r.Updated = now
+}
+
+// load returns the record of a provider from memory or the datastore. Must be called with the lock.
+func (d *Discovery) load(p peer.ID) *ProviderRecord {
+	if r, ok := d.recs[p]; ok {
+		return r
+	}
+	r := &ProviderRecord{Peer: p}
+	if b, err := d.ds.Get(datastore.NewKey(p.String())); err == nil {
+		if err := json.Unmarshal(b, r); err != nil {
+			r = &ProviderRecord{Peer: p}
+		}
+	}
+	d.recs[p] = r
+	return r
+}
+
+func (d *Discovery) update(p peer.ID, fn func(r *ProviderRecord)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := d.load(p)
+	d.decay(r, d.now())
+	fn(r)
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return d.ds.Put(datastore.NewKey(p.String()), b)
+}
+
+// RecordRTT adds the time a provider took to answer a query to its RTT average
+func (d *Discovery) RecordRTT(p peer.ID, rtt time.Duration) error {
+	return d.update(p, func(r *ProviderRecord) {
+		if r.RTT == 0 {
+			r.RTT = rtt
+			return
+		}
+		r.RTT = time.Duration(math.Round(sampleWeight*float64(rtt) + (1-sampleWeight)*float64(r.RTT)))
+	})
+}
+
+// RecordTransfer counts a successful retrieval and adds its throughput to the average of the provider
+func (d *Discovery) RecordTransfer(p peer.ID, size uint64, duration time.Duration) error {
+	return d.update(p, func(r *ProviderRecord) {
+		r.Successes++
+		if duration <= 0 {
+			return
+		}
+		tp := float64(size) / duration.Seconds()
+		if r.Throughput == 0 {
+			r.Throughput = tp
+			return
+		}
+		r.Throughput = sampleWeight*tp + (1-sampleWeight)*r.Throughput
+	})
+}
+
+// RecordFailure counts a failed retrieval
+func (d *Discovery) RecordFailure(p peer.ID, reason error) error {
+	return d.update(p, func(r *ProviderRecord) {
+		r.Failures++
+		if reason != nil {
+			r.LastError = reason.Error()
+		}
+	})
+}
+
+// Record returns what we know about a provider with decay applied
+func (d *Discovery) Record(p peer.ID) ProviderRecord {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	r := *d.load(p)
+	d.decay(&r, d.now())
+	return r
+}
+
+// List returns the records of all the providers we retrieved from sorted by score
+func (d *Discovery) List() ([]ProviderRecord, error) {
+	res, err := d.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var recs []ProviderRecord
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		var r ProviderRecord
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			continue
+		}
+		recs = append(recs, d.Record(r.Peer))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Score() > recs[j].Score()
+	})
+	return recs, nil
+}
+
+// Find returns the cached offers for a content ranked best first
+func (d *Discovery) Find(root cid.Cid) []RankedOffer {
+	return d.Rank(d.offers.Get(root))
+}
+
+// Rank scores offers for the same content against each other and sorts them best first. Offers keep the
+// order they arrived in, fastest first, at the same score.
+func (d *Discovery) Rank(offers []deal.Offer) []RankedOffer {
+	ranked := make([]RankedOffer, len(offers))
+	var minPrice, maxThroughput float64
+	var minRTT time.Duration
+	for i, offer := range offers {
+		r := d.Record(offer.PeerID)
+		ranked[i] = RankedOffer{Offer: offer, Record: r}
+		price := tokenFloat(offer.Response.PieceRetrievalPrice().Int)
+		if i == 0 || price < minPrice {
+			minPrice = price
+		}
+		if r.Throughput > maxThroughput {
+			maxThroughput = r.Throughput
+		}
+		if r.RTT > 0 && (minRTT == 0 || r.RTT < minRTT) {
+			minRTT = r.RTT
+		}
+	}
+	w := d.Weights
+	for i := range ranked {
+		r := ranked[i].Record
+		priceF := 1.0
+		if price := tokenFloat(ranked[i].Response.PieceRetrievalPrice().Int); price > 0 {
+			priceF = minPrice / price
+		}
+		tpF := unknownFactor
+		if r.Throughput > 0 {
+			tpF = r.Throughput / maxThroughput
+		}
+		rttF := unknownFactor
+		if r.RTT > 0 {
+			rttF = float64(minRTT) / float64(r.RTT)
+		}
+		ranked[i].Score = w.Price*priceF + w.Throughput*tpF + w.RTT*rttF + w.Reliability*r.Score()
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// handleClientEvent measures the throughput of our retrievals and counts the failures of providers
+func (d *Discovery) handleClientEvent(event client.Event, state deal.ClientState) {
+	switch {
+	case event == client.EventDealAccepted:
+		d.mu.Lock()
+		d.started[state.ID] = d.now()
+		d.mu.Unlock()
+	case state.Status == deal.StatusCompleted:
+		d.mu.Lock()
+		start, ok := d.started[state.ID]
+		delete(d.started, state.ID)
+		d.mu.Unlock()
+		if ok {
+			d.RecordTransfer(state.Sender, state.TotalReceived, d.now().Sub(start))
+		}
+	case state.Status == deal.StatusErrored || state.Status == deal.StatusRejected:
+		d.mu.Lock()
+		delete(d.started, state.ID)
+		d.mu.Unlock()
+		d.RecordFailure(state.Sender, errors.New(state.Message))
+	case state.Status == deal.StatusCancelled:
+		// Deals cancelled by us e.g. losing a race aren't the fault of the provider
+		d.mu.Lock()
+		delete(d.started, state.ID)
+		d.mu.Unlock()
+	}
+}
+
+// tokenFloat converts an amount of attoFIL to a float to compare prices
+func tokenFloat(i *big.Int) float64 {
+	if i == nil {
+		return 0
+	}
+	f, _ := new(big.Float).SetInt(i).Float64()
+	return f
+}
@@ -0,0 +1,75 @@
+package pop
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveryRank(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	offers := NewOfferCache()
+	d := NewDiscovery(ds, offers)
+
+	newOffer := func(p peer.ID, price int64) deal.Offer {
+		return deal.Offer{PeerID: p, Response: deal.QueryResponse{
+			Status:          deal.QueryResponseAvailable,
+			Size:            1000,
+			MinPricePerByte: abi.NewTokenAmount(price),
+			UnsealPrice:     big.Zero(),
+			Expiry:          uint64(time.Now().Add(AskTTL).Unix()),
+		}}
+	}
+	cheap := test.RandPeerIDFatal(t)
+	fast := test.RandPeerIDFatal(t)
+	flaky := test.RandPeerIDFatal(t)
+
+	// We know nothing about the providers so the cheapest offer wins
+	ranked := d.Rank([]deal.Offer{newOffer(fast, 2), newOffer(cheap, 1)})
+	require.Equal(t, cheap, ranked[0].PeerID)
+	require.Equal(t, 0.5, ranked[0].Record.Score())
+
+	// A provider which answered and delivered fast beats a slightly cheaper unknown one
+	require.NoError(t, d.RecordRTT(fast, 20*time.Millisecond))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.RecordTransfer(fast, 1<<20, time.Second))
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, d.RecordFailure(flaky, errors.New("stalled")))
+	}
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	offers.Add(root, newOffer(cheap, 9))
+	offers.Add(root, newOffer(fast, 10))
+	offers.Add(root, newOffer(flaky, 9))
+	ranked = d.Find(root)
+	require.Len(t, ranked, 3)
+	require.Equal(t, fast, ranked[0].PeerID)
+	require.Equal(t, cheap, ranked[1].PeerID)
+	require.Equal(t, flaky, ranked[2].PeerID)
+	require.Equal(t, float64(1<<20), ranked[0].Record.Throughput)
+	require.Equal(t, "stalled", ranked[2].Record.LastError)
+
+	// Failures lose their weight over time
+	now := time.Now()
+	d.now = func() time.Time { return now.Add(d.HalfLife) }
+	require.InDelta(t, 1.5, d.Record(flaky).Failures, 0.01)
+
+	// Records are restored after a restart
+	d2 := NewDiscovery(ds, NewOfferCache())
+	recs, err := d2.List()
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	require.Equal(t, fast, recs[0].Peer)
+	require.Equal(t, 20*time.Millisecond, recs[0].RTT)
+}
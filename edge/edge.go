@@ -0,0 +1,313 @@
+// Package edge runs edge functions packed by publishers with their content to transform the files
+// caches serve e.g. inject headers or personalize manifests. Edge functions are WASI modules following
+// the CGI conventions: they read the file on stdin, the request in their environment and write headers,
+// a blank line then the body on stdout. This is experimental.
+package edge
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+)
+
+// ModuleName is the name of the entry holding the edge function of a content
+const ModuleName = "_edge.wasm"
+
+// ErrInvalidModule is returned when a module isn't a WebAssembly binary or is too large
+var ErrInvalidModule = errors.New("invalid wasm module")
+
+// ErrOutputTooLarge is returned when an edge function writes more than the output limit
+var ErrOutputTooLarge = errors.New("edge function output too large")
+
+// ErrTimeout is returned when an edge function runs longer than the time limit
+var ErrTimeout = errors.New("edge function timed out")
+
+// ErrInvalidResponse is returned when an edge function doesn't write a header section
+var ErrInvalidResponse = errors.New("invalid edge function response")
+
+// wasmHeader is the magic number and version 1 starting every WebAssembly binary
+var wasmHeader = []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+
+// Limits bound the resources of a single run of an edge function
+type Limits struct {
+	// MaxModuleSize is the largest module in bytes we run
+	MaxModuleSize int64
+	// MaxMemory is the largest linear memory in bytes a module can grow
+	MaxMemory uint64
+	// MaxOutput is the largest response in bytes a module can write
+	MaxOutput int64
+	// Timeout is how long a module can run
+	Timeout time.Duration
+}
+
+// DefaultLimits are strict enough to run edge functions on every retrieval of a small cache
+var DefaultLimits = Limits{
+	MaxModuleSize: 4 << 20,
+	MaxMemory:     64 << 20,
+	MaxOutput:     32 << 20,
+	Timeout:       time.Second,
+}
+
+// Request describes the file an edge function transforms
+type Request struct {
+	Method string
+	Root   cid.Cid
+	// Path of the file in the content
+	Path        string
+	ContentType string
+	Header      http.Header
+}
+
+// EnvHeaders are the request headers passed to edge functions. Functions run code from publishers so
+// credentials like Authorization or Cookie never reach them.
+var EnvHeaders = []string{
+	"Accept",
+	"Accept-Language",
+	"If-Modified-Since",
+	"If-None-Match",
+	"Range",
+	"Referer",
+	"User-Agent",
+}
+
+// env returns the CGI environment of the request
+func (r Request) env(size int) []string {
+	method := r.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	env := []string{
+		"SERVER_SOFTWARE=pop",
+		"GATEWAY_INTERFACE=CGI/1.1",
+		"REQUEST_METHOD=" + method,
+		"PATH_INFO=/" + strings.TrimPrefix(r.Path, "/"),
+		"CONTENT_TYPE=" + r.ContentType,
+		"CONTENT_LENGTH=" + strconv.Itoa(size),
+		"X_POP_ROOT=" + r.Root.String(),
+	}
+	for _, k := range EnvHeaders {
+		vs := r.Header.Values(k)
+		if len(vs) == 0 {
+			continue
+		}
+		k = "HTTP_" + strings.ToUpper(strings.Replace(k, "-", "_", -1))
+		env = append(env, k+"="+strings.Join(vs, ", "))
+	}
+	return env
+}
+
+// Response is the file transformed by an edge function
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// ValidateModule checks a module is a WebAssembly binary within the size limit
+func ValidateModule(module []byte, limits Limits) error {
+	if limits.MaxModuleSize > 0 && int64(len(module)) > limits.MaxModuleSize {
+		return fmt.Errorf("%w: %d bytes is over the %d bytes limit", ErrInvalidModule, len(module), limits.MaxModuleSize)
+	}
+	if !bytes.HasPrefix(module, wasmHeader) {
+		return fmt.Errorf("%w: not a wasm binary", ErrInvalidModule)
+	}
+	return nil
+}
+
+// Runtime executes a WASI module at a path with the given environment, stdin and stdout. It must not
+// give the module access to the file system or the network and must enforce the memory limit.
+type Runtime interface {
+	Run(ctx context.Context, module string, env []string, stdin io.Reader, stdout io.Writer, limits Limits) error
+}
+
+// RuntimeFunc is a function implementing Runtime
+type RuntimeFunc func(ctx context.Context, module string, env []string, stdin io.Reader, stdout io.Writer, limits Limits) error
+
+// Run calls the function
+func (f RuntimeFunc) Run(ctx context.Context, module string, env []string, stdin io.Reader, stdout io.Writer, limits Limits) error {
+	return f(ctx, module, env, stdin, stdout, limits)
+}
+
+// CommandRuntime runs modules with a WASI runtime executable. Modules get no preopened directory so
+// they can only read their stdin and environment.
+type CommandRuntime struct {
+	// Path of the executable
+	Path string
+	// Args are passed before the flags and the module
+	Args []string
+	// EnvFlag passes an environment variable to the module
+	EnvFlag string
+	// MemoryFlag formats the flag limiting the memory of the module with the limit in bytes
+	MemoryFlag string
+}
+
+// Wasmtime returns the runtime running modules with the wasmtime executable at the given path
+func Wasmtime(path string) CommandRuntime {
+	return CommandRuntime{
+		Path:       path,
+		Args:       []string{"run", "--disable-cache"},
+		EnvFlag:    "--env",
+		MemoryFlag: "-Wmax-memory-size=%d",
+	}
+}
+
+// Run executes the runtime killing it when the context is done
+func (rt CommandRuntime) Run(ctx context.Context, module string, env []string, stdin io.Reader, stdout io.Writer, limits Limits) error {
+	args := append([]string{}, rt.Args...)
+	if rt.MemoryFlag != "" && limits.MaxMemory > 0 {
+		args = append(args, fmt.Sprintf(rt.MemoryFlag, limits.MaxMemory))
+	}
+	for _, e := range env {
+		args = append(args, rt.EnvFlag, e)
+	}
+	args = append(args, module)
+
+	cmd := exec.CommandContext(ctx, rt.Path, args...)
+	// The runtime doesn't inherit our environment
+	cmd.Env = []string{}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	// Keep the start of the error output to explain failures
+	stderr := &limitedBuffer{max: 4096, truncate: true}
+	cmd.Stderr = stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// Runner runs edge functions with a runtime within limits
+type Runner struct {
+	Limits Limits
+
+	rt  Runtime
+	dir string
+}
+
+// NewRunner creates a runner writing the modules it runs in the given directory
+func NewRunner(rt Runtime, dir string, limits Limits) (*Runner, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Runner{
+		Limits: limits,
+		rt:     rt,
+		dir:    dir,
+	}, nil
+}
+
+// modulePath writes a module to the runner directory unless we ran it already
+func (r *Runner) modulePath(module []byte) (string, error) {
+	sum := sha256.Sum256(module)
+	path := filepath.Join(r.dir, hex.EncodeToString(sum[:])+".wasm")
+	if _, err := os.Stat(path); err == nil {
+		return path, nil
+	}
+	// Write to a temporary file first so concurrent runs never read a partial module
+	tmp, err := ioutil.TempFile(r.dir, "module-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(module); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// Run transforms a file with an edge function
+func (r *Runner) Run(ctx context.Context, module []byte, req Request, body []byte) (*Response, error) {
+	if err := ValidateModule(module, r.Limits); err != nil {
+		return nil, err
+	}
+	path, err := r.modulePath(module)
+	if err != nil {
+		return nil, err
+	}
+	if r.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.Limits.Timeout)
+		defer cancel()
+	}
+	out := &limitedBuffer{max: r.Limits.MaxOutput}
+	err = r.rt.Run(ctx, path, req.env(len(body)), bytes.NewReader(body), out, r.Limits)
+	switch {
+	case out.exceeded:
+		return nil, ErrOutputTooLarge
+	case ctx.Err() == context.DeadlineExceeded:
+		return nil, ErrTimeout
+	case err != nil:
+		return nil, fmt.Errorf("edge function failed: %w", err)
+	}
+	return parseResponse(out.Bytes())
+}
+
+// parseResponse reads the CGI headers and the body written by an edge function
+func parseResponse(out []byte) (*Response, error) {
+	br := bufio.NewReader(bytes.NewReader(out))
+	h, err := textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+	}
+	res := &Response{
+		Status: http.StatusOK,
+		Header: http.Header(h),
+	}
+	if s := res.Header.Get("Status"); s != "" {
+		res.Header.Del("Status")
+		code, err := strconv.Atoi(strings.Fields(s)[0])
+		if err != nil || code < 100 || code > 999 {
+			return nil, fmt.Errorf("%w: bad status %q", ErrInvalidResponse, s)
+		}
+		res.Status = code
+	}
+	res.Body, err = ioutil.ReadAll(br)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// limitedBuffer fails writes past a maximum size or drops them if truncate is set. A zero maximum
+// doesn't limit the size.
+type limitedBuffer struct {
+	bytes.Buffer
+	max      int64
+	truncate bool
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.max > 0 && int64(b.Len()+len(p)) > b.max {
+		b.exceeded = true
+		if b.truncate {
+			b.Buffer.Write(p[:b.max-int64(b.Len())])
+			return len(p), nil
+		}
+		return 0, ErrOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,109 @@
+package edge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	module := append(append([]byte{}, wasmHeader...), []byte("code")...)
+
+	var env []string
+	// The fake runtime prefixes the body with a greeting for the request path
+	rt := RuntimeFunc(func(ctx context.Context, m string, e []string, stdin io.Reader, stdout io.Writer, limits Limits) error {
+		code, err := ioutil.ReadFile(m)
+		require.NoError(t, err)
+		require.Equal(t, module, code)
+		env = e
+		body, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Content-Type: text/html\r\nX-Greeting: hello\r\n\r\n")
+		if bytes.Contains(body, []byte("slow")) {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		if bytes.Contains(body, []byte("big")) {
+			_, err := stdout.Write(bytes.Repeat([]byte("a"), 1024))
+			return err
+		}
+		stdout.Write([]byte("<!-- edge -->"))
+		stdout.Write(body)
+		return nil
+	})
+	r, err := NewRunner(rt, t.TempDir(), Limits{
+		MaxModuleSize: 64,
+		MaxOutput:     512,
+		Timeout:       100 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	req := Request{
+		Root:        root,
+		Path:        "index.html",
+		ContentType: "text/html",
+		Header: http.Header{
+			"Accept-Language": []string{"fr"},
+			"Authorization":   []string{"Bearer secret"},
+			"Cookie":          []string{"session=secret"},
+		},
+	}
+	res, err := r.Run(ctx, module, req, []byte("<p>page</p>"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.Status)
+	require.Equal(t, "hello", res.Header.Get("X-Greeting"))
+	require.Equal(t, "<!-- edge --><p>page</p>", string(res.Body))
+	require.Contains(t, env, "PATH_INFO=/index.html")
+	require.Contains(t, env, "X_POP_ROOT="+root.String())
+	require.Contains(t, env, "HTTP_ACCEPT_LANGUAGE=fr")
+	// Credentials never reach the function
+	for _, e := range env {
+		require.False(t, strings.HasPrefix(e, "HTTP_AUTHORIZATION=") || strings.HasPrefix(e, "HTTP_COOKIE="), e)
+	}
+	require.Contains(t, env, "CONTENT_LENGTH=11")
+
+	// The module is written once
+	_, err = r.Run(ctx, module, req, []byte("<p>page</p>"))
+	require.NoError(t, err)
+
+	_, err = r.Run(ctx, module, req, []byte("slow"))
+	require.Equal(t, ErrTimeout, err)
+
+	_, err = r.Run(ctx, module, req, []byte("big"))
+	require.Equal(t, ErrOutputTooLarge, err)
+
+	_, err = r.Run(ctx, []byte("#!/bin/sh"), req, nil)
+	require.True(t, errors.Is(err, ErrInvalidModule))
+
+	_, err = r.Run(ctx, append(module, make([]byte, 64)...), req, nil)
+	require.True(t, errors.Is(err, ErrInvalidModule))
+}
+
+func TestParseResponse(t *testing.T) {
+	res, err := parseResponse([]byte("Status: 404 Not Found\nContent-Type: text/plain\n\nnot here"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, res.Status)
+	require.Equal(t, "", res.Header.Get("Status"))
+	require.Equal(t, "not here", string(res.Body))
+
+	_, err = parseResponse([]byte("Status: teapot\n\n"))
+	require.True(t, errors.Is(err, ErrInvalidResponse))
+
+	_, err = parseResponse([]byte(strings.Repeat("no headers", 3)))
+	require.True(t, errors.Is(err, ErrInvalidResponse))
+}
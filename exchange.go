@@ -9,20 +9,25 @@ import (
 	"github.com/filecoin-project/go-address"
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-multistore"
+	"github.com/filecoin-project/go-state-types/big"
 	cid "github.com/ipfs/go-cid"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	cbor "github.com/ipfs/go-ipld-cbor"
 	"github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/myelnet/pop/filecoin"
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
+	"github.com/myelnet/pop/indexer"
 	"github.com/myelnet/pop/retrieval"
-	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/retrieval/provider"
 	"github.com/myelnet/pop/supply"
 	"github.com/myelnet/pop/wallet"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // RequestTopic listens for peers looking for content blocks
@@ -37,17 +42,29 @@ func NewExchange(ctx context.Context, set Settings) (*Exchange, error) {
 		bs:           set.Blockstore,
 		regionSubs:   make(map[string]*pubsub.Subscription),
 		regionTopics: make(map[string]*pubsub.Topic),
+		offers:       NewOfferCache(),
+		log:          log.Logger,
+	}
+	if set.Logger != nil {
+		ex.log = *set.Logger
 	}
 
 	// Start our lotus api if we have an endpoint.
-	if set.FilecoinRPCEndpoint != "" {
+	if set.FilecoinAPI != nil {
+		ex.fAPI = set.FilecoinAPI
+	} else if set.FilecoinRPCEndpoint != "" {
 		ex.fAPI, err = filecoin.NewLotusRPC(ctx, set.FilecoinRPCEndpoint, set.FilecoinRPCHeader)
 		if err != nil {
 			return nil, err
 		}
 	}
-	// Set wallet from IPFS Keystore, we should make this more generic eventually
-	ex.wallet = wallet.NewIPFS(set.Keystore, ex.fAPI)
+	ex.wallet, err = wallet.Open(set.Wallet, set.Keystore, ex.fAPI)
+	if err != nil {
+		return nil, err
+	}
+	if set.ConfirmMessage != nil {
+		ex.wallet = wallet.NewConfirming(ex.wallet, ex.fAPI, set.ConfirmThreshold, set.ConfirmMessage)
+	}
 	// Make a new default key to be sure we have an address where to receive our payments
 	if ex.wallet.DefaultAddress() == address.Undef {
 		_, err = ex.wallet.NewKey(ctx, wallet.KTSecp256k1)
@@ -55,8 +72,27 @@ func NewExchange(ctx context.Context, set Settings) (*Exchange, error) {
 			return nil, err
 		}
 	}
+	if set.Payer != nil {
+		ex.payer, err = paychmgr.NewDelegation(set.Payer, ex.wallet.DefaultAddress())
+		if err != nil {
+			return nil, err
+		}
+		pd, err := wallet.Open(set.PayerWallet, set.Keystore, ex.fAPI)
+		if err != nil {
+			return nil, err
+		}
+		if set.ConfirmMessage != nil {
+			pd = wallet.NewConfirming(pd, ex.fAPI, set.ConfirmThreshold, set.ConfirmMessage)
+		}
+		// The payer driver enforces the limit of the authorization whatever we track in memory
+		pd, err = paychmgr.NewLimitedPayer(pd, set.Payer, set.Datastore)
+		if err != nil {
+			return nil, err
+		}
+		ex.wallet = wallet.NewDelegated(ex.wallet, set.Payer.Payer, pd)
+	}
 	// Setup the messaging protocol for communicating retrieval deals
-	ex.net = retrieval.NewQueryNetwork(ex.h)
+	ex.net = retrieval.NewQueryNetwork(ex.h, retrieval.Logger(ex.log))
 
 	// Retrieval data transfer setup
 	ex.dataTransfer, err = NewDataTransfer(ctx, ex.h, set.GraphSync, set.Datastore, "retrieval", set.RepoPath)
@@ -67,9 +103,68 @@ func NewExchange(ctx context.Context, set Settings) (*Exchange, error) {
 	// Add a special adaptor to use the blockstore with cbor encoding
 	cborblocks := cbor.NewCborStore(set.Blockstore)
 	// Create our payment manager
-	paym := payments.New(ctx, ex.fAPI, ex.wallet, set.Datastore, cborblocks)
+	paym := paychmgr.New(ctx, ex.fAPI, ex.wallet, set.Datastore, cborblocks)
+	// Region scoped services start without regions, they join them with the request topics below
+	ex.market, err = NewMarket(ctx, ex.h, ex.ps, nil, ex.log)
+	if err != nil {
+		return nil, err
+	}
+	if set.Capacity > 0 {
+		go ex.market.Advertise(ctx, set.Capacity)
+	}
+	strategy := set.SelectionStrategy
+	if strategy == nil {
+		strategy, err = ex.selectionStrategy(set.ReplicationStrategy, set.Regions)
+		if err != nil {
+			return nil, err
+		}
+	}
+	ex.publications, err = NewPublications(ctx, ex.h, ex.ps, set.Datastore, nil, ex.log)
+	if err != nil {
+		return nil, err
+	}
 	// create the supply manager to handle optimisations of the block supply
-	ex.supply = supply.New(ex.h, ex.dataTransfer, set.Datastore, ex.multiStore, set.Regions)
+	ex.supply = supply.New(ex.h, ex.dataTransfer, set.Datastore, ex.multiStore, set.Regions, strategy)
+	ex.supply.SetLogger(ex.log)
+	ex.stats, err = NewRegionStats(ctx, ex.h, ex.ps, nil, ex.log)
+	if err != nil {
+		return nil, err
+	}
+	if set.SectorAccessor != nil {
+		ex.supply.SetSectorAccessor(set.SectorAccessor)
+	}
+	// Join the regional topics where publishers announce new content
+	if err := ex.supply.EnableAnnouncements(ctx, ex.ps); err != nil {
+		return nil, err
+	}
+	ex.supply.SetGateways(set.Gateways)
+	limits := set.DAGLimits
+	if limits == (supply.DAGLimits{}) {
+		limits = supply.DefaultDAGLimits
+	}
+	ex.supply.SetDAGLimits(limits)
+	// Stop loading blocks over the limit before the transfer completes
+	set.GraphSync.RegisterIncomingBlockHook(limits.BlockHook())
+	if set.ColdStore != nil {
+		ex.supply.SetColdStore(set.ColdStore)
+	}
+	if set.MaxPulls != 0 {
+		ex.supply.SetMaxPulls(set.MaxPulls)
+	}
+	if set.DispatchRate != 0 {
+		ex.supply.SetDispatchRate(set.DispatchRate)
+	}
+	if set.PublisherQuota > 0 {
+		ex.supply.SetQuotas(supply.Quotas{Default: set.PublisherQuota})
+	}
+	if set.AcceptRules != nil {
+		if err := ex.supply.SetAcceptRules(*set.AcceptRules); err != nil {
+			return nil, err
+		}
+	}
+	if set.Gateway {
+		ex.supply.EnableGateway()
+	}
 	// Create our retrieval manager
 	ex.retrieval, err = retrieval.New(
 		ctx,
@@ -79,12 +174,70 @@ func NewExchange(ctx context.Context, set Settings) (*Exchange, error) {
 		ex.dataTransfer,
 		ex.supply,
 		ex.h.ID(),
+		ex.log,
 	)
 	if err != nil {
 		return nil, err
 	}
+	// Measure our retrievals to rank the offers of the providers next time
+	ex.discovery = NewDiscovery(set.Datastore, ex.offers)
+	ex.retrieval.Client().SubscribeToEvents(ex.discovery.handleClientEvent)
+	policy, err := supply.ParseEvictionPolicy(set.EvictionPolicy)
+	if err != nil {
+		return nil, err
+	}
+	ex.supply.EnableEviction(policy, set.Capacity)
+	ex.supply.StartJanitor(ctx, supply.JanitorInterval)
+	if set.Tiering != nil {
+		ex.supply.EnableTiering(ctx, *set.Tiering)
+	}
+	if set.RegionProvider != nil {
+		ex.supply.StartRegionRefresh(ctx, set.RegionProvider, supply.RegionRefreshInterval)
+	}
+	if set.Routing != nil {
+		ex.routing = set.Routing
+		interval := set.ReprovideInterval
+		if interval == 0 {
+			interval = DefaultReprovideInterval
+		}
+		ex.startReprovider(ctx, interval)
+	}
+	if set.AuditInterval > 0 {
+		ex.startAudits(ctx, set.AuditInterval)
+	}
+	if len(set.Indexers) > 0 {
+		ex.indexer = indexer.NewPublisher(ex.h, set.Blockstore, set.Datastore, set.Indexers, ex.log)
+		ex.startIndexing(ctx)
+	}
+	// Content retrieved from us is more valuable to keep
+	ex.retrieval.Provider().SubscribeToEvents(func(event provider.Event, state deal.ProviderState) {
+		if state.Status == deal.StatusCompleted {
+			ex.supply.RecordAccess(state.PayloadCID)
+			ex.stats.RecordServed(state.TotalSent)
+		}
+	})
+	// Caches share their stats so anyone can tell the health of a region
+	if set.Capacity > 0 {
+		go ex.stats.Publish(ctx, func() uint64 {
+			usage, err := ex.supply.Usage()
+			if err != nil || usage > set.Capacity {
+				return 0
+			}
+			return set.Capacity - usage
+		})
+	}
 
-	return ex, ex.joinRegions(ctx, set.Regions)
+	// Regions we joined or left at runtime are restored by the supply
+	return ex, ex.joinRegions(ctx, ex.supply.Regions())
+}
+
+// selectionStrategy builds a provider selection strategy from its name. Free space weighted
+// selection uses the capacity caches advertise on the market.
+func (e *Exchange) selectionStrategy(name string, regions []supply.Region) (supply.ProviderSelectionStrategy, error) {
+	if name == "free-space" {
+		return &supply.CapacityWeighted{Capacity: e.market.Capacity}, nil
+	}
+	return supply.ParseSelectionStrategy(name, e.h, regions)
 }
 
 // Exchange is a gossip based exchange for retrieving blocks from Filecoin
@@ -98,21 +251,63 @@ type Exchange struct {
 	retrieval retrieval.Manager
 	net       retrieval.QueryNetwork
 	supply    *supply.Supply
-	wallet    wallet.Driver
-	fAPI      filecoin.API
+	market    *Market
+	stats     *RegionStats
+	// publications maps names to the latest root of their content
+	publications *Publications
+	wallet       wallet.Driver
+	fAPI         filecoin.API
+	// payer pays for our retrievals instead of our default address when set
+	payer *paychmgr.Delegation
 
 	mu           sync.Mutex
 	regionSubs   map[string]*pubsub.Subscription
 	regionTopics map[string]*pubsub.Topic
+	// offers caches the verified offers providers sent us until they expire
+	offers *OfferCache
+	// discovery ranks the offers from the history of their providers
+	discovery *Discovery
+	// routing publishes provider records for the content we cache, nil if disabled
+	routing routing.ContentRouting
+	// indexer advertises the content we cache to network indexers, nil if disabled
+	indexer *indexer.Publisher
+
+	log zerolog.Logger
+}
+
+// JoinRegion starts serving content queries and dispatches in a new region without restarting.
+// The region is persisted so we are still part of it on restart.
+func (e *Exchange) JoinRegion(ctx context.Context, r supply.Region) error {
+	if err := e.supply.JoinRegion(ctx, r); err != nil {
+		return err
+	}
+	return e.joinRegions(ctx, []supply.Region{r})
+}
+
+// LeaveRegion stops serving content queries and dispatches in a region
+func (e *Exchange) LeaveRegion(name string) error {
+	if err := e.supply.LeaveRegion(name); err != nil {
+		return err
+	}
+	return e.leaveRegion(name)
 }
 
-// joinRegions allows a provider to handle request in specific CDN regions
-// TODO: allow nodes to join and leave regions without restarting
+// joinRegions allows a provider to handle request in specific CDN regions. Announcements are
+// joined by the supply, every other region scoped service joins here.
 func (e *Exchange) joinRegions(ctx context.Context, rgs []supply.Region) error {
 	e.mu.Lock()
 	defer e.mu.Unlock()
-	// Gossip sub subscription for incoming content queries
 	for _, r := range rgs {
+		if err := e.market.joinRegion(ctx, r); err != nil {
+			return err
+		}
+		if err := e.publications.joinRegion(ctx, r); err != nil {
+			return err
+		}
+		if err := e.stats.joinRegion(ctx, r); err != nil {
+			return err
+		}
+		// Gossip sub subscription for incoming content queries
 		topic, err := e.ps.Join(fmt.Sprintf("%s/%s", RequestTopic, r.Name))
 		if err != nil {
 			return err
@@ -131,6 +326,30 @@ func (e *Exchange) joinRegions(ctx context.Context, rgs []supply.Region) error {
 	return nil
 }
 
+// leaveRegion leaves all the region scoped services joined in joinRegions
+func (e *Exchange) leaveRegion(name string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.market.leaveRegion(name); err != nil {
+		return err
+	}
+	if err := e.publications.leaveRegion(name); err != nil {
+		return err
+	}
+	if err := e.stats.leaveRegion(name); err != nil {
+		return err
+	}
+	if sub, ok := e.regionSubs[name]; ok {
+		sub.Cancel()
+		delete(e.regionSubs, name)
+	}
+	if topic, ok := e.regionTopics[name]; ok {
+		delete(e.regionTopics, name)
+		return topic.Close()
+	}
+	return nil
+}
+
 // requestLoop runs by default in the background when the pop client is initialized
 // it iterates over new gossip messages and sends a response if we have the block in store
 func (e *Exchange) requestLoop(ctx context.Context, sub *pubsub.Subscription, r supply.Region) {
@@ -147,36 +366,74 @@ func (e *Exchange) requestLoop(ctx context.Context, sub *pubsub.Subscription, r
 			continue
 		}
 
+		var size uint64
+		var labels map[string]string
+		unseal := false
 		store, err := e.supply.GetStore(m.PayloadCID)
-		if err != nil {
+		if err == nil {
+			if info, err := e.supply.Inspect(m.PayloadCID); err == nil {
+				labels = info.Labels
+			}
+			// DAGStat is both a way of checking if we have the blocks and returning its size
+			// TODO: support selector in Query
+			stats, err := DAGStat(ctx, store.Bstore, m.PayloadCID, AllSelector())
+			if err != nil {
+				e.log.Error().Err(err).Str("root", m.PayloadCID.String()).Msg("failed to get content stat")
+			} else {
+				size = uint64(stats.Size)
+			}
+		} else if info, uerr := e.supply.FindUnsealable(ctx, m.PayloadCID); uerr == nil {
+			// The content is in one of our miner's sectors, it will be unsealed if a client starts a retrieval
+			size = info.PayloadSize
+			unseal = true
+		} else {
 			// TODO: we need to log when we couldn't find some content so we can try looking for it
-			fmt.Printf("no store found for %s \n", m.PayloadCID)
+			e.log.Debug().Str("root", m.PayloadCID.String()).Msg("no store found")
+			e.stats.RecordQuery(r.Name, false)
 			continue
 		}
-		// DAGStat is both a way of checking if we have the blocks and returning its size
-		// TODO: support selector in Query
-		stats, err := DAGStat(ctx, store.Bstore, m.PayloadCID, AllSelector())
-		if err != nil {
-			fmt.Printf("failed to get content stat: %s\n", err)
-		}
+		e.stats.RecordQuery(r.Name, true)
 		// We don't have the block we don't even reply to avoid taking bandwidth
 		// On the client side we assume no response means they don't have it
-		if err == nil && stats.Size > 0 {
+		if size > 0 {
 			qs, err := e.net.NewQueryStream(msg.ReceivedFrom)
 			if err != nil {
-				fmt.Println("error", err)
+				e.log.Warn().Err(err).Str("peer", msg.ReceivedFrom.String()).Msg("failed to open query stream")
 				continue
 			}
+			ask, ok := e.retrieval.Provider().Asks().Lookup(m.PayloadCID, labels)
+			if !ok {
+				// Without any ask we charge the price of the region
+				ask = retrieval.Ask{
+					PricePerByte:            r.PPB,
+					PaymentInterval:         deal.DefaultPaymentInterval,
+					PaymentIntervalIncrease: deal.DefaultPaymentIntervalIncrease,
+				}
+			}
+			unsealPrice := big.Zero()
+			// Content we already hold doesn't need unsealing
+			if unseal && !ask.UnsealPrice.Nil() {
+				unsealPrice = ask.UnsealPrice
+			}
+			// Operators can serve some peers or content for free and let publishers audit their content
+			audit := labels[supply.KPublisher] == msg.ReceivedFrom.String() && e.retrieval.Provider().FreeAudit(msg.ReceivedFrom)
+			if audit || e.retrieval.Provider().Policy().Free(msg.ReceivedFrom, m.PayloadCID) {
+				ask.PricePerByte = big.Zero()
+				unsealPrice = big.Zero()
+			}
 			answer := deal.QueryResponse{
 				Status:                     deal.QueryResponseAvailable,
-				Size:                       uint64(stats.Size),
+				Size:                       size,
 				PaymentAddress:             e.wallet.DefaultAddress(),
-				MinPricePerByte:            r.PPB, // TODO: dynamic pricing
-				MaxPaymentInterval:         deal.DefaultPaymentInterval,
-				MaxPaymentIntervalIncrease: deal.DefaultPaymentIntervalIncrease,
+				MinPricePerByte:            ask.PricePerByte,
+				MaxPaymentInterval:         ask.PaymentInterval,
+				MaxPaymentIntervalIncrease: ask.PaymentIntervalIncrease,
+				UnsealPrice:                unsealPrice,
+				Peers:                      e.regionPeers(r.Name, msg.ReceivedFrom, PEXPeers),
 			}
+			e.signAsk(&answer)
 			if err := qs.WriteQueryResponse(answer); err != nil {
-				fmt.Printf("retrieval query: WriteCborRPC: %s\n", err)
+				e.log.Warn().Err(err).Msg("failed to write query response")
 				return
 			}
 			// We need to remember the offer we made so we can validate against it once
@@ -188,34 +445,48 @@ func (e *Exchange) requestLoop(ctx context.Context, sub *pubsub.Subscription, r
 
 // NewSession returns a new retrieval session
 func (e *Exchange) NewSession(ctx context.Context, root cid.Cid) (*Session, error) {
-	// Track when the session is completed
-	done := make(chan error)
-	// Subscribe to client events to send to the channel
 	cl := e.retrieval.Client()
-	unsubscribe := cl.SubscribeToEvents(func(event client.Event, state deal.ClientState) {
-		switch state.Status {
-		case deal.StatusCompleted:
-			done <- nil
-			return
-		case deal.StatusCancelled, deal.StatusErrored:
-			done <- fmt.Errorf("retrieval: %v, %v", deal.Statuses[state.Status], state.Message)
-			return
-		}
-	})
+	// Copy the topics as we may join or leave regions while the session runs
+	e.mu.Lock()
+	topics := make(map[string]*pubsub.Topic, len(e.regionTopics))
+	for name, topic := range e.regionTopics {
+		topics[name] = topic
+	}
+	e.mu.Unlock()
+	clientAddr := e.wallet.DefaultAddress()
+	if e.payer != nil {
+		clientAddr = e.payer.Payer()
+	}
 	session := &Session{
-		regionTopics: e.regionTopics,
+		regionTopics: topics,
+		peers:        e.h.Peerstore(),
+		self:         e.h.ID(),
+		offers:       e.offers,
+		discovery:    e.discovery,
+		routing:      e.routing,
+		h:            e.h,
 		net:          e.net,
 		root:         root,
+		sel:          AllSelector(),
 		retriever:    cl,
-		clientAddr:   e.wallet.DefaultAddress(),
-		done:         done,
-		unsub:        unsubscribe,
+		clientAddr:   clientAddr,
+		payer:        e.payer,
+		log:          e.log,
+		// Track when the session is completed
+		done: make(chan error, 1),
 		// We create a fresh new store for this session
 		storeID: e.multiStore.Next(),
 	}
+	// Subscribe to client events to send to the channel
+	session.unsub = cl.SubscribeToEvents(session.handleEvent)
 	return session, nil
 }
 
+// Payer returns the delegation paying for our retrievals or nil if we pay ourselves
+func (e *Exchange) Payer() *paychmgr.Delegation {
+	return e.payer
+}
+
 // Wallet returns the wallet instance funding the exchange
 func (e *Exchange) Wallet() wallet.Driver {
 	return e.wallet
@@ -231,6 +502,31 @@ func (e *Exchange) Supply() *supply.Supply {
 	return e.supply
 }
 
+// Market exposes the listings of caches in our regions
+func (e *Exchange) Market() *Market {
+	return e.market
+}
+
+// Stats exposes the stats of caches in our regions
+func (e *Exchange) Stats() *RegionStats {
+	return e.stats
+}
+
+// Publications exposes the names mapping to the latest root of publications in our regions
+func (e *Exchange) Publications() *Publications {
+	return e.publications
+}
+
+// Discovery returns the component ranking the offers of providers
+func (e *Exchange) Discovery() *Discovery {
+	return e.discovery
+}
+
+// Indexer returns the publisher advertising our content to network indexers, nil if disabled
+func (e *Exchange) Indexer() *indexer.Publisher {
+	return e.indexer
+}
+
 // Retrieval is the retrieval module and deal state manager
 func (e *Exchange) Retrieval() retrieval.Manager {
 	return e.retrieval
@@ -11,7 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/ipfs/go-blockservice"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dss "github.com/ipfs/go-datastore/sync"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
@@ -27,6 +29,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/myelnet/pop/internal/testutil"
 	"github.com/myelnet/pop/supply"
 	"github.com/stretchr/testify/require"
@@ -90,14 +93,14 @@ func TestExchangeDirect(t *testing.T) {
 
 			// In this test we expect the maximum of providers to receive the content
 			// that may not be the case in the real world
-			res, err := client.Supply().Dispatch(supply.Request{
+			res, err := client.Supply().Dispatch(ctx, supply.Request{
 				PayloadCID: rootCid,
-				Size:       uint64(len(origBytes)),
+				Size:       cnode.DAGSize(ctx, t, storeID, rootCid),
 			})
 			require.NoError(t, err)
 
 			var records []supply.PRecord
-			for len(records) < res.Count {
+			for len(records) < res.Attempted() {
 				rec, err := res.Next(ctx)
 				require.NoError(t, err)
 				records = append(records, rec)
@@ -144,6 +147,82 @@ func TestExchangeDirect(t *testing.T) {
 	}
 }
 
+func TestExchangeJoinRegion(t *testing.T) {
+	bgCtx := context.Background()
+
+	ctx, cancel := context.WithTimeout(bgCtx, 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(bgCtx)
+
+	// The first exchange is in Global and the second one only joins it at runtime
+	var exchs []*Exchange
+	var pss []*pubsub.PubSub
+	for _, r := range []string{"Global", "Europe"} {
+		n := testutil.NewTestNode(mn, t)
+		n.SetupGraphSync(ctx)
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+
+		exch, err := NewExchange(bgCtx, Settings{
+			Datastore:  n.Ds,
+			Blockstore: n.Bs,
+			MultiStore: n.Ms,
+			Host:       n.Host,
+			PubSub:     ps,
+			GraphSync:  n.Gs,
+			RepoPath:   n.DTTmpDir,
+			Keystore:   keystore.NewMemKeystore(),
+			Regions:    []supply.Region{supply.Regions[r]},
+			Capacity:   4096,
+		})
+		require.NoError(t, err)
+		exchs = append(exchs, exch)
+		pss = append(pss, ps)
+	}
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	// Wait to know the first exchange is in the market before joining
+	require.Eventually(t, func() bool {
+		return len(pss[1].ListPeers(fmt.Sprintf("%s/%s", MarketTopic, "Global"))) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, exchs[1].JoinRegion(ctx, supply.Regions["Global"]))
+
+	// Joining advertises our capacity in the region right away
+	require.Eventually(t, func() bool {
+		return len(exchs[0].Market().Providers("Global", 1024, abi.TokenAmount{})) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Equal(t, exchs[1].h.ID(), exchs[0].Market().Providers("Global", 0, abi.TokenAmount{})[0].Provider)
+
+	// Wait for both peers to be subscribed to the publications of the region
+	topic := fmt.Sprintf("%s/%s", PublicationTopic, "Global")
+	require.Eventually(t, func() bool {
+		return len(pss[0].ListPeers(topic)) == 1 && len(pss[1].ListPeers(topic)) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	hash, err := mh.Sum([]byte("v1"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	root := cid.NewCidV1(cid.Raw, hash)
+	_, err = exchs[0].Publications().Publish(ctx, "site", root, 1)
+	require.NoError(t, err)
+	_, err = exchs[1].Publications().Publish(ctx, "blog", root, 1)
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, err := exchs[1].Publications().Resolve("site")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Eventually(t, func() bool {
+		_, err := exchs[0].Publications().Resolve("blog")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	// Leaving the region forgets its listings
+	require.NoError(t, exchs[0].LeaveRegion("Global"))
+	require.Len(t, exchs[0].Market().Providers("Global", 0, abi.TokenAmount{}), 0)
+}
+
 func TestDAGStat(t *testing.T) {
 	ctx := context.Background()
 
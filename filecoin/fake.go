@@ -0,0 +1,585 @@
+package filecoin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/go-state-types/dline"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/go-state-types/network"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/miner"
+	"github.com/ipfs/go-cid"
+)
+
+// FakeGenesisTimestamp is the timestamp of the genesis block of fake chains
+const FakeGenesisTimestamp = uint64(1598306400)
+
+// FakeBaseFee is the base fee of every fake tipset and the fee cap messages are estimated with
+var FakeBaseFee = abi.NewTokenAmount(100)
+
+// fakeGasLimit is the gas limit estimated for all the messages
+const fakeGasLimit = int64(10_000_000)
+
+// FakeDeal is a storage deal published on a fake chain
+type FakeDeal struct {
+	Proposal     market.DealProposal
+	PublishEpoch abi.ChainEpoch
+	// SectorStartEpoch is when the deal was activated in a proven sector, -1 until then
+	SectorStartEpoch abi.ChainEpoch
+}
+
+type fakeMsg struct {
+	smsg   *SignedMessage
+	lookup MsgLookup
+}
+
+// FakeAPI is an in-memory Filecoin chain implementing the API so applications can test against pop
+// or run it locally without a lotus node. The chain only moves forward when a message is pushed,
+// a message is waited for with more confidence than it has or Advance is called so results are
+// deterministic. Messages are applied when pushed: value is transferred between actors and calls to
+// the storage market AddBalance, WithdrawBalance and PublishStorageDeals update the market balances
+// and deals. Other actor methods only transfer value.
+type FakeAPI struct {
+	mu       sync.Mutex
+	tipsets  []*TipSet
+	actors   map[address.Address]*Actor
+	ids      map[address.Address]address.Address // robust address to ID address
+	keys     map[address.Address]address.Address // ID address to robust address
+	nextID   uint64
+	miners   map[address.Address]MinerInfo
+	balances map[address.Address]MarketBalance
+	dataCaps map[address.Address]abi.StoragePower
+	msgs     map[cid.Cid]*fakeMsg
+	objects  map[cid.Cid][]byte
+	deals    map[abi.DealID]FakeDeal
+	nextDeal abi.DealID
+}
+
+// NewFakeAPI creates a fake chain with only a genesis tipset
+func NewFakeAPI() *FakeAPI {
+	f := &FakeAPI{
+		actors:   make(map[address.Address]*Actor),
+		ids:      make(map[address.Address]address.Address),
+		keys:     make(map[address.Address]address.Address),
+		nextID:   1000,
+		miners:   make(map[address.Address]MinerInfo),
+		balances: make(map[address.Address]MarketBalance),
+		dataCaps: make(map[address.Address]abi.StoragePower),
+		msgs:     make(map[cid.Cid]*fakeMsg),
+		objects:  make(map[cid.Cid][]byte),
+		deals:    make(map[abi.DealID]FakeDeal),
+	}
+	f.advance(1)
+	return f
+}
+
+// fakeStateRoot is the state root of all fake blocks, the cid of an empty CBOR list
+var fakeStateRoot = func() cid.Cid {
+	c, err := abi.CidBuilder.Sum([]byte{0x80})
+	if err != nil {
+		panic(err)
+	}
+	return c
+}()
+
+// advance appends n tipsets to the chain. The caller must hold the lock.
+func (f *FakeAPI) advance(n int) *TipSet {
+	for i := 0; i < n; i++ {
+		var parents []cid.Cid
+		height := abi.ChainEpoch(0)
+		if l := len(f.tipsets); l > 0 {
+			parents = f.tipsets[l-1].cids
+			height = abi.ChainEpoch(l)
+		}
+		ts, err := NewTipSet([]*BlockHeader{{
+			Miner:                 builtin.SystemActorAddr,
+			Ticket:                &Ticket{VRFProof: []byte(fmt.Sprintf("fake-%d", height))},
+			Parents:               parents,
+			ParentWeight:          NewInt(uint64(height)),
+			Height:                height,
+			ParentStateRoot:       fakeStateRoot,
+			ParentMessageReceipts: fakeStateRoot,
+			Messages:              fakeStateRoot,
+			Timestamp:             FakeGenesisTimestamp + uint64(height)*uint64(builtin.EpochDurationSeconds),
+			ParentBaseFee:         FakeBaseFee,
+		}})
+		if err != nil {
+			panic(err)
+		}
+		f.tipsets = append(f.tipsets, ts)
+	}
+	return f.tipsets[len(f.tipsets)-1]
+}
+
+// Advance adds n epochs to the chain and returns the new head
+func (f *FakeAPI) Advance(n int) *TipSet {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.advance(n)
+}
+
+// head returns the last tipset. The caller must hold the lock.
+func (f *FakeAPI) head() *TipSet {
+	return f.tipsets[len(f.tipsets)-1]
+}
+
+// lookupID resolves an address to its ID address, assigning the next ID to robust addresses we
+// have not seen yet. The caller must hold the lock.
+func (f *FakeAPI) lookupID(addr address.Address) address.Address {
+	if addr.Protocol() == address.ID {
+		return addr
+	}
+	if id, ok := f.ids[addr]; ok {
+		return id
+	}
+	id, err := address.NewIDAddress(f.nextID)
+	if err != nil {
+		panic(err)
+	}
+	f.nextID++
+	f.ids[addr] = id
+	f.keys[id] = addr
+	return id
+}
+
+// actor returns the actor of an address, creating an empty one if create is true.
+// The caller must hold the lock.
+func (f *FakeAPI) actor(addr address.Address, create bool) *Actor {
+	id := f.lookupID(addr)
+	act, ok := f.actors[id]
+	if !ok && create {
+		act = &Actor{
+			Code:    builtin.AccountActorCodeID,
+			Head:    fakeStateRoot,
+			Balance: big.Zero(),
+		}
+		f.actors[id] = act
+	}
+	return act
+}
+
+// marketBalance returns the market balance of an address. The caller must hold the lock.
+func (f *FakeAPI) marketBalance(addr address.Address) MarketBalance {
+	bal, ok := f.balances[f.lookupID(addr)]
+	if !ok {
+		return MarketBalance{Escrow: big.Zero(), Locked: big.Zero()}
+	}
+	return bal
+}
+
+// SetBalance sets the wallet balance of an address, creating its account if needed
+func (f *FakeAPI) SetBalance(addr address.Address, amount abi.TokenAmount) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.actor(addr, true).Balance = amount
+}
+
+// SetMarketBalance sets the escrow and locked funds of an address in the storage market
+func (f *FakeAPI) SetMarketBalance(addr address.Address, bal MarketBalance) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.balances[f.lookupID(addr)] = bal
+}
+
+// SetDataCap makes the address a verified client with the given datacap, nil removes it
+func (f *FakeAPI) SetDataCap(addr address.Address, dc *abi.StoragePower) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := f.lookupID(addr)
+	if dc == nil {
+		delete(f.dataCaps, id)
+		return
+	}
+	f.dataCaps[id] = *dc
+}
+
+// AddMiner registers a storage miner with the given info. Its worker can publish deals.
+func (f *FakeAPI) AddMiner(maddr address.Address, info MinerInfo) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	act := f.actor(maddr, true)
+	act.Code = builtin.StorageMinerActorCodeID
+	f.actor(info.Worker, true)
+	f.miners[f.lookupID(maddr)] = info
+}
+
+// PutObject stores raw bytes ChainReadObj returns and their cid
+func (f *FakeAPI) PutObject(data []byte) (cid.Cid, error) {
+	c, err := abi.CidBuilder.Sum(data)
+	if err != nil {
+		return cid.Undef, err
+	}
+	f.mu.Lock()
+	f.objects[c] = data
+	f.mu.Unlock()
+	return c, nil
+}
+
+// PublishDeals publishes deal proposals on behalf of the worker of a miner as a storage provider
+// would once it accepted them. It returns the cid of the publish message. Client signatures aren't
+// verified so unsigned proposals are published with an empty one.
+func (f *FakeAPI) PublishDeals(worker address.Address, deals ...market.ClientDealProposal) (cid.Cid, error) {
+	params := market.PublishStorageDealsParams{Deals: make([]market.ClientDealProposal, len(deals))}
+	for i, d := range deals {
+		// A zero signature has no valid type and the market actor cannot decode it
+		if d.ClientSignature.Type == 0 && len(d.ClientSignature.Data) == 0 {
+			d.ClientSignature = crypto.Signature{Type: crypto.SigTypeSecp256k1}
+		}
+		params.Deals[i] = d
+	}
+	buf := new(bytes.Buffer)
+	if err := params.MarshalCBOR(buf); err != nil {
+		return cid.Undef, err
+	}
+	f.mu.Lock()
+	nonce := f.actor(worker, true).Nonce
+	f.mu.Unlock()
+	return f.MpoolPush(context.Background(), &SignedMessage{
+		Message: Message{
+			To:         builtin.StorageMarketActorAddr,
+			From:       worker,
+			Nonce:      nonce,
+			Value:      big.Zero(),
+			GasLimit:   fakeGasLimit,
+			GasFeeCap:  FakeBaseFee,
+			GasPremium: big.Zero(),
+			Method:     builtin.MethodsMarket.PublishStorageDeals,
+			Params:     buf.Bytes(),
+		},
+		Signature: crypto.Signature{Type: crypto.SigTypeSecp256k1},
+	})
+}
+
+// ActivateDeal marks a published deal as included in a proven sector at the current height
+func (f *FakeAPI) ActivateDeal(id abi.DealID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.deals[id]
+	if !ok {
+		return fmt.Errorf("deal not found: %d", id)
+	}
+	d.SectorStartEpoch = f.head().Height()
+	f.deals[id] = d
+	return nil
+}
+
+// Deal returns a deal published on the chain
+func (f *FakeAPI) Deal(id abi.DealID) (FakeDeal, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.deals[id]
+	return d, ok
+}
+
+// Deals returns all the deals published on the chain
+func (f *FakeAPI) Deals() map[abi.DealID]FakeDeal {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deals := make(map[abi.DealID]FakeDeal, len(f.deals))
+	for id, d := range f.deals {
+		deals[id] = d
+	}
+	return deals
+}
+
+// apply executes a message and returns its receipt. The caller must hold the lock.
+func (f *FakeAPI) apply(msg *Message) MessageReceipt {
+	from := f.actor(msg.From, false)
+	if from == nil {
+		return MessageReceipt{ExitCode: exitcode.SysErrSenderInvalid}
+	}
+	if msg.Nonce != from.Nonce {
+		return MessageReceipt{ExitCode: exitcode.SysErrSenderStateInvalid}
+	}
+	value := msg.Value
+	if value.Nil() {
+		value = big.Zero()
+	}
+	if from.Balance.LessThan(value) {
+		return MessageReceipt{ExitCode: exitcode.SysErrInsufficientFunds}
+	}
+	from.Nonce++
+	from.Balance = big.Sub(from.Balance, value)
+	to := f.actor(msg.To, true)
+	to.Balance = big.Add(to.Balance, value)
+
+	rct := MessageReceipt{ExitCode: exitcode.Ok, GasUsed: fakeGasLimit / 2}
+	if msg.To != builtin.StorageMarketActorAddr {
+		return rct
+	}
+	switch msg.Method {
+	case builtin.MethodsMarket.AddBalance:
+		var addr address.Address
+		if err := addr.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return MessageReceipt{ExitCode: exitcode.ErrSerialization}
+		}
+		bal := f.marketBalance(addr)
+		bal.Escrow = big.Add(bal.Escrow, value)
+		f.balances[f.lookupID(addr)] = bal
+
+	case builtin.MethodsMarket.WithdrawBalance:
+		var params market.WithdrawBalanceParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return MessageReceipt{ExitCode: exitcode.ErrSerialization}
+		}
+		bal := f.marketBalance(params.ProviderOrClientAddress)
+		amt := big.Min(params.Amount, big.Sub(bal.Escrow, bal.Locked))
+		bal.Escrow = big.Sub(bal.Escrow, amt)
+		f.balances[f.lookupID(params.ProviderOrClientAddress)] = bal
+		to.Balance = big.Sub(to.Balance, amt)
+		from.Balance = big.Add(from.Balance, amt)
+
+	case builtin.MethodsMarket.PublishStorageDeals:
+		var params market.PublishStorageDealsParams
+		if err := params.UnmarshalCBOR(bytes.NewReader(msg.Params)); err != nil {
+			return MessageReceipt{ExitCode: exitcode.ErrSerialization}
+		}
+		var ret market.PublishStorageDealsReturn
+		for _, d := range params.Deals {
+			mi, ok := f.miners[f.lookupID(d.Proposal.Provider)]
+			if !ok || f.lookupID(mi.Worker) != f.lookupID(msg.From) {
+				return MessageReceipt{ExitCode: exitcode.ErrForbidden}
+			}
+			cbal := f.marketBalance(d.Proposal.Client)
+			cbal.Locked = big.Add(cbal.Locked, d.Proposal.ClientBalanceRequirement())
+			f.balances[f.lookupID(d.Proposal.Client)] = cbal
+
+			id := f.nextDeal
+			f.nextDeal++
+			f.deals[id] = FakeDeal{
+				Proposal:         d.Proposal,
+				PublishEpoch:     f.head().Height() + 1,
+				SectorStartEpoch: -1,
+			}
+			ret.IDs = append(ret.IDs, id)
+		}
+		buf := new(bytes.Buffer)
+		if err := ret.MarshalCBOR(buf); err != nil {
+			return MessageReceipt{ExitCode: exitcode.ErrSerialization}
+		}
+		rct.Return = buf.Bytes()
+	}
+	return rct
+}
+
+// ChainHead returns the last tipset of the chain
+func (f *FakeAPI) ChainHead(context.Context) (*TipSet, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.head(), nil
+}
+
+// GasEstimateMessageGas fills the gas values left empty with fixed estimates
+func (f *FakeAPI) GasEstimateMessageGas(ctx context.Context, msg *Message, spec *MessageSendSpec, tsk TipSetKey) (*Message, error) {
+	m := *msg
+	if m.GasLimit == 0 {
+		m.GasLimit = fakeGasLimit
+	}
+	if m.GasFeeCap.Nil() || m.GasFeeCap.IsZero() {
+		m.GasFeeCap = FakeBaseFee
+	}
+	if m.GasPremium.Nil() {
+		m.GasPremium = big.Zero()
+	}
+	return &m, nil
+}
+
+// StateGetActor returns the actor of an address or an error if it has never received funds
+func (f *FakeAPI) StateGetActor(ctx context.Context, addr address.Address, tsk TipSetKey) (*Actor, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	act := f.actor(addr, false)
+	if act == nil {
+		return nil, fmt.Errorf("actor not found: %s", addr)
+	}
+	a := *act
+	return &a, nil
+}
+
+// MpoolPush applies the message and includes it in a new tipset
+func (f *FakeAPI) MpoolPush(ctx context.Context, smsg *SignedMessage) (cid.Cid, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := smsg.Cid()
+	if _, ok := f.msgs[c]; ok {
+		return c, nil
+	}
+	rct := f.apply(&smsg.Message)
+	ts := f.advance(1)
+	fm := &fakeMsg{
+		smsg: smsg,
+		lookup: MsgLookup{
+			Message: c,
+			Receipt: rct,
+			TipSet:  ts.Key(),
+			Height:  ts.Height(),
+		},
+	}
+	f.msgs[c] = fm
+	// The unsigned message cid can also be used to look up secp messages
+	f.msgs[smsg.Message.Cid()] = fm
+	return c, nil
+}
+
+// StateWaitMsg returns the receipt of a pushed message, advancing the chain until the message
+// has the requested confidence
+func (f *FakeAPI) StateWaitMsg(ctx context.Context, c cid.Cid, conf uint64) (*MsgLookup, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fm, ok := f.msgs[c]
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", c)
+	}
+	if missing := fm.lookup.Height + abi.ChainEpoch(conf) - f.head().Height(); missing > 0 {
+		f.advance(int(missing))
+	}
+	lkp := fm.lookup
+	return &lkp, nil
+}
+
+// StateAccountKey returns the robust address of an ID address
+func (f *FakeAPI) StateAccountKey(ctx context.Context, addr address.Address, tsk TipSetKey) (address.Address, error) {
+	if addr.Protocol() != address.ID {
+		return addr, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key, ok := f.keys[addr]
+	if !ok {
+		return address.Undef, fmt.Errorf("no account key for %s", addr)
+	}
+	return key, nil
+}
+
+// StateLookupID returns the ID address of an address
+func (f *FakeAPI) StateLookupID(ctx context.Context, addr address.Address, tsk TipSetKey) (address.Address, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.lookupID(addr), nil
+}
+
+// StateReadState returns the balance of an actor. The fake chain has no actor state.
+func (f *FakeAPI) StateReadState(ctx context.Context, addr address.Address, tsk TipSetKey) (*ActorState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	act := f.actor(addr, false)
+	if act == nil {
+		return nil, fmt.Errorf("actor not found: %s", addr)
+	}
+	return &ActorState{Balance: act.Balance}, nil
+}
+
+// StateNetworkVersion returns the network version of the actors the fake chain implements
+func (f *FakeAPI) StateNetworkVersion(ctx context.Context, tsk TipSetKey) (network.Version, error) {
+	return network.Version10, nil
+}
+
+// StateMarketBalance returns the escrow and locked funds of an address in the storage market
+func (f *FakeAPI) StateMarketBalance(ctx context.Context, addr address.Address, tsk TipSetKey) (MarketBalance, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.marketBalance(addr), nil
+}
+
+// StateMarketStorageDeal returns a deal published with PublishDeals and its state
+func (f *FakeAPI) StateMarketStorageDeal(ctx context.Context, id abi.DealID, tsk TipSetKey) (*MarketDeal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	d, ok := f.deals[id]
+	if !ok {
+		return nil, fmt.Errorf("deal not found: %d", id)
+	}
+	return &MarketDeal{
+		Proposal: d.Proposal,
+		State: market.DealState{
+			SectorStartEpoch: d.SectorStartEpoch,
+			LastUpdatedEpoch: -1,
+			SlashEpoch:       -1,
+		},
+	}, nil
+}
+
+// StateDealProviderCollateralBounds returns no minimum or maximum collateral
+func (f *FakeAPI) StateDealProviderCollateralBounds(ctx context.Context, s abi.PaddedPieceSize, verified bool, tsk TipSetKey) (DealCollateralBounds, error) {
+	return DealCollateralBounds{Min: big.Zero(), Max: big.Zero()}, nil
+}
+
+// StateMinerInfo returns the info of a miner added with AddMiner
+func (f *FakeAPI) StateMinerInfo(ctx context.Context, addr address.Address, tsk TipSetKey) (MinerInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	mi, ok := f.miners[f.lookupID(addr)]
+	if !ok {
+		return MinerInfo{}, fmt.Errorf("miner not found: %s", addr)
+	}
+	return mi, nil
+}
+
+// StateMinerProvingDeadline returns the current deadline of miners, all miners start proving at genesis
+func (f *FakeAPI) StateMinerProvingDeadline(ctx context.Context, addr address.Address, tsk TipSetKey) (*dline.Info, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.miners[f.lookupID(addr)]; !ok {
+		return nil, fmt.Errorf("miner not found: %s", addr)
+	}
+	height := f.head().Height()
+	start := height - height%miner.WPoStProvingPeriod
+	idx := uint64((height - start) / miner.WPoStChallengeWindow)
+	return miner.NewDeadlineInfo(start, idx, height), nil
+}
+
+// StateCall runs a message without changing the chain and always succeeds
+func (f *FakeAPI) StateCall(ctx context.Context, msg *Message, tsk TipSetKey) (*InvocResult, error) {
+	return &InvocResult{
+		MsgCid: msg.Cid(),
+		Msg:    msg,
+		MsgRct: &MessageReceipt{ExitCode: exitcode.Ok},
+	}, nil
+}
+
+// StateVerifiedClientStatus returns the datacap of a verified client or nil if it isn't verified
+func (f *FakeAPI) StateVerifiedClientStatus(ctx context.Context, addr address.Address, tsk TipSetKey) (*abi.StoragePower, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	dc, ok := f.dataCaps[f.lookupID(addr)]
+	if !ok {
+		return nil, nil
+	}
+	return &dc, nil
+}
+
+// ChainReadObj returns the bytes stored with PutObject
+func (f *FakeAPI) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects[c]
+	if !ok {
+		return nil, fmt.Errorf("object not found: %s", c)
+	}
+	return data, nil
+}
+
+// ChainGetMessage returns a pushed message from its signed or unsigned cid
+func (f *FakeAPI) ChainGetMessage(ctx context.Context, c cid.Cid) (*Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fm, ok := f.msgs[c]
+	if !ok {
+		return nil, fmt.Errorf("message not found: %s", c)
+	}
+	m := fm.smsg.Message
+	return &m, nil
+}
+
+// Close does nothing as the fake chain has no connection
+func (f *FakeAPI) Close() {}
+
+var _ API = (*FakeAPI)(nil)
@@ -0,0 +1,165 @@
+package filecoin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeAPIChain(t *testing.T) {
+	ctx := context.Background()
+	f1 := NewFakeAPI()
+	f2 := NewFakeAPI()
+
+	ts, err := f1.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(0), ts.Height())
+
+	head := f1.Advance(3)
+	require.Equal(t, abi.ChainEpoch(3), head.Height())
+	require.Equal(t, FakeGenesisTimestamp+3*uint64(builtin.EpochDurationSeconds), head.MinTimestamp())
+
+	// The same steps always produce the same chain
+	require.Equal(t, head.Key(), f2.Advance(3).Key())
+}
+
+func TestFakeAPIMarketFunds(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeAPI()
+
+	client, err := address.NewActorAddress([]byte("client"))
+	require.NoError(t, err)
+	f.SetBalance(client, abi.NewTokenAmount(1000))
+
+	params := new(bytes.Buffer)
+	require.NoError(t, client.MarshalCBOR(params))
+	msg := &Message{
+		To:     builtin.StorageMarketActorAddr,
+		From:   client,
+		Value:  abi.NewTokenAmount(600),
+		Method: builtin.MethodsMarket.AddBalance,
+		Params: params.Bytes(),
+	}
+	msg, err = f.GasEstimateMessageGas(ctx, msg, nil, EmptyTSK)
+	require.NoError(t, err)
+
+	c, err := f.MpoolPush(ctx, &SignedMessage{Message: *msg})
+	require.NoError(t, err)
+
+	lkp, err := f.StateWaitMsg(ctx, c, 5)
+	require.NoError(t, err)
+	require.Equal(t, exitcode.Ok, lkp.Receipt.ExitCode)
+	require.Equal(t, abi.ChainEpoch(1), lkp.Height)
+
+	// Waiting for confidence moved the chain forward
+	ts, err := f.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(6), ts.Height())
+
+	bal, err := f.StateMarketBalance(ctx, client, EmptyTSK)
+	require.NoError(t, err)
+	require.True(t, bal.Escrow.Equals(abi.NewTokenAmount(600)))
+
+	act, err := f.StateGetActor(ctx, client, EmptyTSK)
+	require.NoError(t, err)
+	require.True(t, act.Balance.Equals(abi.NewTokenAmount(400)))
+	require.Equal(t, uint64(1), act.Nonce)
+
+	// Not enough funds
+	msg.Nonce = 1
+	c, err = f.MpoolPush(ctx, &SignedMessage{Message: *msg})
+	require.NoError(t, err)
+	lkp, err = f.StateWaitMsg(ctx, c, 0)
+	require.NoError(t, err)
+	require.Equal(t, exitcode.SysErrInsufficientFunds, lkp.Receipt.ExitCode)
+}
+
+func TestFakeAPIPublishDeals(t *testing.T) {
+	ctx := context.Background()
+	f := NewFakeAPI()
+
+	client, err := address.NewActorAddress([]byte("client"))
+	require.NoError(t, err)
+	maddr, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+	worker, err := address.NewActorAddress([]byte("worker"))
+	require.NoError(t, err)
+
+	f.AddMiner(maddr, MinerInfo{Worker: worker, SectorSize: abi.SectorSize(2048)})
+	f.SetMarketBalance(client, MarketBalance{Escrow: abi.NewTokenAmount(1000), Locked: big.Zero()})
+
+	mi, err := f.StateMinerInfo(ctx, maddr, EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, worker, mi.Worker)
+
+	dl, err := f.StateMinerProvingDeadline(ctx, maddr, EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, abi.ChainEpoch(0), dl.PeriodStart)
+
+	prop := market.ClientDealProposal{
+		Proposal: market.DealProposal{
+			PieceCID:             fakeStateRoot,
+			PieceSize:            abi.PaddedPieceSize(2048),
+			Client:               client,
+			Provider:             maddr,
+			StartEpoch:           10,
+			EndEpoch:             20,
+			StoragePricePerEpoch: abi.NewTokenAmount(10),
+			ProviderCollateral:   big.Zero(),
+			ClientCollateral:     big.Zero(),
+		},
+	}
+	c, err := f.PublishDeals(worker, prop)
+	require.NoError(t, err)
+
+	pubmsg, err := f.ChainGetMessage(ctx, c)
+	require.NoError(t, err)
+	require.Equal(t, builtin.MethodsMarket.PublishStorageDeals, pubmsg.Method)
+
+	lkp, err := f.StateWaitMsg(ctx, c, 5)
+	require.NoError(t, err)
+	require.Equal(t, exitcode.Ok, lkp.Receipt.ExitCode)
+
+	var ret market.PublishStorageDealsReturn
+	require.NoError(t, ret.UnmarshalCBOR(bytes.NewReader(lkp.Receipt.Return)))
+	require.Equal(t, []abi.DealID{0}, ret.IDs)
+
+	deal, ok := f.Deal(0)
+	require.True(t, ok)
+	require.Equal(t, client, deal.Proposal.Client)
+	require.Len(t, f.Deals(), 1)
+
+	// Deals are active once included in a proven sector
+	md, err := f.StateMarketStorageDeal(ctx, 0, EmptyTSK)
+	require.NoError(t, err)
+	require.Equal(t, prop.Proposal.PieceCID, md.Proposal.PieceCID)
+	require.Equal(t, abi.ChainEpoch(-1), md.State.SectorStartEpoch)
+	require.NoError(t, f.ActivateDeal(0))
+	md, err = f.StateMarketStorageDeal(ctx, 0, EmptyTSK)
+	require.NoError(t, err)
+	head, err := f.ChainHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, head.Height(), md.State.SectorStartEpoch)
+	_, err = f.StateMarketStorageDeal(ctx, 1, EmptyTSK)
+	require.Error(t, err)
+
+	// The storage fee is locked
+	bal, err := f.StateMarketBalance(ctx, client, EmptyTSK)
+	require.NoError(t, err)
+	require.True(t, bal.Locked.Equals(abi.NewTokenAmount(100)))
+
+	// Only the worker of the miner can publish its deals
+	c, err = f.PublishDeals(client, prop)
+	require.NoError(t, err)
+	lkp, err = f.StateWaitMsg(ctx, c, 0)
+	require.NoError(t, err)
+	require.Equal(t, exitcode.ErrForbidden, lkp.Receipt.ExitCode)
+}
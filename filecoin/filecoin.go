@@ -24,10 +24,12 @@ type API interface {
 	StateReadState(context.Context, address.Address, TipSetKey) (*ActorState, error)
 	StateNetworkVersion(context.Context, TipSetKey) (network.Version, error)
 	StateMarketBalance(context.Context, address.Address, TipSetKey) (MarketBalance, error)
+	StateMarketStorageDeal(context.Context, abi.DealID, TipSetKey) (*MarketDeal, error)
 	StateDealProviderCollateralBounds(context.Context, abi.PaddedPieceSize, bool, TipSetKey) (DealCollateralBounds, error)
 	StateMinerInfo(context.Context, address.Address, TipSetKey) (MinerInfo, error)
 	StateMinerProvingDeadline(context.Context, address.Address, TipSetKey) (*dline.Info, error)
 	StateCall(context.Context, *Message, TipSetKey) (*InvocResult, error)
+	StateVerifiedClientStatus(context.Context, address.Address, TipSetKey) (*abi.StoragePower, error)
 	ChainReadObj(context.Context, cid.Cid) ([]byte, error)
 	ChainGetMessage(context.Context, cid.Cid) (*Message, error)
 	Close()
@@ -25,10 +25,12 @@ type LotusAPI struct {
 		StateReadState                    func(context.Context, address.Address, TipSetKey) (*ActorState, error)
 		StateNetworkVersion               func(context.Context, TipSetKey) (network.Version, error)
 		StateMarketBalance                func(context.Context, address.Address, TipSetKey) (MarketBalance, error)
+		StateMarketStorageDeal            func(context.Context, abi.DealID, TipSetKey) (*MarketDeal, error)
 		StateDealProviderCollateralBounds func(context.Context, abi.PaddedPieceSize, bool, TipSetKey) (DealCollateralBounds, error)
 		StateMinerInfo                    func(context.Context, address.Address, TipSetKey) (MinerInfo, error)
 		StateMinerProvingDeadline         func(context.Context, address.Address, TipSetKey) (*dline.Info, error)
 		StateCall                         func(context.Context, *Message, TipSetKey) (*InvocResult, error)
+		StateVerifiedClientStatus         func(context.Context, address.Address, TipSetKey) (*abi.StoragePower, error)
 		ChainReadObj                      func(context.Context, cid.Cid) ([]byte, error)
 		ChainGetMessage                   func(context.Context, cid.Cid) (*Message, error)
 	}
@@ -92,6 +94,10 @@ func (a *LotusAPI) StateMarketBalance(ctx context.Context, addr address.Address,
 	return a.Methods.StateMarketBalance(ctx, addr, tsk)
 }
 
+func (a *LotusAPI) StateMarketStorageDeal(ctx context.Context, id abi.DealID, tsk TipSetKey) (*MarketDeal, error) {
+	return a.Methods.StateMarketStorageDeal(ctx, id, tsk)
+}
+
 func (a *LotusAPI) StateDealProviderCollateralBounds(ctx context.Context, size abi.PaddedPieceSize, verified bool, tsk TipSetKey) (DealCollateralBounds, error) {
 	return a.Methods.StateDealProviderCollateralBounds(ctx, size, verified, tsk)
 }
@@ -108,6 +114,10 @@ func (a *LotusAPI) StateCall(ctx context.Context, msg *Message, tsk TipSetKey) (
 	return a.Methods.StateCall(ctx, msg, tsk)
 }
 
+func (a *LotusAPI) StateVerifiedClientStatus(ctx context.Context, addr address.Address, tsk TipSetKey) (*abi.StoragePower, error) {
+	return a.Methods.StateVerifiedClientStatus(ctx, addr, tsk)
+}
+
 func (a *LotusAPI) ChainReadObj(ctx context.Context, c cid.Cid) ([]byte, error) {
 	return a.Methods.ChainReadObj(ctx, c)
 }
@@ -1,4 +1,4 @@
-package payments
+package paychmgr
 
 import (
 	"bytes"
@@ -340,21 +340,11 @@ func (ch *channel) mpoolPush(ctx context.Context, msg *filecoin.Message) (*filec
 		return nil, err
 	}
 	msg.Nonce = act.Nonce
-	mbl, err := msg.ToStorageBlock()
+	smsg, err := wallet.SignMessage(ctx, ch.wal, msg)
 	if err != nil {
 		return nil, err
 	}
 
-	sig, err := ch.wal.Sign(ctx, msg.From, mbl.Cid().Bytes())
-	if err != nil {
-		return nil, err
-	}
-
-	smsg := &filecoin.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
-	}
-
 	if _, err := ch.api.MpoolPush(ctx, smsg); err != nil {
 		if strings.Contains(err.Error(), "already in mpool, increase GasPremium") {
 			// incGas picks up the suggested gas premium from the error message and tries to push
@@ -379,21 +369,11 @@ func (ch *channel) increaseGas(ctx context.Context, msg *filecoin.Message, rec s
 		return nil, err
 	}
 	msg.GasPremium = prem
-	mbl, err := msg.ToStorageBlock()
+	smsg, err := wallet.SignMessage(ctx, ch.wal, msg)
 	if err != nil {
 		return nil, err
 	}
 
-	sig, err := ch.wal.Sign(ctx, msg.From, mbl.Cid().Bytes())
-	if err != nil {
-		return nil, err
-	}
-
-	smsg := &filecoin.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
-	}
-
 	if _, err := ch.api.MpoolPush(ctx, smsg); err != nil {
 		return nil, fmt.Errorf("MpoolPush failed with error: %v", err)
 	}
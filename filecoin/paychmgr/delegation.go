@@ -0,0 +1,150 @@
+package paychmgr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/wallet"
+)
+
+// ErrInvalidAuthorization is returned when an authorization is not signed by its payer
+var ErrInvalidAuthorization = errors.New("invalid payer authorization")
+
+// ErrAuthorizationExpired is returned when paying with an expired authorization
+var ErrAuthorizationExpired = errors.New("payer authorization expired")
+
+// ErrWrongClient is returned when using an authorization issued to another client
+var ErrWrongClient = errors.New("payer authorization issued to another client")
+
+// ErrLimitExceeded is returned when a payment would exceed the limit set by the payer
+var ErrLimitExceeded = errors.New("payer authorization limit exceeded")
+
+// authorizationPrefix separates the authorization signatures from the other payloads a payer signs
+const authorizationPrefix = "pop-payer-authorization:"
+
+// Authorization lets a client pay for retrievals from the payment channels of a payer, so applications
+// can sponsor the retrievals of their users
+type Authorization struct {
+	// Payer is the address funding the payment channels and signing the vouchers
+	Payer address.Address
+	// Client is the default address of the node allowed to spend the payer funds
+	Client address.Address
+	// Limit is the most the client can spend
+	Limit abi.TokenAmount
+	// Expiration is when the client can no longer start retrievals
+	Expiration time.Time
+}
+
+// SigningBytes returns the bytes the payer signs
+func (a Authorization) SigningBytes() ([]byte, error) {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(authorizationPrefix), b...), nil
+}
+
+// SignedAuthorization is an authorization with the signature of the payer
+type SignedAuthorization struct {
+	Authorization
+	Signature *crypto.Signature
+}
+
+// Authorize signs an authorization with the payer key
+func Authorize(ctx context.Context, w wallet.Driver, a Authorization) (*SignedAuthorization, error) {
+	b, err := a.SigningBytes()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := w.Sign(ctx, a.Payer, b)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedAuthorization{
+		Authorization: a,
+		Signature:     sig,
+	}, nil
+}
+
+// Verify checks the authorization was signed by the payer for the given client and is not expired
+func (sa *SignedAuthorization) Verify(client address.Address, now time.Time) error {
+	if sa.Signature == nil {
+		return ErrInvalidAuthorization
+	}
+	if sa.Client != client {
+		return ErrWrongClient
+	}
+	if now.After(sa.Expiration) {
+		return ErrAuthorizationExpired
+	}
+	b, err := sa.SigningBytes()
+	if err != nil {
+		return err
+	}
+	sig, err := wallet.SigTypeSig(sa.Signature.Type)
+	if err != nil {
+		return err
+	}
+	if err := sig.Verify(sa.Signature.Data, sa.Payer, b); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAuthorization, err)
+	}
+	return nil
+}
+
+// Delegation tracks what a client spent from the funds of a payer who authorized it. It lets us fail
+// early before starting a retrieval, the limit itself is enforced by the LimitedPayer signing vouchers.
+type Delegation struct {
+	auth   SignedAuthorization
+	client address.Address
+
+	mu    sync.Mutex
+	spent abi.TokenAmount
+}
+
+// NewDelegation verifies the authorization was issued to the client before spending from it
+func NewDelegation(sa *SignedAuthorization, client address.Address) (*Delegation, error) {
+	if err := sa.Verify(client, time.Now()); err != nil {
+		return nil, err
+	}
+	return &Delegation{
+		auth:   *sa,
+		client: client,
+		spent:  big.Zero(),
+	}, nil
+}
+
+// Payer returns the address paying for our retrievals
+func (d *Delegation) Payer() address.Address {
+	return d.auth.Payer
+}
+
+// Spent returns the total amount reserved for our retrievals so far
+func (d *Delegation) Spent() abi.TokenAmount {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.spent
+}
+
+// Reserve counts the funds of a retrieval against the limit of the authorization
+func (d *Delegation) Reserve(amt abi.TokenAmount) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if time.Now().After(d.auth.Expiration) {
+		return ErrAuthorizationExpired
+	}
+	total := big.Add(d.spent, amt)
+	if total.GreaterThan(d.auth.Limit) {
+		return fmt.Errorf("%w: %s spent of %s", ErrLimitExceeded, filecoin.FIL(d.spent), filecoin.FIL(d.auth.Limit))
+	}
+	d.spent = total
+	return nil
+}
@@ -0,0 +1,134 @@
+package paychmgr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/paych"
+	ds "github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/myelnet/pop/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegation(t *testing.T) {
+	ctx := context.Background()
+
+	sponsor := wallet.NewIPFS(keystore.NewMemKeystore(), nil)
+	payer, err := sponsor.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+
+	user := wallet.NewIPFS(keystore.NewMemKeystore(), nil)
+	client, err := user.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+	other, err := user.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+
+	sa, err := Authorize(ctx, sponsor, Authorization{
+		Payer:      payer,
+		Client:     client,
+		Limit:      abi.NewTokenAmount(1000),
+		Expiration: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	_, err = NewDelegation(sa, other)
+	require.True(t, errors.Is(err, ErrWrongClient))
+
+	d, err := NewDelegation(sa, client)
+	require.NoError(t, err)
+	require.Equal(t, payer, d.Payer())
+
+	require.NoError(t, d.Reserve(abi.NewTokenAmount(600)))
+	require.True(t, errors.Is(d.Reserve(abi.NewTokenAmount(500)), ErrLimitExceeded))
+	require.NoError(t, d.Reserve(abi.NewTokenAmount(400)))
+	require.True(t, d.Spent().Equals(abi.NewTokenAmount(1000)))
+
+	// The client cannot raise its own limit
+	tampered := *sa
+	tampered.Limit = abi.NewTokenAmount(2000)
+	require.True(t, errors.Is(tampered.Verify(client, time.Now()), ErrInvalidAuthorization))
+
+	require.True(t, errors.Is(sa.Verify(client, time.Now().Add(2*time.Hour)), ErrAuthorizationExpired))
+
+	// Only the payer can issue authorizations
+	forged, err := Authorize(ctx, user, Authorization{
+		Payer:      client,
+		Client:     client,
+		Limit:      abi.NewTokenAmount(1000),
+		Expiration: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	forged.Payer = payer
+	require.True(t, errors.Is(forged.Verify(client, time.Now()), ErrInvalidAuthorization))
+}
+
+func TestLimitedPayer(t *testing.T) {
+	ctx := context.Background()
+
+	sponsor := wallet.NewIPFS(keystore.NewMemKeystore(), nil)
+	payer, err := sponsor.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+
+	user := wallet.NewIPFS(keystore.NewMemKeystore(), nil)
+	client, err := user.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+
+	sa, err := Authorize(ctx, sponsor, Authorization{
+		Payer:      payer,
+		Client:     client,
+		Limit:      abi.NewTokenAmount(1000),
+		Expiration: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	chAddr, err := address.NewIDAddress(100)
+	require.NoError(t, err)
+	voucher := func(lane uint64, amt int64) []byte {
+		sv := &paych.SignedVoucher{
+			ChannelAddr: chAddr,
+			Lane:        lane,
+			Nonce:       1,
+			Amount:      abi.NewTokenAmount(amt),
+		}
+		vb, err := sv.SigningBytes()
+		require.NoError(t, err)
+		return vb
+	}
+
+	store := dssync.MutexWrap(ds.NewMapDatastore())
+	lp, err := NewLimitedPayer(sponsor, sa, store)
+	require.NoError(t, err)
+
+	_, err = lp.Sign(ctx, payer, voucher(0, 400))
+	require.NoError(t, err)
+	// Vouchers are cumulative on a lane so only the difference is spent
+	_, err = lp.Sign(ctx, payer, voucher(0, 600))
+	require.NoError(t, err)
+	_, err = lp.Sign(ctx, payer, voucher(1, 500))
+	require.True(t, errors.Is(err, ErrLimitExceeded))
+
+	// The payer doesn't sign anything else
+	_, err = lp.Sign(ctx, payer, []byte("hello"))
+	require.True(t, errors.Is(err, ErrNotVoucher))
+
+	// The spend record survives a restart of the client
+	lp, err = NewLimitedPayer(sponsor, sa, store)
+	require.NoError(t, err)
+	spent, err := lp.Spent()
+	require.NoError(t, err)
+	require.True(t, spent.Equals(abi.NewTokenAmount(600)))
+
+	_, err = lp.Sign(ctx, payer, voucher(1, 500))
+	require.True(t, errors.Is(err, ErrLimitExceeded))
+	sig, err := lp.Sign(ctx, payer, voucher(1, 400))
+	require.NoError(t, err)
+	ok, err := sponsor.Verify(ctx, payer, voucher(1, 400), sig)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
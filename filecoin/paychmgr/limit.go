@@ -0,0 +1,149 @@
+package paychmgr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/paych"
+	"github.com/ipfs/go-datastore"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/wallet"
+)
+
+// ErrNotVoucher is returned when asking the payer to sign bytes which are not a payment voucher
+var ErrNotVoucher = errors.New("payer only signs payment vouchers")
+
+// dsKeyDelegations is where the amounts signed for each authorization are persisted
+const dsKeyDelegations = "/delegations"
+
+// LimitedPayer is the driver signing for a payer who authorized a client. Vouchers redeem the funds
+// of the payer so the amount of each voucher it signs is counted against the limit of the authorization.
+// The spend record is persisted so the limit holds across restarts of the client.
+type LimitedPayer struct {
+	wallet.Driver
+	auth SignedAuthorization
+	ds   datastore.Datastore
+	key  datastore.Key
+
+	mu sync.Mutex
+}
+
+// NewLimitedPayer wraps the driver of the payer to enforce the limit of the authorization
+func NewLimitedPayer(pd wallet.Driver, sa *SignedAuthorization, ds datastore.Datastore) (*LimitedPayer, error) {
+	b, err := sa.SigningBytes()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(b)
+	return &LimitedPayer{
+		Driver: pd,
+		auth:   *sa,
+		ds:     ds,
+		key:    datastore.NewKey(dsKeyDelegations).ChildString(hex.EncodeToString(sum[:16])),
+	}, nil
+}
+
+// laneKey identifies a lane of a payment channel in the spend record
+func laneKey(ch address.Address, lane uint64) string {
+	return fmt.Sprintf("%s/%d", ch, lane)
+}
+
+// lanes returns the highest amount signed on each lane. Voucher amounts are cumulative for a lane
+// so the total spent is the sum of these amounts.
+func (l *LimitedPayer) lanes() (map[string]abi.TokenAmount, error) {
+	b, err := l.ds.Get(l.key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return make(map[string]abi.TokenAmount), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lanes := make(map[string]abi.TokenAmount)
+	if err := json.Unmarshal(b, &lanes); err != nil {
+		return nil, err
+	}
+	return lanes, nil
+}
+
+func total(lanes map[string]abi.TokenAmount) abi.TokenAmount {
+	t := big.Zero()
+	for _, amt := range lanes {
+		t = big.Add(t, amt)
+	}
+	return t
+}
+
+// Spent returns the total amount of the vouchers signed for the authorization
+func (l *LimitedPayer) Spent() (abi.TokenAmount, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lanes, err := l.lanes()
+	if err != nil {
+		return big.Zero(), err
+	}
+	return total(lanes), nil
+}
+
+// Sign only signs vouchers for the payer and records their amount before signing them
+func (l *LimitedPayer) Sign(ctx context.Context, addr address.Address, msg []byte) (*crypto.Signature, error) {
+	if addr != l.auth.Payer {
+		return l.Driver.Sign(ctx, addr, msg)
+	}
+	var sv paych.SignedVoucher
+	if err := sv.UnmarshalCBOR(bytes.NewReader(msg)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotVoucher, err)
+	}
+	// Make sure the bytes are exactly the voucher we account for
+	vb, err := sv.SigningBytes()
+	if err != nil || !bytes.Equal(vb, msg) {
+		return nil, ErrNotVoucher
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if time.Now().After(l.auth.Expiration) {
+		return nil, ErrAuthorizationExpired
+	}
+	lanes, err := l.lanes()
+	if err != nil {
+		return nil, err
+	}
+	lk := laneKey(sv.ChannelAddr, sv.Lane)
+	prev, ok := lanes[lk]
+	if !ok {
+		prev = big.Zero()
+	}
+	if sv.Amount.GreaterThan(prev) {
+		spent := total(lanes)
+		next := big.Add(spent, big.Sub(sv.Amount, prev))
+		if next.GreaterThan(l.auth.Limit) {
+			return nil, fmt.Errorf("%w: %s spent of %s", ErrLimitExceeded, filecoin.FIL(spent), filecoin.FIL(l.auth.Limit))
+		}
+		lanes[lk] = sv.Amount
+		b, err := json.Marshal(lanes)
+		if err != nil {
+			return nil, err
+		}
+		// The amount is recorded before signing so a crash can only leave us more conservative
+		if err := l.ds.Put(l.key, b); err != nil {
+			return nil, err
+		}
+	}
+	return l.Driver.Sign(ctx, addr, msg)
+}
+
+// SignMessage signs messages with the wrapped driver so its confirmation policy still applies
+func (l *LimitedPayer) SignMessage(ctx context.Context, msg *filecoin.Message) (*filecoin.SignedMessage, error) {
+	return wallet.SignMessage(ctx, l.Driver, msg)
+}
@@ -1,4 +1,7 @@
-package payments
+// Package paychmgr manages the Filecoin payment channels paying for retrievals. It creates and funds
+// channels through the Filecoin API, allocates lanes, creates and validates vouchers, submits the best
+// vouchers of inbound channels and settles and collects channels once retrievals complete.
+package paychmgr
 
 import (
 	"context"
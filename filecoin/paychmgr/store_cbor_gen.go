@@ -1,6 +1,6 @@
 // Code generated by github.com/whyrusleeping/cbor-gen. DO NOT EDIT.
 
-package payments
+package paychmgr
 
 import (
 	"fmt"
@@ -180,7 +180,7 @@ func (t *ChannelInfo) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
-	// t.Vouchers ([]*payments.VoucherInfo) (slice)
+	// t.Vouchers ([]*paychmgr.VoucherInfo) (slice)
 	if len(t.Vouchers) > cbg.MaxLength {
 		return xerrors.Errorf("Slice value in field t.Vouchers was too long")
 	}
@@ -320,7 +320,7 @@ func (t *ChannelInfo) UnmarshalCBOR(r io.Reader) error {
 		t.Direction = uint64(extra)
 
 	}
-	// t.Vouchers ([]*payments.VoucherInfo) (slice)
+	// t.Vouchers ([]*paychmgr.VoucherInfo) (slice)
 
 	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sync"
 
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	miner3 "github.com/filecoin-project/specs-actors/v3/actors/builtin"
@@ -28,6 +29,32 @@ type Adapter struct {
 	fAPI    fil.API
 	wallet  wallet.Driver
 	fundmgr *FundManager
+
+	lmu    sync.Mutex
+	labels map[labelKey]string
+}
+
+// labelKey identifies a proposal before it is signed. The market client labels proposals
+// with the payload root by default.
+type labelKey struct {
+	root     string
+	provider address.Address
+}
+
+// setLabel replaces the label of the next proposal for the root with the provider until released
+func (a *Adapter) setLabel(root cid.Cid, provider address.Address, label string) func() {
+	k := labelKey{root: root.String(), provider: provider}
+	a.lmu.Lock()
+	defer a.lmu.Unlock()
+	if a.labels == nil {
+		a.labels = make(map[labelKey]string)
+	}
+	a.labels[k] = label
+	return func() {
+		a.lmu.Lock()
+		defer a.lmu.Unlock()
+		delete(a.labels, k)
+	}
 }
 
 // GetChainHead returns a tipset token for the current chain head
@@ -58,19 +85,10 @@ func (a *Adapter) AddFunds(ctx context.Context, addr address.Address, amount abi
 		return cid.Undef, err
 	}
 	msg.Nonce = act.Nonce
-	mbl, err := msg.ToStorageBlock()
+	smsg, err := wallet.SignMessage(ctx, a.wallet, msg)
 	if err != nil {
 		return cid.Undef, err
 	}
-	sig, err := a.wallet.Sign(ctx, msg.From, mbl.Cid().Bytes())
-	if err != nil {
-		return cid.Undef, err
-	}
-
-	smsg := &fil.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
-	}
 	return a.fAPI.MpoolPush(ctx, smsg)
 }
 
@@ -243,6 +261,12 @@ func (a *Adapter) ValidatePublishedDeal(ctx context.Context, deal sm.ClientDeal)
 
 // SignProposal signs a DealProposal
 func (a *Adapter) SignProposal(ctx context.Context, signer address.Address, proposal market3.DealProposal) (*market3.ClientDealProposal, error) {
+	a.lmu.Lock()
+	if label, ok := a.labels[labelKey{root: proposal.Label, provider: proposal.Provider}]; ok {
+		proposal.Label = label
+	}
+	a.lmu.Unlock()
+
 	// TODO: output spec signed proposal
 	buf, err := cborutil.Dump(&proposal)
 	if err != nil {
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	market3 "github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/wallet"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProposalLabel(t *testing.T) {
+	ctx := context.Background()
+	w := wallet.NewIPFS(keystore.NewMemKeystore(), nil)
+	client, err := w.NewKey(ctx, wallet.KTSecp256k1)
+	require.NoError(t, err)
+
+	ad := &Adapter{
+		fAPI:   fil.NewMockLotusAPI(),
+		wallet: w,
+	}
+
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	p1, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	p2, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	release := ad.setLabel(root, p1, "project-42")
+
+	sp, err := ad.SignProposal(ctx, client, market3.DealProposal{
+		Client:   client,
+		Provider: p1,
+		PieceCID: root,
+		Label:    root.String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, "project-42", sp.Proposal.Label)
+
+	// The signature covers the new label
+	buf, err := cborutil.Dump(&sp.Proposal)
+	require.NoError(t, err)
+	ok, err := w.Verify(ctx, client, buf, &sp.ClientSignature)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Proposals to other providers keep the default label
+	sp, err = ad.SignProposal(ctx, client, market3.DealProposal{
+		Client:   client,
+		Provider: p2,
+		PieceCID: root,
+		Label:    root.String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, root.String(), sp.Proposal.Label)
+
+	release()
+	sp, err = ad.SignProposal(ctx, client, market3.DealProposal{
+		Client:   client,
+		Provider: p1,
+		PieceCID: root,
+		Label:    root.String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, root.String(), sp.Proposal.Label)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// ErrBudgetExceeded is returned when the cheapest miners cost more than our budget
+var ErrBudgetExceeded = errors.New("budget exceeded")
+
+// ErrNotEnoughMiners is returned when fewer miners than the replication factor fit our params
+var ErrNotEnoughMiners = errors.New("not enough miners")
+
+// dealPrice is the price of storing a piece for the given number of epochs at a price per GiB per epoch
+func dealPrice(price abi.TokenAmount, pieceSize uint64, epochs abi.ChainEpoch) fil.FIL {
+	gib := fil.NewInt(1 << 30)
+	epochPrice := fil.BigDiv(fil.BigMul(price, fil.NewInt(pieceSize)), gib)
+	return fil.FIL(fil.BigMul(epochPrice, fil.NewInt(uint64(epochs))))
+}
+
+// selectWithinBudget returns the rf cheapest miners and their total price if it fits in the budget.
+// As each deal is priced independently, no other set of rf miners costs less. Miners are expected to
+// be sorted by reliability which breaks the ties between miners asking the same price.
+func selectWithinBudget(miners []Miner, prices map[address.Address]fil.FIL, rf int, budget fil.FIL) ([]Miner, fil.FIL, error) {
+	if len(miners) < rf {
+		return nil, fil.FIL{}, fmt.Errorf("%w: %d miners fit those parameters, %d needed", ErrNotEnoughMiners, len(miners), rf)
+	}
+	sorted := append([]Miner{}, miners...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return fil.BigInt(prices[sorted[i].Info.Address]).LessThan(fil.BigInt(prices[sorted[j].Info.Address]))
+	})
+	sel := sorted[:rf]
+
+	total := fil.NewInt(0)
+	for _, m := range sel {
+		total = fil.BigAdd(total, fil.BigInt(prices[m.Info.Address]))
+	}
+	if total.GreaterThan(fil.BigInt(budget)) {
+		return nil, fil.FIL(total), fmt.Errorf("%w: the %d cheapest miners cost %s, budget is %s", ErrBudgetExceeded, rf, fil.FIL(total), budget)
+	}
+	return sel, fil.FIL(total), nil
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectWithinBudget(t *testing.T) {
+	miners := testMiners(t, 5)
+	prices := make(map[address.Address]fil.FIL)
+	for i, p := range []int64{50, 10, 30, 10, 20} {
+		prices[miners[i].Info.Address] = fil.FIL(fil.NewInt(uint64(p)))
+	}
+
+	sel, total, err := selectWithinBudget(miners, prices, 3, fil.FIL(fil.NewInt(40)))
+	require.NoError(t, err)
+	require.True(t, fil.NewInt(40).Equals(fil.BigInt(total)))
+	// Ties keep the reliability order
+	require.Equal(t, []Miner{miners[1], miners[3], miners[4]}, sel)
+
+	_, total, err = selectWithinBudget(miners, prices, 3, fil.FIL(fil.NewInt(39)))
+	require.True(t, errors.Is(err, ErrBudgetExceeded))
+	require.True(t, fil.NewInt(40).Equals(fil.BigInt(total)))
+
+	_, _, err = selectWithinBudget(miners, prices, 6, fil.FIL(fil.NewInt(1000)))
+	require.True(t, errors.Is(err, ErrNotEnoughMiners))
+}
+
+func TestDealPrice(t *testing.T) {
+	// 1 GiB for 10 epochs at 2 per GiB per epoch
+	require.True(t, fil.NewInt(20).Equals(fil.BigInt(dealPrice(abi.NewTokenAmount(2), 1<<30, 10))))
+	// Half a GiB
+	require.True(t, fil.NewInt(10).Equals(fil.BigInt(dealPrice(abi.NewTokenAmount(2), 1<<29, 10))))
+}
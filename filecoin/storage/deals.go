@@ -0,0 +1,267 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// ErrDealNotFound is returned when we have no record of a deal
+var ErrDealNotFound = errors.New("deal not found")
+
+// DealPhase groups the many states of a storage deal into what users care about
+type DealPhase string
+
+const (
+	// DealPhaseActive is a deal being negotiated, transferred, published or sealed
+	DealPhaseActive DealPhase = "active"
+	// DealPhaseSealed is a deal the miner proved on chain
+	DealPhaseSealed DealPhase = "sealed"
+	// DealPhaseExpired is a deal which reached its end epoch
+	DealPhaseExpired DealPhase = "expired"
+	// DealPhaseFailed is a deal which was rejected, failed or slashed
+	DealPhaseFailed DealPhase = "failed"
+)
+
+// phaseOf returns the phase of a deal state
+func phaseOf(s storagemarket.StorageDealStatus) DealPhase {
+	switch s {
+	case storagemarket.StorageDealActive:
+		return DealPhaseSealed
+	case storagemarket.StorageDealExpired:
+		return DealPhaseExpired
+	case storagemarket.StorageDealError,
+		storagemarket.StorageDealFailing,
+		storagemarket.StorageDealSlashed,
+		storagemarket.StorageDealProposalRejected,
+		storagemarket.StorageDealProposalNotFound:
+		return DealPhaseFailed
+	default:
+		return DealPhaseActive
+	}
+}
+
+// DealTransition is a change of state of a deal
+type DealTransition struct {
+	Event   string
+	State   storagemarket.StorageDealStatus
+	Message string
+	Time    time.Time
+}
+
+// StateName returns a human readable name of the state the deal entered
+func (t DealTransition) StateName() string {
+	return storagemarket.DealStates[t.State]
+}
+
+// DealRecord is the history of a storage deal we proposed
+type DealRecord struct {
+	ProposalCid cid.Cid
+	Root        cid.Cid
+	Miner       address.Address
+	PieceCID    cid.Cid
+	PieceSize   abi.PaddedPieceSize
+	// Price is the price per epoch of the deal
+	Price      abi.TokenAmount
+	StartEpoch abi.ChainEpoch
+	EndEpoch   abi.ChainEpoch
+	// DealID is the ID of the deal on chain once published
+	DealID  abi.DealID
+	State   storagemarket.StorageDealStatus
+	Message string
+	// Transitions are the states the deal went through, oldest first
+	Transitions []DealTransition
+	// PieceCheck is the verification of the piece CID once the deal is published
+	PieceCheck *PieceCheck
+	Created    time.Time
+	Updated    time.Time
+}
+
+// Phase returns the phase the deal is in
+func (r DealRecord) Phase() DealPhase {
+	return phaseOf(r.State)
+}
+
+// StateName returns a human readable name of the deal state
+func (r DealRecord) StateName() string {
+	return storagemarket.DealStates[r.State]
+}
+
+// DealTracker records the state transitions of our storage deals so we can follow them after
+// StartDeal returns. Records are persisted in the datastore keyed by proposal CID.
+type DealTracker struct {
+	ds     datastore.Batching
+	now    func() time.Time
+	mu     sync.Mutex
+	faults faultListeners
+}
+
+// NewDealTracker creates a tracker persisting its records in the datastore
+func NewDealTracker(ds datastore.Batching) *DealTracker {
+	return &DealTracker{
+		ds:  namespace.Wrap(ds, datastore.NewKey("/deals/")),
+		now: time.Now,
+	}
+}
+
+func (dt *DealTracker) get(k cid.Cid) (*DealRecord, error) {
+	b, err := dt.ds.Get(datastore.NewKey(k.String()))
+	if err == datastore.ErrNotFound {
+		return nil, ErrDealNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r DealRecord
+	if err := json.Unmarshal(b, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// record applies an event to the record of a deal. Transitions are only added when the state changes.
+// It returns the fault of a deal we knew about entering a state putting the content at risk, if any.
+func (dt *DealTracker) record(event string, deal storagemarket.ClientDeal) (*DealFault, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	now := dt.now()
+	r, err := dt.get(deal.ProposalCid)
+	known := err == nil
+	if err == ErrDealNotFound {
+		r = &DealRecord{ProposalCid: deal.ProposalCid, Created: now}
+	} else if err != nil {
+		return nil, err
+	}
+	prev, prevState := r.Phase(), r.State
+	if deal.DataRef != nil {
+		r.Root = deal.DataRef.Root
+	}
+	r.Miner = deal.Proposal.Provider
+	r.PieceCID = deal.Proposal.PieceCID
+	r.PieceSize = deal.Proposal.PieceSize
+	r.Price = deal.Proposal.StoragePricePerEpoch
+	r.StartEpoch = deal.Proposal.StartEpoch
+	r.EndEpoch = deal.Proposal.EndEpoch
+	r.DealID = deal.DealID
+	if deal.Message != "" {
+		r.Message = deal.Message
+	}
+	if len(r.Transitions) == 0 || r.State != deal.State {
+		r.Transitions = append(r.Transitions, DealTransition{
+			Event:   event,
+			State:   deal.State,
+			Message: deal.Message,
+			Time:    now,
+		})
+	}
+	r.State = deal.State
+	r.Updated = now
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if err := dt.ds.Put(datastore.NewKey(deal.ProposalCid.String()), b); err != nil {
+		return nil, err
+	}
+	if !known || prevState == r.State || !isFault(prev, r.State) {
+		return nil, nil
+	}
+	return &DealFault{
+		ProposalCid: r.ProposalCid,
+		Root:        r.Root,
+		Miner:       r.Miner,
+		DealID:      r.DealID,
+		State:       r.State,
+		Message:     r.Message,
+		Sealed:      prev == DealPhaseSealed,
+		Time:        now,
+	}, nil
+}
+
+// recordDealEvent is subscribed to the storage client events
+func (dt *DealTracker) recordDealEvent(event storagemarket.ClientEvent, deal storagemarket.ClientDeal) {
+	f, err := dt.record(storagemarket.ClientEvents[event], deal)
+	if err == nil && f != nil {
+		dt.faults.notify(*f)
+	}
+}
+
+// backfill records the deals the storage client knows about but we don't, for instance deals
+// made before tracking existed
+func (dt *DealTracker) backfill(ctx context.Context, client storagemarket.StorageClient) error {
+	deals, err := client.ListLocalDeals(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range deals {
+		if _, err := dt.get(d.ProposalCid); err != ErrDealNotFound {
+			continue
+		}
+		if _, err := dt.record("", d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetDeal returns the record of a deal from its proposal CID
+func (dt *DealTracker) GetDeal(proposal cid.Cid) (DealRecord, error) {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+	r, err := dt.get(proposal)
+	if err != nil {
+		return DealRecord{}, err
+	}
+	return *r, nil
+}
+
+// ListDeals returns the records of our deals in the given phases, all of them if none is given.
+// The most recently updated deals come first.
+func (dt *DealTracker) ListDeals(phases ...DealPhase) ([]DealRecord, error) {
+	res, err := dt.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var recs []DealRecord
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		var r DealRecord
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			continue
+		}
+		if len(phases) > 0 && !hasPhase(phases, r.Phase()) {
+			continue
+		}
+		recs = append(recs, r)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Updated.After(recs[j].Updated)
+	})
+	return recs, nil
+}
+
+func hasPhase(phases []DealPhase, p DealPhase) bool {
+	for _, ph := range phases {
+		if ph == p {
+			return true
+		}
+	}
+	return false
+}
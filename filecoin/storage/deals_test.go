@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDealTracker(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	now := time.Now()
+	dt := NewDealTracker(ds)
+	dt.now = func() time.Time { return now }
+
+	bg := blocksutil.NewBlockGenerator()
+	m, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	newDeal := func() storagemarket.ClientDeal {
+		deal := storagemarket.ClientDeal{
+			ProposalCid: bg.Next().Cid(),
+			DataRef:     &storagemarket.DataRef{Root: bg.Next().Cid()},
+		}
+		deal.Proposal.Provider = m
+		deal.Proposal.PieceSize = abi.PaddedPieceSize(2048)
+		deal.Proposal.StoragePricePerEpoch = abi.NewTokenAmount(100)
+		return deal
+	}
+
+	sealed := newDeal()
+	sealed.State = storagemarket.StorageDealStartDataTransfer
+	dt.recordDealEvent(storagemarket.ClientEventOpen, sealed)
+	// Events without a state change don't add transitions
+	now = now.Add(time.Minute)
+	dt.recordDealEvent(storagemarket.ClientEventOpen, sealed)
+	now = now.Add(time.Minute)
+	sealed.State = storagemarket.StorageDealActive
+	sealed.DealID = 42
+	dt.recordDealEvent(storagemarket.ClientEventDealActivated, sealed)
+
+	failed := newDeal()
+	failed.State = storagemarket.StorageDealError
+	failed.Message = "miner rejected the deal"
+	now = now.Add(time.Minute)
+	dt.recordDealEvent(storagemarket.ClientEventFailed, failed)
+
+	rec, err := dt.GetDeal(sealed.ProposalCid)
+	require.NoError(t, err)
+	require.Equal(t, DealPhaseSealed, rec.Phase())
+	require.Equal(t, abi.DealID(42), rec.DealID)
+	require.Equal(t, sealed.DataRef.Root, rec.Root)
+	require.Equal(t, m, rec.Miner)
+	require.Len(t, rec.Transitions, 2)
+	require.Equal(t, storagemarket.StorageDealStartDataTransfer, rec.Transitions[0].State)
+	require.Equal(t, storagemarket.StorageDealActive, rec.Transitions[1].State)
+	require.True(t, rec.Price.Equals(abi.NewTokenAmount(100)))
+
+	// Records persist in the datastore
+	dt = NewDealTracker(ds)
+	recs, err := dt.ListDeals()
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	require.Equal(t, failed.ProposalCid, recs[0].ProposalCid)
+	require.Equal(t, "miner rejected the deal", recs[0].Message)
+
+	recs, err = dt.ListDeals(DealPhaseFailed, DealPhaseExpired)
+	require.NoError(t, err)
+	require.Len(t, recs, 1)
+	require.Equal(t, DealPhaseFailed, recs[0].Phase())
+
+	recs, err = dt.ListDeals(DealPhaseActive)
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+
+	_, err = dt.GetDeal(bg.Next().Cid())
+	require.Equal(t, ErrDealNotFound, err)
+}
+
+func TestDealFaults(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	dt := NewDealTracker(ds)
+
+	bg := blocksutil.NewBlockGenerator()
+	m, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	var faults []DealFault
+	unsub := dt.faults.subscribe(func(f DealFault) {
+		faults = append(faults, f)
+	})
+
+	newDeal := func(state storagemarket.StorageDealStatus) storagemarket.ClientDeal {
+		deal := storagemarket.ClientDeal{
+			ProposalCid: bg.Next().Cid(),
+			DataRef:     &storagemarket.DataRef{Root: bg.Next().Cid()},
+			State:       state,
+		}
+		deal.Proposal.Provider = m
+		return deal
+	}
+
+	// Deals failing before they were sealed are not faults
+	rejected := newDeal(storagemarket.StorageDealStartDataTransfer)
+	dt.recordDealEvent(storagemarket.ClientEventOpen, rejected)
+	rejected.State = storagemarket.StorageDealError
+	dt.recordDealEvent(storagemarket.ClientEventFailed, rejected)
+	require.Len(t, faults, 0)
+
+	// Nor are deals we discover in a failed state
+	dt.recordDealEvent(storagemarket.ClientEventFailed, newDeal(storagemarket.StorageDealSlashed))
+	require.Len(t, faults, 0)
+
+	sealed := newDeal(storagemarket.StorageDealActive)
+	sealed.DealID = 42
+	dt.recordDealEvent(storagemarket.ClientEventDealActivated, sealed)
+	sealed.State = storagemarket.StorageDealSlashed
+	sealed.Message = "sector terminated"
+	dt.recordDealEvent(storagemarket.ClientEventDealSlashed, sealed)
+	// Events without a state change are only reported once
+	dt.recordDealEvent(storagemarket.ClientEventDealSlashed, sealed)
+	require.Len(t, faults, 1)
+	require.Equal(t, sealed.ProposalCid, faults[0].ProposalCid)
+	require.Equal(t, sealed.DataRef.Root, faults[0].Root)
+	require.Equal(t, m, faults[0].Miner)
+	require.Equal(t, abi.DealID(42), faults[0].DealID)
+	require.Equal(t, "sector terminated", faults[0].Message)
+	require.True(t, faults[0].Sealed)
+
+	// Sealed deals failing lost a copy too
+	failing := newDeal(storagemarket.StorageDealActive)
+	dt.recordDealEvent(storagemarket.ClientEventDealActivated, failing)
+	failing.State = storagemarket.StorageDealFailing
+	dt.recordDealEvent(storagemarket.ClientEventFailed, failing)
+	failing.State = storagemarket.StorageDealError
+	dt.recordDealEvent(storagemarket.ClientEventFailed, failing)
+	require.Len(t, faults, 2)
+	require.Equal(t, storagemarket.StorageDealFailing, faults[1].State)
+
+	unsub()
+	unwatched := newDeal(storagemarket.StorageDealActive)
+	dt.recordDealEvent(storagemarket.ClientEventDealActivated, unwatched)
+	unwatched.State = storagemarket.StorageDealSlashed
+	dt.recordDealEvent(storagemarket.ClientEventDealSlashed, unwatched)
+	require.Len(t, faults, 2)
+}
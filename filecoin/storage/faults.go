@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+)
+
+// DealFault is a deal of a content we stored which the miner stopped honoring. The storage market
+// reports deals whose sector was terminated or faulted for too long as slashed.
+type DealFault struct {
+	ProposalCid cid.Cid
+	Root        cid.Cid
+	Miner       address.Address
+	DealID      abi.DealID
+	State       storagemarket.StorageDealStatus
+	Message     string
+	// Sealed is set when the miner had proven the content before the fault so a copy was lost
+	Sealed bool
+	// Repairing is set when we will propose deals to alternate miners to replace this one. Otherwise
+	// the content should be pushed again to keep the same number of copies.
+	Repairing bool
+	Time      time.Time
+}
+
+// StateName returns a human readable name of the state the deal is in
+func (f DealFault) StateName() string {
+	return storagemarket.DealStates[f.State]
+}
+
+// isFault tells if a deal entering the given state from a previous phase puts the content at risk.
+// Deals failing before they were sealed never held the content and are only repaired.
+func isFault(prev DealPhase, state storagemarket.StorageDealStatus) bool {
+	if state == storagemarket.StorageDealSlashed {
+		return true
+	}
+	return prev == DealPhaseSealed && phaseOf(state) == DealPhaseFailed
+}
+
+// FaultListener is called when a deal of our content faults
+type FaultListener func(DealFault)
+
+// faultListeners notifies the subsystems reporting faults to the publisher
+type faultListeners struct {
+	mu     sync.Mutex
+	nextID int
+	fns    map[int]FaultListener
+}
+
+func (l *faultListeners) subscribe(fn FaultListener) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fns == nil {
+		l.fns = make(map[int]FaultListener)
+	}
+	id := l.nextID
+	l.nextID++
+	l.fns[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.fns, id)
+	}
+}
+
+func (l *faultListeners) notify(f DealFault) {
+	l.mu.Lock()
+	fns := make([]FaultListener, 0, len(l.fns))
+	for _, fn := range l.fns {
+		fns = append(fns, fn)
+	}
+	l.mu.Unlock()
+	for _, fn := range fns {
+		fn(f)
+	}
+}
+
+// SubscribeToFaults calls fn whenever a deal of our content is slashed or fails after it was sealed.
+// The returned function stops the subscription.
+func (s *Storage) SubscribeToFaults(fn FaultListener) func() {
+	return s.deals.faults.subscribe(func(f DealFault) {
+		f.Repairing = s.repairing(f.Root)
+		fn(f)
+	})
+}
+
+// repairing tells if the repair loop will replace the failed deals of a content
+func (s *Storage) repairing(root cid.Cid) bool {
+	if !root.Defined() {
+		return false
+	}
+	b, err := s.repairs.Get(datastore.NewKey(root.String()))
+	if err != nil {
+		return false
+	}
+	var r replication
+	if err := json.Unmarshal(b, &r); err != nil {
+		return false
+	}
+	return len(r.Alternates) > 0
+}
@@ -17,6 +17,7 @@ import (
 	dsq "github.com/ipfs/go-datastore/query"
 	fil "github.com/myelnet/pop/filecoin"
 	"github.com/myelnet/pop/wallet"
+	"github.com/rs/zerolog"
 	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
@@ -52,18 +53,10 @@ func (a *fundManagerAPI) MpoolPushMessage(ctx context.Context, msg *fil.Message,
 		return nil, err
 	}
 	msg.Nonce = act.Nonce
-	mbl, err := msg.ToStorageBlock()
+	smsg, err := wallet.SignMessage(ctx, a.wallet, msg)
 	if err != nil {
 		return nil, err
 	}
-	sig, err := a.wallet.Sign(ctx, msg.From, mbl.Cid().Bytes())
-	if err != nil {
-		return nil, err
-	}
-	smsg := &fil.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
-	}
 	_, err = a.api.MpoolPush(ctx, smsg)
 	return smsg, err
 }
@@ -82,12 +75,13 @@ type FundManager struct {
 	shutdown context.CancelFunc
 	api      FundManagerAPI
 	str      *Store
+	log      zerolog.Logger
 
 	lk          sync.Mutex
 	fundedAddrs map[address.Address]*fundedAddress
 }
 
-func NewFundManager(ds datastore.Batching, fapi fil.API, w wallet.Driver) *FundManager {
+func NewFundManager(ds datastore.Batching, fapi fil.API, w wallet.Driver, log zerolog.Logger) *FundManager {
 	ctx, cancel := context.WithCancel(context.Background())
 	api := &fundManagerAPI{fapi, w}
 	return &FundManager{
@@ -95,6 +89,7 @@ func NewFundManager(ds datastore.Batching, fapi fil.API, w wallet.Driver) *FundM
 		shutdown:    cancel,
 		api:         api,
 		str:         newStore(ds),
+		log:         log,
 		fundedAddrs: make(map[address.Address]*fundedAddress),
 	}
 }
@@ -158,6 +153,47 @@ func (fm *FundManager) GetReserved(addr address.Address) abi.TokenAmount {
 	return fm.getFundedAddress(addr).getReserved()
 }
 
+// Balance is the state of the storage market funds of an address
+type Balance struct {
+	Addr address.Address
+	// Escrow is all the funds deposited in the storage market
+	Escrow abi.TokenAmount
+	// Locked is the part of the escrow locked on chain for the payment and collateral of published deals
+	Locked abi.TokenAmount
+	// Reserved is the part of the escrow set aside for deals not published yet
+	Reserved abi.TokenAmount
+	// Available is what can be withdrawn: the escrow neither locked nor reserved
+	Available abi.TokenAmount
+	// PendingMsg is the cid of a deposit or withdrawal message not yet on chain
+	PendingMsg *cid.Cid
+}
+
+// Balance returns the market balance of the address with the funds we reserved for it
+func (fm *FundManager) Balance(ctx context.Context, addr address.Address) (Balance, error) {
+	bal, err := fm.api.StateMarketBalance(ctx, addr, fil.EmptyTSK)
+	if err != nil {
+		return Balance{}, err
+	}
+	fa := fm.getFundedAddress(addr)
+	fa.lk.RLock()
+	reserved := fa.state.AmtReserved
+	pending := fa.state.MsgCid
+	fa.lk.RUnlock()
+
+	avail := fil.BigSub(fil.BigSub(bal.Escrow, bal.Locked), reserved)
+	if avail.LessThan(abi.NewTokenAmount(0)) {
+		avail = abi.NewTokenAmount(0)
+	}
+	return Balance{
+		Addr:       addr,
+		Escrow:     bal.Escrow,
+		Locked:     bal.Locked,
+		Reserved:   reserved,
+		Available:  avail,
+		PendingMsg: pending,
+	}, nil
+}
+
 // FundedAddressState keeps track of the state of an address with funds in the
 // datastore
 type FundedAddressState struct {
@@ -175,6 +211,7 @@ type fundedAddress struct {
 	ctx context.Context
 	env *fundManagerEnvironment
 	str *Store
+	log zerolog.Logger
 
 	lk    sync.RWMutex
 	state *FundedAddressState
@@ -193,6 +230,7 @@ func newFundedAddress(fm *FundManager, addr address.Address) *fundedAddress {
 		ctx: fm.ctx,
 		env: &fundManagerEnvironment{api: fm.api},
 		str: fm.str,
+		log: fm.log.With().Str("addr", addr.String()).Logger(),
 		state: &FundedAddressState{
 			Addr:        addr,
 			AmtReserved: abi.NewTokenAmount(0),
@@ -347,7 +385,7 @@ func (a *fundedAddress) saveState() {
 	// Not much we can do if saving to the datastore fails, just log
 	err := a.str.save(a.state)
 	if err != nil {
-		fmt.Printf("saving state to store for addr %s: %v\n", a.state.Addr, err)
+		a.log.Error().Err(err).Msg("saving state to store")
 	}
 }
 
@@ -602,7 +640,7 @@ func (a *fundedAddress) startWaitForResults(msgCid cid.Cid) {
 		if err != nil {
 			// We don't really care about the results here, we're just waiting
 			// so as to only process one on-chain message at a time
-			fmt.Printf("waiting for results of message %s for addr %s: %v\n", msgCid, a.state.Addr, err)
+			a.log.Warn().Err(err).Str("msg", msgCid.String()).Msg("waiting for results of message")
 		}
 
 		a.lk.Lock()
@@ -616,8 +654,7 @@ func (a *fundedAddress) startWaitForResults(msgCid cid.Cid) {
 
 func (a *fundedAddress) debugf(args ...interface{}) {
 	fmtStr := args[0].(string)
-	args = args[1:]
-	fmt.Printf(a.state.Addr.String()+": "+fmtStr+"\n", args...)
+	a.log.Debug().Msgf(fmtStr, args[1:]...)
 }
 
 // The result of a fund request
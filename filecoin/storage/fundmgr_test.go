@@ -19,6 +19,7 @@ import (
 	keystore "github.com/ipfs/go-ipfs-keystore"
 	fil "github.com/myelnet/pop/filecoin"
 	"github.com/myelnet/pop/wallet"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
@@ -108,6 +109,28 @@ func TestFundManagerBasic(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestFundManagerBalance(t *testing.T) {
+	s := setup(t)
+	defer s.fm.Stop()
+
+	sentinel, err := s.fm.Reserve(s.ctx, s.walletAddr, s.acctAddr, abi.NewTokenAmount(10))
+	require.NoError(t, err)
+	s.mockApi.completeMsg(sentinel)
+
+	require.NoError(t, s.fm.Release(s.acctAddr, abi.NewTokenAmount(4)))
+
+	bal, err := s.fm.Balance(s.ctx, s.acctAddr)
+	require.NoError(t, err)
+	require.Equal(t, s.acctAddr, bal.Addr)
+	require.Equal(t, abi.NewTokenAmount(10), bal.Escrow)
+	require.Equal(t, abi.NewTokenAmount(6), bal.Reserved)
+	require.Equal(t, abi.NewTokenAmount(4), bal.Available)
+
+	// Only the available funds can be withdrawn
+	_, err = s.fm.Withdraw(s.ctx, s.walletAddr, s.acctAddr, abi.NewTokenAmount(5))
+	require.Error(t, err)
+}
+
 type scaffold struct {
 	ctx        context.Context
 	ds         datastore.Batching
@@ -138,6 +161,7 @@ func setup(t *testing.T) *scaffold {
 		shutdown:    cancel,
 		api:         mockAPI,
 		str:         newStore(dstore),
+		log:         zerolog.Nop(),
 		fundedAddrs: make(map[address.Address]*fundedAddress),
 	}
 	return &scaffold{
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+)
+
+// ErrNoFundsAvailable is returned when withdrawing while all the escrow is locked or reserved
+var ErrNoFundsAvailable = errors.New("no funds available to withdraw")
+
+// Reservation is the funds the storage client set aside in escrow for a deal until it is published
+type Reservation struct {
+	ProposalCid cid.Cid
+	Root        cid.Cid
+	Miner       address.Address
+	Amount      abi.TokenAmount
+	State       storagemarket.StorageDealStatus
+}
+
+// StateName returns a human readable name of the deal state
+func (r Reservation) StateName() string {
+	return storagemarket.DealStates[r.State]
+}
+
+// Funds returns the storage market balance of the address with the funds reserved for our deals
+func (s *Storage) Funds(ctx context.Context, addr address.Address) (Balance, error) {
+	return s.fundmgr.Balance(ctx, addr)
+}
+
+// Reservations returns the funds reserved for each deal not published yet
+func (s *Storage) Reservations(ctx context.Context) ([]Reservation, error) {
+	deals, err := s.client.ListLocalDeals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var res []Reservation
+	for _, d := range deals {
+		if d.FundsReserved.Nil() || d.FundsReserved.LessThanEqual(abi.NewTokenAmount(0)) {
+			continue
+		}
+		res = append(res, Reservation{
+			ProposalCid: d.ProposalCid,
+			Root:        d.DataRef.Root,
+			Miner:       d.Proposal.Provider,
+			Amount:      d.FundsReserved,
+			State:       d.State,
+		})
+	}
+	return res, nil
+}
+
+// WithdrawFunds moves escrow that is neither locked nor reserved back to the wallet of the address.
+// A nil amount withdraws all the available funds. It returns the cid of the withdrawal message.
+func (s *Storage) WithdrawFunds(ctx context.Context, addr address.Address, amt abi.TokenAmount) (cid.Cid, error) {
+	if amt.Nil() {
+		bal, err := s.fundmgr.Balance(ctx, addr)
+		if err != nil {
+			return cid.Undef, err
+		}
+		amt = bal.Available
+	}
+	if amt.LessThanEqual(abi.NewTokenAmount(0)) {
+		return cid.Undef, ErrNoFundsAvailable
+	}
+	return s.fundmgr.Withdraw(ctx, addr, addr, amt)
+}
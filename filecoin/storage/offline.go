@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/filecoin-project/go-commp-utils/writer"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-multistore"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipld/go-car"
+)
+
+// Piece is the CAR file of a content exported for offline deals with its piece commitment
+type Piece struct {
+	Root cid.Cid
+	// Path is the file the CAR was written to
+	Path      string
+	CarSize   int64
+	PieceCID  cid.Cid
+	PieceSize abi.PaddedPieceSize
+}
+
+// CARExporter writes the DAG of a store as a CARv2 file with an index and copies the CARv1 data
+// payload to payload
+type CARExporter interface {
+	ExportCAR(ctx context.Context, id uint64, root cid.Cid, w io.Writer, payload io.Writer) error
+}
+
+// SetCARExporter exports pieces from the CAR files of the stores instead of traversing the DAG
+func (s *Storage) SetCARExporter(cars CARExporter) {
+	s.cars = cars
+}
+
+// ExportPiece writes the CAR of the content to a file at the given path and computes its piece
+// commitment while writing so the file can be shipped to miners who import it for offline deals.
+// With a CAR exporter the file is a CARv2 and the piece commits to its CARv1 data payload.
+func (s *Storage) ExportPiece(ctx context.Context, root cid.Cid, path string) (*Piece, error) {
+	sid, err := s.sp.GetStoreID(root)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sum writer.DataCIDSize
+	if s.cars != nil {
+		sum, err = exportCommitment(ctx, s.cars, uint64(sid), root, f)
+	} else {
+		var store *multistore.Store
+		store, err = s.ms.Get(sid)
+		if err != nil {
+			return nil, err
+		}
+		sum, err = pieceCommitment(ctx, store.DAG, root, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return &Piece{
+		Root:      root,
+		Path:      path,
+		CarSize:   sum.PayloadSize,
+		PieceCID:  sum.PieceCID,
+		PieceSize: sum.PieceSize,
+	}, nil
+}
+
+// pieceCommitment computes the piece commitment of the CAR of the content, copying the CAR to out
+func pieceCommitment(ctx context.Context, dag ipldformat.DAGService, root cid.Cid, out io.Writer) (writer.DataCIDSize, error) {
+	cw := &writer.Writer{}
+	bw := bufio.NewWriterSize(io.MultiWriter(out, cw), int(writer.CommPBuf))
+	if err := car.WriteCar(ctx, dag, []cid.Cid{root}, bw); err != nil {
+		return writer.DataCIDSize{}, fmt.Errorf("failed to write CAR: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return writer.DataCIDSize{}, err
+	}
+	sum, err := cw.Sum()
+	if err != nil {
+		return writer.DataCIDSize{}, fmt.Errorf("failed to compute piece commitment: %w", err)
+	}
+	return sum, nil
+}
+
+// exportCommitment computes the piece commitment of the CARv1 payload while the exporter writes the CARv2
+func exportCommitment(ctx context.Context, cars CARExporter, id uint64, root cid.Cid, out io.Writer) (writer.DataCIDSize, error) {
+	cw := &writer.Writer{}
+	bw := bufio.NewWriterSize(cw, int(writer.CommPBuf))
+	if err := cars.ExportCAR(ctx, id, root, out, bw); err != nil {
+		return writer.DataCIDSize{}, fmt.Errorf("failed to export CAR: %w", err)
+	}
+	if err := bw.Flush(); err != nil {
+		return writer.DataCIDSize{}, err
+	}
+	sum, err := cw.Sum()
+	if err != nil {
+		return writer.DataCIDSize{}, fmt.Errorf("failed to compute piece commitment: %w", err)
+	}
+	return sum, nil
+}
+
+// StoreOffline proposes deals with a manual transfer for a piece we exported. No data is sent to the
+// miners: they start sealing once they import the piece file for the deal proposals of the receipt.
+// Offline deals are not repaired as the piece would need to be shipped again.
+func (s *Storage) StoreOffline(ctx context.Context, p Params, piece *Piece) (*Receipt, error) {
+	p.Payload = &storagemarket.DataRef{
+		TransferType: storagemarket.TTManual,
+		Root:         piece.Root,
+		PieceCid:     &piece.PieceCID,
+		PieceSize:    piece.PieceSize.Unpadded(),
+	}
+	p.PieceSize = piece.PieceSize
+	return s.Store(ctx, p)
+}
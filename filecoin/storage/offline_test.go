@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-commp-utils/writer"
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/require"
+)
+
+type testSupplier struct {
+	stores map[cid.Cid]multistore.StoreID
+}
+
+func (s testSupplier) GetStoreID(c cid.Cid) (multistore.StoreID, error) {
+	id, ok := s.stores[c]
+	if !ok {
+		return 0, datastore.ErrNotFound
+	}
+	return id, nil
+}
+
+func (s testSupplier) ListMiners(ctx context.Context) ([]address.Address, error) {
+	return nil, nil
+}
+
+func TestExportPiece(t *testing.T) {
+	ctx := context.Background()
+	ms, err := multistore.NewMultiDstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	sid := ms.Next()
+	store, err := ms.Get(sid)
+	require.NoError(t, err)
+
+	leaf := merkledag.NewRawNode([]byte("offline deals"))
+	root := merkledag.NodeWithData([]byte("root"))
+	require.NoError(t, root.AddNodeLink("leaf", leaf))
+	require.NoError(t, store.DAG.AddMany(ctx, []ipldformat.Node{leaf, root}))
+
+	s := &Storage{
+		ms: ms,
+		sp: testSupplier{stores: map[cid.Cid]multistore.StoreID{root.Cid(): sid}},
+	}
+	path := filepath.Join(t.TempDir(), "piece.car")
+	piece, err := s.ExportPiece(ctx, root.Cid(), path)
+	require.NoError(t, err)
+	require.Equal(t, root.Cid(), piece.Root)
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	fi, err := f.Stat()
+	require.NoError(t, err)
+	require.Equal(t, fi.Size(), piece.CarSize)
+
+	// The file holds the DAG and hashes to the same piece commitment
+	cr, err := car.NewCarReader(f)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{root.Cid()}, cr.Header.Roots)
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	cw := &writer.Writer{}
+	_, err = io.Copy(cw, f)
+	require.NoError(t, err)
+	sum, err := cw.Sum()
+	require.NoError(t, err)
+	require.Equal(t, sum.PieceCID, piece.PieceCID)
+	require.Equal(t, sum.PieceSize, piece.PieceSize)
+
+	_, err = s.ExportPiece(ctx, leaf.Cid(), path)
+	require.Error(t, err)
+}
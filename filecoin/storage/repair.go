@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// ErrAllDealsFailed is returned when no deal could be started with any of the miners
+var ErrAllDealsFailed = errors.New("all deals failed")
+
+// RepairInterval is how often we check the replication of our content
+const RepairInterval = 10 * time.Minute
+
+// DealOutcome is the result of proposing a deal to a miner
+type DealOutcome struct {
+	Miner address.Address
+	// Proposal is the CID of the deal proposal, undefined if the deal failed to start
+	Proposal cid.Cid
+	Err      string
+}
+
+// startDeals proposes deals to the candidates in order until rf deals are started or no candidate is left.
+// It returns the outcome for every miner we tried and the index of the first candidate we didn't try.
+func startDeals(ctx context.Context, rf int, candidates []Miner, start func(Miner) (cid.Cid, error)) ([]DealOutcome, int) {
+	var outcomes []DealOutcome
+	started := 0
+	i := 0
+	for ; i < len(candidates) && started < rf; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		m := candidates[i]
+		o := DealOutcome{Miner: m.Info.Address}
+		pcid, err := start(m)
+		if err != nil {
+			o.Err = err.Error()
+		} else {
+			o.Proposal = pcid
+			started++
+		}
+		outcomes = append(outcomes, o)
+	}
+	return outcomes, i
+}
+
+// replication is the storage of a content we keep topping up with alternate miners when deals fail
+type replication struct {
+	Root     cid.Cid
+	Duration time.Duration
+	Wallet   address.Address
+	Label    string
+	// RF is how many deals we want for the content
+	RF    int
+	Deals []cid.Cid
+	// Alternates are the miners from the quote we haven't proposed to yet
+	Alternates []Miner
+	Verified   bool
+	PieceSize  abi.PaddedPieceSize
+}
+
+// health counts the deals which haven't failed and the ones which are sealed. Deals we have no record of
+// yet are assumed to be in progress.
+func (r replication) health(deals *DealTracker) (healthy int, sealed int) {
+	for _, d := range r.Deals {
+		rec, err := deals.GetDeal(d)
+		if err != nil {
+			healthy++
+			continue
+		}
+		switch rec.Phase() {
+		case DealPhaseFailed:
+		case DealPhaseSealed, DealPhaseExpired:
+			healthy++
+			sealed++
+		default:
+			healthy++
+		}
+	}
+	return healthy, sealed
+}
+
+func (s *Storage) putReplication(r replication) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.repairs.Put(datastore.NewKey(r.Root.String()), b)
+}
+
+func (s *Storage) replications() ([]replication, error) {
+	res, err := s.repairs.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var reps []replication
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		var r replication
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			continue
+		}
+		reps = append(reps, r)
+	}
+	return reps, nil
+}
+
+// Repair proposes deals to alternate miners for the content whose deals failed. Content is no longer
+// repaired once all its deals are sealed or we ran out of alternate miners.
+func (s *Storage) Repair(ctx context.Context) error {
+	reps, err := s.replications()
+	if err != nil {
+		return err
+	}
+	for _, r := range reps {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := s.repair(ctx, r); err != nil {
+			s.log.Error().Err(err).Str("root", r.Root.String()).Msg("failed to repair replication")
+		}
+	}
+	return nil
+}
+
+func (s *Storage) repair(ctx context.Context, r replication) error {
+	healthy, sealed := r.health(s.deals)
+	if sealed >= r.RF {
+		return s.repairs.Delete(datastore.NewKey(r.Root.String()))
+	}
+	if healthy >= r.RF {
+		return nil
+	}
+	if len(r.Alternates) == 0 {
+		s.log.Warn().Str("root", r.Root.String()).Int("deals", healthy).Int("rf", r.RF).Msg("no alternate miner left to repair replication")
+		return s.repairs.Delete(datastore.NewKey(r.Root.String()))
+	}
+	if r.Verified {
+		// We keep the replication around in case the wallet gets more datacap
+		if err := s.CheckDataCap(ctx, r.Wallet, r.PieceSize, r.RF-healthy); err != nil {
+			return err
+		}
+	}
+	p := NewParams(r.Root, r.Duration, r.Wallet, nil)
+	p.Label = r.Label
+	p.Verified = r.Verified
+	p.PieceSize = r.PieceSize
+	outcomes, next := startDeals(ctx, r.RF-healthy, r.Alternates, s.dealStarter(ctx, p))
+	for _, o := range outcomes {
+		if o.Proposal.Defined() {
+			r.Deals = append(r.Deals, o.Proposal)
+			s.log.Info().Str("root", r.Root.String()).Str("miner", o.Miner.String()).Msg("proposed replacement deal")
+		}
+	}
+	r.Alternates = r.Alternates[next:]
+	return s.putReplication(r)
+}
+
+// repairLoop periodically repairs our replications until the context is done
+func (s *Storage) repairLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Repair(ctx); err != nil && ctx.Err() == nil {
+				s.log.Error().Err(err).Msg("failed to repair replications")
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// dealStarter returns a function starting a deal with a miner for the given params
+func (s *Storage) dealStarter(ctx context.Context, p Params) func(Miner) (cid.Cid, error) {
+	epochs := calcEpochs(p.Duration)
+	return func(m Miner) (cid.Cid, error) {
+		pcid, err := s.StartDeal(ctx, StartDealParams{
+			Data:              p.Payload,
+			Wallet:            p.Address,
+			Miner:             m,
+			EpochPrice:        askPrice(m.Ask, p.Verified),
+			MinBlocksDuration: uint64(epochs),
+			DealStartEpoch:    -1,
+			FastRetrieval:     false,
+			VerifiedDeal:      p.Verified,
+			Label:             p.Label,
+		})
+		if err != nil {
+			s.tracker.RecordFailure(m.Info.Address, err)
+			return cid.Undef, err
+		}
+		return *pcid, nil
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	dss "github.com/ipfs/go-datastore/sync"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func testMiners(t *testing.T, n int) []Miner {
+	var miners []Miner
+	for i := 0; i < n; i++ {
+		a, err := address.NewIDAddress(uint64(1000 + i))
+		require.NoError(t, err)
+		miners = append(miners, Miner{
+			Ask:  &storagemarket.StorageAsk{Miner: a},
+			Info: &storagemarket.StorageProviderInfo{Address: a},
+		})
+	}
+	return miners
+}
+
+func TestStartDeals(t *testing.T) {
+	ctx := context.Background()
+	gen := blocksutil.NewBlockGenerator()
+	miners := testMiners(t, 5)
+
+	failing := map[address.Address]bool{
+		miners[1].Info.Address: true,
+		miners[2].Info.Address: true,
+	}
+	start := func(m Miner) (cid.Cid, error) {
+		if failing[m.Info.Address] {
+			return cid.Undef, errors.New("deal rejected")
+		}
+		return gen.Next().Cid(), nil
+	}
+
+	// Failed miners are replaced with the next candidates
+	outcomes, next := startDeals(ctx, 2, miners, start)
+	require.Len(t, outcomes, 4)
+	require.Equal(t, 4, next)
+	require.True(t, outcomes[0].Proposal.Defined())
+	require.Equal(t, "deal rejected", outcomes[1].Err)
+	require.False(t, outcomes[2].Proposal.Defined())
+	require.Equal(t, miners[3].Info.Address, outcomes[3].Miner)
+	require.True(t, outcomes[3].Proposal.Defined())
+
+	// We stop when no candidate is left
+	outcomes, next = startDeals(ctx, 3, miners[1:3], start)
+	require.Len(t, outcomes, 2)
+	require.Equal(t, 2, next)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	outcomes, next = startDeals(cctx, 2, miners, start)
+	require.Len(t, outcomes, 0)
+	require.Equal(t, 0, next)
+}
+
+func TestRepairHealth(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	gen := blocksutil.NewBlockGenerator()
+	s := &Storage{
+		deals:   NewDealTracker(ds),
+		tracker: NewMinerTracker(ds),
+		repairs: namespace.Wrap(ds, datastore.NewKey("/replications/")),
+		log:     zerolog.Nop(),
+	}
+
+	record := func(state storagemarket.StorageDealStatus) cid.Cid {
+		deal := storagemarket.ClientDeal{ProposalCid: gen.Next().Cid(), State: state}
+		s.deals.recordDealEvent(storagemarket.ClientEventOpen, deal)
+		return deal.ProposalCid
+	}
+
+	r := replication{
+		Root: gen.Next().Cid(),
+		RF:   2,
+		Deals: []cid.Cid{
+			record(storagemarket.StorageDealActive),
+			record(storagemarket.StorageDealError),
+			// Deals we know nothing about yet are in progress
+			gen.Next().Cid(),
+		},
+	}
+	healthy, sealed := r.health(s.deals)
+	require.Equal(t, 2, healthy)
+	require.Equal(t, 1, sealed)
+
+	// Healthy replications are left alone
+	require.NoError(t, s.putReplication(r))
+	require.NoError(t, s.Repair(ctx))
+	reps, err := s.replications()
+	require.NoError(t, err)
+	require.Len(t, reps, 1)
+
+	// Replications we cannot repair anymore are dropped
+	r.Deals = r.Deals[:2]
+	require.NoError(t, s.putReplication(r))
+	require.NoError(t, s.Repair(ctx))
+	reps, err = s.replications()
+	require.NoError(t, err)
+	require.Len(t, reps, 0)
+
+	// So are replications with all their deals sealed
+	r.Deals = []cid.Cid{record(storagemarket.StorageDealActive), record(storagemarket.StorageDealActive)}
+	r.Alternates = testMiners(t, 1)
+	require.NoError(t, s.putReplication(r))
+	require.NoError(t, s.Repair(ctx))
+	reps, err = s.replications()
+	require.NoError(t, err)
+	require.Len(t, reps, 0)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/filecoin-project/go-address"
@@ -20,16 +21,27 @@ import (
 	"github.com/filecoin-project/specs-actors/v3/actors/builtin"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
 	fil "github.com/myelnet/pop/filecoin"
 	"github.com/myelnet/pop/wallet"
+	"github.com/rs/zerolog"
 )
 
 const dealStartBufferHours uint64 = 49
 
+// MaxLabelSize is the maximum length in bytes of a deal label accepted by the market actor
+const MaxLabelSize = 256
+
+// ErrLabelTooLong is returned when a deal label would be rejected on chain
+var ErrLabelTooLong = fmt.Errorf("deal label exceeds %d bytes", MaxLabelSize)
+
+// ErrInsufficientDataCap is returned when the wallet cannot pay for verified deals with its datacap
+var ErrInsufficientDataCap = errors.New("insufficient datacap")
+
 // BlockDelaySecs is the time elapsed between each block
 const BlockDelaySecs = uint64(builtin.EpochDurationSeconds)
 
@@ -50,18 +62,84 @@ type Supplier interface {
 	MinerLister
 }
 
+// NetworkConfig tunes how we reach miners when negotiating deals. Operators on bad links or dealing
+// with slow miners may need more attempts or longer backoffs.
+type NetworkConfig struct {
+	// MinBackoff and MaxBackoff bound the delay between attempts to open a stream to a miner
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Attempts is how many times we try to open a stream before giving up
+	Attempts float64
+	// BackoffFactor multiplies the delay after each failed attempt
+	BackoffFactor float64
+	// PollingInterval is how often we check the state of our deals with the miners
+	PollingInterval time.Duration
+	// QueryWorkers is how many miners we ping and query asks from at the same time when selecting miners
+	QueryWorkers int
+	// QueryTimeout bounds how long we wait for a single miner to answer
+	QueryTimeout time.Duration
+}
+
+// DefaultNetworkConfig is used for all the zero values of a NetworkConfig
+var DefaultNetworkConfig = NetworkConfig{
+	MinBackoff:      time.Second,
+	MaxBackoff:      5 * time.Minute,
+	Attempts:        15,
+	BackoffFactor:   5,
+	PollingInterval: time.Second,
+	QueryWorkers:    16,
+	QueryTimeout:    30 * time.Second,
+}
+
+// withDefaults replaces the zero values with the defaults
+func (c NetworkConfig) withDefaults() NetworkConfig {
+	d := DefaultNetworkConfig
+	if c.MinBackoff > 0 {
+		d.MinBackoff = c.MinBackoff
+	}
+	if c.MaxBackoff > 0 {
+		d.MaxBackoff = c.MaxBackoff
+	}
+	if c.Attempts > 0 {
+		d.Attempts = c.Attempts
+	}
+	if c.BackoffFactor > 0 {
+		d.BackoffFactor = c.BackoffFactor
+	}
+	if c.PollingInterval > 0 {
+		d.PollingInterval = c.PollingInterval
+	}
+	if c.QueryWorkers > 0 {
+		d.QueryWorkers = c.QueryWorkers
+	}
+	if c.QueryTimeout > 0 {
+		d.QueryTimeout = c.QueryTimeout
+	}
+	return d
+}
+
 // Storage is a minimal system for creating basic storage deals on Filecoin
 type Storage struct {
 	host    host.Host
 	client  storagemarket.StorageClient
+	dt      datatransfer.Manager
+	ms      *multistore.MultiStore
 	adapter *Adapter
 	fundmgr *FundManager
 	fAPI    fil.API
 	sp      Supplier
+	cars    CARExporter
 	disc    *discoveryimpl.Local
+	tracker *MinerTracker
+	infos   *infoCache
+	deals   *DealTracker
+	repairs datastore.Batching
+	cfg     NetworkConfig
+	log     zerolog.Logger
 }
 
-// New creates a new storage client instance
+// New creates a new storage client instance. Failures of background operations are reported to the logger.
+// Zero values of the network config use the defaults.
 func New(
 	h host.Host,
 	bs blockstore.Blockstore,
@@ -71,15 +149,18 @@ func New(
 	w wallet.Driver,
 	api fil.API,
 	sp Supplier,
+	cfg NetworkConfig,
+	log zerolog.Logger,
 ) (*Storage, error) {
-	fundmgr := NewFundManager(ds, api, w)
+	fundmgr := NewFundManager(ds, api, w, log)
 	ad := &Adapter{
 		fAPI:    api,
 		wallet:  w,
 		fundmgr: fundmgr,
 	}
 
-	marketsRetryParams := smnet.RetryParameters(time.Second, 5*time.Minute, 15, 5)
+	cfg = cfg.withDefaults()
+	marketsRetryParams := smnet.RetryParameters(cfg.MinBackoff, cfg.MaxBackoff, cfg.Attempts, cfg.BackoffFactor)
 	net := smnet.NewFromLibp2pHost(h, marketsRetryParams)
 
 	disc, err := discoveryimpl.NewLocal(ds)
@@ -87,7 +168,7 @@ func New(
 		return nil, err
 	}
 
-	c, err := storageimpl.NewClient(net, bs, ms, dt, disc, ds, ad, storageimpl.DealPollingInterval(time.Second))
+	c, err := storageimpl.NewClient(net, bs, ms, dt, disc, ds, ad, storageimpl.DealPollingInterval(cfg.PollingInterval))
 	if err != nil {
 		return nil, err
 	}
@@ -95,11 +176,19 @@ func New(
 	return &Storage{
 		host:    h,
 		client:  c,
+		dt:      dt,
+		ms:      ms,
 		adapter: ad,
 		fundmgr: fundmgr,
 		sp:      sp,
 		fAPI:    api,
 		disc:    disc,
+		tracker: NewMinerTracker(ds),
+		infos:   newInfoCache(),
+		deals:   NewDealTracker(ds),
+		repairs: namespace.Wrap(ds, datastore.NewKey("/replications/")),
+		cfg:     cfg,
+		log:     log,
 	}, nil
 }
 
@@ -114,7 +203,32 @@ func (s *Storage) Start(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	return s.client.Start(ctx)
+	s.client.SubscribeToEvents(s.tracker.recordDealEvent)
+	s.client.SubscribeToEvents(s.deals.recordDealEvent)
+	s.client.SubscribeToEvents(s.verifyPublishedPieces(ctx))
+	if err := s.client.Start(ctx); err != nil {
+		return err
+	}
+	if err := s.deals.backfill(ctx, s.client); err != nil {
+		s.log.Error().Err(err).Msg("failed to record existing deals")
+	}
+	go s.repairLoop(ctx, RepairInterval)
+	return nil
+}
+
+// Tracker returns the history of the miners we dealt with
+func (s *Storage) Tracker() *MinerTracker {
+	return s.tracker
+}
+
+// ListDeals returns the deals we proposed in the given phases, all of them if none is given
+func (s *Storage) ListDeals(phases ...DealPhase) ([]DealRecord, error) {
+	return s.deals.ListDeals(phases...)
+}
+
+// GetDeal returns the history of a deal from its proposal CID
+func (s *Storage) GetDeal(proposal cid.Cid) (DealRecord, error) {
+	return s.deals.GetDeal(proposal)
 }
 
 // Miner encapsulates some information about a storage miner
@@ -129,18 +243,118 @@ type MinerSelectionParams struct {
 	MaxPrice  uint64
 	PieceSize uint64
 	RF        int
+	// Verified compares the verified price of the miners with our max price
+	Verified bool
+	// Refresh queries the miners again instead of reusing the asks and info we cached
+	Refresh bool
+	// MaxLatency excludes the miners slower to answer our pings. Zero for no limit.
+	MaxLatency time.Duration
+	// KeepAll returns all the miners matching the params instead of the most reliable ones
+	KeepAll bool
 }
 
-// LoadMiners selects a set of miners to queue storage deals with
+// LoadMiners selects a set of miners to queue storage deals with. Miners who failed us often are skipped
+// and recent asks are reused from the tracker.
 func (s *Storage) LoadMiners(ctx context.Context, msp MinerSelectionParams) ([]Miner, error) {
 	addrs, err := s.sp.ListMiners(ctx)
 	if err != nil {
 		return nil, err
 	}
+	// Cached asks expiring before the current height are queried again
+	var height abi.ChainEpoch
+	if ts, err := s.fAPI.ChainHead(ctx); err == nil && ts != nil {
+		height = ts.Height()
+	}
 
+	var mu sync.Mutex
 	var sel []Miner
-	lats := make(map[address.Address]time.Duration)
+	err = probeMiners(ctx, addrs, s.cfg.QueryWorkers, func(ctx context.Context, a address.Address) error {
+		m, err := s.loadMiner(ctx, a, msp, height)
+		if err != nil || m == nil {
+			return err
+		}
+		mu.Lock()
+		sel = append(sel, *m)
+		mu.Unlock()
+		return nil
+	})
+	if ctx.Err() != nil {
+		return sel, ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Sort by score then latency
+	recs := make(map[address.Address]MinerRecord, len(sel))
+	for _, m := range sel {
+		recs[m.Info.Address] = s.tracker.Record(m.Info.Address)
+	}
+	sort.Slice(sel, func(i, j int) bool {
+		return compareMiners(recs[sel[i].Info.Address], recs[sel[j].Info.Address])
+	})
+	// Only keep the lowest latencies
+	// We add 2 on top of the replication factor in case some deals fails
+	l := msp.RF + 2
+	if len(sel) > l && !msp.KeepAll {
+		return sel[:l], nil
+	}
+	return sel, nil
+}
+
+// probeMiners calls fn for each miner with at most workers calls running at the same time.
+// It stops dispatching after the first error and returns it.
+func probeMiners(ctx context.Context, addrs []address.Address, workers int, fn func(context.Context, address.Address) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan address.Address)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(addrs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for a := range jobs {
+				if err := fn(ctx, a); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+feed:
 	for _, a := range addrs {
+		select {
+		case jobs <- a:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// loadMiner returns the miner if its ask matches our params or nil if it doesn't or cannot be reached
+func (s *Storage) loadMiner(ctx context.Context, a address.Address, msp MinerSelectionParams, height abi.ChainEpoch) (*Miner, error) {
+	if s.tracker.Skip(a) {
+		s.log.Debug().Str("miner", a.String()).Msg("skipping unreliable miner")
+		return nil, nil
+	}
+	ci, ok := s.infos.get(a, s.tracker.AskTTL)
+	if !ok || msp.Refresh {
 		mi, err := s.fAPI.StateMinerInfo(ctx, a, fil.EmptyTSK)
 		if err != nil {
 			return nil, err
@@ -149,63 +363,127 @@ func (s *Storage) LoadMiners(ctx context.Context, msp MinerSelectionParams) ([]M
 		if mi.PeerId == nil {
 			return nil, fmt.Errorf("no peer id for miner %v", a)
 		}
-		info := NewStorageProviderInfo(a, mi.Worker, mi.SectorSize, *mi.PeerId, mi.Multiaddrs)
+		ci = cachedInfo{
+			info:  NewStorageProviderInfo(a, mi.Worker, mi.SectorSize, *mi.PeerId, mi.Multiaddrs),
+			proof: mi.WindowPoStProofType,
+		}
+		s.infos.put(a, ci)
+	}
+	info := ci.info
 
-		ai := peer.AddrInfo{
-			ID:    info.PeerID,
-			Addrs: info.Addrs,
+	var ask *storagemarket.StorageAsk
+	if !msp.Refresh {
+		ask, _ = s.tracker.CachedAsk(a, height)
+	}
+	if ask == nil {
+		var err error
+		qctx, cancel := context.WithTimeout(ctx, s.cfg.QueryTimeout)
+		ask, err = s.queryMiner(qctx, info)
+		cancel()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
-		// We need to connect directly with the peer to ping them
-		err = s.host.Connect(ctx, ai)
 		if err != nil {
-			continue
+			s.log.Debug().Err(err).Str("miner", a.String()).Msg("failed to query miner")
+			s.tracker.RecordFailure(a, err)
+			return nil, nil
 		}
-		pings := ping.Ping(ctx, s.host, *mi.PeerId)
+	}
 
-		select {
-		case p := <-pings:
-			if p.Error != nil {
-				// If any error we know they're probably not reachable
-				continue
-			}
-			lats[a] = p.RTT
-		case <-ctx.Done():
-			return sel, ctx.Err()
-		}
+	if fil.NewInt(msp.MaxPrice).LessThan(askPrice(ask, msp.Verified)) {
+		return nil, nil
+	}
 
-		ask, err := s.client.GetAsk(ctx, info)
-		if err != nil {
-			fmt.Println("error", err)
-			continue
-		}
+	if msp.MaxLatency > 0 && s.tracker.Record(a).Latency > msp.MaxLatency {
+		return nil, nil
+	}
 
-		if fil.NewInt(msp.MaxPrice).LessThan(ask.Price) {
-			continue
-		}
+	// Check miners can fit our piece
+	if msp.PieceSize > uint64(ask.MaxPieceSize) ||
+		msp.PieceSize < uint64(ask.MinPieceSize) {
+		return nil, nil
+	}
 
-		// Check miners can fit our piece
-		if msp.PieceSize > uint64(ask.MaxPieceSize) ||
-			msp.PieceSize < uint64(ask.MinPieceSize) {
-			continue
-		}
+	return &Miner{
+		Ask:                 ask,
+		Info:                &info,
+		WindowPoStProofType: ci.proof,
+	}, nil
+}
+
+// cachedInfo is the on chain info of a miner we keep for the session
+type cachedInfo struct {
+	info  storagemarket.StorageProviderInfo
+	proof abi.RegisteredPoStProof
+	at    time.Time
+}
 
-		sel = append(sel, Miner{
-			Ask:                 ask,
-			Info:                &info,
-			WindowPoStProofType: mi.WindowPoStProofType,
-		})
+// infoCache saves a chain call per miner when selecting miners again shortly after
+type infoCache struct {
+	mu    sync.Mutex
+	infos map[address.Address]cachedInfo
+}
+
+func newInfoCache() *infoCache {
+	return &infoCache{infos: make(map[address.Address]cachedInfo)}
+}
+
+// get returns the info of a miner if we cached it less than ttl ago
+func (c *infoCache) get(a address.Address, ttl time.Duration) (cachedInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ci, ok := c.infos[a]
+	if !ok || time.Since(ci.at) > ttl {
+		return cachedInfo{}, false
 	}
-	// Sort by latency
-	sort.Slice(sel, func(i, j int) bool {
-		return lats[sel[i].Info.Address] < lats[sel[j].Info.Address]
-	})
-	// Only keep the lowest latencies
-	// We add 2 on top of the replication factor in case some deals fails
-	l := msp.RF + 2
-	if len(sel) > l {
-		return sel[:l], nil
+	return ci, true
+}
+
+func (c *infoCache) put(a address.Address, ci cachedInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ci.at = time.Now()
+	c.infos[a] = ci
+}
+
+// askPrice returns the price per GiB per epoch a miner asks for regular or verified deals
+func askPrice(ask *storagemarket.StorageAsk, verified bool) abi.TokenAmount {
+	if verified {
+		return ask.VerifiedPrice
 	}
-	return sel, nil
+	return ask.Price
+}
+
+// queryMiner pings a miner and requests its ask, recording both in the tracker
+func (s *Storage) queryMiner(ctx context.Context, info storagemarket.StorageProviderInfo) (*storagemarket.StorageAsk, error) {
+	ai := peer.AddrInfo{
+		ID:    info.PeerID,
+		Addrs: info.Addrs,
+	}
+	// We need to connect directly with the peer to ping them
+	err := s.host.Connect(ctx, ai)
+	if err != nil {
+		return nil, err
+	}
+	pings := ping.Ping(ctx, s.host, info.PeerID)
+
+	select {
+	case p := <-pings:
+		if p.Error != nil {
+			// If any error we know they're probably not reachable
+			return nil, p.Error
+		}
+		s.tracker.RecordLatency(info.Address, p.RTT)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	ask, err := s.client.GetAsk(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+	s.tracker.RecordAsk(info.Address, ask)
+	return ask, nil
 }
 
 // StartDealParams are params configurable on the user side
@@ -219,6 +497,8 @@ type StartDealParams struct {
 	DealStartEpoch     abi.ChainEpoch
 	FastRetrieval      bool
 	VerifiedDeal       bool
+	// Label is recorded in the deal proposal on chain. Defaults to the payload root.
+	Label string
 }
 
 // StartDeal starts a new storage deal with a Filecoin storage miner
@@ -248,6 +528,14 @@ func (s *Storage) StartDeal(ctx context.Context, params StartDealParams) (*cid.C
 		return nil, fmt.Errorf("failed to get seal proof type: %w", err)
 	}
 
+	if params.Label != "" {
+		if len(params.Label) > MaxLabelSize {
+			return nil, ErrLabelTooLong
+		}
+		release := s.adapter.setLabel(params.Data.Root, params.Miner.Info.Address, params.Label)
+		defer release()
+	}
+
 	result, err := s.client.ProposeStorageDeal(ctx, storagemarket.ProposeStorageDealParams{
 		Addr:          params.Wallet,
 		Info:          params.Miner.Info,
@@ -269,26 +557,68 @@ func (s *Storage) StartDeal(ctx context.Context, params StartDealParams) (*cid.C
 	return &result.ProposalCid, nil
 }
 
+// CheckDataCap returns ErrInsufficientDataCap if the address is not a verified client or doesn't have
+// enough datacap left to make verified deals for a piece with n miners
+func (s *Storage) CheckDataCap(ctx context.Context, addr address.Address, size abi.PaddedPieceSize, n int) error {
+	dc, err := s.fAPI.StateVerifiedClientStatus(ctx, addr, fil.EmptyTSK)
+	if err != nil {
+		return fmt.Errorf("failed to get datacap: %w", err)
+	}
+	if dc == nil {
+		return fmt.Errorf("%w: %s is not a verified client, push without verified deals instead", ErrInsufficientDataCap, addr)
+	}
+	need := big.Mul(big.NewInt(int64(size)), big.NewInt(int64(n)))
+	if dc.LessThan(need) {
+		return fmt.Errorf(
+			"%w: %s has %s left but %d verified deals need %s, push without verified deals or with fewer miners",
+			ErrInsufficientDataCap, addr, fil.SizeStr(*dc), n, fil.SizeStr(need),
+		)
+	}
+	return nil
+}
+
 // QuoteParams is the params to calculate the storage quote with.
 type QuoteParams struct {
 	PieceSize uint64
 	Duration  time.Duration
 	RF        int
 	MaxPrice  uint64
+	// Verified quotes the prices of verified deals
+	Verified bool
+	// Refresh queries all the miners instead of reusing the asks we cached
+	Refresh bool
+	// Budget is the most we want to pay for all the deals. When set, the quote is the cheapest set of
+	// RF miners fitting in the budget instead of the most reliable miners.
+	Budget fil.FIL
+	// MaxLatency excludes the miners slower to answer our pings. Zero for no limit.
+	MaxLatency time.Duration
+}
+
+// budgeted tells if the quote must fit in a budget
+func (p QuoteParams) budgeted() bool {
+	budget := fil.BigInt(p.Budget)
+	return !budget.Nil() && budget.GreaterThan(fil.NewInt(0))
 }
 
 // Quote is an estimate of who can store given content and for how much
 type Quote struct {
 	Miners []Miner
 	Prices map[address.Address]fil.FIL
+	// Total is the price of storing with all the miners of a quote fitting in a budget
+	Total fil.FIL
 }
 
 // GetMarketQuote returns the costs of storing for a given CID and duration
 func (s *Storage) GetMarketQuote(ctx context.Context, params QuoteParams) (*Quote, error) {
 	miners, err := s.LoadMiners(ctx, MinerSelectionParams{
-		PieceSize: params.PieceSize,
-		RF:        params.RF,
-		MaxPrice:  params.MaxPrice,
+		PieceSize:  params.PieceSize,
+		RF:         params.RF,
+		MaxPrice:   params.MaxPrice,
+		Verified:   params.Verified,
+		Refresh:    params.Refresh,
+		MaxLatency: params.MaxLatency,
+		// The cheapest miners may not be the most reliable ones
+		KeepAll: params.budgeted(),
 	})
 	if err != nil {
 		return nil, err
@@ -297,22 +627,34 @@ func (s *Storage) GetMarketQuote(ctx context.Context, params QuoteParams) (*Quot
 		return nil, errors.New("no miners fit those parameters")
 	}
 
-	gib := fil.NewInt(1 << 30)
-
 	epochs := calcEpochs(params.Duration)
 
 	prices := make(map[address.Address]fil.FIL)
 
 	for _, m := range miners {
-		p := m.Ask.Price
-		epochPrice := fil.BigDiv(fil.BigMul(p, fil.NewInt(params.PieceSize)), gib)
-		prices[m.Info.Address] = fil.FIL(fil.BigMul(epochPrice, fil.NewInt(uint64(epochs))))
+		prices[m.Info.Address] = dealPrice(askPrice(m.Ask, params.Verified), params.PieceSize, epochs)
 	}
 
-	return &Quote{
-		Miners: miners,
-		Prices: prices,
-	}, nil
+	if !params.budgeted() {
+		return &Quote{
+			Miners: miners,
+			Prices: prices,
+		}, nil
+	}
+
+	sel, total, err := selectWithinBudget(miners, prices, params.RF, params.Budget)
+	if err != nil {
+		return nil, err
+	}
+	q := &Quote{
+		Miners: sel,
+		Prices: make(map[address.Address]fil.FIL, len(sel)),
+		Total:  total,
+	}
+	for _, m := range sel {
+		q.Prices[m.Info.Address] = prices[m.Info.Address]
+	}
+	return q, nil
 }
 
 // Params are the global parameters for storing on Filecoin with given replication
@@ -321,6 +663,15 @@ type Params struct {
 	Duration time.Duration
 	Address  address.Address
 	Miners   []Miner
+	// Label is attached to all the deal proposals e.g. an internal project identifier
+	Label string
+	// Alternates are miners from the quote we propose to in order when deals with Miners fail
+	// to start or fail later on
+	Alternates []Miner
+	// Verified deals are paid with the datacap of the wallet address
+	Verified bool
+	// PieceSize is the size of the piece we check the datacap against for verified deals
+	PieceSize abi.PaddedPieceSize
 }
 
 // NewParams creates a new Params struct for storage
@@ -336,44 +687,71 @@ func NewParams(root cid.Cid, dur time.Duration, w address.Address, mnrs []Miner)
 	}
 }
 
-// Receipt compiles all information about our content storage contracts
+// Receipt compiles all information about our content storage contracts.
+// DealRefs[i] is the proposal of the deal started with Miners[i].
 type Receipt struct {
 	Miners   []address.Address
 	DealRefs []cid.Cid
+	// Label is the label of all the deal proposals
+	Label string
+	// Outcomes lists every miner we proposed a deal to including the ones that failed
+	Outcomes []DealOutcome
 }
 
 // Store is the main storage operation which automatically stores content for a given CID
-// with the best conditions available
+// with the best conditions available. We propose a deal to each of the miners, replacing the
+// ones failing with alternates. Store only fails if no deal could be started, the content is
+// then repaired in the background as deals fail.
 func (s *Storage) Store(ctx context.Context, p Params) (*Receipt, error) {
-	var ma []address.Address
-	for _, m := range p.Miners {
-		ma = append(ma, m.Info.Address)
-	}
-	epochs := calcEpochs(p.Duration)
-	var drfs []cid.Cid
-	for _, m := range p.Miners {
-		pcid, err := s.StartDeal(ctx, StartDealParams{
-			Data:              p.Payload,
-			Wallet:            p.Address,
-			Miner:             m,
-			EpochPrice:        m.Ask.Price,
-			MinBlocksDuration: uint64(epochs),
-			DealStartEpoch:    -1,
-			FastRetrieval:     false,
-			VerifiedDeal:      false,
-		})
-		if err != nil {
+	rf := len(p.Miners)
+	if p.Verified {
+		if err := s.CheckDataCap(ctx, p.Address, p.PieceSize, rf); err != nil {
 			return nil, err
 		}
-		if pcid != nil {
-			drfs = append(drfs, *pcid)
+	}
+	candidates := append(append([]Miner{}, p.Miners...), p.Alternates...)
+	outcomes, next := startDeals(ctx, rf, candidates, s.dealStarter(ctx, p))
+
+	rcpt := &Receipt{
+		Label:    p.Label,
+		Outcomes: outcomes,
+	}
+	var lastErr string
+	for _, o := range outcomes {
+		if o.Proposal.Defined() {
+			rcpt.Miners = append(rcpt.Miners, o.Miner)
+			rcpt.DealRefs = append(rcpt.DealRefs, o.Proposal)
+		} else {
+			lastErr = o.Err
 		}
 	}
+	if len(rcpt.DealRefs) == 0 {
+		if ctx.Err() != nil {
+			return rcpt, ctx.Err()
+		}
+		return rcpt, fmt.Errorf("%w: %s", ErrAllDealsFailed, lastErr)
+	}
 
-	return &Receipt{
-		Miners:   ma,
-		DealRefs: drfs,
-	}, nil
+	// Manual transfers would need the piece shipped again so we don't repair offline deals
+	if p.Payload.TransferType == storagemarket.TTManual {
+		return rcpt, nil
+	}
+
+	err := s.putReplication(replication{
+		Root:       p.Payload.Root,
+		Duration:   p.Duration,
+		Wallet:     p.Address,
+		Label:      p.Label,
+		RF:         rf,
+		Deals:      rcpt.DealRefs,
+		Alternates: candidates[next:],
+		Verified:   p.Verified,
+		PieceSize:  p.PieceSize,
+	})
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to record replication")
+	}
+	return rcpt, nil
 }
 
 func PreferredSealProofTypeFromWindowPoStType(proof abi.RegisteredPoStProof) (abi.RegisteredSealProof, error) {
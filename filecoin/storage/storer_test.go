@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetworkConfigDefaults(t *testing.T) {
+	require.Equal(t, DefaultNetworkConfig, NetworkConfig{}.withDefaults())
+
+	cfg := NetworkConfig{MaxBackoff: 20 * time.Minute, Attempts: 30}.withDefaults()
+	require.Equal(t, 20*time.Minute, cfg.MaxBackoff)
+	require.Equal(t, float64(30), cfg.Attempts)
+	require.Equal(t, DefaultNetworkConfig.MinBackoff, cfg.MinBackoff)
+	require.Equal(t, DefaultNetworkConfig.BackoffFactor, cfg.BackoffFactor)
+	require.Equal(t, DefaultNetworkConfig.PollingInterval, cfg.PollingInterval)
+	require.Equal(t, DefaultNetworkConfig.QueryWorkers, cfg.QueryWorkers)
+	require.Equal(t, DefaultNetworkConfig.QueryTimeout, cfg.QueryTimeout)
+}
+
+func TestProbeMiners(t *testing.T) {
+	ctx := context.Background()
+	var addrs []address.Address
+	for i := 0; i < 20; i++ {
+		a, err := address.NewIDAddress(uint64(1000 + i))
+		require.NoError(t, err)
+		addrs = append(addrs, a)
+	}
+
+	var running, max, calls int32
+	err := probeMiners(ctx, addrs, 4, func(ctx context.Context, a address.Address) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, int32(20), calls)
+	require.Equal(t, int32(4), max)
+
+	// The first error stops the probing
+	calls = 0
+	fail := errors.New("no peer id")
+	err = probeMiners(ctx, addrs, 2, func(ctx context.Context, a address.Address) error {
+		atomic.AddInt32(&calls, 1)
+		if a == addrs[0] {
+			return fail
+		}
+		<-ctx.Done()
+		return nil
+	})
+	require.Equal(t, fail, err)
+	require.Less(t, atomic.LoadInt32(&calls), int32(20))
+}
+
+func TestCheckDataCap(t *testing.T) {
+	ctx := context.Background()
+	api := fil.NewMockLotusAPI()
+	s := &Storage{fAPI: api}
+	addr, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	// Regular clients have no datacap
+	err = s.CheckDataCap(ctx, addr, abi.PaddedPieceSize(1<<20), 2)
+	require.True(t, errors.Is(err, ErrInsufficientDataCap))
+
+	dc := abi.NewStoragePower(3 << 20)
+	api.SetDataCap(&dc)
+	require.NoError(t, s.CheckDataCap(ctx, addr, abi.PaddedPieceSize(1<<20), 3))
+
+	err = s.CheckDataCap(ctx, addr, abi.PaddedPieceSize(1<<20), 4)
+	require.True(t, errors.Is(err, ErrInsufficientDataCap))
+}
+
+func TestAskPrice(t *testing.T) {
+	ask := &storagemarket.StorageAsk{
+		Price:         abi.NewTokenAmount(100),
+		VerifiedPrice: abi.NewTokenAmount(0),
+	}
+	require.Equal(t, ask.Price, askPrice(ask, false))
+	require.Equal(t, ask.VerifiedPrice, askPrice(ask, true))
+}
+
+func TestInfoCache(t *testing.T) {
+	c := newInfoCache()
+	a, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	_, ok := c.get(a, time.Hour)
+	require.False(t, ok)
+
+	c.put(a, cachedInfo{info: storagemarket.StorageProviderInfo{Address: a}})
+	ci, ok := c.get(a, time.Hour)
+	require.True(t, ok)
+	require.Equal(t, a, ci.info.Address)
+
+	// Stale info is fetched again
+	_, ok = c.get(a, 0)
+	require.False(t, ok)
+}
@@ -0,0 +1,232 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// DefaultScoreHalfLife is how long it takes for the weight of past successes and failures to halve
+const DefaultScoreHalfLife = 7 * 24 * time.Hour
+
+// DefaultAskTTL is how long we reuse a miner ask before querying it again
+const DefaultAskTTL = time.Hour
+
+// DefaultMinScore is the score under which we stop dealing with a miner
+const DefaultMinScore = 0.25
+
+// minObservations is the weight of events we need before skipping a miner so a single failure
+// doesn't exclude anyone
+const minObservations = 3
+
+// latencyWeight is the weight of a new latency sample in the moving average
+const latencyWeight = 0.3
+
+// MinerRecord is what we remember about a storage miner
+type MinerRecord struct {
+	Miner address.Address
+	// Latency is a moving average of the ping round trips
+	Latency time.Duration
+	// Ask is the last ask we received and AskTime when we got it
+	Ask     *storagemarket.StorageAsk
+	AskTime time.Time
+	// Successes and Failures are decayed counts of deals and requests
+	Successes float64
+	Failures  float64
+	// LastError describes the last failure
+	LastError string
+	Updated   time.Time
+}
+
+// Score is the likelihood of the miner succeeding from 0 to 1. Miners we know nothing about score 0.5.
+func (r MinerRecord) Score() float64 {
+	return (r.Successes + 1) / (r.Successes + r.Failures + 2)
+}
+
+// MinerTracker records the history of the miners we deal with so miner selection can skip the
+// ones failing often and reuse recent asks without network round trips. Records are persisted
+// in the datastore.
+type MinerTracker struct {
+	// HalfLife is how fast past events lose weight
+	HalfLife time.Duration
+	// AskTTL is how long asks are reused
+	AskTTL time.Duration
+	// MinScore is the score under which miners are skipped
+	MinScore float64
+
+	ds  datastore.Batching
+	now func() time.Time
+
+	mu   sync.Mutex
+	recs map[address.Address]*MinerRecord
+}
+
+// NewMinerTracker creates a tracker persisting its records in the datastore
+func NewMinerTracker(ds datastore.Batching) *MinerTracker {
+	return &MinerTracker{
+		HalfLife: DefaultScoreHalfLife,
+		AskTTL:   DefaultAskTTL,
+		MinScore: DefaultMinScore,
+		ds:       namespace.Wrap(ds, datastore.NewKey("/miners/")),
+		now:      time.Now,
+		recs:     make(map[address.Address]*MinerRecord),
+	}
+}
+
+// decay reduces the weight of past events since the last update
+func (mt *MinerTracker) decay(r *MinerRecord, now time.Time) {
+	if !r.Updated.IsZero() && mt.HalfLife > 0 {
+		elapsed := now.Sub(r.Updated)
+		if elapsed > 0 {
+			f := math.Pow(0.5, float64(elapsed)/float64(mt.HalfLife))
+			r.Successes *= f
+			r.Failures *= f
+		}
+	}
+	r.Updated = now
+}
+
+// load returns the record of a miner from memory or the datastore. Must be called with the lock.
+func (mt *MinerTracker) load(m address.Address) *MinerRecord {
+	if r, ok := mt.recs[m]; ok {
+		return r
+	}
+	r := &MinerRecord{Miner: m}
+	if b, err := mt.ds.Get(datastore.NewKey(m.String())); err == nil {
+		if err := json.Unmarshal(b, r); err != nil {
+			r = &MinerRecord{Miner: m}
+		}
+	}
+	mt.recs[m] = r
+	return r
+}
+
+func (mt *MinerTracker) update(m address.Address, fn func(r *MinerRecord)) error {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	r := mt.load(m)
+	mt.decay(r, mt.now())
+	fn(r)
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return mt.ds.Put(datastore.NewKey(m.String()), b)
+}
+
+// RecordLatency adds a ping round trip to the latency average of a miner
+func (mt *MinerTracker) RecordLatency(m address.Address, rtt time.Duration) error {
+	return mt.update(m, func(r *MinerRecord) {
+		if r.Latency == 0 {
+			r.Latency = rtt
+			return
+		}
+		r.Latency = time.Duration(math.Round(latencyWeight*float64(rtt) + (1-latencyWeight)*float64(r.Latency)))
+	})
+}
+
+// RecordAsk caches the last ask of a miner
+func (mt *MinerTracker) RecordAsk(m address.Address, ask *storagemarket.StorageAsk) error {
+	return mt.update(m, func(r *MinerRecord) {
+		r.Ask = ask
+		r.AskTime = mt.now()
+	})
+}
+
+// RecordSuccess counts a successful deal with a miner
+func (mt *MinerTracker) RecordSuccess(m address.Address) error {
+	return mt.update(m, func(r *MinerRecord) {
+		r.Successes++
+	})
+}
+
+// RecordFailure counts a failed deal or request with a miner
+func (mt *MinerTracker) RecordFailure(m address.Address, reason error) error {
+	return mt.update(m, func(r *MinerRecord) {
+		r.Failures++
+		if reason != nil {
+			r.LastError = reason.Error()
+		}
+	})
+}
+
+// Record returns what we know about a miner with decay applied
+func (mt *MinerTracker) Record(m address.Address) MinerRecord {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	r := *mt.load(m)
+	mt.decay(&r, mt.now())
+	return r
+}
+
+// Skip tells if a miner failed often enough recently that we shouldn't bother reaching it
+func (mt *MinerTracker) Skip(m address.Address) bool {
+	r := mt.Record(m)
+	return r.Successes+r.Failures >= minObservations && r.Score() < mt.MinScore
+}
+
+// CachedAsk returns the last ask of a miner if it is recent enough and hasn't expired at the given chain
+// height. A zero height skips the expiry check. Miners we never pinged have no cached ask.
+func (mt *MinerTracker) CachedAsk(m address.Address, height abi.ChainEpoch) (*storagemarket.StorageAsk, bool) {
+	r := mt.Record(m)
+	if r.Ask == nil || r.Latency == 0 || mt.now().Sub(r.AskTime) > mt.AskTTL {
+		return nil, false
+	}
+	if height > 0 && r.Ask.Expiry <= height {
+		return nil, false
+	}
+	return r.Ask, true
+}
+
+// List returns the records of all the miners we know sorted by score
+func (mt *MinerTracker) List() ([]MinerRecord, error) {
+	res, err := mt.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var recs []MinerRecord
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		var r MinerRecord
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			continue
+		}
+		recs = append(recs, mt.Record(r.Miner))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Score() > recs[j].Score()
+	})
+	return recs, nil
+}
+
+// recordDealEvent counts deals that became active or failed
+func (mt *MinerTracker) recordDealEvent(event storagemarket.ClientEvent, deal storagemarket.ClientDeal) {
+	switch {
+	case event == storagemarket.ClientEventDealActivated:
+		mt.RecordSuccess(deal.Proposal.Provider)
+	case deal.State == storagemarket.StorageDealError && event == storagemarket.ClientEventFailed:
+		mt.RecordFailure(deal.Proposal.Provider, errors.New(deal.Message))
+	}
+}
+
+// compareMiners orders miners by score then latency
+func compareMiners(a, b MinerRecord) bool {
+	if sa, sb := a.Score(), b.Score(); sa != sb {
+		return sa > sb
+	}
+	return a.Latency < b.Latency
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMinerTracker(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	now := time.Now()
+	mt := NewMinerTracker(ds)
+	mt.now = func() time.Time { return now }
+
+	good, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	bad, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+
+	// Unknown miners are neutral
+	require.Equal(t, 0.5, mt.Record(good).Score())
+	require.False(t, mt.Skip(good))
+
+	require.NoError(t, mt.RecordSuccess(good))
+	require.NoError(t, mt.RecordFailure(bad, errors.New("connection refused")))
+	// A single failure doesn't exclude a miner
+	require.False(t, mt.Skip(bad))
+	require.NoError(t, mt.RecordFailure(bad, errors.New("connection refused")))
+	require.NoError(t, mt.RecordFailure(bad, errors.New("deal rejected")))
+	require.True(t, mt.Skip(bad))
+	require.Equal(t, "deal rejected", mt.Record(bad).LastError)
+
+	// Failures are forgotten over time
+	now = now.Add(2 * DefaultScoreHalfLife)
+	require.False(t, mt.Skip(bad))
+	require.InDelta(t, 0.75, mt.Record(bad).Failures, 0.001)
+
+	// Asks are reused once we know the latency
+	ask := &storagemarket.StorageAsk{Price: abi.NewTokenAmount(10), Miner: good}
+	require.NoError(t, mt.RecordAsk(good, ask))
+	_, ok := mt.CachedAsk(good, 0)
+	require.False(t, ok)
+	require.NoError(t, mt.RecordLatency(good, 100*time.Millisecond))
+	require.NoError(t, mt.RecordLatency(good, 200*time.Millisecond))
+	require.Equal(t, 130*time.Millisecond, mt.Record(good).Latency)
+	cached, ok := mt.CachedAsk(good, 0)
+	require.True(t, ok)
+	require.Equal(t, ask.Price, cached.Price)
+
+	// Expired asks are not reused
+	ask.Expiry = 1000
+	require.NoError(t, mt.RecordAsk(good, ask))
+	_, ok = mt.CachedAsk(good, 999)
+	require.True(t, ok)
+	_, ok = mt.CachedAsk(good, 1000)
+	require.False(t, ok)
+
+	now = now.Add(DefaultAskTTL + time.Second)
+	_, ok = mt.CachedAsk(good, 0)
+	require.False(t, ok)
+
+	// Records persist in the datastore
+	mt2 := NewMinerTracker(ds)
+	mt2.now = func() time.Time { return now }
+	recs, err := mt2.List()
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	require.Equal(t, good, recs[0].Miner)
+	require.Equal(t, 130*time.Millisecond, recs[0].Latency)
+
+	require.True(t, compareMiners(recs[0], recs[1]))
+}
+
+func TestTrackDealEvents(t *testing.T) {
+	mt := NewMinerTracker(dss.MutexWrap(datastore.NewMapDatastore()))
+	m, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+
+	deal := storagemarket.ClientDeal{}
+	deal.Proposal.Provider = m
+
+	mt.recordDealEvent(storagemarket.ClientEventDealActivated, deal)
+	require.InDelta(t, 1, mt.Record(m).Successes, 0.001)
+
+	deal.State = storagemarket.StorageDealError
+	deal.Message = "miner unreachable"
+	mt.recordDealEvent(storagemarket.ClientEventFailed, deal)
+	require.InDelta(t, 1, mt.Record(m).Failures, 0.001)
+	require.Equal(t, "miner unreachable", mt.Record(m).LastError)
+
+	// Other events are ignored
+	mt.recordDealEvent(storagemarket.ClientEventOpen, deal)
+	require.InDelta(t, 2, mt.Record(m).Successes+mt.Record(m).Failures, 0.001)
+}
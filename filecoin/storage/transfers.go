@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-fil-markets/storagemarket/impl/requestvalidation"
+	"github.com/ipfs/go-cid"
+)
+
+// TransferProgress reports the data sent to a miner for one of our deals
+type TransferProgress struct {
+	Miner address.Address
+	Deal  cid.Cid
+	// Sent is the number of bytes the miner received so far
+	Sent uint64
+	// Total is the size of the payload if the transfer knows it
+	Total uint64
+	// Done is set once the transfer completed or failed
+	Done bool
+	Err  string
+}
+
+// WatchTransfers calls fn whenever data is sent to a miner for a deal of the receipt and when
+// each transfer settles. The returned function stops watching.
+func (s *Storage) WatchTransfers(rcpt *Receipt, fn func(TransferProgress)) datatransfer.Unsubscribe {
+	miners := make(map[cid.Cid]address.Address, len(rcpt.DealRefs))
+	for i, d := range rcpt.DealRefs {
+		if i < len(rcpt.Miners) {
+			miners[d] = rcpt.Miners[i]
+		}
+	}
+	var mu sync.Mutex
+	settled := make(map[cid.Cid]bool)
+	return s.dt.SubscribeToEvents(func(event datatransfer.Event, state datatransfer.ChannelState) {
+		v, ok := state.Voucher().(*requestvalidation.StorageDataTransferVoucher)
+		if !ok {
+			return
+		}
+		m, ok := miners[v.Proposal]
+		if !ok {
+			return
+		}
+		tp := TransferProgress{
+			Miner: m,
+			Deal:  v.Proposal,
+			Sent:  state.Sent(),
+			Total: state.TotalSize(),
+		}
+		switch state.Status() {
+		case datatransfer.Completed:
+			tp.Done = true
+		case datatransfer.Failed, datatransfer.Cancelled:
+			tp.Done = true
+			tp.Err = state.Message()
+			if tp.Err == "" {
+				tp.Err = event.Message
+			}
+		default:
+			if event.Code != datatransfer.DataSent {
+				return
+			}
+		}
+		mu.Lock()
+		// Cleanup events keep coming after a transfer settled
+		if settled[v.Proposal] {
+			mu.Unlock()
+			return
+		}
+		settled[v.Proposal] = tp.Done
+		mu.Unlock()
+		fn(tp)
+	})
+}
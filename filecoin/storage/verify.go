@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// ErrPieceMismatch is returned when the piece CID of a deal published on chain differs from the one we proposed
+var ErrPieceMismatch = errors.New("piece CID mismatch")
+
+// ErrDealNotPublished is returned when checking the piece of a deal not published on chain yet
+var ErrDealNotPublished = errors.New("deal not published")
+
+// PieceCheck is the comparison of the piece CID we proposed with the deal the miner published on chain.
+// The piece is only proven to be stored once the miner proves a sector holding it.
+type PieceCheck struct {
+	// Proposed is the piece commitment we computed from our copy of the content when proposing the deal
+	Proposed cid.Cid
+	// Chain is the piece CID of the deal published on chain
+	Chain cid.Cid
+	// Sealed is set once the deal is included in a sector the miner proved
+	Sealed bool
+	// Err describes the mismatch if any
+	Err  string
+	Time time.Time
+}
+
+// OK tells if the piece CIDs match
+func (c PieceCheck) OK() bool {
+	return c.Err == ""
+}
+
+// checkPiece compares the piece CID we proposed with the one on chain
+func checkPiece(proposed, chain cid.Cid) error {
+	if proposed != chain {
+		return fmt.Errorf("%w: proposed %s, published %s", ErrPieceMismatch, proposed, chain)
+	}
+	return nil
+}
+
+// checkDeal reads the state of a published deal on chain and checks its piece
+func checkDeal(ctx context.Context, api fil.API, deal storagemarket.ClientDeal) (*PieceCheck, error) {
+	if deal.PublishMessage == nil {
+		return nil, fmt.Errorf("%w: %s", ErrDealNotPublished, deal.ProposalCid)
+	}
+	md, err := api.StateMarketStorageDeal(ctx, deal.DealID, fil.EmptyTSK)
+	if err != nil {
+		return nil, err
+	}
+	check := &PieceCheck{
+		Proposed: deal.Proposal.PieceCID,
+		Chain:    md.Proposal.PieceCID,
+		Sealed:   md.State.SectorStartEpoch >= 0,
+	}
+	if err := checkPiece(check.Proposed, check.Chain); err != nil {
+		check.Err = err.Error()
+	}
+	return check, nil
+}
+
+// VerifyPiece checks the piece CID of a deal published on chain is the commitment we computed when
+// proposing it and whether the miner proved a sector holding it. The check is recorded with the deal.
+func (s *Storage) VerifyPiece(ctx context.Context, proposal cid.Cid) (*PieceCheck, error) {
+	deal, err := s.client.GetLocalDeal(ctx, proposal)
+	if err != nil {
+		return nil, err
+	}
+	check, err := checkDeal(ctx, s.fAPI, deal)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.deals.recordPieceCheck(proposal, check); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// verifyPublishedPieces verifies the piece of deals once they are published and again once they are
+// activated in a proven sector
+func (s *Storage) verifyPublishedPieces(ctx context.Context) storagemarket.ClientSubscriber {
+	return func(event storagemarket.ClientEvent, deal storagemarket.ClientDeal) {
+		if event != storagemarket.ClientEventDealPublished && event != storagemarket.ClientEventDealActivated {
+			return
+		}
+		go func() {
+			check, err := s.VerifyPiece(ctx, deal.ProposalCid)
+			if err != nil {
+				s.log.Error().Err(err).Str("proposal", deal.ProposalCid.String()).Msg("failed to verify piece")
+				return
+			}
+			if !check.OK() {
+				s.log.Error().
+					Str("proposal", deal.ProposalCid.String()).
+					Str("miner", deal.Proposal.Provider.String()).
+					Msg(check.Err)
+			}
+		}()
+	}
+}
+
+// recordPieceCheck adds the result of a piece verification to the record of a deal
+func (dt *DealTracker) recordPieceCheck(proposal cid.Cid, check *PieceCheck) error {
+	dt.mu.Lock()
+	defer dt.mu.Unlock()
+
+	r, err := dt.get(proposal)
+	if err != nil {
+		return err
+	}
+	check.Time = dt.now()
+	r.PieceCheck = check
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return dt.ds.Put(datastore.NewKey(proposal.String()), b)
+}
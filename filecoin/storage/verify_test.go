@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDeal(t *testing.T) {
+	ctx := context.Background()
+	api := fil.NewFakeAPI()
+	bg := blocksutil.NewBlockGenerator()
+
+	client, err := address.NewActorAddress([]byte("client"))
+	require.NoError(t, err)
+	maddr, err := address.NewIDAddress(1234)
+	require.NoError(t, err)
+	worker, err := address.NewActorAddress([]byte("worker"))
+	require.NoError(t, err)
+	api.AddMiner(maddr, fil.MinerInfo{Worker: worker, SectorSize: abi.SectorSize(2048)})
+	api.SetMarketBalance(client, fil.MarketBalance{Escrow: abi.NewTokenAmount(1000), Locked: big.Zero()})
+
+	deal := storagemarket.ClientDeal{ProposalCid: bg.Next().Cid()}
+	deal.Proposal = market.DealProposal{
+		PieceCID:             bg.Next().Cid(),
+		PieceSize:            abi.PaddedPieceSize(2048),
+		Client:               client,
+		Provider:             maddr,
+		StartEpoch:           10,
+		EndEpoch:             20,
+		StoragePricePerEpoch: abi.NewTokenAmount(1),
+		ProviderCollateral:   big.Zero(),
+		ClientCollateral:     big.Zero(),
+	}
+	_, err = checkDeal(ctx, api, deal)
+	require.True(t, errors.Is(err, ErrDealNotPublished))
+
+	c, err := api.PublishDeals(worker, deal.ClientDealProposal)
+	require.NoError(t, err)
+	_, err = api.StateWaitMsg(ctx, c, 0)
+	require.NoError(t, err)
+	deal.PublishMessage = &c
+
+	check, err := checkDeal(ctx, api, deal)
+	require.NoError(t, err)
+	require.True(t, check.OK())
+	require.Equal(t, deal.Proposal.PieceCID, check.Chain)
+	require.False(t, check.Sealed)
+
+	require.NoError(t, api.ActivateDeal(deal.DealID))
+	check, err = checkDeal(ctx, api, deal)
+	require.NoError(t, err)
+	require.True(t, check.Sealed)
+
+	// The deal on chain doesn't hold the piece we computed
+	other := deal
+	other.Proposal.PieceCID = bg.Next().Cid()
+	check, err = checkDeal(ctx, api, other)
+	require.NoError(t, err)
+	require.False(t, check.OK())
+	require.True(t, errors.Is(checkPiece(other.Proposal.PieceCID, check.Chain), ErrPieceMismatch))
+}
+
+func TestRecordPieceCheck(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	dt := NewDealTracker(ds)
+	bg := blocksutil.NewBlockGenerator()
+
+	deal := storagemarket.ClientDeal{
+		ProposalCid: bg.Next().Cid(),
+		DataRef:     &storagemarket.DataRef{Root: bg.Next().Cid()},
+		State:       storagemarket.StorageDealCheckForAcceptance,
+	}
+	deal.Proposal.PieceCID = bg.Next().Cid()
+	dt.recordDealEvent(storagemarket.ClientEventDataTransferComplete, deal)
+
+	chain := bg.Next().Cid()
+	check := &PieceCheck{Proposed: deal.Proposal.PieceCID, Chain: chain}
+	check.Err = checkPiece(check.Proposed, check.Chain).Error()
+	require.NoError(t, dt.recordPieceCheck(deal.ProposalCid, check))
+
+	rec, err := dt.GetDeal(deal.ProposalCid)
+	require.NoError(t, err)
+	require.NotNil(t, rec.PieceCheck)
+	require.False(t, rec.PieceCheck.OK())
+	require.Equal(t, chain, rec.PieceCheck.Chain)
+
+	// Later events keep the check
+	deal.State = storagemarket.StorageDealSealing
+	dt.recordDealEvent(storagemarket.ClientEventDealPublished, deal)
+	rec, err = dt.GetDeal(deal.ProposalCid)
+	require.NoError(t, err)
+	require.NotNil(t, rec.PieceCheck)
+
+	require.Equal(t, ErrDealNotFound, dt.recordPieceCheck(bg.Next().Cid(), check))
+}
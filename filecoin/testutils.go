@@ -21,6 +21,7 @@ type MockLotusAPI struct {
 	accountKey  address.Address      // address returned when calling StateAccountKey
 	lookupID    address.Address      // address returned when calling StateLookupID
 	invocResult *InvocResult         // invocResult returned when calling StateCall
+	dataCap     *abi.StoragePower    // dataCap returned when calling StateVerifiedClientStatus
 }
 
 func NewMockLotusAPI() *MockLotusAPI {
@@ -77,6 +78,10 @@ func (m *MockLotusAPI) StateMarketBalance(ctx context.Context, addr address.Addr
 	return MarketBalance{}, nil
 }
 
+func (m *MockLotusAPI) StateMarketStorageDeal(ctx context.Context, id abi.DealID, tsk TipSetKey) (*MarketDeal, error) {
+	return nil, nil
+}
+
 func (m *MockLotusAPI) StateDealProviderCollateralBounds(ctx context.Context, s abi.PaddedPieceSize, b bool, tsk TipSetKey) (DealCollateralBounds, error) {
 	return DealCollateralBounds{}, nil
 }
@@ -89,6 +94,10 @@ func (m *MockLotusAPI) StateCall(ctx context.Context, msg *Message, tsk TipSetKe
 	return m.invocResult, nil
 }
 
+func (m *MockLotusAPI) StateVerifiedClientStatus(ctx context.Context, addr address.Address, tsk TipSetKey) (*abi.StoragePower, error) {
+	return m.dataCap, nil
+}
+
 func (m *MockLotusAPI) ChainGetMessage(ctx context.Context, c cid.Cid) (*Message, error) {
 	return nil, nil
 }
@@ -136,3 +145,8 @@ func (m *MockLotusAPI) SetMsgLookup(lkp *MsgLookup) {
 func (m *MockLotusAPI) SetInvocResult(i *InvocResult) {
 	m.invocResult = i
 }
+
+// SetDataCap sets the datacap of verified clients, nil if the client isn't verified
+func (m *MockLotusAPI) SetDataCap(dc *abi.StoragePower) {
+	m.dataCap = dc
+}
@@ -14,6 +14,7 @@ import (
 	big2 "github.com/filecoin-project/go-state-types/big"
 	"github.com/filecoin-project/go-state-types/crypto"
 	"github.com/filecoin-project/go-state-types/exitcode"
+	"github.com/filecoin-project/specs-actors/v3/actors/builtin/market"
 	"github.com/filecoin-project/specs-actors/v3/actors/runtime/proof"
 	block "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
@@ -66,6 +67,17 @@ func (ts *TipSet) Height() abi.ChainEpoch {
 	return ts.height
 }
 
+// MinTimestamp returns the earliest timestamp of the blocks in the tipset
+func (ts *TipSet) MinTimestamp() uint64 {
+	minTs := ts.blks[0].Timestamp
+	for _, bh := range ts.blks[1:] {
+		if bh.Timestamp < minTs {
+			minTs = bh.Timestamp
+		}
+	}
+	return minTs
+}
+
 func (ts *TipSet) Key() TipSetKey {
 	if ts == nil {
 		return EmptyTSK
@@ -623,6 +635,12 @@ type MarketBalance struct {
 	Locked big2.Int
 }
 
+// MarketDeal is a deal published in the storage market and its state
+type MarketDeal struct {
+	Proposal market.DealProposal
+	State    market.DealState
+}
+
 // DealCollateralBounds is the Min and Max collateral a storage provider can issue
 type DealCollateralBounds struct {
 	Min abi.TokenAmount
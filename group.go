@@ -0,0 +1,154 @@
+package pop
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// DefaultGroupReserve is how many retrievals at the price of the first one we reserve funds for in the
+// payment channel of each provider serving a group
+const DefaultGroupReserve = 10
+
+// groupProvider is how the retrievals of a group from a provider went
+type groupProvider struct {
+	successes int
+	failures  int
+}
+
+// Group shares provider discovery, payment channels and peer scoring across related retrievals e.g.
+// all the assets of a web page. Offers of the providers which served the group are preferred and funds
+// are reserved in their payment channel once so the next retrievals skip adding funds on chain.
+type Group struct {
+	// Reserve is how many retrievals at the price of the first one we reserve funds for with each
+	// provider. Zero uses DefaultGroupReserve.
+	Reserve int
+
+	ex *Exchange
+	// fmu makes concurrent retrievals wait for the funds another one is reserving
+	fmu sync.Mutex
+
+	mu        sync.Mutex
+	providers map[peer.ID]*groupProvider
+	// reserved are the client and payment addresses we reserved funds for
+	reserved map[[2]address.Address]bool
+}
+
+// NewGroup creates a group of retrievals sharing providers and payment channels
+func (e *Exchange) NewGroup() *Group {
+	return &Group{
+		Reserve:   DefaultGroupReserve,
+		ex:        e,
+		providers: make(map[peer.ID]*groupProvider),
+		reserved:  make(map[[2]address.Address]bool),
+	}
+}
+
+// NewSession creates a session retrieving a content as part of the group
+func (g *Group) NewSession(ctx context.Context, root cid.Cid) (*Session, error) {
+	s, err := g.ex.NewSession(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	s.group = g
+	return s, nil
+}
+
+// Providers returns the providers which served the group more often than they failed, best first
+func (g *Group) Providers() []peer.ID {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var ps []peer.ID
+	for p, gp := range g.providers {
+		if gp.successes > gp.failures {
+			ps = append(ps, p)
+		}
+	}
+	sort.Slice(ps, func(i, j int) bool {
+		a, b := g.providers[ps[i]], g.providers[ps[j]]
+		if a.successes-a.failures != b.successes-b.failures {
+			return a.successes-a.failures > b.successes-b.failures
+		}
+		return ps[i] < ps[j]
+	})
+	return ps
+}
+
+// record counts a retrieval of the group from a provider
+func (g *Group) record(p peer.ID, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	gp, found := g.providers[p]
+	if !found {
+		gp = &groupProvider{}
+		g.providers[p] = gp
+	}
+	if ok {
+		gp.successes++
+	} else {
+		gp.failures++
+	}
+}
+
+// prefer moves the offers of the providers which served the group first keeping the order of the others
+func (g *Group) prefer(offers []deal.Offer) []deal.Offer {
+	rank := make(map[peer.ID]int)
+	for i, p := range g.Providers() {
+		rank[p] = i + 1
+	}
+	if len(rank) == 0 {
+		return offers
+	}
+	sort.SliceStable(offers, func(i, j int) bool {
+		ri, rj := rank[offers[i].PeerID], rank[offers[j].PeerID]
+		if ri == 0 || rj == 0 {
+			return ri != 0
+		}
+		return ri < rj
+	})
+	return offers
+}
+
+// fund reserves funds in the payment channel with the provider of an offer unless enough remain
+func (g *Group) fund(ctx context.Context, from address.Address, of *deal.Offer) error {
+	price := of.Response.PieceRetrievalPrice()
+	if price.IsZero() {
+		return nil
+	}
+	to := of.Response.PaymentAddress
+	g.fmu.Lock()
+	defer g.fmu.Unlock()
+	cl := g.ex.retrieval.Client()
+	if !cl.ReservedFunds(from, to).LessThan(price) {
+		return nil
+	}
+	n := g.Reserve
+	if n <= 0 {
+		n = DefaultGroupReserve
+	}
+	if err := cl.ReserveFunds(ctx, from, to, big.Mul(price, abi.NewTokenAmount(int64(n)))); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	g.reserved[[2]address.Address{from, to}] = true
+	g.mu.Unlock()
+	return nil
+}
+
+// Close releases the funds the group reserved. They stay in the payment channels for later retrievals.
+func (g *Group) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	cl := g.ex.retrieval.Client()
+	for addrs := range g.reserved {
+		cl.ReleaseFunds(addrs[0], addrs[1])
+	}
+	g.reserved = make(map[[2]address.Address]bool)
+}
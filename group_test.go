@@ -0,0 +1,36 @@
+package pop
+
+import (
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroupPrefer(t *testing.T) {
+	g := (&Exchange{}).NewGroup()
+	good := test.RandPeerIDFatal(t)
+	better := test.RandPeerIDFatal(t)
+	flaky := test.RandPeerIDFatal(t)
+	unknown := test.RandPeerIDFatal(t)
+
+	offers := []deal.Offer{{PeerID: unknown}, {PeerID: flaky}, {PeerID: good}, {PeerID: better}}
+	// Without history the ranking is kept
+	require.Equal(t, offers, g.prefer(append([]deal.Offer{}, offers...)))
+
+	g.record(good, true)
+	g.record(better, true)
+	g.record(better, true)
+	g.record(flaky, true)
+	g.record(flaky, false)
+	require.Equal(t, []peer.ID{better, good}, g.Providers())
+
+	ranked := g.prefer(offers)
+	require.Equal(t, better, ranked[0].PeerID)
+	require.Equal(t, good, ranked[1].PeerID)
+	// Providers which failed as often as they served keep their rank among the others
+	require.Equal(t, unknown, ranked[2].PeerID)
+	require.Equal(t, flaky, ranked[3].PeerID)
+}
@@ -0,0 +1,89 @@
+package indexer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+//go:generate cbor-gen-for Advertisement EntryChunk
+
+// ErrInvalidSignature is returned when an advertisement isn't signed by the provider it describes
+var ErrInvalidSignature = errors.New("invalid advertisement signature")
+
+// Metadata tells retrieval clients finding our advertisements in an indexer which protocol serves the
+// content: pop retrievals after a gossip or direct query
+var Metadata = []byte("/myel/pop/retrieval/1.0")
+
+// Advertisement is a link in the chain of changes to the content a provider serves. Indexers walk the
+// chain from its head to learn which multihashes the provider holds. Each advertisement adds or
+// removes the multihashes of a context, for us the root of a content.
+type Advertisement struct {
+	// PreviousID links to the previous advertisement of the provider, nil for the first one
+	PreviousID *cid.Cid
+	Provider   string
+	Addresses  []string
+	// Entries links to the first chunk of multihashes, nil when removing a whole context
+	Entries   *cid.Cid
+	ContextID []byte
+	Metadata  []byte
+	IsRm      bool
+	Signature []byte
+}
+
+// EntryChunk is a page of multihashes in a linked list
+type EntryChunk struct {
+	Entries [][]byte
+	Next    *cid.Cid
+}
+
+// signingBytes returns the bytes the provider signs
+func (ad Advertisement) signingBytes() ([]byte, error) {
+	ad.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := ad.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign signs the advertisement with the key of the provider
+func (ad *Advertisement) Sign(key crypto.PrivKey) error {
+	b, err := ad.signingBytes()
+	if err != nil {
+		return err
+	}
+	ad.Signature, err = key.Sign(b)
+	return err
+}
+
+// Verify checks the advertisement was signed by its provider. The public key must be inlined in the
+// provider ID or given.
+func (ad Advertisement) Verify(pub crypto.PubKey) error {
+	p, err := peer.Decode(ad.Provider)
+	if err != nil || len(ad.Signature) == 0 {
+		return ErrInvalidSignature
+	}
+	if pub == nil {
+		pub, err = p.ExtractPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+		}
+	}
+	if !p.MatchesPublicKey(pub) {
+		return ErrInvalidSignature
+	}
+	b, err := ad.signingBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(b, ad.Signature)
+	if err != nil || !ok {
+		return ErrInvalidSignature
+	}
+	return nil
+}
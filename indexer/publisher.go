@@ -0,0 +1,226 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	cbor "github.com/ipfs/go-ipld-cbor"
+	"github.com/libp2p/go-libp2p-core/host"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multihash"
+	"github.com/rs/zerolog"
+)
+
+// MaxChunkEntries is how many multihashes we put in a single entry chunk
+const MaxChunkEntries = 4096
+
+// headKey is where we persist the latest advertisement of our chain
+var headKey = datastore.NewKey("/indexer-head")
+
+// Publisher maintains the chain of signed advertisements describing the content we cache and announces
+// its head to network indexers. The advertisements and entry chunks are stored in the blockstore so
+// the indexers can sync the chain from us.
+type Publisher struct {
+	h        host.Host
+	store    cbor.IpldStore
+	ds       datastore.Batching
+	indexers []string
+	// Client sends the announcements, defaults to http.DefaultClient
+	Client *http.Client
+	log    zerolog.Logger
+
+	mu   sync.Mutex
+	head cid.Cid
+}
+
+// NewPublisher creates a publisher announcing our advertisements to the given indexer endpoints and
+// restores the head of the chain from the datastore
+func NewPublisher(h host.Host, bs blockstore.Blockstore, ds datastore.Batching, indexers []string, log zerolog.Logger) *Publisher {
+	p := &Publisher{
+		h:        h,
+		store:    cbor.NewCborStore(bs),
+		ds:       ds,
+		indexers: indexers,
+		log:      log,
+	}
+	if b, err := ds.Get(headKey); err == nil {
+		if c, err := cid.Cast(b); err == nil {
+			p.head = c
+		}
+	}
+	return p
+}
+
+// Head returns the latest advertisement of our chain, cid.Undef if we never published
+func (p *Publisher) Head() cid.Cid {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.head
+}
+
+// Advertisement loads an advertisement of our chain
+func (p *Publisher) Advertisement(ctx context.Context, c cid.Cid) (Advertisement, error) {
+	var ad Advertisement
+	err := p.store.Get(ctx, c, &ad)
+	return ad, err
+}
+
+// Entries loads all the multihashes linked from an advertisement
+func (p *Publisher) Entries(ctx context.Context, ad Advertisement) ([]multihash.Multihash, error) {
+	var mhs []multihash.Multihash
+	next := ad.Entries
+	for next != nil {
+		var chunk EntryChunk
+		if err := p.store.Get(ctx, *next, &chunk); err != nil {
+			return nil, err
+		}
+		for _, e := range chunk.Entries {
+			mhs = append(mhs, multihash.Multihash(e))
+		}
+		next = chunk.Next
+	}
+	return mhs, nil
+}
+
+// Publish advertises the multihashes of the blocks of a content we cache
+func (p *Publisher) Publish(ctx context.Context, root cid.Cid, mhs []multihash.Multihash) (cid.Cid, error) {
+	// Link the chunks from the last one so each chunk points to the next
+	var next *cid.Cid
+	for end := len(mhs); end > 0; end -= MaxChunkEntries {
+		start := end - MaxChunkEntries
+		if start < 0 {
+			start = 0
+		}
+		chunk := &EntryChunk{Next: next}
+		for _, mh := range mhs[start:end] {
+			chunk.Entries = append(chunk.Entries, []byte(mh))
+		}
+		c, err := p.store.Put(ctx, chunk)
+		if err != nil {
+			return cid.Undef, err
+		}
+		next = &c
+	}
+	return p.publish(ctx, Advertisement{
+		Entries:   next,
+		ContextID: root.Bytes(),
+		Metadata:  Metadata,
+	})
+}
+
+// Remove advertises we no longer serve any of the multihashes of a content
+func (p *Publisher) Remove(ctx context.Context, root cid.Cid) (cid.Cid, error) {
+	return p.publish(ctx, Advertisement{
+		ContextID: root.Bytes(),
+		Metadata:  Metadata,
+		IsRm:      true,
+	})
+}
+
+// publish signs an advertisement, appends it to our chain and announces the new head
+func (p *Publisher) publish(ctx context.Context, ad Advertisement) (cid.Cid, error) {
+	key := p.h.Peerstore().PrivKey(p.h.ID())
+	if key == nil {
+		return cid.Undef, fmt.Errorf("no private key for %s", p.h.ID())
+	}
+	ad.Provider = p.h.ID().String()
+	for _, a := range p.h.Addrs() {
+		ad.Addresses = append(ad.Addresses, a.String())
+	}
+
+	p.mu.Lock()
+	if p.head.Defined() {
+		prev := p.head
+		ad.PreviousID = &prev
+	}
+	if err := ad.Sign(key); err != nil {
+		p.mu.Unlock()
+		return cid.Undef, err
+	}
+	c, err := p.store.Put(ctx, &ad)
+	if err != nil {
+		p.mu.Unlock()
+		return cid.Undef, err
+	}
+	if err := p.ds.Put(headKey, c.Bytes()); err != nil {
+		p.mu.Unlock()
+		return cid.Undef, err
+	}
+	p.head = c
+	p.mu.Unlock()
+
+	// The chain is updated even if the indexers are unreachable, they'll sync it with the next announcement
+	if err := p.Announce(ctx); err != nil {
+		p.log.Warn().Err(err).Msg("failed to announce advertisements")
+	}
+	return c, nil
+}
+
+// announceMessage is the dag-json message indexers expect on their announce endpoint
+type announceMessage struct {
+	Cid   map[string]string
+	Addrs []map[string]map[string]string
+}
+
+// Announce tells all the indexers about the head of our chain so they sync the advertisements
+func (p *Publisher) Announce(ctx context.Context) error {
+	head := p.Head()
+	if !head.Defined() {
+		return nil
+	}
+	msg := announceMessage{Cid: map[string]string{"/": head.String()}}
+	pma, err := ma.NewMultiaddr("/p2p/" + p.h.ID().String())
+	if err != nil {
+		return err
+	}
+	for _, a := range p.h.Addrs() {
+		msg.Addrs = append(msg.Addrs, map[string]map[string]string{
+			"/": {"bytes": base64.RawStdEncoding.EncodeToString(a.Encapsulate(pma).Bytes())},
+		})
+	}
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	for _, endpoint := range p.indexers {
+		if err := p.announce(ctx, endpoint, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("announcing to indexers: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (p *Publisher) announce(ctx context.Context, endpoint string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, strings.TrimSuffix(endpoint, "/")+"/ingest/announce", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", endpoint, res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	cid "github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multihash"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublisher(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	n := testutil.NewTestNode(mn, t)
+
+	var mu sync.Mutex
+	var announced []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, http.MethodPut, r.Method)
+		require.Equal(t, "/ingest/announce", r.URL.Path)
+		b, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		var msg announceMessage
+		require.NoError(t, json.Unmarshal(b, &msg))
+		mu.Lock()
+		announced = append(announced, msg.Cid["/"])
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	pub := NewPublisher(n.Host, n.Bs, n.Ds, []string{srv.URL}, log.Logger)
+	require.Equal(t, cid.Undef, pub.Head())
+
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	var mhs []multihash.Multihash
+	for i := 0; i < MaxChunkEntries+10; i++ {
+		mhs = append(mhs, gen.Next().Cid().Hash())
+	}
+
+	first, err := pub.Publish(ctx, root, mhs)
+	require.NoError(t, err)
+	require.Equal(t, first, pub.Head())
+
+	ad, err := pub.Advertisement(ctx, first)
+	require.NoError(t, err)
+	require.NoError(t, ad.Verify(n.Host.Peerstore().PubKey(n.Host.ID())))
+	require.Nil(t, ad.PreviousID)
+	require.Equal(t, n.Host.ID().String(), ad.Provider)
+	require.Equal(t, root.Bytes(), ad.ContextID)
+	require.False(t, ad.IsRm)
+
+	// The entries span multiple chunks
+	entries, err := pub.Entries(ctx, ad)
+	require.NoError(t, err)
+	require.Equal(t, mhs, entries)
+
+	second, err := pub.Remove(ctx, root)
+	require.NoError(t, err)
+	rm, err := pub.Advertisement(ctx, second)
+	require.NoError(t, err)
+	require.True(t, rm.IsRm)
+	require.Nil(t, rm.Entries)
+	require.Equal(t, first, *rm.PreviousID)
+
+	// Tampering with an advertisement invalidates it
+	rm.IsRm = false
+	require.Equal(t, ErrInvalidSignature, rm.Verify(n.Host.Peerstore().PubKey(n.Host.ID())))
+
+	mu.Lock()
+	require.Equal(t, []string{first.String(), second.String()}, announced)
+	mu.Unlock()
+
+	// The head of the chain is restored after a restart
+	pub2 := NewPublisher(n.Host, n.Bs, n.Ds, nil, log.Logger)
+	require.Equal(t, second, pub2.Head())
+}
@@ -0,0 +1,71 @@
+package pop
+
+import (
+	"context"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+)
+
+// indexUpdate is a change to the content we cache waiting to be advertised
+type indexUpdate struct {
+	root  cid.Cid
+	added bool
+}
+
+// startIndexing advertises the content added to or removed from our supply to the indexers in the
+// order it changes
+func (e *Exchange) startIndexing(ctx context.Context) {
+	updates := make(chan indexUpdate, 64)
+	unsub := e.supply.SubscribeToContent(func(root cid.Cid, added bool) {
+		select {
+		case updates <- indexUpdate{root: root, added: added}:
+		case <-ctx.Done():
+		}
+	})
+	go func() {
+		defer unsub()
+		for {
+			select {
+			case u := <-updates:
+				e.index(ctx, u.root, u.added)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// index publishes the advertisement for a content we added or removed
+func (e *Exchange) index(ctx context.Context, root cid.Cid, added bool) {
+	var err error
+	if added {
+		var mhs []multihash.Multihash
+		mhs, err = e.contentMultihashes(ctx, root)
+		if err == nil {
+			_, err = e.indexer.Publish(ctx, root, mhs)
+		}
+	} else {
+		_, err = e.indexer.Remove(ctx, root)
+	}
+	if err != nil && ctx.Err() == nil {
+		e.log.Error().Err(err).Str("root", root.String()).Bool("added", added).Msg("failed to advertise content")
+	}
+}
+
+// contentMultihashes lists the multihashes of all the blocks in the store of a content
+func (e *Exchange) contentMultihashes(ctx context.Context, root cid.Cid) ([]multihash.Multihash, error) {
+	store, err := e.supply.GetStore(root)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := store.Bstore.AllKeysChan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var mhs []multihash.Multihash
+	for k := range keys {
+		mhs = append(mhs, k.Hash())
+	}
+	return mhs, ctx.Err()
+}
@@ -0,0 +1,584 @@
+// Package carstore packs the blocks of each multistore store into a single CAR file
+// instead of individual datastore keys and exports the DAGs of a store as indexed CARv2 files
+package carstore
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-car"
+	"github.com/multiformats/go-base32"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ErrStoreNotFound is returned when exporting a store which has no CAR file
+var ErrStoreNotFound = errors.New("car store not found")
+
+// DefaultMaxOpenFiles is how many store files we keep open at once. The least recently used file
+// is closed when opening another one.
+const DefaultMaxOpenFiles = 128
+
+// metaPrefix is where we keep the block key namespace and tombstones for each store
+var metaPrefix = datastore.NewKey("/carstore")
+
+// placeholder is the root written in the header of each store file. Roots are only known
+// when exporting so we use an empty identity CID.
+var placeholder = func() cid.Cid {
+	hash, _ := mh.Sum(nil, mh.IDENTITY, -1)
+	return cid.NewCidV1(cid.Raw, hash)
+}()
+
+// headerLen is the size of the placeholder header at the beginning of each file
+var headerLen = func() int64 {
+	buf := new(bytes.Buffer)
+	_ = car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{placeholder}, Version: 1}, buf)
+	return int64(buf.Len())
+}()
+
+type entry struct {
+	offset int64 // offset of the block data in the file
+	size   int
+}
+
+// carFile is an append only file of CAR sections holding all the blocks of a single store
+type carFile struct {
+	id     string
+	f      *os.File
+	end    int64
+	ns     string
+	index  map[string]entry
+	remove map[string]bool
+	// elem is the position of the file in the list of open files
+	elem *list.Element
+}
+
+// Datastore wraps a datastore used by a MultiStore and writes the blocks of every store
+// in a CAR file. All other keys are passed through to the underlying datastore.
+// Deleted blocks are only removed from the index, the file is dropped once the store is empty.
+// Only the most recently used files stay open with their index.
+type Datastore struct {
+	ds  datastore.Batching
+	dir string
+
+	mu      sync.Mutex
+	files   map[string]*carFile
+	lru     *list.List
+	maxOpen int
+}
+
+// New creates a CAR backed datastore writing store files in the given directory
+func New(ds datastore.Batching, dir string) (*Datastore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &Datastore{
+		ds:      ds,
+		dir:     dir,
+		files:   make(map[string]*carFile),
+		lru:     list.New(),
+		maxOpen: DefaultMaxOpenFiles,
+	}, nil
+}
+
+// SetMaxOpenFiles changes how many store files we keep open at once
+func (d *Datastore) SetMaxOpenFiles(n int) {
+	if n < 1 {
+		n = 1
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.maxOpen = n
+	d.evict()
+}
+
+// blockKey checks if a key belongs to a store blockstore and returns the store ID and the namespace.
+// The multistore keeps each store under /multi/<store id> and the blockstore keys look like
+// /multi/<store id>/.../blocks/<base32 multihash>.
+func blockKey(k datastore.Key) (string, string, bool) {
+	ls := k.List()
+	if len(ls) < 4 || ls[0] != "multi" || ls[len(ls)-2] != "blocks" {
+		return "", "", false
+	}
+	if _, err := strconv.ParseUint(ls[1], 10, 64); err != nil {
+		return "", "", false
+	}
+	return ls[1], k.Parent().String(), true
+}
+
+func (d *Datastore) path(id string) string {
+	return filepath.Join(d.dir, id+".car")
+}
+
+func (d *Datastore) metaKey(id string) datastore.Key {
+	return metaPrefix.ChildString(id)
+}
+
+// open returns the file for a given store, loading the index from disk if it exists.
+// the caller must hold the lock.
+func (d *Datastore) open(id string, create bool) (*carFile, error) {
+	if cf, ok := d.files[id]; ok {
+		d.lru.MoveToFront(cf.elem)
+		return cf, nil
+	}
+	flags := os.O_RDWR
+	if create {
+		flags |= os.O_CREATE
+	}
+	f, err := os.OpenFile(d.path(id), flags, 0644)
+	if os.IsNotExist(err) {
+		return nil, datastore.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	cf := &carFile{
+		id:     id,
+		f:      f,
+		index:  make(map[string]entry),
+		remove: make(map[string]bool),
+	}
+	if err := d.init(cf); err != nil {
+		f.Close()
+		return nil, err
+	}
+	d.files[id] = cf
+	cf.elem = d.lru.PushFront(cf)
+	d.evict()
+	return cf, nil
+}
+
+// init writes the header of a new file or loads the index of an existing one
+func (d *Datastore) init(cf *carFile) error {
+	st, err := cf.f.Stat()
+	if err != nil {
+		return err
+	}
+	if st.Size() == 0 {
+		err = car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{placeholder}, Version: 1}, cf.f)
+		if err != nil {
+			return err
+		}
+		cf.end = headerLen
+		return nil
+	}
+	ns, err := d.ds.Get(d.metaKey(cf.id))
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+	cf.ns = string(ns)
+	tombs, err := d.tombstones(cf.id)
+	if err != nil {
+		return err
+	}
+	return cf.load(tombs)
+}
+
+// evict closes the least recently used files until we are within the limit. The caller must hold the lock.
+func (d *Datastore) evict() {
+	for d.lru.Len() > d.maxOpen {
+		cf := d.lru.Remove(d.lru.Back()).(*carFile)
+		delete(d.files, cf.id)
+		cf.f.Close()
+	}
+}
+
+// tombstones returns the keys of the blocks deleted from a store
+func (d *Datastore) tombstones(id string) (map[string]bool, error) {
+	res, err := d.ds.Query(query.Query{Prefix: d.metaKey(id).String() + "/", KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	tombs := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		tombs[datastore.RawKey(e.Key).BaseNamespace()] = true
+	}
+	return tombs, nil
+}
+
+// load scans all the sections of the file to rebuild the index
+func (cf *carFile) load(tombs map[string]bool) error {
+	if _, err := cf.f.Seek(headerLen, io.SeekStart); err != nil {
+		return err
+	}
+	br := bufio.NewReader(cf.f)
+	offset := headerLen
+	for {
+		l, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		n := int64(uvarintSize(l))
+		section := make([]byte, l)
+		if _, err := io.ReadFull(br, section); err != nil {
+			// A partial write at the end of the file is ignored and overwritten by the next put
+			break
+		}
+		cl, c, err := cid.CidFromBytes(section)
+		if err != nil {
+			return err
+		}
+		name := keyName(c.Hash())
+		if !tombs[name] {
+			cf.index[name] = entry{offset: offset + n + int64(cl), size: int(l) - cl}
+		}
+		offset += n + int64(l)
+	}
+	cf.end = offset
+	return nil
+}
+
+func uvarintSize(v uint64) int {
+	buf := make([]byte, binary.MaxVarintLen64)
+	return binary.PutUvarint(buf, v)
+}
+
+// keyName encodes a multihash the same way the blockstore does in its datastore keys
+func keyName(hash mh.Multihash) string {
+	return base32.RawStdEncoding.EncodeToString(hash)
+}
+
+// Get returns the value for a key
+func (d *Datastore) Get(k datastore.Key) ([]byte, error) {
+	id, _, ok := blockKey(k)
+	if !ok {
+		return d.ds.Get(k)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cf, err := d.open(id, false)
+	if err != nil {
+		return nil, err
+	}
+	e, ok := cf.index[k.BaseNamespace()]
+	if !ok {
+		return nil, datastore.ErrNotFound
+	}
+	data := make([]byte, e.size)
+	if _, err := cf.f.ReadAt(data, e.offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Has checks if a key is present
+func (d *Datastore) Has(k datastore.Key) (bool, error) {
+	_, err := d.GetSize(k)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetSize returns the size of the value for a key
+func (d *Datastore) GetSize(k datastore.Key) (int, error) {
+	id, _, ok := blockKey(k)
+	if !ok {
+		return d.ds.GetSize(k)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cf, err := d.open(id, false)
+	if err != nil {
+		return -1, err
+	}
+	e, ok := cf.index[k.BaseNamespace()]
+	if !ok {
+		return -1, datastore.ErrNotFound
+	}
+	return e.size, nil
+}
+
+// Put appends blocks to the store file and passes other values through
+func (d *Datastore) Put(k datastore.Key, value []byte) error {
+	id, ns, ok := blockKey(k)
+	if !ok {
+		return d.ds.Put(k, value)
+	}
+	name := k.BaseNamespace()
+	hash, err := base32.RawStdEncoding.DecodeString(name)
+	if err != nil {
+		return fmt.Errorf("invalid block key %s: %w", k, err)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cf, err := d.open(id, true)
+	if err != nil {
+		return err
+	}
+	if cf.ns != ns {
+		if err := d.ds.Put(d.metaKey(id), []byte(ns)); err != nil {
+			return err
+		}
+		cf.ns = ns
+	}
+	if _, ok := cf.index[name]; ok {
+		return nil
+	}
+	// Blocks are keyed by multihash so the codec is unknown until the block is linked from a DAG. The
+	// sections of the store file use raw CIDs and ExportCAR resolves the real CIDs from the links.
+	c := cid.NewCidV1(cid.Raw, hash)
+	cb := c.Bytes()
+	l := uint64(len(cb) + len(value))
+	buf := make([]byte, 0, binary.MaxVarintLen64+int(l))
+	buf = buf[:binary.PutUvarint(buf[:binary.MaxVarintLen64], l)]
+	hl := int64(len(buf))
+	buf = append(buf, cb...)
+	buf = append(buf, value...)
+	if _, err := cf.f.WriteAt(buf, cf.end); err != nil {
+		return err
+	}
+	cf.index[name] = entry{offset: cf.end + hl + int64(len(cb)), size: len(value)}
+	cf.end += int64(len(buf))
+	if cf.remove[name] {
+		delete(cf.remove, name)
+		return d.ds.Delete(d.metaKey(id).ChildString(name))
+	}
+	return nil
+}
+
+// Delete removes a key. Blocks are tombstoned and the file is removed once the store is empty.
+func (d *Datastore) Delete(k datastore.Key) error {
+	id, _, ok := blockKey(k)
+	if !ok {
+		return d.ds.Delete(k)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cf, err := d.open(id, false)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	name := k.BaseNamespace()
+	if _, ok := cf.index[name]; !ok {
+		return nil
+	}
+	delete(cf.index, name)
+	if len(cf.index) == 0 {
+		return d.drop(id, cf)
+	}
+	cf.remove[name] = true
+	return d.ds.Put(d.metaKey(id).ChildString(name), nil)
+}
+
+// drop closes and removes the file of a store as well as its metadata
+func (d *Datastore) drop(id string, cf *carFile) error {
+	delete(d.files, id)
+	d.lru.Remove(cf.elem)
+	if err := cf.f.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(d.path(id)); err != nil {
+		return err
+	}
+	tombs, err := d.tombstones(id)
+	if err != nil {
+		return err
+	}
+	for name := range tombs {
+		if err := d.ds.Delete(d.metaKey(id).ChildString(name)); err != nil {
+			return err
+		}
+	}
+	return d.ds.Delete(d.metaKey(id))
+}
+
+// Query merges block entries from the store files with the results of the underlying datastore.
+// Results are streamed, the values of the blocks are only read when the entry is returned.
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	res, err := d.ds.Query(query.Query{Prefix: q.Prefix, KeysOnly: q.KeysOnly, ReturnsSizes: q.ReturnsSizes})
+	if err != nil {
+		return nil, err
+	}
+	ids, err := d.storeIDs()
+	if err != nil {
+		res.Close()
+		return nil, err
+	}
+	it := &storeIter{
+		d:      d,
+		q:      q,
+		prefix: datastore.NewKey(q.Prefix).String(),
+		ids:    ids,
+	}
+	var (
+		dsDone    bool
+		closeOnce sync.Once
+	)
+	iter := query.Iterator{
+		Next: func() (query.Result, bool) {
+			// Entries of the underlying datastore come first
+			if !dsDone {
+				if r, ok := res.NextSync(); ok {
+					return r, true
+				}
+				dsDone = true
+			}
+			return it.next()
+		},
+		Close: func() error {
+			var err error
+			closeOnce.Do(func() {
+				err = res.Close()
+			})
+			return err
+		},
+	}
+	return query.NaiveQueryApply(q, query.ResultsFromIterator(q, iter)), nil
+}
+
+// storeIter goes through the blocks of the store files one store at a time
+type storeIter struct {
+	d      *Datastore
+	q      query.Query
+	prefix string
+	ids    []string
+	// id is the store we are going through and names the keys of its blocks left to return
+	id    string
+	ns    string
+	names []string
+}
+
+// next returns the next block entry of the store files matching the prefix
+func (it *storeIter) next() (query.Result, bool) {
+	for {
+		for len(it.names) > 0 {
+			name := it.names[0]
+			it.names = it.names[1:]
+			qe, ok, err := it.entry(name)
+			if err != nil {
+				return query.Result{Error: err}, true
+			}
+			if ok {
+				return query.Result{Entry: qe}, true
+			}
+		}
+		if len(it.ids) == 0 {
+			return query.Result{}, false
+		}
+		it.id = it.ids[0]
+		it.ids = it.ids[1:]
+		if err := it.load(); err != nil {
+			return query.Result{Error: err}, true
+		}
+	}
+}
+
+// load lists the keys of the blocks of the current store matching the prefix
+func (it *storeIter) load() error {
+	it.d.mu.Lock()
+	defer it.d.mu.Unlock()
+	cf, err := it.d.open(it.id, false)
+	if errors.Is(err, datastore.ErrNotFound) {
+		// The store was dropped since the query started
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(cf.ns, it.prefix) && !strings.HasPrefix(it.prefix, cf.ns) {
+		return nil
+	}
+	it.ns = cf.ns
+	for name := range cf.index {
+		key := datastore.NewKey(cf.ns).ChildString(name)
+		if it.prefix != "/" && !strings.HasPrefix(key.String(), it.prefix+"/") {
+			continue
+		}
+		it.names = append(it.names, name)
+	}
+	return nil
+}
+
+// entry reads the entry of a block of the current store. Blocks deleted since the store was listed are skipped.
+func (it *storeIter) entry(name string) (query.Entry, bool, error) {
+	it.d.mu.Lock()
+	defer it.d.mu.Unlock()
+	// The file may have been closed to open other stores since we listed it
+	cf, err := it.d.open(it.id, false)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return query.Entry{}, false, nil
+	}
+	if err != nil {
+		return query.Entry{}, false, err
+	}
+	e, ok := cf.index[name]
+	if !ok {
+		return query.Entry{}, false, nil
+	}
+	qe := query.Entry{Key: datastore.NewKey(it.ns).ChildString(name).String(), Size: e.size}
+	if !it.q.KeysOnly {
+		qe.Value = make([]byte, e.size)
+		if _, err := cf.f.ReadAt(qe.Value, e.offset); err != nil {
+			return query.Entry{}, false, err
+		}
+	}
+	return qe, true, nil
+}
+
+// storeIDs lists the stores which have a file on disk
+func (d *Datastore) storeIDs() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(d.dir, "*.car"))
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(matches))
+	for _, m := range matches {
+		ids = append(ids, strings.TrimSuffix(filepath.Base(m), ".car"))
+	}
+	return ids, nil
+}
+
+// Sync flushes the store files to disk
+func (d *Datastore) Sync(prefix datastore.Key) error {
+	d.mu.Lock()
+	for _, cf := range d.files {
+		if err := cf.f.Sync(); err != nil {
+			d.mu.Unlock()
+			return err
+		}
+	}
+	d.mu.Unlock()
+	return d.ds.Sync(prefix)
+}
+
+// Close all the store files
+func (d *Datastore) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, cf := range d.files {
+		cf.f.Close()
+		delete(d.files, id)
+	}
+	d.lru.Init()
+	return nil
+}
+
+// Batch returns a basic batch writing to the CAR files or underlying datastore
+func (d *Datastore) Batch() (datastore.Batch, error) {
+	return datastore.NewBasicBatch(d), nil
+}
+
+var _ datastore.Batching = (*Datastore)(nil)
@@ -0,0 +1,170 @@
+package carstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"testing"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-car"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCarDatastore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	cds, err := New(ds, dir)
+	require.NoError(t, err)
+	ms, err := multistore.NewMultiDstore(cds)
+	require.NoError(t, err)
+
+	id := ms.Next()
+	store, err := ms.Get(id)
+	require.NoError(t, err)
+
+	leaf := merkledag.NewRawNode([]byte("leaf"))
+	other := merkledag.NewRawNode([]byte("other"))
+	root := merkledag.NodeWithData([]byte("root"))
+	require.NoError(t, root.AddNodeLink("leaf", leaf))
+	require.NoError(t, store.DAG.AddMany(ctx, []ipldformat.Node{leaf, other, root}))
+
+	// Blocks are packed in the store file instead of the underlying datastore
+	ids, err := cds.storeIDs()
+	require.NoError(t, err)
+	require.Len(t, ids, 1)
+	res, err := ds.Query(query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := res.Rest()
+	require.NoError(t, err)
+	for _, e := range entries {
+		_, _, ok := blockKey(datastore.RawKey(e.Key))
+		require.False(t, ok, e.Key)
+	}
+
+	require.NoError(t, store.DAG.Remove(ctx, other.Cid()))
+	require.NoError(t, ms.Close())
+	require.NoError(t, cds.Close())
+
+	// Reopening rebuilds the index from the file
+	cds, err = New(ds, dir)
+	require.NoError(t, err)
+	ms, err = multistore.NewMultiDstore(cds)
+	require.NoError(t, err)
+	store, err = ms.Get(id)
+	require.NoError(t, err)
+
+	_, err = store.DAG.Get(ctx, other.Cid())
+	require.Error(t, err)
+	nd, err := store.DAG.Get(ctx, root.Cid())
+	require.NoError(t, err)
+	require.Equal(t, root.RawData(), nd.RawData())
+
+	buf := new(bytes.Buffer)
+	payload := new(bytes.Buffer)
+	require.NoError(t, cds.ExportCAR(ctx, uint64(id), root.Cid(), buf, payload))
+
+	b := buf.Bytes()
+	require.Equal(t, Pragma, b[:len(Pragma)])
+	header := b[len(Pragma):DataOffset]
+	require.Equal(t, uint64(DataOffset), binary.LittleEndian.Uint64(header[16:]))
+	dataSize := binary.LittleEndian.Uint64(header[24:])
+	indexOffset := binary.LittleEndian.Uint64(header[32:])
+	require.Equal(t, uint64(DataOffset)+dataSize, indexOffset)
+	require.Equal(t, b[DataOffset:indexOffset], payload.Bytes())
+
+	// The payload is a CARv1 with the real CIDs of the DAG and without the deleted block
+	cr, err := car.NewCarReader(bufio.NewReader(payload))
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{root.Cid()}, cr.Header.Roots)
+	var cids []cid.Cid
+	for {
+		blk, err := cr.Next()
+		if err != nil {
+			break
+		}
+		cids = append(cids, blk.Cid())
+	}
+	require.Equal(t, []cid.Cid{root.Cid(), leaf.Cid()}, cids)
+	require.Equal(t, uint64(cid.DagProtobuf), cids[0].Prefix().Codec)
+
+	// The index is sorted with a single bucket for the sha256 digests
+	index := bytes.NewReader(b[indexOffset:])
+	codec, err := binary.ReadUvarint(index)
+	require.NoError(t, err)
+	require.Equal(t, uint64(indexSorted), codec)
+	var buckets int32
+	require.NoError(t, binary.Read(index, binary.LittleEndian, &buckets))
+	require.Equal(t, int32(1), buckets)
+	var width uint32
+	require.NoError(t, binary.Read(index, binary.LittleEndian, &width))
+	require.Equal(t, uint32(32+8), width)
+	var size int64
+	require.NoError(t, binary.Read(index, binary.LittleEndian, &size))
+	require.Equal(t, int64(2*width), size)
+
+	// The file is dropped with the last block of the store
+	require.NoError(t, store.Bstore.DeleteBlock(leaf.Cid()))
+	require.NoError(t, store.Bstore.DeleteBlock(root.Cid()))
+	require.Equal(t, ErrStoreNotFound, cds.ExportCAR(ctx, uint64(id), root.Cid(), buf, nil))
+}
+
+func TestCarDatastoreOpenFiles(t *testing.T) {
+	ctx := context.Background()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	cds, err := New(ds, t.TempDir())
+	require.NoError(t, err)
+	cds.SetMaxOpenFiles(2)
+	ms, err := multistore.NewMultiDstore(cds)
+	require.NoError(t, err)
+
+	var nodes []ipldformat.Node
+	for i := 0; i < 5; i++ {
+		store, err := ms.Get(ms.Next())
+		require.NoError(t, err)
+		nd := merkledag.NewRawNode([]byte(fmt.Sprintf("block %d", i)))
+		require.NoError(t, store.DAG.Add(ctx, nd))
+		nodes = append(nodes, nd)
+	}
+	// Only the most recently used files are kept open
+	require.Len(t, cds.files, 2)
+	require.Equal(t, 2, cds.lru.Len())
+
+	// Closed files are reopened with their index
+	for i, nd := range nodes {
+		store, err := ms.Get(multistore.StoreID(i + 1))
+		require.NoError(t, err)
+		got, err := store.DAG.Get(ctx, nd.Cid())
+		require.NoError(t, err)
+		require.Equal(t, nd.RawData(), got.RawData())
+	}
+	require.Len(t, cds.files, 2)
+
+	// Queries stream the blocks of all the stores
+	res, err := cds.Query(query.Query{Prefix: "/multi"})
+	require.NoError(t, err)
+	values := make(map[string]bool)
+	for r := range res.Next() {
+		require.NoError(t, r.Error)
+		if _, _, ok := blockKey(datastore.RawKey(r.Key)); ok {
+			values[string(r.Value)] = true
+		}
+	}
+	require.NoError(t, res.Close())
+	require.Len(t, values, len(nodes))
+	for _, nd := range nodes {
+		require.True(t, values[string(nd.RawData())])
+	}
+	require.Len(t, cds.files, 2)
+}
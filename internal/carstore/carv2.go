@@ -0,0 +1,207 @@
+package carstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-car"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// Pragma is the fixed prefix of CARv2 files, a CARv1 style header with version 2
+var Pragma = []byte{0x0a, 0xa1, 0x67, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x02}
+
+// HeaderSize is the size of the CARv2 header following the pragma
+const HeaderSize = 40
+
+// DataOffset is where the CARv1 data payload starts in the CARv2 files we export
+var DataOffset = int64(len(Pragma)) + HeaderSize
+
+// indexSorted is the multicodec of the CARv2 index sorting digests by width
+const indexSorted = 0x0400
+
+// section is a block of the DAG we export and where to find it in the store file. Identity blocks
+// aren't stored so their data is inlined.
+type section struct {
+	cid    cid.Cid
+	e      entry
+	inline []byte
+}
+
+func (s section) size() int {
+	if s.inline != nil {
+		return len(s.inline)
+	}
+	return s.e.size
+}
+
+// walk lists the blocks of the DAG under the root in the order go-car writes them. Blocks are keyed by
+// multihash in the store file so the CIDs, with their codecs, are resolved from the links of the DAG.
+func (cf *carFile) walk(ctx context.Context, root cid.Cid) ([]section, error) {
+	var sections []section
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipldformat.Link, error) {
+		s := section{cid: c}
+		var data []byte
+		if dh, err := mh.Decode(c.Hash()); err == nil && dh.Code == mh.IDENTITY {
+			data = dh.Digest
+			s.inline = data
+		} else {
+			e, ok := cf.index[keyName(c.Hash())]
+			if !ok {
+				return nil, ipldformat.ErrNotFound
+			}
+			data = make([]byte, e.size)
+			if _, err := cf.f.ReadAt(data, e.offset); err != nil {
+				return nil, err
+			}
+			s.e = e
+		}
+		blk, err := blocks.NewBlockWithCid(data, c)
+		if err != nil {
+			return nil, err
+		}
+		nd, err := ipldformat.Decode(blk)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, s)
+		return nd.Links(), nil
+	}
+	if err := merkledag.Walk(ctx, getLinks, root, cid.NewSet().Visit); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// ExportCAR writes the DAG under the root as a CARv2 file with a sorted index. Only the blocks reachable
+// from the root are exported so deleted blocks and other DAGs sharing the store are left out. If payload
+// is not nil it receives a copy of the CARv1 data payload, for instance to compute a piece commitment.
+func (d *Datastore) ExportCAR(ctx context.Context, id uint64, root cid.Cid, w io.Writer, payload io.Writer) error {
+	sid := strconv.FormatUint(id, 10)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	cf, err := d.open(sid, false)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return ErrStoreNotFound
+	}
+	if err != nil {
+		return err
+	}
+	sections, err := cf.walk(ctx, root)
+	if err != nil {
+		return err
+	}
+
+	hbuf := new(bytes.Buffer)
+	if err := car.WriteHeader(&car.CarHeader{Roots: []cid.Cid{root}, Version: 1}, hbuf); err != nil {
+		return err
+	}
+	// Offsets in the index are relative to the start of the data payload
+	offsets := make([]uint64, len(sections))
+	dataSize := uint64(hbuf.Len())
+	for i, s := range sections {
+		offsets[i] = dataSize
+		l := uint64(len(s.cid.Bytes()) + s.size())
+		dataSize += uint64(uvarintSize(l)) + l
+	}
+
+	header := make([]byte, HeaderSize)
+	// The characteristics in the first 16 bytes are all unset
+	binary.LittleEndian.PutUint64(header[16:], uint64(DataOffset))
+	binary.LittleEndian.PutUint64(header[24:], dataSize)
+	binary.LittleEndian.PutUint64(header[32:], uint64(DataOffset)+dataSize)
+	if _, err := w.Write(Pragma); err != nil {
+		return err
+	}
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	data := w
+	if payload != nil {
+		data = io.MultiWriter(w, payload)
+	}
+	if _, err := data.Write(hbuf.Bytes()); err != nil {
+		return err
+	}
+	vbuf := make([]byte, binary.MaxVarintLen64)
+	for _, s := range sections {
+		cb := s.cid.Bytes()
+		n := binary.PutUvarint(vbuf, uint64(len(cb)+s.size()))
+		if _, err := data.Write(vbuf[:n]); err != nil {
+			return err
+		}
+		if _, err := data.Write(cb); err != nil {
+			return err
+		}
+		if s.inline != nil {
+			if _, err := data.Write(s.inline); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := io.Copy(data, io.NewSectionReader(cf.f, s.e.offset, int64(s.e.size))); err != nil {
+			return err
+		}
+	}
+	return writeIndex(w, sections, offsets)
+}
+
+// writeIndex writes an IndexSorted CARv2 index: the digests and offsets of the sections bucketed by
+// digest length and sorted by digest in each bucket
+func writeIndex(w io.Writer, sections []section, offsets []uint64) error {
+	buckets := make(map[uint32][][]byte)
+	for i, s := range sections {
+		dh, err := mh.Decode(s.cid.Hash())
+		if err != nil {
+			return err
+		}
+		rec := make([]byte, len(dh.Digest)+8)
+		copy(rec, dh.Digest)
+		binary.LittleEndian.PutUint64(rec[len(dh.Digest):], offsets[i])
+		width := uint32(len(rec))
+		buckets[width] = append(buckets[width], rec)
+	}
+	widths := make([]uint32, 0, len(buckets))
+	for width := range buckets {
+		widths = append(widths, width)
+	}
+	sort.Slice(widths, func(i, j int) bool { return widths[i] < widths[j] })
+
+	vbuf := make([]byte, binary.MaxVarintLen64)
+	n := binary.PutUvarint(vbuf, indexSorted)
+	if _, err := w.Write(vbuf[:n]); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, int32(len(widths))); err != nil {
+		return err
+	}
+	for _, width := range widths {
+		recs := buckets[width]
+		sort.Slice(recs, func(i, j int) bool {
+			return bytes.Compare(recs[i][:width-8], recs[j][:width-8]) < 0
+		})
+		if err := binary.Write(w, binary.LittleEndian, width); err != nil {
+			return err
+		}
+		if err := binary.Write(w, binary.LittleEndian, int64(len(recs))*int64(width)); err != nil {
+			return err
+		}
+		for _, rec := range recs {
+			if _, err := w.Write(rec); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,405 @@
+// Package compress transparently compresses the blocks written in a datastore
+package compress
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// Codec identifies the algorithm used to compress a block
+type Codec byte
+
+const (
+	// None stores the block as is. It is used when compression doesn't save any space.
+	None Codec = iota
+	// Flate uses the DEFLATE algorithm
+	Flate
+	// Gzip uses the gzip format
+	Gzip
+	// Zlib uses the zlib format
+	Zlib
+)
+
+// ErrUnknownCodec is returned when parsing an unsupported codec name or reading a block
+// compressed with an unknown codec
+var ErrUnknownCodec = errors.New("unknown compression codec")
+
+// ErrCodecMismatch is returned when opening a repo with another codec than the one its blocks are written with
+var ErrCodecMismatch = errors.New("compression codec mismatch")
+
+// codecKey is where the codec the repo was created with is persisted
+var codecKey = datastore.NewKey("/compress/codec")
+
+// statsKey is where the compression stats are persisted
+var statsKey = datastore.NewKey("/compress/stats")
+
+// statsFlushBlocks is how many blocks we write between two saves of the stats
+const statsFlushBlocks = 128
+
+// ParseCodec returns a codec from its name
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "", "none":
+		return None, nil
+	case "flate":
+		return Flate, nil
+	case "gzip":
+		return Gzip, nil
+	case "zlib":
+		return Zlib, nil
+	}
+	return None, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+}
+
+func (c Codec) String() string {
+	switch c {
+	case None:
+		return "none"
+	case Flate:
+		return "flate"
+	case Gzip:
+		return "gzip"
+	case Zlib:
+		return "zlib"
+	}
+	return "unknown"
+}
+
+// Stats gives feedback about how much space compression saved since the repo was created
+type Stats struct {
+	Blocks      int64
+	RawBytes    int64
+	StoredBytes int64
+}
+
+// Saved returns the number of bytes saved
+func (s Stats) Saved() int64 {
+	return s.RawBytes - s.StoredBytes
+}
+
+// Ratio returns the percentage of space saved
+func (s Stats) Ratio() float64 {
+	if s.RawBytes == 0 {
+		return 0
+	}
+	return float64(s.Saved()) / float64(s.RawBytes) * 100
+}
+
+// Datastore compresses the value of block keys before writing them to the underlying datastore.
+// Each value is prefixed with the codec and uncompressed size so blocks written with different
+// codecs can be read back.
+type Datastore struct {
+	ds    datastore.Batching
+	codec Codec
+
+	blocks int64
+	raw    int64
+	stored int64
+	// unsaved counts the blocks written since the stats were last saved
+	unsaved int64
+}
+
+// Wrap a datastore to compress blocks with the given codec
+func Wrap(ds datastore.Batching, codec Codec) *Datastore {
+	return &Datastore{ds: ds, codec: codec}
+}
+
+// Open checks the repo was created with the given codec and wraps its datastore to compress blocks
+// with it. The stats are loaded from the last time they were saved.
+func Open(ds datastore.Batching, codec Codec) (*Datastore, error) {
+	if err := CheckCodec(ds, codec); err != nil {
+		return nil, err
+	}
+	d := Wrap(ds, codec)
+	b, err := ds.Get(statsKey)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return d, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stats Stats
+	if err := json.Unmarshal(b, &stats); err != nil {
+		return nil, err
+	}
+	d.blocks, d.raw, d.stored = stats.Blocks, stats.RawBytes, stats.StoredBytes
+	return d, nil
+}
+
+// CheckCodec persists the codec a repo is created with and refuses to open it with another one as
+// blocks would be misread. Repos which hold blocks but no codec predate compression so their blocks
+// are uncompressed.
+func CheckCodec(ds datastore.Batching, codec Codec) error {
+	b, err := ds.Get(codecKey)
+	if err == nil {
+		if len(b) != 1 || Codec(b[0]) != codec {
+			return fmt.Errorf("%w: repo blocks use %s", ErrCodecMismatch, Codec(b[0]))
+		}
+		return nil
+	}
+	if !errors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+	has, err := hasBlocks(ds)
+	if err != nil {
+		return err
+	}
+	if has && codec != None {
+		return fmt.Errorf("%w: repo blocks use %s", ErrCodecMismatch, None)
+	}
+	return ds.Put(codecKey, []byte{byte(codec)})
+}
+
+// hasBlocks checks if any block was written in the datastore
+func hasBlocks(ds datastore.Batching) (bool, error) {
+	res, err := ds.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return false, err
+	}
+	defer res.Close()
+	for r := range res.Next() {
+		if r.Error != nil {
+			return false, r.Error
+		}
+		if isBlock(datastore.RawKey(r.Key)) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// saveStats persists the stats so they cover the whole life of the repo
+func (d *Datastore) saveStats() error {
+	atomic.StoreInt64(&d.unsaved, 0)
+	b, err := json.Marshal(d.Stats())
+	if err != nil {
+		return err
+	}
+	return d.ds.Put(statsKey, b)
+}
+
+// isBlock checks if a key is a block key written by a blockstore
+func isBlock(k datastore.Key) bool {
+	ls := k.List()
+	return len(ls) >= 2 && ls[len(ls)-2] == "blocks"
+}
+
+func (d *Datastore) compress(value []byte) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var hdr [binary.MaxVarintLen64 + 1]byte
+	hdr[0] = byte(d.codec)
+	n := binary.PutUvarint(hdr[1:], uint64(len(value)))
+	buf.Write(hdr[:n+1])
+
+	var w io.WriteCloser
+	var err error
+	switch d.codec {
+	case None:
+		buf.Write(value)
+		return buf.Bytes(), nil
+	case Flate:
+		w, err = flate.NewWriter(buf, flate.DefaultCompression)
+	case Gzip:
+		w = gzip.NewWriter(buf)
+	case Zlib:
+		w = zlib.NewWriter(buf)
+	default:
+		return nil, ErrUnknownCodec
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	// Already compressed content like images may end up larger
+	if buf.Len() >= len(value)+n+1 {
+		hdr[0] = byte(None)
+		return append(hdr[:n+1], value...), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// header reads the codec and uncompressed size of a value
+func header(value []byte) (Codec, int, []byte, error) {
+	if len(value) == 0 {
+		return None, 0, nil, fmt.Errorf("empty value")
+	}
+	size, n := binary.Uvarint(value[1:])
+	if n <= 0 {
+		return None, 0, nil, fmt.Errorf("invalid size header")
+	}
+	return Codec(value[0]), int(size), value[n+1:], nil
+}
+
+func decompress(value []byte) ([]byte, error) {
+	codec, size, data, err := header(value)
+	if err != nil {
+		return nil, err
+	}
+	var r io.Reader
+	switch codec {
+	case None:
+		return data, nil
+	case Flate:
+		fr := flate.NewReader(bytes.NewReader(data))
+		defer fr.Close()
+		r = fr
+	case Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case Zlib:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, ErrUnknownCodec
+	}
+	b := bytes.NewBuffer(make([]byte, 0, size))
+	if _, err := io.Copy(b, r); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Stats returns the compression stats since the repo was created
+func (d *Datastore) Stats() Stats {
+	return Stats{
+		Blocks:      atomic.LoadInt64(&d.blocks),
+		RawBytes:    atomic.LoadInt64(&d.raw),
+		StoredBytes: atomic.LoadInt64(&d.stored),
+	}
+}
+
+// Codec returns the codec used to compress new blocks
+func (d *Datastore) Codec() Codec {
+	return d.codec
+}
+
+// Get returns the decompressed value for a key
+func (d *Datastore) Get(k datastore.Key) ([]byte, error) {
+	v, err := d.ds.Get(k)
+	if err != nil || !isBlock(k) {
+		return v, err
+	}
+	return decompress(v)
+}
+
+// Has checks if a key is present
+func (d *Datastore) Has(k datastore.Key) (bool, error) {
+	return d.ds.Has(k)
+}
+
+// GetSize returns the uncompressed size of a value
+func (d *Datastore) GetSize(k datastore.Key) (int, error) {
+	if !isBlock(k) {
+		return d.ds.GetSize(k)
+	}
+	v, err := d.ds.Get(k)
+	if err != nil {
+		return -1, err
+	}
+	_, size, _, err := header(v)
+	if err != nil {
+		return -1, err
+	}
+	return size, nil
+}
+
+// Put compresses block values before writing them
+func (d *Datastore) Put(k datastore.Key, value []byte) error {
+	if !isBlock(k) {
+		return d.ds.Put(k, value)
+	}
+	enc, err := d.compress(value)
+	if err != nil {
+		return err
+	}
+	if err := d.ds.Put(k, enc); err != nil {
+		return err
+	}
+	atomic.AddInt64(&d.blocks, 1)
+	atomic.AddInt64(&d.raw, int64(len(value)))
+	atomic.AddInt64(&d.stored, int64(len(enc)))
+	// The stats are saved every few blocks so a crash only loses the last ones
+	if atomic.AddInt64(&d.unsaved, 1) >= statsFlushBlocks {
+		return d.saveStats()
+	}
+	return nil
+}
+
+// Delete removes a key
+func (d *Datastore) Delete(k datastore.Key) error {
+	return d.ds.Delete(k)
+}
+
+// Query decompresses block values in the results
+func (d *Datastore) Query(q query.Query) (query.Results, error) {
+	res, err := d.ds.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	if q.KeysOnly {
+		return res, nil
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for i, e := range entries {
+		if !isBlock(datastore.RawKey(e.Key)) {
+			continue
+		}
+		v, err := decompress(e.Value)
+		if err != nil {
+			return nil, err
+		}
+		entries[i].Value = v
+		entries[i].Size = len(v)
+	}
+	return query.ResultsWithEntries(q, entries), nil
+}
+
+// Sync saves the stats and flushes the underlying datastore
+func (d *Datastore) Sync(prefix datastore.Key) error {
+	if err := d.saveStats(); err != nil {
+		return err
+	}
+	return d.ds.Sync(prefix)
+}
+
+// Close saves the stats and closes the underlying datastore
+func (d *Datastore) Close() error {
+	if err := d.saveStats(); err != nil {
+		return err
+	}
+	return d.ds.Close()
+}
+
+// Batch returns a basic batch compressing block values
+func (d *Datastore) Batch() (datastore.Batch, error) {
+	return datastore.NewBasicBatch(d), nil
+}
+
+var _ datastore.Batching = (*Datastore)(nil)
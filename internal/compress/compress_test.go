@@ -0,0 +1,73 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressBlocks(t *testing.T) {
+	for _, codec := range []Codec{None, Flate, Gzip, Zlib} {
+		t.Run(codec.String(), func(t *testing.T) {
+			ds := dssync.MutexWrap(datastore.NewMapDatastore())
+			cds := Wrap(ds, codec)
+
+			value := bytes.Repeat([]byte("<p>hello edge</p>"), 100)
+			k := datastore.NewKey("/blocks/CIQTEST")
+			require.NoError(t, cds.Put(k, value))
+
+			v, err := cds.Get(k)
+			require.NoError(t, err)
+			require.Equal(t, value, v)
+
+			size, err := cds.GetSize(k)
+			require.NoError(t, err)
+			require.Equal(t, len(value), size)
+
+			stats := cds.Stats()
+			require.Equal(t, int64(1), stats.Blocks)
+			if codec != None {
+				require.Greater(t, stats.Saved(), int64(0))
+			}
+
+			// Other keys are not compressed
+			require.NoError(t, cds.Put(datastore.NewKey("/index"), []byte("raw")))
+			v, err = ds.Get(datastore.NewKey("/index"))
+			require.NoError(t, err)
+			require.Equal(t, []byte("raw"), v)
+		})
+	}
+}
+
+func TestOpenCodec(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	cds, err := Open(ds, Gzip)
+	require.NoError(t, err)
+
+	value := bytes.Repeat([]byte("<p>hello edge</p>"), 100)
+	require.NoError(t, cds.Put(datastore.NewKey("/blocks/CIQTEST"), value))
+	require.NoError(t, cds.Close())
+
+	// Blocks would be misread with another codec or without compression
+	_, err = Open(ds, Flate)
+	require.True(t, errors.Is(err, ErrCodecMismatch))
+	require.True(t, errors.Is(CheckCodec(ds, None), ErrCodecMismatch))
+
+	// Stats are kept across restarts
+	cds, err = Open(ds, Gzip)
+	require.NoError(t, err)
+	stats := cds.Stats()
+	require.Equal(t, int64(1), stats.Blocks)
+	require.Equal(t, int64(len(value)), stats.RawBytes)
+
+	// Repos with blocks written before the codec was persisted are uncompressed
+	ds = dssync.MutexWrap(datastore.NewMapDatastore())
+	require.NoError(t, ds.Put(datastore.NewKey("/blocks/CIQTEST"), value))
+	_, err = Open(ds, Zlib)
+	require.True(t, errors.Is(err, ErrCodecMismatch))
+	require.NoError(t, CheckCodec(ds, None))
+}
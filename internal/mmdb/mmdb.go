@@ -0,0 +1,299 @@
+// Package mmdb reads MaxMind DB files such as the GeoLite2 country database. It only implements
+// what we need to look up the record of an IP address.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+)
+
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// ErrInvalidDatabase is returned when the file is not a MaxMind DB we can read
+var ErrInvalidDatabase = errors.New("invalid MaxMind DB")
+
+// ErrNotFound is returned when an address has no record
+var ErrNotFound = errors.New("address not found")
+
+// Reader looks up records in a database loaded in memory
+type Reader struct {
+	buf        []byte
+	data       []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	ipv4Start  uint
+}
+
+// Open reads a database file
+func Open(path string) (*Reader, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return FromBytes(buf)
+}
+
+// FromBytes reads a database from its content
+func FromBytes(buf []byte) (*Reader, error) {
+	i := bytes.LastIndex(buf, metadataMarker)
+	if i == -1 {
+		return nil, ErrInvalidDatabase
+	}
+	md := buf[i+len(metadataMarker):]
+	v, _, err := (&decoder{buf: md}).decode(0)
+	if err != nil {
+		return nil, err
+	}
+	meta, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrInvalidDatabase
+	}
+	r := &Reader{
+		buf:        buf,
+		nodeCount:  uint(toUint(meta["node_count"])),
+		recordSize: uint(toUint(meta["record_size"])),
+		ipVersion:  uint(toUint(meta["ip_version"])),
+	}
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%w: unsupported record size %d", ErrInvalidDatabase, r.recordSize)
+	}
+	treeSize := r.nodeCount * r.recordSize / 4
+	// The data section starts after 16 null bytes
+	if treeSize+16 > uint(i) {
+		return nil, ErrInvalidDatabase
+	}
+	r.data = buf[treeSize+16 : i]
+	// IPv4 addresses are under ::/96 of IPv6 trees
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for j := 0; j < 96 && node < r.nodeCount; j++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// record reads the left (0) or right (1) record of a node
+func (r *Reader) record(node uint, bit uint) uint {
+	switch r.recordSize {
+	case 24:
+		off := node*6 + bit*3
+		b := r.buf[off : off+3]
+		return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+	case 28:
+		off := node * 7
+		b := r.buf[off : off+7]
+		if bit == 0 {
+			return uint(b[3]&0xf0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])
+		}
+		return uint(b[3]&0x0f)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6])
+	default:
+		off := node*8 + bit*4
+		return uint(binary.BigEndian.Uint32(r.buf[off : off+4]))
+	}
+}
+
+// Lookup returns the record of an IP address. Maps are decoded as map[string]interface{}.
+func (r *Reader) Lookup(ip net.IP) (interface{}, error) {
+	node := uint(0)
+	bits := ip.To4()
+	if bits != nil && r.ipVersion == 6 {
+		node = r.ipv4Start
+	}
+	if bits == nil {
+		if r.ipVersion == 4 {
+			return nil, ErrNotFound
+		}
+		bits = ip.To16()
+		if bits == nil {
+			return nil, fmt.Errorf("invalid IP %s", ip)
+		}
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		node = r.record(node, bit)
+	}
+	if node <= r.nodeCount {
+		return nil, ErrNotFound
+	}
+	off := node - r.nodeCount - 16
+	if off >= uint(len(r.data)) {
+		return nil, ErrInvalidDatabase
+	}
+	v, _, err := (&decoder{buf: r.data}).decode(off)
+	return v, err
+}
+
+// decoder reads the values of the data section
+type decoder struct {
+	buf []byte
+}
+
+const (
+	typeExtended = iota
+	typePointer
+	typeString
+	typeDouble
+	typeBytes
+	typeUint16
+	typeUint32
+	typeMap
+	typeInt32
+	typeUint64
+	typeUint128
+	typeArray
+	typeContainer
+	typeEnd
+	typeBool
+	typeFloat
+)
+
+func (d *decoder) next(off uint, n uint) ([]byte, uint, error) {
+	if off+n > uint(len(d.buf)) {
+		return nil, 0, ErrInvalidDatabase
+	}
+	return d.buf[off : off+n], off + n, nil
+}
+
+// decode returns the value at an offset and the offset following it
+func (d *decoder) decode(off uint) (interface{}, uint, error) {
+	b, off, err := d.next(off, 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	ctrl := b[0]
+	typ := uint(ctrl >> 5)
+	if typ == typePointer {
+		return d.decodePointer(ctrl, off)
+	}
+	if typ == typeExtended {
+		b, off, err = d.next(off, 1)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ = 7 + uint(b[0])
+	}
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		b, off, err = d.next(off, n)
+		if err != nil {
+			return nil, 0, err
+		}
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+	}
+	switch typ {
+	case typeMap:
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				return nil, 0, ErrInvalidDatabase
+			}
+			v, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[key] = v
+			off = next
+		}
+		return m, off, nil
+	case typeArray:
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := d.decode(off)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case typeBool:
+		return size != 0, off, nil
+	}
+	b, off, err = d.next(off, size)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch typ {
+	case typeString:
+		return string(b), off, nil
+	case typeBytes:
+		return append([]byte(nil), b...), off, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, ErrInvalidDatabase
+		}
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), off, nil
+	case typeUint16, typeUint32, typeUint64:
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, off, nil
+	case typeInt32:
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int32(v), off, nil
+	case typeUint128:
+		// We don't need 128 bit values, keep their bytes
+		return append([]byte(nil), b...), off, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown type %d", ErrInvalidDatabase, typ)
+}
+
+// decodePointer follows a pointer to another value of the data section
+func (d *decoder) decodePointer(ctrl byte, off uint) (interface{}, uint, error) {
+	ss := uint(ctrl>>3) & 0x3
+	vvv := uint(ctrl & 0x7)
+	b, next, err := d.next(off, ss+1)
+	if err != nil {
+		return nil, 0, err
+	}
+	var p uint
+	switch ss {
+	case 0:
+		p = vvv<<8 | uint(b[0])
+	case 1:
+		p = (vvv<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+	case 2:
+		p = (vvv<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+	default:
+		p = uint(binary.BigEndian.Uint32(b))
+	}
+	v, _, err := d.decode(p)
+	return v, next, err
+}
+
+func toUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
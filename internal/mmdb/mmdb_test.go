@@ -0,0 +1,78 @@
+package mmdb
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func str(s string) []byte {
+	return append([]byte{byte(typeString<<5 | len(s))}, s...)
+}
+
+func continent(code string) []byte {
+	var b bytes.Buffer
+	b.WriteByte(typeMap<<5 | 1)
+	b.Write(str("continent"))
+	b.WriteByte(typeMap<<5 | 1)
+	b.Write(str("code"))
+	b.Write(str(code))
+	return b.Bytes()
+}
+
+// testDB maps 0.0.0.0/1 to Europe and 128.0.0.0/1 to North America with a single node
+func testDB() []byte {
+	eu := continent("EU")
+	na := continent("NA")
+	var db bytes.Buffer
+	nodeCount := 1
+	left := nodeCount + 16
+	right := nodeCount + 16 + len(eu)
+	db.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left)})
+	db.Write([]byte{byte(right >> 16), byte(right >> 8), byte(right)})
+	db.Write(make([]byte, 16))
+	db.Write(eu)
+	db.Write(na)
+	db.Write(metadataMarker)
+	db.WriteByte(typeMap<<5 | 3)
+	db.Write(str("node_count"))
+	db.Write([]byte{typeUint32<<5 | 1, byte(nodeCount)})
+	db.Write(str("record_size"))
+	db.Write([]byte{typeUint16<<5 | 1, 24})
+	db.Write(str("ip_version"))
+	db.Write([]byte{typeUint16<<5 | 1, 4})
+	return db.Bytes()
+}
+
+func TestLookup(t *testing.T) {
+	r, err := FromBytes(testDB())
+	require.NoError(t, err)
+
+	rec, err := r.Lookup(net.ParseIP("81.2.69.160"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{
+		"continent": map[string]interface{}{"code": "EU"},
+	}, rec)
+
+	rec, err = r.Lookup(net.ParseIP("216.160.83.56"))
+	require.NoError(t, err)
+	require.Equal(t, "NA", rec.(map[string]interface{})["continent"].(map[string]interface{})["code"])
+
+	_, err = r.Lookup(net.ParseIP("2001:db8::1"))
+	require.Equal(t, ErrNotFound, err)
+
+	_, err = FromBytes([]byte("not a database"))
+	require.Equal(t, ErrInvalidDatabase, err)
+}
+
+func TestDecodePointer(t *testing.T) {
+	// A map whose value points back to the string at offset 0
+	buf := append(str("EU"), typeMap<<5|1)
+	buf = append(buf, str("code")...)
+	buf = append(buf, typePointer<<5, 0)
+	v, _, err := (&decoder{buf: buf}).decode(3)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"code": "EU"}, v)
+}
@@ -242,6 +242,24 @@ func (tn *TestNode) VerifyFileTransferred(ctx context.Context, t *testing.T, dag
 	require.EqualValues(t, origBytes, b)
 }
 
+// DAGSize returns the bytes of all the blocks of a DAG in a store, the size publishers declare when dispatching it
+func (tn *TestNode) DAGSize(ctx context.Context, t *testing.T, storeID multistore.StoreID, root cid.Cid) uint64 {
+	store, err := tn.Ms.Get(storeID)
+	require.NoError(t, err)
+	dag := store.DAG
+	var size uint64
+	err = merkledag.Walk(ctx, func(ctx context.Context, c cid.Cid) ([]*ipldformat.Link, error) {
+		nd, err := dag.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		size += uint64(len(nd.RawData()))
+		return nd.Links(), nil
+	}, root, cid.NewSet().Visit)
+	require.NoError(t, err)
+	return size
+}
+
 func (tn *TestNode) NukeBlockstore(ctx context.Context, t *testing.T) {
 	cids, err := tn.Bs.AllKeysChan(ctx)
 	require.NoError(t, err)
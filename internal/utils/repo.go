@@ -34,13 +34,23 @@ func RepoPath() string {
 	return ".pop"
 }
 
-// FullPath constructs full path and check if a repo was initialized with a datastore
+// FullPath resolves a repo path relative to the home directory. Absolute paths are kept as is and a
+// leading ~ is expanded so $POP_PATH works with any separator, including on Windows.
 func FullPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path), nil
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, path), nil
+	if path == "~" {
+		return home, nil
+	}
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		path = path[2:]
+	}
+	return filepath.Join(home, filepath.FromSlash(path)), nil
 }
 
 // RepoExists checks if we have a datastore directory already created
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/rs/zerolog"
+)
+
+// maxWarnChannels caps how many channels we remember before resetting
+const maxWarnChannels = 1024
+
+type lastWarn struct {
+	msg string
+	at  time.Time
+}
+
+// ChannelWarner logs data transfer channel warnings at most once per interval for the same message
+// on a given channel so events firing repeatedly don't flood the logs
+type ChannelWarner struct {
+	logger   zerolog.Logger
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[datatransfer.ChannelID]lastWarn
+}
+
+// NewChannelWarner creates a new ChannelWarner logging with the given logger
+func NewChannelWarner(logger zerolog.Logger, interval time.Duration) *ChannelWarner {
+	return &ChannelWarner{
+		logger:   logger,
+		interval: interval,
+		last:     make(map[datatransfer.ChannelID]lastWarn),
+	}
+}
+
+// Warn logs an error for a given channel unless the same error was logged recently.
+// It returns true if the message was logged.
+func (w *ChannelWarner) Warn(chid datatransfer.ChannelID, msg string, err error) bool {
+	w.mu.Lock()
+	now := time.Now()
+	l, ok := w.last[chid]
+	if ok && l.msg == err.Error() && now.Sub(l.at) < w.interval {
+		w.mu.Unlock()
+		return false
+	}
+	if len(w.last) >= maxWarnChannels {
+		w.last = make(map[datatransfer.ChannelID]lastWarn)
+	}
+	w.last[chid] = lastWarn{msg: err.Error(), at: now}
+	w.mu.Unlock()
+
+	w.logger.Warn().Err(err).Str("channel", chid.String()).Msg(msg)
+	return true
+}
@@ -0,0 +1,336 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+)
+
+//go:generate cbor-gen-for Listing
+
+// MarketTopic is the gossip topic where caches advertise their capacity and price in a region
+const MarketTopic = "/myel/pop/market/1.0"
+
+// ListingInterval is how often caches publish their listing
+const ListingInterval = time.Minute
+
+// ListingTTL is how long a listing remains valid if the provider doesn't publish it again
+const ListingTTL = 3 * ListingInterval
+
+// ErrInvalidListingSignature is returned when a listing isn't signed by its provider
+var ErrInvalidListingSignature = errors.New("invalid listing signature")
+
+// ErrListingExpired is returned when a listing is past its expiry
+var ErrListingExpired = errors.New("listing expired")
+
+// Listing is an offer from a cache to store content in a region
+type Listing struct {
+	Provider peer.ID
+	Region   string
+	// Capacity is the space available in bytes
+	Capacity     uint64
+	PricePerByte abi.TokenAmount
+	// Expiry is the unix time in seconds after which the listing is stale
+	Expiry uint64
+	// Signature of the provider over all the other fields so relays cannot alter the listing
+	Signature []byte
+}
+
+// signingBytes returns the bytes the provider signs
+func (l Listing) signingBytes() ([]byte, error) {
+	l.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := l.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign signs the listing with the key of the provider
+func (l *Listing) Sign(key crypto.PrivKey) error {
+	b, err := l.signingBytes()
+	if err != nil {
+		return err
+	}
+	l.Signature, err = key.Sign(b)
+	return err
+}
+
+// Verify checks the listing was signed by its provider. The public key must be inlined in the peer ID
+// or given.
+func (l Listing) Verify(pub crypto.PubKey) error {
+	if l.Provider == "" || len(l.Signature) == 0 {
+		return ErrInvalidListingSignature
+	}
+	if pub == nil {
+		var err error
+		pub, err = l.Provider.ExtractPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidListingSignature, err)
+		}
+	}
+	if !l.Provider.MatchesPublicKey(pub) {
+		return ErrInvalidListingSignature
+	}
+	b, err := l.signingBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(b, l.Signature)
+	if err != nil || !ok {
+		return ErrInvalidListingSignature
+	}
+	return nil
+}
+
+// Expired returns whether the listing is stale at the given time
+func (l Listing) Expired(now time.Time) bool {
+	return uint64(now.Unix()) >= l.Expiry
+}
+
+// Market keeps track of the listings published by caches in our regions
+type Market struct {
+	h   host.Host
+	ps  *pubsub.PubSub
+	log zerolog.Logger
+
+	mu       sync.Mutex
+	regions  map[string]supply.Region
+	topics   map[string]*pubsub.Topic
+	subs     map[string]*pubsub.Subscription
+	listings map[string]map[peer.ID]Listing
+	capacity uint64
+}
+
+// NewMarket creates a new Market and joins the market topics of the given regions
+func NewMarket(ctx context.Context, h host.Host, ps *pubsub.PubSub, regions []supply.Region, log zerolog.Logger) (*Market, error) {
+	m := &Market{
+		h:        h,
+		ps:       ps,
+		log:      log,
+		regions:  make(map[string]supply.Region),
+		topics:   make(map[string]*pubsub.Topic),
+		subs:     make(map[string]*pubsub.Subscription),
+		listings: make(map[string]map[peer.ID]Listing),
+	}
+	for _, r := range regions {
+		if err := m.joinRegion(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// joinRegion starts collecting the listings of a region and advertising our capacity there
+func (m *Market) joinRegion(ctx context.Context, r supply.Region) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.topics[r.Name]; ok {
+		return nil
+	}
+	topic, err := m.ps.Join(fmt.Sprintf("%s/%s", MarketTopic, r.Name))
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		topic.Close()
+		return err
+	}
+	m.regions[r.Name] = r
+	m.topics[r.Name] = topic
+	m.subs[r.Name] = sub
+	go m.listingLoop(ctx, sub, r)
+	// Don't wait for the next interval to be listed in a region we join while advertising
+	if m.capacity > 0 {
+		go m.publishListing(ctx, topic, r, m.capacity)
+	}
+	return nil
+}
+
+// leaveRegion stops advertising in a region and forgets its listings
+func (m *Market) leaveRegion(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.regions, name)
+	delete(m.listings, name)
+	if sub, ok := m.subs[name]; ok {
+		sub.Cancel()
+		delete(m.subs, name)
+	}
+	if topic, ok := m.topics[name]; ok {
+		delete(m.topics, name)
+		return topic.Close()
+	}
+	return nil
+}
+
+func (m *Market) listingLoop(ctx context.Context, sub *pubsub.Subscription, r supply.Region) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == m.h.ID() {
+			continue
+		}
+		if err := m.addListing(r.Name, msg.Data); err != nil {
+			m.log.Debug().Err(err).Str("peer", msg.ReceivedFrom.String()).Msg("dropping listing")
+		}
+	}
+}
+
+// addListing decodes and verifies a listing published in a region before recording it
+func (m *Market) addListing(region string, data []byte) error {
+	var l Listing
+	if err := l.UnmarshalCBOR(bytes.NewReader(data)); err != nil {
+		return err
+	}
+	if l.Region != region {
+		return fmt.Errorf("listing for region %s published in %s", l.Region, region)
+	}
+	// Providers can only publish listings for themselves
+	if err := l.Verify(m.h.Peerstore().PubKey(l.Provider)); err != nil {
+		return err
+	}
+	if l.Expired(time.Now()) {
+		return ErrListingExpired
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.listings[region] == nil {
+		m.listings[region] = make(map[peer.ID]Listing)
+	}
+	m.listings[region][l.Provider] = l
+	return nil
+}
+
+// Advertise publishes our capacity in all our regions at regular intervals until the context is cancelled.
+// The price is the region minimum price per byte.
+func (m *Market) Advertise(ctx context.Context, capacity uint64) {
+	m.mu.Lock()
+	m.capacity = capacity
+	m.mu.Unlock()
+
+	publish := func() {
+		// Copy the regions as we may join or leave some while publishing
+		m.mu.Lock()
+		capacity := m.capacity
+		regions := make([]supply.Region, 0, len(m.regions))
+		topics := make(map[string]*pubsub.Topic, len(m.topics))
+		for name, r := range m.regions {
+			regions = append(regions, r)
+			topics[name] = m.topics[name]
+		}
+		m.mu.Unlock()
+		for _, r := range regions {
+			m.publishListing(ctx, topics[r.Name], r, capacity)
+		}
+	}
+	ticker := time.NewTicker(ListingInterval)
+	defer ticker.Stop()
+	publish()
+	for {
+		select {
+		case <-ticker.C:
+			publish()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// publishListing signs and publishes our listing in a region
+func (m *Market) publishListing(ctx context.Context, topic *pubsub.Topic, r supply.Region, capacity uint64) {
+	key := m.h.Peerstore().PrivKey(m.h.ID())
+	if key == nil {
+		m.log.Error().Msg("no key to sign listings")
+		return
+	}
+	l := Listing{
+		Provider:     m.h.ID(),
+		Region:       r.Name,
+		Capacity:     capacity,
+		PricePerByte: r.PPB,
+		Expiry:       uint64(time.Now().Add(ListingTTL).Unix()),
+	}
+	if err := l.Sign(key); err != nil {
+		m.log.Error().Err(err).Msg("failed to sign listing")
+		return
+	}
+	buf := new(bytes.Buffer)
+	if err := l.MarshalCBOR(buf); err != nil {
+		return
+	}
+	if err := topic.Publish(ctx, buf.Bytes()); err != nil {
+		m.log.Warn().Err(err).Str("region", r.Name).Msg("failed to publish listing")
+	}
+}
+
+// SetCapacity updates the capacity we advertise
+func (m *Market) SetCapacity(capacity uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.capacity = capacity
+}
+
+// Capacity returns the largest capacity a provider advertised in our regions or 0 if we haven't heard from them
+func (m *Market) Capacity(p peer.ID) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var capacity uint64
+	now := time.Now()
+	for _, ls := range m.listings {
+		l, ok := ls[p]
+		if !ok || l.Expired(now) {
+			continue
+		}
+		if l.Capacity > capacity {
+			capacity = l.Capacity
+		}
+	}
+	return capacity
+}
+
+// Providers returns the listings in a region matching our needs sorted by price. An empty region
+// returns listings from all our regions and a nil max price doesn't filter by price.
+func (m *Market) Providers(region string, minCapacity uint64, maxPPB abi.TokenAmount) []Listing {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Listing
+	now := time.Now()
+	for rname, ls := range m.listings {
+		for p, l := range ls {
+			if l.Expired(now) {
+				delete(ls, p)
+				continue
+			}
+			if region != "" && rname != region {
+				continue
+			}
+			if l.Capacity < minCapacity {
+				continue
+			}
+			if !maxPPB.Nil() && l.PricePerByte.GreaterThan(maxPPB) {
+				continue
+			}
+			out = append(out, l)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].PricePerByte.LessThan(out[j].PricePerByte)
+	})
+	return out
+}
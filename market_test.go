@@ -0,0 +1,116 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarketListings(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	regions := []supply.Region{supply.Regions["Global"]}
+
+	var markets []*Market
+	for i := 0; i < 2; i++ {
+		n := testutil.NewTestNode(mn, t)
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+		m, err := NewMarket(ctx, n.Host, ps, regions, zerolog.Nop())
+		require.NoError(t, err)
+		markets = append(markets, m)
+	}
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	// Wait for the gossip mesh to form
+	time.Sleep(time.Second)
+
+	go markets[0].Advertise(ctx, 4096)
+
+	require.Eventually(t, func() bool {
+		return markets[1].Capacity(markets[0].h.ID()) == 4096
+	}, 5*time.Second, 50*time.Millisecond)
+
+	ls := markets[1].Providers("Global", 1024, abi.TokenAmount{})
+	require.Len(t, ls, 1)
+	require.Equal(t, markets[0].h.ID(), ls[0].Provider)
+	require.NoError(t, ls[0].Verify(nil))
+	require.Len(t, markets[1].Providers("Global", 8192, abi.TokenAmount{}), 0)
+}
+
+func TestListingSignature(t *testing.T) {
+	mn := mocknet.New(context.Background())
+	n := testutil.NewTestNode(mn, t)
+	m := &Market{
+		h:        n.Host,
+		log:      zerolog.Nop(),
+		listings: make(map[string]map[peer.ID]Listing),
+	}
+
+	newListing := func(capacity uint64, ppb int64, expiry time.Time) (Listing, crypto.PrivKey) {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(priv)
+		require.NoError(t, err)
+		l := Listing{
+			Provider:     id,
+			Region:       "Europe",
+			Capacity:     capacity,
+			PricePerByte: big.NewInt(ppb),
+			Expiry:       uint64(expiry.Unix()),
+		}
+		require.NoError(t, l.Sign(priv))
+		return l, priv
+	}
+	encode := func(l Listing) []byte {
+		buf := new(bytes.Buffer)
+		require.NoError(t, l.MarshalCBOR(buf))
+		return buf.Bytes()
+	}
+
+	cheap, _ := newListing(2048, 1, time.Now().Add(ListingTTL))
+	pricey, _ := newListing(4096, 2, time.Now().Add(ListingTTL))
+
+	var dec Listing
+	require.NoError(t, dec.UnmarshalCBOR(bytes.NewReader(encode(cheap))))
+	require.Equal(t, cheap, dec)
+
+	require.NoError(t, m.addListing("Europe", encode(pricey)))
+	require.NoError(t, m.addListing("Europe", encode(cheap)))
+
+	// Listings can't be altered or published on behalf of another provider
+	tampered := cheap
+	tampered.Capacity = 1 << 40
+	require.Equal(t, ErrInvalidListingSignature, m.addListing("Europe", encode(tampered)))
+	spoofed, _ := newListing(8192, 1, time.Now().Add(ListingTTL))
+	spoofed.Provider = pricey.Provider
+	require.Equal(t, ErrInvalidListingSignature, m.addListing("Europe", encode(spoofed)))
+	unsigned := cheap
+	unsigned.Signature = nil
+	require.Equal(t, ErrInvalidListingSignature, m.addListing("Europe", encode(unsigned)))
+
+	expired, _ := newListing(8192, 1, time.Now().Add(-time.Second))
+	require.Equal(t, ErrListingExpired, m.addListing("Europe", encode(expired)))
+	require.Error(t, m.addListing("Asia", encode(cheap)))
+
+	require.Equal(t, []Listing{cheap, pricey}, m.Providers("", 0, abi.TokenAmount{}))
+	require.Equal(t, []Listing{cheap}, m.Providers("Europe", 0, big.NewInt(1)))
+	require.Equal(t, []Listing{pricey}, m.Providers("Europe", 4096, abi.TokenAmount{}))
+	require.Equal(t, uint64(4096), m.Capacity(pricey.Provider))
+	require.Equal(t, uint64(0), m.Capacity(expired.Provider))
+}
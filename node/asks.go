@@ -0,0 +1,102 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/retrieval"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// buildAsk applies the terms of the args to the ask currently applying to the target: its own ask, else
+// the default ask, else the default payment terms without price
+func buildAsk(asks *retrieval.Asks, args *AskArgs) (retrieval.Ask, error) {
+	ask, err := asks.Get(args.Target)
+	if errors.Is(err, retrieval.ErrAskNotFound) {
+		ask, err = asks.Get(retrieval.AskTargetDefault)
+	}
+	if errors.Is(err, retrieval.ErrAskNotFound) {
+		ask, err = retrieval.Ask{
+			PaymentInterval:         deal.DefaultPaymentInterval,
+			PaymentIntervalIncrease: deal.DefaultPaymentIntervalIncrease,
+		}, nil
+	}
+	if err != nil {
+		return ask, err
+	}
+	if args.PricePerByte != "" {
+		f, err := filecoin.ParseFIL(args.PricePerByte)
+		if err != nil {
+			return ask, fmt.Errorf("invalid price per byte: %w", err)
+		}
+		ask.PricePerByte = abi.TokenAmount(f)
+	}
+	if args.UnsealPrice != "" {
+		f, err := filecoin.ParseFIL(args.UnsealPrice)
+		if err != nil {
+			return ask, fmt.Errorf("invalid unseal price: %w", err)
+		}
+		ask.UnsealPrice = abi.TokenAmount(f)
+	}
+	if args.PaymentInterval > 0 {
+		ask.PaymentInterval = args.PaymentInterval
+	}
+	if args.PaymentIntervalIncrease > 0 {
+		ask.PaymentIntervalIncrease = args.PaymentIntervalIncrease
+	}
+	return ask, nil
+}
+
+// formatAsk converts an ask into an entry with prices in FIL
+func formatAsk(e retrieval.AskEntry) AskEntry {
+	entry := AskEntry{
+		Target:                  e.Target,
+		PricePerByte:            filecoin.FIL(e.Ask.PricePerByte).Short(),
+		UnsealPrice:             "0",
+		PaymentInterval:         e.Ask.PaymentInterval,
+		PaymentIntervalIncrease: e.Ask.PaymentIntervalIncrease,
+	}
+	if !e.Ask.UnsealPrice.Nil() {
+		entry.UnsealPrice = filecoin.FIL(e.Ask.UnsealPrice).Short()
+	}
+	return entry
+}
+
+// Ask sets or removes the price we offer for a target then sends all our asks
+func (nd *node) Ask(ctx context.Context, args *AskArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			AskResult: &AskResult{
+				Err: err.Error(),
+			}})
+	}
+	asks := nd.exch.Retrieval().Provider().Asks()
+	switch {
+	case args.Set && args.Remove:
+		sendErr(errors.New("cannot set and remove an ask at once"))
+		return
+	case args.Set:
+		ask, err := buildAsk(asks, args)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		if err := asks.Set(args.Target, ask); err != nil {
+			sendErr(err)
+			return
+		}
+	case args.Remove:
+		if err := asks.Remove(args.Target); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	res := &AskResult{}
+	for _, e := range asks.List() {
+		res.Asks = append(res.Asks, formatAsk(e))
+	}
+	nd.send(ctx, Notify{AskResult: res})
+}
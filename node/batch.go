@@ -0,0 +1,196 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/filecoin"
+)
+
+// DefaultBatchWorkers is how many contents of a batch we retrieve at once when none is given
+const DefaultBatchWorkers = 4
+
+// ErrBudgetExceeded is returned for the contents of a batch we cannot retrieve without going over its
+// price or bandwidth budget
+var ErrBudgetExceeded = errors.New("batch budget exceeded")
+
+// batchBudget is the price and bandwidth a batch of retrievals can use. Zero limits are unbounded.
+type batchBudget struct {
+	mu       sync.Mutex
+	maxSpend abi.TokenAmount
+	maxBytes uint64
+	spent    abi.TokenAmount
+	bytes    uint64
+}
+
+func newBatchBudget(maxSpend abi.TokenAmount, maxBytes uint64) *batchBudget {
+	return &batchBudget{
+		maxSpend: maxSpend,
+		maxBytes: maxBytes,
+		spent:    big.Zero(),
+	}
+}
+
+// reserve counts a retrieval against the budget unless it would go over it
+func (b *batchBudget) reserve(price abi.TokenAmount, size uint64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	spent := big.Add(b.spent, price)
+	if !b.maxSpend.Nil() && !b.maxSpend.IsZero() && spent.GreaterThan(b.maxSpend) {
+		return ErrBudgetExceeded
+	}
+	if b.maxBytes > 0 && b.bytes+size > b.maxBytes {
+		return ErrBudgetExceeded
+	}
+	b.spent = spent
+	b.bytes += size
+	return nil
+}
+
+// release gives back the budget reserved for a retrieval which failed
+func (b *batchBudget) release(price abi.TokenAmount, size uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.spent = big.Sub(b.spent, price)
+	b.bytes -= size
+}
+
+// totals returns what the completed retrievals spent and how many bytes they transferred
+func (b *batchBudget) totals() (abi.TokenAmount, uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.spent, b.bytes
+}
+
+// batch is shared by the retrievals of a BatchGet
+type batch struct {
+	group  *pop.Group
+	budget *batchBudget
+}
+
+// BatchGet retrieves many contents as a single session sharing providers, payment channels and a
+// price and bandwidth budget. It sends a result for each content as it completes then the totals.
+func (nd *node) BatchGet(ctx context.Context, args *BatchGetArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			BatchGetResult: &BatchGetResult{
+				Err: err.Error(),
+			}})
+	}
+	if len(args.Refs) == 0 {
+		sendErr(errors.New("no content to retrieve"))
+		return
+	}
+	var maxSpend abi.TokenAmount
+	if args.MaxSpend != "" {
+		f, err := filecoin.ParseFIL(args.MaxSpend)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		maxSpend = abi.TokenAmount(f)
+	}
+	if args.Timeout == 0 {
+		args.Timeout = DefaultGetTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(args.Timeout)*time.Minute)
+	defer cancel()
+
+	b := &batch{budget: newBatchBudget(maxSpend, args.MaxBytes)}
+	if args.Group != "" {
+		b.group = nd.group(args.Group)
+	} else {
+		b.group = nd.exch.NewGroup()
+		defer b.group.Close()
+	}
+
+	workers := args.Workers
+	if workers <= 0 {
+		workers = DefaultBatchWorkers
+	}
+	refs := make(chan string)
+	items := make(chan BatchItem)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ref := range refs {
+				items <- nd.batchGet(ctx, b, ref, args)
+			}
+		}()
+	}
+	go func() {
+		defer close(refs)
+		for _, ref := range args.Refs {
+			select {
+			case refs <- ref:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(items)
+	}()
+
+	res := &BatchGetResult{}
+	for item := range items {
+		item := item
+		if item.Err == "" {
+			res.Completed++
+		}
+		nd.send(ctx, Notify{BatchGetResult: &BatchGetResult{Item: &item}})
+	}
+	// Including the contents we didn't get to before the timeout
+	res.Failed = len(args.Refs) - res.Completed
+	spent, bytes := b.budget.totals()
+	res.TotalSpent = filecoin.FIL(spent).Short()
+	res.TotalBytes = filecoin.SizeStr(filecoin.NewInt(bytes))
+	res.Done = true
+	nd.send(ctx, Notify{BatchGetResult: res})
+}
+
+// batchGet retrieves a content of a batch and returns how it went
+func (nd *node) batchGet(ctx context.Context, b *batch, ref string, args *BatchGetArgs) BatchItem {
+	item := BatchItem{Ref: ref}
+	gargs := &GetArgs{
+		Cid:       ref,
+		Sel:       args.Sel,
+		Timeout:   args.Timeout,
+		Providers: args.Providers,
+		batch:     b,
+	}
+	if args.Out != "" {
+		gargs.Out = filepath.Join(args.Out, filepath.FromSlash(strings.TrimPrefix(ref, "/")))
+		if err := os.MkdirAll(filepath.Dir(gargs.Out), 0755); err != nil {
+			item.Err = err.Error()
+			return item
+		}
+	}
+	nd.Get(withNotify(ctx, func(no Notify) {
+		gr := no.GetResult
+		if gr == nil {
+			return
+		}
+		if gr.Err != "" && item.Err == "" {
+			item.Err = gr.Err
+		}
+		if gr.DealID != "" {
+			item.DealID = gr.DealID
+			item.TotalPrice = gr.TotalPrice
+			item.Size = gr.PieceSize
+		}
+		item.Local = item.Local || gr.Local
+	}), gargs)
+	return item
+}
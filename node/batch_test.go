@@ -0,0 +1,71 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchBudget(t *testing.T) {
+	b := newBatchBudget(abi.NewTokenAmount(100), 1000)
+	require.NoError(t, b.reserve(abi.NewTokenAmount(60), 400))
+	require.Equal(t, ErrBudgetExceeded, b.reserve(abi.NewTokenAmount(50), 100))
+	require.Equal(t, ErrBudgetExceeded, b.reserve(abi.NewTokenAmount(10), 700))
+	require.NoError(t, b.reserve(abi.NewTokenAmount(40), 600))
+
+	b.release(abi.NewTokenAmount(40), 600)
+	spent, bytes := b.totals()
+	require.Equal(t, abi.NewTokenAmount(60), spent)
+	require.Equal(t, uint64(400), bytes)
+
+	// Without limits we only keep count
+	b = newBatchBudget(abi.TokenAmount{}, 0)
+	require.NoError(t, b.reserve(abi.NewTokenAmount(1e9), 1<<40))
+}
+
+func TestBatchGet(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data.txt"), []byte("batch me"), 0666))
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	require.NoError(t, err)
+	_, err = wd.Add(ctx, AddOptions{Path: filepath.Join(dir, "data.txt"), ChunkSize: 1024})
+	require.NoError(t, err)
+	ref, err := wd.Commit(ctx, CommitOptions{})
+	require.NoError(t, err)
+	require.NoError(t, nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID))
+
+	var items []BatchItem
+	var res *BatchGetResult
+	nd.BatchGet(withNotify(ctx, func(no Notify) {
+		br := no.BatchGetResult
+		require.NotNil(t, br)
+		if br.Item != nil {
+			items = append(items, *br.Item)
+			return
+		}
+		res = br
+	}), &BatchGetArgs{
+		Refs:    []string{ref.PayloadCID.String(), "unknown-publication"},
+		Workers: 1,
+	})
+
+	require.Len(t, items, 2)
+	require.Equal(t, ref.PayloadCID.String(), items[0].Ref)
+	require.True(t, items[0].Local)
+	require.Empty(t, items[0].Err)
+	require.Equal(t, "unknown-publication", items[1].Ref)
+	require.NotEmpty(t, items[1].Err)
+
+	require.True(t, res.Done)
+	require.Equal(t, 1, res.Completed)
+	require.Equal(t, 1, res.Failed)
+}
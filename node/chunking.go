@@ -0,0 +1,336 @@
+package node
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	files "github.com/ipfs/go-ipfs-files"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+)
+
+// KAdds is the datastore key under which the progress of the files being added is persisted
+const KAdds = "adds"
+
+// addCheckpointBytes is how many bytes of a file we chunk between two saves of the progress
+const addCheckpointBytes = 32 << 20
+
+// chunkLink links to a block of a file we chunked
+type chunkLink struct {
+	Cid cid.Cid
+	// Size is the size of the block and its descendants
+	Size uint64
+	// FileSize is the number of bytes of the file under the link
+	FileSize uint64
+}
+
+// addProgress is persisted while a file is chunked. The links to the chunks stored so far are
+// persisted in segments of one checkpoint each so saving the progress doesn't get slower as it grows.
+type addProgress struct {
+	Path      string
+	Size      int64
+	ModTime   time.Time
+	ChunkSize int64
+	Chunker   string
+	Prefix    cid.Prefix
+	RawLeaves bool
+	// Offset is the number of bytes of the file stored in the chunks
+	Offset   int64
+	Segments int
+}
+
+// resumes tells if the progress was saved by an add of the same version of a file with the same options
+func (p addProgress) resumes(o addProgress) bool {
+	return p.Path == o.Path &&
+		p.Size == o.Size &&
+		p.ModTime.Equal(o.ModTime) &&
+		p.ChunkSize == o.ChunkSize &&
+		p.Chunker == o.Chunker &&
+		p.Prefix == o.Prefix &&
+		p.RawLeaves == o.RawLeaves
+}
+
+// addKey is where the progress of adding a file to the workdag is persisted
+func (w *Workdag) addKey(path string) (datastore.Key, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return datastore.Key{}, err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return datastore.NewKey(KAdds).ChildString(w.name).ChildString(hex.EncodeToString(sum[:16])), nil
+}
+
+func (w *Workdag) loadAddProgress(key datastore.Key) (*addProgress, []chunkLink, error) {
+	b, err := w.ds.Get(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var p addProgress
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, nil, err
+	}
+	var links []chunkLink
+	for i := 0; i < p.Segments; i++ {
+		b, err := w.ds.Get(key.ChildString(strconv.Itoa(i)))
+		if err != nil {
+			return nil, nil, err
+		}
+		var seg []chunkLink
+		if err := json.Unmarshal(b, &seg); err != nil {
+			return nil, nil, err
+		}
+		links = append(links, seg...)
+	}
+	return &p, links, nil
+}
+
+// saveAddProgress persists the links of the chunks stored since the last save along with the new offset
+func (w *Workdag) saveAddProgress(key datastore.Key, p *addProgress, seg []chunkLink) error {
+	batch, err := w.ds.Batch()
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(seg)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(key.ChildString(strconv.Itoa(p.Segments)), b); err != nil {
+		return err
+	}
+	next := *p
+	next.Segments++
+	b, err = json.Marshal(next)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(key, b); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	*p = next
+	return nil
+}
+
+func (w *Workdag) clearAddProgress(key datastore.Key, segments int) error {
+	for i := 0; i < segments; i++ {
+		if err := w.ds.Delete(key.ChildString(strconv.Itoa(i))); err != nil {
+			return err
+		}
+	}
+	return w.ds.Delete(key)
+}
+
+// resumeAdd returns the chunks stored by an interrupted add of the same file and sets the offset to
+// continue from. The progress is discarded if the file changed or the chunks are no longer in our store.
+func (w *Workdag) resumeAdd(key datastore.Key, p *addProgress) ([]chunkLink, error) {
+	saved, links, err := w.loadAddProgress(key)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if saved.resumes(*p) {
+		stored := true
+		for _, l := range links {
+			if has, err := w.store.Bstore.Has(l.Cid); err != nil || !has {
+				stored = false
+				break
+			}
+		}
+		if stored {
+			*p = *saved
+			return links, nil
+		}
+	}
+	return nil, w.clearAddProgress(key, saved.Segments)
+}
+
+// chunkFile stores the chunks of a file and links them in the balanced layout of go-unixfs. The progress
+// is saved every few chunks so the add resumes from the last save if it is interrupted.
+func (w *Workdag) chunkFile(ctx context.Context, f files.File, opts AddOptions, params helpers.DagBuilderParams) (cid.Cid, error) {
+	st, err := os.Stat(opts.Path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	prefix, err := opts.prefix(cid.DagProtobuf)
+	if err != nil {
+		return cid.Undef, err
+	}
+	key, err := w.addKey(opts.Path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	p := addProgress{
+		Path:      opts.Path,
+		Size:      st.Size(),
+		ModTime:   st.ModTime(),
+		ChunkSize: opts.ChunkSize,
+		Chunker:   opts.Chunker,
+		Prefix:    prefix,
+		RawLeaves: params.RawLeaves,
+	}
+	links, err := w.resumeAdd(key, &p)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if p.Offset > 0 {
+		if _, err := f.Seek(p.Offset, io.SeekStart); err != nil {
+			return cid.Undef, err
+		}
+	}
+	progress := opts.Progress
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	progress(p.Offset, p.Size)
+
+	checkpoint := opts.checkpointBytes
+	if checkpoint == 0 {
+		checkpoint = addCheckpointBytes
+	}
+
+	// Chunkers start over at each cut so resuming from the end of a chunk cuts the file the same way
+	spl, err := opts.splitter(f)
+	if err != nil {
+		return cid.Undef, err
+	}
+	params.Dagserv = w.store.DAG
+	db, err := params.New(spl)
+	if err != nil {
+		return cid.Undef, err
+	}
+	buf := ipldformat.NewBufferedDAG(ctx, w.store.DAG)
+	var (
+		seg      []chunkLink
+		segBytes int64
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			return cid.Undef, err
+		}
+		data, err := spl.NextBytes()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return cid.Undef, err
+		}
+		l, err := addChunk(ctx, buf, db, data)
+		if err != nil {
+			return cid.Undef, err
+		}
+		seg = append(seg, l)
+		segBytes += int64(len(data))
+		if segBytes < checkpoint {
+			continue
+		}
+		// The chunks must be in the store before the progress says so
+		if err := buf.Commit(); err != nil {
+			return cid.Undef, err
+		}
+		buf = ipldformat.NewBufferedDAG(ctx, w.store.DAG)
+		p.Offset += segBytes
+		if err := w.saveAddProgress(key, &p, seg); err != nil {
+			return cid.Undef, err
+		}
+		links = append(links, seg...)
+		seg, segBytes = nil, 0
+		progress(p.Offset, p.Size)
+	}
+	links = append(links, seg...)
+	// Empty files are a single empty leaf
+	if len(links) == 0 {
+		l, err := addChunk(ctx, buf, db, nil)
+		if err != nil {
+			return cid.Undef, err
+		}
+		links = append(links, l)
+	}
+	root, err := linkChunks(ctx, buf, links, params.Maxlinks, prefix)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := buf.Commit(); err != nil {
+		return cid.Undef, err
+	}
+	progress(p.Size, p.Size)
+	return root, w.clearAddProgress(key, p.Segments)
+}
+
+// addChunk stores a leaf of a file
+func addChunk(ctx context.Context, dag ipldformat.DAGService, db *helpers.DagBuilderHelper, data []byte) (chunkLink, error) {
+	nd, err := db.NewLeafNode(data, unixfs.TFile)
+	if err != nil {
+		return chunkLink{}, err
+	}
+	if err := dag.Add(ctx, nd); err != nil {
+		return chunkLink{}, err
+	}
+	size, err := nd.Size()
+	if err != nil {
+		return chunkLink{}, err
+	}
+	return chunkLink{Cid: nd.Cid(), Size: size, FileSize: uint64(len(data))}, nil
+}
+
+// linkChunks links the leaves of a file level by level. Filling each node with maxlinks children from the
+// left yields the same DAG as the balanced layout of go-unixfs which we cannot resume.
+func linkChunks(ctx context.Context, dag ipldformat.DAGService, links []chunkLink, maxlinks int, prefix cid.Builder) (cid.Cid, error) {
+	for len(links) > 1 {
+		parents := make([]chunkLink, 0, (len(links)+maxlinks-1)/maxlinks)
+		for i := 0; i < len(links); i += maxlinks {
+			end := i + maxlinks
+			if end > len(links) {
+				end = len(links)
+			}
+			p, err := linkChunk(ctx, dag, links[i:end], prefix)
+			if err != nil {
+				return cid.Undef, err
+			}
+			parents = append(parents, p)
+		}
+		links = parents
+	}
+	return links[0].Cid, nil
+}
+
+// linkChunk stores a UnixFS file node linking to the given children
+func linkChunk(ctx context.Context, dag ipldformat.DAGService, children []chunkLink, prefix cid.Builder) (chunkLink, error) {
+	nd := new(merkledag.ProtoNode)
+	nd.SetCidBuilder(prefix)
+	fsn := unixfs.NewFSNode(unixfs.TFile)
+	for _, c := range children {
+		if err := nd.AddRawLink("", &ipldformat.Link{Cid: c.Cid, Size: c.Size}); err != nil {
+			return chunkLink{}, err
+		}
+		fsn.AddBlockSize(c.FileSize)
+	}
+	data, err := fsn.GetBytes()
+	if err != nil {
+		return chunkLink{}, err
+	}
+	nd.SetData(data)
+	if err := dag.Add(ctx, nd); err != nil {
+		return chunkLink{}, err
+	}
+	size, err := nd.Size()
+	if err != nil {
+		return chunkLink{}, err
+	}
+	return chunkLink{Cid: nd.Cid(), Size: size, FileSize: fsn.FileSize()}, nil
+}
@@ -0,0 +1,148 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	chunk "github.com/ipfs/go-ipfs-chunker"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipfs/go-unixfs/importer/balanced"
+	"github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinkChunks(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	prefix, err := merkledag.PrefixForCidVersion(1)
+	require.NoError(t, err)
+	params := helpers.DagBuilderParams{
+		Maxlinks:   3,
+		RawLeaves:  true,
+		CidBuilder: prefix,
+		Dagserv:    wd.Store().DAG,
+	}
+	// Files filling the layout exactly or overflowing each depth by a chunk
+	for _, chunks := range []int{0, 1, 2, 3, 4, 9, 10, 27, 28} {
+		data := make([]byte, chunks*16)
+		rand.New(rand.NewSource(int64(chunks))).Read(data)
+
+		db, err := params.New(chunk.NewSizeSplitter(bytes.NewReader(data), 16))
+		require.NoError(t, err)
+		expected, err := balanced.Layout(db)
+		require.NoError(t, err)
+
+		spl := chunk.NewSizeSplitter(bytes.NewReader(data), 16)
+		db, err = params.New(spl)
+		require.NoError(t, err)
+		var links []chunkLink
+		for {
+			b, err := spl.NextBytes()
+			if err != nil {
+				break
+			}
+			l, err := addChunk(ctx, wd.Store().DAG, db, b)
+			require.NoError(t, err)
+			links = append(links, l)
+		}
+		if len(links) == 0 {
+			l, err := addChunk(ctx, wd.Store().DAG, db, nil)
+			require.NoError(t, err)
+			links = append(links, l)
+		}
+		root, err := linkChunks(ctx, wd.Store().DAG, links, params.Maxlinks, prefix)
+		require.NoError(t, err)
+		require.Equal(t, expected.Cid(), root, "%d chunks", chunks)
+	}
+}
+
+func TestResumeAdd(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	data := make([]byte, 64<<10)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	p := filepath.Join(t.TempDir(), "large")
+	require.NoError(t, ioutil.WriteFile(p, data, 0666))
+
+	expected, err := wd.Add(ctx, AddOptions{Path: p, ChunkSize: 1024})
+	require.NoError(t, err)
+
+	opts := AddOptions{Path: p, ChunkSize: 1024, Resumable: true, checkpointBytes: 8 << 10}
+	// interrupt stops the add once the given bytes are saved
+	interrupt := func(at int64) {
+		cctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		o := opts
+		o.Progress = func(done, total int64) {
+			require.Equal(t, int64(len(data)), total)
+			if done >= at {
+				cancel()
+			}
+		}
+		_, err := wd.Add(cctx, o)
+		require.True(t, errors.Is(err, context.Canceled))
+	}
+
+	interrupt(16 << 10)
+	key, err := wd.addKey(p)
+	require.NoError(t, err)
+	saved, links, err := wd.loadAddProgress(key)
+	require.NoError(t, err)
+	require.Equal(t, int64(16<<10), saved.Offset)
+	require.Len(t, links, 16)
+
+	// Adding the file again continues from the last save
+	var started []int64
+	o := opts
+	o.Progress = func(done, total int64) {
+		started = append(started, done)
+	}
+	root, err := wd.Add(ctx, o)
+	require.NoError(t, err)
+	require.Equal(t, expected, root)
+	require.Equal(t, int64(16<<10), started[0])
+	require.Equal(t, int64(len(data)), started[len(started)-1])
+
+	_, _, err = wd.loadAddProgress(key)
+	require.True(t, errors.Is(err, datastore.ErrNotFound))
+
+	// The progress is discarded when the file changes
+	interrupt(8 << 10)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	require.NoError(t, ioutil.WriteFile(p, data, 0666))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(p, later, later))
+
+	started = nil
+	root, err = wd.Add(ctx, o)
+	require.NoError(t, err)
+	require.NotEqual(t, expected, root)
+	require.Equal(t, int64(0), started[0])
+
+	status, err := wd.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.Equal(t, root, status[0].Cid)
+}
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ipfs/go-cid"
+	"github.com/rs/zerolog/log"
+)
+
+// delegatedRoutingPrefix is the path of the provider lookups of the delegated routing HTTP API
+const delegatedRoutingPrefix = "/routing/v1/providers/"
+
+// ndjsonMediaType streams one provider record per line to the clients accepting it
+const ndjsonMediaType = "application/x-ndjson"
+
+// transferProtocol is how IPFS clients can retrieve from our caches: graphsync with go-data-transfer
+const transferProtocol = "transport-graphsync-filecoinv1"
+
+// ProviderRecord is a provider of a content in the peer schema of the delegated routing HTTP API
+type ProviderRecord struct {
+	Schema    string
+	ID        string
+	Addrs     []string
+	Protocols []string
+}
+
+// ProvidersResponse is the answer to a provider lookup of the delegated routing HTTP API
+type ProvidersResponse struct {
+	Providers []ProviderRecord
+}
+
+// delegatedRoutingHandler answers the provider lookups of the delegated routing HTTP API from the
+// providers we already know in our regions so IPFS clients configured with it discover our caches
+func (nd *node) delegatedRoutingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		root, err := cid.Decode(strings.TrimPrefix(r.URL.Path, delegatedRoutingPrefix))
+		if err != nil {
+			http.Error(w, "invalid cid: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		var records []ProviderRecord
+		for _, info := range nd.exch.KnownProviders(root) {
+			rec := ProviderRecord{
+				Schema:    "peer",
+				ID:        info.ID.String(),
+				Protocols: []string{transferProtocol},
+			}
+			for _, a := range info.Addrs {
+				rec.Addrs = append(rec.Addrs, a.String())
+			}
+			records = append(records, rec)
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Add("Vary", "Accept")
+		if len(records) == 0 {
+			// Clients should ask again soon as caches may pull the content any time
+			h.Set("Cache-Control", "public, max-age=15")
+			http.Error(w, "no providers found", http.StatusNotFound)
+			return
+		}
+		h.Set("Cache-Control", "public, max-age=300")
+		stream := strings.Contains(r.Header.Get("Accept"), ndjsonMediaType)
+		if stream {
+			h.Set("Content-Type", ndjsonMediaType)
+		} else {
+			h.Set("Content-Type", "application/json")
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		enc := json.NewEncoder(w)
+		if stream {
+			for _, rec := range records {
+				if err := enc.Encode(rec); err != nil {
+					return
+				}
+			}
+			return
+		}
+		if err := enc.Encode(ProvidersResponse{Providers: records}); err != nil {
+			log.Debug().Err(err).Msg("failed to write providers")
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package node
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedRouting(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data.txt"), []byte("route me"), 0666))
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	require.NoError(t, err)
+	_, err = wd.Add(ctx, AddOptions{Path: filepath.Join(dir, "data.txt"), ChunkSize: 1024})
+	require.NoError(t, err)
+	ref, err := wd.Commit(ctx, CommitOptions{})
+	require.NoError(t, err)
+	require.NoError(t, nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID))
+
+	srv := httptest.NewServer(nd.delegatedRoutingHandler())
+	defer srv.Close()
+	url := srv.URL + delegatedRoutingPrefix + ref.PayloadCID.String()
+
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "application/json", res.Header.Get("Content-Type"))
+	var pr ProvidersResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&pr))
+	require.Len(t, pr.Providers, 1)
+	require.Equal(t, "peer", pr.Providers[0].Schema)
+	require.Equal(t, nd.host.ID().String(), pr.Providers[0].ID)
+	require.NotEmpty(t, pr.Providers[0].Addrs)
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/x-ndjson")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, ndjsonMediaType, res.Header.Get("Content-Type"))
+	s := bufio.NewScanner(res.Body)
+	require.True(t, s.Scan())
+	var rec ProviderRecord
+	require.NoError(t, json.Unmarshal(s.Bytes(), &rec))
+	require.Equal(t, nd.host.ID().String(), rec.ID)
+	require.False(t, s.Scan())
+
+	gen := blocksutil.NewBlockGenerator()
+	unknown := gen.Next().Cid()
+	res, err = http.Get(srv.URL + delegatedRoutingPrefix + unknown.String())
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(srv.URL + delegatedRoutingPrefix + "notacid")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,284 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-datastore/query"
+	badgerds "github.com/ipfs/go-ds-badger"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/wallet"
+)
+
+// MaxClockSkew is the maximum difference we tolerate between our clock and the Filecoin chain head
+// timestamp. Blocks are produced every 30 seconds so the head is usually behind by less than a minute.
+const MaxClockSkew = 2 * time.Minute
+
+// Diagnosis is the result of a single health check
+type Diagnosis struct {
+	Check string
+	Ok    bool
+	// Skipped is true when the check could not run with the current configuration
+	Skipped bool
+	Message string
+	// Fix is an actionable suggestion when the check failed
+	Fix string
+}
+
+// DoctorOptions configures the resources checked by Doctor
+type DoctorOptions struct {
+	RepoPath string
+	// SocketPath is the unix socket of the daemon, empty if it listens on the local tcp port
+	SocketPath     string
+	BootstrapPeers []string
+	FilEndpoint    string
+	FilToken       string
+	// Timeout bounds each network check. Defaults to 10 seconds.
+	Timeout time.Duration
+}
+
+// Doctor checks the health of a repo and its network dependencies. It runs without a daemon
+// so it can help troubleshoot a node failing to start.
+func Doctor(ctx context.Context, opts DoctorOptions) []Diagnosis {
+	if opts.Timeout == 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	repo := checkRepo(opts.RepoPath)
+	if !repo.Ok {
+		// Other checks depend on the repo
+		return []Diagnosis{repo}
+	}
+	diags := []Diagnosis{
+		repo,
+		checkDatastore(opts.RepoPath, opts.SocketPath),
+		checkKeystore(opts.RepoPath),
+	}
+	diags = append(diags, checkFilecoin(ctx, opts)...)
+	return append(diags, checkBootstrap(ctx, opts))
+}
+
+func checkRepo(path string) Diagnosis {
+	d := Diagnosis{Check: "repo"}
+	st, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		d.Message = fmt.Sprintf("no repo at %s", path)
+		d.Fix = "run 'pop start' to initialize a repo or set $POP_PATH to an existing one"
+		return d
+	}
+	if err != nil {
+		d.Message = err.Error()
+		return d
+	}
+	if !st.IsDir() {
+		d.Message = fmt.Sprintf("%s is not a directory", path)
+		d.Fix = "move the file away and run 'pop start' to initialize a repo"
+		return d
+	}
+	f, err := ioutil.TempFile(path, ".doctor")
+	if err != nil {
+		d.Message = fmt.Sprintf("repo is not writable: %v", err)
+		d.Fix = fmt.Sprintf("make sure your user owns the repo: chown -R $USER %s", path)
+		return d
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	if st.Mode().Perm()&0002 != 0 {
+		d.Message = "repo is writable by all users"
+		d.Fix = fmt.Sprintf("chmod o-w %s", path)
+		return d
+	}
+	if _, err := os.Stat(filepath.Join(path, "PopConfig.json")); err != nil {
+		d.Message = "missing PopConfig.json"
+		d.Fix = "run 'pop start' to generate a default config"
+		return d
+	}
+	d.Ok = true
+	d.Message = path
+	return d
+}
+
+func checkDatastore(path, socket string) Diagnosis {
+	d := Diagnosis{Check: "datastore"}
+
+	dsopts := badgerds.DefaultOptions
+	dsopts.ReadOnly = true
+
+	ds, err := badgerds.NewDatastore(filepath.Join(path, "datastore"), &dsopts)
+	if err != nil {
+		// The running daemon holds the datastore lock
+		if c, cerr := SocketConnect(socket); cerr == nil {
+			c.Close()
+			d.Skipped = true
+			d.Message = "datastore in use by the running daemon"
+			d.Fix = "stop the daemon to check the datastore integrity"
+			return d
+		}
+		d.Message = fmt.Sprintf("failed to open datastore: %v", err)
+		d.Fix = "restart the daemon once to repair the datastore or remove stale LOCK files in the datastore directory"
+		return d
+	}
+	defer ds.Close()
+
+	res, err := ds.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		d.Message = fmt.Sprintf("failed to query datastore: %v", err)
+		return d
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		d.Message = fmt.Sprintf("failed to read datastore: %v", err)
+		d.Fix = "the datastore may be corrupted, back up your keystore and initialize a new repo"
+		return d
+	}
+	d.Ok = true
+	d.Message = fmt.Sprintf("%d keys", len(entries))
+	return d
+}
+
+func checkKeystore(path string) Diagnosis {
+	d := Diagnosis{Check: "keys"}
+	kspath := filepath.Join(path, "keystore")
+	st, err := os.Stat(kspath)
+	if os.IsNotExist(err) {
+		d.Message = "no keystore"
+		d.Fix = "run 'pop start' to generate keys"
+		return d
+	}
+	if err != nil {
+		d.Message = err.Error()
+		return d
+	}
+	if st.Mode().Perm()&0077 != 0 {
+		d.Message = "keystore is accessible by other users"
+		d.Fix = fmt.Sprintf("chmod 700 %s", kspath)
+		return d
+	}
+	ks, err := keystore.NewFSKeystore(kspath)
+	if err != nil {
+		d.Message = err.Error()
+		return d
+	}
+	var missing []string
+	if ok, err := ks.Has(KLibp2pHost); err != nil || !ok {
+		missing = append(missing, "peer identity")
+	}
+	if ok, err := ks.Has(wallet.KDefault); err != nil || !ok {
+		missing = append(missing, "default wallet address")
+	}
+	if len(missing) > 0 {
+		d.Message = fmt.Sprintf("missing %s", strings.Join(missing, " and "))
+		d.Fix = "restart with 'pop start --privkey <path>' to import a key, a new identity is generated on start"
+		return d
+	}
+	d.Ok = true
+	d.Message = "peer identity and default wallet address found"
+	return d
+}
+
+func checkFilecoin(ctx context.Context, opts DoctorOptions) []Diagnosis {
+	api := Diagnosis{Check: "filecoin api"}
+	clock := Diagnosis{Check: "clock"}
+	if opts.FilEndpoint == "" {
+		api.Skipped = true
+		api.Message = "no filecoin endpoint configured"
+		api.Fix = "set --fil-endpoint and --fil-token to enable storage deals and payments"
+		clock.Skipped = true
+		clock.Message = "needs a filecoin endpoint"
+		return []Diagnosis{api, clock}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	fapi, err := filecoin.NewLotusRPC(ctx, opts.FilEndpoint, http.Header{
+		"Authorization": []string{opts.FilToken},
+	})
+	if err != nil {
+		api.Message = fmt.Sprintf("failed to connect: %v", err)
+		api.Fix = "check --fil-endpoint is reachable"
+		clock.Skipped = true
+		clock.Message = "needs a filecoin endpoint"
+		return []Diagnosis{api, clock}
+	}
+	defer fapi.Close()
+
+	head, err := fapi.ChainHead(ctx)
+	if err != nil {
+		api.Message = fmt.Sprintf("failed to get chain head: %v", err)
+		api.Fix = "check --fil-token and --fil-token-type are valid for this endpoint"
+		clock.Skipped = true
+		clock.Message = "needs a filecoin endpoint"
+		return []Diagnosis{api, clock}
+	}
+	api.Ok = true
+	api.Message = fmt.Sprintf("chain head at height %d", head.Height())
+
+	skew := time.Since(time.Unix(int64(head.MinTimestamp()), 0))
+	if skew < -MaxClockSkew || skew > MaxClockSkew {
+		clock.Message = fmt.Sprintf("local clock is %s off the chain head", skew.Round(time.Second))
+		clock.Fix = "synchronize your system clock with NTP, payment vouchers and deal proposals depend on it"
+		return []Diagnosis{api, clock}
+	}
+	clock.Ok = true
+	clock.Message = fmt.Sprintf("%s behind the chain head", skew.Round(time.Second))
+	return []Diagnosis{api, clock}
+}
+
+func checkBootstrap(ctx context.Context, opts DoctorOptions) Diagnosis {
+	d := Diagnosis{Check: "bootstrap"}
+	if len(opts.BootstrapPeers) == 0 {
+		d.Skipped = true
+		d.Message = "no bootstrap peers configured"
+		d.Fix = "set --bootstrap to discover peers in your regions"
+		return d
+	}
+	// Use a throwaway host so we can run while the daemon is running
+	h, err := libp2p.New(ctx, libp2p.NoListenAddrs)
+	if err != nil {
+		d.Message = err.Error()
+		return d
+	}
+	defer h.Close()
+
+	var failed []string
+	for _, s := range opts.BootstrapPeers {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s, err))
+			continue
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", s, err))
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+		err = h.Connect(cctx, *info)
+		cancel()
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", info.ID, err))
+		}
+	}
+	connected := len(opts.BootstrapPeers) - len(failed)
+	d.Message = fmt.Sprintf("connected to %d/%d bootstrap peers", connected, len(opts.BootstrapPeers))
+	if len(failed) > 0 {
+		d.Message = fmt.Sprintf("%s, failed %s", d.Message, strings.Join(failed, ", "))
+	}
+	if connected == 0 {
+		d.Fix = "check your network connection and firewall or set a different --bootstrap peer"
+		return d
+	}
+	d.Ok = true
+	return d
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDoctor(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	diags := Doctor(ctx, DoctorOptions{RepoPath: filepath.Join(dir, "missing")})
+	require.Len(t, diags, 1)
+	require.False(t, diags[0].Ok)
+	require.NotEmpty(t, diags[0].Fix)
+
+	require.NoError(t, os.Chmod(dir, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "PopConfig.json"), []byte("{}"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "keystore"), 0755))
+
+	diags = Doctor(ctx, DoctorOptions{RepoPath: dir})
+	checks := make(map[string]Diagnosis)
+	for _, d := range diags {
+		checks[d.Check] = d
+	}
+	require.True(t, checks["repo"].Ok)
+	// Keys must not be readable by other users
+	require.False(t, checks["keys"].Ok)
+	require.Contains(t, checks["keys"].Fix, "chmod 700")
+	require.True(t, checks["filecoin api"].Skipped)
+	require.True(t, checks["bootstrap"].Skipped)
+
+	require.NoError(t, os.Chmod(filepath.Join(dir, "keystore"), 0700))
+	d := checkKeystore(dir)
+	require.False(t, d.Ok)
+	require.Contains(t, d.Message, "default wallet address")
+}
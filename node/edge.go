@@ -0,0 +1,71 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/myelnet/pop/edge"
+)
+
+// edgeLimits fills the zero limits with the defaults
+func edgeLimits(l edge.Limits) edge.Limits {
+	if l.MaxModuleSize == 0 {
+		l.MaxModuleSize = edge.DefaultLimits.MaxModuleSize
+	}
+	if l.MaxMemory == 0 {
+		l.MaxMemory = edge.DefaultLimits.MaxMemory
+	}
+	if l.MaxOutput == 0 {
+		l.MaxOutput = edge.DefaultLimits.MaxOutput
+	}
+	if l.Timeout == 0 {
+		l.Timeout = edge.DefaultLimits.Timeout
+	}
+	return l
+}
+
+// runEdgeFunction transforms a file we serve with the edge function packed with its content. It returns
+// nil when edge functions are disabled or the content has none.
+func (nd *node) runEdgeFunction(ctx context.Context, root cid.Cid, sid multistore.StoreID, req edge.Request, body []byte) (*edge.Response, error) {
+	if nd.edge == nil {
+		return nil, nil
+	}
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return nil, err
+	}
+	m, err := w.Manifest(ctx, root, sid)
+	if err != nil {
+		return nil, err
+	}
+	var module cid.Cid
+	for _, e := range m.Entries {
+		if e.Name == edge.ModuleName {
+			module = e.Cid
+		}
+	}
+	if !module.Defined() {
+		return nil, nil
+	}
+	n, err := w.LoadFile(ctx, module, sid)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := n.(files.File)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not a file", edge.ErrInvalidModule, edge.ModuleName)
+	}
+	defer f.Close()
+	// Read one more byte than the limit so the runner can reject modules which are too large
+	code, err := ioutil.ReadAll(io.LimitReader(f, nd.edge.Limits.MaxModuleSize+1))
+	if err != nil {
+		return nil, err
+	}
+	req.Root = root
+	return nd.edge.Run(ctx, code, req, body)
+}
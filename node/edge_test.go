@@ -0,0 +1,65 @@
+package node
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/myelnet/pop/edge"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunEdgeFunction(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+	nd := &node{ds: ds, ms: ms}
+
+	dir := t.TempDir()
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, edge.ModuleName), module, 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>page</p>"), 0666))
+
+	pack := func(names ...string) *DataRef {
+		wd, err := NewWorkdag(ms, ds)
+		require.NoError(t, err)
+		for _, name := range names {
+			_, err := wd.Add(ctx, AddOptions{Path: filepath.Join(dir, name), ChunkSize: 1024})
+			require.NoError(t, err)
+		}
+		ref, err := wd.Commit(ctx, CommitOptions{})
+		require.NoError(t, err)
+		return ref
+	}
+	withModule := pack(edge.ModuleName, "index.html")
+	withoutModule := pack("index.html")
+
+	req := edge.Request{Path: "index.html", ContentType: "text/html"}
+
+	// Edge functions are disabled by default
+	res, err := nd.runEdgeFunction(ctx, withModule.PayloadCID, withModule.StoreID, req, []byte("<p>page</p>"))
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	nd.edge, err = edge.NewRunner(edge.RuntimeFunc(func(ctx context.Context, m string, env []string, stdin io.Reader, stdout io.Writer, l edge.Limits) error {
+		io.WriteString(stdout, "X-Edge: 1\n\n")
+		_, err := io.Copy(stdout, stdin)
+		return err
+	}), t.TempDir(), edgeLimits(edge.Limits{}))
+	require.NoError(t, err)
+
+	res, err = nd.runEdgeFunction(ctx, withModule.PayloadCID, withModule.StoreID, req, []byte("<p>page</p>"))
+	require.NoError(t, err)
+	require.Equal(t, "1", res.Header.Get("X-Edge"))
+	require.Equal(t, "<p>page</p>", string(res.Body))
+
+	res, err = nd.runEdgeFunction(ctx, withoutModule.PayloadCID, withoutModule.StoreID, req, []byte("<p>page</p>"))
+	require.NoError(t, err)
+	require.Nil(t, res)
+}
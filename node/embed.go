@@ -0,0 +1,431 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop"
+)
+
+// DefaultGetTimeout is the timeout in minutes of the Get requests of embedded nodes when none is given
+const DefaultGetTimeout = 60
+
+// errNoResult is returned if a command completed without sending a result
+var errNoResult = errors.New("command returned no result")
+
+// Node is the Go API of a pop node for applications embedding it as a library instead of shelling out
+// to the CLI. Commands block until they complete and report their progress to an optional callback.
+// Commands run one at a time as they share the node notifications while block and DAG access is
+// safe to use concurrently. Canceling an add and Status don't wait for the command in progress.
+type Node struct {
+	nd *node
+	// cmu makes sure the notifications of a command only go to its caller
+	cmu sync.Mutex
+}
+
+// NewNode starts a pop node configured with the given options applied on top of DefaultOptions.
+// The node runs until the context is cancelled.
+func NewNode(ctx context.Context, options ...Option) (*Node, error) {
+	opts := DefaultOptions()
+	for _, o := range options {
+		o(&opts)
+	}
+	nd, err := New(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if nd.metrics != nil {
+		go nd.serveMetrics(ctx, opts.MetricsAddr)
+	}
+	if opts.HTTPGateway != "" {
+		go nd.serveGateway(ctx, opts.HTTPGateway)
+	}
+	if opts.RPCAddr != "" {
+		token, err := loadRPCToken(opts.RepoPath, opts.RPCToken)
+		if err != nil {
+			return nil, err
+		}
+		go nd.serveRPC(ctx, opts.RPCAddr, token)
+	}
+	return &Node{nd: nd}, nil
+}
+
+// ID returns the peer ID of the node
+func (n *Node) ID() peer.ID {
+	return n.nd.host.ID()
+}
+
+// Exchange returns the exchange for direct access to the supply, retrieval and wallet
+func (n *Node) Exchange() *pop.Exchange {
+	return n.nd.exch
+}
+
+// Blockstore returns the blockstore of the node. Content added, packed or retrieved is kept in
+// separate stores, use GetBlock or DAG to read it.
+func (n *Node) Blockstore() blockstore.Blockstore {
+	return n.nd.bs
+}
+
+// GetBlock returns a block from the node blockstore or any of the stores holding our content
+func (n *Node) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	blk, err := n.nd.bs.Get(c)
+	if err == nil || !errors.Is(err, blockstore.ErrNotFound) {
+		return blk, err
+	}
+	for _, id := range n.nd.ms.List() {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		store, err := n.nd.ms.Get(id)
+		if err != nil {
+			continue
+		}
+		blk, err := store.Bstore.Get(c)
+		if err == nil {
+			return blk, nil
+		}
+	}
+	return nil, blockstore.ErrNotFound
+}
+
+// PutBlock adds a raw block to the node blockstore
+func (n *Node) PutBlock(ctx context.Context, blk blocks.Block) error {
+	return n.nd.bs.Put(blk)
+}
+
+// DAG returns a DAG service reading and writing the store holding the given content
+func (n *Node) DAG(root cid.Cid) (ipldformat.DAGService, error) {
+	sid, err := n.nd.exch.Supply().GetStoreID(root)
+	if err != nil {
+		return nil, err
+	}
+	store, err := n.nd.ms.Get(sid)
+	if err != nil {
+		return nil, err
+	}
+	return store.DAG, nil
+}
+
+// run calls a node command passing all the notifications it sends to fn
+func (n *Node) run(cmd func(), fn func(Notify)) {
+	n.cmu.Lock()
+	defer n.cmu.Unlock()
+
+	n.nd.mu.Lock()
+	n.nd.notify = fn
+	n.nd.mu.Unlock()
+
+	cmd()
+
+	n.nd.mu.Lock()
+	n.nd.notify = nil
+	n.nd.mu.Unlock()
+}
+
+// call runs a node command with its own notifications so it doesn't wait for the command run
+// in progress. The command must send all its notifications before returning.
+func (n *Node) call(ctx context.Context, cmd func(context.Context), fn func(Notify)) {
+	cmd(withNotify(ctx, fn))
+}
+
+// Add chunks and stages a file or directory for the next Pack. Adding with Cancel stops the add
+// of the file in progress.
+func (n *Node) Add(ctx context.Context, args AddArgs) (*AddResult, error) {
+	var res *AddResult
+	fn := func(no Notify) {
+		if no.AddResult != nil {
+			res = no.AddResult
+		}
+	}
+	if args.Cancel {
+		n.call(ctx, func(ctx context.Context) { n.nd.Add(ctx, &args) }, fn)
+	} else {
+		n.run(func() { n.nd.Add(ctx, &args) }, fn)
+	}
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Status returns the files staged in a workdag
+func (n *Node) Status(ctx context.Context, args StatusArgs) (*StatusResult, error) {
+	var res *StatusResult
+	n.call(ctx, func(ctx context.Context) { n.nd.Status(ctx, &args) }, func(no Notify) {
+		if no.StatusResult != nil {
+			res = no.StatusResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Pack commits the staged DAGs into an archive we can push and provide
+func (n *Node) Pack(ctx context.Context, args PackArgs) (*PackResult, error) {
+	var res *PackResult
+	n.run(func() { n.nd.Pack(ctx, &args) }, func(no Notify) {
+		if no.PackResult != nil {
+			res = no.PackResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Checkout sets the workdag content is staged in by default and lists all the workdags. An empty
+// name only lists them.
+func (n *Node) Checkout(ctx context.Context, args CheckoutArgs) (*CheckoutResult, error) {
+	var res *CheckoutResult
+	n.run(func() { n.nd.Checkout(ctx, &args) }, func(no Notify) {
+		if no.CheckoutResult != nil {
+			res = no.CheckoutResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Quote returns the price miners ask to store a commit. Push uses the last quote to select the miners.
+func (n *Node) Quote(ctx context.Context, args QuoteArgs) (*QuoteResult, error) {
+	var res *QuoteResult
+	n.run(func() { n.nd.Quote(ctx, &args) }, func(no Notify) {
+		if no.QuoteResult != nil {
+			res = no.QuoteResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Push stores a commit with Filecoin miners and dispatches it to caches. Progress is called with the
+// storage deals, then the caches who pulled the content. Data keeps being sent to the miners after
+// Push returns, use Deals to follow the deals.
+func (n *Node) Push(ctx context.Context, args PushArgs, progress func(PushResult)) error {
+	var err error
+	n.run(func() { n.nd.Push(ctx, &args) }, func(no Notify) {
+		pr := no.PushResult
+		if pr == nil {
+			return
+		}
+		if pr.Err != "" && err == nil {
+			err = errors.New(pr.Err)
+		}
+		if progress != nil {
+			progress(*pr)
+		}
+	})
+	return err
+}
+
+// Get retrieves content from the network unless we have it already, writing it to args.Out if set.
+// Progress is called once a deal is accepted and when the transfer completes.
+func (n *Node) Get(ctx context.Context, args GetArgs, progress func(GetResult)) error {
+	if args.Timeout == 0 {
+		args.Timeout = DefaultGetTimeout
+	}
+	var err error
+	n.run(func() { n.nd.Get(ctx, &args) }, func(no Notify) {
+		gr := no.GetResult
+		if gr == nil {
+			return
+		}
+		if gr.Err != "" && err == nil {
+			err = errors.New(gr.Err)
+		}
+		if progress != nil {
+			progress(*gr)
+		}
+	})
+	return err
+}
+
+// List returns a page of the content we provide
+func (n *Node) List(ctx context.Context, args ListArgs) (*ListResult, error) {
+	var res *ListResult
+	n.run(func() { n.nd.List(ctx, &args) }, func(no Notify) {
+		if no.ListResult != nil {
+			res = no.ListResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Deals returns our storage deals
+func (n *Node) Deals(ctx context.Context, args DealsArgs) (*DealsResult, error) {
+	var res *DealsResult
+	n.run(func() { n.nd.Deals(ctx, &args) }, func(no Notify) {
+		if no.DealsResult != nil {
+			res = no.DealsResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Funds returns our balance in the storage market, withdrawing available funds first if requested
+func (n *Node) Funds(ctx context.Context, args FundsArgs) (*FundsResult, error) {
+	var res *FundsResult
+	n.run(func() { n.nd.Funds(ctx, &args) }, func(no Notify) {
+		if no.FundsResult != nil {
+			res = no.FundsResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Cost returns what we spent to store and retrieve a content, in total and per period
+func (n *Node) Cost(ctx context.Context, args CostArgs) (*CostResult, error) {
+	var res *CostResult
+	n.run(func() { n.nd.Cost(ctx, &args) }, func(no Notify) {
+		if no.CostResult != nil {
+			res = no.CostResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Receipts returns the bytes the caches of a content served according to the receipts of their clients
+func (n *Node) Receipts(ctx context.Context, args ReceiptsArgs) (*ReceiptsResult, error) {
+	var res *ReceiptsResult
+	n.run(func() { n.nd.Receipts(ctx, &args) }, func(no Notify) {
+		if no.ReceiptsResult != nil {
+			res = no.ReceiptsResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Ask sets or removes the ask of a target and returns all the asks
+func (n *Node) Ask(ctx context.Context, args AskArgs) (*AskResult, error) {
+	var res *AskResult
+	n.run(func() { n.nd.Ask(ctx, &args) }, func(no Notify) {
+		if no.AskResult != nil {
+			res = no.AskResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Retrievals returns the retrieval deals we served and made during a time range
+func (n *Node) Retrievals(ctx context.Context, args RetrievalsArgs) (*RetrievalsResult, error) {
+	var res *RetrievalsResult
+	n.run(func() { n.nd.Retrievals(ctx, &args) }, func(no Notify) {
+		if no.RetrievalsResult != nil {
+			res = no.RetrievalsResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// Find returns the offers of the caches holding a content ranked best first
+func (n *Node) Find(ctx context.Context, args FindArgs) (*FindResult, error) {
+	var res *FindResult
+	n.run(func() { n.nd.Find(ctx, &args) }, func(no Notify) {
+		if no.FindResult != nil {
+			res = no.FindResult
+		}
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
+
+// BatchGet retrieves many contents as a single session within a price and bandwidth budget. Progress is
+// called with the result of each content as it completes.
+func (n *Node) BatchGet(ctx context.Context, args BatchGetArgs, progress func(BatchItem)) (*BatchGetResult, error) {
+	var res *BatchGetResult
+	n.run(func() { n.nd.BatchGet(ctx, &args) }, func(no Notify) {
+		br := no.BatchGetResult
+		if br == nil {
+			return
+		}
+		if br.Item != nil {
+			if progress != nil {
+				progress(*br.Item)
+			}
+			return
+		}
+		res = br
+	})
+	if res == nil {
+		return nil, errNoResult
+	}
+	if res.Err != "" {
+		return res, errors.New(res.Err)
+	}
+	return res, nil
+}
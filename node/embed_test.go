@@ -0,0 +1,106 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedNode(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := &Node{nd: newTestNode(ctx, mn, t)}
+	require.NoError(t, mn.LinkAll())
+
+	dir := t.TempDir()
+	data := make([]byte, 256000)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(data)
+	p := filepath.Join(dir, "data")
+	require.NoError(t, os.WriteFile(p, data, 0666))
+
+	ar, err := n.Add(ctx, AddArgs{Path: p, ChunkSize: 1024})
+	require.NoError(t, err)
+	require.NotEqual(t, "", ar.Cid)
+
+	pr, err := n.Pack(ctx, PackArgs{})
+	require.NoError(t, err)
+	root, err := cid.Decode(pr.DataCID)
+	require.NoError(t, err)
+
+	// Errors are returned instead of notified
+	_, err = n.Pack(ctx, PackArgs{})
+	require.EqualError(t, err, ErrNoDAGForPacking.Error())
+
+	// Blocks of our content can be read from their store
+	blk, err := n.GetBlock(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, root, blk.Cid())
+	dag, err := n.DAG(root)
+	require.NoError(t, err)
+	nd, err := dag.Get(ctx, root)
+	require.NoError(t, err)
+	require.NotEmpty(t, nd.Links())
+
+	gen := blocksutil.NewBlockGenerator()
+	raw := gen.Next()
+	require.NoError(t, n.PutBlock(ctx, raw))
+	blk, err = n.GetBlock(ctx, raw.Cid())
+	require.NoError(t, err)
+	require.Equal(t, raw.RawData(), blk.RawData())
+
+	out := filepath.Join(dir, "out")
+	var updates []GetResult
+	err = n.Get(ctx, GetArgs{Cid: fmt.Sprintf("/%s/data", root), Out: out}, func(gr GetResult) {
+		updates = append(updates, gr)
+	})
+	require.NoError(t, err)
+	require.Len(t, updates, 1)
+	require.True(t, updates[0].Local)
+
+	got, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
+
+func TestEmbeddedCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	nd := newTestNode(ctx, mn, t)
+	nd.ds = slowAddsDatastore{Batching: nd.ds, delay: 3 * time.Second}
+	n := &Node{nd: nd}
+
+	p := filepath.Join(t.TempDir(), "data")
+	require.NoError(t, os.WriteFile(p, make([]byte, 256000), 0666))
+
+	added := make(chan *AddResult, 1)
+	go func() {
+		ar, _ := n.Add(ctx, AddArgs{Path: p, ChunkSize: 1024})
+		added <- ar
+	}()
+
+	// Status and cancel don't wait for the add in progress
+	start := time.Now()
+	require.Eventually(t, func() bool {
+		_, err := n.Add(ctx, AddArgs{Path: p, Cancel: true})
+		return err == nil
+	}, 2*time.Second, 10*time.Millisecond)
+	_, err := n.Status(ctx, StatusArgs{})
+	require.NoError(t, err)
+	require.Less(t, int64(time.Since(start)), int64(2*time.Second))
+
+	ar := <-added
+	require.NotNil(t, ar)
+	require.True(t, ar.Canceled)
+}
@@ -0,0 +1,97 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/myelnet/pop/filecoin/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// MetricDealFaults counts the storage deals of our content slashed or failing after they were sealed
+const MetricDealFaults = "pop_storage_deal_faults_total"
+
+// faultWebhookTimeout bounds how long we wait for the webhook to accept a fault
+const faultWebhookTimeout = 10 * time.Second
+
+// faultResult describes a deal fault and what the publisher can do about it
+func faultResult(f storage.DealFault) *DealFaultResult {
+	res := &DealFaultResult{
+		Proposal:  f.ProposalCid.String(),
+		Miner:     f.Miner.String(),
+		DealID:    uint64(f.DealID),
+		State:     f.StateName(),
+		Message:   f.Message,
+		Sealed:    f.Sealed,
+		Repairing: f.Repairing,
+		Time:      f.Time,
+	}
+	if f.Root.Defined() {
+		res.Root = f.Root.String()
+	}
+	switch {
+	case f.Repairing:
+		res.Suggestion = "a deal with an alternate miner is being proposed to replace it"
+	case res.Root != "":
+		res.Suggestion = fmt.Sprintf("run pop push %s to store another copy", res.Root)
+	default:
+		res.Suggestion = "push the content again to store another copy"
+	}
+	return res
+}
+
+// notifyDealFault tells the publisher a deal of their content faulted. The fault is broadcast to the
+// connected clients, counted in our metrics and posted to the webhook if we have one.
+func (nd *node) notifyDealFault(webhook string) storage.FaultListener {
+	return func(f storage.DealFault) {
+		res := faultResult(f)
+		log.Warn().
+			Str("root", res.Root).
+			Str("miner", res.Miner).
+			Str("state", res.State).
+			Bool("repairing", res.Repairing).
+			Msg("storage deal faulted")
+
+		nd.send(context.Background(), Notify{DealFaultResult: res})
+
+		if nd.metrics != nil {
+			nd.metrics.Count(MetricDealFaults, 1, "miner", res.Miner, "state", res.State)
+		}
+		if webhook != "" {
+			go func() {
+				if err := postFault(webhook, res); err != nil {
+					log.Error().Err(err).Str("root", res.Root).Msg("failed to post deal fault to webhook")
+				}
+			}()
+		}
+	}
+}
+
+// postFault sends a deal fault as JSON to the webhook
+func postFault(webhook string, res *DealFaultResult) error {
+	body, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), faultWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, webhook, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s: %s", webhook, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package node
+
+import (
+	"context"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/filecoin"
+)
+
+// DefaultFindProviders is how many offers the Find command collects when none is given
+const DefaultFindProviders = 5
+
+// DefaultFindTimeout is how long the Find command waits for a first offer when no timeout is given
+const DefaultFindTimeout = 30 * time.Second
+
+// DefaultFindWait is how long the Find command waits for more offers after the first one
+const DefaultFindWait = 2 * time.Second
+
+// findEntry converts a ranked offer into an entry with prices in FIL
+func findEntry(r pop.RankedOffer) FindEntry {
+	return FindEntry{
+		Provider:     r.PeerID.String(),
+		Price:        filecoin.FIL(r.Response.PieceRetrievalPrice()).Short(),
+		PricePerByte: filecoin.FIL(r.Response.MinPricePerByte).Short(),
+		Size:         r.Response.Size,
+		RTT:          r.Record.RTT,
+		Throughput:   r.Record.Throughput,
+		Reliability:  r.Record.Score(),
+		Score:        r.Score,
+	}
+}
+
+// Find queries the caches holding a content and sends their offers ranked from their price and our past
+// retrievals from them
+func (nd *node) Find(ctx context.Context, args *FindArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			FindResult: &FindResult{
+				Err: err.Error(),
+			}})
+	}
+	root, err := cid.Decode(args.Cid)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	max := args.Providers
+	if max <= 0 {
+		max = DefaultFindProviders
+	}
+	wait := args.Wait
+	if wait <= 0 {
+		wait = DefaultFindWait
+	}
+	timeout := args.Timeout
+	if timeout <= 0 {
+		timeout = DefaultFindTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	session, err := nd.exch.NewSession(ctx, root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	defer session.Close()
+
+	offers, err := session.QueryOffers(ctx, max, wait)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	res := &FindResult{}
+	for _, r := range nd.exch.Discovery().Rank(offers) {
+		res.Offers = append(res.Offers, findEntry(r))
+	}
+	nd.send(ctx, Notify{FindResult: res})
+}
@@ -0,0 +1,218 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/gabriel-vasile/mimetype"
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipfs/go-path"
+	"github.com/myelnet/pop/edge"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultGatewayTimeout is how long the HTTP gateway waits for a retrieval of content we don't have
+const DefaultGatewayTimeout = 2 * time.Minute
+
+// gatewayPrefix is the path the gateway serves content under
+const gatewayPrefix = "/ipfs/"
+
+// serveGateway serves the content we have and retrieves the content we don't over HTTP on
+// /ipfs/<cid>[/path] and answers delegated routing lookups on /routing/v1/providers/<cid> until the
+// context is cancelled
+func (nd *node) serveGateway(ctx context.Context, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle(gatewayPrefix, nd.gatewayHandler())
+	mux.Handle(delegatedRoutingPrefix, nd.delegatedRoutingHandler())
+	srv := &http.Server{
+		Addr:        addr,
+		Handler:     mux,
+		ReadTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("failed to serve gateway")
+	}
+}
+
+// gatewayHandler serves UnixFS files from our supply, or their blocks as CAR files or raw blocks for
+// light clients to verify. Content we don't have is retrieved entirely then cached in our supply so we
+// serve it to the next clients.
+func (nd *node) gatewayHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		root, segs, err := path.SplitAbsPath(path.FromString(r.URL.Path))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := strings.Join(segs, "/")
+
+		sid, err := nd.exch.Supply().GetStoreIDContext(r.Context(), root)
+		if err != nil {
+			sid, err = nd.gatewayRetrieve(r.Context(), root)
+			if err != nil {
+				log.Error().Err(err).Str("root", root.String()).Msg("gateway failed to retrieve")
+				http.Error(w, "failed to retrieve content: "+err.Error(), http.StatusBadGateway)
+				return
+			}
+		}
+
+		h := w.Header()
+		h.Set("Access-Control-Allow-Origin", "*")
+		h.Set("Access-Control-Allow-Methods", http.MethodGet)
+		h.Set("Cache-Control", "public, max-age=29030400, immutable")
+		h.Set("Etag", `"`+root.String()+"/"+name+`"`)
+		h.Set("X-Ipfs-Path", r.URL.Path)
+		if format := trustlessFormat(r); format != "" {
+			nd.serveTrustless(w, r, root, name, sid, format)
+			return
+		}
+		h.Add("Vary", "Accept-Encoding")
+		// Compressed variants are only served with a known type as their content can't be sniffed
+		ctype := mime.TypeByExtension(filepath.Ext(name))
+		accept := ""
+		if ctype != "" {
+			accept = r.Header.Get("Accept-Encoding")
+		}
+
+		file, encoding, err := nd.gatewayFile(r.Context(), root, name, sid, accept)
+		switch {
+		case errors.Is(err, ErrNodeNotFound):
+			http.Error(w, "file not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		defer file.Close()
+		size, err := file.Size()
+		if err != nil {
+			http.Error(w, "cannot serve files with unknown sizes", http.StatusBadGateway)
+			return
+		}
+		content := &lazySeeker{
+			size:   size,
+			reader: file,
+		}
+		if ctype == "" {
+			mimeType, err := mimetype.DetectReader(content)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("cannot detect content-type: %s", err.Error()), http.StatusInternalServerError)
+				return
+			}
+			ctype = mimeType.String()
+			if _, err := content.Seek(0, io.SeekStart); err != nil {
+				http.Error(w, "seeker can't seek", http.StatusInternalServerError)
+				return
+			}
+		}
+		h.Set("Content-Type", ctype)
+		if encoding != "" {
+			h.Set("Content-Encoding", encoding)
+		}
+
+		if nd.edge != nil && encoding == "" && size <= nd.edge.Limits.MaxOutput {
+			res, err := nd.gatewayEdge(r, root, name, sid, ctype, content)
+			if err != nil {
+				log.Error().Err(err).Str("root", root.String()).Str("path", name).Msg("edge function failed")
+				http.Error(w, "edge function failed", http.StatusBadGateway)
+				return
+			}
+			if res != nil {
+				// The output of a function may depend on the request so it isn't the immutable file
+				h.Del("Cache-Control")
+				h.Del("Etag")
+				for k, vs := range res.Header {
+					h[k] = vs
+				}
+				if res.Status != http.StatusOK {
+					w.WriteHeader(res.Status)
+					w.Write(res.Body)
+					return
+				}
+				http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(res.Body))
+				return
+			}
+		}
+		// ServeContent handles range requests
+		http.ServeContent(w, r, name, time.Time{}, content)
+	})
+}
+
+// gatewayRetrieve retrieves an entire content for the gateway and returns the store it's cached in
+func (nd *node) gatewayRetrieve(ctx context.Context, root cid.Cid) (multistore.StoreID, error) {
+	ctx, cancel := context.WithTimeout(ctx, DefaultGatewayTimeout)
+	defer cancel()
+	// Our clients don't need to hear about the retrievals of the gateway
+	ctx = withNotify(ctx, func(Notify) {})
+	if err := nd.get(ctx, root, &GetArgs{Cid: root.String(), Sel: "all"}); err != nil {
+		return 0, err
+	}
+	return nd.exch.Supply().GetStoreID(root)
+}
+
+// gatewayFile returns a file of a content or its gzip variant if the client accepts it
+func (nd *node) gatewayFile(ctx context.Context, root cid.Cid, name string, sid multistore.StoreID, accept string) (files.File, string, error) {
+	if name != "" && strings.Contains(accept, "gzip") {
+		wd, err := NewWorkdag(nd.ms, nd.ds)
+		if err != nil {
+			return nil, "", err
+		}
+		if m, err := wd.Manifest(ctx, root, sid); err == nil {
+			if c, err := m.Variant(name, GzipTransform{}.Name()); err == nil {
+				if n, err := wd.LoadFile(ctx, c, sid); err == nil {
+					if f, ok := n.(files.File); ok {
+						return f, "gzip", nil
+					}
+				}
+			}
+		}
+	}
+	n, err := nd.extractFile(ctx, root, name, sid)
+	if err != nil {
+		return nil, "", err
+	}
+	f, ok := n.(files.File)
+	if !ok {
+		// We don't list directories
+		n.Close()
+		return nil, "", ErrNodeNotFound
+	}
+	return f, "", nil
+}
+
+// gatewayEdge runs the edge function of a content on a file
+func (nd *node) gatewayEdge(r *http.Request, root cid.Cid, name string, sid multistore.StoreID, ctype string, file io.ReadSeeker) (*edge.Response, error) {
+	body, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return nd.runEdgeFunction(r.Context(), root, sid, edge.Request{
+		Method:      r.Method,
+		Path:        name,
+		ContentType: ctype,
+		Header:      r.Header,
+	}, body)
+}
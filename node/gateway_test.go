@@ -0,0 +1,233 @@
+package node
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/edge"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGateway(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	dir := t.TempDir()
+	page := strings.Repeat("<p>Two roads diverged in a yellow wood</p>\n", 50)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data"), []byte("%PDF-1.4 not really"), 0666))
+
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	require.NoError(t, err)
+	for _, name := range []string{"index.html", "data"} {
+		_, err := wd.Add(ctx, AddOptions{Path: filepath.Join(dir, name), ChunkSize: 1024})
+		require.NoError(t, err)
+	}
+	ref, err := wd.Commit(ctx, CommitOptions{Transforms: []Transform{GzipTransform{}}})
+	require.NoError(t, err)
+	require.NoError(t, nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID))
+
+	srv := httptest.NewServer(nd.gatewayHandler())
+	defer srv.Close()
+	base := srv.URL + "/ipfs/" + ref.PayloadCID.String()
+
+	get := func(path string, header http.Header) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, base+path, nil)
+		require.NoError(t, err)
+		for k, vs := range header {
+			req.Header[k] = vs
+		}
+		// Don't let the transport decompress the gzip variant for us
+		res, err := (&http.Transport{DisableCompression: true}).RoundTrip(req)
+		require.NoError(t, err)
+		return res
+	}
+
+	res := get("/index.html", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "text/html; charset=utf-8", res.Header.Get("Content-Type"))
+	require.Equal(t, "public, max-age=29030400, immutable", res.Header.Get("Cache-Control"))
+	body, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, page, string(body))
+
+	res = get("/index.html", http.Header{"Range": []string{"bytes=3-5"}})
+	require.Equal(t, http.StatusPartialContent, res.StatusCode)
+	body, err = ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, page[3:6], string(body))
+
+	// Clients accepting gzip get the precompressed variant
+	res = get("/index.html", http.Header{"Accept-Encoding": []string{"gzip, br"}})
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	gr, err := gzip.NewReader(res.Body)
+	require.NoError(t, err)
+	body, err = ioutil.ReadAll(gr)
+	require.NoError(t, err)
+	require.Equal(t, page, string(body))
+
+	// Files without extension are sniffed
+	res = get("/data", nil)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "application/pdf", res.Header.Get("Content-Type"))
+
+	res = get("/missing.html", nil)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	req, err := http.NewRequest(http.MethodPost, base+"/index.html", nil)
+	require.NoError(t, err)
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+}
+
+func TestGatewayEdge(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	dir := t.TempDir()
+	module := []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, edge.ModuleName), module, 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte("<p>page</p>"), 0666))
+
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	require.NoError(t, err)
+	for _, name := range []string{edge.ModuleName, "index.html"} {
+		_, err := wd.Add(ctx, AddOptions{Path: filepath.Join(dir, name), ChunkSize: 1024})
+		require.NoError(t, err)
+	}
+	ref, err := wd.Commit(ctx, CommitOptions{})
+	require.NoError(t, err)
+	require.NoError(t, nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID))
+
+	var env []string
+	nd.edge, err = edge.NewRunner(edge.RuntimeFunc(func(ctx context.Context, m string, e []string, stdin io.Reader, stdout io.Writer, l edge.Limits) error {
+		env = e
+		io.WriteString(stdout, "X-Edge: 1\n\n")
+		_, err := io.Copy(stdout, stdin)
+		return err
+	}), t.TempDir(), edgeLimits(edge.Limits{}))
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(nd.gatewayHandler())
+	defer srv.Close()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/ipfs/"+ref.PayloadCID.String()+"/index.html", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Accept-Language", "fr")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "1", res.Header.Get("X-Edge"))
+	// The output of the function is not cached as the immutable file
+	require.Equal(t, "", res.Header.Get("Cache-Control"))
+	require.Equal(t, "", res.Header.Get("Etag"))
+
+	require.Contains(t, env, "HTTP_ACCEPT_LANGUAGE=fr")
+	for _, e := range env {
+		require.False(t, strings.HasPrefix(e, "HTTP_AUTHORIZATION="), e)
+	}
+}
+
+func TestTrustlessGateway(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("verify me ", 500))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "data.txt"), data, 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "other.txt"), []byte("other"), 0666))
+
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	require.NoError(t, err)
+	for _, name := range []string{"data.txt", "other.txt"} {
+		_, err := wd.Add(ctx, AddOptions{Path: filepath.Join(dir, name), ChunkSize: 1024})
+		require.NoError(t, err)
+	}
+	ref, err := wd.Commit(ctx, CommitOptions{})
+	require.NoError(t, err)
+	require.NoError(t, nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID))
+
+	srv := httptest.NewServer(nd.gatewayHandler())
+	defer srv.Close()
+	base := srv.URL + "/ipfs/" + ref.PayloadCID.String()
+
+	// readCar returns the CIDs of the blocks of a CAR response checking they match their data
+	readCar := func(res *http.Response) []cid.Cid {
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "application/vnd.ipld.car; version=1", res.Header.Get("Content-Type"))
+		cr, err := car.NewCarReader(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, []cid.Cid{ref.PayloadCID}, cr.Header.Roots)
+		var cids []cid.Cid
+		for {
+			blk, err := cr.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			c, err := blk.Cid().Prefix().Sum(blk.RawData())
+			require.NoError(t, err)
+			require.True(t, c.Equals(blk.Cid()))
+			cids = append(cids, blk.Cid())
+		}
+		return cids
+	}
+
+	res, err := http.Get(base + "?format=car")
+	require.NoError(t, err)
+	all := readCar(res)
+	require.Equal(t, ref.PayloadCID, all[0])
+
+	req, err := http.NewRequest(http.MethodGet, base+"/data.txt", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", "application/vnd.ipld.car")
+	res, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	entry := readCar(res)
+	require.Equal(t, ref.PayloadCID, entry[0])
+	require.Greater(t, len(entry), 2)
+	require.Less(t, len(entry), len(all))
+
+	// Only the blocks on the path to the entry and its root
+	res, err = http.Get(base + "/data.txt?format=car&dag-scope=block")
+	require.NoError(t, err)
+	require.Len(t, readCar(res), 2)
+
+	res, err = http.Get(base + "?format=car&dag-scope=block")
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{ref.PayloadCID}, readCar(res))
+
+	res, err = http.Get(base + "?format=raw")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, "application/vnd.ipld.raw", res.Header.Get("Content-Type"))
+	raw, err := ioutil.ReadAll(res.Body)
+	require.NoError(t, err)
+	c, err := ref.PayloadCID.Prefix().Sum(raw)
+	require.NoError(t, err)
+	require.Equal(t, ref.PayloadCID, c)
+
+	res, err = http.Get(base + "/missing.txt?format=car")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	res, err = http.Get(base + "?format=car&dag-scope=nope")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+}
@@ -0,0 +1,40 @@
+package node
+
+import (
+	"time"
+
+	"github.com/myelnet/pop"
+)
+
+// DefaultGroupIdle is how long a retrieval group lives after its last retrieval
+const DefaultGroupIdle = 10 * time.Minute
+
+// retrievalGroup is a group of retrievals and when it was last used
+type retrievalGroup struct {
+	*pop.Group
+	used time.Time
+}
+
+// group returns the retrieval group with the given name creating it if needed. Groups unused for
+// DefaultGroupIdle are closed.
+func (nd *node) group(name string) *pop.Group {
+	nd.gmu.Lock()
+	defer nd.gmu.Unlock()
+	now := time.Now()
+	for n, g := range nd.groups {
+		if now.Sub(g.used) > DefaultGroupIdle {
+			g.Close()
+			delete(nd.groups, n)
+		}
+	}
+	if nd.groups == nil {
+		nd.groups = make(map[string]*retrievalGroup)
+	}
+	g, ok := nd.groups[name]
+	if !ok {
+		g = &retrievalGroup{Group: nd.exch.NewGroup()}
+		nd.groups[name] = g
+	}
+	g.used = now
+	return g.Group
+}
@@ -5,8 +5,12 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
@@ -14,6 +18,11 @@ import (
 
 var jsonEscapedZero = []byte(`\u0000`)
 
+// HelloArgs are sent by a client when connecting to negotiate the largest message either side can send
+type HelloArgs struct {
+	MaxMessageSize uint32
+}
+
 // PingArgs get passed to the Ping command
 type PingArgs struct {
 	Addr string
@@ -23,16 +32,37 @@ type PingArgs struct {
 type AddArgs struct {
 	Path      string
 	ChunkSize int
+	Chunker   string // Chunker is size-<bytes>, rabin[-<min>-<avg>-<max>] or buzhash, chunks of ChunkSize when empty
+	Layout    string // Layout is either balanced (default) or trickle
+	Codec     string // Codec is either unixfs (default), dag-cbor or raw
+	HashFunc  string // HashFunc is either blake2b-256 (default), sha2-256 or blake3
+	CidV0     bool   // CidV0 builds legacy CIDv0 links for sha2-256 UnixFS DAGs
+	Workdag   string // Workdag stages the content in a named workdag instead of the checked out one
+	// Cancel stops the add of Path in progress. Adding the file again resumes where it stopped.
+	Cancel bool
 }
 
 // StatusArgs get passed to the Status command
 type StatusArgs struct {
 	Verbose bool
+	Workdag string // Workdag lists the entries of a named workdag instead of the checked out one
+}
+
+// CheckoutArgs are passed to the Checkout command
+type CheckoutArgs struct {
+	// Name of the workdag to stage content in by default, created if it doesn't exist.
+	// The workdags are only listed when empty.
+	Name string
 }
 
 // PackArgs are passed to the Pack command
 type PackArgs struct {
-	Archive bool
+	Archive  bool
+	Name     string // Name of the publication the pack is a new version of
+	HashFunc string // HashFunc hashes the commit root, blake2b-256 by default
+	// Transforms are the names of the transforms deriving variants of the staged files e.g. gzip
+	Transforms []string
+	Workdag    string // Workdag packs a named workdag instead of the checked out one
 }
 
 // QuoteArgs are passed to the quote command
@@ -41,17 +71,32 @@ type QuoteArgs struct {
 	StorageRF int // StorageRF is the replication factor or number of miners we will try to store with
 	Duration  time.Duration
 	MaxPrice  uint64
+	Verified  bool // Verified quotes the price of verified deals paid with our datacap
+	Refresh   bool // Refresh queries all the miners again instead of reusing cached asks
+	// Budget is the most we pay in FIL for all the deals. When set, the quote is the cheapest
+	// StorageRF miners within the budget.
+	Budget     string
+	MaxLatency time.Duration // MaxLatency excludes miners slower to answer our pings
 }
 
 // PushArgs are passed to the Push command
 type PushArgs struct {
-	Ref       string // Ref is the root CID of the archive to push to remote storage
-	NoCache   bool
-	CacheOnly bool
-	CacheRF   int // CacheRF is the cache replication factor or number of cache provider will request
-	StorageRF int // StorageRF if the replication factor for storage
-	Duration  time.Duration
-	Miners    map[string]bool
+	Ref        string // Ref is the root CID of the archive to push to remote storage
+	NoCache    bool
+	CacheOnly  bool
+	CacheRF    int // CacheRF is the cache replication factor or number of cache provider will request
+	StorageRF  int // StorageRF if the replication factor for storage
+	Duration   time.Duration
+	Miners     map[string]bool
+	Announce   bool           // Announce the content on the region topics instead of dispatching it to connected caches
+	RegionRF   map[string]int // RegionRF is the cache replication factor of each region, overrides CacheRF
+	Queue      bool           // Queue the push until we are online instead of failing
+	MaxPrice   uint64         // MaxPrice is used to quote miners when a queued push didn't select any
+	Label      string         // Label is recorded in the storage deal proposals
+	CachePrice string         // CachePrice is the price per byte in FIL we offer caches to keep the content
+	Verified   bool           // Verified makes verified storage deals paid with our datacap
+	Offline    bool           // Offline proposes manual transfer deals for a piece exported to PieceDir
+	PieceDir   string         // PieceDir is the directory the node writes the CAR of offline deals to
 }
 
 // GetArgs get passed to the Get command
@@ -63,17 +108,164 @@ type GetArgs struct {
 	Timeout  int
 	Verbose  bool
 	Miner    string
+	// Providers is how many cache offers we compare before retrieving from the cheapest one.
+	// Zero or one takes the first offer.
+	Providers int
+	// Race starts the transfer with this many of the cheapest offers and keeps the first provider
+	// to send us the first blocks
+	Race int
+	// Variant retrieves a variant of the manifest entry the path points to e.g. gzip
+	Variant string
+	// Group shares providers and payment channels with the other retrievals of the same group e.g. the
+	// assets of a web page
+	Group string
+
+	batch *batch // batch is set for the retrievals of a BatchGet
+}
+
+// MarketArgs are passed to the Market command to browse cache listings
+type MarketArgs struct {
+	Region      string
+	MinCapacity uint64
+	MaxPrice    string // MaxPrice is the max price per byte in FIL, empty for no limit
+}
+
+// ListArgs are passed to the List command to page through the content we provide
+type ListArgs struct {
+	Offset int
+	Limit  int
+	Labels map[string]string // Labels filters content by record labels, empty values match any value
+}
+
+// InspectArgs are passed to the Inspect command to get the record of a content in our supply
+type InspectArgs struct {
+	Ref string
+}
+
+// RegionArgs are passed to the Region command to join or leave a region. Without arguments
+// it lists the regions we are part of.
+type RegionArgs struct {
+	Join  string
+	Leave string
+	Stats bool   // Stats returns the aggregated health of our regions
+	Name  string // Name of the region to get the stats of, all our regions if empty
+}
+
+// DealsArgs are passed to the Deals command to follow our storage deals
+type DealsArgs struct {
+	Proposal string // Proposal is the CID of a deal proposal to get the history of
+	Phase    string // Phase filters deals by phase: active, sealed, expired or failed. Empty for all.
+}
+
+// FundsArgs are passed to the Funds command to get our storage market balance
+type FundsArgs struct {
+	Withdraw string // Withdraw is an amount in FIL or "all" to withdraw the available funds to our wallet
+}
+
+// CostArgs are passed to the Cost command to get what we spent on a content
+type CostArgs struct {
+	Root   string // Root is the CID of the content
+	Period string // Period groups spending by day, week or month. Defaults to day.
+}
+
+// ReceiptsArgs are passed to the Receipts command to collect the receipts the caches of a content
+// countersigned for the bytes they served
+type ReceiptsArgs struct {
+	Root      string   // Root is the CID of the content
+	Providers []string // Providers are the peer IDs of the caches to ask, the caches we dispatched to when empty
+}
+
+// SchemaArgs are passed to the Schema command to attach a schema to a content root or detach it. Without
+// any action it returns the schema attached to the root.
+type SchemaArgs struct {
+	Root   string          // Root is the CID of the content
+	Set    json.RawMessage // Set is the JSON encoded schema to attach
+	Remove bool
+}
+
+// RulesArgs are passed to the Rules command to replace the rules deciding which dispatches we accept.
+// Without a rule set it returns the current rules.
+type RulesArgs struct {
+	Set *RuleSet
+}
+
+// AskArgs are passed to the Ask command to set or remove the ask of a target. Without any action it
+// returns all the asks.
+type AskArgs struct {
+	Target string // Target is default, a content root or a label as <key>=<value>
+	Set    bool
+	Remove bool
+	// Terms left empty keep the terms of the ask currently applying to the target
+	PricePerByte            string // PricePerByte in FIL
+	UnsealPrice             string // UnsealPrice in FIL charged when content must be unsealed from a sector
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+}
+
+// RetrievalsArgs are passed to the Retrievals command to list the retrieval deals which ended between
+// From and To. Zero times leave the range open.
+type RetrievalsArgs struct {
+	From time.Time
+	To   time.Time
+}
+
+// FindArgs are passed to the Find command to look up and rank the offers of the caches holding a content
+type FindArgs struct {
+	Cid       string
+	Providers int           // Providers is how many offers we collect at most, DefaultFindProviders when zero
+	Wait      time.Duration // Wait is how long we wait for more offers after the first one
+	Timeout   time.Duration // Timeout is how long we wait for the first offer, DefaultFindTimeout when zero
+}
+
+// BatchGetArgs are passed to the BatchGet command to retrieve many contents as a single session
+type BatchGetArgs struct {
+	Refs      []string // Refs are the CIDs, paths or <name>@<version> of the contents to retrieve
+	Sel       string
+	Out       string // Out is a directory the contents are written to under their ref
+	Timeout   int    // Timeout of the whole batch in minutes
+	Providers int
+	Workers   int    // Workers is how many contents we retrieve at once, DefaultBatchWorkers when zero
+	MaxSpend  string // MaxSpend is the most FIL we pay for the whole batch, unbounded when empty
+	MaxBytes  uint64 // MaxBytes is the most bytes we retrieve for the whole batch, unbounded when zero
+	Group     string // Group shares providers and payment channels with other retrievals than the batch
 }
 
 // Command is a message sent from a client to the daemon
 type Command struct {
-	Ping   *PingArgs
-	Add    *AddArgs
-	Status *StatusArgs
-	Pack   *PackArgs
-	Quote  *QuoteArgs
-	Push   *PushArgs
-	Get    *GetArgs
+	// RequestID is echoed in the notifications the command sends so a client can run several
+	// commands at once on the same connection
+	RequestID  uint64 `json:",omitempty"`
+	Hello      *HelloArgs
+	Ping       *PingArgs
+	Add        *AddArgs
+	Status     *StatusArgs
+	Pack       *PackArgs
+	Quote      *QuoteArgs
+	Push       *PushArgs
+	Get        *GetArgs
+	Market     *MarketArgs
+	List       *ListArgs
+	Region     *RegionArgs
+	Inspect    *InspectArgs
+	Deals      *DealsArgs
+	Rules      *RulesArgs
+	Funds      *FundsArgs
+	Cost       *CostArgs
+	Ask        *AskArgs
+	Retrievals *RetrievalsArgs
+	Find       *FindArgs
+	BatchGet   *BatchGetArgs
+	Checkout   *CheckoutArgs
+	Receipts   *ReceiptsArgs
+	Schema     *SchemaArgs
+}
+
+// HelloResult is the message size the daemon agreed on. It is only sent to the client saying hello.
+type HelloResult struct {
+	MaxMessageSize uint32
+	// IdleTimeout is how long the daemon keeps a connection open without any message. Clients waiting
+	// for long commands send empty messages to keep it open. Zero never closes idle connections.
+	IdleTimeout time.Duration
 }
 
 // PingResult is sent in the notify message to give us the info we requested
@@ -81,7 +273,10 @@ type PingResult struct {
 	ID             string   // Host's peer ID
 	Addrs          []string // Addresses the host is listening on
 	Peers          []string // Peers currently connected to the node (local daemon only)
+	Regions        []string // Regions the local node is part of
+	DetectedRegion string   // DetectedRegion is the region we inferred from our IP address if any
 	LatencySeconds float64
+	Version        string // Version of pop the peer runs if known
 	Err            string
 }
 
@@ -90,13 +285,25 @@ type AddResult struct {
 	Cid       string
 	Size      string
 	NumBlocks int
+	Canceled  bool // Canceled is set when the add was stopped by a Cancel command
 	Err       string
 }
 
 // StatusResult gives us the result of status request to pring
 type StatusResult struct {
-	Output string
-	Err    string
+	Output         string
+	Compression    string   // Compression gives stats about the space saved if blocks are compressed
+	Version        string   // Version of the daemon
+	VersionWarning string   // VersionWarning is set when the daemon lags behind the network
+	Queued         []string // Queued are the refs of the pushes waiting for connectivity
+	Err            string
+}
+
+// CheckoutResult gives the checked out workdag and all the workdags we have
+type CheckoutResult struct {
+	Name     string
+	Workdags []string
+	Err      string
 }
 
 // PackResult gives us feedback on the result of the Commit operation
@@ -105,6 +312,9 @@ type PackResult struct {
 	DataSize  int64
 	PieceCID  string
 	PieceSize int64
+	Name      string
+	Version   int64
+	StoreID   uint64 // StoreID is the store holding the blocks of the commit
 	Err       string
 }
 
@@ -112,15 +322,76 @@ type PackResult struct {
 type QuoteResult struct {
 	Ref    string
 	Quotes map[string]string
+	Total  string // Total is the price of all the miners of a quote within a budget
 	Err    string
 }
 
 // PushResult is feedback on the push operation
 type PushResult struct {
-	Miners []string
-	Deals  []string
-	Caches []string
-	Err    string
+	Miners         []string
+	Deals          []string
+	FailedDeals    map[string]string // FailedDeals maps the miners we couldn't start a deal with to the reason
+	Caches         []string          // Caches who confirmed they pulled the content
+	CacheAttempted int               // CacheAttempted is the number of caches we sent the request to
+	CacheFailed    int
+	CachePending   int               // CachePending is the number of caches still pulling when the push returned
+	CacheFailures  map[string]string // CacheFailures maps the caches who failed to the reason
+	Previous       string            // Previous is the version caches already held if we only sent them a diff
+	DiffBlocks     int               // DiffBlocks is the number of new blocks in the diff
+	Publication    string            // Publication is the <name>@<version> now pointing to the pushed root
+	RegionCaches   map[string]int    // RegionCaches is the number of caches who pulled the content in each region
+	Shortfalls     map[string]int    // Shortfalls is the number of caches missing to reach the RF of each region
+	Relays         map[string]string // Relays maps regions we had no peers in to the gateway relaying the content
+	Queued         string            // Queued is the ref of the push we deferred until we are online
+	Transfer       *DealTransfer     // Transfer is an update on the data sent to one of the miners
+	Label          string            // Label is the label of the storage deals
+	PieceFile      string            // PieceFile is the CAR file to ship to the miners for offline deals
+	// Root, PieceCID and PieceSize identify what we pushed so it can be verified independently of us.
+	// Root is the payload CID, PieceCID the piece commitment of the deals and PieceSize its padded size.
+	Root      string
+	PieceCID  string
+	PieceSize uint64
+	Proposals map[string]string // Proposals maps the miners we started a deal with to the CID of the deal proposal
+	Err       string
+}
+
+// DealTransfer is the progress of the data we send to a storage miner for a deal
+type DealTransfer struct {
+	Miner string
+	Deal  string
+	Sent  uint64
+	Total uint64 // Total is 0 if the size of the transfer is unknown
+	Done  bool
+	Err   string
+}
+
+// DealFaultResult is broadcast when a storage deal of content we pushed is slashed or fails after it was
+// sealed so the publisher can repair it before the content is lost
+type DealFaultResult struct {
+	Root       string
+	Proposal   string
+	Miner      string
+	DealID     uint64
+	State      string
+	Message    string
+	Sealed     bool   // Sealed is set when the miner had proven the content so a copy was lost
+	Repairing  bool   // Repairing is set when we replace the deal with an alternate miner
+	Suggestion string // Suggestion is what the publisher can do to keep their copies
+	Time       time.Time
+}
+
+// ProgressResult reports the progress of the transfers of a long running Get or Push or of the chunking
+// of a large file we Add between their results
+type ProgressResult struct {
+	Command string // Command is get, push or add
+	Root    string
+	Path    string // Path is the file being added
+	Peer    string // Peer is the provider we retrieve from or the cache pulling our content
+	Bytes   uint64 // Bytes transferred so far
+	Blocks  int    // Blocks received so far, only counted when we retrieve
+	Total   uint64 // Total is 0 if the size of the transfer is unknown
+	Status  string // Status is the state of the retrieval deal or the transfer
+	Done    bool
 }
 
 // GetResult gives us feedback on the result of the Get request
@@ -137,15 +408,265 @@ type GetResult struct {
 	Err             string
 }
 
+// MarketListing is a cache listing returned by the Market command
+type MarketListing struct {
+	Provider     string
+	Region       string
+	Capacity     string
+	PricePerByte string
+}
+
+// MarketResult returns the cache listings matching the Market request
+type MarketResult struct {
+	Providers []MarketListing
+	Err       string
+}
+
+// ContentEntry is a content listed by the List command
+type ContentEntry struct {
+	Root       string
+	Size       string
+	StoreID    uint64
+	Region     string
+	ReceivedAt time.Time
+	Labels     map[string]string
+}
+
+// ListResult returns a page of the content we provide
+type ListResult struct {
+	Entries []ContentEntry
+	Total   int // Total is the number of content matching the filters across all pages
+	Err     string
+}
+
+// InspectResult returns the record of a content
+type InspectResult struct {
+	Content ContentEntry
+	Err     string
+}
+
+// RegionResult returns the regions we are part of after the Region command
+type RegionResult struct {
+	Regions []string
+	Health  []RegionHealth
+	Err     string
+}
+
+// RegionHealth is the aggregated stats of the caches in a region
+type RegionHealth struct {
+	Region      string
+	Caches      int
+	Capacity    string
+	HitRate     float64
+	Queries     uint64
+	BytesServed string
+}
+
+// DealEntry is a storage deal returned by the Deals command
+type DealEntry struct {
+	ProposalCid string
+	Root        string
+	Miner       string
+	DealID      uint64
+	State       string
+	Phase       string
+	PieceSize   string
+	Price       string // Price is the price per epoch in FIL
+	Message     string
+	PieceCheck  string // PieceCheck is "ok", "sealed" once proven or the piece CID mismatch once the deal is published
+	Updated     time.Time
+	Transitions []DealTransitionEntry // Only set when requesting a single deal
+}
+
+// DealTransitionEntry is a change of state of a storage deal
+type DealTransitionEntry struct {
+	Event   string
+	State   string
+	Message string
+	Time    time.Time
+}
+
+// DealsResult returns our storage deals
+type DealsResult struct {
+	Deals []DealEntry
+	Err   string
+}
+
+// ReservationEntry is the funds reserved for a deal not published yet
+type ReservationEntry struct {
+	ProposalCid string
+	Miner       string
+	Amount      string
+	State       string
+}
+
+// FundsResult returns our balance in the storage market. Amounts are in FIL.
+type FundsResult struct {
+	Address      string
+	Escrow       string
+	Locked       string
+	Reserved     string
+	Available    string
+	PendingMsg   string // PendingMsg is a deposit or withdrawal not yet on chain
+	Reservations []ReservationEntry
+	WithdrawMsg  string // WithdrawMsg is the message withdrawing funds if requested
+	Err          string
+}
+
+// CostEntry is what we spent on a content during a period. Amounts are in FIL.
+type CostEntry struct {
+	Start     time.Time // Start of the period, zero for the total
+	Storage   string
+	Retrieval string
+	Gas       string
+	Total     string
+}
+
+// CostResult returns what we spent on a content in total and per period, oldest period first
+type CostResult struct {
+	Root    string
+	Total   CostEntry
+	Periods []CostEntry
+	Err     string
+}
+
+// ProviderReceipts sums the receipts of a cache
+type ProviderReceipts struct {
+	Provider string
+	Receipts int
+	Bytes    uint64
+	Err      string
+}
+
+// ReceiptsResult returns the bytes each cache served for a content according to the receipts issued by
+// their clients
+type ReceiptsResult struct {
+	Root      string
+	Providers []ProviderReceipts
+	Bytes     uint64 // Bytes is the total served by all the providers
+	Err       string
+}
+
+// SchemaResult returns the JSON encoded schema attached to a root, empty if it has none
+type SchemaResult struct {
+	Root   string
+	Schema json.RawMessage `json:",omitempty"`
+	Err    string
+}
+
+// RulesResult returns the rules deciding which dispatches we accept
+type RulesResult struct {
+	Rules RuleSet
+	Err   string
+}
+
+// AskEntry is the price and payment terms we offer for a target. Prices are in FIL.
+type AskEntry struct {
+	Target                  string
+	PricePerByte            string
+	UnsealPrice             string
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+}
+
+// AskResult returns the default ask first then the overrides
+type AskResult struct {
+	Asks []AskEntry
+	Err  string
+}
+
+// RetrievalEntry is a retrieval deal we served (inbound) or made (outbound). Paid is in FIL.
+type RetrievalEntry struct {
+	Direction string
+	ID        uint64
+	Peer      string
+	Root      string
+	Bytes     uint64
+	Paid      string
+	Duration  time.Duration
+	Status    string
+	Message   string
+	End       time.Time
+}
+
+// RetrievalsResult returns the retrieval deals oldest first with what we earned serving content and
+// spent retrieving it in FIL
+type RetrievalsResult struct {
+	Deals  []RetrievalEntry
+	Earned string
+	Spent  string
+	Err    string
+}
+
+// FindEntry is a ranked offer for a content. Prices are in FIL.
+type FindEntry struct {
+	Provider     string
+	Price        string // Price is the total price of the retrieval
+	PricePerByte string
+	Size         uint64
+	RTT          time.Duration // RTT is the average time the provider took to answer our queries
+	Throughput   float64       // Throughput is the average bytes per second of our retrievals from the provider
+	Reliability  float64       // Reliability is the likelihood of our retrievals from the provider succeeding
+	Score        float64
+}
+
+// FindResult returns the offers for a content best first
+type FindResult struct {
+	Offers []FindEntry
+	Err    string
+}
+
+// BatchItem is the result of the retrieval of a content in a batch
+type BatchItem struct {
+	Ref        string
+	DealID     string
+	TotalPrice string
+	Size       string
+	Local      bool // Local is set when we had the content already
+	Err        string
+}
+
+// BatchGetResult reports each content of a batch as its retrieval completes then the totals once Done
+type BatchGetResult struct {
+	Item       *BatchItem
+	Done       bool
+	Completed  int
+	Failed     int
+	TotalSpent string
+	TotalBytes string
+	Err        string
+}
+
 // Notify is a message sent from the daemon to the client
 type Notify struct {
-	PingResult   *PingResult
-	AddResult    *AddResult
-	StatusResult *StatusResult
-	PackResult   *PackResult
-	QuoteResult  *QuoteResult
-	PushResult   *PushResult
-	GetResult    *GetResult
+	// RequestID is the ID of the command the notification is a result of, zero for the notifications
+	// broadcast to all clients
+	RequestID        uint64 `json:",omitempty"`
+	HelloResult      *HelloResult
+	PingResult       *PingResult
+	AddResult        *AddResult
+	StatusResult     *StatusResult
+	PackResult       *PackResult
+	QuoteResult      *QuoteResult
+	PushResult       *PushResult
+	GetResult        *GetResult
+	MarketResult     *MarketResult
+	ListResult       *ListResult
+	RegionResult     *RegionResult
+	InspectResult    *InspectResult
+	DealsResult      *DealsResult
+	RulesResult      *RulesResult
+	FundsResult      *FundsResult
+	CostResult       *CostResult
+	AskResult        *AskResult
+	RetrievalsResult *RetrievalsResult
+	FindResult       *FindResult
+	BatchGetResult   *BatchGetResult
+	ProgressResult   *ProgressResult
+	CheckoutResult   *CheckoutResult
+	DealFaultResult  *DealFaultResult
+	ReceiptsResult   *ReceiptsResult
+	SchemaResult     *SchemaResult
 }
 
 // CommandServer receives commands on the daemon side and executes them
@@ -178,7 +699,8 @@ func (cs *CommandServer) GotMsg(ctx context.Context, cmd *Command) error {
 		return nil
 	}
 	if c := cmd.Add; c != nil {
-		cs.n.Add(ctx, c)
+		// chunking large files takes a while and we must still receive the commands to cancel them
+		go cs.n.Add(ctx, c)
 		return nil
 	}
 	if c := cmd.Status; c != nil {
@@ -189,6 +711,10 @@ func (cs *CommandServer) GotMsg(ctx context.Context, cmd *Command) error {
 		cs.n.Pack(ctx, c)
 		return nil
 	}
+	if c := cmd.Checkout; c != nil {
+		cs.n.Checkout(ctx, c)
+		return nil
+	}
 	if c := cmd.Quote; c != nil {
 		cs.n.Quote(ctx, c)
 		return nil
@@ -204,10 +730,71 @@ func (cs *CommandServer) GotMsg(ctx context.Context, cmd *Command) error {
 		go cs.n.Get(ctx, c)
 		return nil
 	}
+	if c := cmd.Market; c != nil {
+		cs.n.Market(ctx, c)
+		return nil
+	}
+	if c := cmd.List; c != nil {
+		cs.n.List(ctx, c)
+		return nil
+	}
+	if c := cmd.Region; c != nil {
+		cs.n.Region(ctx, c)
+		return nil
+	}
+	if c := cmd.Inspect; c != nil {
+		cs.n.Inspect(ctx, c)
+		return nil
+	}
+	if c := cmd.Deals; c != nil {
+		cs.n.Deals(ctx, c)
+		return nil
+	}
+	if c := cmd.Rules; c != nil {
+		cs.n.Rules(ctx, c)
+		return nil
+	}
+	if c := cmd.Funds; c != nil {
+		cs.n.Funds(ctx, c)
+		return nil
+	}
+	if c := cmd.Cost; c != nil {
+		cs.n.Cost(ctx, c)
+		return nil
+	}
+	if c := cmd.Ask; c != nil {
+		cs.n.Ask(ctx, c)
+		return nil
+	}
+	if c := cmd.Retrievals; c != nil {
+		cs.n.Retrievals(ctx, c)
+		return nil
+	}
+	if c := cmd.Find; c != nil {
+		go cs.n.Find(ctx, c)
+		return nil
+	}
+	if c := cmd.BatchGet; c != nil {
+		go cs.n.BatchGet(ctx, c)
+		return nil
+	}
+	if c := cmd.Receipts; c != nil {
+		go cs.n.Receipts(ctx, c)
+		return nil
+	}
+	if c := cmd.Schema; c != nil {
+		cs.n.Schema(ctx, c)
+		return nil
+	}
 	return fmt.Errorf("CommandServer: no command specified")
 }
 
 func (cs *CommandServer) send(n Notify) {
+	cs.sendNotifyMsg(marshalNotify(n))
+}
+
+// marshalNotify encodes a notification for clients
+func marshalNotify(n Notify) []byte {
 	b, err := json.Marshal(n)
 	if err != nil {
 		log.Fatal().Err(err).Interface("n", n).Msg("Failed json.Marshal(notify)")
@@ -215,21 +802,38 @@ func (cs *CommandServer) send(n Notify) {
 	if bytes.Contains(b, jsonEscapedZero) {
 		log.Error().Msg("[unexpected] zero byte in BackendServer.send notify message")
 	}
-	cs.sendNotifyMsg(b)
+	return b
 }
 
 // CommandClient sends commands to a daemon process
 type CommandClient struct {
 	sendCommandMsg func(jsonb []byte)
 	notify         func(Notify)
+	maxMsgSize     uint32 // accessed atomically
+	lastID         uint64 // accessed atomically
+
+	hmu      sync.Mutex
+	handlers map[uint64]func(Notify)
 }
 
 func NewCommandClient(sendCommandMsg func(jsonb []byte)) *CommandClient {
 	return &CommandClient{
 		sendCommandMsg: sendCommandMsg,
+		maxMsgSize:     MaxMessageSize,
+		handlers:       make(map[uint64]func(Notify)),
 	}
 }
 
+// MaxMessageSize returns the largest message the client and the daemon can send each other
+func (cc *CommandClient) MaxMessageSize() uint32 {
+	return atomic.LoadUint32(&cc.maxMsgSize)
+}
+
+// SetMaxMessageSize sets the message size negotiated with the daemon
+func (cc *CommandClient) SetMaxMessageSize(size uint32) {
+	atomic.StoreUint32(&cc.maxMsgSize, size)
+}
+
 func (cc *CommandClient) GotNotifyMsg(b []byte) {
 	if len(b) == 0 {
 		// not interesting
@@ -242,12 +846,45 @@ func (cc *CommandClient) GotNotifyMsg(b []byte) {
 	if err := json.Unmarshal(b, &n); err != nil {
 		log.Fatal().Err(err).Int("len", len(b)).Msg("BackendClient.Notify: cannot decode message")
 	}
+	if n.HelloResult != nil {
+		cc.SetMaxMessageSize(n.HelloResult.MaxMessageSize)
+		return
+	}
+	if n.RequestID != 0 {
+		cc.hmu.Lock()
+		fn := cc.handlers[n.RequestID]
+		cc.hmu.Unlock()
+		if fn != nil {
+			fn(n)
+			return
+		}
+	}
 	if cc.notify != nil {
 		cc.notify(n)
 	}
 }
 
+// Run sends a command passing the notifications it sends to fn instead of the notify callback until
+// the returned function is called. Commands run this way can be sent concurrently on the same connection.
+func (cc *CommandClient) Run(cmd Command, fn func(Notify)) func() {
+	cmd.RequestID = atomic.AddUint64(&cc.lastID, 1)
+	cc.hmu.Lock()
+	cc.handlers[cmd.RequestID] = fn
+	cc.hmu.Unlock()
+
+	cc.send(cmd)
+
+	return func() {
+		cc.hmu.Lock()
+		delete(cc.handlers, cmd.RequestID)
+		cc.hmu.Unlock()
+	}
+}
+
 func (cc *CommandClient) send(cmd Command) {
+	if cmd.RequestID == 0 {
+		cmd.RequestID = atomic.AddUint64(&cc.lastID, 1)
+	}
 	b, err := json.Marshal(cmd)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed json.Marshal(cmd)")
@@ -274,6 +911,10 @@ func (cc *CommandClient) Pack(args *PackArgs) {
 	cc.send(Command{Pack: args})
 }
 
+func (cc *CommandClient) Checkout(args *CheckoutArgs) {
+	cc.send(Command{Checkout: args})
+}
+
 func (cc *CommandClient) Quote(args *QuoteArgs) {
 	cc.send(Command{Quote: args})
 }
@@ -286,21 +927,151 @@ func (cc *CommandClient) Get(args *GetArgs) {
 	cc.send(Command{Get: args})
 }
 
+func (cc *CommandClient) Market(args *MarketArgs) {
+	cc.send(Command{Market: args})
+}
+
+func (cc *CommandClient) List(args *ListArgs) {
+	cc.send(Command{List: args})
+}
+
+func (cc *CommandClient) Region(args *RegionArgs) {
+	cc.send(Command{Region: args})
+}
+
+func (cc *CommandClient) Inspect(args *InspectArgs) {
+	cc.send(Command{Inspect: args})
+}
+
+func (cc *CommandClient) Deals(args *DealsArgs) {
+	cc.send(Command{Deals: args})
+}
+
+func (cc *CommandClient) Rules(args *RulesArgs) {
+	cc.send(Command{Rules: args})
+}
+
+func (cc *CommandClient) Funds(args *FundsArgs) {
+	cc.send(Command{Funds: args})
+}
+
+func (cc *CommandClient) Cost(args *CostArgs) {
+	cc.send(Command{Cost: args})
+}
+
+func (cc *CommandClient) Ask(args *AskArgs) {
+	cc.send(Command{Ask: args})
+}
+
+func (cc *CommandClient) Retrievals(args *RetrievalsArgs) {
+	cc.send(Command{Retrievals: args})
+}
+
+func (cc *CommandClient) Find(args *FindArgs) {
+	cc.send(Command{Find: args})
+}
+
+func (cc *CommandClient) BatchGet(args *BatchGetArgs) {
+	cc.send(Command{BatchGet: args})
+}
+
+func (cc *CommandClient) Receipts(args *ReceiptsArgs) {
+	cc.send(Command{Receipts: args})
+}
+
+func (cc *CommandClient) Schema(args *SchemaArgs) {
+	cc.send(Command{Schema: args})
+}
+
 func (cc *CommandClient) SetNotifyCallback(fn func(Notify)) {
 	cc.notify = fn
 }
 
-// MaxMessageSize is the maximum message size, in bytes.
+// MaxMessageSize is the maximum message size, in bytes, unless the client and the daemon negotiate
+// another one when connecting
 const MaxMessageSize = 10 << 20
 
+// MinMessageSize is the smallest message size we negotiate so commands and results still fit
+const MinMessageSize = 64 << 10
+
+// MaxMessageSizeLimit is the largest message size we negotiate
+const MaxMessageSizeLimit = 1 << 30
+
+// helloTimeout is how long a client waits for the daemon to answer its hello. Daemons which don't
+// negotiate never answer.
+const helloTimeout = time.Second
+
+// clampMessageSize bounds a message size to the sizes we negotiate, zero being the default
+func clampMessageSize(size uint32) uint32 {
+	switch {
+	case size == 0:
+		return MaxMessageSize
+	case size < MinMessageSize:
+		return MinMessageSize
+	case size > MaxMessageSizeLimit:
+		return MaxMessageSizeLimit
+	}
+	return size
+}
+
+// NegotiateMessageSize returns the size a client and a daemon agree on: the smallest of both
+func NegotiateMessageSize(client, daemon uint32) uint32 {
+	client, daemon = clampMessageSize(client), clampMessageSize(daemon)
+	if client < daemon {
+		return client
+	}
+	return daemon
+}
+
+// Hello negotiates the message size with the daemon on a new connection before any other command is
+// sent. Daemons which don't negotiate keep MaxMessageSize and never close idle connections. It returns
+// the size both sides agreed on.
+func Hello(c net.Conn, size uint32) (*HelloResult, error) {
+	b, err := json.Marshal(Command{Hello: &HelloArgs{MaxMessageSize: clampMessageSize(size)}})
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteMsg(c, b); err != nil {
+		return nil, err
+	}
+	if err := c.SetReadDeadline(time.Now().Add(helloTimeout)); err != nil {
+		return nil, err
+	}
+	defer c.SetReadDeadline(time.Time{})
+	for {
+		msg, err := ReadMsg(c)
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() {
+			return &HelloResult{MaxMessageSize: MaxMessageSize}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// Notifications broadcast to all clients may come before our answer
+		var n Notify
+		if err := json.Unmarshal(msg, &n); err != nil {
+			return nil, err
+		}
+		if n.HelloResult != nil {
+			return n.HelloResult, nil
+		}
+	}
+}
+
+// ReadMsg reads a message of at most MaxMessageSize bytes
 func ReadMsg(r io.Reader) ([]byte, error) {
+	return ReadMsgLimit(r, MaxMessageSize)
+}
+
+// ReadMsgLimit reads a message of at most limit bytes
+func ReadMsgLimit(r io.Reader, limit uint32) ([]byte, error) {
 	cb := make([]byte, 4)
 	_, err := io.ReadFull(r, cb)
 	if err != nil {
 		return nil, err
 	}
 	n := binary.LittleEndian.Uint32(cb)
-	if n > MaxMessageSize {
+	if n > limit {
 		return nil, fmt.Errorf("ReadMsg: message too large: %d bytes", n)
 	}
 	b := make([]byte, n)
@@ -314,10 +1085,16 @@ func ReadMsg(r io.Reader) ([]byte, error) {
 	return b, nil
 }
 
+// WriteMsg writes a message of at most MaxMessageSize bytes
 func WriteMsg(w io.Writer, b []byte) error {
+	return WriteMsgLimit(w, b, MaxMessageSize)
+}
+
+// WriteMsgLimit writes a message of at most limit bytes
+func WriteMsgLimit(w io.Writer, b []byte, limit uint32) error {
 
 	cb := make([]byte, 4)
-	if len(b) > MaxMessageSize {
+	if uint64(len(b)) > uint64(limit) {
 		return fmt.Errorf("WriteMsg: message too large: %d bytes", len(b))
 	}
 	binary.LittleEndian.PutUint32(cb, uint32(len(b)))
@@ -0,0 +1,175 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateMessageSize(t *testing.T) {
+	require.Equal(t, uint32(MaxMessageSize), NegotiateMessageSize(0, 0))
+	require.Equal(t, uint32(1<<20), NegotiateMessageSize(1<<20, 0))
+	require.Equal(t, uint32(1<<20), NegotiateMessageSize(64<<20, 1<<20))
+	require.Equal(t, uint32(MinMessageSize), NegotiateMessageSize(1, 0))
+	require.Equal(t, uint32(MaxMessageSizeLimit), NegotiateMessageSize(1<<31, 1<<31))
+}
+
+func TestHello(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("negotiates with the daemon", func(t *testing.T) {
+		cc, sc := net.Pipe()
+		defer cc.Close()
+		s := &server{maxMsgSize: 1 << 20}
+		go s.serveConn(ctx, sc)
+
+		res, err := Hello(cc, 64<<20)
+		require.NoError(t, err)
+		size := res.MaxMessageSize
+		require.Equal(t, uint32(1<<20), size)
+		require.Equal(t, size, s.connMsgSize(sc))
+
+		// Messages larger than the negotiated size are rejected
+		require.Error(t, WriteMsgLimit(cc, make([]byte, 2<<20), size))
+	})
+
+	t.Run("daemons which don't negotiate keep the default", func(t *testing.T) {
+		cc, sc := net.Pipe()
+		defer cc.Close()
+		defer sc.Close()
+		go func() {
+			for {
+				if _, err := ReadMsg(sc); err != nil {
+					return
+				}
+			}
+		}()
+
+		res, err := Hello(cc, 64<<20)
+		require.NoError(t, err)
+		require.Equal(t, uint32(MaxMessageSize), res.MaxMessageSize)
+		require.Equal(t, time.Duration(0), res.IdleTimeout)
+	})
+}
+
+func TestClientConns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("closes idle connections", func(t *testing.T) {
+		cc, sc := net.Pipe()
+		defer cc.Close()
+		s := &server{idleTimeout: 200 * time.Millisecond}
+		go s.serveConn(ctx, sc)
+
+		res, err := Hello(cc, 0)
+		require.NoError(t, err)
+		require.Equal(t, s.idleTimeout, res.IdleTimeout)
+
+		// Empty messages keep the connection open
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+			require.NoError(t, WriteMsg(cc, nil))
+		}
+		_, err = ReadMsg(cc)
+		require.Error(t, err)
+	})
+
+	t.Run("sends results to the client running the command", func(t *testing.T) {
+		s := &server{}
+		nd := &node{}
+		var broadcast []Notify
+		nd.notify = func(n Notify) {
+			broadcast = append(broadcast, n)
+		}
+
+		c1, sc1 := net.Pipe()
+		defer c1.Close()
+		c2, sc2 := net.Pipe()
+		defer c2.Close()
+		cc1 := s.addConn(sc1)
+		s.addConn(sc2)
+
+		go nd.send(withNotify(ctx, cc1.notify), Notify{PingResult: &PingResult{ID: "first"}})
+
+		msg, err := ReadMsg(c1)
+		require.NoError(t, err)
+		require.Contains(t, string(msg), "first")
+		require.Len(t, broadcast, 0)
+
+		// The other client receives nothing
+		c2.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, err = ReadMsg(c2)
+		require.Error(t, err)
+
+		nd.send(ctx, Notify{PingResult: &PingResult{ID: "all"}})
+		require.Len(t, broadcast, 1)
+	})
+}
+
+func TestRequestIDs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("client dispatches notifications by request ID", func(t *testing.T) {
+		var sent []Command
+		cc := NewCommandClient(func(b []byte) {
+			var cmd Command
+			require.NoError(t, json.Unmarshal(b, &cmd))
+			sent = append(sent, cmd)
+		})
+		var fallback []Notify
+		cc.SetNotifyCallback(func(n Notify) {
+			fallback = append(fallback, n)
+		})
+		var first, second []Notify
+		done := cc.Run(Command{Ping: &PingArgs{}}, func(n Notify) { first = append(first, n) })
+		cc.Run(Command{Ping: &PingArgs{}}, func(n Notify) { second = append(second, n) })
+		cc.Ping("")
+		require.Len(t, sent, 3)
+		require.NotEqual(t, sent[0].RequestID, sent[1].RequestID)
+		require.NotEqual(t, uint64(0), sent[2].RequestID)
+
+		cc.GotNotifyMsg(marshalNotify(Notify{RequestID: sent[1].RequestID, PingResult: &PingResult{ID: "second"}}))
+		cc.GotNotifyMsg(marshalNotify(Notify{RequestID: sent[0].RequestID, PingResult: &PingResult{ID: "first"}}))
+		cc.GotNotifyMsg(marshalNotify(Notify{PingResult: &PingResult{ID: "broadcast"}}))
+		require.Len(t, first, 1)
+		require.Equal(t, "first", first[0].PingResult.ID)
+		require.Len(t, second, 1)
+		require.Equal(t, "second", second[0].PingResult.ID)
+		require.Len(t, fallback, 1)
+
+		// Once done the notifications of a command go to the notify callback
+		done()
+		cc.GotNotifyMsg(marshalNotify(Notify{RequestID: sent[0].RequestID, PingResult: &PingResult{ID: "late"}}))
+		require.Len(t, first, 1)
+		require.Len(t, fallback, 2)
+	})
+
+	t.Run("daemon tags the notifications of a command", func(t *testing.T) {
+		nd := newTestNode(ctx, mocknet.New(ctx), t)
+		s := &server{node: nd}
+		s.cs = NewCommandServer(nd, s.writeToClients)
+
+		c, sc := net.Pipe()
+		defer c.Close()
+		go s.serveConn(ctx, sc)
+
+		b, err := json.Marshal(Command{RequestID: 42, Ping: &PingArgs{}})
+		require.NoError(t, err)
+		require.NoError(t, WriteMsg(c, b))
+
+		msg, err := ReadMsg(c)
+		require.NoError(t, err)
+		var n Notify
+		require.NoError(t, json.Unmarshal(msg, &n))
+		require.Equal(t, uint64(42), n.RequestID)
+		require.Equal(t, nd.host.ID().String(), n.PingResult.ID)
+	})
+}
@@ -11,10 +11,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-address"
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
 	keystore "github.com/ipfs/go-ipfs-keystore"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/filecoin/storage"
 	"github.com/myelnet/pop/internal/testutil"
 	"github.com/myelnet/pop/supply"
 	"github.com/stretchr/testify/require"
@@ -148,16 +153,27 @@ func TestStatusAndPack(t *testing.T) {
 	cn.Status(ctx, &StatusArgs{})
 	<-stat
 
-	pac := make(chan string, 1)
+	pac := make(chan *PackResult, 1)
 	cn.notify = func(n Notify) {
 		require.Equal(t, n.PackResult.Err, "")
 
-		pac <- n.PackResult.DataCID
+		pac <- n.PackResult
 	}
 	cn.Pack(ctx, &PackArgs{})
-	out := <-pac
+	pr := <-pac
+	out := pr.DataCID
 	require.NotEqual(t, out, "")
 
+	// The packed content is recorded with the store holding its blocks
+	ins := make(chan *InspectResult, 1)
+	cn.notify = func(n Notify) {
+		ins <- n.InspectResult
+	}
+	cn.Inspect(ctx, &InspectArgs{Ref: out})
+	ir := <-ins
+	require.Equal(t, "", ir.Err)
+	require.Equal(t, pr.StoreID, ir.Content.StoreID)
+
 	// Export back out
 	path := fmt.Sprintf("/%s/data2", out)
 	loc := make(chan bool, 1)
@@ -180,3 +196,89 @@ func TestStatusAndPack(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, data2, newb)
 }
+
+type mockStorer struct {
+	RemoteStorer
+	fn func(storage.TransferProgress)
+}
+
+func (m *mockStorer) WatchTransfers(rcpt *storage.Receipt, fn func(storage.TransferProgress)) datatransfer.Unsubscribe {
+	m.fn = fn
+	return func() {}
+}
+
+func TestWatchTransfers(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	rs := &mockStorer{}
+	nd := &node{rs: rs}
+	var transfers []*DealTransfer
+	nd.notify = func(n Notify) {
+		transfers = append(transfers, n.PushResult.Transfer)
+	}
+
+	gen := blocksutil.NewBlockGenerator()
+	d1, d2 := gen.Next().Cid(), gen.Next().Cid()
+	m1, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	m2, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	nd.watchTransfers(ctx, &storage.Receipt{
+		Miners:   []address.Address{m1, m2},
+		DealRefs: []cid.Cid{d1, d2},
+	})
+
+	rs.fn(storage.TransferProgress{Miner: m1, Deal: d1, Sent: 100})
+	// Updates are throttled
+	rs.fn(storage.TransferProgress{Miner: m1, Deal: d1, Sent: 200})
+	rs.fn(storage.TransferProgress{Miner: m2, Deal: d2, Sent: 100})
+	rs.fn(storage.TransferProgress{Miner: m1, Deal: d1, Sent: 300, Done: true})
+	rs.fn(storage.TransferProgress{Miner: m2, Deal: d2, Sent: 100, Done: true, Err: "miner disconnected"})
+
+	require.Len(t, transfers, 4)
+	require.Equal(t, m1.String(), transfers[0].Miner)
+	require.Equal(t, uint64(100), transfers[0].Sent)
+	require.Equal(t, d2.String(), transfers[1].Deal)
+	require.True(t, transfers[2].Done)
+	require.Equal(t, uint64(300), transfers[2].Sent)
+	require.Equal(t, "miner disconnected", transfers[3].Err)
+}
+
+func TestStorageResult(t *testing.T) {
+	gen := blocksutil.NewBlockGenerator()
+	root, piece := gen.Next().Cid(), gen.Next().Cid()
+	p1, p2 := gen.Next().Cid(), gen.Next().Cid()
+	m1, err := address.NewIDAddress(1000)
+	require.NoError(t, err)
+	m2, err := address.NewIDAddress(1001)
+	require.NoError(t, err)
+	m3, err := address.NewIDAddress(1002)
+	require.NoError(t, err)
+
+	com := &DataRef{PayloadCID: root, PieceCID: piece, PieceSize: 2048}
+	pr := storageResult(com, &storage.Receipt{
+		Miners:   []address.Address{m1, m2},
+		DealRefs: []cid.Cid{p1, p2},
+		Label:    "backup",
+		Outcomes: []storage.DealOutcome{
+			{Miner: m1, Proposal: p1},
+			{Miner: m3, Err: "miner offline"},
+			{Miner: m2, Proposal: p2},
+		},
+	}, nil)
+	require.Equal(t, root.String(), pr.Root)
+	require.Equal(t, piece.String(), pr.PieceCID)
+	require.Equal(t, uint64(2048), pr.PieceSize)
+	require.Equal(t, "backup", pr.Label)
+	require.Equal(t, map[string]string{m1.String(): p1.String(), m2.String(): p2.String()}, pr.Proposals)
+	require.Equal(t, map[string]string{m3.String(): "miner offline"}, pr.FailedDeals)
+	require.Equal(t, "", pr.PieceFile)
+
+	// Offline deals report the piece we exported
+	exported := gen.Next().Cid()
+	pr = storageResult(com, &storage.Receipt{}, &storage.Piece{Root: root, Path: "/tmp/piece.car", PieceCID: exported, PieceSize: 4096})
+	require.Equal(t, exported.String(), pr.PieceCID)
+	require.Equal(t, uint64(4096), pr.PieceSize)
+	require.Equal(t, "/tmp/piece.car", pr.PieceFile)
+}
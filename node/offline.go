@@ -0,0 +1,177 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/myelnet/pop/filecoin/storage"
+	"github.com/rs/zerolog/log"
+)
+
+// OfflineCheckInterval is how often we check if queued operations can run when no peer connected.
+// It mostly matters for the Filecoin API which doesn't notify us when it's reachable again.
+const OfflineCheckInterval = time.Minute
+
+// offlineQueue persists the pushes we couldn't run while offline so they survive restarts.
+// Adding and packing content only need our local store so they never need queuing.
+type offlineQueue struct {
+	mu  sync.Mutex
+	ds  datastore.Batching
+	seq uint64
+}
+
+type queuedPush struct {
+	key  datastore.Key
+	args PushArgs
+}
+
+func newOfflineQueue(ds datastore.Batching) (*offlineQueue, error) {
+	q := &offlineQueue{ds: namespace.Wrap(ds, datastore.NewKey("/offline-queue"))}
+	entries, err := q.list()
+	if err != nil {
+		return nil, err
+	}
+	// Keep appending after the last entry we had
+	for _, e := range entries {
+		var seq uint64
+		if _, err := fmt.Sscanf(e.key.Name(), "%020d", &seq); err == nil && seq >= q.seq {
+			q.seq = seq + 1
+		}
+	}
+	return q, nil
+}
+
+// add appends a push to the queue
+func (q *offlineQueue) add(args PushArgs) error {
+	b, err := json.Marshal(args)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Zero padded keys are returned in the order they were added
+	key := datastore.NewKey(fmt.Sprintf("%020d", q.seq))
+	q.seq++
+	return q.ds.Put(key, b)
+}
+
+// list returns the queued pushes in the order they were added
+func (q *offlineQueue) list() ([]queuedPush, error) {
+	res, err := q.ds.Query(query.Query{Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]queuedPush, 0, len(entries))
+	for _, e := range entries {
+		var args PushArgs
+		if err := json.Unmarshal(e.Value, &args); err != nil {
+			return nil, err
+		}
+		out = append(out, queuedPush{datastore.NewKey(e.Key), args})
+	}
+	return out, nil
+}
+
+func (q *offlineQueue) remove(key datastore.Key) error {
+	return q.ds.Delete(key)
+}
+
+// canPush returns whether we can reach what a push needs: peers for caching and the Filecoin API for storage
+func (nd *node) canPush(args *PushArgs) bool {
+	if !args.CacheOnly && args.StorageRF > 0 && !nd.exch.IsFilecoinOnline() {
+		return false
+	}
+	if !args.NoCache && (args.CacheRF > 0 || len(args.RegionRF) > 0) && len(nd.connPeers()) == 0 {
+		return false
+	}
+	return true
+}
+
+// queuePush defers a push until we are online. The ref is resolved now so packing new commits in the meantime
+// doesn't change what we push.
+func (nd *node) queuePush(args *PushArgs) (string, error) {
+	com, err := nd.getCommit(args.Ref)
+	if err != nil {
+		return "", err
+	}
+	queued := *args
+	queued.Ref = com.PayloadCID.String()
+	return queued.Ref, nd.queue.add(queued)
+}
+
+// flushQueue runs the queued pushes we can now execute in the order they were queued.
+// Results are notified to any client connected at the time.
+func (nd *node) flushQueue(ctx context.Context) {
+	entries, err := nd.queue.list()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read offline queue")
+		return
+	}
+	for _, e := range entries {
+		if !nd.canPush(&e.args) {
+			continue
+		}
+		if err := nd.queue.remove(e.key); err != nil {
+			log.Error().Err(err).Msg("failed to remove queued push")
+			continue
+		}
+		log.Info().Str("ref", e.args.Ref).Msg("running queued push")
+		args := e.args
+		// If we lose connectivity again the push is queued back
+		nd.Push(ctx, &args)
+	}
+}
+
+// syncOnReconnect runs queued operations as soon as peers or the Filecoin API become reachable
+func (nd *node) syncOnReconnect(ctx context.Context) {
+	reconnected := make(chan struct{}, 1)
+	notifee := &network.NotifyBundle{
+		ConnectedF: func(network.Network, network.Conn) {
+			select {
+			case reconnected <- struct{}{}:
+			default:
+			}
+		},
+	}
+	nd.host.Network().Notify(notifee)
+	defer nd.host.Network().StopNotify(notifee)
+
+	ticker := time.NewTicker(OfflineCheckInterval)
+	defer ticker.Stop()
+	for {
+		nd.flushQueue(ctx)
+		select {
+		case <-reconnected:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// quoteMiners selects the miners of a fresh market quote for pushes which couldn't ask the user to pick
+// miners while we were offline
+func (nd *node) quoteMiners(ctx context.Context, com *DataRef, args *PushArgs) ([]storage.Miner, error) {
+	quote, err := nd.rs.GetMarketQuote(ctx, storage.QuoteParams{
+		PieceSize: uint64(com.PieceSize),
+		Duration:  args.Duration,
+		RF:        args.StorageRF,
+		MaxPrice:  args.MaxPrice,
+		Verified:  args.Verified,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return quote.Miners, nil
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfflineQueue(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	q, err := newOfflineQueue(ds)
+	require.NoError(t, err)
+	for i := 0; i < 12; i++ {
+		require.NoError(t, q.add(PushArgs{Ref: string(rune('a' + i)), CacheOnly: true, CacheRF: 1}))
+	}
+
+	// The queue is restored after a restart and keeps the order
+	q, err = newOfflineQueue(ds)
+	require.NoError(t, err)
+	require.NoError(t, q.add(PushArgs{Ref: "z"}))
+
+	entries, err := q.list()
+	require.NoError(t, err)
+	require.Len(t, entries, 13)
+	for i := 0; i < 12; i++ {
+		require.Equal(t, string(rune('a'+i)), entries[i].args.Ref)
+	}
+	require.Equal(t, "z", entries[12].args.Ref)
+
+	require.NoError(t, q.remove(entries[0].key))
+	entries, err = q.list()
+	require.NoError(t, err)
+	require.Len(t, entries, 12)
+	require.Equal(t, "b", entries[0].args.Ref)
+}
+
+func TestCanPush(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	nd := newTestNode(ctx, mn, t)
+	newTestNode(ctx, mn, t)
+
+	args := &PushArgs{CacheOnly: true, CacheRF: 1}
+	require.False(t, nd.canPush(args))
+	// Storage deals need the Filecoin API
+	require.False(t, nd.canPush(&PushArgs{NoCache: true, StorageRF: 1}))
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	require.True(t, nd.canPush(args))
+}
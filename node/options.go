@@ -0,0 +1,148 @@
+package node
+
+import (
+	"github.com/ipfs/go-datastore"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/myelnet/pop/supply"
+)
+
+// DefaultRegions are the regions a node joins when none is given
+var DefaultRegions = []string{"Global"}
+
+// Option configures the node started by NewNode
+type Option func(*Options)
+
+// DefaultOptions returns the options NewNode starts from:
+//   - the repo is ~/.pop or $POP_PATH if set
+//   - the node joins the DefaultRegions
+//   - without a Filecoin API the node only makes and serves free retrievals and cannot store on Filecoin
+//   - the DAGs we pull or import are bounded by supply.DefaultDAGLimits
+//   - metrics are disabled
+//   - the datastore is a badger datastore in the repo and blocks are not compressed
+func DefaultOptions() Options {
+	opts := Options{
+		Regions: append([]string{}, DefaultRegions...),
+	}
+	if path, err := utils.FullPath(utils.RepoPath()); err == nil {
+		opts.RepoPath = path
+	}
+	return opts
+}
+
+// WithOptions replaces all the options e.g. with the ones loaded from a config file. Options given
+// after it still apply.
+func WithOptions(o Options) Option {
+	return func(opts *Options) {
+		*opts = o
+	}
+}
+
+// WithRepoPath persists the keys and the datastore of the node in the given directory
+func WithRepoPath(path string) Option {
+	return func(opts *Options) {
+		opts.RepoPath = path
+	}
+}
+
+// WithRegions joins the given regions instead of the DefaultRegions
+func WithRegions(regions ...string) Option {
+	return func(opts *Options) {
+		opts.Regions = regions
+	}
+}
+
+// WithBootstrapPeers connects to the given peer multiaddrs to discover the network
+func WithBootstrapPeers(peers ...string) Option {
+	return func(opts *Options) {
+		opts.BootstrapPeers = peers
+	}
+}
+
+// WithFilecoinAPI connects to the Filecoin API at the websocket endpoint to pay for retrievals and
+// store content with miners. The token is sent as Authorization header and may be empty.
+func WithFilecoinAPI(endpoint, token string) Option {
+	return func(opts *Options) {
+		opts.FilEndpoint = endpoint
+		opts.FilToken = token
+	}
+}
+
+// WithFilecoinClient uses the given Filecoin API instead of connecting to an endpoint. Tests can run
+// the node against a filecoin.FakeAPI to store and pay for retrievals without a lotus node.
+func WithFilecoinClient(api filecoin.API) Option {
+	return func(opts *Options) {
+		opts.FilecoinAPI = api
+	}
+}
+
+// WithPayer pays for retrievals with the funds of another address who authorized us with the JSON
+// file at authPath. The payer key is held by the wallet driver at the walletURI, the repo keystore if empty.
+func WithPayer(authPath, walletURI string) Option {
+	return func(opts *Options) {
+		opts.PayerAuth = authPath
+		opts.PayerWallet = walletURI
+	}
+}
+
+// WithLimits bounds the DAGs we pull or import. Zero values use the default limits.
+func WithLimits(limits supply.DAGLimits) Option {
+	return func(opts *Options) {
+		opts.MaxBlockSize = limits.MaxBlockSize
+		opts.MaxLinks = limits.MaxLinks
+		opts.MaxDepth = limits.MaxDepth
+	}
+}
+
+// WithProfile tunes concurrency and memory defaults for a class of devices e.g. ProfileLowPower.
+// Options set explicitly take precedence over the profile.
+func WithProfile(name string) Option {
+	return func(opts *Options) {
+		opts.Profile = name
+	}
+}
+
+// WithMetrics serves Prometheus metrics on the given address
+func WithMetrics(addr string) Option {
+	return func(opts *Options) {
+		opts.MetricsAddr = addr
+	}
+}
+
+// WithHTTPGateway serves content over HTTP on the given address
+func WithHTTPGateway(addr string) Option {
+	return func(opts *Options) {
+		opts.HTTPGateway = addr
+	}
+}
+
+// WithRPC serves the JSON-RPC API on the given address to the clients presenting the token.
+// An empty token uses the token generated in the repo.
+func WithRPC(addr, token string) Option {
+	return func(opts *Options) {
+		opts.RPCAddr = addr
+		opts.RPCToken = token
+	}
+}
+
+// WithDatastore keeps the node state in the given datastore instead of a badger datastore in the repo
+func WithDatastore(ds datastore.Batching) Option {
+	return func(opts *Options) {
+		opts.Datastore = ds
+	}
+}
+
+// WithBlockstore reads and writes blocks from the given blockstore instead of the datastore
+func WithBlockstore(bs blockstore.Blockstore) Option {
+	return func(opts *Options) {
+		opts.Blockstore = bs
+	}
+}
+
+// WithTransforms registers transforms deriving variants of the files we pack on top of the DefaultTransforms
+func WithTransforms(ts ...Transform) Option {
+	return func(opts *Options) {
+		opts.Transforms = append(opts.Transforms, ts...)
+	}
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/supply"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions(t *testing.T) {
+	opts := DefaultOptions()
+	require.Equal(t, DefaultRegions, opts.Regions)
+	require.NotEqual(t, "", opts.RepoPath)
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	bs := blockstore.NewBlockstore(ds)
+	fapi := filecoin.NewFakeAPI()
+	for _, o := range []Option{
+		WithOptions(Options{Capacity: 1 << 30, Regions: []string{"Asia"}}),
+		WithRepoPath("/tmp/pop"),
+		WithRegions("Europe", "Africa"),
+		WithFilecoinAPI("wss://api.node.glif.io", "token"),
+		WithLimits(supply.DAGLimits{MaxLinks: 10}),
+		WithMetrics(":9100"),
+		WithDatastore(ds),
+		WithBlockstore(bs),
+		WithFilecoinClient(fapi),
+	} {
+		o(&opts)
+	}
+	require.Equal(t, uint64(1<<30), opts.Capacity)
+	require.Equal(t, "/tmp/pop", opts.RepoPath)
+	require.Equal(t, []string{"Europe", "Africa"}, opts.Regions)
+	require.Equal(t, "wss://api.node.glif.io", opts.FilEndpoint)
+	require.Equal(t, "token", opts.FilToken)
+	require.Equal(t, 10, opts.MaxLinks)
+	require.Equal(t, uint64(0), opts.MaxBlockSize)
+	require.Equal(t, ":9100", opts.MetricsAddr)
+	require.Equal(t, ds, opts.Datastore)
+	require.Equal(t, bs, opts.Blockstore)
+	require.Equal(t, fapi, opts.FilecoinAPI)
+
+	// The defaults are not shared between nodes
+	opts = DefaultOptions()
+	opts.Regions[0] = "Europe"
+	require.Equal(t, "Global", DefaultRegions[0])
+}
@@ -0,0 +1,43 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/retrieval"
+)
+
+// ProviderPolicy decides which retrievals we serve for free and bounds the bandwidth we spend serving
+// content. Empty fields add no exception or limit.
+type ProviderPolicy struct {
+	FreePeers     []string // FreePeers are the peer IDs retrieving any of our content for free
+	FreeRoots     []string // FreeRoots are the content CIDs anyone can retrieve for free
+	DailyQuota    uint64   // DailyQuota is how many bytes each peer can retrieve from us per day
+	MaxUploadRate uint64   // MaxUploadRate is how many bytes per second we serve to all peers
+	AuditQuota    uint64   // AuditQuota is how many bytes publishers audit their content for free per day
+}
+
+// parse converts the policy into a retrieval policy
+func (pp ProviderPolicy) parse() (retrieval.Policy, error) {
+	policy := retrieval.Policy{
+		DailyQuota:    pp.DailyQuota,
+		MaxUploadRate: pp.MaxUploadRate,
+		AuditQuota:    pp.AuditQuota,
+	}
+	for _, s := range pp.FreePeers {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return policy, fmt.Errorf("invalid free peer %s: %w", s, err)
+		}
+		policy.FreePeers = append(policy.FreePeers, p)
+	}
+	for _, s := range pp.FreeRoots {
+		c, err := cid.Decode(s)
+		if err != nil {
+			return policy, fmt.Errorf("invalid free root %s: %w", s, err)
+		}
+		policy.FreeRoots = append(policy.FreeRoots, c)
+	}
+	return policy, nil
+}
@@ -6,13 +6,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/filecoin-project/go-address"
+	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-multistore"
+	"github.com/filecoin-project/go-state-types/abi"
 	"github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
@@ -38,10 +44,16 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/p2p/net/conngater"
 	"github.com/libp2p/go-libp2p/p2p/protocol/ping"
+	ma "github.com/multiformats/go-multiaddr"
 	mh "github.com/multiformats/go-multihash"
 	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/build"
+	"github.com/myelnet/pop/edge"
 	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/filecoin/storage"
+	"github.com/myelnet/pop/internal/carstore"
+	"github.com/myelnet/pop/internal/compress"
 	"github.com/myelnet/pop/internal/utils"
 	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
@@ -54,11 +66,17 @@ const DefaultHashFunction = uint64(mh.BLAKE2B_MIN + 31)
 const unixfsLinksPerLevel = 1024
 const KLibp2pHost = "libp2p-host"
 
+// offerWindow is how long we wait for more offers after the first one when comparing providers
+const offerWindow = 500 * time.Millisecond
+
+// routingTimeout is how long we look for caches on the DHT when gossip discovery failed
+const routingTimeout = 15 * time.Second
+
 // ErrFilecoinRPCOffline is returned when the node is running without a provided filecoin api endpoint + token
 var ErrFilecoinRPCOffline = errors.New("filecoin RPC is offline")
 
 // ErrAllDealsFailed is returned when all storage deals failed to get started
-var ErrAllDealsFailed = errors.New("all deals failed")
+var ErrAllDealsFailed = storage.ErrAllDealsFailed
 
 // ErrNoDAGForPacking is returned when no DAGs are staged in the index before packing
 var ErrNoDAGForPacking = errors.New("no DAG for packing")
@@ -72,6 +90,9 @@ var ErrNodeNotFound = errors.New("node not found")
 // ErrQuoteNotFound is returned when we are trying to store but couldn't get a quote
 var ErrQuoteNotFound = errors.New("quote not found")
 
+// ErrNoPieceDir is returned when pushing offline without a directory to export the piece to
+var ErrNoPieceDir = errors.New("offline push needs a directory to export the piece to")
+
 // ErrInvalidPeer is returned when trying to ping a peer with invalid peer ID or address
 var ErrInvalidPeer = errors.New("invalid peer ID or address")
 
@@ -79,8 +100,19 @@ var ErrInvalidPeer = errors.New("invalid peer ID or address")
 type Options struct {
 	// RepoPath is the file system path to use to persist our datastore
 	RepoPath string
-	// SocketPath is the unix socket path to listen on
+	// SocketPath is the unix socket path to listen on, we listen on a local tcp port if empty
 	SocketPath string
+	// SocketMode is the file mode of the unix socket. Zero uses DefaultSocketMode.
+	SocketMode os.FileMode
+	// IdleTimeout closes client connections without any message for this long. Zero uses
+	// DefaultIdleTimeout and a negative timeout never closes them.
+	IdleTimeout time.Duration
+	// Profile tunes concurrency and memory defaults for a class of devices e.g. ProfileLowPower for
+	// Raspberry Pi class caches. Empty uses ProfileDefault.
+	Profile string
+	// MaxMessageSize is the largest message in bytes clients can send us on the socket and we send them
+	// if they accept it. Zero uses the default MaxMessageSize.
+	MaxMessageSize uint32
 	// BootstrapPeers is a peer address to connect to for discovering other peers
 	BootstrapPeers []string
 	// FilEndpoint is the websocket url for accessing a remote filecoin api
@@ -92,6 +124,109 @@ type Options struct {
 	// Regions is a list of regions a provider chooses to support.
 	// Nothing prevents providers from participating in regions outside of their geographic location however they may get less deals since the latency is likely to be higher
 	Regions []string
+	// CarStores writes the blocks of each store in a single CAR file instead of individual datastore keys
+	CarStores bool
+	// Capacity is the storage space in bytes we advertise to publishers on the market
+	Capacity uint64
+	// Compression is the codec used to compress blocks on disk (none, flate, gzip or zlib).
+	// It must be set when creating the repo as existing blocks are not converted: the node refuses to
+	// start with another codec than the one the repo was created with.
+	Compression string
+	// Replication is the strategy selecting which caches we dispatch content to
+	Replication string
+	// Eviction is the policy evicting cached content once we get close to our capacity
+	Eviction string
+	// ReleaseEndpoint is an optional URL to check for new releases
+	ReleaseEndpoint string
+	// MaxVersionLag is the number of minor versions we can lag behind our peers before warning.
+	// Defaults to DefaultMaxVersionLag.
+	MaxVersionLag int
+	// Gateways are multiaddrs of caches relaying our dispatches to regions we have no peers in
+	Gateways []string
+	// Gateway relays dispatches from publishers outside our regions to the caches in our regions
+	Gateway bool
+	// MaxBlockSize, MaxLinks and MaxDepth bound the DAGs we pull or import. Zero uses the default limit.
+	MaxBlockSize uint64
+	MaxLinks     int
+	MaxDepth     int
+	// MaxPulls is how many dispatched contents we pull at the same time. Zero uses the default.
+	MaxPulls int
+	// DispatchRate is how many dispatch requests per minute we accept from a single publisher. Zero uses
+	// the default, a negative value removes the limit.
+	DispatchRate int
+	// PublisherQuota is how many bytes each publisher can cache on our node. Zero means no limit.
+	PublisherQuota uint64
+	// AcceptRules replace the rules deciding which dispatches we accept when set. Otherwise we keep
+	// the rules set last time.
+	AcceptRules *RuleSet
+	// Policy decides which peers and content we serve for free and bounds the bytes each peer can
+	// retrieve per day and our upload rate
+	Policy ProviderPolicy
+	// ColdStore is a bucket URL or a directory where evicted content is offloaded. ColdStoreAuth is either
+	// aws4:<access key>:<secret key>:<region> to sign requests to S3 buckets or the Authorization header
+	// sent to http buckets.
+	ColdStore     string
+	ColdStoreAuth string
+	// SectorAccessor lets a cache colocated with a miner serve content from its unsealed sectors.
+	// SectorDir is a directory of unsealed pieces named <piece cid>.car used when it isn't set.
+	SectorAccessor supply.SectorAccessor
+	SectorDir      string
+	// HotCapacity is the memory in bytes used to serve the most retrieved content. Zero disables tiering.
+	HotCapacity uint64
+	// ColdAfter is how long content can go unretrieved before it's offloaded to the cold store
+	ColdAfter time.Duration
+	// RegionRegistry is a JSON or TOML file or an https endpoint defining the regions and their miners
+	RegionRegistry string
+	// AuditInterval is how often we retrieve a random sample of the content we published from the caches
+	// holding it. Caches failing audits are skipped by our dispatches. Zero disables audits.
+	AuditInterval time.Duration
+	// ProvideInterval is how often we publish provider records for all our content on the DHT. Zero uses
+	// pop.DefaultReprovideInterval and a negative interval disables the DHT content routing.
+	ProvideInterval time.Duration
+	// Indexers are the endpoints of the network indexers we advertise our cached content to
+	Indexers []string
+	// DetectRegion picks our region from our IP address when no region is given. It looks up the
+	// GeoDB MaxMind database if set or asks the GeoService.
+	DetectRegion bool
+	GeoDB        string
+	GeoService   string
+	// DealNetwork tunes the retries and polling of deal negotiations with miners. Zero values use the defaults.
+	DealNetwork storage.NetworkConfig
+	// MetricsAddr is the address we serve Prometheus metrics on. Metrics are disabled when empty.
+	MetricsAddr string
+	// FaultWebhook is a URL we post the storage deals of our content slashed or failing after they were
+	// sealed to as JSON
+	FaultWebhook string
+	// HTTPGateway is the address we serve content on over HTTP under /ipfs/<cid>[/path]. Content we
+	// don't have is retrieved then cached in our supply. The gateway also answers delegated routing
+	// lookups under /routing/v1/providers/<cid>. The gateway is disabled when empty.
+	HTTPGateway string
+	// RPCAddr is the address we serve the JSON-RPC API on under /rpc/v0 over HTTP and WebSocket. Clients
+	// authenticate with RPCToken or the token generated in the repo when empty. The API is disabled when
+	// RPCAddr is empty.
+	RPCAddr  string
+	RPCToken string
+	// EdgeRuntime is the path of the wasmtime executable running the edge functions publishers pack
+	// with their content on the files we serve. Edge functions are disabled when empty. EdgeLimits bound
+	// each run, zero values use edge.DefaultLimits. This is experimental.
+	EdgeRuntime string
+	EdgeLimits  edge.Limits
+	// Wallet is the URI of the driver holding our keys e.g. unix:///run/pop-signer.sock for a remote
+	// signer. Defaults to the repo keystore.
+	Wallet string
+	// PayerAuth is the path to a JSON authorization from another address to pay for our retrievals
+	PayerAuth string
+	// PayerWallet is the URI of the driver holding the key of the payer. Defaults to the repo keystore.
+	PayerWallet string
+	// Datastore replaces the badger datastore of the repo when set
+	Datastore datastore.Batching
+	// Blockstore replaces the blockstore built on top of the datastore when set. Compression is not
+	// applied to it and content we add, pack or retrieve is still kept in stores of the datastore.
+	Blockstore blockstore.Blockstore
+	// FilecoinAPI replaces the connection to the FilEndpoint when set e.g. with a filecoin.FakeAPI
+	FilecoinAPI filecoin.API
+	// Transforms are registered next to the DefaultTransforms so packs can derive variants with them
+	Transforms []Transform
 }
 
 // RemoteStorer is the interface used to store content on decentralized storage networks (Filecoin)
@@ -99,6 +234,16 @@ type RemoteStorer interface {
 	Start(context.Context) error
 	Store(context.Context, storage.Params) (*storage.Receipt, error)
 	GetMarketQuote(context.Context, storage.QuoteParams) (*storage.Quote, error)
+	WatchTransfers(*storage.Receipt, func(storage.TransferProgress)) datatransfer.Unsubscribe
+	ListDeals(...storage.DealPhase) ([]storage.DealRecord, error)
+	GetDeal(cid.Cid) (storage.DealRecord, error)
+	CheckDataCap(context.Context, address.Address, abi.PaddedPieceSize, int) error
+	ExportPiece(context.Context, cid.Cid, string) (*storage.Piece, error)
+	StoreOffline(context.Context, storage.Params, *storage.Piece) (*storage.Receipt, error)
+	Funds(context.Context, address.Address) (storage.Balance, error)
+	Reservations(context.Context) ([]storage.Reservation, error)
+	WithdrawFunds(context.Context, address.Address, abi.TokenAmount) (cid.Cid, error)
+	SubscribeToFaults(storage.FaultListener) func()
 }
 
 type node struct {
@@ -111,31 +256,104 @@ type node struct {
 	ps   *pubsub.PubSub
 	exch *pop.Exchange
 	rs   RemoteStorer
+	cds  *compress.Datastore // only set if blocks are compressed
 
 	mu     sync.Mutex
 	notify func(Notify)
 
+	// region is the region we detected from our IP address if any
+	region string
+
 	qmu    sync.Mutex // mutex for the storage quote
 	sQuote *storage.Quote
+
+	queue *offlineQueue // pushes waiting for connectivity
+
+	spending *spendingLedger // retrieval payments and gas we spent per content
+
+	limits supply.DAGLimits // limits of the DAGs we import
+
+	transforms map[string]Transform // transforms deriving variants when packing by name
+
+	edge *edge.Runner // only set if edge functions are enabled
+
+	gmu    sync.Mutex
+	groups map[string]*retrievalGroup // retrieval groups by name
+
+	amu  sync.Mutex
+	adds map[string]context.CancelFunc // adds in progress by workdag and path
+
+	metrics *supply.PrometheusMetrics // only set if we serve metrics
+
+	maxVersionLag int
+	vmu           sync.Mutex // mutex for the latest release
+	latestRelease build.Semver
 }
 
 // New puts together all the components of the ipfs node
 func New(ctx context.Context, opts Options) (*node, error) {
-	var err error
-	nd := &node{}
+	profile, err := ParseProfile(opts.Profile)
+	if err != nil {
+		return nil, err
+	}
+	profile.apply(&opts)
 
-	dsopts := badgerds.DefaultOptions
-	dsopts.SyncWrites = false
-	dsopts.Truncate = true
+	nd := &node{maxVersionLag: opts.MaxVersionLag}
+	if nd.maxVersionLag == 0 {
+		nd.maxVersionLag = DefaultMaxVersionLag
+	}
+	nd.transforms = make(map[string]Transform)
+	for _, t := range append(DefaultTransforms, opts.Transforms...) {
+		nd.transforms[t.Name()] = t
+	}
+	if opts.EdgeRuntime != "" {
+		nd.edge, err = edge.NewRunner(edge.Wasmtime(opts.EdgeRuntime), filepath.Join(opts.RepoPath, "edge"), edgeLimits(opts.EdgeLimits))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Datastore != nil {
+		nd.ds = opts.Datastore
+	} else {
+		dsopts := profile.datastoreOptions()
+		nd.ds, err = badgerds.NewDatastore(filepath.Join(opts.RepoPath, "datastore"), &dsopts)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	nd.ds, err = badgerds.NewDatastore(filepath.Join(opts.RepoPath, "datastore"), &dsopts)
+	codec, err := compress.ParseCodec(opts.Compression)
 	if err != nil {
 		return nil, err
 	}
+	bsds := nd.ds
+	if codec != compress.None {
+		nd.cds, err = compress.Open(nd.ds, codec)
+		if err != nil {
+			return nil, err
+		}
+		bsds = nd.cds
+	} else if err := compress.CheckCodec(nd.ds, codec); err != nil {
+		return nil, err
+	}
+
+	nd.bs = opts.Blockstore
+	if nd.bs == nil {
+		nd.bs = blockstore.NewBlockstore(bsds)
+	}
 
-	nd.bs = blockstore.NewBlockstore(nd.ds)
+	msds := bsds
+	var cars *carstore.Datastore
+	if opts.CarStores {
+		cars, err = carstore.New(bsds, filepath.Join(opts.RepoPath, "stores"))
+		if err != nil {
+			return nil, err
+		}
+		msds = cars
+	}
 
-	nd.ms, err = multistore.NewMultiDstore(nd.ds)
+	nd.ms, err = multistore.NewMultiDstore(msds)
 	if err != nil {
 		return nil, err
 	}
@@ -157,13 +375,17 @@ func New(ctx context.Context, opts Options) (*node, error) {
 		return nil, err
 	}
 
+	var kad *dht.IpfsDHT
+
 	nd.host, err = libp2p.New(
 		ctx,
 		libp2p.Identity(priv),
+		// Advertise our version via identify
+		libp2p.UserAgent(build.UserAgent()),
 		libp2p.ConnectionManager(connmgr.NewConnManager(
-			20,             // Lowwater
-			60,             // HighWater,
-			20*time.Second, // GracePeriod
+			profile.ConnLow,  // Lowwater
+			profile.ConnHigh, // HighWater,
+			20*time.Second,   // GracePeriod
 		)),
 		libp2p.ConnectionGater(gater),
 		libp2p.DisableRelay(),
@@ -172,7 +394,8 @@ func New(ctx context.Context, opts Options) (*node, error) {
 		libp2p.EnableNATService(),
 		// Let this host use the DHT to find other hosts
 		libp2p.Routing(func(h host.Host) (routing.PeerRouting, error) {
-			return dht.New(ctx, h)
+			kad, err = dht.New(ctx, h)
+			return kad, err
 		}),
 	)
 	if err != nil {
@@ -188,11 +411,86 @@ func New(ctx context.Context, opts Options) (*node, error) {
 		gsnet.NewFromLibp2pHost(nd.host),
 		storeutil.LoaderForBlockstore(nd.bs),
 		storeutil.StorerForBlockstore(nd.bs),
+		profile.graphsyncOptions()...,
 	)
 
+	var rp supply.RegionProvider
+	if opts.RegionRegistry != "" {
+		rp = supply.ParseRegionProvider(opts.RegionRegistry)
+		// We can still start with the preset regions if the registry is unreachable
+		if _, err := supply.LoadRegions(ctx, rp); err != nil {
+			log.Warn().Err(err).Str("registry", opts.RegionRegistry).Msg("failed to load regions")
+		}
+	}
+	if len(opts.Regions) == 0 && opts.DetectRegion {
+		nd.region = nd.detectRegion(ctx, opts)
+		opts.Regions = []string{nd.region}
+	}
 	// Convert region names to region structs
 	regions := supply.ParseRegions(opts.Regions)
 
+	var gateways []peer.AddrInfo
+	for _, s := range opts.Gateways {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway %s: %w", s, err)
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway %s: %w", s, err)
+		}
+		gateways = append(gateways, *info)
+	}
+
+	nd.limits = supply.DefaultDAGLimits
+	if opts.MaxBlockSize > 0 {
+		nd.limits.MaxBlockSize = opts.MaxBlockSize
+	}
+	if opts.MaxLinks > 0 {
+		nd.limits.MaxLinks = opts.MaxLinks
+	}
+	if opts.MaxDepth > 0 {
+		nd.limits.MaxDepth = opts.MaxDepth
+	}
+
+	var rules *supply.AcceptRules
+	if opts.AcceptRules != nil {
+		r, err := opts.AcceptRules.parse()
+		if err != nil {
+			return nil, err
+		}
+		rules = &r
+	}
+
+	policy, err := opts.Policy.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	var cold supply.ObjectStore
+	if opts.ColdStore != "" {
+		cold, err = supply.ParseObjectStore(opts.ColdStore, opts.ColdStoreAuth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sectors := opts.SectorAccessor
+	if sectors == nil && opts.SectorDir != "" {
+		sectors, err = supply.NewDirSectorAccessor(opts.SectorDir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var tiering *supply.TieringPolicy
+	if opts.HotCapacity > 0 {
+		policy := supply.DefaultTieringPolicy
+		policy.HotCapacity = opts.HotCapacity
+		policy.ColdAfter = opts.ColdAfter
+		tiering = &policy
+	}
+
 	settings := pop.Settings{
 		Datastore:  nd.ds,
 		Blockstore: nd.bs,
@@ -207,18 +505,70 @@ func New(ctx context.Context, opts Options) (*node, error) {
 		FilecoinRPCHeader: http.Header{
 			"Authorization": []string{opts.FilToken},
 		},
-		Regions: regions,
+		FilecoinAPI:         opts.FilecoinAPI,
+		Regions:             regions,
+		SectorAccessor:      sectors,
+		Capacity:            opts.Capacity,
+		ReplicationStrategy: opts.Replication,
+		EvictionPolicy:      opts.Eviction,
+		Gateways:            gateways,
+		Gateway:             opts.Gateway,
+		DAGLimits:           nd.limits,
+		MaxPulls:            opts.MaxPulls,
+		DispatchRate:        opts.DispatchRate,
+		PublisherQuota:      opts.PublisherQuota,
+		AcceptRules:         rules,
+		ColdStore:           cold,
+		Tiering:             tiering,
+		RegionProvider:      rp,
+		Wallet:              opts.Wallet,
+		PayerWallet:         opts.PayerWallet,
+		Logger:              &log.Logger,
+	}
+	// A negative interval disables content routing
+	if opts.ProvideInterval >= 0 {
+		settings.Routing = kad
+		settings.ReprovideInterval = opts.ProvideInterval
+	}
+	settings.AuditInterval = opts.AuditInterval
+	settings.Indexers = opts.Indexers
+	if opts.PayerAuth != "" {
+		settings.Payer, err = loadAuthorization(opts.PayerAuth)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load payer authorization: %w", err)
+		}
 	}
 
 	nd.exch, err = pop.NewExchange(ctx, settings)
 	if err != nil {
 		return nil, err
 	}
+	nd.exch.Retrieval().Provider().SetPolicy(policy)
 	if opts.PrivKey != "" {
 		nd.importAddress(opts.PrivKey)
 	}
+	if opts.MetricsAddr != "" {
+		nd.metrics = supply.NewPrometheusMetrics()
+		nd.exch.Supply().SetMetrics(nd.metrics)
+	}
+	// Caches we dispatched to before restarting can still pull the content
+	resumed, err := nd.exch.Supply().ResumeDispatches(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resume dispatches")
+	} else if len(resumed) > 0 {
+		log.Info().Int("count", len(resumed)).Msg("resumed dispatches")
+	}
+	nd.spending = newSpendingLedger(nd.ds)
+	nd.exch.Retrieval().Client().SubscribeToEvents(nd.recordRetrievalSpending(ctx))
+	// Retrievals interrupted when we stopped continue from the last block we received
+	resumedDeals, err := nd.exch.Retrieval().Client().ResumeDeals(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to resume retrievals")
+	} else if resumedDeals > 0 {
+		log.Info().Int("count", resumedDeals).Msg("resumed retrievals")
+	}
 
-	nd.rs, err = storage.New(
+	rs, err := storage.New(
 		nd.host,
 		nd.bs,
 		nd.ms,
@@ -227,23 +577,73 @@ func New(ctx context.Context, opts Options) (*node, error) {
 		nd.exch.Wallet(),
 		nd.exch.FilecoinAPI(),
 		nd.exch.Supply(),
+		opts.DealNetwork,
+		log.Logger,
 	)
 	if err != nil {
 		return nil, err
 	}
+	// Offline pieces are exported straight from the store files as CARv2
+	if cars != nil {
+		rs.SetCARExporter(cars)
+	}
+	nd.rs = rs
 	err = nd.rs.Start(ctx)
 	if err != nil {
 		return nil, err
 	}
+	nd.rs.SubscribeToFaults(nd.notifyDealFault(opts.FaultWebhook))
+	nd.queue, err = newOfflineQueue(nd.ds)
+	if err != nil {
+		return nil, err
+	}
+	go nd.syncOnReconnect(ctx)
+
 	// start connecting with peers
 	go utils.Bootstrap(ctx, nd.host, opts.BootstrapPeers)
 
+	if opts.ReleaseEndpoint != "" {
+		go nd.checkReleases(ctx, opts.ReleaseEndpoint)
+	}
+
 	return nd, nil
 
 }
 
-// send hits out notify callback if we attached one
-func (nd *node) send(n Notify) {
+// detectRegion returns the name of the region matching our location or the Global region if it fails
+func (nd *node) detectRegion(ctx context.Context, opts Options) string {
+	var l supply.Locator = supply.HTTPLocator{Endpoint: opts.GeoService}
+	if opts.GeoDB != "" {
+		l = supply.MMDBLocator{Path: opts.GeoDB}
+	} else if opts.GeoService == "" {
+		l = supply.HTTPLocator{Endpoint: supply.DefaultGeoService}
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	r, err := supply.DetectRegion(ctx, l)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to detect region, joining the Global region")
+		return "Global"
+	}
+	log.Info().Str("region", r.Name).Msg("detected region")
+	return r.Name
+}
+
+type notifyKey struct{}
+
+// withNotify returns a context passing the notifications of the commands running with it to fn rather
+// than our notify callback, so each client only receives the results of its own commands
+func withNotify(ctx context.Context, fn func(Notify)) context.Context {
+	return context.WithValue(ctx, notifyKey{}, fn)
+}
+
+// send hits the notify callback of the context or our notify callback if we attached one
+func (nd *node) send(ctx context.Context, n Notify) {
+	if notify, ok := ctx.Value(notifyKey{}).(func(Notify)); ok {
+		notify(n)
+		return
+	}
+
 	nd.mu.Lock()
 	notify := nd.notify
 	nd.mu.Unlock()
@@ -258,7 +658,7 @@ func (nd *node) send(n Notify) {
 // Ping the node for sanity check more than anything
 func (nd *node) Ping(ctx context.Context, who string) {
 	sendErr := func(err error) {
-		nd.send(Notify{PingResult: &PingResult{
+		nd.send(ctx, Notify{PingResult: &PingResult{
 			Err: err.Error(),
 		}})
 	}
@@ -273,10 +673,17 @@ func (nd *node) Ping(ctx context.Context, who string) {
 		for _, a := range nd.host.Addrs() {
 			addrs = append(addrs, a.String())
 		}
-		nd.send(Notify{PingResult: &PingResult{
-			ID:    nd.host.ID().String(),
-			Addrs: addrs,
-			Peers: pstr,
+		var regions []string
+		for _, r := range nd.exch.Supply().Regions() {
+			regions = append(regions, r.Name)
+		}
+		nd.send(ctx, Notify{PingResult: &PingResult{
+			ID:             nd.host.ID().String(),
+			Addrs:          addrs,
+			Peers:          pstr,
+			Version:        build.Version,
+			Regions:        regions,
+			DetectedRegion: nd.region,
 		}})
 		return
 	}
@@ -321,11 +728,15 @@ func (nd *node) ping(ctx context.Context, pi peer.AddrInfo) error {
 		if res.Error != nil {
 			return res.Error
 		}
-		nd.send(Notify{PingResult: &PingResult{
+		pr := &PingResult{
 			ID:             pi.ID.String(),
 			Addrs:          strs,
 			LatencySeconds: res.RTT.Seconds(),
-		}})
+		}
+		if v, ok := nd.peerVersion(pi.ID); ok {
+			pr.Version = v.String()
+		}
+		nd.send(ctx, Notify{PingResult: pr})
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -336,22 +747,79 @@ func (nd *node) ping(ctx context.Context, pi peer.AddrInfo) error {
 func (nd *node) Add(ctx context.Context, args *AddArgs) {
 
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			AddResult: &AddResult{
 				Err: err.Error(),
 			},
 		})
 	}
 
-	w, err := NewWorkdag(nd.ms, nd.ds)
+	w, err := nd.workdag(args.Workdag)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	key, err := w.addKey(args.Path)
 	if err != nil {
 		sendErr(err)
 		return
 	}
-	root, err := w.Add(ctx, AddOptions{
+	if args.Cancel {
+		if err := nd.cancelAdd(key.String()); err != nil {
+			sendErr(fmt.Errorf("%s: %w", args.Path, err))
+			return
+		}
+		nd.send(ctx, Notify{AddResult: &AddResult{Canceled: true}})
+		return
+	}
+	actx, done, err := nd.startAdd(ctx, key.String())
+	if err != nil {
+		sendErr(fmt.Errorf("%s: %w", args.Path, err))
+		return
+	}
+	defer done()
+
+	codec, err := parseCodec(args.Codec)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	hash, err := parseHashFunc(args.HashFunc)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	sent := time.Now()
+	root, err := w.Add(actx, AddOptions{
 		Path:      args.Path,
 		ChunkSize: int64(args.ChunkSize),
+		Chunker:   args.Chunker,
+		Layout:    args.Layout,
+		Codec:     codec,
+		HashFunc:  hash,
+		CidV0:     args.CidV0,
+		Limits:    nd.limits,
+		Resumable: true,
+		Progress: func(done, total int64) {
+			if time.Since(sent) < transferUpdateInterval {
+				return
+			}
+			sent = time.Now()
+			nd.send(ctx, Notify{ProgressResult: &ProgressResult{
+				Command: "add",
+				Path:    args.Path,
+				Bytes:   uint64(done),
+				Total:   uint64(total),
+				Status:  "chunking",
+				Done:    done == total,
+			}})
+		},
 	})
+	if errors.Is(err, context.Canceled) && ctx.Err() == nil {
+		// The chunks stored until the last checkpoint are kept for the next add of the file
+		nd.send(ctx, Notify{AddResult: &AddResult{Canceled: true}})
+		return
+	}
 	if err != nil {
 		sendErr(err)
 		return
@@ -362,7 +830,7 @@ func (nd *node) Add(ctx context.Context, args *AddArgs) {
 	if err != nil {
 		log.Error().Err(err).Msg("record not found")
 	}
-	nd.send(Notify{
+	nd.send(ctx, Notify{
 		AddResult: &AddResult{
 			Cid:       root.String(),
 			Size:      filecoin.SizeStr(filecoin.NewInt(uint64(stats.Size))),
@@ -370,18 +838,86 @@ func (nd *node) Add(ctx context.Context, args *AddArgs) {
 		}})
 }
 
+// ErrAddInProgress is returned when a file is added while a previous add of it is in progress
+var ErrAddInProgress = errors.New("add already in progress")
+
+// ErrNoAddInProgress is returned when canceling the add of a file which isn't being added
+var ErrNoAddInProgress = errors.New("no add in progress")
+
+// startAdd registers the add of a file so it can be canceled. done must be called once it returns.
+func (nd *node) startAdd(ctx context.Context, key string) (context.Context, func(), error) {
+	nd.amu.Lock()
+	defer nd.amu.Unlock()
+	if nd.adds == nil {
+		nd.adds = make(map[string]context.CancelFunc)
+	}
+	if _, ok := nd.adds[key]; ok {
+		return nil, nil, ErrAddInProgress
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	nd.adds[key] = cancel
+	return ctx, func() {
+		nd.amu.Lock()
+		delete(nd.adds, key)
+		nd.amu.Unlock()
+		cancel()
+	}, nil
+}
+
+// cancelAdd stops the add of a file in progress
+func (nd *node) cancelAdd(key string) error {
+	nd.amu.Lock()
+	defer nd.amu.Unlock()
+	cancel, ok := nd.adds[key]
+	if !ok {
+		return ErrNoAddInProgress
+	}
+	cancel()
+	return nil
+}
+
+// parseCodec returns the multicodec for a given codec name
+func parseCodec(name string) (uint64, error) {
+	switch name {
+	case "", "unixfs":
+		return cid.DagProtobuf, nil
+	case "dag-cbor":
+		return cid.DagCBOR, nil
+	case "raw":
+		return cid.Raw, nil
+	default:
+		return 0, fmt.Errorf("unsupported codec %s", name)
+	}
+}
+
+// parseHashFunc returns the multihash code for a hash function name. Only hashes caches
+// can verify are accepted.
+func parseHashFunc(name string) (uint64, error) {
+	switch name {
+	case "":
+		return DefaultHashFunction, nil
+	case "blake2b":
+		name = "blake2b-256"
+	}
+	code, ok := supply.SupportedHashes[name]
+	if !ok {
+		return 0, fmt.Errorf("hash function %s %w", name, supply.ErrUnsupportedCodec)
+	}
+	return code, nil
+}
+
 // Status prints the current workdag index. It shows which files have been added but not yet committed
 // and pushed to the network
 func (nd *node) Status(ctx context.Context, args *StatusArgs) {
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			StatusResult: &StatusResult{
 				Err: err.Error(),
 			},
 		})
 	}
 
-	w, err := NewWorkdag(nd.ms, nd.ds)
+	w, err := nd.workdag(args.Workdag)
 	if err != nil {
 		sendErr(err)
 		return
@@ -392,10 +928,34 @@ func (nd *node) Status(ctx context.Context, args *StatusArgs) {
 		return
 	}
 
-	nd.send(Notify{
-		StatusResult: &StatusResult{
-			Output: s.String(),
-		},
+	res := &StatusResult{
+		Output:         s.String(),
+		Version:        build.Version,
+		VersionWarning: nd.versionWarning(),
+	}
+	if nd.queue != nil {
+		queued, err := nd.queue.list()
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		for _, q := range queued {
+			res.Queued = append(res.Queued, q.args.Ref)
+		}
+	}
+	if nd.cds != nil {
+		stats := nd.cds.Stats()
+		res.Compression = fmt.Sprintf(
+			"%s: %d blocks, saved %s (%.1f%%)",
+			nd.cds.Codec(),
+			stats.Blocks,
+			filecoin.SizeStr(filecoin.NewInt(uint64(stats.Saved()))),
+			stats.Ratio(),
+		)
+	}
+
+	nd.send(ctx, Notify{
+		StatusResult: res,
 	})
 }
 
@@ -404,13 +964,13 @@ func (nd *node) Status(ctx context.Context, args *StatusArgs) {
 // any peer trying to retrieve it
 func (nd *node) Pack(ctx context.Context, args *PackArgs) {
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			PackResult: &PackResult{
 				Err: err.Error(),
 			},
 		})
 	}
-	w, err := NewWorkdag(nd.ms, nd.ds)
+	w, err := nd.workdag(args.Workdag)
 	if err != nil {
 		sendErr(err)
 		return
@@ -425,22 +985,84 @@ func (nd *node) Pack(ctx context.Context, args *PackArgs) {
 		return
 	}
 
-	ref, err := w.Commit(ctx, CommitOptions{})
+	hash, err := parseHashFunc(args.HashFunc)
 	if err != nil {
 		sendErr(err)
 		return
 	}
-	err = nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID)
+	transforms, err := resolveTransforms(nd.transforms, args.Transforms)
 	if err != nil {
 		sendErr(err)
 		return
 	}
-	nd.send(Notify{
+	ref, err := w.Commit(ctx, CommitOptions{
+		Name:       args.Name,
+		HashFunc:   hash,
+		Transforms: transforms,
+		// The content is recorded in our supply before the commit so it never points at a missing store
+		Register: func(ref *DataRef) error {
+			err := nd.exch.Supply().Register(ref.PayloadCID, ref.StoreID)
+			if err != nil {
+				return err
+			}
+			// Our own content is never evicted
+			return nd.exch.Supply().Pin(ref.PayloadCID)
+		},
+	})
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	nd.send(ctx, Notify{
 		PackResult: &PackResult{
 			DataCID:   ref.PayloadCID.String(),
 			DataSize:  ref.PayloadSize,
 			PieceCID:  ref.PieceCID.String(),
 			PieceSize: int64(ref.PieceSize),
+			Name:      ref.Name,
+			Version:   ref.Version,
+			StoreID:   uint64(ref.StoreID),
+		},
+	})
+}
+
+// workdag opens the named workdag or the checked out one when the name is empty
+func (nd *node) workdag(name string) (*Workdag, error) {
+	if name == "" {
+		return NewWorkdag(nd.ms, nd.ds)
+	}
+	return NewNamedWorkdag(nd.ms, nd.ds, name)
+}
+
+// Checkout sets the workdag content is staged in by default then lists all the workdags
+func (nd *node) Checkout(ctx context.Context, args *CheckoutArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			CheckoutResult: &CheckoutResult{
+				Err: err.Error(),
+			},
+		})
+	}
+	if args.Name != "" {
+		if err := CheckoutWorkdag(nd.ms, nd.ds, args.Name); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	active, err := ActiveWorkdag(nd.ds)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	names, err := ListWorkdags(nd.ds)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	nd.send(ctx, Notify{
+		CheckoutResult: &CheckoutResult{
+			Name:     active,
+			Workdags: names,
 		},
 	})
 }
@@ -477,10 +1099,41 @@ func (nd *node) getCommit(cstr string) (*DataRef, error) {
 	return com, nil
 }
 
+// publish points the name of a commit to its root once pushed. It returns the published <name>@<version>
+// or an empty string if the commit isn't named.
+func (nd *node) publish(ctx context.Context, com *DataRef) string {
+	if com.Name == "" {
+		return ""
+	}
+	_, err := nd.exch.Publications().Publish(ctx, com.Name, com.PayloadCID, uint64(com.Version))
+	// The version may already be published if we pushed to storage before caching
+	if err != nil && !errors.Is(err, pop.ErrStaleVersion) {
+		log.Error().Err(err).Str("name", com.Name).Msg("failed to publish")
+		return ""
+	}
+	return fmt.Sprintf("%s@%d", com.Name, com.Version)
+}
+
+// previousCommit returns the previous version of a commit
+func (nd *node) previousCommit(com *DataRef) (*DataRef, error) {
+	if !com.Previous.Defined() {
+		return nil, ErrVersionNotFound
+	}
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := w.Index()
+	if err != nil {
+		return nil, err
+	}
+	return idx.Version(com.Name, com.Version-1)
+}
+
 // Quote returns an estimation of market price for storing a commit on Filecoin
 func (nd *node) Quote(ctx context.Context, args *QuoteArgs) {
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			QuoteResult: &QuoteResult{
 				Err: err.Error(),
 			},
@@ -495,11 +1148,31 @@ func (nd *node) Quote(ctx context.Context, args *QuoteArgs) {
 		sendErr(err)
 		return
 	}
+	if args.Verified {
+		// Let the user know before picking miners if they cannot afford verified deals
+		err := nd.rs.CheckDataCap(ctx, nd.exch.Wallet().DefaultAddress(), com.PieceSize, args.StorageRF)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	var budget filecoin.FIL
+	if args.Budget != "" {
+		budget, err = filecoin.ParseFIL(args.Budget)
+		if err != nil {
+			sendErr(fmt.Errorf("invalid budget: %w", err))
+			return
+		}
+	}
 	quote, err := nd.rs.GetMarketQuote(ctx, storage.QuoteParams{
-		PieceSize: uint64(com.PieceSize),
-		Duration:  args.Duration,
-		RF:        args.StorageRF,
-		MaxPrice:  args.MaxPrice,
+		PieceSize:  uint64(com.PieceSize),
+		Duration:   args.Duration,
+		RF:         args.StorageRF,
+		MaxPrice:   args.MaxPrice,
+		Verified:   args.Verified,
+		Refresh:    args.Refresh,
+		Budget:     budget,
+		MaxLatency: args.MaxLatency,
 	})
 	nd.qmu.Lock()
 	nd.sQuote = quote
@@ -515,23 +1188,90 @@ func (nd *node) Quote(ctx context.Context, args *QuoteArgs) {
 		quotes[addr.String()] = quote.Prices[addr].String()
 	}
 
-	nd.send(Notify{
-		QuoteResult: &QuoteResult{
-			Ref:    com.PayloadCID.String(),
-			Quotes: quotes,
-		},
+	qr := &QuoteResult{
+		Ref:    com.PayloadCID.String(),
+		Quotes: quotes,
+	}
+	if total := filecoin.BigInt(quote.Total); !total.Nil() {
+		qr.Total = quote.Total.String()
+	}
+	nd.send(ctx, Notify{
+		QuoteResult: qr,
 	})
 }
 
+// pushDispatchTimeout is how long we keep tracking the caches pulling the content we pushed
+const pushDispatchTimeout = time.Hour
+
+// transferUpdateInterval is the minimum delay between two progress updates of a transfer to a miner
+const transferUpdateInterval = time.Second
+
+// watchTransfers notifies the progress of the data sent to the miners of a receipt until all
+// the transfers settled or the context is cancelled
+func (nd *node) watchTransfers(ctx context.Context, rcpt *storage.Receipt) {
+	done := make(chan struct{})
+	var mu sync.Mutex
+	pending := len(rcpt.DealRefs)
+	last := make(map[cid.Cid]time.Time)
+	unsub := nd.rs.WatchTransfers(rcpt, func(tp storage.TransferProgress) {
+		mu.Lock()
+		if !tp.Done && time.Since(last[tp.Deal]) < transferUpdateInterval {
+			mu.Unlock()
+			return
+		}
+		last[tp.Deal] = time.Now()
+		if tp.Done {
+			pending--
+			if pending == 0 {
+				close(done)
+			}
+		}
+		mu.Unlock()
+
+		nd.send(ctx, Notify{
+			PushResult: &PushResult{
+				Transfer: &DealTransfer{
+					Miner: tp.Miner.String(),
+					Deal:  tp.Deal.String(),
+					Sent:  tp.Sent,
+					Total: tp.Total,
+					Done:  tp.Done,
+					Err:   tp.Err,
+				},
+			},
+		})
+	})
+	go func() {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+		unsub()
+	}()
+}
+
 // Push deploys a committed DAG archive for storage
 func (nd *node) Push(ctx context.Context, args *PushArgs) {
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			PushResult: &PushResult{
 				Err: err.Error(),
 			},
 		})
 	}
+	if args.Queue && nd.queue != nil && !nd.canPush(args) {
+		ref, err := nd.queuePush(args)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		nd.send(ctx, Notify{
+			PushResult: &PushResult{
+				Queued: ref,
+			},
+		})
+		return
+	}
 	com, err := nd.getCommit(args.Ref)
 	if err != nil {
 		sendErr(err)
@@ -544,29 +1284,63 @@ func (nd *node) Push(ctx context.Context, args *PushArgs) {
 			return
 		}
 
-		nd.qmu.Lock()
-		if nd.sQuote == nil {
+		var miners, alternates []storage.Miner
+		if args.Queue && len(args.Miners) == 0 {
+			// We couldn't pick miners from a quote while offline
+			miners, err = nd.quoteMiners(ctx, com, args)
+			if err != nil {
+				sendErr(err)
+				return
+			}
+		} else {
+			nd.qmu.Lock()
+			if nd.sQuote == nil {
+				nd.qmu.Unlock()
+				sendErr(ErrQuoteNotFound)
+				return
+			}
+			quote := nd.sQuote
 			nd.qmu.Unlock()
-			sendErr(ErrQuoteNotFound)
-			return
-		}
-		quote := nd.sQuote
-		nd.qmu.Unlock()
 
-		var miners []storage.Miner
-		for _, m := range quote.Miners {
-			addr := m.Info.Address
-			if args.Miners[addr.String()] {
-				miners = append(miners, m)
+			for _, m := range quote.Miners {
+				addr := m.Info.Address
+				if args.Miners[addr.String()] {
+					miners = append(miners, m)
+				} else {
+					// Other miners from the quote replace the ones failing
+					alternates = append(alternates, m)
+				}
 			}
 		}
 
-		rcpt, err := nd.rs.Store(ctx, storage.NewParams(
+		params := storage.NewParams(
 			com.PayloadCID,
 			args.Duration,
 			nd.exch.Wallet().DefaultAddress(),
 			miners,
-		))
+		)
+		params.Label = args.Label
+		params.Alternates = alternates
+		params.Verified = args.Verified
+		params.PieceSize = com.PieceSize
+
+		var rcpt *storage.Receipt
+		var piece *storage.Piece
+		if args.Offline {
+			if args.PieceDir == "" {
+				sendErr(ErrNoPieceDir)
+				return
+			}
+			// The miners import the piece from the file we export instead of us sending the data
+			piece, err = nd.rs.ExportPiece(ctx, com.PayloadCID, filepath.Join(args.PieceDir, com.PayloadCID.String()+".car"))
+			if err != nil {
+				sendErr(err)
+				return
+			}
+			rcpt, err = nd.rs.StoreOffline(ctx, params, piece)
+		} else {
+			rcpt, err = nd.rs.Store(ctx, params)
+		}
 		if err != nil {
 			sendErr(err)
 			return
@@ -575,66 +1349,193 @@ func (nd *node) Push(ctx context.Context, args *PushArgs) {
 			sendErr(ErrAllDealsFailed)
 			return
 		}
-		var pr PushResult
-		for _, m := range rcpt.Miners {
-			pr.Miners = append(pr.Miners, m.String())
-		}
-		for _, d := range rcpt.DealRefs {
-			pr.Deals = append(pr.Deals, d.String())
+		pr := storageResult(com, rcpt, piece)
+		if piece == nil {
+			// Uploading to miners can take hours so we keep reporting progress after the push returns
+			nd.watchTransfers(ctx, rcpt)
 		}
-		nd.send(Notify{
-			PushResult: &pr,
+		pr.Publication = nd.publish(ctx, com)
+		nd.send(ctx, Notify{
+			PushResult: pr,
 		})
 	}
 
-	if !args.NoCache && args.CacheRF > 0 {
-		// TODO: adjust timeout?
-		ctx, cancel := context.WithTimeout(ctx, 1*time.Hour)
-		defer cancel()
+	if !args.NoCache && (args.CacheRF > 0 || len(args.RegionRF) > 0) {
+		timeout := pushDispatchTimeout
+		if args.Announce {
+			// We don't know how many caches will pull announced content so we only track them for a while
+			timeout = supply.AnnounceTimeout
+		}
+		// Caches keep pulling after we reached the target so the dispatch outlives the command
+		dctx, dcancel := context.WithTimeout(context.Background(), timeout)
 
-		res, err := nd.exch.Supply().Dispatch(supply.Request{
+		req := supply.Request{
 			PayloadCID: com.PayloadCID,
 			Size:       uint64(com.PayloadSize),
-		})
-		defer res.Close()
+			// Caches keep the content as long as we store it
+			TTL: uint64(args.Duration.Seconds()),
+		}
+		if args.CachePrice != "" {
+			f, err := filecoin.ParseFIL(args.CachePrice)
+			if err != nil {
+				dcancel()
+				sendErr(err)
+				return
+			}
+			ppb := abi.TokenAmount(f)
+			req.PricePerByte = &ppb
+		}
+		stop := nd.watchProgress(ctx, "push", com.PayloadCID, uint64(com.PayloadSize))
+		defer stop()
+
+		var res *supply.Response
+		// If we dispatched a previous version, caches holding it only pull the new blocks
+		prev, perr := nd.previousCommit(com)
+		if args.Announce {
+			res, err = nd.exch.Supply().Announce(dctx, req)
+		} else if len(args.RegionRF) > 0 {
+			res, err = nd.exch.Supply().DispatchRegions(dctx, req, supply.ReplicationPolicy(args.RegionRF))
+		} else if perr == nil {
+			res, err = nd.exch.Supply().DispatchUpdate(dctx, req, prev.PayloadCID)
+		} else {
+			res, err = nd.exch.Supply().Dispatch(dctx, req)
+		}
 		if err != nil {
+			if res != nil {
+				res.Close()
+			}
+			dcancel()
 			sendErr(err)
 			return
 		}
-		for {
-			// Right now we only wait for 1 peer to receive the content but we could wait for
-			// more peers, the question is when to stop as we don't know exactly how many will retrieve
-			rec, err := res.Next(ctx)
-			nd.send(Notify{
-				PushResult: &PushResult{
-					Caches: []string{
-						rec.Provider.String(),
-					},
-				},
-			})
-			if err != nil {
-				sendErr(ctx.Err())
+		// Keep recording the caches pulling the content until they all settled
+		go func() {
+			defer dcancel()
+			defer res.Close()
+			select {
+			case <-res.Done():
+			case <-dctx.Done():
 			}
+		}()
+		// Return as soon as enough caches pulled the content, or once they all settled if fewer did
+		recs, err := res.WaitFor(ctx, pushTarget(args))
+		if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+			sendErr(err)
 			return
 		}
+		var caches []string
+		for _, rec := range recs {
+			caches = append(caches, rec.Provider.String())
+		}
+		pr := &PushResult{
+			Root:           com.PayloadCID.String(),
+			Caches:         caches,
+			CacheAttempted: res.Attempted(),
+			CacheFailed:    res.Failed(),
+		}
+		// The number of caches pulling announced content is unknown
+		if !args.Announce {
+			pr.CachePending = pr.CacheAttempted - res.Confirmed() - pr.CacheFailed
+		}
+		for p, reason := range res.Failures() {
+			if pr.CacheFailures == nil {
+				pr.CacheFailures = make(map[string]string)
+			}
+			pr.CacheFailures[p.String()] = reason.Error()
+		}
+		if len(args.RegionRF) > 0 {
+			pr.RegionCaches = res.RegionConfirmed()
+			pr.Shortfalls = res.Shortfalls()
+		}
+		for region, p := range res.Relays() {
+			if pr.Relays == nil {
+				pr.Relays = make(map[string]string)
+			}
+			pr.Relays[region] = p.String()
+		}
+		if res.Diff != nil {
+			pr.Previous = res.Diff.Previous.String()
+			pr.DiffBlocks = len(res.Diff.Blocks)
+		}
+		pr.Publication = nd.publish(ctx, com)
+		nd.send(ctx, Notify{
+			PushResult: pr,
+		})
+		return
 	}
 	// We shouldn't end up in this state as it's the command client role to
 	// validate we won't but just in case we return an empty result
-	nd.send(Notify{
+	nd.send(ctx, Notify{
 		PushResult: &PushResult{},
 	})
 }
 
+// pushTarget is the number of caches we wait for before reporting a push, zero waits for all of them
+func pushTarget(args *PushArgs) int {
+	if len(args.RegionRF) > 0 {
+		var n int
+		for _, rf := range args.RegionRF {
+			n += rf
+		}
+		return n
+	}
+	return args.CacheRF
+}
+
+// storageResult describes the deals we started for a commit and what they store
+func storageResult(com *DataRef, rcpt *storage.Receipt, piece *storage.Piece) *PushResult {
+	pr := &PushResult{
+		Root:      com.PayloadCID.String(),
+		PieceSize: uint64(com.PieceSize),
+		Label:     rcpt.Label,
+	}
+	if com.PieceCID.Defined() {
+		pr.PieceCID = com.PieceCID.String()
+	}
+	if piece != nil {
+		pr.PieceFile = piece.Path
+		pr.PieceCID = piece.PieceCID.String()
+		pr.PieceSize = uint64(piece.PieceSize)
+	}
+	for _, m := range rcpt.Miners {
+		pr.Miners = append(pr.Miners, m.String())
+	}
+	for _, d := range rcpt.DealRefs {
+		pr.Deals = append(pr.Deals, d.String())
+	}
+	for _, o := range rcpt.Outcomes {
+		if o.Err != "" {
+			if pr.FailedDeals == nil {
+				pr.FailedDeals = make(map[string]string)
+			}
+			pr.FailedDeals[o.Miner.String()] = o.Err
+			continue
+		}
+		if o.Proposal.Defined() {
+			if pr.Proposals == nil {
+				pr.Proposals = make(map[string]string)
+			}
+			pr.Proposals[o.Miner.String()] = o.Proposal.String()
+		}
+	}
+	return pr
+}
+
 // Get sends a request for content with the given arguments. It also sends feedback to any open cli
 // connections
 func (nd *node) Get(ctx context.Context, args *GetArgs) {
 	sendErr := func(err error) {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			GetResult: &GetResult{
 				Err: err.Error(),
 			}})
 	}
-	p := path.FromString(args.Cid)
+	ref, err := nd.resolveVersion(ctx, args)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	p := path.FromString(ref)
 	// /<cid>/path/file.ext => cid, ["path", file.ext"]
 	root, segs, err := path.SplitAbsPath(p)
 	if err != nil {
@@ -644,20 +1545,25 @@ func (nd *node) Get(ctx context.Context, args *GetArgs) {
 	// Check our supply if we may already have it
 	sID, err := nd.exch.Supply().GetStoreID(root)
 	if err == nil && args.Out != "" {
-		err := nd.export(ctx, root, segs[0], args.Out, sID)
+		var err error
+		if args.Variant != "" {
+			err = nd.exportVariant(ctx, root, strings.Join(segs, "/"), args.Variant, args.Out, sID)
+		} else {
+			err = nd.export(ctx, root, strings.Join(segs, "/"), args.Out, sID)
+		}
 		if err != nil {
 			sendErr(err)
 			return
 		}
 	}
 	if err == nil {
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			GetResult: &GetResult{
 				Local: true,
 			}})
 		return
 	}
-	// Only support a single segment for now
+	// Paths only retrieve the manifest entry they point to
 	args.Segments = segs
 	// Log progress
 	if args.Verbose {
@@ -680,13 +1586,100 @@ func (nd *node) Get(ctx context.Context, args *GetArgs) {
 	}
 }
 
+// resolveVersion replaces a <name>@<version> reference with the root of the given version.
+// The name may be a publication we committed, a publication announced in our regions or the root
+// of any version of a publication. References with a name only resolve to the latest root.
+// Versions we don't have are walked back from the given root by retrieving their manifests.
+func (nd *node) resolveVersion(ctx context.Context, args *GetArgs) (string, error) {
+	ref := strings.TrimPrefix(args.Cid, "/")
+	segs := strings.SplitN(ref, "/", 2)
+	at := strings.LastIndex(segs[0], "@")
+	if at == -1 {
+		if _, err := cid.Decode(segs[0]); err == nil || segs[0] == "ipfs" {
+			return args.Cid, nil
+		}
+		// Resolve the name to the latest root of the publication
+		pub, err := nd.exch.Publications().Resolve(segs[0])
+		if err != nil {
+			return "", err
+		}
+		segs[0] = pub.Root.String()
+		return "/" + strings.Join(segs, "/"), nil
+	}
+	name := segs[0][:at]
+	version, err := strconv.ParseInt(segs[0][at+1:], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("invalid version: %w", err)
+	}
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return "", err
+	}
+	var root cid.Cid
+	idx, err := w.Index()
+	if err != nil {
+		return "", err
+	}
+	if com, err := idx.Version(name, version); err == nil {
+		root = com.PayloadCID
+	} else if head := idx.head(name); head != nil {
+		root = head.PayloadCID
+	} else if pub, err := nd.exch.Publications().Resolve(name); err == nil {
+		root = pub.Root
+	} else if root, err = cid.Decode(name); err != nil {
+		return "", ErrVersionNotFound
+	}
+	for {
+		sid, err := nd.exch.Supply().GetStoreID(root)
+		if err != nil {
+			// Retrieve the version we don't have to read its manifest
+			if err := nd.get(ctx, root, &GetArgs{Timeout: args.Timeout}); err != nil {
+				return "", err
+			}
+			if sid, err = nd.exch.Supply().GetStoreID(root); err != nil {
+				return "", err
+			}
+		}
+		m, err := w.Manifest(ctx, root, sid)
+		if err != nil {
+			return "", err
+		}
+		if m.Version == version {
+			break
+		}
+		if m.Version < version || !m.Previous.Defined() {
+			return "", ErrVersionNotFound
+		}
+		root = m.Previous
+	}
+	segs[0] = root.String()
+	return "/" + strings.Join(segs, "/"), nil
+}
+
 // get is a synchronous content retrieval operation which can be called by a CLI request or HTTP
-func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) error {
-	// TODO handle different predefined selectors
+func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) (err error) {
+	sel, err := parseSelection(args.Sel, args.Segments)
+	if err != nil {
+		return err
+	}
+	if args.Variant != "" {
+		if sel.path == "" {
+			return fmt.Errorf("%w: variant %s requires a path", ErrInvalidSelector, args.Variant)
+		}
+		sel.variant = args.Variant
+	}
 
 	start := time.Now()
 
-	session, err := nd.exch.NewSession(ctx, c)
+	var session *pop.Session
+	switch {
+	case args.batch != nil:
+		session, err = args.batch.group.NewSession(ctx, c)
+	case args.Group != "":
+		session, err = nd.group(args.Group).NewSession(ctx, c)
+	default:
+		session, err = nd.exch.NewSession(ctx, c)
+	}
 	if err != nil {
 		return err
 	}
@@ -710,19 +1703,76 @@ func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) error {
 		now := time.Now()
 		discDuration = now.Sub(start)
 	}
+	var offers []deal.Offer
 	if offer == nil {
 		// Gossip discovery shouldn't last more than 5 seconds
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		gctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 		defer cancel()
-		offer, err = session.QueryGossip(ctx)
+		if n := maxInt(args.Providers, args.Race); n > 1 {
+			offers, err = session.QueryOffers(gctx, n, offerWindow)
+			if err == nil {
+				offer = &offers[0]
+			}
+		} else {
+			offer, err = session.QueryGossip(gctx)
+		}
 		if err != nil {
-			return err
+			// None of the peers we are connected to has the content, look for caches on the DHT
+			rctx, cancel := context.WithTimeout(ctx, routingTimeout)
+			defer cancel()
+			var rerr error
+			offer, rerr = session.QueryRouting(rctx)
+			if rerr == routing.ErrNotSupported {
+				return err
+			}
+			if rerr != nil {
+				return rerr
+			}
 		}
 		now := time.Now()
 		discDuration = now.Sub(start)
 	}
 
-	err = session.SyncBlocks(ctx, offer)
+	stop := nd.watchProgress(ctx, "get", c, offer.Response.Size)
+	defer stop()
+
+	var m *Manifest
+	if sel.needsManifest() {
+		// Retrieve the manifest first to find the entry the path points to
+		m, err = nd.retrieveManifest(ctx, session, c, offer)
+		if err != nil {
+			return err
+		}
+	}
+	if !sel.all() {
+		s, err := sel.selector(m)
+		if err != nil {
+			return err
+		}
+		session.SetSelector(s)
+	}
+
+	if args.batch != nil {
+		// The batch budget is reserved for the offer before we pay and given back if we fail
+		price, size := offer.Response.PieceRetrievalPrice(), offer.Response.Size
+		if err := args.batch.budget.reserve(price, size); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				args.batch.budget.release(price, size)
+			}
+		}()
+	}
+
+	if args.Race > 1 && len(offers) > 1 {
+		if len(offers) > args.Race {
+			offers = offers[:args.Race]
+		}
+		offer, err = session.Race(ctx, offers, pop.DefaultRaceBytes)
+	} else {
+		err = session.SyncBlocks(ctx, offer)
+	}
 	if err != nil {
 		return err
 	}
@@ -732,7 +1782,7 @@ func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) error {
 		return err
 	}
 
-	nd.send(Notify{
+	nd.send(ctx, Notify{
 		GetResult: &GetResult{
 			DealID:       did.String(),
 			TotalPrice:   filecoin.FIL(offer.Response.PieceRetrievalPrice()).Short(),
@@ -749,18 +1799,28 @@ func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) error {
 		}
 		end := time.Now()
 		transDuration := end.Sub(start) - discDuration
-		if args.Out != "" {
-			err := nd.export(ctx, c, args.Segments[0], args.Out, session.StoreID())
+		if sel.all() {
+			if args.Out != "" {
+				err := nd.export(ctx, c, "", args.Out, session.StoreID())
+				if err != nil {
+					return err
+				}
+			}
+			// Register new blocks in our supply by default
+			err = nd.exch.Supply().Register(c, session.StoreID())
 			if err != nil {
 				return err
 			}
-		}
-		// Register new blocks in our supply by default
-		err = nd.exch.Supply().Register(c, session.StoreID())
-		if err != nil {
+			// Drop the content if it doesn't match the schema the publisher attached to it
+			err = nd.exch.Supply().ValidateContent(ctx, c)
+			if err != nil {
+				nd.exch.Supply().RemoveContent(c)
+				return err
+			}
+		} else if err := nd.storeSelection(ctx, c, sel, args.Out, session.StoreID()); err != nil {
 			return err
 		}
-		nd.send(Notify{
+		nd.send(ctx, Notify{
 			GetResult: &GetResult{
 				DiscLatSeconds:  discDuration.Seconds(),
 				TransLatSeconds: transDuration.Seconds(),
@@ -772,12 +1832,297 @@ func (nd *node) get(ctx context.Context, c cid.Cid, args *GetArgs) error {
 	}
 }
 
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Market returns the cache listings matching the given arguments, cheapest first
+func (nd *node) Market(ctx context.Context, args *MarketArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			MarketResult: &MarketResult{
+				Err: err.Error(),
+			}})
+	}
+	var maxPPB abi.TokenAmount
+	if args.MaxPrice != "" {
+		f, err := filecoin.ParseFIL(args.MaxPrice)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		maxPPB = abi.TokenAmount(f)
+	}
+	var res MarketResult
+	for _, l := range nd.exch.Market().Providers(args.Region, args.MinCapacity, maxPPB) {
+		res.Providers = append(res.Providers, MarketListing{
+			Provider:     l.Provider.String(),
+			Region:       l.Region,
+			Capacity:     filecoin.SizeStr(filecoin.NewInt(l.Capacity)),
+			PricePerByte: filecoin.FIL(l.PricePerByte).Short(),
+		})
+	}
+	nd.send(ctx, Notify{MarketResult: &res})
+}
+
+// List sends a page of the content we currently provide
+func (nd *node) List(ctx context.Context, args *ListArgs) {
+	infos, total, err := nd.exch.Supply().ListContent(supply.ListOptions{
+		Offset: args.Offset,
+		Limit:  args.Limit,
+		Labels: args.Labels,
+	})
+	if err != nil {
+		nd.send(ctx, Notify{
+			ListResult: &ListResult{
+				Err: err.Error(),
+			}})
+		return
+	}
+	res := ListResult{Total: total}
+	for _, info := range infos {
+		res.Entries = append(res.Entries, ContentEntry{
+			Root:       info.Root.String(),
+			Size:       filecoin.SizeStr(filecoin.NewInt(info.Size)),
+			StoreID:    uint64(info.StoreID),
+			Region:     info.Region,
+			ReceivedAt: info.ReceivedAt,
+			Labels:     info.Labels,
+		})
+	}
+	nd.send(ctx, Notify{ListResult: &res})
+}
+
+// Inspect sends the record of a content in our supply
+func (nd *node) Inspect(ctx context.Context, args *InspectArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			InspectResult: &InspectResult{
+				Err: err.Error(),
+			}})
+	}
+	root, err := cid.Parse(args.Ref)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	info, err := nd.exch.Supply().Inspect(root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	// Make sure the store still exists
+	if _, err := nd.exch.Supply().GetStoreID(root); err != nil {
+		sendErr(err)
+		return
+	}
+	nd.send(ctx, Notify{
+		InspectResult: &InspectResult{
+			Content: ContentEntry{
+				Root:       info.Root.String(),
+				Size:       filecoin.SizeStr(filecoin.NewInt(info.Size)),
+				StoreID:    uint64(info.StoreID),
+				Region:     info.Region,
+				ReceivedAt: info.ReceivedAt,
+				Labels:     info.Labels,
+			},
+		}})
+}
+
+// Deals sends the storage deals we proposed or the history of a single deal
+func (nd *node) Deals(ctx context.Context, args *DealsArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			DealsResult: &DealsResult{
+				Err: err.Error(),
+			}})
+	}
+	if args.Proposal != "" {
+		proposal, err := cid.Parse(args.Proposal)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		rec, err := nd.rs.GetDeal(proposal)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		entry := dealEntry(rec)
+		for _, t := range rec.Transitions {
+			entry.Transitions = append(entry.Transitions, DealTransitionEntry{
+				Event:   t.Event,
+				State:   t.StateName(),
+				Message: t.Message,
+				Time:    t.Time,
+			})
+		}
+		nd.send(ctx, Notify{DealsResult: &DealsResult{Deals: []DealEntry{entry}}})
+		return
+	}
+	var phases []storage.DealPhase
+	if args.Phase != "" {
+		phases = append(phases, storage.DealPhase(args.Phase))
+	}
+	recs, err := nd.rs.ListDeals(phases...)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	var res DealsResult
+	for _, rec := range recs {
+		res.Deals = append(res.Deals, dealEntry(rec))
+	}
+	nd.send(ctx, Notify{DealsResult: &res})
+}
+
+func dealEntry(rec storage.DealRecord) DealEntry {
+	e := DealEntry{
+		ProposalCid: rec.ProposalCid.String(),
+		Miner:       rec.Miner.String(),
+		DealID:      uint64(rec.DealID),
+		State:       rec.StateName(),
+		Phase:       string(rec.Phase()),
+		PieceSize:   filecoin.SizeStr(filecoin.NewInt(uint64(rec.PieceSize))),
+		Message:     rec.Message,
+		Updated:     rec.Updated,
+	}
+	if rec.Root.Defined() {
+		e.Root = rec.Root.String()
+	}
+	if !rec.Price.Nil() {
+		e.Price = filecoin.FIL(rec.Price).Short()
+	}
+	if c := rec.PieceCheck; c != nil {
+		switch {
+		case !c.OK():
+			e.PieceCheck = c.Err
+		case c.Sealed:
+			e.PieceCheck = "sealed"
+		default:
+			e.PieceCheck = "ok"
+		}
+	}
+	return e
+}
+
+// Funds sends our balance in the storage market and the funds reserved for each deal. It withdraws
+// the funds neither locked nor reserved back to our wallet first if requested.
+func (nd *node) Funds(ctx context.Context, args *FundsArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			FundsResult: &FundsResult{
+				Err: err.Error(),
+			}})
+	}
+	if !nd.exch.IsFilecoinOnline() {
+		sendErr(ErrFilecoinRPCOffline)
+		return
+	}
+	addr := nd.exch.Wallet().DefaultAddress()
+
+	var res FundsResult
+	if args.Withdraw != "" {
+		// A nil amount withdraws all the available funds
+		var amt abi.TokenAmount
+		if args.Withdraw != "all" {
+			f, err := filecoin.ParseFIL(args.Withdraw)
+			if err != nil {
+				sendErr(fmt.Errorf("invalid amount: %w", err))
+				return
+			}
+			amt = abi.TokenAmount(f)
+		}
+		mcid, err := nd.rs.WithdrawFunds(ctx, addr, amt)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		res.WithdrawMsg = mcid.String()
+	}
+
+	bal, err := nd.rs.Funds(ctx, addr)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	res.Address = addr.String()
+	res.Escrow = filecoin.FIL(bal.Escrow).Short()
+	res.Locked = filecoin.FIL(bal.Locked).Short()
+	res.Reserved = filecoin.FIL(bal.Reserved).Short()
+	res.Available = filecoin.FIL(bal.Available).Short()
+	if bal.PendingMsg != nil {
+		res.PendingMsg = bal.PendingMsg.String()
+	}
+
+	rsvs, err := nd.rs.Reservations(ctx)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	for _, r := range rsvs {
+		res.Reservations = append(res.Reservations, ReservationEntry{
+			ProposalCid: r.ProposalCid.String(),
+			Miner:       r.Miner.String(),
+			Amount:      filecoin.FIL(r.Amount).Short(),
+			State:       r.StateName(),
+		})
+	}
+	nd.send(ctx, Notify{FundsResult: &res})
+}
+
+// Region joins or leaves a region at runtime and sends the regions we are part of
+func (nd *node) Region(ctx context.Context, args *RegionArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			RegionResult: &RegionResult{
+				Err: err.Error(),
+			}})
+	}
+	if args.Join != "" {
+		if err := nd.exch.JoinRegion(ctx, supply.ParseRegions([]string{args.Join})[0]); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	if args.Leave != "" {
+		if err := nd.exch.LeaveRegion(args.Leave); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	var res RegionResult
+	for _, r := range nd.exch.Supply().Regions() {
+		res.Regions = append(res.Regions, r.Name)
+	}
+	if args.Stats {
+		for _, h := range nd.exch.Stats().Health(args.Name) {
+			res.Health = append(res.Health, RegionHealth{
+				Region:      h.Region,
+				Caches:      h.Caches,
+				Capacity:    filecoin.SizeStr(filecoin.NewInt(h.Capacity)),
+				HitRate:     h.HitRate,
+				Queries:     h.Queries,
+				BytesServed: filecoin.SizeStr(filecoin.NewInt(h.BytesServed)),
+			})
+		}
+	}
+	nd.send(ctx, Notify{RegionResult: &res})
+}
+
 // extractFile from an archive
 func (nd *node) extractFile(ctx context.Context, root cid.Cid, name string, sid multistore.StoreID) (files.Node, error) {
 	w, err := NewWorkdag(nd.ms, nd.ds)
 	if err != nil {
 		return nil, err
 	}
+	// Without a path we return the root itself which may be a dag-cbor object or a raw block
+	if name == "" {
+		return w.LoadFile(ctx, root, sid)
+	}
 
 	fls, err := w.Unpack(ctx, root, sid)
 	if err != nil {
@@ -795,6 +2140,14 @@ func (nd *node) extractFile(ctx context.Context, root cid.Cid, name string, sid
 	return file, nil
 }
 
+// firstSegment returns the first path segment or an empty string when the path is only a root
+func firstSegment(segs []string) string {
+	if len(segs) == 0 {
+		return ""
+	}
+	return segs[0]
+}
+
 // export extracts a given file from an archive and writes it to a given path
 func (nd *node) export(ctx context.Context, root cid.Cid, name, out string, sid multistore.StoreID) error {
 	file, err := nd.extractFile(ctx, root, name, sid)
@@ -808,6 +2161,27 @@ func (nd *node) export(ctx context.Context, root cid.Cid, name, out string, sid
 	return nil
 }
 
+// exportVariant writes a variant of a manifest entry to a given path
+func (nd *node) exportVariant(ctx context.Context, root cid.Cid, name, variant, out string, sid multistore.StoreID) error {
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return err
+	}
+	m, err := w.Manifest(ctx, root, sid)
+	if err != nil {
+		return err
+	}
+	c, err := m.Variant(name, variant)
+	if err != nil {
+		return err
+	}
+	file, err := w.LoadFile(ctx, c, sid)
+	if err != nil {
+		return err
+	}
+	return files.WriteTo(file, out)
+}
+
 // connPeers returns a list of connected peer IDs
 func (nd *node) connPeers() []peer.ID {
 	conns := nd.host.Network().Conns()
@@ -843,3 +2217,16 @@ func (nd *node) importAddress(pk string) {
 		}
 	}
 }
+
+// loadAuthorization reads a payer authorization from a JSON file
+func loadAuthorization(path string) (*paychmgr.SignedAuthorization, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var sa paychmgr.SignedAuthorization
+	if err := json.Unmarshal(b, &sa); err != nil {
+		return nil, err
+	}
+	return &sa, nil
+}
@@ -0,0 +1,113 @@
+package node
+
+import (
+	"fmt"
+
+	"github.com/dgraph-io/badger/options"
+	badgerds "github.com/ipfs/go-ds-badger"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+)
+
+const (
+	// ProfileDefault tunes the node for desktops and servers
+	ProfileDefault = "default"
+	// ProfileLowPower tunes the node for Raspberry Pi class devices with little memory and few cores
+	ProfileLowPower = "low-power"
+)
+
+// Profile is a set of concurrency and memory defaults suited to a class of devices. Options set
+// explicitly always take precedence over the profile.
+type Profile struct {
+	Name string
+	// MaxPulls is how many dispatched contents we pull at the same time
+	MaxPulls int
+	// QueryWorkers is how many storage miners we query at the same time
+	QueryWorkers int
+	// GraphsyncRequests is how many graphsync requests we process at the same time. Zero uses the
+	// graphsync default.
+	GraphsyncRequests uint64
+	// GraphsyncMemory and GraphsyncPeerMemory bound the memory of the blocks queued for all peers and for
+	// each peer. Zero uses the graphsync default.
+	GraphsyncMemory     uint64
+	GraphsyncPeerMemory uint64
+	// ConnLow and ConnHigh are the connection manager watermarks
+	ConnLow  int
+	ConnHigh int
+	// LowMemoryDatastore reads badger tables and value logs from files instead of memory mapping them and
+	// keeps smaller write caches
+	LowMemoryDatastore bool
+}
+
+var profiles = map[string]Profile{
+	ProfileDefault: {
+		Name:     ProfileDefault,
+		ConnLow:  20,
+		ConnHigh: 60,
+	},
+	ProfileLowPower: {
+		Name:                ProfileLowPower,
+		MaxPulls:            2,
+		QueryWorkers:        4,
+		GraphsyncRequests:   2,
+		GraphsyncMemory:     32 << 20,
+		GraphsyncPeerMemory: 4 << 20,
+		ConnLow:             10,
+		ConnHigh:            30,
+		LowMemoryDatastore:  true,
+	},
+}
+
+// ParseProfile returns the profile with the given name, an empty name is the default profile
+func ParseProfile(name string) (Profile, error) {
+	if name == "" {
+		name = ProfileDefault
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return p, fmt.Errorf("unknown profile %q: expected %s or %s", name, ProfileDefault, ProfileLowPower)
+	}
+	return p, nil
+}
+
+// apply sets the profile defaults for the options left to zero
+func (p Profile) apply(opts *Options) {
+	if opts.MaxPulls == 0 {
+		opts.MaxPulls = p.MaxPulls
+	}
+	if opts.DealNetwork.QueryWorkers == 0 {
+		opts.DealNetwork.QueryWorkers = p.QueryWorkers
+	}
+}
+
+// datastoreOptions returns the options of the badger datastore in the repo
+func (p Profile) datastoreOptions() badgerds.Options {
+	dsopts := badgerds.DefaultOptions
+	dsopts.SyncWrites = false
+	dsopts.Truncate = true
+	if p.LowMemoryDatastore {
+		dsopts.TableLoadingMode = options.FileIO
+		dsopts.ValueLogLoadingMode = options.FileIO
+		dsopts.MaxTableSize = 8 << 20
+		dsopts.ValueLogFileSize = 64 << 20
+		dsopts.NumMemtables = 1
+		dsopts.NumLevelZeroTables = 1
+		dsopts.NumLevelZeroTablesStall = 2
+		dsopts.NumCompactors = 1
+	}
+	return dsopts
+}
+
+// graphsyncOptions returns the options bounding the graphsync requests we serve
+func (p Profile) graphsyncOptions() []gsimpl.Option {
+	var opts []gsimpl.Option
+	if p.GraphsyncRequests > 0 {
+		opts = append(opts, gsimpl.MaxInProgressRequests(p.GraphsyncRequests))
+	}
+	if p.GraphsyncMemory > 0 {
+		opts = append(opts, gsimpl.MaxMemoryResponder(p.GraphsyncMemory))
+	}
+	if p.GraphsyncPeerMemory > 0 {
+		opts = append(opts, gsimpl.MaxMemoryPerPeerResponder(p.GraphsyncPeerMemory))
+	}
+	return opts
+}
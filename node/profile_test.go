@@ -0,0 +1,39 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/dgraph-io/badger/options"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfile(t *testing.T) {
+	_, err := ParseProfile("turbo")
+	require.Error(t, err)
+
+	p, err := ParseProfile("")
+	require.NoError(t, err)
+	require.Equal(t, ProfileDefault, p.Name)
+	require.Len(t, p.graphsyncOptions(), 0)
+
+	// The default profile leaves the components to their own defaults
+	opts := Options{}
+	p.apply(&opts)
+	require.Equal(t, 0, opts.MaxPulls)
+	require.Equal(t, 0, opts.DealNetwork.QueryWorkers)
+
+	p, err = ParseProfile(ProfileLowPower)
+	require.NoError(t, err)
+	require.Len(t, p.graphsyncOptions(), 3)
+	require.Equal(t, options.FileIO, p.datastoreOptions().TableLoadingMode)
+
+	opts = Options{}
+	p.apply(&opts)
+	require.Equal(t, p.MaxPulls, opts.MaxPulls)
+	require.Equal(t, p.QueryWorkers, opts.DealNetwork.QueryWorkers)
+
+	// Options set explicitly take precedence
+	opts = Options{MaxPulls: 12}
+	p.apply(&opts)
+	require.Equal(t, 12, opts.MaxPulls)
+}
@@ -0,0 +1,122 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// transferProgress is the last progress we know of a transfer with a peer and when we reported it
+type transferProgress struct {
+	ProgressResult
+	sent time.Time
+}
+
+// progressTracker throttles the progress updates of the transfers of a root with each peer
+type progressTracker struct {
+	command string
+	root    cid.Cid
+	total   uint64
+	send    func(ProgressResult)
+
+	mu        sync.Mutex
+	transfers map[peer.ID]*transferProgress
+}
+
+func newProgressTracker(command string, root cid.Cid, total uint64, send func(ProgressResult)) *progressTracker {
+	return &progressTracker{
+		command:   command,
+		root:      root,
+		total:     total,
+		send:      send,
+		transfers: make(map[peer.ID]*transferProgress),
+	}
+}
+
+// update applies fn to the progress of the transfer with a peer and sends it unless we did less than
+// transferUpdateInterval ago and neither the status changed nor the transfer is done
+func (t *progressTracker) update(p peer.ID, fn func(*ProgressResult)) {
+	t.mu.Lock()
+	tp, ok := t.transfers[p]
+	if !ok {
+		tp = &transferProgress{ProgressResult: ProgressResult{
+			Command: t.command,
+			Root:    t.root.String(),
+			Peer:    p.String(),
+			Total:   t.total,
+		}}
+		t.transfers[p] = tp
+	}
+	status := tp.Status
+	fn(&tp.ProgressResult)
+	if tp.Status == status && !tp.Done && time.Since(tp.sent) < transferUpdateInterval {
+		t.mu.Unlock()
+		return
+	}
+	tp.sent = time.Now()
+	pr := tp.ProgressResult
+	t.mu.Unlock()
+
+	t.send(pr)
+}
+
+// watchProgress sends the progress of the transfers of a root with any peer to the client of a command
+// until the returned function is called
+func (nd *node) watchProgress(ctx context.Context, command string, root cid.Cid, total uint64) func() {
+	tracker := newProgressTracker(command, root, total, func(pr ProgressResult) {
+		nd.send(ctx, Notify{ProgressResult: &pr})
+	})
+	self := nd.host.ID()
+	unsubTransfers := nd.exch.Supply().SubscribeToTransfers(root, func(event datatransfer.Event, state datatransfer.ChannelState) {
+		switch event.Code {
+		case datatransfer.DataReceived, datatransfer.DataSent, datatransfer.Accept, datatransfer.Complete,
+			datatransfer.CleanupComplete, datatransfer.Cancel, datatransfer.Error:
+		default:
+			return
+		}
+		// We receive the content we retrieve and send the content caches pull from us
+		p := state.Recipient()
+		if p == self {
+			p = state.Sender()
+		}
+		tracker.update(p, func(pr *ProgressResult) {
+			if state.Recipient() == self {
+				pr.Bytes = state.Received()
+				pr.Blocks = len(state.ReceivedCids())
+			} else {
+				pr.Bytes = state.Sent()
+			}
+			switch st := state.Status(); st {
+			case datatransfer.Completed, datatransfer.Failed, datatransfer.Cancelled:
+				pr.Done = true
+				pr.Status = datatransfer.Statuses[st]
+			default:
+				// Retrievals report the state of their deal instead
+				if command != "get" {
+					pr.Status = datatransfer.Statuses[st]
+				}
+			}
+		})
+	})
+	unsubDeals := nd.exch.Retrieval().Client().SubscribeToEvents(func(event client.Event, state deal.ClientState) {
+		if !state.PayloadCID.Equals(root) {
+			return
+		}
+		tracker.update(state.Sender, func(pr *ProgressResult) {
+			pr.Status = deal.Statuses[state.Status]
+			if state.TotalReceived > pr.Bytes {
+				pr.Bytes = state.TotalReceived
+			}
+		})
+	})
+	return func() {
+		unsubTransfers()
+		unsubDeals()
+	}
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"testing"
+
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProgressTracker(t *testing.T) {
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	var sent []ProgressResult
+	tracker := newProgressTracker("get", root, 1000, func(pr ProgressResult) {
+		sent = append(sent, pr)
+	})
+	p1 := test.RandPeerIDFatal(t)
+	p2 := test.RandPeerIDFatal(t)
+
+	tracker.update(p1, func(pr *ProgressResult) { pr.Status = "Accepted" })
+	tracker.update(p1, func(pr *ProgressResult) { pr.Status = "Ongoing" })
+	// Updates are throttled unless the status changes
+	tracker.update(p1, func(pr *ProgressResult) { pr.Bytes = 100; pr.Blocks = 1 })
+	tracker.update(p1, func(pr *ProgressResult) { pr.Bytes = 200; pr.Blocks = 2 })
+	// Each peer is throttled separately
+	tracker.update(p2, func(pr *ProgressResult) { pr.Bytes = 50 })
+	tracker.update(p1, func(pr *ProgressResult) { pr.Bytes = 1000; pr.Blocks = 10; pr.Done = true })
+
+	require.Len(t, sent, 4)
+	require.Equal(t, "Accepted", sent[0].Status)
+	require.Equal(t, "get", sent[0].Command)
+	require.Equal(t, root.String(), sent[0].Root)
+	require.Equal(t, uint64(1000), sent[0].Total)
+	require.Equal(t, "Ongoing", sent[1].Status)
+	require.Equal(t, p2.String(), sent[2].Peer)
+	require.Equal(t, uint64(50), sent[2].Bytes)
+	require.Equal(t, p1.String(), sent[3].Peer)
+	require.True(t, sent[3].Done)
+	require.Equal(t, 10, sent[3].Blocks)
+	require.Equal(t, "Ongoing", sent[3].Status)
+}
@@ -0,0 +1,73 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/supply"
+)
+
+// receiptsTimeout bounds how long we wait for a cache to send its receipts
+const receiptsTimeout = 30 * time.Second
+
+// Receipts collects the receipts the caches of a content countersigned and sums the bytes they served
+func (nd *node) Receipts(ctx context.Context, args *ReceiptsArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			ReceiptsResult: &ReceiptsResult{
+				Err: err.Error(),
+			}})
+	}
+	root, err := cid.Parse(args.Root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	var providers []peer.ID
+	for _, p := range args.Providers {
+		pid, err := peer.Decode(p)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		providers = append(providers, pid)
+	}
+	if len(providers) == 0 {
+		providers, err = nd.exch.Supply().Caches(root)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+	}
+
+	res := &ReceiptsResult{
+		Root:      root.String(),
+		Providers: make([]ProviderReceipts, len(providers)),
+	}
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			pr := ProviderReceipts{Provider: p.String()}
+			fctx, cancel := context.WithTimeout(ctx, receiptsTimeout)
+			defer cancel()
+			rcpts, err := nd.exch.Supply().FetchReceipts(fctx, p, root)
+			if err != nil {
+				pr.Err = err.Error()
+			} else {
+				pr.Receipts = len(rcpts)
+				pr.Bytes = supply.AggregateReceipts(rcpts)[p]
+			}
+			res.Providers[i] = pr
+		}(i, p)
+	}
+	wg.Wait()
+	for _, pr := range res.Providers {
+		res.Bytes += pr.Bytes
+	}
+	nd.send(ctx, Notify{ReceiptsResult: res})
+}
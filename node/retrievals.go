@@ -0,0 +1,54 @@
+package node
+
+import (
+	"context"
+	"strings"
+
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/retrieval"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// retrievalEntry converts a deal record into an entry with the amount paid in FIL
+func retrievalEntry(rec retrieval.DealRecord) RetrievalEntry {
+	return RetrievalEntry{
+		Direction: string(rec.Direction),
+		ID:        uint64(rec.ID),
+		Peer:      rec.Peer.String(),
+		Root:      rec.PayloadCID.String(),
+		Bytes:     rec.Bytes,
+		Paid:      filecoin.FIL(rec.Paid).Short(),
+		Duration:  rec.Duration,
+		Status:    strings.TrimPrefix(deal.Statuses[rec.Status], "DealStatus"),
+		Message:   rec.Message,
+		End:       rec.End,
+	}
+}
+
+// Retrievals sends the retrieval deals we served and made during a time range with the total we earned
+// and spent
+func (nd *node) Retrievals(ctx context.Context, args *RetrievalsArgs) {
+	recs, err := nd.exch.Retrieval().History().ListDeals(args.From, args.To)
+	if err != nil {
+		nd.send(ctx, Notify{
+			RetrievalsResult: &RetrievalsResult{
+				Err: err.Error(),
+			}})
+		return
+	}
+	earned, spent := big.Zero(), big.Zero()
+	res := &RetrievalsResult{}
+	for _, rec := range recs {
+		switch rec.Direction {
+		case retrieval.DealInbound:
+			earned = big.Add(earned, rec.Paid)
+		case retrieval.DealOutbound:
+			spent = big.Add(spent, rec.Paid)
+		}
+		res.Deals = append(res.Deals, retrievalEntry(rec))
+	}
+	res.Earned = filecoin.FIL(earned).Short()
+	res.Spent = filecoin.FIL(spent).Short()
+	nd.send(ctx, Notify{RetrievalsResult: res})
+}
@@ -0,0 +1,300 @@
+package node
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/ipfs/go-cid"
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog/log"
+)
+
+// RPCVersion is the version of the JSON-RPC API, served on /rpc/<version>. Methods are only added
+// to a version, changing or removing one bumps the version.
+const RPCVersion = "v0"
+
+// RPCNamespace prefixes the JSON-RPC methods e.g. Pop.Status
+const RPCNamespace = "Pop"
+
+// rpcTokenFile is the file in the repo keeping the token of the JSON-RPC API when none is configured
+const rpcTokenFile = "rpc-token"
+
+// RPCPath is the path the JSON-RPC API is served on over HTTP and WebSocket
+const RPCPath = "/rpc/" + RPCVersion
+
+// RPCEvent is an event of the node streamed to the subscribers of the JSON-RPC API
+type RPCEvent struct {
+	// Type is either content when content is added to our supply or removed from it or retrieval
+	// when a retrieval deal we made changes state
+	Type  string
+	Root  string
+	Added bool `json:",omitempty"`
+	// Retrieval events
+	DealID uint64 `json:",omitempty"`
+	Event  string `json:",omitempty"`
+	Status string `json:",omitempty"`
+	Bytes  uint64 `json:",omitempty"`
+}
+
+// rpcAPI exposes the node commands over JSON-RPC. One-off commands return their result while commands
+// reporting progress stream it over a channel, which requires a WebSocket connection.
+type rpcAPI struct {
+	nd *node
+}
+
+// rpcCall runs a command and returns the first notification carrying the result picked by want.
+// Commands may report their progress before sending their result.
+func rpcCall(ctx context.Context, cmd func(context.Context), want func(Notify) bool) Notify {
+	var (
+		mu  sync.Mutex
+		res Notify
+		got bool
+	)
+	cmd(withNotify(ctx, func(no Notify) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !got && want(no) {
+			res = no
+			got = true
+		}
+	}))
+	return res
+}
+
+// rpcErr returns the error reported in the result of a command
+func rpcErr(msg string) error {
+	if msg != "" {
+		return errors.New(msg)
+	}
+	return nil
+}
+
+// Add chunks and stages a file or directory on the node file system for the next Pack
+func (a *rpcAPI) Add(ctx context.Context, args AddArgs) (*AddResult, error) {
+	res := rpcCall(ctx, func(ctx context.Context) { a.nd.Add(ctx, &args) }, func(no Notify) bool {
+		return no.AddResult != nil
+	}).AddResult
+	if res == nil {
+		return nil, errNoResult
+	}
+	return res, rpcErr(res.Err)
+}
+
+// Pack commits the staged DAGs into an archive we can push and provide
+func (a *rpcAPI) Pack(ctx context.Context, args PackArgs) (*PackResult, error) {
+	res := rpcCall(ctx, func(ctx context.Context) { a.nd.Pack(ctx, &args) }, func(no Notify) bool {
+		return no.PackResult != nil
+	}).PackResult
+	if res == nil {
+		return nil, errNoResult
+	}
+	return res, rpcErr(res.Err)
+}
+
+// Quote returns the price miners ask to store a commit
+func (a *rpcAPI) Quote(ctx context.Context, args QuoteArgs) (*QuoteResult, error) {
+	res := rpcCall(ctx, func(ctx context.Context) { a.nd.Quote(ctx, &args) }, func(no Notify) bool {
+		return no.QuoteResult != nil
+	}).QuoteResult
+	if res == nil {
+		return nil, errNoResult
+	}
+	return res, rpcErr(res.Err)
+}
+
+// Status returns the staged content and the state of the node
+func (a *rpcAPI) Status(ctx context.Context, args StatusArgs) (*StatusResult, error) {
+	res := rpcCall(ctx, func(ctx context.Context) { a.nd.Status(ctx, &args) }, func(no Notify) bool {
+		return no.StatusResult != nil
+	}).StatusResult
+	if res == nil {
+		return nil, errNoResult
+	}
+	return res, rpcErr(res.Err)
+}
+
+// List returns a page of the content we provide
+func (a *rpcAPI) List(ctx context.Context, args ListArgs) (*ListResult, error) {
+	res := rpcCall(ctx, func(ctx context.Context) { a.nd.List(ctx, &args) }, func(no Notify) bool {
+		return no.ListResult != nil
+	}).ListResult
+	if res == nil {
+		return nil, errNoResult
+	}
+	return res, rpcErr(res.Err)
+}
+
+// Push streams the storage deals then the caches who pulled a commit until the push completes
+func (a *rpcAPI) Push(ctx context.Context, args PushArgs) (<-chan PushResult, error) {
+	out := make(chan PushResult, 8)
+	a.stream(ctx, func(ctx context.Context) { a.nd.Push(ctx, &args) }, func(no Notify) {
+		if no.PushResult == nil {
+			return
+		}
+		select {
+		case out <- *no.PushResult:
+		case <-ctx.Done():
+		}
+	}, func() { close(out) })
+	return out, nil
+}
+
+// Get streams the progress of a retrieval until the content is local
+func (a *rpcAPI) Get(ctx context.Context, args GetArgs) (<-chan GetResult, error) {
+	if args.Timeout == 0 {
+		args.Timeout = DefaultGetTimeout
+	}
+	out := make(chan GetResult, 8)
+	a.stream(ctx, func(ctx context.Context) { a.nd.Get(ctx, &args) }, func(no Notify) {
+		if no.GetResult == nil {
+			return
+		}
+		select {
+		case out <- *no.GetResult:
+		case <-ctx.Done():
+		}
+	}, func() { close(out) })
+	return out, nil
+}
+
+// stream runs a command in the background passing its notifications to send until it completes then
+// calls done. Notifications sent after the command returned are dropped.
+func (a *rpcAPI) stream(ctx context.Context, cmd func(context.Context), send func(Notify), done func()) {
+	go func() {
+		var (
+			mu     sync.Mutex
+			closed bool
+		)
+		cmd(withNotify(ctx, func(no Notify) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !closed {
+				send(no)
+			}
+		}))
+		mu.Lock()
+		closed = true
+		done()
+		mu.Unlock()
+	}()
+}
+
+// Events streams the content added to our supply or removed from it and the state changes of our
+// retrievals until the subscriber disconnects
+func (a *rpcAPI) Events(ctx context.Context) (<-chan RPCEvent, error) {
+	out := make(chan RPCEvent, 16)
+	var (
+		mu     sync.Mutex
+		closed bool
+	)
+	emit := func(e RPCEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case out <- e:
+		default:
+			log.Debug().Str("type", e.Type).Msg("rpc subscriber lagging, dropping event")
+		}
+	}
+	unsubContent := a.nd.exch.Supply().SubscribeToContent(func(root cid.Cid, added bool) {
+		emit(RPCEvent{Type: "content", Root: root.String(), Added: added})
+	})
+	unsubRetrieval := a.nd.exch.Retrieval().Client().SubscribeToEvents(func(event client.Event, state deal.ClientState) {
+		emit(RPCEvent{
+			Type:   "retrieval",
+			Root:   state.PayloadCID.String(),
+			DealID: uint64(state.ID),
+			Event:  client.Events[event],
+			Status: deal.Statuses[state.Status],
+			Bytes:  state.TotalReceived,
+		})
+	})
+	go func() {
+		<-ctx.Done()
+		unsubContent()
+		unsubRetrieval()
+		mu.Lock()
+		closed = true
+		close(out)
+		mu.Unlock()
+	}()
+	return out, nil
+}
+
+// rpcHandler serves the JSON-RPC API to the clients presenting the token
+func (nd *node) rpcHandler(token string) http.Handler {
+	srv := jsonrpc.NewServer()
+	srv.Register(RPCNamespace, &rpcAPI{nd: nd})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Browsers cannot set headers on WebSocket connections so they pass the token in the query
+		given := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if given == "" {
+			given = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		srv.ServeHTTP(w, r)
+	})
+}
+
+// serveRPC serves the JSON-RPC API on RPCPath until the context is cancelled
+func (nd *node) serveRPC(ctx context.Context, addr, token string) {
+	mux := http.NewServeMux()
+	mux.Handle(RPCPath, nd.rpcHandler(token))
+	srv := &http.Server{
+		Addr:    addr,
+		Handler: mux,
+		// No read timeout as WebSocket connections stay open for subscriptions
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Error().Err(err).Msg("failed to serve rpc")
+	}
+}
+
+// loadRPCToken returns the configured token of the JSON-RPC API or the one kept in the repo,
+// generating it the first time
+func loadRPCToken(repo, token string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	p := filepath.Join(repo, rpcTokenFile)
+	b, err := ioutil.ReadFile(p)
+	if err == nil && len(strings.TrimSpace(string(b))) > 0 {
+		return strings.TrimSpace(string(b)), nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token = hex.EncodeToString(buf)
+	if err := ioutil.WriteFile(p, []byte(token), 0600); err != nil {
+		return "", err
+	}
+	return token, nil
+}
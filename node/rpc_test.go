@@ -0,0 +1,131 @@
+package node
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/ipfs/go-datastore"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRPC(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+
+	token, err := loadRPCToken(t.TempDir(), "")
+	require.NoError(t, err)
+	require.Len(t, token, 64)
+
+	srv := httptest.NewServer(nd.rpcHandler(token))
+	defer srv.Close()
+
+	// Clients without the token are rejected
+	res, err := http.Post(srv.URL, "application/json", strings.NewReader(`{"jsonrpc":"2.0","method":"Pop.Status","params":[{}],"id":1}`))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	var api struct {
+		Add    func(context.Context, AddArgs) (*AddResult, error)
+		Pack   func(context.Context, PackArgs) (*PackResult, error)
+		Status func(context.Context, StatusArgs) (*StatusResult, error)
+		List   func(context.Context, ListArgs) (*ListResult, error)
+		Events func(context.Context) (<-chan RPCEvent, error)
+	}
+	closer, err := jsonrpc.NewMergeClient(ctx, "ws://"+srv.Listener.Addr().String(), RPCNamespace,
+		[]interface{}{&api},
+		http.Header{"Authorization": []string{"Bearer " + token}},
+	)
+	require.NoError(t, err)
+	defer closer()
+
+	events, err := api.Events(ctx)
+	require.NoError(t, err)
+
+	p := filepath.Join(t.TempDir(), "data.txt")
+	require.NoError(t, ioutil.WriteFile(p, []byte("hello rpc"), 0666))
+
+	added, err := api.Add(ctx, AddArgs{Path: p, ChunkSize: 1024})
+	require.NoError(t, err)
+	require.NotEmpty(t, added.Cid)
+
+	status, err := api.Status(ctx, StatusArgs{})
+	require.NoError(t, err)
+	require.Contains(t, status.Output, "data.txt")
+
+	packed, err := api.Pack(ctx, PackArgs{})
+	require.NoError(t, err)
+
+	select {
+	case e := <-events:
+		require.Equal(t, "content", e.Type)
+		require.Equal(t, packed.DataCID, e.Root)
+		require.True(t, e.Added)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no content event")
+	}
+
+	list, err := api.List(ctx, ListArgs{})
+	require.NoError(t, err)
+	require.Equal(t, 1, list.Total)
+	require.Equal(t, packed.DataCID, list.Entries[0].Root)
+
+	// Errors are returned to the client
+	_, err = api.Add(ctx, AddArgs{Path: filepath.Join(t.TempDir(), "missing")})
+	require.Error(t, err)
+}
+
+// slowAddsDatastore delays loading the progress of adds so they last longer than a progress update
+type slowAddsDatastore struct {
+	datastore.Batching
+	delay time.Duration
+}
+
+func (ds slowAddsDatastore) Get(key datastore.Key) ([]byte, error) {
+	if strings.Contains(key.String(), "/"+KAdds+"/") {
+		time.Sleep(ds.delay)
+	}
+	return ds.Batching.Get(key)
+}
+
+func TestRPCSlowAdd(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+	nd := newTestNode(ctx, mn, t)
+	nd.ds = slowAddsDatastore{Batching: nd.ds, delay: 3 * time.Second}
+
+	token, err := loadRPCToken(t.TempDir(), "")
+	require.NoError(t, err)
+	srv := httptest.NewServer(nd.rpcHandler(token))
+	defer srv.Close()
+
+	var api struct {
+		Add func(context.Context, AddArgs) (*AddResult, error)
+	}
+	closer, err := jsonrpc.NewMergeClient(ctx, "ws://"+srv.Listener.Addr().String(), RPCNamespace,
+		[]interface{}{&api},
+		http.Header{"Authorization": []string{"Bearer " + token}},
+	)
+	require.NoError(t, err)
+	defer closer()
+
+	p := filepath.Join(t.TempDir(), "data.txt")
+	require.NoError(t, ioutil.WriteFile(p, []byte("hello slow rpc"), 0666))
+
+	// The add reports its progress before its result
+	start := time.Now()
+	added, err := api.Add(ctx, AddArgs{Path: p, ChunkSize: 1024})
+	require.NoError(t, err)
+	require.NotEmpty(t, added.Cid)
+	require.True(t, time.Since(start) > 3*time.Second)
+}
@@ -0,0 +1,83 @@
+package node
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/supply"
+)
+
+// RuleSet is the set of rules deciding which dispatch requests we accept. Empty fields accept everything.
+type RuleSet struct {
+	MaxSize    uint64   // MaxSize is the largest content in bytes we pull
+	Regions    []string // Regions we accept requests for
+	Publishers []string // Publishers are the peer IDs we accept content from
+	MinPrice   string   // MinPrice is the lowest price per byte in FIL publishers must offer
+}
+
+// parse converts the rule set into supply accept rules
+func (rs RuleSet) parse() (supply.AcceptRules, error) {
+	rules := supply.AcceptRules{
+		MaxSize: rs.MaxSize,
+		Regions: rs.Regions,
+	}
+	for _, s := range rs.Publishers {
+		p, err := peer.Decode(s)
+		if err != nil {
+			return rules, fmt.Errorf("invalid publisher %s: %w", s, err)
+		}
+		rules.Publishers = append(rules.Publishers, p)
+	}
+	if rs.MinPrice != "" {
+		f, err := filecoin.ParseFIL(rs.MinPrice)
+		if err != nil {
+			return rules, fmt.Errorf("invalid min price: %w", err)
+		}
+		rules.MinPricePerByte = abi.TokenAmount(f)
+	}
+	return rules, nil
+}
+
+// formatRules converts supply accept rules into a rule set
+func formatRules(rules supply.AcceptRules) RuleSet {
+	rs := RuleSet{
+		MaxSize: rules.MaxSize,
+		Regions: rules.Regions,
+	}
+	for _, p := range rules.Publishers {
+		rs.Publishers = append(rs.Publishers, p.String())
+	}
+	if !rules.MinPricePerByte.Nil() && !rules.MinPricePerByte.IsZero() {
+		rs.MinPrice = filecoin.FIL(rules.MinPricePerByte).Short()
+	}
+	return rs
+}
+
+// Rules replaces the rules deciding which dispatch requests we accept if new ones are given and
+// sends the current rules
+func (nd *node) Rules(ctx context.Context, args *RulesArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			RulesResult: &RulesResult{
+				Err: err.Error(),
+			}})
+	}
+	if args.Set != nil {
+		rules, err := args.Set.parse()
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		if err := nd.exch.Supply().SetAcceptRules(rules); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	nd.send(ctx, Notify{
+		RulesResult: &RulesResult{
+			Rules: formatRules(nd.exch.Supply().AcceptRules()),
+		}})
+}
@@ -0,0 +1,60 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/myelnet/pop/supply"
+)
+
+// Schema attaches a schema to a content root, detaches it or returns the schema attached to it. Caches we
+// dispatch the content to receive the schema with the request and reject content not conforming to it.
+func (nd *node) Schema(ctx context.Context, args *SchemaArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			SchemaResult: &SchemaResult{
+				Root: args.Root,
+				Err:  err.Error(),
+			}})
+	}
+	root, err := cid.Parse(args.Root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	sup := nd.exch.Supply()
+	switch {
+	case args.Remove:
+		if err := sup.Schemas().Detach(root); err != nil {
+			sendErr(err)
+			return
+		}
+	case len(args.Set) > 0:
+		sch, err := supply.ParseSchema(args.Set)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+		if err := sup.AttachSchema(root, sch); err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	res := &SchemaResult{Root: root.String()}
+	sch, err := sup.Schemas().Get(root)
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		sendErr(err)
+		return
+	}
+	if sch != nil {
+		res.Schema, err = json.Marshal(sch)
+		if err != nil {
+			sendErr(err)
+			return
+		}
+	}
+	nd.send(ctx, Notify{SchemaResult: res})
+}
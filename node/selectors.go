@@ -0,0 +1,273 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/myelnet/pop"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// ErrInvalidSelector is returned when a selector string cannot be compiled
+var ErrInvalidSelector = errors.New("invalid selector")
+
+// selection is the part of a DAG a get request retrieves
+type selection struct {
+	// node is a selector given as dag-json
+	node ipld.Node
+	// path is the name of the manifest entry to retrieve
+	path string
+	// variant is the name of the variant of the entry to retrieve instead of the entry itself
+	variant string
+	// start and end are the range of manifest entries to retrieve, end excluded
+	start, end int
+}
+
+// parseSelection compiles the selector string and path segments of a get request. The selector may be
+// "all", a range of manifest entries as "<start>:<end>" or a selector serialized as dag-json. A path
+// selects the manifest entry with the same name and cannot be combined with another selector.
+func parseSelection(sel string, segs []string) (*selection, error) {
+	s := &selection{path: strings.Join(segs, "/")}
+	sel = strings.TrimSpace(sel)
+	if sel == "" || sel == "all" {
+		return s, nil
+	}
+	if s.path != "" {
+		return nil, fmt.Errorf("%w: cannot combine a path with selector %q", ErrInvalidSelector, sel)
+	}
+	if strings.HasPrefix(sel, "{") {
+		nb := basicnode.Prototype.Any.NewBuilder()
+		if err := dagjson.Decoder(nb, bytes.NewReader([]byte(sel))); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+		}
+		s.node = nb.Build()
+		if _, err := selector.ParseSelector(s.node); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSelector, err)
+		}
+		return s, nil
+	}
+	bounds := strings.SplitN(sel, ":", 2)
+	if len(bounds) != 2 {
+		return nil, fmt.Errorf("%w: %q is neither all, a range nor a dag-json selector", ErrInvalidSelector, sel)
+	}
+	var err error
+	if s.start, err = strconv.Atoi(bounds[0]); err != nil {
+		return nil, fmt.Errorf("%w: range start: %v", ErrInvalidSelector, err)
+	}
+	if s.end, err = strconv.Atoi(bounds[1]); err != nil {
+		return nil, fmt.Errorf("%w: range end: %v", ErrInvalidSelector, err)
+	}
+	if s.start < 0 || s.end <= s.start {
+		return nil, fmt.Errorf("%w: empty range %d:%d", ErrInvalidSelector, s.start, s.end)
+	}
+	return s, nil
+}
+
+// all tells if the whole DAG is retrieved
+func (s *selection) all() bool {
+	return s.node == nil && s.path == "" && s.end == 0
+}
+
+// needsManifest tells if the manifest must be read to compile the selector
+func (s *selection) needsManifest() bool {
+	return s.path != ""
+}
+
+// selector returns the selector to send with the retrieval proposal. The manifest is only required
+// to resolve paths.
+func (s *selection) selector(m *Manifest) (ipld.Node, error) {
+	switch {
+	case s.node != nil:
+		return s.node, nil
+	case s.path != "":
+		if m == nil {
+			return nil, fmt.Errorf("no manifest to resolve %s", s.path)
+		}
+		i, err := m.entryIndex(s.path)
+		if err != nil {
+			return nil, err
+		}
+		if s.variant != "" {
+			if _, err := m.Variant(s.path, s.variant); err != nil {
+				return nil, err
+			}
+			return variantSelector(i, s.variant), nil
+		}
+		return entriesSelector(i, i+1), nil
+	case s.end > 0:
+		return entriesSelector(s.start, s.end), nil
+	}
+	return pop.AllSelector(), nil
+}
+
+// entryIndex returns the position of an entry in the manifest
+func (m *Manifest) entryIndex(name string) (int, error) {
+	for i, e := range m.Entries {
+		if e.Name == name {
+			return i, nil
+		}
+	}
+	return 0, ErrEntryNotFound
+}
+
+// rootSelector only selects the root block, for instance to read a manifest
+func rootSelector() ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return ssb.Matcher().Node()
+}
+
+// entriesSelector selects the manifest root and the whole DAG of the entries in the range
+func entriesSelector(start, end int) ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return exploreEntries(ssb, start, end, ssb.ExploreRecursive(selector.RecursionLimitNone(),
+		ssb.ExploreAll(ssb.ExploreRecursiveEdge())))
+}
+
+// entryBlockSelector selects the manifest root and the root block of an entry
+func entryBlockSelector(i int) ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return exploreEntries(ssb, i, i+1, ssb.Matcher())
+}
+
+// exploreEntries selects the manifest root and what the link selector selects from the root of the
+// entries in the range. Manifests packed before versioning are a plain list of entries so both layouts
+// are explored.
+func exploreEntries(ssb builder.SelectorSpecBuilder, start, end int, link builder.SelectorSpec) ipld.Node {
+	entries := ssb.ExploreRange(int64(start), int64(end), ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("Link", link)
+	}))
+	return ssb.ExploreUnion(
+		ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+			efsb.Insert("Entries", entries)
+		}),
+		entries,
+	).Node()
+}
+
+// variantSelector selects the manifest root and the whole DAG of a variant of an entry. Variants were
+// introduced after versioning so manifests are always maps.
+func variantSelector(i int, variant string) ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	entry := ssb.ExploreIndex(int64(i), ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("Variants", ssb.ExploreFields(func(vsb builder.ExploreFieldsSpecBuilder) {
+			vsb.Insert(variant, ssb.ExploreRecursive(selector.RecursionLimitNone(),
+				ssb.ExploreAll(ssb.ExploreRecursiveEdge())))
+		}))
+	}))
+	return ssb.ExploreFields(func(efsb builder.ExploreFieldsSpecBuilder) {
+		efsb.Insert("Entries", entry)
+	}).Node()
+}
+
+// retrieveManifest only retrieves the root block from the provider of the offer to read the manifest
+func (nd *node) retrieveManifest(ctx context.Context, session *pop.Session, root cid.Cid, offer *deal.Offer) (*Manifest, error) {
+	session.SetSelector(rootSelector())
+	if err := session.SyncBlocks(ctx, offer); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-session.Done():
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return nil, err
+	}
+	return w.Manifest(ctx, root, session.StoreID())
+}
+
+// storeSelection registers the manifest entries retrieved with a path or range in our supply as each of
+// them is a complete DAG, then exports them. The root itself is never registered since we only have part
+// of its DAG. A dag-json selector may select anything so only the root is exported.
+func (nd *node) storeSelection(ctx context.Context, root cid.Cid, sel *selection, out string, sid multistore.StoreID) error {
+	if sel.node != nil {
+		if out == "" {
+			return nil
+		}
+		return nd.export(ctx, root, "", out, sid)
+	}
+	w, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return err
+	}
+	m, err := w.Manifest(ctx, root, sid)
+	if err != nil {
+		return err
+	}
+	if sel.variant != "" {
+		c, err := m.Variant(sel.path, sel.variant)
+		if err != nil {
+			return err
+		}
+		if err := nd.exch.Supply().Register(c, sid); err != nil {
+			return err
+		}
+		if out == "" {
+			return nil
+		}
+		file, err := w.LoadFile(ctx, c, sid)
+		if err != nil {
+			return err
+		}
+		return files.WriteTo(file, out)
+	}
+	var entries []*Entry
+	if sel.path != "" {
+		i, err := m.entryIndex(sel.path)
+		if err != nil {
+			return err
+		}
+		entries = m.Entries[i : i+1]
+	} else {
+		if sel.start >= len(m.Entries) {
+			return ErrEntryNotFound
+		}
+		end := sel.end
+		if end > len(m.Entries) {
+			end = len(m.Entries)
+		}
+		entries = m.Entries[sel.start:end]
+	}
+	for _, e := range entries {
+		if err := nd.exch.Supply().Register(e.Cid, sid); err != nil {
+			return err
+		}
+		if out == "" {
+			continue
+		}
+		// A single path is written to the output while ranges write each entry into the output directory
+		target := out
+		if sel.path == "" {
+			target = filepath.Join(out, e.Name)
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+		}
+		file, err := w.LoadFile(ctx, e.Cid, sid)
+		if err != nil {
+			return err
+		}
+		if err := files.WriteTo(file, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/myelnet/pop"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSelection(t *testing.T) {
+	testCases := []struct {
+		name string
+		sel  string
+		segs []string
+		err  bool
+		all  bool
+	}{
+		{name: "default", sel: "", all: true},
+		{name: "all", sel: "all", all: true},
+		{name: "path", sel: "all", segs: []string{"dir", "file.png"}},
+		{name: "range", sel: "2:5"},
+		{name: "json", sel: `{"R":{"l":{"none":{}},":>":{"a":{">":{"@":{}}}}}}`},
+		{name: "path and range", sel: "0:1", segs: []string{"file.png"}, err: true},
+		{name: "empty range", sel: "3:3", err: true},
+		{name: "negative range", sel: "-1:3", err: true},
+		{name: "not a range", sel: "a:b", err: true},
+		{name: "invalid json", sel: `{"R":`, err: true},
+		{name: "not a selector", sel: `{"foo":"bar"}`, err: true},
+		{name: "unknown", sel: "everything", err: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := parseSelection(tc.sel, tc.segs)
+			if tc.err {
+				require.True(t, errors.Is(err, ErrInvalidSelector))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.all, s.all())
+		})
+	}
+}
+
+func TestSelectionTraversal(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	_, filepaths := genTestFiles(t)
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+	for _, p := range filepaths {
+		_, err := wd.Add(ctx, AddOptions{Path: p, ChunkSize: int64(1 << 10)})
+		require.NoError(t, err)
+	}
+	com, err := wd.Commit(ctx, CommitOptions{Name: "poem"})
+	require.NoError(t, err)
+
+	store, err := ms.Get(com.StoreID)
+	require.NoError(t, err)
+	m, err := wd.Manifest(ctx, com.PayloadCID, com.StoreID)
+	require.NoError(t, err)
+
+	// Each file fits in a single block
+	stat, err := pop.DAGStat(ctx, store.Bstore, com.PayloadCID, pop.AllSelector())
+	require.NoError(t, err)
+	require.Equal(t, 9, stat.NumBlocks)
+
+	stat, err = pop.DAGStat(ctx, store.Bstore, com.PayloadCID, rootSelector())
+	require.NoError(t, err)
+	require.Equal(t, 1, stat.NumBlocks)
+
+	s, err := parseSelection("all", []string{m.Entries[3].Name})
+	require.NoError(t, err)
+	sel, err := s.selector(m)
+	require.NoError(t, err)
+	stat, err = pop.DAGStat(ctx, store.Bstore, com.PayloadCID, sel)
+	require.NoError(t, err)
+	require.Equal(t, 2, stat.NumBlocks)
+
+	s, err = parseSelection("all", []string{"missing.txt"})
+	require.NoError(t, err)
+	_, err = s.selector(m)
+	require.Equal(t, ErrEntryNotFound, err)
+
+	// Ranges past the last entry stop at the end of the manifest
+	s, err = parseSelection("5:20", nil)
+	require.NoError(t, err)
+	sel, err = s.selector(nil)
+	require.NoError(t, err)
+	stat, err = pop.DAGStat(ctx, store.Bstore, com.PayloadCID, sel)
+	require.NoError(t, err)
+	require.Equal(t, 4, stat.NumBlocks)
+}
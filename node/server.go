@@ -3,6 +3,7 @@ package node
 import (
 	"bufio"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"net/http"
 	gopath "path"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -19,6 +21,12 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+// DefaultIdleTimeout is how long we keep a client connection open without any message
+const DefaultIdleTimeout = 5 * time.Minute
+
+// writeTimeout bounds writes to a client so a client not reading doesn't block the others
+const writeTimeout = 10 * time.Second
+
 // server listens for connection and controls the node to execute requests
 type server struct {
 	node *node
@@ -26,8 +34,62 @@ type server struct {
 	csMu sync.Mutex // lock order: csMu, then mu
 	cs   *CommandServer
 
+	// maxMsgSize is the largest message we accept from clients
+	maxMsgSize uint32
+	// idleTimeout closes connections without any message for this long, zero never closes them
+	idleTimeout time.Duration
+
 	mu      sync.Mutex
-	clients map[net.Conn]bool
+	clients map[net.Conn]*clientConn
+}
+
+// clientConn is the state of a connection with a client
+type clientConn struct {
+	net.Conn
+
+	msgSize uint32 // message size negotiated with the client, accessed atomically
+	active  int64  // unix time in nanoseconds of the last message, accessed atomically
+	done    chan struct{}
+
+	wmu sync.Mutex // serializes writes
+}
+
+func (cc *clientConn) maxMsgSize() uint32 {
+	return atomic.LoadUint32(&cc.msgSize)
+}
+
+// touch records activity on the connection
+func (cc *clientConn) touch() {
+	atomic.StoreInt64(&cc.active, time.Now().UnixNano())
+}
+
+// idle returns how long since the last message on the connection
+func (cc *clientConn) idle() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&cc.active)))
+}
+
+func (cc *clientConn) write(b []byte) error {
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	return cc.writeLocked(b)
+}
+
+func (cc *clientConn) writeLocked(b []byte) error {
+	cc.SetWriteDeadline(time.Now().Add(writeTimeout))
+	defer cc.SetWriteDeadline(time.Time{})
+	if err := WriteMsgLimit(cc.Conn, b, cc.maxMsgSize()); err != nil {
+		return err
+	}
+	cc.touch()
+	return nil
+}
+
+// notify sends a notification to the client. Clients we fail to write to are disconnected.
+func (cc *clientConn) notify(n Notify) {
+	if err := cc.write(marshalNotify(n)); err != nil {
+		log.Error().Err(err).Msg("WriteMsg")
+		cc.Close()
+	}
 }
 
 func (s *server) serveConn(ctx context.Context, c net.Conn) {
@@ -53,11 +115,17 @@ func (s *server) serveConn(ctx context.Context, c net.Conn) {
 		return
 	}
 
-	s.addConn(c)
+	cc := s.addConn(c)
 	defer s.removeAndCloseConn(c)
 
+	if s.idleTimeout > 0 {
+		go s.closeIdle(cc)
+	}
+	// Results of the commands sent on this connection are only written back to it
+	ctx = withNotify(ctx, cc.notify)
+
 	for ctx.Err() == nil {
-		msg, err := ReadMsg(br)
+		msg, err := ReadMsgLimit(br, cc.maxMsgSize())
 		if errors.Is(err, io.EOF) {
 			return
 		}
@@ -65,8 +133,30 @@ func (s *server) serveConn(ctx context.Context, c net.Conn) {
 			log.Error().Err(err).Msg("ReadMsg")
 			return
 		}
+		cc.touch()
+		// Clients send empty messages to keep the connection open
+		if len(msg) == 0 {
+			continue
+		}
+		cmd := &Command{}
+		if err := json.Unmarshal(msg, cmd); err != nil {
+			log.Error().Err(err).Msg("GotMsgBytes")
+			continue
+		}
+		if cmd.Hello != nil {
+			s.hello(cc, cmd.Hello)
+			continue
+		}
+		cctx := ctx
+		if id := cmd.RequestID; id != 0 {
+			// Tag the notifications so the client can tell the results of concurrent commands apart
+			cctx = withNotify(ctx, func(n Notify) {
+				n.RequestID = id
+				cc.notify(n)
+			})
+		}
 		s.csMu.Lock()
-		if err := s.cs.GotMsgBytes(ctx, msg); err != nil {
+		if err := s.cs.GotMsg(cctx, cmd); err != nil {
 			log.Error().Err(err).Msg("GotMsgBytes")
 		}
 		s.csMu.Unlock()
@@ -74,29 +164,101 @@ func (s *server) serveConn(ctx context.Context, c net.Conn) {
 	}
 }
 
-func (s *server) addConn(c net.Conn) {
+// closeIdle closes the connection once it has been idle for longer than the idle timeout. Notifications
+// we write count as activity so clients waiting for a command don't need to keep the connection open.
+func (s *server) closeIdle(cc *clientConn) {
+	for {
+		select {
+		case <-cc.done:
+			return
+		case <-time.After(s.idleTimeout - cc.idle()):
+			if cc.idle() >= s.idleTimeout {
+				log.Debug().Str("addr", cc.RemoteAddr().String()).Msg("closing idle connection")
+				cc.Close()
+				return
+			}
+		}
+	}
+}
+
+// defaultMsgSize is the message size of clients which did not negotiate. They can't read messages larger
+// than MaxMessageSize.
+func (s *server) defaultMsgSize() uint32 {
+	return NegotiateMessageSize(MaxMessageSize, s.maxMsgSize)
+}
+
+func (s *server) connMsgSize(c net.Conn) uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cc, ok := s.clients[c]; ok {
+		return cc.maxMsgSize()
+	}
+	return s.defaultMsgSize()
+}
+
+// hello answers the client with the message size we agree on and uses it for the connection
+func (s *server) hello(cc *clientConn, args *HelloArgs) {
+	size := NegotiateMessageSize(args.MaxMessageSize, s.maxMsgSize)
+	b, err := json.Marshal(Notify{HelloResult: &HelloResult{
+		MaxMessageSize: size,
+		IdleTimeout:    s.idleTimeout,
+	}})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed json.Marshal(hello)")
+		return
+	}
+	cc.wmu.Lock()
+	defer cc.wmu.Unlock()
+	// Write the answer with the previous size so the client reads it before any larger message
+	if err := cc.writeLocked(b); err != nil {
+		log.Error().Err(err).Msg("WriteMsg")
+		return
+	}
+	atomic.StoreUint32(&cc.msgSize, size)
+}
+
+func (s *server) addConn(c net.Conn) *clientConn {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	if s.clients == nil {
-		s.clients = map[net.Conn]bool{}
+		s.clients = map[net.Conn]*clientConn{}
 	}
 
-	s.clients[c] = true
+	cc := &clientConn{
+		Conn:    c,
+		msgSize: s.defaultMsgSize(),
+		done:    make(chan struct{}),
+	}
+	cc.touch()
+	s.clients[c] = cc
+	return cc
 }
 
 func (s *server) removeAndCloseConn(c net.Conn) {
 	s.mu.Lock()
-	delete(s.clients, c)
+	if cc, ok := s.clients[c]; ok {
+		close(cc.done)
+		delete(s.clients, c)
+	}
 	s.mu.Unlock()
 	c.Close()
 }
 
+// writeToClients broadcasts notifications which are not the result of a client command
 func (s *server) writeToClients(b []byte) {
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	for c := range s.clients {
-		WriteMsg(c, b)
+	clients := make([]*clientConn, 0, len(s.clients))
+	for _, cc := range s.clients {
+		clients = append(clients, cc)
+	}
+	s.mu.Unlock()
+	// Write outside the lock so slow clients don't block new connections
+	for _, cc := range clients {
+		if err := cc.write(b); err != nil {
+			log.Error().Err(err).Msg("WriteMsg")
+			cc.Close()
+		}
 	}
 }
 
@@ -171,7 +333,7 @@ func (s *server) getHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 	}
-	fnd, err := s.node.extractFile(r.Context(), root, segs[0], sID)
+	fnd, err := s.node.extractFile(r.Context(), root, firstSegment(segs), sID)
 	if err != nil {
 		http.Error(w, "Unable to create unix files", http.StatusInternalServerError)
 		return
@@ -217,7 +379,7 @@ func Run(ctx context.Context, opts Options) error {
 	defer close(done)
 
 	// listen, err := socket.Listen(socketPath, port)
-	listen, err := SocketListen(opts.SocketPath)
+	listen, err := SocketListen(opts.SocketPath, opts.SocketMode)
 	if err != nil {
 		return fmt.Errorf("SocketListen: %v", err)
 	}
@@ -236,13 +398,40 @@ func Run(ctx context.Context, opts Options) error {
 	}
 
 	fmt.Printf("==> Started pop node\n")
+	fmt.Printf("==> Listening for commands on %s\n", listen.Addr())
 	fmt.Printf("==> Joined %s regions\n", opts.Regions)
 	if nd.exch.IsFilecoinOnline() {
 		fmt.Printf("==> Connected to Filecoin RPC at %s\n", opts.FilEndpoint)
 	}
+	if nd.metrics != nil {
+		go nd.serveMetrics(ctx, opts.MetricsAddr)
+		fmt.Printf("==> Serving metrics at http://%s/metrics\n", opts.MetricsAddr)
+	}
+	if opts.HTTPGateway != "" {
+		go nd.serveGateway(ctx, opts.HTTPGateway)
+		fmt.Printf("==> Serving content at http://%s/ipfs/\n", opts.HTTPGateway)
+		fmt.Printf("==> Serving delegated routing at http://%s/routing/v1\n", opts.HTTPGateway)
+	}
+	if opts.RPCAddr != "" {
+		token, err := loadRPCToken(opts.RepoPath, opts.RPCToken)
+		if err != nil {
+			return fmt.Errorf("loadRPCToken: %v", err)
+		}
+		go nd.serveRPC(ctx, opts.RPCAddr, token)
+		fmt.Printf("==> Serving JSON-RPC API at http://%s%s\n", opts.RPCAddr, RPCPath)
+	}
 
+	idle := opts.IdleTimeout
+	if idle == 0 {
+		idle = DefaultIdleTimeout
+	}
+	if idle < 0 {
+		idle = 0
+	}
 	server := &server{
-		node: nd,
+		node:        nd,
+		maxMsgSize:  clampMessageSize(opts.MaxMessageSize),
+		idleTimeout: idle,
 	}
 
 	server.cs = NewCommandServer(nd, server.writeToClients)
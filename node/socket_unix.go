@@ -0,0 +1,51 @@
+// +build !windows
+
+package node
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+)
+
+func pathListen(path string, perm os.FileMode) (net.Listener, error) {
+	return unixListen(path, perm)
+}
+
+func pathConnect(path string) (net.Conn, error) {
+	return unixConnect(path)
+}
+
+func unixListen(path string, perm os.FileMode) (net.Listener, error) {
+	c, err := net.Dial("unix", path)
+	if err == nil {
+		c.Close()
+		return nil, fmt.Errorf("%v: address already in use", path)
+	}
+	// Remove the socket left behind by a daemon which did not shut down cleanly
+	_ = os.Remove(path)
+
+	// Only the user can traverse a directory we create
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	pipe, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, perm); err != nil {
+		pipe.Close()
+		return nil, err
+	}
+	return pipe, nil
+}
+
+func unixConnect(path string) (net.Conn, error) {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -0,0 +1,42 @@
+// +build !windows
+
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "run", "popd.sock")
+
+	l, err := SocketListen(path, 0)
+	require.NoError(t, err)
+	defer l.Close()
+
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, DefaultSocketMode, fi.Mode().Perm())
+
+	go func() {
+		c, err := l.Accept()
+		if err == nil {
+			WriteMsg(c, []byte("hello"))
+			c.Close()
+		}
+	}()
+
+	c, err := SocketConnect(path)
+	require.NoError(t, err)
+	defer c.Close()
+	msg, err := ReadMsg(c)
+	require.NoError(t, err)
+	require.Equal(t, "hello", string(msg))
+
+	// A second daemon can't take over the socket
+	_, err = SocketListen(path, 0)
+	require.Error(t, err)
+}
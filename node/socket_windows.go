@@ -0,0 +1,52 @@
+// +build windows
+
+package node
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/Microsoft/go-winio"
+)
+
+// pipePrefix is the namespace of the named pipes on the local machine
+const pipePrefix = `\\.\pipe\`
+
+// pipeDialTimeout bounds how long we wait for a busy pipe
+const pipeDialTimeout = 5 * time.Second
+
+// pipeName maps a socket path to a named pipe so the same config works across platforms, for instance
+// ~/.pop/popd.sock becomes \\.\pipe\popd
+func pipeName(path string) string {
+	if strings.HasPrefix(path, pipePrefix) {
+		return path
+	}
+	return pipePrefix + strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// pipeSecurity converts a file mode into a security descriptor. The owner and the system always have
+// access, other users only if the mode gives read or write access to the group or others.
+func pipeSecurity(mode os.FileMode) string {
+	sd := "D:P(A;;GA;;;OW)(A;;GA;;;SY)"
+	if mode&0066 != 0 {
+		sd += "(A;;GRGW;;;AU)"
+	}
+	return sd
+}
+
+func pathListen(path string, perm os.FileMode) (net.Listener, error) {
+	return winio.ListenPipe(pipeName(path), &winio.PipeConfig{
+		SecurityDescriptor: pipeSecurity(perm),
+		MessageMode:        false,
+		InputBufferSize:    256 * 1024,
+		OutputBufferSize:   256 * 1024,
+	})
+}
+
+func pathConnect(path string) (net.Conn, error) {
+	timeout := pipeDialTimeout
+	return winio.DialPipe(pipeName(path), &timeout)
+}
@@ -0,0 +1,267 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/storage"
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog/log"
+)
+
+// SpendingKind is what we paid for to distribute a content
+type SpendingKind string
+
+const (
+	// SpendingStorage is the price of the storage deals for the whole deal duration
+	SpendingStorage SpendingKind = "storage"
+	// SpendingRetrieval is the funds we sent to providers for retrievals
+	SpendingRetrieval SpendingKind = "retrieval"
+	// SpendingGas is the fee of the messages creating and funding payment channels for retrievals
+	SpendingGas SpendingKind = "gas"
+)
+
+// spendingEntry is an amount we spent for a content
+type spendingEntry struct {
+	Kind   SpendingKind
+	Amount abi.TokenAmount
+	Time   time.Time
+}
+
+// spendingLedger persists the retrieval payments and gas we spent per content root. Storage deals
+// are already recorded by the deal tracker.
+type spendingLedger struct {
+	ds datastore.Batching
+}
+
+func newSpendingLedger(ds datastore.Batching) *spendingLedger {
+	return &spendingLedger{ds: namespace.Wrap(ds, datastore.NewKey("/spending"))}
+}
+
+// record adds an entry for the root unless one was already recorded with the same id
+func (l *spendingLedger) record(root cid.Cid, id string, e spendingEntry) error {
+	key := datastore.NewKey(root.String()).ChildString(id)
+	if has, err := l.ds.Has(key); err != nil || has {
+		return err
+	}
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return l.ds.Put(key, b)
+}
+
+// list returns all the entries recorded for the root
+func (l *spendingLedger) list(root cid.Cid) ([]spendingEntry, error) {
+	res, err := l.ds.Query(query.Query{Prefix: "/" + root.String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]spendingEntry, 0, len(entries))
+	for _, e := range entries {
+		var se spendingEntry
+		if err := json.Unmarshal(e.Value, &se); err != nil {
+			return nil, err
+		}
+		out = append(out, se)
+	}
+	return out, nil
+}
+
+// recordRetrievalSpending records the funds spent by retrievals once they are over and the gas of the
+// payment channel message they waited for
+func (nd *node) recordRetrievalSpending(ctx context.Context) func(client.Event, deal.ClientState) {
+	return func(event client.Event, state deal.ClientState) {
+		switch state.Status {
+		case deal.StatusCompleted, deal.StatusCancelled, deal.StatusErrored:
+		default:
+			return
+		}
+		root := state.PayloadCID
+		if !state.FundsSpent.Nil() && state.FundsSpent.GreaterThan(big.Zero()) {
+			err := nd.spending.record(root, fmt.Sprintf("retrieval-%d", state.ID), spendingEntry{
+				Kind:   SpendingRetrieval,
+				Amount: state.FundsSpent,
+				Time:   time.Now(),
+			})
+			if err != nil {
+				log.Error().Err(err).Msg("failed to record retrieval spending")
+			}
+		}
+		if state.WaitMsgCID != nil && nd.exch.IsFilecoinOnline() {
+			go nd.recordGas(ctx, root, *state.WaitMsgCID)
+		}
+	}
+}
+
+// recordGas records the fee of a message as its gas used at the fee cap, an upper bound of what we paid
+func (nd *node) recordGas(ctx context.Context, root cid.Cid, mcid cid.Cid) {
+	fapi := nd.exch.FilecoinAPI()
+	lkp, err := fapi.StateWaitMsg(ctx, mcid, 0)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to look up payment channel message")
+		return
+	}
+	msg, err := fapi.ChainGetMessage(ctx, mcid)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get payment channel message")
+		return
+	}
+	err = nd.spending.record(root, "gas-"+mcid.String(), spendingEntry{
+		Kind:   SpendingGas,
+		Amount: big.Mul(big.NewInt(lkp.Receipt.GasUsed), msg.GasFeeCap),
+		Time:   time.Now(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to record gas spending")
+	}
+}
+
+// storageSpending returns the price of the storage deals of the root that did not fail
+func storageSpending(recs []storage.DealRecord, root cid.Cid) []spendingEntry {
+	var out []spendingEntry
+	for _, rec := range recs {
+		if rec.Root != root || rec.Phase() == storage.DealPhaseFailed || rec.Price.Nil() {
+			continue
+		}
+		out = append(out, spendingEntry{
+			Kind:   SpendingStorage,
+			Amount: big.Mul(rec.Price, big.NewInt(int64(rec.EndEpoch-rec.StartEpoch))),
+			Time:   rec.Created,
+		})
+	}
+	return out
+}
+
+// spendingBucket sums the spending of a period by kind
+type spendingBucket struct {
+	Start  time.Time
+	Totals map[SpendingKind]abi.TokenAmount
+}
+
+func (b spendingBucket) add(e spendingEntry) {
+	if t, ok := b.Totals[e.Kind]; ok {
+		b.Totals[e.Kind] = big.Add(t, e.Amount)
+		return
+	}
+	b.Totals[e.Kind] = e.Amount
+}
+
+// bucketStart returns the start of the day, week or month of the time
+func bucketStart(t time.Time, period string) (time.Time, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch period {
+	case "", "day":
+		return day, nil
+	case "week":
+		// Weeks start on monday
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7)), nil
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()), nil
+	}
+	return time.Time{}, fmt.Errorf("unknown period %q, expected day, week or month", period)
+}
+
+// aggregateSpending sums the entries per period, oldest period first, and over all the periods
+func aggregateSpending(entries []spendingEntry, period string) (spendingBucket, []spendingBucket, error) {
+	total := spendingBucket{Totals: make(map[SpendingKind]abi.TokenAmount)}
+	byStart := make(map[int64]spendingBucket)
+	for _, e := range entries {
+		// Periods are in local time
+		start, err := bucketStart(e.Time.Local(), period)
+		if err != nil {
+			return total, nil, err
+		}
+		b, ok := byStart[start.Unix()]
+		if !ok {
+			b = spendingBucket{Start: start, Totals: make(map[SpendingKind]abi.TokenAmount)}
+			byStart[start.Unix()] = b
+		}
+		b.add(e)
+		total.add(e)
+	}
+	buckets := make([]spendingBucket, 0, len(byStart))
+	for _, b := range byStart {
+		buckets = append(buckets, b)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Start.Before(buckets[j].Start)
+	})
+	return total, buckets, nil
+}
+
+// costEntry formats the totals of a bucket in FIL
+func costEntry(b spendingBucket) CostEntry {
+	sum := big.Zero()
+	str := func(k SpendingKind) string {
+		amt, ok := b.Totals[k]
+		if !ok {
+			amt = big.Zero()
+		}
+		sum = big.Add(sum, amt)
+		return filecoin.FIL(amt).Short()
+	}
+	e := CostEntry{
+		Start:     b.Start,
+		Storage:   str(SpendingStorage),
+		Retrieval: str(SpendingRetrieval),
+		Gas:       str(SpendingGas),
+	}
+	e.Total = filecoin.FIL(sum).Short()
+	return e
+}
+
+// Cost sends what we spent to store and retrieve a content, in total and per period
+func (nd *node) Cost(ctx context.Context, args *CostArgs) {
+	sendErr := func(err error) {
+		nd.send(ctx, Notify{
+			CostResult: &CostResult{
+				Err: err.Error(),
+			}})
+	}
+	root, err := cid.Parse(args.Root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	entries, err := nd.spending.list(root)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	recs, err := nd.rs.ListDeals()
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	entries = append(entries, storageSpending(recs, root)...)
+
+	total, buckets, err := aggregateSpending(entries, args.Period)
+	if err != nil {
+		sendErr(err)
+		return
+	}
+	res := &CostResult{
+		Root:  root.String(),
+		Total: costEntry(total),
+	}
+	for _, b := range buckets {
+		res.Periods = append(res.Periods, costEntry(b))
+	}
+	nd.send(ctx, Notify{CostResult: res})
+}
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-fil-markets/storagemarket"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/storage"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpendingLedger(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	l := newSpendingLedger(ds)
+
+	root := blocks.NewBlock([]byte("root")).Cid()
+	other := blocks.NewBlock([]byte("other")).Cid()
+	now := time.Now()
+
+	require.NoError(t, l.record(root, "retrieval-1", spendingEntry{Kind: SpendingRetrieval, Amount: abi.NewTokenAmount(10), Time: now}))
+	// Recording the same retrieval twice only counts it once
+	require.NoError(t, l.record(root, "retrieval-1", spendingEntry{Kind: SpendingRetrieval, Amount: abi.NewTokenAmount(10), Time: now}))
+	require.NoError(t, l.record(root, "gas-1", spendingEntry{Kind: SpendingGas, Amount: abi.NewTokenAmount(2), Time: now}))
+	require.NoError(t, l.record(other, "retrieval-2", spendingEntry{Kind: SpendingRetrieval, Amount: abi.NewTokenAmount(5), Time: now}))
+
+	entries, err := l.list(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	entries, err = l.list(other)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+func TestAggregateSpending(t *testing.T) {
+	root := blocks.NewBlock([]byte("root")).Cid()
+	day1 := time.Date(2021, time.March, 1, 10, 0, 0, 0, time.Local)
+	day2 := time.Date(2021, time.March, 3, 22, 0, 0, 0, time.Local)
+
+	recs := []storage.DealRecord{
+		{Root: root, Price: abi.NewTokenAmount(2), StartEpoch: 100, EndEpoch: 200, Created: day1},
+		// Failed deals cost us nothing
+		{Root: root, Price: abi.NewTokenAmount(2), StartEpoch: 100, EndEpoch: 200, Created: day1, State: storagemarket.StorageDealProposalRejected},
+	}
+	entries := storageSpending(recs, root)
+	require.Len(t, entries, 1)
+	entries = append(entries,
+		spendingEntry{Kind: SpendingRetrieval, Amount: abi.NewTokenAmount(10), Time: day2},
+		spendingEntry{Kind: SpendingRetrieval, Amount: abi.NewTokenAmount(5), Time: day2.Add(-time.Hour)},
+		spendingEntry{Kind: SpendingGas, Amount: abi.NewTokenAmount(1), Time: day1},
+	)
+
+	total, buckets, err := aggregateSpending(entries, "day")
+	require.NoError(t, err)
+	require.Len(t, buckets, 2)
+	require.Equal(t, 1, buckets[0].Start.Day())
+	require.True(t, buckets[0].Totals[SpendingStorage].Equals(abi.NewTokenAmount(200)))
+	require.True(t, buckets[1].Totals[SpendingRetrieval].Equals(abi.NewTokenAmount(15)))
+	require.True(t, total.Totals[SpendingGas].Equals(abi.NewTokenAmount(1)))
+
+	// Both days are in the same week
+	_, buckets, err = aggregateSpending(entries, "week")
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+
+	require.Equal(t, filecoin.FIL(big.NewInt(216)).Short(), costEntry(total).Total)
+
+	_, _, err = aggregateSpending(entries, "year")
+	require.Error(t, err)
+}
+
+func TestBucketStart(t *testing.T) {
+	// Sunday
+	d := time.Date(2021, time.March, 7, 15, 30, 0, 0, time.UTC)
+
+	s, err := bucketStart(d, "week")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), s)
+
+	s, err = bucketStart(d, "month")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, time.March, 1, 0, 0, 0, 0, time.UTC), s)
+
+	s, err = bucketStart(d, "")
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC), s)
+}
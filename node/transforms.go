@@ -0,0 +1,112 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ErrTransformNotFound is returned when packing with a transform that isn't registered
+var ErrTransformNotFound = errors.New("transform not found")
+
+// Transform derives a web optimized variant of a staged file when packing e.g. minified, resized or
+// precompressed. Variants are recorded in the manifest entry of the file so caches can serve them
+// directly.
+type Transform interface {
+	// Name is the key of the variant in the manifest entry
+	Name() string
+	// Transform returns the content of the variant or false if it doesn't apply to the file
+	Transform(name string, data []byte) ([]byte, bool, error)
+}
+
+// TransformFunc derives the content of a variant from a file
+type TransformFunc func(name string, data []byte) ([]byte, bool, error)
+
+type namedTransform struct {
+	name string
+	fn   TransformFunc
+}
+
+func (t namedTransform) Name() string {
+	return t.name
+}
+
+func (t namedTransform) Transform(name string, data []byte) ([]byte, bool, error) {
+	return t.fn(name, data)
+}
+
+// NewTransform wraps a function into a Transform recording its variants under the given name
+func NewTransform(name string, fn TransformFunc) Transform {
+	return namedTransform{name: name, fn: fn}
+}
+
+// compressibleExts are the extensions of the text assets worth precompressing
+var compressibleExts = map[string]bool{
+	".html": true,
+	".htm":  true,
+	".css":  true,
+	".js":   true,
+	".mjs":  true,
+	".json": true,
+	".svg":  true,
+	".xml":  true,
+	".txt":  true,
+	".md":   true,
+	".wasm": true,
+}
+
+// GzipTransform precompresses text assets so they can be served with a gzip Content-Encoding
+type GzipTransform struct {
+	// Level is the gzip compression level, gzip.BestCompression when zero
+	Level int
+}
+
+// Name of the gzip variant
+func (GzipTransform) Name() string {
+	return "gzip"
+}
+
+// Transform compresses the file if it's a text asset and compression makes it smaller
+func (t GzipTransform) Transform(name string, data []byte) ([]byte, bool, error) {
+	if !compressibleExts[strings.ToLower(filepath.Ext(name))] {
+		return nil, false, nil
+	}
+	level := t.Level
+	if level == 0 {
+		level = gzip.BestCompression
+	}
+	buf := new(bytes.Buffer)
+	gw, err := gzip.NewWriterLevel(buf, level)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err := gw.Write(data); err != nil {
+		return nil, false, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, false, err
+	}
+	if buf.Len() >= len(data) {
+		return nil, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// DefaultTransforms are the transforms available to every node
+var DefaultTransforms = []Transform{GzipTransform{}}
+
+// resolveTransforms returns the registered transforms with the given names
+func resolveTransforms(registered map[string]Transform, names []string) ([]Transform, error) {
+	var ts []Transform
+	for _, name := range names {
+		t, ok := registered[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrTransformNotFound, name)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
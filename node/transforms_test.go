@@ -0,0 +1,85 @@
+package node
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/myelnet/pop"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWorkdagTransforms(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	page := strings.Repeat("<p>Two roads diverged in a yellow wood</p>\n", 50)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "index.html"), []byte(page), 0666))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "logo.png"), []byte("not text"), 0666))
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+	for _, name := range []string{"index.html", "logo.png"} {
+		_, err := wd.Add(ctx, AddOptions{Path: filepath.Join(dir, name), ChunkSize: 1 << 14})
+		require.NoError(t, err)
+	}
+
+	upper := NewTransform("upper", func(name string, data []byte) ([]byte, bool, error) {
+		if filepath.Ext(name) != ".html" {
+			return nil, false, nil
+		}
+		return bytes.ToUpper(data), true, nil
+	})
+	com, err := wd.Commit(ctx, CommitOptions{Transforms: []Transform{GzipTransform{}, upper}})
+	require.NoError(t, err)
+
+	m, err := wd.Manifest(ctx, com.PayloadCID, com.StoreID)
+	require.NoError(t, err)
+
+	// Only the html page has variants
+	gz, err := m.Variant("index.html", "gzip")
+	require.NoError(t, err)
+	_, err = m.Variant("index.html", "upper")
+	require.NoError(t, err)
+	_, err = m.Variant("logo.png", "gzip")
+	require.Equal(t, ErrVariantNotFound, err)
+
+	f, err := wd.LoadFile(ctx, gz, com.StoreID)
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(f.(files.File))
+	require.NoError(t, err)
+	content, err := ioutil.ReadAll(gr)
+	require.NoError(t, err)
+	require.Equal(t, page, string(content))
+
+	// A variant is retrieved without the original file
+	store, err := ms.Get(com.StoreID)
+	require.NoError(t, err)
+	s, err := parseSelection("all", []string{"index.html"})
+	require.NoError(t, err)
+	s.variant = "gzip"
+	sel, err := s.selector(m)
+	require.NoError(t, err)
+	stat, err := pop.DAGStat(ctx, store.Bstore, com.PayloadCID, sel)
+	require.NoError(t, err)
+	require.Equal(t, 2, stat.NumBlocks)
+
+	s.variant = "brotli"
+	_, err = s.selector(m)
+	require.Equal(t, ErrVariantNotFound, err)
+
+	_, err = resolveTransforms(map[string]Transform{"gzip": GzipTransform{}}, []string{"brotli"})
+	require.True(t, errors.Is(err, ErrTransformNotFound))
+}
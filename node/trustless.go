@@ -0,0 +1,133 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/myelnet/pop"
+	"github.com/rs/zerolog/log"
+)
+
+// Media types of the verifiable responses of the trustless gateway
+const (
+	carMediaType = "application/vnd.ipld.car"
+	rawMediaType = "application/vnd.ipld.raw"
+)
+
+// trustlessFormat returns the media type of the verifiable response a request asks for either with
+// the format query parameter or the Accept header, or an empty string for a deserialized response
+func trustlessFormat(r *http.Request) string {
+	switch r.URL.Query().Get("format") {
+	case "car":
+		return carMediaType
+	case "raw":
+		return rawMediaType
+	}
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, carMediaType):
+		return carMediaType
+	case strings.Contains(accept, rawMediaType):
+		return rawMediaType
+	}
+	return ""
+}
+
+// serveTrustless serves the blocks of a content for clients to verify them against the root themselves
+// following the trustless gateway spec. Raw responses are the root block. CAR responses are the blocks
+// from the root to the entry the path points to then the entry DAG or only its root block with
+// dag-scope=block.
+func (nd *node) serveTrustless(w http.ResponseWriter, r *http.Request, root cid.Cid, name string, sid multistore.StoreID, format string) {
+	store, err := nd.ms.Get(sid)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h := w.Header()
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Add("Vary", "Accept")
+
+	if format == rawMediaType {
+		if name != "" {
+			http.Error(w, "raw blocks can only be requested by their CID", http.StatusBadRequest)
+			return
+		}
+		blk, err := store.Bstore.Get(root)
+		if err != nil {
+			http.Error(w, "block not found", http.StatusNotFound)
+			return
+		}
+		h.Set("Content-Type", rawMediaType)
+		h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.bin"`, root))
+		h.Set("Etag", fmt.Sprintf(`"%s.raw"`, root))
+		if r.Method == http.MethodHead {
+			return
+		}
+		w.Write(blk.RawData())
+		return
+	}
+
+	scope := r.URL.Query().Get("dag-scope")
+	sel, err := nd.trustlessSelector(r.Context(), root, name, sid, scope)
+	switch {
+	case errors.Is(err, ErrEntryNotFound):
+		http.Error(w, "file not found", http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scope == "" {
+		scope = "all"
+	}
+	h.Set("Content-Type", carMediaType+"; version=1")
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.car"`, root))
+	h.Set("Etag", fmt.Sprintf(`"%s/%s.%s.car"`, root, name, scope))
+	if r.Method == http.MethodHead {
+		return
+	}
+	sc := car.NewSelectiveCar(r.Context(), store.Bstore, []car.Dag{{Root: root, Selector: sel}})
+	if err := sc.Write(w); err != nil {
+		// The status was sent already so the client can only tell from the truncated CAR
+		log.Error().Err(err).Str("root", root.String()).Str("path", name).Msg("failed to write CAR")
+	}
+}
+
+// trustlessSelector returns the selector of the blocks of a CAR response for the given path and scope
+func (nd *node) trustlessSelector(ctx context.Context, root cid.Cid, name string, sid multistore.StoreID, scope string) (ipld.Node, error) {
+	switch scope {
+	case "", "all", "entity":
+	case "block":
+	default:
+		return nil, fmt.Errorf("unsupported dag-scope %q", scope)
+	}
+	if name == "" {
+		if scope == "block" {
+			return rootSelector(), nil
+		}
+		return pop.AllSelector(), nil
+	}
+	wd, err := NewWorkdag(nd.ms, nd.ds)
+	if err != nil {
+		return nil, err
+	}
+	m, err := wd.Manifest(ctx, root, sid)
+	if err != nil {
+		return nil, err
+	}
+	i, err := m.entryIndex(name)
+	if err != nil {
+		return nil, err
+	}
+	if scope == "block" {
+		return entryBlockSelector(i), nil
+	}
+	return entriesSelector(i, i+1), nil
+}
@@ -0,0 +1,90 @@
+package node
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/build"
+	"github.com/rs/zerolog/log"
+)
+
+// DefaultMaxVersionLag is the number of minor versions we can lag behind our peers before warning
+const DefaultMaxVersionLag = 2
+
+// ReleaseCheckInterval is how often we check the release endpoint for a new version
+const ReleaseCheckInterval = 24 * time.Hour
+
+// VersionLag is the number of minor versions we lag behind the newest version known to our peers
+var VersionLag = expvar.NewInt("pop_version_lag")
+
+// peerVersion returns the pop version advertised by a peer via identify
+func (nd *node) peerVersion(p peer.ID) (build.Semver, bool) {
+	agent, err := nd.host.Peerstore().Get(p, "AgentVersion")
+	if err != nil {
+		return build.Semver{}, false
+	}
+	s, ok := agent.(string)
+	if !ok {
+		return build.Semver{}, false
+	}
+	v, ok := build.AgentVersion(s)
+	if !ok {
+		return build.Semver{}, false
+	}
+	sv, err := build.ParseVersion(v)
+	return sv, err == nil
+}
+
+// versionWarning compares our version with the connected peers and the latest release if we checked it.
+// It returns a warning when we lag behind by more than the max number of minor versions.
+func (nd *node) versionWarning() string {
+	cur, err := build.ParseVersion(build.Version)
+	if err != nil {
+		return ""
+	}
+	newest := cur
+	for _, p := range nd.connPeers() {
+		if v, ok := nd.peerVersion(p); ok && newest.Less(v) {
+			newest = v
+		}
+	}
+	nd.vmu.Lock()
+	if newest.Less(nd.latestRelease) {
+		newest = nd.latestRelease
+	}
+	nd.vmu.Unlock()
+
+	lag := cur.MinorsBehind(newest)
+	VersionLag.Set(int64(lag))
+	if lag > nd.maxVersionLag {
+		return fmt.Sprintf("pop %s is behind %s used by the network, please update", cur, newest)
+	}
+	return ""
+}
+
+// checkReleases periodically fetches the latest release from the endpoint
+func (nd *node) checkReleases(ctx context.Context, endpoint string) {
+	ticker := time.NewTicker(ReleaseCheckInterval)
+	defer ticker.Stop()
+	for {
+		v, err := build.LatestRelease(ctx, endpoint)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to check the latest release")
+		} else {
+			nd.vmu.Lock()
+			nd.latestRelease = v
+			nd.vmu.Unlock()
+			if warn := nd.versionWarning(); warn != "" {
+				log.Warn().Msg(warn)
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
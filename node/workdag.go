@@ -7,9 +7,13 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"sync"
 	"text/tabwriter"
 
 	"github.com/filecoin-project/go-commp-utils/writer"
@@ -18,6 +22,7 @@ import (
 	cid "github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
 	chunk "github.com/ipfs/go-ipfs-chunker"
 	files "github.com/ipfs/go-ipfs-files"
 	ipldformat "github.com/ipfs/go-ipld-format"
@@ -25,16 +30,26 @@ import (
 	unixfile "github.com/ipfs/go-unixfs/file"
 	"github.com/ipfs/go-unixfs/importer/balanced"
 	"github.com/ipfs/go-unixfs/importer/helpers"
+	"github.com/ipfs/go-unixfs/importer/trickle"
 	"github.com/ipld/go-car"
 	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/supply"
 )
 
 var (
 	// ErrEntryNotFound is returned by Index.Entry, if an entry is not found.
 	ErrEntryNotFound = errors.New("entry not found")
+	// ErrVersionNotFound is returned when a publication has no such version
+	ErrVersionNotFound = errors.New("version not found")
+	// ErrVariantNotFound is returned when a manifest entry has no such variant
+	ErrVariantNotFound = errors.New("variant not found")
+	// ErrWorkdagPacked is returned when the workdag is packed while a file is being added to it
+	ErrWorkdagPacked = errors.New("workdag was packed while adding, add the file again")
 )
 
 // KStoreID is datastore key for persisting the last ID of a store for the current workdag
@@ -43,19 +58,93 @@ const KStoreID = "storeid"
 // KIndex is the datastore key for persisting the index of a workdag
 const KIndex = "index"
 
+// KWorkdags is the datastore key under which the indexes of the named workdags are persisted
+const KWorkdags = "workdags"
+
+// KActiveWorkdag is the datastore key for persisting the name of the checked out workdag
+const KActiveWorkdag = "active"
+
+// DefaultWorkdag is the name of the workdag staging content until another one is checked out.
+// Its index also holds the commits of every workdag so versions of a publication can be packed
+// from any of them.
+const DefaultWorkdag = "default"
+
+// ErrInvalidWorkdagName is returned when a workdag name cannot be used as a datastore key
+var ErrInvalidWorkdagName = errors.New("workdag names may only contain letters, digits, '.', '_' and '-'")
+
+var workdagNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// repoLock serializes the updates of the workdag indexes of a repo
+type repoLock struct {
+	// index prevents commits packed from different workdags at the same time from overwriting each other
+	index sync.Mutex
+	// stage prevents files added at the same time from overwriting each other's entries and from being
+	// staged while the workdag is packed
+	stage sync.Mutex
+}
+
+var (
+	repoLocksMu sync.Mutex
+	repoLocks   = make(map[*multistore.MultiStore]*repoLock)
+)
+
+// lockFor returns the locks of the repo a multistore belongs to. Workdags are opened for each
+// operation so all the workdags of a repo share them while other repos don't wait on each other.
+func lockFor(ms *multistore.MultiStore) *repoLock {
+	repoLocksMu.Lock()
+	defer repoLocksMu.Unlock()
+	lk, ok := repoLocks[ms]
+	if !ok {
+		lk = &repoLock{}
+		repoLocks[ms] = lk
+	}
+	return lk
+}
+
 // Workdag represents any local content that hasn't been committed into a car file yet.
 type Workdag struct {
+	name    string
 	storeID multistore.StoreID
 	store   *multistore.Store
 	ms      *multistore.MultiStore
 	ds      datastore.Batching
+	lk      *repoLock
 }
 
-// NewWorkdag instanciates a workdag, checks if we have a store ID and loads the right store
+// NewWorkdag instanciates the checked out workdag, checks if we have a store ID and loads the right store
 func NewWorkdag(ms *multistore.MultiStore, ds datastore.Batching) (*Workdag, error) {
+	name, err := ActiveWorkdag(ds)
+	if err != nil {
+		return nil, err
+	}
+	return NewNamedWorkdag(ms, ds, name)
+}
+
+// NewNamedWorkdag instanciates the workdag with the given name, creating it if needed.
+// An empty name is the default workdag.
+func NewNamedWorkdag(ms *multistore.MultiStore, ds datastore.Batching, name string) (*Workdag, error) {
+	if name == "" {
+		name = DefaultWorkdag
+	}
+	if !workdagNameRe.MatchString(name) {
+		return nil, ErrInvalidWorkdagName
+	}
+	ds = namespace.Wrap(ds, datastore.NewKey("/workdag"))
+	if name != DefaultWorkdag {
+		// The default workdag must exist to record the commits
+		if _, err := openWorkdag(ms, ds, DefaultWorkdag); err != nil {
+			return nil, err
+		}
+	}
+	return openWorkdag(ms, ds, name)
+}
+
+func openWorkdag(ms *multistore.MultiStore, ds datastore.Batching, name string) (*Workdag, error) {
 	w := &Workdag{
-		ds: namespace.Wrap(ds, datastore.NewKey("/workdag")),
-		ms: ms,
+		name: name,
+		ds:   ds,
+		ms:   ms,
+		lk:   lockFor(ms),
 	}
 	idx, err := w.Index()
 	if err != nil && errors.Is(err, datastore.ErrNotFound) {
@@ -74,6 +163,58 @@ func NewWorkdag(ms *multistore.MultiStore, ds datastore.Batching) (*Workdag, err
 	return w, w.SetIndex(idx)
 }
 
+// ActiveWorkdag returns the name of the checked out workdag
+func ActiveWorkdag(ds datastore.Batching) (string, error) {
+	name, err := ds.Get(datastore.NewKey("/workdag").ChildString(KActiveWorkdag))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return DefaultWorkdag, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(name), nil
+}
+
+// CheckoutWorkdag sets the workdag content is staged in when none is specified, creating it if needed
+func CheckoutWorkdag(ms *multistore.MultiStore, ds datastore.Batching, name string) error {
+	w, err := NewNamedWorkdag(ms, ds, name)
+	if err != nil {
+		return err
+	}
+	return ds.Put(datastore.NewKey("/workdag").ChildString(KActiveWorkdag), []byte(w.name))
+}
+
+// ListWorkdags returns the names of all the workdags sorted alphabetically
+func ListWorkdags(ds datastore.Batching) ([]string, error) {
+	ds = namespace.Wrap(ds, datastore.NewKey("/workdag"))
+	res, err := ds.Query(query.Query{
+		Prefix:   "/" + KWorkdags,
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	names := []string{DefaultWorkdag}
+	for _, e := range entries {
+		// Keys are /workdags/<name>/index
+		ns := datastore.NewKey(e.Key).Namespaces()
+		if len(ns) == 3 && ns[2] == KIndex {
+			names = append(names, ns[1])
+		}
+	}
+	sort.Strings(names[1:])
+	return names, nil
+}
+
+// Name returns the name of the workdag
+func (w *Workdag) Name() string {
+	return w.name
+}
+
 // Store exposes the underlying store
 func (w *Workdag) Store() *multistore.Store {
 	return w.store
@@ -84,31 +225,119 @@ func (w *Workdag) StoreID() multistore.StoreID {
 	return w.storeID
 }
 
-// SetIndex updates the Workdag index after an operation
+// indexKey is where the entries of the workdag are persisted
+func (w *Workdag) indexKey() datastore.Key {
+	if w.name == DefaultWorkdag {
+		return datastore.NewKey(KIndex)
+	}
+	return datastore.NewKey(KWorkdags).ChildString(w.name).ChildString(KIndex)
+}
+
+// SetIndex updates the Workdag index after an operation. Commits added, updated or removed since the
+// index was loaded are applied on top of the ones other workdags recorded in the meantime.
 func (w *Workdag) SetIndex(idx *Index) error {
+	w.lk.index.Lock()
+	defer w.lk.index.Unlock()
+
+	main, err := w.loadIndex(datastore.NewKey(KIndex))
+	if err != nil && !errors.Is(err, datastore.ErrNotFound) {
+		return err
+	}
+	if main != nil {
+		// Another workdag may have committed since our index was loaded
+		idx.Commits = mergeCommits(main.Commits, idx.base, idx.Commits)
+	}
+	idx.setBase()
+	if w.name == DefaultWorkdag {
+		return w.putIndex(datastore.NewKey(KIndex), idx)
+	}
+
+	main.Commits = idx.Commits
+	if err := w.putIndex(datastore.NewKey(KIndex), main); err != nil {
+		return err
+	}
+	own := *idx
+	own.Commits = nil
+	return w.putIndex(w.indexKey(), &own)
+}
+
+func (w *Workdag) putIndex(key datastore.Key, idx *Index) error {
 	enc, err := json.Marshal(idx)
 	if err != nil {
 		return err
 	}
 
-	return w.ds.Put(datastore.NewKey(KIndex), enc)
+	return w.ds.Put(key, enc)
+}
+
+// mergeCommits applies the changes between the base commits our index was loaded with and our commits
+// to the recorded ones. Commits we updated replace the recorded ones, commits we removed are dropped
+// and commits recorded or removed by other workdags since the base are left as they are.
+func mergeCommits(recorded []*DataRef, base map[cid.Cid]DataRef, commits []*DataRef) []*DataRef {
+	ours := make(map[cid.Cid]*DataRef, len(commits))
+	for _, c := range commits {
+		ours[c.PayloadCID] = c
+	}
+	changed := func(c *DataRef) bool {
+		b, ok := base[c.PayloadCID]
+		return !ok || b != *c
+	}
+	merged := make([]*DataRef, 0, len(recorded)+len(commits))
+	have := make(map[cid.Cid]bool, len(recorded))
+	for _, c := range recorded {
+		o, ok := ours[c.PayloadCID]
+		_, known := base[c.PayloadCID]
+		switch {
+		case !ok && known:
+			// We removed it
+			continue
+		case ok && changed(o):
+			merged = append(merged, o)
+		default:
+			merged = append(merged, c)
+		}
+		have[c.PayloadCID] = true
+	}
+	for _, c := range commits {
+		// Commits missing from the record are new unless another workdag removed them
+		if !have[c.PayloadCID] && changed(c) {
+			merged = append(merged, c)
+		}
+	}
+	return merged
 }
 
 // Index decodes and returns the workdag index from the datastore
 func (w *Workdag) Index() (*Index, error) {
-	var idx Index
-	enc, err := w.ds.Get(datastore.NewKey(KIndex))
+	idx, err := w.loadIndex(w.indexKey())
 	if err != nil {
 		return nil, err
 	}
-	if err := json.Unmarshal(enc, &idx); err != nil {
-		return nil, err
+	if w.name != DefaultWorkdag {
+		main, err := w.loadIndex(datastore.NewKey(KIndex))
+		if err != nil {
+			return nil, err
+		}
+		idx.Commits = main.Commits
 	}
 	// Sort entries to make sure our commit CID will be deterministic
 	sort.Slice(idx.Entries, func(i, j int) bool {
 		return idx.Entries[i].Cid.String() > idx.Entries[j].Cid.String()
 	})
+	idx.setBase()
+
+	return idx, nil
+}
 
+func (w *Workdag) loadIndex(key datastore.Key) (*Index, error) {
+	var idx Index
+	enc, err := w.ds.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(enc, &idx); err != nil {
+		return nil, err
+	}
 	return &idx, nil
 }
 
@@ -118,6 +347,89 @@ type AddOptions struct {
 	Path string
 	// ChunkSize is size by which to chunk the content when adding a file.
 	ChunkSize int64
+	// Chunker replaces the fixed size chunks with another chunker e.g. rabin or buzhash
+	Chunker string
+	// Layout is how the chunks of UnixFS files are linked, LayoutBalanced when empty or LayoutTrickle
+	Layout string
+	// Codec is the multicodec of the root. Defaults to a UnixFS DAG when zero, cid.DagCBOR expects
+	// a dag-json file to encode as a dag-cbor object and cid.Raw stores the content as a single block.
+	Codec uint64
+	// HashFunc is the multihash function used to hash the blocks. Defaults to DefaultHashFunction when zero.
+	HashFunc uint64
+	// CidV0 builds legacy CIDv0 links. It is only compatible with sha2-256 UnixFS DAGs without raw leaves.
+	CidV0 bool
+	// Limits rejects DAGs with blocks too large, nodes with too many links or too deep. No limits when zero.
+	Limits supply.DAGLimits
+	// Resumable persists the progress of chunking UnixFS files so adding the same file again after
+	// an interruption continues where it stopped
+	Resumable bool
+	// Progress is called with the bytes of the file chunked so far as the progress is persisted
+	Progress func(done, total int64)
+
+	checkpointBytes int64 // bytes chunked between saves of the progress, addCheckpointBytes when zero
+}
+
+// Layouts of the UnixFS DAGs linking the chunks of a file
+const (
+	// LayoutBalanced fills each node with as many chunks as it can link before adding a level. It is the default.
+	LayoutBalanced = "balanced"
+	// LayoutTrickle links the chunks in a tree growing from the start of the file which suits streaming
+	// and appending to the file
+	LayoutTrickle = "trickle"
+)
+
+// splitter returns the chunker cutting a file. Chunkers are given as in go-ipfs: size-<bytes>,
+// rabin[-<min>-<avg>-<max>] or buzhash. Content defined chunkers cut files where the content is the same
+// so versions of a file share most of their blocks. Chunks of ChunkSize bytes are cut by default.
+func (opts AddOptions) splitter(r io.Reader) (chunk.Splitter, error) {
+	if opts.Chunker == "" {
+		return chunk.NewSizeSplitter(r, opts.ChunkSize), nil
+	}
+	return chunk.FromString(r, opts.Chunker)
+}
+
+// layout returns the function linking the chunks of a file
+func (opts AddOptions) layout() (func(*helpers.DagBuilderHelper) (ipldformat.Node, error), error) {
+	switch opts.Layout {
+	case "", LayoutBalanced:
+		return balanced.Layout, nil
+	case LayoutTrickle:
+		return trickle.Layout, nil
+	default:
+		return nil, fmt.Errorf("unknown layout %s", opts.Layout)
+	}
+}
+
+// hashFunc returns the hash function to use or the default one
+func hashFunc(h uint64) uint64 {
+	if h == 0 {
+		return DefaultHashFunction
+	}
+	return h
+}
+
+// prefix returns the CID prefix for blocks of the given codec
+func (opts AddOptions) prefix(codec uint64) (cid.Prefix, error) {
+	version := uint64(1)
+	if opts.CidV0 {
+		version = 0
+	}
+	prefix, err := merkledag.PrefixForCidVersion(int(version))
+	if err != nil {
+		return prefix, err
+	}
+	if opts.CidV0 {
+		if opts.HashFunc != 0 && opts.HashFunc != mh.SHA2_256 {
+			return prefix, errors.New("CIDv0 only supports sha2-256")
+		}
+		if codec != cid.DagProtobuf {
+			return prefix, errors.New("CIDv0 only supports UnixFS DAGs")
+		}
+		return prefix, nil
+	}
+	prefix.Codec = codec
+	prefix.MhType = hashFunc(opts.HashFunc)
+	return prefix, nil
 }
 
 // Add adds the file contents of a file in the workdag
@@ -131,6 +443,9 @@ func (w *Workdag) Add(ctx context.Context, opts AddOptions) (cid.Cid, error) {
 }
 
 func (w *Workdag) doAdd(ctx context.Context, opts AddOptions) (ipld.Link, error) {
+	if err := opts.Limits.CheckBlock(uint64(opts.ChunkSize), 0); err != nil {
+		return nil, fmt.Errorf("chunk size: %w", err)
+	}
 	st, err := os.Stat(opts.Path)
 	if err != nil {
 		return nil, err
@@ -144,7 +459,14 @@ func (w *Workdag) doAdd(ctx context.Context, opts AddOptions) (ipld.Link, error)
 	case files.Directory:
 		return w.doAddDir(ctx, f, opts)
 	case files.File:
-		return w.doAddFile(ctx, f, opts)
+		switch opts.Codec {
+		case 0, cid.DagProtobuf:
+			return w.doAddFile(ctx, f, opts)
+		case cid.DagCBOR, cid.Raw:
+			return w.doAddBlock(ctx, f, opts)
+		default:
+			return nil, fmt.Errorf("unsupported codec %x", opts.Codec)
+		}
 	default:
 		return nil, fmt.Errorf("unknown file type")
 	}
@@ -153,54 +475,131 @@ func (w *Workdag) doAdd(ctx context.Context, opts AddOptions) (ipld.Link, error)
 func (w *Workdag) doAddFile(ctx context.Context, f files.File, opts AddOptions) (ipld.Link, error) {
 	bufferedDS := ipldformat.NewBufferedDAG(ctx, w.store.DAG)
 
-	prefix, err := merkledag.PrefixForCidVersion(1)
+	prefix, err := opts.prefix(cid.DagProtobuf)
 	if err != nil {
 		return nil, err
 	}
-	prefix.MhType = DefaultHashFunction
 
 	params := helpers.DagBuilderParams{
-		Maxlinks:   unixfsLinksPerLevel,
-		RawLeaves:  true,
+		Maxlinks: unixfsLinksPerLevel,
+		// CIDv0 cannot address raw blocks
+		RawLeaves:  !opts.CidV0,
 		CidBuilder: prefix,
 		Dagserv:    bufferedDS,
 	}
 
-	db, err := params.New(chunk.NewSizeSplitter(f, opts.ChunkSize))
+	layout, err := opts.layout()
 	if err != nil {
 		return nil, err
 	}
 
-	n, err := balanced.Layout(db)
-	if err != nil {
+	var root cid.Cid
+	// Only the balanced layout can be linked once all the chunks are stored
+	if opts.Resumable && opts.Layout != LayoutTrickle {
+		root, err = w.chunkFile(ctx, f, opts, params)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		spl, err := opts.splitter(f)
+		if err != nil {
+			return nil, err
+		}
+		db, err := params.New(spl)
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := layout(db)
+		if err != nil {
+			return nil, err
+		}
+
+		err = bufferedDS.Commit()
+		if err != nil {
+			return nil, err
+		}
+		root = n.Cid()
+	}
+	if err := opts.Limits.CheckDAG(ctx, w.store.DAG, root); err != nil {
 		return nil, err
 	}
-
-	err = bufferedDS.Commit()
+	size, err := f.Size()
 	if err != nil {
 		return nil, err
 	}
+	return cidlink.Link{Cid: root}, w.stage(opts.Path, root, size)
+}
+
+// stage records the root of an added file in the index under the file name
+func (w *Workdag) stage(path string, root cid.Cid, size int64) error {
+	w.lk.stage.Lock()
+	defer w.lk.stage.Unlock()
+
 	idx, err := w.Index()
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if idx.StoreID != w.storeID {
+		return ErrWorkdagPacked
 	}
 	// Only keep the file name
-	_, name := filepath.Split(opts.Path)
+	_, name := filepath.Split(path)
 
 	e, err := idx.Entry(name)
 	if errors.Is(err, ErrEntryNotFound) {
 		e = idx.Add(name)
 	} else if err != nil {
-		return nil, err
+		return err
 	}
-	e.Cid = n.Cid()
-	e.Size, err = f.Size()
+	e.Cid = root
+	e.Size = size
+
+	return w.SetIndex(idx)
+}
+
+// doAddBlock adds the file as a single dag-cbor or raw block. Links in dag-json documents are preserved
+// so the object can reference other DAGs.
+func (w *Workdag) doAddBlock(ctx context.Context, f files.File, opts AddOptions) (ipld.Link, error) {
+	data, err := ioutil.ReadAll(f)
 	if err != nil {
 		return nil, err
 	}
-
-	return cidlink.Link{Cid: n.Cid()}, w.SetIndex(idx)
-
+	var root cid.Cid
+	switch opts.Codec {
+	case cid.DagCBOR:
+		nb := basicnode.Prototype.Any.NewBuilder()
+		if err := dagjson.Decoder(nb, bytes.NewReader(data)); err != nil {
+			return nil, err
+		}
+		prefix, err := opts.prefix(cid.DagCBOR)
+		if err != nil {
+			return nil, err
+		}
+		lb := cidlink.LinkBuilder{Prefix: prefix}
+		lnk, err := lb.Build(ctx, ipld.LinkContext{}, nb.Build(), w.store.Storer)
+		if err != nil {
+			return nil, err
+		}
+		root = lnk.(cidlink.Link).Cid
+	case cid.Raw:
+		prefix, err := opts.prefix(cid.Raw)
+		if err != nil {
+			return nil, err
+		}
+		nd, err := merkledag.NewRawNodeWPrefix(data, prefix)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.store.DAG.Add(ctx, nd); err != nil {
+			return nil, err
+		}
+		root = nd.Cid()
+	}
+	if err := opts.Limits.CheckDAG(ctx, w.store.DAG, root); err != nil {
+		return nil, err
+	}
+	return cidlink.Link{Cid: root}, w.stage(opts.Path, root, int64(len(data)))
 }
 
 func (w *Workdag) doAddDir(ctx context.Context, dir files.Directory, opts AddOptions) (ipld.Link, error) {
@@ -245,6 +644,16 @@ func (w *Workdag) Status() (Status, error) {
 
 // CommitOptions might be useful later to add authorship
 type CommitOptions struct {
+	// Name of the publication the commit is a new version of. Commits without name are versions
+	// of the same unnamed publication.
+	Name string
+	// HashFunc is the multihash function used to hash the root. Defaults to DefaultHashFunction when zero.
+	HashFunc uint64
+	// Register is called with the new commit before it is saved in the index. If we crash in between,
+	// the workdag is left untouched and packing again yields the same commit in the same store.
+	Register func(*DataRef) error
+	// Transforms derive variants of the staged files recorded in their manifest entry
+	Transforms []Transform
 }
 
 // DataRef encapsulates information about a content committed for storage
@@ -255,10 +664,50 @@ type DataRef struct {
 	PieceCID  cid.Cid
 	PieceSize abi.PaddedPieceSize
 	StoreID   multistore.StoreID
+	// Name of the publication this commit is a version of
+	Name string
+	// Version starts at 1 for the first commit of a publication
+	Version int64
+	// Previous is the root of the previous version if any
+	Previous cid.Cid
+}
+
+// Manifest is the root of a commit. It lists the committed entries and links to the previous
+// version of the publication.
+type Manifest struct {
+	Name    string
+	Version int64
+	// Previous is stored as a string rather than an IPLD link so retrieving a version
+	// doesn't pull the entire history
+	Previous cid.Cid
+	Entries  []*Entry
+}
+
+// head returns the latest commit of a publication
+func (i *Index) head(name string) *DataRef {
+	for j := len(i.Commits) - 1; j >= 0; j-- {
+		if i.Commits[j].Name == name {
+			return i.Commits[j]
+		}
+	}
+	return nil
+}
+
+// Version returns the commit of a given version of a publication
+func (i *Index) Version(name string, version int64) (*DataRef, error) {
+	for _, c := range i.Commits {
+		if c.Name == name && c.Version == version {
+			return c, nil
+		}
+	}
+	return nil, ErrVersionNotFound
 }
 
 // Commit stores the current contents of the index in an array to yield a single root CID
 func (w *Workdag) Commit(ctx context.Context, opts CommitOptions) (*DataRef, error) {
+	w.lk.stage.Lock()
+	defer w.lk.stage.Unlock()
+
 	idx, err := w.Index()
 	if err != nil {
 		return nil, err
@@ -267,28 +716,71 @@ func (w *Workdag) Commit(ctx context.Context, opts CommitOptions) (*DataRef, err
 	if len(idx.Entries) == 0 {
 		return nil, errors.New("workdag clean, nothing to commit")
 	}
+	if err := w.transform(ctx, idx, opts.Transforms); err != nil {
+		return nil, err
+	}
+
+	m := Manifest{
+		Name:    opts.Name,
+		Version: 1,
+	}
+	if prev := idx.head(opts.Name); prev != nil {
+		m.Version = prev.Version + 1
+		m.Previous = prev.PayloadCID
+	}
 
-	// We need a single root CID so we make a list with the roots of all
+	// We need a single root CID so we make a map with a list of the roots of all
 	// dagpb roots and use that in our CAR generation
-	nb := basicnode.Prototype.List.NewBuilder()
+	nb := basicnode.Prototype.Map.NewBuilder()
 
 	lb := cidlink.LinkBuilder{
 		Prefix: cid.Prefix{
 			Version:  1,
 			Codec:    0x71, // dag-cbor as per multicodec
-			MhType:   DefaultHashFunction,
+			MhType:   hashFunc(opts.HashFunc),
 			MhLength: -1,
 		},
 	}
 
-	as, err := nb.BeginList(int64(len(idx.Entries)))
+	fields := int64(3)
+	if m.Previous.Defined() {
+		fields++
+	}
+	ma, err := nb.BeginMap(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := assignString(ma, "Name", m.Name); err != nil {
+		return nil, err
+	}
+	vas, err := ma.AssembleEntry("Version")
+	if err != nil {
+		return nil, err
+	}
+	if err := vas.AssignInt(int64(m.Version)); err != nil {
+		return nil, err
+	}
+	if m.Previous.Defined() {
+		if err := assignString(ma, "Previous", m.Previous.String()); err != nil {
+			return nil, err
+		}
+	}
+	eas, err := ma.AssembleEntry("Entries")
+	if err != nil {
+		return nil, err
+	}
+	as, err := eas.BeginList(int64(len(idx.Entries)))
 	if err != nil {
 		return nil, err
 	}
 
 	for _, e := range idx.Entries {
-		// Each entry is a map with 2 keys: Name and Link
-		mas, err := as.AssembleValue().BeginMap(2)
+		// Each entry is a map with 2 keys: Name and Link, and the Variants if any
+		keys := int64(2)
+		if len(e.Variants) > 0 {
+			keys++
+		}
+		mas, err := as.AssembleValue().BeginMap(keys)
 		if err != nil {
 			return nil, err
 		}
@@ -309,6 +801,11 @@ func (w *Workdag) Commit(ctx context.Context, opts CommitOptions) (*DataRef, err
 		if err != nil {
 			return nil, err
 		}
+		if len(e.Variants) > 0 {
+			if err := assignVariants(mas, e.Variants); err != nil {
+				return nil, err
+			}
+		}
 		err = mas.Finish()
 		if err != nil {
 			return nil, err
@@ -318,6 +815,10 @@ func (w *Workdag) Commit(ctx context.Context, opts CommitOptions) (*DataRef, err
 	if err != nil {
 		return nil, err
 	}
+	err = ma.Finish()
+	if err != nil {
+		return nil, err
+	}
 
 	lnk, err := lb.Build(
 		ctx,
@@ -353,6 +854,14 @@ func (w *Workdag) Commit(ctx context.Context, opts CommitOptions) (*DataRef, err
 		PieceSize:   dataCIDSize.PieceSize,
 		PieceCID:    dataCIDSize.PieceCID,
 		StoreID:     w.storeID,
+		Name:        m.Name,
+		Version:     m.Version,
+		Previous:    m.Previous,
+	}
+	if opts.Register != nil {
+		if err := opts.Register(ref); err != nil {
+			return nil, err
+		}
 	}
 	// First we clear the entries once they'v been committed
 	var emptyEntries []*Entry
@@ -378,17 +887,72 @@ func (w *Workdag) Unpack(ctx context.Context, root cid.Cid, s multistore.StoreID
 	if err != nil {
 		return nil, err
 	}
-	lk := cidlink.Link{Cid: root}
-	nb := basicnode.Prototype.List.NewBuilder()
-
-	err = lk.Load(ctx, ipld.LinkContext{}, nb, store.Loader)
+	m, err := loadManifest(ctx, store, root)
 	if err != nil {
 		return nil, err
 	}
 	fls := make(map[string]files.Node)
+	for _, e := range m.Entries {
+		f, err := loadFile(ctx, store, e.Cid)
+		if err != nil {
+			return nil, err
+		}
+		fls[e.Name] = f
+	}
+	return fls, nil
+}
+
+// Manifest returns the manifest of a commit given its root and store ID
+func (w *Workdag) Manifest(ctx context.Context, root cid.Cid, s multistore.StoreID) (*Manifest, error) {
+	store, err := w.ms.Get(s)
+	if err != nil {
+		return nil, err
+	}
+	return loadManifest(ctx, store, root)
+}
+
+// loadManifest decodes a commit root. Commits packed before versioning was introduced are a plain
+// list of entries without version.
+func loadManifest(ctx context.Context, store *multistore.Store, root cid.Cid) (*Manifest, error) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	err := cidlink.Link{Cid: root}.Load(ctx, ipld.LinkContext{}, nb, store.Loader)
+	if err != nil {
+		return nil, err
+	}
 	nd := nb.Build()
+	m := &Manifest{}
+	if nd.Kind() == ipld.Kind_Map {
+		if n, err := nd.LookupByString("Name"); err == nil {
+			if m.Name, err = n.AsString(); err != nil {
+				return nil, err
+			}
+		}
+		n, err := nd.LookupByString("Version")
+		if err != nil {
+			return nil, err
+		}
+		v, err := n.AsInt()
+		if err != nil {
+			return nil, err
+		}
+		m.Version = int64(v)
+		if n, err := nd.LookupByString("Previous"); err == nil {
+			ps, err := n.AsString()
+			if err != nil {
+				return nil, err
+			}
+			if m.Previous, err = cid.Decode(ps); err != nil {
+				return nil, err
+			}
+		}
+		if nd, err = nd.LookupByString("Entries"); err != nil {
+			return nil, err
+		}
+	}
 	itr := nd.ListIterator()
-
+	if itr == nil {
+		return nil, fmt.Errorf("invalid manifest")
+	}
 	for !itr.Done() {
 		_, n, err := itr.Next()
 		if err != nil {
@@ -402,26 +966,194 @@ func (w *Workdag) Unpack(ctx context.Context, root cid.Cid, s multistore.StoreID
 		if err != nil {
 			return nil, err
 		}
-		flk := l.(cidlink.Link).Cid
-		dn, err := store.DAG.Get(ctx, flk)
+		entry, err = n.LookupByString("Name")
 		if err != nil {
 			return nil, err
 		}
-		f, err := unixfile.NewUnixfsFile(ctx, store.DAG, dn)
+		k, err := entry.AsString()
 		if err != nil {
 			return nil, err
 		}
-		entry, err = n.LookupByString("Name")
+		e := &Entry{Cid: l.(cidlink.Link).Cid, Name: k}
+		if vn, err := n.LookupByString("Variants"); err == nil {
+			if e.Variants, err = loadVariants(vn); err != nil {
+				return nil, err
+			}
+		}
+		m.Entries = append(m.Entries, e)
+	}
+	return m, nil
+}
+
+// assignVariants encodes the variants of an entry as a map of links sorted by name so the commit
+// CID is deterministic
+func assignVariants(ma ipld.MapAssembler, variants map[string]cid.Cid) error {
+	names := make([]string, 0, len(variants))
+	for name := range variants {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	vas, err := ma.AssembleEntry("Variants")
+	if err != nil {
+		return err
+	}
+	vma, err := vas.BeginMap(int64(len(names)))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		las, err := vma.AssembleEntry(name)
+		if err != nil {
+			return err
+		}
+		if err := las.AssignLink(cidlink.Link{Cid: variants[name]}); err != nil {
+			return err
+		}
+	}
+	return vma.Finish()
+}
+
+// loadVariants decodes the variants of a manifest entry
+func loadVariants(n ipld.Node) (map[string]cid.Cid, error) {
+	variants := make(map[string]cid.Cid)
+	itr := n.MapIterator()
+	if itr == nil {
+		return nil, fmt.Errorf("invalid variants")
+	}
+	for !itr.Done() {
+		k, v, err := itr.Next()
 		if err != nil {
 			return nil, err
 		}
-		k, err := entry.AsString()
+		name, err := k.AsString()
+		if err != nil {
+			return nil, err
+		}
+		l, err := v.AsLink()
 		if err != nil {
 			return nil, err
 		}
-		fls[k] = f
+		variants[name] = l.(cidlink.Link).Cid
 	}
-	return fls, nil
+	return variants, nil
+}
+
+// Variant returns the root of a variant of a manifest entry
+func (m *Manifest) Variant(name, variant string) (cid.Cid, error) {
+	i, err := m.entryIndex(name)
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, ok := m.Entries[i].Variants[variant]
+	if !ok {
+		return cid.Undef, ErrVariantNotFound
+	}
+	return c, nil
+}
+
+// transform derives the variants of the staged files and adds them to the store of the workdag.
+// dag-cbor objects are not files and are never transformed.
+func (w *Workdag) transform(ctx context.Context, idx *Index, ts []Transform) error {
+	if len(ts) == 0 {
+		return nil
+	}
+	for _, e := range idx.Entries {
+		if e.Cid.Prefix().Codec == cid.DagCBOR {
+			continue
+		}
+		nd, err := loadFile(ctx, w.store, e.Cid)
+		if err != nil {
+			return err
+		}
+		f, ok := nd.(files.File)
+		if !ok {
+			continue
+		}
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		for _, t := range ts {
+			out, ok, err := t.Transform(e.Name, data)
+			if err != nil {
+				return fmt.Errorf("%s transform of %s: %w", t.Name(), e.Name, err)
+			}
+			if !ok {
+				continue
+			}
+			c, err := w.addBytes(ctx, out)
+			if err != nil {
+				return err
+			}
+			if e.Variants == nil {
+				e.Variants = make(map[string]cid.Cid)
+			}
+			e.Variants[t.Name()] = c
+		}
+	}
+	return nil
+}
+
+// addBytes adds the content of a variant as a UnixFS DAG in the store of the workdag
+func (w *Workdag) addBytes(ctx context.Context, data []byte) (cid.Cid, error) {
+	bufferedDS := ipldformat.NewBufferedDAG(ctx, w.store.DAG)
+	prefix, err := AddOptions{}.prefix(cid.DagProtobuf)
+	if err != nil {
+		return cid.Undef, err
+	}
+	params := helpers.DagBuilderParams{
+		Maxlinks:   unixfsLinksPerLevel,
+		RawLeaves:  true,
+		CidBuilder: prefix,
+		Dagserv:    bufferedDS,
+	}
+	db, err := params.New(chunk.NewSizeSplitter(bytes.NewReader(data), chunk.DefaultBlockSize))
+	if err != nil {
+		return cid.Undef, err
+	}
+	n, err := balanced.Layout(db)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return n.Cid(), bufferedDS.Commit()
+}
+
+func assignString(ma ipld.MapAssembler, k, v string) error {
+	as, err := ma.AssembleEntry(k)
+	if err != nil {
+		return err
+	}
+	return as.AssignString(v)
+}
+
+// LoadFile returns a single DAG from a store as a file. UnixFS DAGs are read as regular files
+// while dag-cbor objects are encoded as dag-json.
+func (w *Workdag) LoadFile(ctx context.Context, root cid.Cid, s multistore.StoreID) (files.Node, error) {
+	store, err := w.ms.Get(s)
+	if err != nil {
+		return nil, err
+	}
+	return loadFile(ctx, store, root)
+}
+
+func loadFile(ctx context.Context, store *multistore.Store, root cid.Cid) (files.Node, error) {
+	if root.Prefix().Codec == cid.DagCBOR {
+		nb := basicnode.Prototype.Any.NewBuilder()
+		err := cidlink.Link{Cid: root}.Load(ctx, ipld.LinkContext{}, nb, store.Loader)
+		if err != nil {
+			return nil, err
+		}
+		buf := new(bytes.Buffer)
+		if err := dagjson.Encoder(nb.Build(), buf); err != nil {
+			return nil, err
+		}
+		return files.NewBytesFile(buf.Bytes()), nil
+	}
+	dn, err := store.DAG.Get(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	return unixfile.NewUnixfsFile(ctx, store.DAG, dn)
 }
 
 // Index contains the information about which objects are currently checked out
@@ -434,6 +1166,18 @@ type Index struct {
 	Entries []*Entry
 	// Commits is a collection of archived dags ready to be stored.
 	Commits []*DataRef
+
+	// base is a copy of the commits when the index was loaded so updates and removals can be told
+	// apart from the commits of other workdags
+	base map[cid.Cid]DataRef
+}
+
+// setBase records the current commits as the ones the index was loaded with
+func (i *Index) setBase() {
+	i.base = make(map[cid.Cid]DataRef, len(i.Commits))
+	for _, c := range i.Commits {
+		i.base[c.PayloadCID] = *c
+	}
 }
 
 // Add creates a new Entry and returns it. The caller should first check that
@@ -479,4 +1223,6 @@ type Entry struct {
 	Name string
 	// Size is the original file size
 	Size int64
+	// Variants are the roots of the variants derived from the file when packing by transform name
+	Variants map[string]cid.Cid `json:",omitempty"`
 }
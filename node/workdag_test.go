@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/rand"
 	"path/filepath"
 	"testing"
 
 	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dss "github.com/ipfs/go-datastore/sync"
 	files "github.com/ipfs/go-ipfs-files"
 	"github.com/ipfs/go-path"
+	mh "github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
 
@@ -133,3 +136,319 @@ func TestWorkdag(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, bytes, []byte(filevals["line1.txt"]))
 }
+
+func TestWorkdagCodecs(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	meta := filepath.Join(dir, "meta.json")
+	require.NoError(t, ioutil.WriteFile(meta, []byte(`{"name":"Myel","edition":1}`), 0666))
+	blob := filepath.Join(dir, "blob.bin")
+	require.NoError(t, ioutil.WriteFile(blob, []byte("raw bytes"), 0666))
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	mroot, err := wd.Add(ctx, AddOptions{Path: meta, Codec: cid.DagCBOR})
+	require.NoError(t, err)
+	require.Equal(t, uint64(cid.DagCBOR), mroot.Prefix().Codec)
+
+	broot, err := wd.Add(ctx, AddOptions{Path: blob, Codec: cid.Raw})
+	require.NoError(t, err)
+	require.Equal(t, uint64(cid.Raw), broot.Prefix().Codec)
+
+	com, err := wd.Commit(ctx, CommitOptions{})
+	require.NoError(t, err)
+
+	fileNds, err := wd.Unpack(ctx, com.PayloadCID, com.StoreID)
+	require.NoError(t, err)
+
+	bytes, err := io.ReadAll(fileNds["blob.bin"].(files.File))
+	require.NoError(t, err)
+	require.Equal(t, []byte("raw bytes"), bytes)
+
+	// dag-cbor objects are exported back as dag-json
+	bytes, err = io.ReadAll(fileNds["meta.json"].(files.File))
+	require.NoError(t, err)
+	require.Contains(t, string(bytes), "Myel")
+}
+
+func TestWorkdagHashFunctions(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	_, paths := genTestFiles(t)
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	root, err := wd.Add(ctx, AddOptions{Path: paths[0], ChunkSize: 1024})
+	require.NoError(t, err)
+	require.Equal(t, uint64(1), root.Version())
+	require.Equal(t, DefaultHashFunction, root.Prefix().MhType)
+
+	root, err = wd.Add(ctx, AddOptions{Path: paths[1], ChunkSize: 1024, HashFunc: mh.BLAKE3})
+	require.NoError(t, err)
+	require.Equal(t, uint64(mh.BLAKE3), root.Prefix().MhType)
+
+	root, err = wd.Add(ctx, AddOptions{Path: paths[2], ChunkSize: 1024, HashFunc: mh.SHA2_256, CidV0: true})
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), root.Version())
+
+	// CIDv0 only supports sha2-256 UnixFS DAGs
+	_, err = wd.Add(ctx, AddOptions{Path: paths[3], HashFunc: mh.BLAKE3, CidV0: true})
+	require.Error(t, err)
+	_, err = wd.Add(ctx, AddOptions{Path: paths[3], Codec: cid.Raw, CidV0: true})
+	require.Error(t, err)
+
+	com, err := wd.Commit(ctx, CommitOptions{HashFunc: mh.SHA2_256})
+	require.NoError(t, err)
+	require.Equal(t, uint64(mh.SHA2_256), com.PayloadCID.Prefix().MhType)
+}
+
+func TestWorkdagVersions(t *testing.T) {
+	ctx := context.Background()
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "index.html")
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	var coms []*DataRef
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, ioutil.WriteFile(fpath, []byte(fmt.Sprintf("<h1>Version %d</h1>", i)), 0666))
+		_, err = wd.Add(ctx, AddOptions{Path: fpath, ChunkSize: 1024})
+		require.NoError(t, err)
+		com, err := wd.Commit(ctx, CommitOptions{Name: "site"})
+		require.NoError(t, err)
+		require.Equal(t, int64(i), com.Version)
+		coms = append(coms, com)
+	}
+	// Other publications have their own lineage
+	_, err = wd.Add(ctx, AddOptions{Path: fpath, ChunkSize: 1024})
+	require.NoError(t, err)
+	other, err := wd.Commit(ctx, CommitOptions{Name: "blog"})
+	require.NoError(t, err)
+	require.Equal(t, int64(1), other.Version)
+	require.False(t, other.Previous.Defined())
+
+	m, err := wd.Manifest(ctx, coms[2].PayloadCID, coms[2].StoreID)
+	require.NoError(t, err)
+	require.Equal(t, "site", m.Name)
+	require.Equal(t, int64(3), m.Version)
+	require.Equal(t, coms[1].PayloadCID, m.Previous)
+	require.Len(t, m.Entries, 1)
+
+	idx, err := wd.Index()
+	require.NoError(t, err)
+	com, err := idx.Version("site", 1)
+	require.NoError(t, err)
+	require.Equal(t, coms[0].PayloadCID, com.PayloadCID)
+	_, err = idx.Version("site", 4)
+	require.Equal(t, ErrVersionNotFound, err)
+
+	fileNds, err := wd.Unpack(ctx, com.PayloadCID, com.StoreID)
+	require.NoError(t, err)
+	bytes, err := io.ReadAll(fileNds["index.html"].(files.File))
+	require.NoError(t, err)
+	require.Equal(t, "<h1>Version 1</h1>", string(bytes))
+}
+
+func TestNamedWorkdags(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	_, filepaths := genTestFiles(t)
+
+	def, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+	require.Equal(t, DefaultWorkdag, def.Name())
+	_, err = def.Add(ctx, AddOptions{Path: filepaths[0], ChunkSize: int64(1 << 10)})
+	require.NoError(t, err)
+
+	require.NoError(t, CheckoutWorkdag(ms, ds, "site"))
+	active, err := ActiveWorkdag(ds)
+	require.NoError(t, err)
+	require.Equal(t, "site", active)
+
+	// The checked out workdag has its own entries and store
+	site, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+	require.Equal(t, "site", site.Name())
+	require.NotEqual(t, def.StoreID(), site.StoreID())
+	status, err := site.Status()
+	require.NoError(t, err)
+	require.Equal(t, 0, len(status))
+	for i := 1; i < 3; i++ {
+		_, err := site.Add(ctx, AddOptions{Path: filepaths[i], ChunkSize: int64(1 << 10)})
+		require.NoError(t, err)
+	}
+
+	docs, err := NewNamedWorkdag(ms, ds, "docs")
+	require.NoError(t, err)
+	_, err = docs.Add(ctx, AddOptions{Path: filepaths[3], ChunkSize: int64(1 << 10)})
+	require.NoError(t, err)
+
+	// Both named workdags can be committed and share the history of the publications
+	ref1, err := site.Commit(ctx, CommitOptions{Name: "pub"})
+	require.NoError(t, err)
+	ref2, err := docs.Commit(ctx, CommitOptions{Name: "pub"})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), ref2.Version)
+	require.Equal(t, ref1.PayloadCID, ref2.Previous)
+
+	// The default workdag entries are untouched and it sees the commits of the others
+	def, err = NewNamedWorkdag(ms, ds, "")
+	require.NoError(t, err)
+	status, err = def.Status()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(status))
+	idx, err := def.Index()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(idx.Commits))
+
+	names, err := ListWorkdags(ds)
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultWorkdag, "docs", "site"}, names)
+
+	_, err = NewNamedWorkdag(ms, ds, "../oops")
+	require.Equal(t, ErrInvalidWorkdagName, err)
+}
+
+func TestWorkdagIndexMerge(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	commit := func(data string) *DataRef {
+		hash, err := mh.Sum([]byte(data), mh.SHA2_256, -1)
+		require.NoError(t, err)
+		return &DataRef{PayloadCID: cid.NewCidV1(cid.Raw, hash), PayloadSize: int64(len(data))}
+	}
+	def, err := NewNamedWorkdag(ms, ds, "")
+	require.NoError(t, err)
+	site, err := NewNamedWorkdag(ms, ds, "site")
+	require.NoError(t, err)
+
+	c1, c2 := commit("v1"), commit("v2")
+	idx, err := def.Index()
+	require.NoError(t, err)
+	idx.Commits = append(idx.Commits, c1, c2)
+	require.NoError(t, def.SetIndex(idx))
+
+	// Both workdags load the index before either of them records its changes
+	idxA, err := def.Index()
+	require.NoError(t, err)
+	idxB, err := site.Index()
+	require.NoError(t, err)
+
+	// An updated commit replaces the recorded one and a removed commit is dropped
+	updated := *idxA.Commits[0]
+	updated.PieceCID = commit("piece").PayloadCID
+	idxA.Commits = []*DataRef{&updated}
+	require.NoError(t, def.SetIndex(idxA))
+
+	// Changes of the other workdag are kept when recording a new commit
+	c3 := commit("v3")
+	idxB.Commits = append(idxB.Commits, c3)
+	require.NoError(t, site.SetIndex(idxB))
+
+	idx, err = site.Index()
+	require.NoError(t, err)
+	require.Equal(t, []*DataRef{&updated, c3}, idx.Commits)
+	idx, err = def.Index()
+	require.NoError(t, err)
+	require.Equal(t, []*DataRef{&updated, c3}, idx.Commits)
+
+	// Other repos don't share the locks
+	other, err := multistore.NewMultiDstore(dss.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	require.True(t, lockFor(ms) == def.lk)
+	require.False(t, lockFor(other) == def.lk)
+}
+
+func TestWorkdagChunkers(t *testing.T) {
+	ctx := context.Background()
+
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	ms, err := multistore.NewMultiDstore(ds)
+	require.NoError(t, err)
+
+	wd, err := NewWorkdag(ms, ds)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	data := make([]byte, 64<<10)
+	rand.New(rand.NewSource(42)).Read(data)
+	v1 := filepath.Join(dir, "v1")
+	require.NoError(t, ioutil.WriteFile(v1, data, 0666))
+	// The next version of the file has a few bytes inserted at the start
+	v2 := filepath.Join(dir, "v2")
+	require.NoError(t, ioutil.WriteFile(v2, append([]byte("new header"), data...), 0666))
+
+	leaves := func(root cid.Cid) map[cid.Cid]bool {
+		nd, err := wd.Store().DAG.Get(ctx, root)
+		require.NoError(t, err)
+		set := make(map[cid.Cid]bool)
+		for _, l := range nd.Links() {
+			set[l.Cid] = true
+		}
+		return set
+	}
+	shared := func(opts AddOptions) int {
+		opts.Path = v1
+		r1, err := wd.Add(ctx, opts)
+		require.NoError(t, err)
+		opts.Path = v2
+		r2, err := wd.Add(ctx, opts)
+		require.NoError(t, err)
+		l1, l2 := leaves(r1), leaves(r2)
+		n := 0
+		for c := range l2 {
+			if l1[c] {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Fixed size chunks all shift
+	require.Equal(t, 0, shared(AddOptions{ChunkSize: 1024}))
+	// Content defined chunks are mostly the same
+	require.Greater(t, shared(AddOptions{Chunker: "rabin-512-1024-2048"}), 32)
+
+	balancedRoot, err := wd.Add(ctx, AddOptions{Path: v1, ChunkSize: 256})
+	require.NoError(t, err)
+	trickleRoot, err := wd.Add(ctx, AddOptions{Path: v1, ChunkSize: 256, Layout: LayoutTrickle})
+	require.NoError(t, err)
+	require.NotEqual(t, balancedRoot, trickleRoot)
+
+	// Resumable adds build the same DAGs
+	root, err := wd.Add(ctx, AddOptions{Path: v1, ChunkSize: 256, Layout: LayoutTrickle, Resumable: true})
+	require.NoError(t, err)
+	require.Equal(t, trickleRoot, root)
+	rabinRoot, err := wd.Add(ctx, AddOptions{Path: v1, Chunker: "rabin-512-1024-2048"})
+	require.NoError(t, err)
+	root, err = wd.Add(ctx, AddOptions{Path: v1, Chunker: "rabin-512-1024-2048", Resumable: true, checkpointBytes: 8 << 10})
+	require.NoError(t, err)
+	require.Equal(t, rabinRoot, root)
+
+	_, err = wd.Add(ctx, AddOptions{Path: v1, Chunker: "fastcdc"})
+	require.Error(t, err)
+	_, err = wd.Add(ctx, AddOptions{Path: v1, ChunkSize: 1024, Layout: "flat"})
+	require.Error(t, err)
+}
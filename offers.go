@@ -0,0 +1,85 @@
+package pop
+
+import (
+	"sync"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// AskTTL is how long the offers we send remain valid. Clients cache them until then.
+const AskTTL = 10 * time.Minute
+
+// OfferCache keeps the verified offers providers sent us until they expire so we can skip querying
+// the network for content we recently looked up
+type OfferCache struct {
+	mu     sync.Mutex
+	offers map[cid.Cid]map[peer.ID]deal.Offer
+}
+
+// NewOfferCache creates an empty offer cache
+func NewOfferCache() *OfferCache {
+	return &OfferCache{
+		offers: make(map[cid.Cid]map[peer.ID]deal.Offer),
+	}
+}
+
+// Add caches an offer for a root replacing any previous offer of the same provider
+func (c *OfferCache) Add(root cid.Cid, offer deal.Offer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.offers[root] == nil {
+		c.offers[root] = make(map[peer.ID]deal.Offer)
+	}
+	c.offers[root][offer.PeerID] = offer
+}
+
+// Get returns the offers for a root which haven't expired yet and evicts the others
+func (c *OfferCache) Get(root cid.Cid) []deal.Offer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	var res []deal.Offer
+	for p, offer := range c.offers[root] {
+		if offer.Response.Expired(now) {
+			delete(c.offers[root], p)
+			continue
+		}
+		res = append(res, offer)
+	}
+	if len(c.offers[root]) == 0 {
+		delete(c.offers, root)
+	}
+	return res
+}
+
+// signAsk sets the expiry of an offer and signs it with our peer key so clients can tell it comes from us
+func (e *Exchange) signAsk(answer *deal.QueryResponse) {
+	answer.Expiry = uint64(time.Now().Add(AskTTL).Unix())
+	key := e.h.Peerstore().PrivKey(e.h.ID())
+	if key == nil {
+		return
+	}
+	if err := answer.Sign(key); err != nil {
+		e.log.Warn().Err(err).Msg("failed to sign query response")
+	}
+}
+
+// verifyOffer checks an offer is signed by the provider who sent it and hasn't expired
+func verifyOffer(ps peerstore.Peerstore, offer deal.Offer) error {
+	var pub crypto.PubKey
+	if ps != nil {
+		pub = ps.PubKey(offer.PeerID)
+	}
+	if err := offer.Response.Verify(offer.PeerID, pub); err != nil {
+		return err
+	}
+	if offer.Response.Expired(time.Now()) {
+		return deal.ErrAskExpired
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package pop
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOfferCache(t *testing.T) {
+	newOffer := func(expiry time.Time) (deal.Offer, crypto.PrivKey) {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(priv)
+		require.NoError(t, err)
+		addr, err := address.NewIDAddress(10)
+		require.NoError(t, err)
+		res := deal.QueryResponse{
+			Status:                     deal.QueryResponseAvailable,
+			Size:                       1600,
+			PaymentAddress:             addr,
+			MinPricePerByte:            deal.DefaultPricePerByte,
+			MaxPaymentInterval:         deal.DefaultPaymentInterval,
+			MaxPaymentIntervalIncrease: deal.DefaultPaymentIntervalIncrease,
+			Expiry:                     uint64(expiry.Unix()),
+		}
+		require.NoError(t, res.Sign(priv))
+		return deal.Offer{PeerID: id, Response: res}, priv
+	}
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+
+	valid, _ := newOffer(time.Now().Add(AskTTL))
+	require.NoError(t, verifyOffer(nil, valid))
+
+	expired, _ := newOffer(time.Now().Add(-time.Second))
+	require.Equal(t, deal.ErrAskExpired, verifyOffer(nil, expired))
+
+	// Offers signed by another peer are rejected
+	spoofed, _ := newOffer(time.Now().Add(AskTTL))
+	spoofed.PeerID = valid.PeerID
+	require.Equal(t, deal.ErrInvalidAskSignature, verifyOffer(nil, spoofed))
+
+	unsigned := valid
+	unsigned.Response.Signature = nil
+	require.Equal(t, deal.ErrInvalidAskSignature, verifyOffer(nil, unsigned))
+
+	cache := NewOfferCache()
+	cache.Add(root, valid)
+	cache.Add(root, expired)
+	offers := cache.Get(root)
+	require.Len(t, offers, 1)
+	require.Equal(t, valid.PeerID, offers[0].PeerID)
+	require.Len(t, cache.Get(gen.Next().Cid()), 0)
+}
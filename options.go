@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	dtfimpl "github.com/filecoin-project/go-data-transfer/impl"
@@ -28,8 +29,14 @@ import (
 	"github.com/ipld/go-ipld-prime/traversal"
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/supply"
+	"github.com/myelnet/pop/wallet"
+	"github.com/rs/zerolog"
 )
 
 // TODO: We should be able to customize these in the options
@@ -46,8 +53,70 @@ type Settings struct {
 	RepoPath            string
 	FilecoinRPCEndpoint string
 	FilecoinRPCHeader   http.Header
+	// FilecoinAPI is used instead of connecting to the FilecoinRPCEndpoint when set e.g. a filecoin.FakeAPI
+	FilecoinAPI filecoin.API
 	// Probably temporary as we want Regions to be more dynamic eventually
 	Regions []supply.Region
+	// SectorAccessor is optional and lets a cache colocated with a miner serve content from unsealed sectors
+	SectorAccessor supply.SectorAccessor
+	// Capacity is the storage space in bytes we advertise on the market. Zero means we don't advertise.
+	Capacity uint64
+	// ReplicationStrategy is the name of the strategy selecting which caches we dispatch content to:
+	// first, random, latency, free-space or region. Defaults to the first connected caches.
+	ReplicationStrategy string
+	// SelectionStrategy is a custom strategy overriding ReplicationStrategy
+	SelectionStrategy supply.ProviderSelectionStrategy
+	// EvictionPolicy is the name of the policy evicting cached content when our usage gets close to
+	// the Capacity: lru, lfu or none. Eviction is disabled without a capacity.
+	EvictionPolicy string
+	// Gateways are caches relaying our dispatches to the regions we have no peers in
+	Gateways []peer.AddrInfo
+	// Gateway relays the dispatches of publishers outside our regions to the caches in our regions
+	Gateway bool
+	// DAGLimits bounds the DAGs we pull. Defaults to supply.DefaultDAGLimits when zero.
+	DAGLimits supply.DAGLimits
+	// MaxPulls is how many dispatched contents we pull at the same time. Defaults to supply.DefaultMaxPulls
+	// when zero, a negative value removes the limit.
+	MaxPulls int
+	// DispatchRate is how many dispatch requests per minute we accept from a single publisher. Defaults to
+	// supply.DefaultDispatchRate when zero, a negative value removes the limit.
+	DispatchRate int
+	// PublisherQuota is how many bytes of content each publisher can cache on our node. Zero means no limit.
+	PublisherQuota uint64
+	// AcceptRules replace the rules deciding which dispatch requests we pull when set
+	AcceptRules *supply.AcceptRules
+	// ColdStore receives the content we evict so it can be recalled later instead of being deleted
+	ColdStore supply.ObjectStore
+	// Tiering moves content between memory, disk and the ColdStore from its access stats. Disabled when nil.
+	Tiering *supply.TieringPolicy
+	// RegionProvider refreshes the definitions of the regions we are part of. Disabled when nil.
+	RegionProvider supply.RegionProvider
+	// Routing publishes provider records for the content we cache e.g. on the IPFS DHT and finds the
+	// caches we aren't connected to. Disabled when nil.
+	Routing routing.ContentRouting
+	// ReprovideInterval is how often we publish provider records for all our content again. Defaults
+	// to DefaultReprovideInterval when zero.
+	ReprovideInterval time.Duration
+	// AuditInterval is how often we retrieve a sample of the content we published from the caches
+	// holding it. Zero disables audits.
+	AuditInterval time.Duration
+	// Indexers are the endpoints of the network indexers we advertise the content we cache to, using
+	// the storetheindex ingestion protocol
+	Indexers []string
+	// Wallet is the URI of the wallet driver holding our keys such as unix:///run/pop-signer.sock.
+	// Defaults to the Keystore.
+	Wallet string
+	// ConfirmMessage is called before signing messages with a value of at least ConfirmThreshold.
+	// Messages are signed without confirmation when nil.
+	ConfirmMessage   wallet.ConfirmFunc
+	ConfirmThreshold filecoin.BigInt
+	// Payer is an authorization from another address to pay for our retrievals. Its payment channels
+	// and vouchers are signed by the PayerWallet.
+	Payer *paychmgr.SignedAuthorization
+	// PayerWallet is the URI of the wallet driver holding the payer key, defaults to the Keystore
+	PayerWallet string
+	// Logger receives the warnings and errors of all the exchange subsystems. Defaults to the global zerolog logger.
+	Logger *zerolog.Logger
 }
 
 // NewDataTransfer packages together all the things needed for a new manager to work
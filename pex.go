@@ -0,0 +1,65 @@
+package pop
+
+import (
+	"math/rand"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// PEXPeers is how many other members of a region we share in our query responses so sparsely
+// connected peers discover more of the region
+const PEXPeers = 3
+
+// regionPeers returns the p2p addresses of up to n random members of a region we know how to reach,
+// leaving out the given peer
+func (e *Exchange) regionPeers(region string, except peer.ID, n int) []string {
+	e.mu.Lock()
+	topic, ok := e.regionTopics[region]
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	members := topic.ListPeers()
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	var addrs []string
+	for _, p := range members {
+		if n == 0 {
+			break
+		}
+		if p == except || p == e.h.ID() {
+			continue
+		}
+		info := e.h.Peerstore().PeerInfo(p)
+		if len(info.Addrs) == 0 {
+			continue
+		}
+		paddrs, err := peer.AddrInfoToP2pAddrs(&info)
+		if err != nil {
+			continue
+		}
+		for _, a := range paddrs {
+			addrs = append(addrs, a.String())
+		}
+		n--
+	}
+	return addrs
+}
+
+// addPEXPeers adds the region members shared by a provider to our peerstore. Invalid addresses are ignored.
+func addPEXPeers(ps peerstore.Peerstore, self peer.ID, addrs []string) {
+	for _, s := range addrs {
+		addr, err := ma.NewMultiaddr(s)
+		if err != nil {
+			continue
+		}
+		info, err := peer.AddrInfoFromP2pAddr(addr)
+		if err != nil || info.ID == self {
+			continue
+		}
+		ps.AddAddrs(info.ID, info.Addrs, peerstore.AddressTTL)
+	}
+}
@@ -0,0 +1,37 @@
+package pop
+
+import (
+	"crypto/rand"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-peerstore/pstoremem"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddPEXPeers(t *testing.T) {
+	newPeer := func() peer.ID {
+		priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+		require.NoError(t, err)
+		id, err := peer.IDFromPrivateKey(priv)
+		require.NoError(t, err)
+		return id
+	}
+	self := newPeer()
+	other := newPeer()
+	addr := ma.StringCast("/ip4/127.0.0.1/tcp/41505")
+
+	ps := pstoremem.NewPeerstore()
+	addPEXPeers(ps, self, []string{
+		addr.String() + "/p2p/" + other.String(),
+		addr.String() + "/p2p/" + self.String(),
+		"/not/an/addr",
+		addr.String(),
+	})
+	require.Len(t, ps.Addrs(other), 1)
+	require.True(t, ps.Addrs(other)[0].Equal(addr))
+	require.Len(t, ps.Addrs(self), 0)
+	require.Len(t, ps.PeersWithAddrs(), 1)
+}
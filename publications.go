@@ -0,0 +1,340 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+)
+
+//go:generate cbor-gen-for Publication
+
+// PublicationTopic is the gossip topic where publishers announce the latest root of their publications
+const PublicationTopic = "/myel/pop/publication/1.0"
+
+// RepublishInterval is how often we publish our records again so new peers learn about them
+const RepublishInterval = 10 * time.Minute
+
+// ErrNameNotFound is returned when we don't know any publication with a given name
+var ErrNameNotFound = errors.New("name not found")
+
+// ErrAmbiguousName is returned when different publishers use the same name. The name must then be
+// prefixed with the publisher peer ID.
+var ErrAmbiguousName = errors.New("name published by multiple publishers, use <peer id>/<name>")
+
+// ErrStaleVersion is returned when publishing a version older than the latest one
+var ErrStaleVersion = errors.New("stale version")
+
+// Publication is a signed record mapping a name to the latest root of a publisher's content
+type Publication struct {
+	Name      string
+	Root      cid.Cid
+	Version   uint64
+	Publisher peer.ID
+	// Time is the unix time when the record was signed
+	Time      uint64
+	Signature []byte
+}
+
+func (p Publication) signingBytes() ([]byte, error) {
+	p.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := p.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Verify checks the record was signed by its publisher
+func (p Publication) Verify() error {
+	pub, err := p.Publisher.ExtractPublicKey()
+	if err != nil {
+		return err
+	}
+	b, err := p.signingBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(b, p.Signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("invalid publication signature")
+	}
+	return nil
+}
+
+// newer checks if a record supersedes another one for the same name
+func (p Publication) newer(other Publication) bool {
+	if p.Version != other.Version {
+		return p.Version > other.Version
+	}
+	return p.Time > other.Time
+}
+
+func publicationKey(p peer.ID, name string) datastore.Key {
+	return datastore.NewKey(p.String()).ChildString(name)
+}
+
+// Publications keeps track of the named publications in our regions
+type Publications struct {
+	h   host.Host
+	ps  *pubsub.PubSub
+	ds  datastore.Batching
+	log zerolog.Logger
+
+	// mu makes sure updates of a record are atomic
+	mu     sync.Mutex
+	topics map[string]*pubsub.Topic
+	subs   map[string]*pubsub.Subscription
+	// own are the records we published ourselves
+	own map[string]Publication
+}
+
+// NewPublications joins the publication topics of the given regions and starts recording
+// the publications we receive
+func NewPublications(ctx context.Context, h host.Host, ps *pubsub.PubSub, ds datastore.Batching, regions []supply.Region, log zerolog.Logger) (*Publications, error) {
+	p := &Publications{
+		h:      h,
+		ps:     ps,
+		ds:     namespace.Wrap(ds, datastore.NewKey("/publications")),
+		log:    log,
+		topics: make(map[string]*pubsub.Topic),
+		subs:   make(map[string]*pubsub.Subscription),
+		own:    make(map[string]Publication),
+	}
+	for _, r := range regions {
+		if err := p.joinRegion(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	go p.republishLoop(ctx)
+	return p, nil
+}
+
+// joinRegion starts recording the publications of a region and announcing ours there.
+// Records we already know are kept when leaving a region.
+func (p *Publications) joinRegion(ctx context.Context, r supply.Region) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.topics[r.Name]; ok {
+		return nil
+	}
+	topic, err := p.ps.Join(fmt.Sprintf("%s/%s", PublicationTopic, r.Name))
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		topic.Close()
+		return err
+	}
+	p.topics[r.Name] = topic
+	p.subs[r.Name] = sub
+	go p.subscriptionLoop(ctx, sub)
+	return nil
+}
+
+// leaveRegion stops announcing our publications in a region
+func (p *Publications) leaveRegion(name string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sub, ok := p.subs[name]; ok {
+		sub.Cancel()
+		delete(p.subs, name)
+	}
+	if topic, ok := p.topics[name]; ok {
+		delete(p.topics, name)
+		return topic.Close()
+	}
+	return nil
+}
+
+func (p *Publications) subscriptionLoop(ctx context.Context, sub *pubsub.Subscription) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == p.h.ID() {
+			continue
+		}
+		var rec Publication
+		if err := rec.UnmarshalCBOR(bytes.NewReader(msg.Data)); err != nil {
+			continue
+		}
+		// Publishers can only publish records for themselves
+		if rec.Publisher != msg.GetFrom() || rec.Verify() != nil {
+			continue
+		}
+		if err := p.put(rec); err != nil && !errors.Is(err, ErrStaleVersion) {
+			p.log.Error().Err(err).Str("name", rec.Name).Msg("failed to record publication")
+		}
+	}
+}
+
+// put records a publication if it is newer than the one we have
+func (p *Publications) put(rec Publication) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := publicationKey(rec.Publisher, rec.Name)
+	if enc, err := p.ds.Get(key); err == nil {
+		var cur Publication
+		if err := cur.UnmarshalCBOR(bytes.NewReader(enc)); err == nil && !rec.newer(cur) {
+			return ErrStaleVersion
+		}
+	}
+	buf := new(bytes.Buffer)
+	if err := rec.MarshalCBOR(buf); err != nil {
+		return err
+	}
+	return p.ds.Put(key, buf.Bytes())
+}
+
+// Publish signs a record mapping a name to a new root and announces it in our regions.
+// Versions must increase so consumers never go back to an older root.
+func (p *Publications) Publish(ctx context.Context, name string, root cid.Cid, version uint64) (Publication, error) {
+	rec := Publication{
+		Name:      name,
+		Root:      root,
+		Version:   version,
+		Publisher: p.h.ID(),
+		Time:      uint64(time.Now().Unix()),
+	}
+	b, err := rec.signingBytes()
+	if err != nil {
+		return rec, err
+	}
+	rec.Signature, err = p.h.Peerstore().PrivKey(p.h.ID()).Sign(b)
+	if err != nil {
+		return rec, err
+	}
+	if err := p.put(rec); err != nil {
+		return rec, err
+	}
+	p.mu.Lock()
+	p.own[name] = rec
+	p.mu.Unlock()
+	return rec, p.publish(ctx, rec)
+}
+
+func (p *Publications) publish(ctx context.Context, rec Publication) error {
+	buf := new(bytes.Buffer)
+	if err := rec.MarshalCBOR(buf); err != nil {
+		return err
+	}
+	// Copy the topics as we may join or leave regions while publishing
+	p.mu.Lock()
+	topics := make([]*pubsub.Topic, 0, len(p.topics))
+	for _, topic := range p.topics {
+		topics = append(topics, topic)
+	}
+	p.mu.Unlock()
+	for _, topic := range topics {
+		if err := topic.Publish(ctx, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Publications) republishLoop(ctx context.Context) {
+	ticker := time.NewTicker(RepublishInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.mu.Lock()
+			var recs []Publication
+			for _, rec := range p.own {
+				recs = append(recs, rec)
+			}
+			p.mu.Unlock()
+			for _, rec := range recs {
+				if err := p.publish(ctx, rec); err != nil {
+					p.log.Warn().Err(err).Str("name", rec.Name).Msg("failed to republish")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// List returns all the publications we know about
+func (p *Publications) List() ([]Publication, error) {
+	res, err := p.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	recs := make([]Publication, 0, len(entries))
+	for _, e := range entries {
+		var rec Publication
+		if err := rec.UnmarshalCBOR(bytes.NewReader(e.Value)); err != nil {
+			return nil, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// Resolve returns the latest record for a name. Names published by different publishers
+// must be prefixed with the publisher peer ID: <peer id>/<name>.
+func (p *Publications) Resolve(name string) (Publication, error) {
+	if i := strings.Index(name, "/"); i != -1 {
+		pid, err := peer.Decode(name[:i])
+		if err == nil {
+			enc, err := p.ds.Get(publicationKey(pid, name[i+1:]))
+			if errors.Is(err, datastore.ErrNotFound) {
+				return Publication{}, ErrNameNotFound
+			}
+			if err != nil {
+				return Publication{}, err
+			}
+			var rec Publication
+			err = rec.UnmarshalCBOR(bytes.NewReader(enc))
+			return rec, err
+		}
+	}
+	recs, err := p.List()
+	if err != nil {
+		return Publication{}, err
+	}
+	var found []Publication
+	for _, rec := range recs {
+		if rec.Name == name {
+			found = append(found, rec)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return Publication{}, ErrNameNotFound
+	case 1:
+		return found[0], nil
+	}
+	// Our own publications take precedence
+	for _, rec := range found {
+		if rec.Publisher == p.h.ID() {
+			return rec, nil
+		}
+	}
+	return Publication{}, ErrAmbiguousName
+}
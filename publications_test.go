@@ -0,0 +1,68 @@
+package pop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublications(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	regions := []supply.Region{supply.Regions["Global"]}
+
+	var pubs []*Publications
+	for i := 0; i < 2; i++ {
+		n := testutil.NewTestNode(mn, t)
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+		p, err := NewPublications(ctx, n.Host, ps, dssync.MutexWrap(datastore.NewMapDatastore()), regions, zerolog.Nop())
+		require.NoError(t, err)
+		pubs = append(pubs, p)
+	}
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	// Wait for the gossip mesh to form
+	time.Sleep(time.Second)
+
+	hash, err := mh.Sum([]byte("v1"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	v1 := cid.NewCidV1(cid.Raw, hash)
+	hash, err = mh.Sum([]byte("v2"), mh.SHA2_256, -1)
+	require.NoError(t, err)
+	v2 := cid.NewCidV1(cid.Raw, hash)
+
+	_, err = pubs[0].Publish(ctx, "site", v1, 1)
+	require.NoError(t, err)
+	_, err = pubs[0].Publish(ctx, "site", v2, 2)
+	require.NoError(t, err)
+	// Versions can't go back
+	_, err = pubs[0].Publish(ctx, "site", v1, 1)
+	require.Equal(t, ErrStaleVersion, err)
+
+	require.Eventually(t, func() bool {
+		rec, err := pubs[1].Resolve("site")
+		return err == nil && rec.Root.Equals(v2)
+	}, 5*time.Second, 50*time.Millisecond)
+
+	rec, err := pubs[1].Resolve(pubs[0].h.ID().String() + "/site")
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), rec.Version)
+	require.NoError(t, rec.Verify())
+
+	_, err = pubs[1].Resolve("blog")
+	require.Equal(t, ErrNameNotFound, err)
+}
@@ -0,0 +1,167 @@
+package pop
+
+import (
+	"context"
+	"errors"
+
+	"github.com/myelnet/pop/retrieval/deal"
+)
+
+// DefaultRaceBytes is how many bytes a provider must send us first to win a race
+const DefaultRaceBytes = 256 << 10
+
+// ErrRaceLost is returned when none of the racing providers delivered the content
+var ErrRaceLost = errors.New("all racing providers failed")
+
+// race tracks deals with several providers competing for the same transfer. The first deal to
+// receive enough bytes wins and the others are cancelled.
+type race struct {
+	threshold uint64
+	offers    map[deal.ID]*deal.Offer
+	// seen is the last state of deals which changed before we registered them
+	seen map[deal.ID]deal.ClientState
+	// started is set once all the deals are registered
+	started bool
+	failed  int
+	winner  *deal.ID
+	// decided is closed once we have a winner or all the deals failed
+	decided chan struct{}
+	closed  bool
+}
+
+func newRace(threshold uint64) *race {
+	return &race{
+		threshold: threshold,
+		offers:    make(map[deal.ID]*deal.Offer),
+		seen:      make(map[deal.ID]deal.ClientState),
+		decided:   make(chan struct{}),
+	}
+}
+
+// register adds a deal to the race and returns its last state if it changed before. Must be called
+// with the session lock.
+func (r *race) register(id deal.ID, of *deal.Offer) (deal.ClientState, bool) {
+	r.offers[id] = of
+	state, ok := r.seen[id]
+	if ok {
+		delete(r.seen, id)
+		r.update(state)
+	}
+	return state, ok
+}
+
+// start tells all the deals are registered. Must be called with the session lock.
+func (r *race) start() {
+	r.started = true
+	r.check()
+}
+
+func (r *race) decide() {
+	if !r.closed {
+		r.closed = true
+		close(r.decided)
+	}
+}
+
+// check decides the race is lost once all the deals failed
+func (r *race) check() {
+	if r.started && r.failed == len(r.offers) {
+		r.decide()
+	}
+}
+
+// update checks if a racing deal won or failed. Must be called with the session lock.
+func (r *race) update(state deal.ClientState) {
+	if r.closed {
+		return
+	}
+	if _, ok := r.offers[state.ID]; !ok {
+		r.seen[state.ID] = state
+		return
+	}
+	switch state.Status {
+	case deal.StatusCompleted:
+	case deal.StatusCancelled, deal.StatusErrored, deal.StatusRejected, deal.StatusDealNotFound:
+		r.failed++
+		r.check()
+		return
+	default:
+		if state.TotalReceived < r.threshold {
+			return
+		}
+	}
+	id := state.ID
+	r.winner = &id
+	r.decide()
+}
+
+// Race starts deals with the providers of all the offers at once and keeps the first one to send us
+// threshold bytes, cancelling the others. The losers may have received and been paid for their first
+// blocks. It returns the offer of the winning provider.
+func (s *Session) Race(ctx context.Context, offers []deal.Offer, threshold uint64) (*deal.Offer, error) {
+	r := newRace(threshold)
+	s.mu.Lock()
+	s.race = r
+	s.mu.Unlock()
+
+	var err error
+	for i := range offers {
+		of := &offers[i]
+		id, rerr := s.retrieve(ctx, of)
+		if rerr != nil {
+			err = rerr
+			continue
+		}
+		s.mu.Lock()
+		state, replayed := r.register(id, of)
+		won := r.winner != nil
+		if won {
+			s.dealID = r.winner
+		}
+		s.mu.Unlock()
+		// The winner may have completed before we registered it
+		if replayed && won && *r.winner == id {
+			s.finish(state)
+		}
+		// No need to start more deals once one won
+		if won {
+			break
+		}
+	}
+	s.mu.Lock()
+	r.start()
+	if len(r.offers) == 0 {
+		s.race = nil
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-r.decided:
+	case <-ctx.Done():
+		s.cancelRace(r, nil)
+		return nil, ctx.Err()
+	}
+
+	s.mu.Lock()
+	winner := r.winner
+	s.race = nil
+	s.mu.Unlock()
+	s.cancelRace(r, winner)
+	if winner == nil {
+		return nil, ErrRaceLost
+	}
+	return r.offers[*winner], nil
+}
+
+// cancelRace cancels all the racing deals but the winner
+func (s *Session) cancelRace(r *race, winner *deal.ID) {
+	for id := range r.offers {
+		if winner != nil && id == *winner {
+			continue
+		}
+		// Deals which already failed can't be cancelled
+		_ = s.retriever.CancelDeal(id)
+	}
+}
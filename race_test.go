@@ -0,0 +1,70 @@
+package pop
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRankOffers(t *testing.T) {
+	offer := func(ppb int64, size uint64) deal.Offer {
+		return deal.Offer{Response: deal.QueryResponse{
+			Size:            size,
+			MinPricePerByte: abi.NewTokenAmount(ppb),
+			UnsealPrice:     abi.NewTokenAmount(0),
+		}}
+	}
+	offers := RankOffers([]deal.Offer{offer(3, 100), offer(1, 100), offer(2, 50), offer(1, 101)})
+	// Same price keeps the fastest first
+	require.Equal(t, uint64(100), offers[0].Response.Size)
+	require.Equal(t, uint64(50), offers[1].Response.Size)
+	require.Equal(t, uint64(101), offers[2].Response.Size)
+	require.Equal(t, int64(3), offers[3].Response.MinPricePerByte.Int64())
+}
+
+func TestRace(t *testing.T) {
+	t.Run("first to receive the threshold wins", func(t *testing.T) {
+		r := newRace(100)
+		r.register(1, &deal.Offer{})
+		r.register(2, &deal.Offer{})
+		r.start()
+
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 1}, Status: deal.StatusOngoing, TotalReceived: 50})
+		require.Nil(t, r.winner)
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 2}, Status: deal.StatusOngoing, TotalReceived: 120})
+		require.Equal(t, deal.ID(2), *r.winner)
+		<-r.decided
+
+		// Later progress doesn't change the winner
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 1}, Status: deal.StatusOngoing, TotalReceived: 200})
+		require.Equal(t, deal.ID(2), *r.winner)
+	})
+
+	t.Run("events before registration are replayed", func(t *testing.T) {
+		r := newRace(100)
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 1}, Status: deal.StatusCompleted, TotalReceived: 10})
+		state, replayed := r.register(1, &deal.Offer{})
+		require.True(t, replayed)
+		require.Equal(t, deal.StatusCompleted, state.Status)
+		require.Equal(t, deal.ID(1), *r.winner)
+	})
+
+	t.Run("lost once all deals failed", func(t *testing.T) {
+		r := newRace(100)
+		r.register(1, &deal.Offer{})
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 1}, Status: deal.StatusErrored})
+		r.register(2, &deal.Offer{})
+		// Not decided until all the deals are registered
+		select {
+		case <-r.decided:
+			t.Fatal("race decided early")
+		default:
+		}
+		r.start()
+		r.update(deal.ClientState{Proposal: deal.Proposal{ID: 2}, Status: deal.StatusRejected})
+		<-r.decided
+		require.Nil(t, r.winner)
+	})
+}
@@ -0,0 +1,205 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+)
+
+// ErrAskNotFound is returned when no ask applies to a target
+var ErrAskNotFound = errors.New("ask not found")
+
+// AskTargetDefault is the target of the ask applying to all the content without an override
+const AskTargetDefault = "default"
+
+// Ask is the price and payment terms we offer clients querying our content
+type Ask struct {
+	PricePerByte            abi.TokenAmount
+	UnsealPrice             abi.TokenAmount
+	PaymentInterval         uint64
+	PaymentIntervalIncrease uint64
+}
+
+// AskEntry is an ask with the content it applies to
+type AskEntry struct {
+	// Target is either AskTargetDefault, a content root or a label as <key>=<value>
+	Target string
+	Ask    Ask
+}
+
+// Asks persists the default ask of the provider and the asks overriding it for a content root or for the
+// content with a given label
+type Asks struct {
+	ds datastore.Batching
+
+	mu     sync.RWMutex
+	def    *Ask
+	roots  map[cid.Cid]Ask
+	labels map[string]Ask
+}
+
+// NewAsks loads the asks persisted in the datastore
+func NewAsks(ds datastore.Batching) (*Asks, error) {
+	a := &Asks{
+		ds:     namespace.Wrap(ds, datastore.NewKey("/retrieval/asks")),
+		roots:  make(map[cid.Cid]Ask),
+		labels: make(map[string]Ask),
+	}
+	res, err := a.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		var ask Ask
+		if err := json.Unmarshal(e.Value, &ask); err != nil {
+			return nil, err
+		}
+		if err := a.put(strings.TrimPrefix(e.Key, "/"), ask); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// put sets the ask of a target in memory
+func (a *Asks) put(target string, ask Ask) error {
+	switch {
+	case target == AskTargetDefault:
+		a.def = &ask
+	case strings.Contains(target, "="):
+		a.labels[target] = ask
+	default:
+		root, err := cid.Decode(target)
+		if err != nil {
+			return fmt.Errorf("invalid ask target %q: expected default, a cid or <key>=<value>", target)
+		}
+		a.roots[root] = ask
+	}
+	return nil
+}
+
+// Set persists the ask of a target which is either AskTargetDefault, a content root or a label as
+// <key>=<value>
+func (a *Asks) Set(target string, ask Ask) error {
+	if ask.PricePerByte.Nil() {
+		return fmt.Errorf("ask for %s has no price per byte", target)
+	}
+	if ask.UnsealPrice.Nil() {
+		ask.UnsealPrice = abi.NewTokenAmount(0)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := a.put(target, ask); err != nil {
+		return err
+	}
+	b, err := json.Marshal(ask)
+	if err != nil {
+		return err
+	}
+	return a.ds.Put(datastore.NewKey(target), b)
+}
+
+// Remove deletes the ask of a target
+func (a *Asks) Remove(target string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.get(target); err != nil {
+		return err
+	}
+	switch {
+	case target == AskTargetDefault:
+		a.def = nil
+	case strings.Contains(target, "="):
+		delete(a.labels, target)
+	default:
+		root, _ := cid.Decode(target)
+		delete(a.roots, root)
+	}
+	return a.ds.Delete(datastore.NewKey(target))
+}
+
+// Get returns the ask set for a target
+func (a *Asks) Get(target string) (Ask, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.get(target)
+}
+
+func (a *Asks) get(target string) (Ask, error) {
+	switch {
+	case target == AskTargetDefault:
+		if a.def != nil {
+			return *a.def, nil
+		}
+	case strings.Contains(target, "="):
+		if ask, ok := a.labels[target]; ok {
+			return ask, nil
+		}
+	default:
+		root, err := cid.Decode(target)
+		if err != nil {
+			return Ask{}, fmt.Errorf("invalid ask target %q: expected default, a cid or <key>=<value>", target)
+		}
+		if ask, ok := a.roots[root]; ok {
+			return ask, nil
+		}
+	}
+	return Ask{}, ErrAskNotFound
+}
+
+// Lookup returns the ask applying to a content with the given labels. Content root overrides come first,
+// then label overrides in alphabetical order, then the default ask.
+func (a *Asks) Lookup(root cid.Cid, labels map[string]string) (Ask, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if ask, ok := a.roots[root]; ok {
+		return ask, true
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if ask, ok := a.labels[k+"="+labels[k]]; ok {
+			return ask, true
+		}
+	}
+	if a.def != nil {
+		return *a.def, true
+	}
+	return Ask{}, false
+}
+
+// List returns the default ask first then the overrides sorted by target
+func (a *Asks) List() []AskEntry {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var entries []AskEntry
+	for root, ask := range a.roots {
+		entries = append(entries, AskEntry{Target: root.String(), Ask: ask})
+	}
+	for label, ask := range a.labels {
+		entries = append(entries, AskEntry{Target: label, Ask: ask})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Target < entries[j].Target
+	})
+	if a.def != nil {
+		entries = append([]AskEntry{{Target: AskTargetDefault, Ask: *a.def}}, entries...)
+	}
+	return entries
+}
@@ -0,0 +1,66 @@
+package retrieval
+
+import (
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsks(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	asks, err := NewAsks(ds)
+	require.NoError(t, err)
+
+	root := blockGen.Next().Cid()
+	other := blockGen.Next().Cid()
+	labels := map[string]string{"publisher": "pub1", "region": "Europe"}
+
+	_, ok := asks.Lookup(root, labels)
+	require.False(t, ok)
+
+	// Asks must have a price
+	require.Error(t, asks.Set(AskTargetDefault, Ask{PaymentInterval: 1 << 20}))
+	require.Error(t, asks.Set("notacid", Ask{PricePerByte: abi.NewTokenAmount(1)}))
+
+	require.NoError(t, asks.Set(AskTargetDefault, Ask{PricePerByte: abi.NewTokenAmount(1)}))
+	ask, ok := asks.Lookup(root, labels)
+	require.True(t, ok)
+	require.Equal(t, "1", ask.PricePerByte.String())
+	require.Equal(t, "0", ask.UnsealPrice.String())
+
+	require.NoError(t, asks.Set("region=Europe", Ask{PricePerByte: abi.NewTokenAmount(3)}))
+	require.NoError(t, asks.Set("publisher=pub1", Ask{PricePerByte: abi.NewTokenAmount(2)}))
+	// Labels are matched in alphabetical order of their keys
+	ask, _ = asks.Lookup(root, labels)
+	require.Equal(t, "2", ask.PricePerByte.String())
+	ask, _ = asks.Lookup(root, map[string]string{"region": "Europe"})
+	require.Equal(t, "3", ask.PricePerByte.String())
+
+	require.NoError(t, asks.Set(root.String(), Ask{PricePerByte: abi.NewTokenAmount(4), UnsealPrice: abi.NewTokenAmount(100)}))
+	ask, _ = asks.Lookup(root, labels)
+	require.Equal(t, "4", ask.PricePerByte.String())
+	require.Equal(t, "100", ask.UnsealPrice.String())
+	ask, _ = asks.Lookup(other, nil)
+	require.Equal(t, "1", ask.PricePerByte.String())
+
+	// Asks are persisted
+	asks, err = NewAsks(ds)
+	require.NoError(t, err)
+	entries := asks.List()
+	require.Len(t, entries, 4)
+	require.Equal(t, AskTargetDefault, entries[0].Target)
+	ask, _ = asks.Lookup(root, labels)
+	require.Equal(t, "4", ask.PricePerByte.String())
+
+	require.NoError(t, asks.Remove(root.String()))
+	require.Equal(t, ErrAskNotFound, asks.Remove(root.String()))
+	ask, _ = asks.Lookup(root, labels)
+	require.Equal(t, "2", ask.PricePerByte.String())
+
+	require.NoError(t, asks.Remove(AskTargetDefault))
+	_, ok = asks.Lookup(other, nil)
+	require.False(t, ok)
+}
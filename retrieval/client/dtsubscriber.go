@@ -7,6 +7,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-statemachine/fsm"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog"
 )
 
 // EventReceiver is any thing that can receive FSM events
@@ -42,7 +43,7 @@ func eventFromDealStatus(response *deal.Response) (Event, []interface{}) {
 
 const noEvent = Event(math.MaxUint64)
 
-func eventFromDataTransfer(event datatransfer.Event, channelState datatransfer.ChannelState) (Event, []interface{}) {
+func eventFromDataTransfer(event datatransfer.Event, channelState datatransfer.ChannelState, log zerolog.Logger) (Event, []interface{}) {
 	switch event.Code {
 	case datatransfer.DataReceived:
 		return EventBlocksReceived, []interface{}{channelState.Received()}
@@ -53,13 +54,13 @@ func eventFromDataTransfer(event datatransfer.Event, channelState datatransfer.C
 	case datatransfer.NewVoucherResult:
 		response, ok := deal.ResponseFromVoucherResult(channelState.LastVoucherResult())
 		if !ok {
-			fmt.Println("unexpected voucher result received:", channelState.LastVoucher().Type())
+			log.Warn().Str("type", string(channelState.LastVoucher().Type())).Msg("unexpected voucher result received")
 			return noEvent, nil
 		}
 
 		return eventFromDealStatus(response)
 	case datatransfer.Disconnected:
-		return EventDataTransferError, []interface{}{fmt.Errorf("deal data transfer stalled (peer hungup)")}
+		return EventDataTransferStalled, []interface{}{fmt.Errorf("deal data transfer stalled (peer hungup)")}
 	case datatransfer.Error:
 		if channelState.Message() == datatransfer.ErrRejected.Error() {
 			return EventDealRejected, []interface{}{"rejected for unknown reasons"}
@@ -74,8 +75,8 @@ func eventFromDataTransfer(event datatransfer.Event, channelState datatransfer.C
 // DataTransferSubscriber is the function called when an event occurs in a data
 // transfer initiated on the client -- it reads the voucher to verify this even occurred
 // in a storage market deal, then, based on the data transfer event that occurred, it dispatches
-// an event to the appropriate state machine
-func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
+// an event to the appropriate state machine. Failures to process events are reported to the logger.
+func DataTransferSubscriber(deals EventReceiver, log zerolog.Logger) datatransfer.Subscriber {
 	return func(event datatransfer.Event, channelState datatransfer.ChannelState) {
 		dealProposal, ok := deal.ProposalFromVoucher(channelState.Voucher())
 
@@ -88,7 +89,7 @@ func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
 			return
 		}
 
-		retrievalEvent, params := eventFromDataTransfer(event, channelState)
+		retrievalEvent, params := eventFromDataTransfer(event, channelState, log)
 		if retrievalEvent == noEvent {
 			return
 		}
@@ -96,12 +97,11 @@ func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
 		// data transfer events for progress do not affect deal state
 		err := deals.Send(dealProposal.ID, retrievalEvent, params...)
 		if err != nil {
-			fmt.Printf(
-				"processing dt client event %s for state %s: %v\n",
-				datatransfer.Events[event.Code],
-				datatransfer.Statuses[channelState.Status()],
-				err,
-			)
+			log.Error().
+				Err(err).
+				Str("event", datatransfer.Events[event.Code]).
+				Str("status", datatransfer.Statuses[channelState.Status()]).
+				Msg("processing dt client event")
 		}
 	}
 }
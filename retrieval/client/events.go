@@ -128,6 +128,13 @@ const (
 	// EventProviderErrored happens when we receive a status in response voucher
 	// telling us something went wrong on the provider side but they don't know what (500)
 	EventProviderErrored
+
+	// EventDataTransferStalled happens when we lose the connection with the provider during a transfer.
+	// The deal keeps its state until the transfer is restarted.
+	EventDataTransferStalled
+
+	// EventRestart happens when the data transfer of an interrupted deal is reopened
+	EventRestart
 )
 
 // Events is a human readable map of client event name -> event description
@@ -169,4 +176,6 @@ var Events = map[Event]string{
 	EventCancel:                        "ClientEventCancel",
 	EventWaitForLastBlocks:             "ClientEventWaitForLastBlocks",
 	EventProviderErrored:               "ClientEventProviderErrored",
+	EventDataTransferStalled:           "ClientEventDataTransferStalled",
+	EventRestart:                       "ClientEventRestart",
 }
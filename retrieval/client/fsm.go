@@ -13,7 +13,7 @@ import (
 	"github.com/ipfs/go-cid"
 	peer "github.com/libp2p/go-libp2p-peer"
 
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval/deal"
 )
 
@@ -183,6 +183,21 @@ var FSMEvents = fsm.Events{
 			return nil
 		}),
 
+	// Interrupted transfers wait for the data transfer channel to be restarted. Restarting runs the
+	// handler of the current state again in case the interruption happened while it was running.
+	fsm.Event(EventDataTransferStalled).
+		FromAny().ToJustRecord().
+		Action(func(ds *deal.ClientState, err error) error {
+			ds.Message = err.Error()
+			return nil
+		}),
+	fsm.Event(EventRestart).
+		FromAny().ToNoChange().
+		Action(func(ds *deal.ClientState) error {
+			ds.Message = ""
+			return nil
+		}),
+
 	// Receiving requests for payment
 	fsm.Event(EventLastPaymentRequested).
 		FromMany(
@@ -382,7 +397,9 @@ var StateEntryFuncs = fsm.StateEntryFuncs{
 // DealEnvironment is a bridge to the environment a client deal is executing in.
 // It provides access to relevant functionality on the retrieval client
 type DealEnvironment interface {
-	Payments() payments.Manager
+	Payments() paychmgr.Manager
+	// ReservedChannel draws the funds of a deal from funds already added to the channel for several deals
+	ReservedChannel(from, to address.Address, amt abi.TokenAmount) (*paychmgr.ChannelResponse, bool)
 	OpenDataTransfer(ctx context.Context, to peer.ID, proposal *deal.Proposal) (datatransfer.ChannelID, error)
 	SendDataTransferVoucher(context.Context, datatransfer.ChannelID, *deal.Payment) error
 	CloseDataTransfer(context.Context, datatransfer.ChannelID) error
@@ -403,10 +420,16 @@ func SetupPaymentChannelStart(ctx fsm.Context, environment DealEnvironment, ds d
 	if ds.TotalFunds.IsZero() {
 		return ctx.Trigger(EventPaymentChannelSkip)
 	}
-	// We may already have a payment channel ready to go otherwise the state machine will wait for it
-	res, err := environment.Payments().GetChannel(ctx.Context(), ds.ClientWallet, ds.MinerWallet, ds.TotalFunds)
-	if err != nil {
-		return ctx.Trigger(EventPaymentChannelErrored, err)
+	// Funds may be reserved in the channel already in which case waiting for the message which added
+	// them returns right away
+	res, ok := environment.ReservedChannel(ds.ClientWallet, ds.MinerWallet, ds.TotalFunds)
+	if !ok {
+		var err error
+		// We may already have a payment channel ready to go otherwise the state machine will wait for it
+		res, err = environment.Payments().GetChannel(ctx.Context(), ds.ClientWallet, ds.MinerWallet, ds.TotalFunds)
+		if err != nil {
+			return ctx.Trigger(EventPaymentChannelErrored, err)
+		}
 	}
 
 	if res.Channel == address.Undef {
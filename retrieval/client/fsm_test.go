@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"errors"
 	"math/rand"
 	"testing"
 
@@ -15,7 +16,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	"github.com/stretchr/testify/require"
 
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval/deal"
 )
 
@@ -32,13 +33,47 @@ func TestClientFSM(t *testing.T) {
 		require.NoError(t, err)
 		fsmCtx.ReplayEvents(t, dealState)
 	})
+
+	t.Run("interrupted transfers wait for a restart", func(t *testing.T) {
+		dealState := makeClientDealState(deal.StatusOngoing)
+		fsmCtx := fsmtest.NewTestContext(ctx, eventMachine)
+		err := fsmCtx.Trigger(EventDataTransferStalled, errors.New("peer hung up"))
+		require.NoError(t, err)
+		fsmCtx.ReplayEvents(t, dealState)
+		require.Equal(t, deal.StatusOngoing, dealState.Status)
+		require.Equal(t, "peer hung up", dealState.Message)
+
+		fsmCtx = fsmtest.NewTestContext(ctx, eventMachine)
+		err = fsmCtx.Trigger(EventRestart)
+		require.NoError(t, err)
+		fsmCtx.ReplayEvents(t, dealState)
+		require.Equal(t, deal.StatusOngoing, dealState.Status)
+		require.Equal(t, "", dealState.Message)
+	})
+
+	t.Run("reserved funds are not added to the channel again", func(t *testing.T) {
+		dealState := makeClientDealState(deal.StatusAccepted)
+		sentinel := testnet.GenerateCids(1)[0]
+		// Without payments manager the test panics if we try to add funds
+		environment := &mockClientEnvironment{
+			reserved: &paychmgr.ChannelResponse{Channel: address.TestAddress, WaitSentinel: sentinel},
+		}
+		fsmCtx := fsmtest.NewTestContext(ctx, eventMachine)
+		err := SetupPaymentChannelStart(fsmCtx, environment, *dealState)
+		require.NoError(t, err)
+		fsmCtx.ReplayEvents(t, dealState)
+		require.Equal(t, deal.StatusPaymentChannelAddingInitialFunds, dealState.Status)
+		require.Equal(t, address.TestAddress, dealState.PaymentInfo.PayCh)
+		require.Equal(t, sentinel, *dealState.WaitMsgCID)
+	})
 }
 
 type mockClientEnvironment struct {
 	OpenDataTransferError        error
 	SendDataTransferVoucherError error
 	CloseDataTransferError       error
-	payments                     payments.Manager
+	payments                     paychmgr.Manager
+	reserved                     *paychmgr.ChannelResponse
 }
 
 func (e *mockClientEnvironment) OpenDataTransfer(ctx context.Context, to peer.ID, proposal *deal.Proposal) (datatransfer.ChannelID, error) {
@@ -53,10 +88,14 @@ func (e *mockClientEnvironment) CloseDataTransfer(_ context.Context, _ datatrans
 	return e.CloseDataTransferError
 }
 
-func (e *mockClientEnvironment) Payments() payments.Manager {
+func (e *mockClientEnvironment) Payments() paychmgr.Manager {
 	return e.payments
 }
 
+func (e *mockClientEnvironment) ReservedChannel(from, to address.Address, amt abi.TokenAmount) (*paychmgr.ChannelResponse, bool) {
+	return e.reserved, e.reserved != nil
+}
+
 func makeClientDealState(status deal.Status) *deal.ClientState {
 	var defaultTotalFunds = abi.NewTokenAmount(4000000)
 	var defaultCurrentInterval = uint64(1000)
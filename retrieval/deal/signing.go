@@ -0,0 +1,69 @@
+package deal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ErrInvalidAskSignature is returned when a query response isn't signed by the provider who sent it
+var ErrInvalidAskSignature = errors.New("invalid ask signature")
+
+// ErrAskExpired is returned when a query response is past its expiry
+var ErrAskExpired = errors.New("ask expired")
+
+// signingBytes returns the bytes the provider signs
+func (qr QueryResponse) signingBytes() ([]byte, error) {
+	qr.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := qr.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign signs the query response with the key of the provider
+func (qr *QueryResponse) Sign(key crypto.PrivKey) error {
+	b, err := qr.signingBytes()
+	if err != nil {
+		return err
+	}
+	qr.Signature, err = key.Sign(b)
+	return err
+}
+
+// Verify checks the query response was signed by the given provider. The public key must be inlined
+// in the peer ID or given.
+func (qr QueryResponse) Verify(p peer.ID, pub crypto.PubKey) error {
+	if p == "" || len(qr.Signature) == 0 {
+		return ErrInvalidAskSignature
+	}
+	if pub == nil {
+		var err error
+		pub, err = p.ExtractPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidAskSignature, err)
+		}
+	}
+	if !p.MatchesPublicKey(pub) {
+		return ErrInvalidAskSignature
+	}
+	b, err := qr.signingBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(b, qr.Signature)
+	if err != nil || !ok {
+		return ErrInvalidAskSignature
+	}
+	return nil
+}
+
+// Expired returns whether the offer is stale at the given time
+func (qr QueryResponse) Expired(now time.Time) bool {
+	return qr.Expiry > 0 && uint64(now.Unix()) >= qr.Expiry
+}
@@ -18,7 +18,7 @@ import (
 	cbg "github.com/whyrusleeping/cbor-gen"
 )
 
-//go:generate cbor-gen-for --map-encoding QueryParams Query QueryResponse Proposal Response Params Payment ClientState ProviderState PaymentInfo
+//go:generate cbor-gen-for --map-encoding QueryParams Query QueryResponse QueryResponseV0 Proposal Response Params Payment ClientState ProviderState PaymentInfo
 
 // QueryParams - indicate what specific information about a piece that a retrieval
 // client is interested in, as well as specific parameters the client is seeking
@@ -84,6 +84,12 @@ type QueryResponse struct {
 	MaxPaymentIntervalIncrease uint64
 	Message                    string
 	UnsealPrice                abi.TokenAmount
+	// Peers are the p2p addresses of other members of the region so clients can discover more of them
+	Peers []string
+	// Expiry is the unix time in seconds after which the offer is stale. Zero never expires.
+	Expiry uint64
+	// Signature of the provider over all the other fields so intermediaries cannot alter the offer
+	Signature []byte
 }
 
 // PieceRetrievalPrice is the total price to retrieve the piece (size * MinPricePerByte + UnsealedPrice)
@@ -91,6 +97,51 @@ func (qr QueryResponse) PieceRetrievalPrice() abi.TokenAmount {
 	return big.Add(big.Mul(qr.MinPricePerByte, abi.NewTokenAmount(int64(qr.Size))), qr.UnsealPrice)
 }
 
+// V0 returns the response in the encoding of the first pop query protocol and lotus providers.
+// Peers, expiry and signature are dropped.
+func (qr QueryResponse) V0() QueryResponseV0 {
+	return QueryResponseV0{
+		Status:                     qr.Status,
+		PieceCIDFound:              qr.PieceCIDFound,
+		Size:                       qr.Size,
+		PaymentAddress:             qr.PaymentAddress,
+		MinPricePerByte:            qr.MinPricePerByte,
+		MaxPaymentInterval:         qr.MaxPaymentInterval,
+		MaxPaymentIntervalIncrease: qr.MaxPaymentIntervalIncrease,
+		Message:                    qr.Message,
+		UnsealPrice:                qr.UnsealPrice,
+	}
+}
+
+// QueryResponseV0 is a query response without peers, expiry nor signature as sent over the first
+// pop query protocol and by lotus providers
+type QueryResponseV0 struct {
+	Status                     QueryResponseStatus
+	PieceCIDFound              QueryItemStatus
+	Size                       uint64
+	PaymentAddress             address.Address
+	MinPricePerByte            abi.TokenAmount
+	MaxPaymentInterval         uint64
+	MaxPaymentIntervalIncrease uint64
+	Message                    string
+	UnsealPrice                abi.TokenAmount
+}
+
+// QueryResponse returns the fields of the response in the current version. It is unsigned.
+func (qr QueryResponseV0) QueryResponse() QueryResponse {
+	return QueryResponse{
+		Status:                     qr.Status,
+		PieceCIDFound:              qr.PieceCIDFound,
+		Size:                       qr.Size,
+		PaymentAddress:             qr.PaymentAddress,
+		MinPricePerByte:            qr.MinPricePerByte,
+		MaxPaymentInterval:         qr.MaxPaymentInterval,
+		MaxPaymentIntervalIncrease: qr.MaxPaymentIntervalIncrease,
+		Message:                    qr.Message,
+		UnsealPrice:                qr.UnsealPrice,
+	}
+}
+
 // Offer is the conditions under which a provider is willing to approve a transfer
 type Offer struct {
 	PeerID   peer.ID
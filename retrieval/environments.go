@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/filecoin-project/go-address"
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-fil-markets/shared"
 	"github.com/filecoin-project/go-multistore"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
 	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
@@ -18,7 +21,7 @@ import (
 	peer "github.com/libp2p/go-libp2p-peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
 
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
 	"github.com/myelnet/pop/retrieval/provider"
@@ -58,10 +61,14 @@ type clientDealEnvironment struct {
 	c *Client
 }
 
-func (cde *clientDealEnvironment) Payments() payments.Manager {
+func (cde *clientDealEnvironment) Payments() paychmgr.Manager {
 	return cde.c.pay
 }
 
+func (cde *clientDealEnvironment) ReservedChannel(from, to address.Address, amt abi.TokenAmount) (*paychmgr.ChannelResponse, bool) {
+	return cde.c.reservedChannel(from, to, amt)
+}
+
 // AllSelector selects everything TODO: ipld sub module
 func AllSelector() ipld.Node {
 	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
@@ -108,9 +115,14 @@ type providerValidationEnvironment struct {
 	p *Provider
 }
 
-// CheckDealParams verifies the given deal params are acceptable
+// CheckDealParams verifies the given deal params are acceptable. Retrievals free under our policy
+// skip the price checks.
 func (pve *providerValidationEnvironment) CheckDealParams(ds deal.ProviderState) error {
 	ask := pve.p.GetAsk(ds.Receiver)
+	if pve.p.Policy().Free(ds.Receiver, ds.PayloadCID) {
+		ask.MinPricePerByte = big.Zero()
+		ask.UnsealPrice = big.Zero()
+	}
 	if ds.PricePerByte.LessThan(ask.MinPricePerByte) {
 		return errors.New("price per byte too low")
 	}
@@ -120,11 +132,19 @@ func (pve *providerValidationEnvironment) CheckDealParams(ds deal.ProviderState)
 	if ds.PaymentIntervalIncrease > ask.MaxPaymentIntervalIncrease {
 		return errors.New("payment interval increase too large")
 	}
+	if !ask.UnsealPrice.Nil() && ask.UnsealPrice.GreaterThan(big.Zero()) &&
+		(ds.UnsealPrice.Nil() || ds.UnsealPrice.LessThan(ask.UnsealPrice)) {
+		return errors.New("unseal price too low")
+	}
 	return nil
 }
 
-// RunDealDecisioningLogic runs custom deal decision logic to decide if a deal is accepted, if present
+// RunDealDecisioningLogic rejects deals from peers over their daily quota or while we upload at our
+// maximum rate
 func (pve *providerValidationEnvironment) RunDealDecisioningLogic(ctx context.Context, state deal.ProviderState) (bool, string, error) {
+	if err := pve.p.bandwidth.check(state.Receiver); err != nil {
+		return false, err.Error(), nil
+	}
 	return true, "", nil
 }
 
@@ -154,7 +174,7 @@ type providerRevalidatorEnvironment struct {
 	p *Provider
 }
 
-func (pre *providerRevalidatorEnvironment) Payments() payments.Manager {
+func (pre *providerRevalidatorEnvironment) Payments() paychmgr.Manager {
 	return pre.p.pay
 }
 
@@ -162,6 +182,10 @@ func (pre *providerRevalidatorEnvironment) SendEvent(dealID deal.ProviderDealIde
 	return pre.p.stateMachines.Send(dealID, evt, args...)
 }
 
+func (pre *providerRevalidatorEnvironment) SentBytes(k peer.ID, n uint64) {
+	pre.p.bandwidth.sent(k, n)
+}
+
 func (pre *providerRevalidatorEnvironment) Get(dealID deal.ProviderDealIdentifier) (deal.ProviderState, error) {
 	var state deal.ProviderState
 	err := pre.p.stateMachines.GetSync(context.TODO(), dealID, &state)
@@ -2,28 +2,48 @@ package retrieval
 
 import (
 	"context"
-	"fmt"
+	"expvar"
+	"time"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
 	"github.com/ipld/go-ipld-prime"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/myelnet/pop/internal/utils"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog"
 )
 
+// StoreConfigFailures counts how many times we failed to configure a store for a transfer.
+// Transfers running without their store write blocks in the wrong place so this should stay at 0.
+var StoreConfigFailures = expvar.NewInt("retrieval_store_config_failures")
+
 // StoreGetter retrieves the store for a given proposal cid
 type StoreGetter interface {
 	Get(otherPeer peer.ID, dealID deal.ID) (*multistore.Store, error)
 }
 
+// LoaderCache is optionally implemented by store getters able to serve the blocks of some content
+// without reading the store, for instance from memory
+type LoaderCache interface {
+	CachedLoader(root cid.Cid, fallback ipld.Loader) ipld.Loader
+}
+
 // StoreConfigurableTransport defines the methods needed to
 // configure a data transfer transport use a unique store for a given request
 type StoreConfigurableTransport interface {
 	UseStore(datatransfer.ChannelID, ipld.Loader, ipld.Storer) error
 }
 
-// TransportConfigurer configurers the graphsync transport to use a custom blockstore per deal
-func TransportConfigurer(thisPeer peer.ID, storeGetter StoreGetter) datatransfer.TransportConfigurer {
+// TransportConfigurer configurers the graphsync transport to use a custom blockstore per deal.
+// Failures are reported to the logger.
+func TransportConfigurer(thisPeer peer.ID, storeGetter StoreGetter, log zerolog.Logger) datatransfer.TransportConfigurer {
+	warner := utils.NewChannelWarner(log, time.Minute)
+	warn := func(chid datatransfer.ChannelID, err error) {
+		StoreConfigFailures.Add(1)
+		warner.Warn(chid, "attempting to configure data store", err)
+	}
 	return func(channelID datatransfer.ChannelID, voucher datatransfer.Voucher, transport datatransfer.Transport) {
 		dealProposal, ok := deal.ProposalFromVoucher(voucher)
 		if !ok {
@@ -36,15 +56,19 @@ func TransportConfigurer(thisPeer peer.ID, storeGetter StoreGetter) datatransfer
 		otherPeer := channelID.OtherParty(thisPeer)
 		store, err := storeGetter.Get(otherPeer, dealProposal.ID)
 		if err != nil {
-			fmt.Println("attempting to configure data store:", err)
+			warn(channelID, err)
 			return
 		}
 		if store == nil {
 			return
 		}
-		err = gsTransport.UseStore(channelID, store.Loader, store.Storer)
+		loader := store.Loader
+		if lc, ok := storeGetter.(LoaderCache); ok {
+			loader = lc.CachedLoader(dealProposal.PayloadCID, loader)
+		}
+		err = gsTransport.UseStore(channelID, loader, store.Storer)
 		if err != nil {
-			fmt.Println("attempting to configure data store:", err)
+			warn(channelID, err)
 		}
 	}
 }
@@ -69,3 +93,11 @@ func (dsg *dualStoreGetter) Get(pid peer.ID, did deal.ID) (*multistore.Store, er
 	}
 	return nil, err
 }
+
+// CachedLoader lets the store ID getter of the provider serve hot content from memory
+func (dsg *dualStoreGetter) CachedLoader(root cid.Cid, fallback ipld.Loader) ipld.Loader {
+	if lc, ok := dsg.p.storeIDGetter.(LoaderCache); ok {
+		return lc.CachedLoader(root, fallback)
+	}
+	return fallback
+}
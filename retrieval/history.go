@@ -0,0 +1,190 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/rs/zerolog"
+
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/retrieval/provider"
+)
+
+// DealDirection tells whether we served or retrieved the content of a deal
+type DealDirection string
+
+const (
+	// DealInbound is a deal a client proposed to us as provider
+	DealInbound DealDirection = "inbound"
+	// DealOutbound is a deal we proposed to a provider as client
+	DealOutbound DealDirection = "outbound"
+)
+
+// DealRecord is a retrieval deal once it is over
+type DealRecord struct {
+	Direction DealDirection
+	ID        deal.ID
+	// Peer is the client of inbound deals and the provider of outbound deals
+	Peer       peer.ID
+	PayloadCID cid.Cid
+	// Bytes is how many bytes we sent for inbound deals and received for outbound deals
+	Bytes uint64
+	// Paid is what the client paid us for inbound deals and what we paid for outbound deals
+	Paid abi.TokenAmount
+	// Duration is zero when the node restarted during the deal
+	Duration time.Duration
+	// Status is the final status of the deal i.e. completed, cancelled, errored or rejected
+	Status  deal.Status
+	Message string
+	End     time.Time
+}
+
+// History persists a record of every retrieval deal we served or made so operators can audit
+// their earnings and spending
+type History struct {
+	ds  datastore.Batching
+	log zerolog.Logger
+
+	mu     sync.Mutex
+	starts map[string]time.Time
+}
+
+// NewHistory creates a deal history persisted in the datastore. Failures to record a deal are reported
+// to the logger.
+func NewHistory(ds datastore.Batching, logger zerolog.Logger) *History {
+	return &History{
+		ds:     namespace.Wrap(ds, datastore.NewKey("/retrieval/history")),
+		log:    logger,
+		starts: make(map[string]time.Time),
+	}
+}
+
+func historyKey(dir DealDirection, p peer.ID, id deal.ID) datastore.Key {
+	return datastore.NewKey(string(dir)).ChildString(p.String()).ChildString(id.String())
+}
+
+// track notes when a deal started then records it once it reached a final status
+func (h *History) track(rec DealRecord, final bool) {
+	key := historyKey(rec.Direction, rec.Peer, rec.ID)
+	h.mu.Lock()
+	start, ok := h.starts[key.String()]
+	if !ok && !final {
+		h.starts[key.String()] = rec.End
+	}
+	if final {
+		delete(h.starts, key.String())
+	}
+	h.mu.Unlock()
+	if !final {
+		return
+	}
+	if ok {
+		rec.Duration = rec.End.Sub(start)
+	}
+	if rec.Paid.Nil() {
+		rec.Paid = big.Zero()
+	}
+	if err := h.record(key, rec); err != nil {
+		h.log.Error().Err(err).Msg("failed to record retrieval deal")
+	}
+}
+
+// record persists a deal unless it was already recorded
+func (h *History) record(key datastore.Key, rec DealRecord) error {
+	if has, err := h.ds.Has(key); err != nil || has {
+		return err
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return h.ds.Put(key, b)
+}
+
+// ListDeals returns the deals which ended between from and to, oldest first. Zero times leave the
+// range open.
+func (h *History) ListDeals(from, to time.Time) ([]DealRecord, error) {
+	res, err := h.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	var recs []DealRecord
+	for _, e := range entries {
+		var rec DealRecord
+		if err := json.Unmarshal(e.Value, &rec); err != nil {
+			return nil, err
+		}
+		if (!from.IsZero() && rec.End.Before(from)) || (!to.IsZero() && rec.End.After(to)) {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].End.Before(recs[j].End)
+	})
+	return recs, nil
+}
+
+// clientFinal is whether a client deal cannot change anymore
+func clientFinal(s deal.Status) bool {
+	for _, f := range client.FinalityStates {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+// providerFinal is whether a provider deal cannot change anymore
+func providerFinal(s deal.Status) bool {
+	for _, f := range provider.FinalityStates {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+// recordClientDeals records the deals we make as client
+func (h *History) recordClientDeals(event client.Event, state deal.ClientState) {
+	h.track(DealRecord{
+		Direction:  DealOutbound,
+		ID:         state.ID,
+		Peer:       state.Sender,
+		PayloadCID: state.PayloadCID,
+		Bytes:      state.TotalReceived,
+		Paid:       state.FundsSpent,
+		Status:     state.Status,
+		Message:    state.Message,
+		End:        time.Now(),
+	}, clientFinal(state.Status))
+}
+
+// recordProviderDeals records the deals we serve as provider
+func (h *History) recordProviderDeals(event provider.Event, state deal.ProviderState) {
+	h.track(DealRecord{
+		Direction:  DealInbound,
+		ID:         state.ID,
+		Peer:       state.Receiver,
+		PayloadCID: state.PayloadCID,
+		Bytes:      state.TotalSent,
+		Paid:       state.FundsReceived,
+		Status:     state.Status,
+		Message:    state.Message,
+		End:        time.Now(),
+	}, providerFinal(state.Status))
+}
@@ -0,0 +1,79 @@
+package retrieval
+
+import (
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/myelnet/pop/retrieval/client"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/retrieval/provider"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	h := NewHistory(ds, zerolog.Nop())
+
+	root := blockGen.Next().Cid()
+	p := test.RandPeerIDFatal(t)
+
+	start := time.Now()
+	cs := deal.ClientState{
+		Proposal:      deal.Proposal{PayloadCID: root, ID: 1},
+		Sender:        p,
+		Status:        deal.StatusNew,
+		FundsSpent:    abi.NewTokenAmount(0),
+		TotalReceived: 0,
+	}
+	h.recordClientDeals(client.EventOpen, cs)
+	recs, err := h.ListDeals(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+
+	time.Sleep(10 * time.Millisecond)
+	cs.Status = deal.StatusCompleted
+	cs.TotalReceived = 1024
+	cs.FundsSpent = abi.NewTokenAmount(2048)
+	h.recordClientDeals(client.EventComplete, cs)
+	// Deals are only recorded once
+	h.recordClientDeals(client.EventComplete, cs)
+
+	ps := deal.ProviderState{
+		Proposal: deal.Proposal{PayloadCID: root, ID: 1},
+		Receiver: test.RandPeerIDFatal(t),
+		Status:   deal.StatusErrored,
+		Message:  "transfer failed",
+	}
+	h.recordProviderDeals(provider.EventDataTransferError, ps)
+
+	recs, err = h.ListDeals(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	require.Equal(t, DealOutbound, recs[0].Direction)
+	require.Equal(t, uint64(1024), recs[0].Bytes)
+	require.Equal(t, "2048", recs[0].Paid.String())
+	require.True(t, recs[0].Duration >= 10*time.Millisecond)
+	require.Equal(t, deal.StatusCompleted, recs[0].Status)
+	require.Equal(t, DealInbound, recs[1].Direction)
+	require.Equal(t, "0", recs[1].Paid.String())
+	// We never saw the provider deal start
+	require.Equal(t, time.Duration(0), recs[1].Duration)
+
+	// Records are persisted
+	h = NewHistory(ds, zerolog.Nop())
+	recs, err = h.ListDeals(start.Add(-time.Minute), time.Now())
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+
+	recs, err = h.ListDeals(time.Now(), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+	recs, err = h.ListDeals(time.Time{}, start.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+}
@@ -0,0 +1,181 @@
+package retrieval
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/stretchr/testify/require"
+	cbg "github.com/whyrusleeping/cbor-gen"
+)
+
+// transcript is a recording of the messages exchanged between a client and a provider
+type transcript struct {
+	Client      string
+	Description string
+	Messages    []struct {
+		Protocol string
+		From     string
+		Type     string
+		CBOR     string
+	}
+}
+
+type cborMessage interface {
+	cbg.CBORMarshaler
+	cbg.CBORUnmarshaler
+}
+
+func newMessage(typ string, proto string) (cborMessage, error) {
+	switch typ {
+	case "Query":
+		return &deal.Query{}, nil
+	case "QueryResponse":
+		// Only the latest query protocol sends signed responses
+		if protocol.ID(proto) != PopQueryProtocolID {
+			return &deal.QueryResponseV0{}, nil
+		}
+		return &deal.QueryResponse{}, nil
+	case "Proposal":
+		return &deal.Proposal{}, nil
+	case "Response":
+		return &deal.Response{}, nil
+	}
+	return nil, fmt.Errorf("unknown message type %s", typ)
+}
+
+func loadTranscripts(t *testing.T) map[string]transcript {
+	files, err := filepath.Glob(filepath.Join("testdata", "interop", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, files)
+
+	trs := make(map[string]transcript)
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		require.NoError(t, err)
+		var tr transcript
+		require.NoError(t, json.Unmarshal(b, &tr), f)
+		trs[filepath.Base(f)] = tr
+	}
+	return trs
+}
+
+// replayHandler answers queries with the responses from a transcript
+type replayHandler struct {
+	t         *testing.T
+	responses chan deal.QueryResponse
+	queries   chan deal.Query
+}
+
+func (h *replayHandler) HandleQueryStream(stream QueryStream) {
+	defer stream.Close()
+
+	query, err := stream.ReadQuery()
+	require.NoError(h.t, err)
+	h.queries <- query
+
+	err = stream.WriteQueryResponse(<-h.responses)
+	require.NoError(h.t, err)
+}
+
+func TestInteropTranscripts(t *testing.T) {
+	for name, tr := range loadTranscripts(t) {
+		tr := tr
+		t.Run(name, func(t *testing.T) {
+			var raw [][]byte
+			var msgs []cborMessage
+			for i, m := range tr.Messages {
+				b, err := hex.DecodeString(m.CBOR)
+				require.NoError(t, err, "message %d", i)
+
+				msg, err := newMessage(m.Type, m.Protocol)
+				require.NoError(t, err, "message %d", i)
+				require.NoError(t, msg.UnmarshalCBOR(bytes.NewReader(b)), "message %d", i)
+
+				// Our encoding must not drift from the recording
+				buf := new(bytes.Buffer)
+				require.NoError(t, msg.MarshalCBOR(buf))
+				require.Equal(t, m.CBOR, hex.EncodeToString(buf.Bytes()), "message %d", i)
+
+				switch v := msg.(type) {
+				case *deal.Query:
+					require.True(t, v.PayloadCID.Defined(), "message %d", i)
+				case *deal.Proposal:
+					require.True(t, v.PayloadCID.Defined(), "message %d", i)
+					if m.From == "client" && v.SelectorSpecified() {
+						nd, err := DecodeNode(v.Selector)
+						require.NoError(t, err, "message %d", i)
+						_, err = selector.ParseSelector(nd)
+						require.NoError(t, err, "message %d", i)
+					}
+				}
+				raw = append(raw, b)
+				msgs = append(msgs, msg)
+			}
+
+			replayQueries(t, tr, raw, msgs)
+		})
+	}
+}
+
+// replayQueries sends the recorded queries to a provider query handler over a libp2p stream and
+// checks it writes back the recorded responses byte for byte
+func replayQueries(t *testing.T, tr transcript, raw [][]byte, msgs []cborMessage) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	cnode := testutil.NewTestNode(mn, t)
+	pnode := testutil.NewTestNode(mn, t)
+
+	handler := &replayHandler{
+		t:         t,
+		responses: make(chan deal.QueryResponse, 1),
+		queries:   make(chan deal.Query, 1),
+	}
+	pnet := NewQueryNetwork(pnode.Host)
+	require.NoError(t, pnet.SetDelegate(handler))
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+
+	for i := 0; i < len(tr.Messages); i++ {
+		if tr.Messages[i].Type != "Query" {
+			continue
+		}
+		require.True(t, i+1 < len(tr.Messages) && tr.Messages[i+1].Type == "QueryResponse",
+			"query %d is not followed by a response", i)
+
+		s, err := cnode.Host.NewStream(ctx, pnode.Host.ID(), protocol.ID(tr.Messages[i].Protocol))
+		require.NoError(t, err)
+
+		switch resp := msgs[i+1].(type) {
+		case *deal.QueryResponse:
+			handler.responses <- *resp
+		case *deal.QueryResponseV0:
+			handler.responses <- resp.QueryResponse()
+		}
+		_, err = s.Write(raw[i])
+		require.NoError(t, err)
+
+		q := <-handler.queries
+		require.Equal(t, msgs[i].(*deal.Query).PayloadCID, q.PayloadCID)
+
+		resp := make([]byte, len(raw[i+1]))
+		_, err = io.ReadFull(s, resp)
+		require.NoError(t, err)
+		require.Equal(t, raw[i+1], resp)
+
+		require.NoError(t, s.Close())
+	}
+}
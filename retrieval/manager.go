@@ -2,7 +2,10 @@ package retrieval
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	datatransfer "github.com/filecoin-project/go-data-transfer"
@@ -16,8 +19,9 @@ import (
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
 	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/rs/zerolog"
 
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
 	"github.com/myelnet/pop/retrieval/provider"
@@ -31,6 +35,7 @@ type Unsubscribe func()
 type Manager interface {
 	Client() *Client
 	Provider() *Provider
+	History() *History
 }
 
 // StoreIDGetter is an interface required for finding the store associated with the content to provide
@@ -42,6 +47,7 @@ type StoreIDGetter interface {
 type Retrieval struct {
 	c *Client
 	p *Provider
+	h *History
 }
 
 // Client to access our Retriever implementation
@@ -54,6 +60,24 @@ func (r *Retrieval) Provider() *Provider {
 	return r.p
 }
 
+// History to list the deals we served and made
+func (r *Retrieval) History() *History {
+	return r.h
+}
+
+// DefaultRestartDelay is how long we wait for a provider to come back before restarting an interrupted
+// transfer. Each new attempt waits one more delay.
+const DefaultRestartDelay = 10 * time.Second
+
+// DefaultRestartAttempts is how many times we try to restart an interrupted transfer before failing the deal
+const DefaultRestartAttempts = 3
+
+// ErrDealTerminated is returned when restarting a deal which already completed, failed or was cancelled
+var ErrDealTerminated = errors.New("retrieval deal is terminated")
+
+// ErrTransferNotStarted is returned when restarting a deal which never opened a data transfer channel
+var ErrTransferNotStarted = errors.New("retrieval deal has no data transfer to restart")
+
 // Client wraps all the client operations
 type Client struct {
 	multiStore    *multistore.MultiStore
@@ -61,7 +85,26 @@ type Client struct {
 	stateMachines fsm.Group
 	subscribers   *pubsub.PubSub
 	counter       *storedcounter.StoredCounter
-	pay           payments.Manager
+	pay           paychmgr.Manager
+	log           zerolog.Logger
+
+	restartDelay    time.Duration
+	restartAttempts int
+	rmu             sync.Mutex
+	restarting      map[deal.ID]struct{}
+
+	resmu        sync.Mutex
+	reservations map[string]*reservation // funds reserved in payment channels by client and provider address
+}
+
+// reservation is funds we added to a payment channel once for several deals with the same provider
+type reservation struct {
+	channel   paychmgr.ChannelResponse
+	remaining abi.TokenAmount
+}
+
+func reservationKey(from, to address.Address) string {
+	return from.String() + "-" + to.String()
 }
 
 func (c *Client) notifySubscribers(eventName fsm.EventName, state fsm.StateType) {
@@ -81,9 +124,12 @@ type Provider struct {
 	subscribers      *pubsub.PubSub
 	requestValidator *ProviderRequestValidator
 	revalidator      *ProviderRevalidator
-	pay              payments.Manager
+	pay              paychmgr.Manager
 	askStore         *AskStore
+	asks             *Asks
+	bandwidth        *bandwidth
 	storeIDGetter    StoreIDGetter
+	log              zerolog.Logger
 }
 
 // GetAsk returns the current deal parameters this provider accepts for a given peer
@@ -96,10 +142,15 @@ func (p *Provider) SetAsk(k peer.ID, ask deal.QueryResponse) {
 	err := p.askStore.SetAsk(k, ask)
 
 	if err != nil {
-		fmt.Printf("Error setting retrieval ask: %v\v", err)
+		p.log.Error().Err(err).Msg("failed to set retrieval ask")
 	}
 }
 
+// Asks returns the prices we offer to clients querying our content
+func (p *Provider) Asks() *Asks {
+	return p.asks
+}
+
 func (p *Provider) notifySubscribers(eventName fsm.EventName, state fsm.StateType) {
 	evt := eventName.(provider.Event)
 	ds := state.(deal.ProviderState)
@@ -114,15 +165,16 @@ func (p *Provider) SubscribeToEvents(subscriber provider.Subscriber) Unsubscribe
 	return Unsubscribe(p.subscribers.Subscribe(subscriber))
 }
 
-// New creates a new retrieval instance
+// New creates a new retrieval instance. Client and provider failures are reported to the logger.
 func New(
 	ctx context.Context,
 	ms *multistore.MultiStore,
 	ds datastore.Batching,
-	pay payments.Manager,
+	pay paychmgr.Manager,
 	dt datatransfer.Manager,
 	sg StoreIDGetter,
 	self peer.ID,
+	logger zerolog.Logger,
 ) (Manager, error) {
 	sc := storedcounter.New(ds, datastore.NewKey("/retrieval/deal-id"))
 	var err error
@@ -133,6 +185,12 @@ func New(
 		counter:      sc,
 		dataTransfer: dt,
 		pay:          pay,
+		log:          logger,
+
+		restartDelay:    DefaultRestartDelay,
+		restartAttempts: DefaultRestartAttempts,
+		restarting:      make(map[deal.ID]struct{}),
+		reservations:    make(map[string]*reservation),
 	}
 	c.stateMachines, err = fsm.New(namespace.Wrap(ds, datastore.NewKey("client-v0")), fsm.Parameters{
 		Environment:     &clientDealEnvironment{c},
@@ -155,6 +213,15 @@ func New(
 			asks: make(map[peer.ID]deal.QueryResponse),
 		},
 		storeIDGetter: sg,
+		log:           logger,
+	}
+	p.asks, err = NewAsks(ds)
+	if err != nil {
+		return nil, err
+	}
+	p.bandwidth, err = newBandwidth(ds, logger)
+	if err != nil {
+		return nil, err
 	}
 	p.stateMachines, err = fsm.New(namespace.Wrap(ds, datastore.NewKey("provider-v0")), fsm.Parameters{
 		Environment:     &providerDealEnvironment{p},
@@ -189,13 +256,19 @@ func New(
 	if err != nil {
 		return nil, err
 	}
-	tconfig := TransportConfigurer(self, &dualStoreGetter{c, p})
+	tconfig := TransportConfigurer(self, &dualStoreGetter{c, p}, logger)
 	err = dt.RegisterTransportConfigurer(&deal.Proposal{}, tconfig)
 	if err != nil {
 		return nil, err
 	}
-	dt.SubscribeToEvents(provider.DataTransferSubscriber(p.stateMachines))
-	dt.SubscribeToEvents(client.DataTransferSubscriber(c.stateMachines))
+	dt.SubscribeToEvents(provider.DataTransferSubscriber(p.stateMachines, logger))
+	dt.SubscribeToEvents(client.DataTransferSubscriber(c.stateMachines, logger))
+	c.SubscribeToEvents(c.restartStalled(ctx))
+
+	h := NewHistory(ds, logger)
+	c.SubscribeToEvents(h.recordClientDeals)
+	p.SubscribeToEvents(h.recordProviderDeals)
+	p.SubscribeToEvents(p.bandwidth.persistUsage)
 
 	// TODO: might want to use the cleanup function returned
 	SettlePaymentChannels(ctx, pay, p)
@@ -205,7 +278,7 @@ func New(
 		return nil, err
 	}
 
-	return &Retrieval{c, p}, nil
+	return &Retrieval{c, p, h}, nil
 }
 
 // Retrieve content
@@ -266,6 +339,68 @@ func (c *Client) Retrieve(
 	return dealState.ID, nil
 }
 
+// ReserveFunds adds funds to the payment channel with a provider once for several deals. The next deals
+// with the provider draw from the reserved funds until they run out instead of adding their own and
+// waiting for the message to land on chain.
+func (c *Client) ReserveFunds(ctx context.Context, from, to address.Address, amt abi.TokenAmount) error {
+	res, err := c.pay.GetChannel(ctx, from, to, amt)
+	if err != nil {
+		return err
+	}
+	ch, err := c.pay.WaitForChannel(ctx, res.WaitSentinel)
+	if err != nil {
+		return err
+	}
+	c.resmu.Lock()
+	defer c.resmu.Unlock()
+	key := reservationKey(from, to)
+	r, ok := c.reservations[key]
+	if !ok {
+		r = &reservation{remaining: big.Zero()}
+		c.reservations[key] = r
+	}
+	r.channel = paychmgr.ChannelResponse{Channel: ch, WaitSentinel: res.WaitSentinel}
+	r.remaining = big.Add(r.remaining, amt)
+	return nil
+}
+
+// ReservedFunds returns the funds which remain reserved for deals with a provider
+func (c *Client) ReservedFunds(from, to address.Address) abi.TokenAmount {
+	c.resmu.Lock()
+	defer c.resmu.Unlock()
+	if r, ok := c.reservations[reservationKey(from, to)]; ok {
+		return r.remaining
+	}
+	return big.Zero()
+}
+
+// ReleaseFunds stops deals with a provider from drawing from the funds we reserved and returns what
+// remained. The funds stay in the payment channel.
+func (c *Client) ReleaseFunds(from, to address.Address) abi.TokenAmount {
+	c.resmu.Lock()
+	defer c.resmu.Unlock()
+	key := reservationKey(from, to)
+	r, ok := c.reservations[key]
+	if !ok {
+		return big.Zero()
+	}
+	delete(c.reservations, key)
+	return r.remaining
+}
+
+// reservedChannel draws the funds of a deal from the funds reserved with its provider if there is enough
+func (c *Client) reservedChannel(from, to address.Address, amt abi.TokenAmount) (*paychmgr.ChannelResponse, bool) {
+	c.resmu.Lock()
+	defer c.resmu.Unlock()
+	r, ok := c.reservations[reservationKey(from, to)]
+	if !ok || r.remaining.LessThan(amt) {
+		return nil, false
+	}
+	r.remaining = big.Sub(r.remaining, amt)
+	res := r.channel
+	return &res, true
+}
+
 // SubscribeToEvents to listen to transfer state changes on the client side
 func (c *Client) SubscribeToEvents(subscriber client.Subscriber) Unsubscribe {
 	return Unsubscribe(c.subscribers.Subscribe(subscriber))
@@ -289,9 +424,107 @@ func (c *Client) TryRestartInsufficientFunds(chAddr address.Address) error {
 	return nil
 }
 
+// CancelDeal stops a deal and closes its data transfer channel
+func (c *Client) CancelDeal(id deal.ID) error {
+	var ds deal.ClientState
+	if err := c.stateMachines.Get(id).Get(&ds); err != nil {
+		return err
+	}
+	if c.stateMachines.IsTerminated(ds) {
+		return ErrDealTerminated
+	}
+	return c.stateMachines.Send(id, client.EventCancel)
+}
+
+// RestartDeal reopens the data transfer channel of an interrupted deal. The provider only sends the
+// blocks we did not receive yet.
+func (c *Client) RestartDeal(ctx context.Context, id deal.ID) error {
+	var ds deal.ClientState
+	if err := c.stateMachines.Get(id).Get(&ds); err != nil {
+		return err
+	}
+	if c.stateMachines.IsTerminated(ds) {
+		return ErrDealTerminated
+	}
+	if ds.ChannelID.Initiator == "" {
+		return ErrTransferNotStarted
+	}
+	if err := c.dataTransfer.RestartDataTransferChannel(ctx, ds.ChannelID); err != nil {
+		return err
+	}
+	return c.stateMachines.Send(id, client.EventRestart)
+}
+
+// ResumeDeals restarts the deals interrupted when the node stopped. Deals which never started their
+// transfer or fail to restart are errored. It returns the number of deals resumed.
+func (c *Client) ResumeDeals(ctx context.Context) (int, error) {
+	var deals []deal.ClientState
+	if err := c.stateMachines.List(&deals); err != nil {
+		return 0, err
+	}
+	resumed := 0
+	for _, d := range deals {
+		if c.stateMachines.IsTerminated(d) {
+			continue
+		}
+		err := c.RestartDeal(ctx, d.ID)
+		if err == nil {
+			resumed++
+			continue
+		}
+		c.log.Error().Err(err).Uint64("id", uint64(d.ID)).Msg("failed to resume retrieval")
+		if err := c.stateMachines.Send(d.ID, client.EventDataTransferError, fmt.Errorf("resuming after restart: %w", err)); err != nil {
+			return resumed, err
+		}
+	}
+	return resumed, nil
+}
+
+// restartStalled restarts the transfers interrupted by a disconnection once the provider had time to
+// come back. The deal fails if the provider is still unreachable after a few attempts.
+func (c *Client) restartStalled(ctx context.Context) client.Subscriber {
+	return func(event client.Event, state deal.ClientState) {
+		if event != client.EventDataTransferStalled {
+			return
+		}
+		c.rmu.Lock()
+		defer c.rmu.Unlock()
+		if _, ok := c.restarting[state.ID]; ok {
+			return
+		}
+		c.restarting[state.ID] = struct{}{}
+		go c.retryRestart(ctx, state.ID)
+	}
+}
+
+func (c *Client) retryRestart(ctx context.Context, id deal.ID) {
+	defer func() {
+		c.rmu.Lock()
+		delete(c.restarting, id)
+		c.rmu.Unlock()
+	}()
+	var err error
+	for i := 1; i <= c.restartAttempts; i++ {
+		select {
+		case <-time.After(time.Duration(i) * c.restartDelay):
+		case <-ctx.Done():
+			return
+		}
+		err = c.RestartDeal(ctx, id)
+		if err == nil || errors.Is(err, ErrDealTerminated) {
+			return
+		}
+		c.log.Debug().Err(err).Uint64("id", uint64(id)).Int("attempt", i).Msg("failed to restart retrieval")
+	}
+	err = c.stateMachines.Send(id, client.EventDataTransferError, fmt.Errorf("restarting stalled transfer: %w", err))
+	if err != nil {
+		c.log.Error().Err(err).Msg("failed to fail stalled retrieval")
+	}
+}
+
 // SettlePaymentChannels subscribes to provider deals and tries to settle payments after any transfer
 // gets into a final state
-func SettlePaymentChannels(ctx context.Context, pay payments.Manager, pro *Provider) Unsubscribe {
+func SettlePaymentChannels(ctx context.Context, pay paychmgr.Manager, pro *Provider) Unsubscribe {
 	return pro.SubscribeToEvents(func(event provider.Event, state deal.ProviderState) {
 		switch state.Status {
 		// In any of those cases we might be able to collect some funds
@@ -301,7 +534,7 @@ func SettlePaymentChannels(ctx context.Context, pay payments.Manager, pro *Provi
 			if state.PayCh != nil {
 				err := pay.Settle(ctx, *state.PayCh)
 				if err != nil {
-					fmt.Printf("settling payment channel: %v\n", err)
+					pro.log.Error().Err(err).Msg("settling payment channel")
 				}
 			}
 			return
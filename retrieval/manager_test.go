@@ -17,11 +17,12 @@ import (
 	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 
 	"github.com/myelnet/pop/filecoin"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/internal/testutil"
-	"github.com/myelnet/pop/payments"
 	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
 	"github.com/myelnet/pop/retrieval/provider"
@@ -30,13 +31,13 @@ import (
 var blockGen = blocksutil.NewBlockGenerator()
 
 type mockPayments struct {
-	chResponse *payments.ChannelResponse
+	chResponse *paychmgr.ChannelResponse
 	chAddr     address.Address
-	chFunds    *payments.AvailableFunds
+	chFunds    *paychmgr.AvailableFunds
 	lk         sync.Mutex
 }
 
-func (p *mockPayments) GetChannel(ctx context.Context, from, to address.Address, amt filecoin.BigInt) (*payments.ChannelResponse, error) {
+func (p *mockPayments) GetChannel(ctx context.Context, from, to address.Address, amt filecoin.BigInt) (*paychmgr.ChannelResponse, error) {
 	p.lk.Lock()
 	defer p.lk.Unlock()
 	p.chFunds.ConfirmedAmt = big.Add(p.chFunds.ConfirmedAmt, amt)
@@ -51,13 +52,13 @@ func (p *mockPayments) ListChannels() ([]address.Address, error) {
 	return nil, nil
 }
 
-func (p *mockPayments) GetChannelInfo(addr address.Address) (*payments.ChannelInfo, error) {
+func (p *mockPayments) GetChannelInfo(addr address.Address) (*paychmgr.ChannelInfo, error) {
 	return nil, nil
 }
 
-func (p *mockPayments) CreateVoucher(ctx context.Context, addr address.Address, amt filecoin.BigInt, lane uint64) (*payments.VoucherCreateResult, error) {
+func (p *mockPayments) CreateVoucher(ctx context.Context, addr address.Address, amt filecoin.BigInt, lane uint64) (*paychmgr.VoucherCreateResult, error) {
 	if amt.GreaterThan(p.chFunds.ConfirmedAmt) {
-		return &payments.VoucherCreateResult{
+		return &paychmgr.VoucherCreateResult{
 			Shortfall: big.Sub(amt, p.chFunds.ConfirmedAmt),
 		}, nil
 	}
@@ -71,7 +72,7 @@ func (p *mockPayments) CreateVoucher(ctx context.Context, addr address.Address,
 		Amount:      amt,
 		// Signature:      sig,
 	}
-	vouchRes := &payments.VoucherCreateResult{
+	vouchRes := &paychmgr.VoucherCreateResult{
 		Voucher:   vouch,
 		Shortfall: filecoin.NewInt(0),
 	}
@@ -86,11 +87,11 @@ func (p *mockPayments) AddVoucherInbound(ctx context.Context, addr address.Addre
 	return expectedAmount, nil
 }
 
-func (p *mockPayments) ChannelAvailableFunds(chAddr address.Address) (*payments.AvailableFunds, error) {
+func (p *mockPayments) ChannelAvailableFunds(chAddr address.Address) (*paychmgr.AvailableFunds, error) {
 	return p.chFunds, nil
 }
 
-func (p *mockPayments) SetChannelAvailableFunds(funds payments.AvailableFunds) {
+func (p *mockPayments) SetChannelAvailableFunds(funds paychmgr.AvailableFunds) {
 	p.lk.Lock()
 	defer p.lk.Unlock()
 	chFunds := addZeroesToAvailableFunds(funds)
@@ -119,14 +120,14 @@ func TestRetrieval(t *testing.T) {
 	testCases := []struct {
 		name           string
 		addFunds       bool
-		chFunds        payments.AvailableFunds
+		chFunds        paychmgr.AvailableFunds
 		free           bool
 		failValidation bool
 	}{
 		// BUG: Need to fix a graphsync issue for these tests to pass again
 		// {name: "Basic transfer"},
 		// {name: "Existing channel", addFunds: true},
-		// {name: "Shortfall", chFunds: payments.AvailableFunds{
+		// {name: "Shortfall", chFunds: paychmgr.AvailableFunds{
 		// 	ConfirmedAmt: abi.NewTokenAmount(-40100000),
 		// }},
 		{name: "Free transfer", free: true},
@@ -152,7 +153,7 @@ func TestRetrieval(t *testing.T) {
 			if testCase.addFunds {
 				chResAddr = chAddr
 			}
-			chResponse := &payments.ChannelResponse{
+			chResponse := &paychmgr.ChannelResponse{
 				Channel:      chResAddr,
 				WaitSentinel: blockGen.Next().Cid(),
 			}
@@ -166,7 +167,7 @@ func TestRetrieval(t *testing.T) {
 			}
 			// this is only needed on the provider side to find where content is stored
 			sidg1 := &mockStoreIDGetter{}
-			r1, err := New(bgCtx, n1.Ms, n1.Ds, pay1, n1.Dt, sidg1, n1.Host.ID())
+			r1, err := New(bgCtx, n1.Ms, n1.Ds, pay1, n1.Dt, sidg1, n1.Host.ID(), zerolog.Nop())
 			require.NoError(t, err)
 
 			fname := n2.CreateRandomFile(t, 256000)
@@ -177,7 +178,7 @@ func TestRetrieval(t *testing.T) {
 			n2.SetupDataTransfer(bgCtx, t)
 			pay2 := &mockPayments{}
 			sidg2 := &mockStoreIDGetter{id: storeID}
-			r2, err := New(bgCtx, n2.Ms, n2.Ds, pay2, n2.Dt, sidg2, n2.Host.ID())
+			r2, err := New(bgCtx, n2.Ms, n2.Ds, pay2, n2.Dt, sidg2, n2.Host.ID(), zerolog.Nop())
 			require.NoError(t, err)
 
 			clientAddr, err := address.NewIDAddress(uint64(10))
@@ -201,7 +202,7 @@ func TestRetrieval(t *testing.T) {
 					return
 				case deal.StatusInsufficientFunds:
 					// Simulate reaprovisioning the payment channel
-					pay1.SetChannelAvailableFunds(payments.AvailableFunds{
+					pay1.SetChannelAvailableFunds(paychmgr.AvailableFunds{
 						ConfirmedAmt: state.VoucherShortfall,
 					})
 					// Need to wait a bit for status to update in state machine
@@ -262,7 +263,7 @@ func TestRetrieval(t *testing.T) {
 	}
 }
 
-func addZeroesToAvailableFunds(channelAvailableFunds payments.AvailableFunds) payments.AvailableFunds {
+func addZeroesToAvailableFunds(channelAvailableFunds paychmgr.AvailableFunds) paychmgr.AvailableFunds {
 	if channelAvailableFunds.ConfirmedAmt.Nil() {
 		channelAvailableFunds.ConfirmedAmt = big.Zero()
 	}
@@ -277,3 +278,41 @@ func addZeroesToAvailableFunds(channelAvailableFunds payments.AvailableFunds) pa
 	}
 	return channelAvailableFunds
 }
+
+func TestReserveFunds(t *testing.T) {
+	ctx := context.Background()
+	chAddr := tutils.NewIDAddr(t, 100)
+	chFunds := addZeroesToAvailableFunds(paychmgr.AvailableFunds{})
+	pay := &mockPayments{
+		chResponse: &paychmgr.ChannelResponse{
+			Channel:      chAddr,
+			WaitSentinel: blockGen.Next().Cid(),
+		},
+		chAddr:  chAddr,
+		chFunds: &chFunds,
+	}
+	c := &Client{pay: pay, reservations: make(map[string]*reservation)}
+	from := tutils.NewIDAddr(t, 101)
+	to := tutils.NewIDAddr(t, 102)
+
+	_, ok := c.reservedChannel(from, to, abi.NewTokenAmount(10))
+	require.False(t, ok)
+
+	require.NoError(t, c.ReserveFunds(ctx, from, to, abi.NewTokenAmount(25)))
+	require.Equal(t, abi.NewTokenAmount(25), pay.chFunds.ConfirmedAmt)
+
+	// Deals draw from the reservation without adding funds
+	for i := 0; i < 2; i++ {
+		res, ok := c.reservedChannel(from, to, abi.NewTokenAmount(10))
+		require.True(t, ok)
+		require.Equal(t, chAddr, res.Channel)
+	}
+	_, ok = c.reservedChannel(from, to, abi.NewTokenAmount(10))
+	require.False(t, ok)
+	require.Equal(t, abi.NewTokenAmount(25), pay.chFunds.ConfirmedAmt)
+	require.Equal(t, abi.NewTokenAmount(5), c.ReservedFunds(from, to))
+
+	require.Equal(t, abi.NewTokenAmount(5), c.ReleaseFunds(from, to))
+	reserved := c.ReservedFunds(from, to)
+	require.True(t, reserved.IsZero())
+}
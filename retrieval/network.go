@@ -15,6 +15,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/protocol"
 	ma "github.com/multiformats/go-multiaddr"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // We stay compatible with lotus nodes so we can retrieve from lotus providers too
@@ -24,8 +26,13 @@ import (
 const FilQueryProtocolID = protocol.ID("/fil/retrieval/qry/1.0.0")
 
 // PopQueryProtocolID is the protocol for exchanging information about retrieval
-// deal parameters from retrieval providers
-const PopQueryProtocolID = protocol.ID("/myel/pop/query/1.0")
+// deal parameters from retrieval providers. Responses carry region peers, an expiry
+// and the signature of the provider.
+const PopQueryProtocolID = protocol.ID("/myel/pop/query/1.1")
+
+// PopQueryV0ProtocolID is the first version of the query protocol. Its responses are
+// encoded like lotus ones without peers, expiry nor signature.
+const PopQueryV0ProtocolID = protocol.ID("/myel/pop/query/1.0")
 
 // These are the required interfaces that must be implemented to send and receive data
 // for retrieval queries and deals.
@@ -73,6 +80,18 @@ type queryStream struct {
 	p        peer.ID
 	rw       mux.MuxedStream
 	buffered *bufio.Reader
+	// v0 is set for the protocols exchanging responses in the QueryResponseV0 encoding
+	v0 bool
+}
+
+// newQueryStream wraps a libp2p stream using the response encoding of its protocol
+func newQueryStream(p peer.ID, s network.Stream) *queryStream {
+	return &queryStream{
+		p:        p,
+		rw:       s,
+		buffered: bufio.NewReaderSize(s, 16),
+		v0:       s.Protocol() != PopQueryProtocolID,
+	}
 }
 
 func (qs *queryStream) ReadQuery() (deal.Query, error) {
@@ -91,6 +110,14 @@ func (qs *queryStream) WriteQuery(q deal.Query) error {
 }
 
 func (qs *queryStream) ReadQueryResponse() (deal.QueryResponse, error) {
+	if qs.v0 {
+		var resp deal.QueryResponseV0
+		if err := resp.UnmarshalCBOR(qs.buffered); err != nil {
+			return deal.QueryResponse{}, err
+		}
+		return resp.QueryResponse(), nil
+	}
+
 	var resp deal.QueryResponse
 
 	if err := resp.UnmarshalCBOR(qs.buffered); err != nil {
@@ -101,6 +128,10 @@ func (qs *queryStream) ReadQueryResponse() (deal.QueryResponse, error) {
 }
 
 func (qs *queryStream) WriteQueryResponse(qr deal.QueryResponse) error {
+	if qs.v0 {
+		v0 := qr.V0()
+		return cborutil.WriteCborRPC(qs.rw, &v0)
+	}
 	return cborutil.WriteCborRPC(qs.rw, &qr)
 }
 
@@ -135,6 +166,13 @@ func SupportedProtocols(supportedProtocols []protocol.ID) Option {
 	}
 }
 
+// Logger sets the logger the network reports failures to
+func Logger(l zerolog.Logger) Option {
+	return func(impl *Libp2pQueryNetwork) {
+		impl.log = l
+	}
+}
+
 // NewQueryNetwork constructs a new instance of the QueryNetwork from a
 // libp2p host
 func NewQueryNetwork(h host.Host, options ...Option) *Libp2pQueryNetwork {
@@ -143,10 +181,13 @@ func NewQueryNetwork(h host.Host, options ...Option) *Libp2pQueryNetwork {
 		maxStreamOpenAttempts: defaultMaxStreamOpenAttempts,
 		minAttemptDuration:    defaultMinAttemptDuration,
 		maxAttemptDuration:    defaultMaxAttemptDuration,
+		// Prefer the protocol with signed responses when the other peer supports it
 		supportedProtocols: []protocol.ID{
-			FilQueryProtocolID,
 			PopQueryProtocolID,
+			PopQueryV0ProtocolID,
+			FilQueryProtocolID,
 		},
+		log: log.Logger,
 	}
 	for _, option := range options {
 		option(impl)
@@ -165,6 +206,7 @@ type Libp2pQueryNetwork struct {
 	minAttemptDuration    time.Duration
 	maxAttemptDuration    time.Duration
 	supportedProtocols    []protocol.ID
+	log                   zerolog.Logger
 }
 
 // NewQueryStream creates a new QueryStream using the provided peer.ID
@@ -173,8 +215,7 @@ func (impl *Libp2pQueryNetwork) NewQueryStream(id peer.ID) (QueryStream, error)
 	if err != nil {
 		return nil, err
 	}
-	buffered := bufio.NewReaderSize(s, 16)
-	return &queryStream{p: id, rw: s, buffered: buffered}, nil
+	return newQueryStream(id, s), nil
 }
 
 func (impl *Libp2pQueryNetwork) openStream(ctx context.Context, id peer.ID, protocols []protocol.ID) (network.Stream, error) {
@@ -190,7 +231,7 @@ func (impl *Libp2pQueryNetwork) openStream(ctx context.Context, id peer.ID, prot
 		if err == nil {
 			return s, err
 		}
-		fmt.Printf("trying again %v\n", err)
+		impl.log.Debug().Err(err).Str("peer", id.String()).Msg("failed to open query stream, trying again")
 
 		nAttempts := b.Attempt()
 		if nAttempts == impl.maxStreamOpenAttempts {
@@ -215,7 +256,6 @@ func (impl *Libp2pQueryNetwork) SetDelegate(r QueryReceiver) error {
 func (impl *Libp2pQueryNetwork) StopHandlingRequests() error {
 	impl.receiver = nil
 	for _, proto := range impl.supportedProtocols {
-		fmt.Printf("protocol %s\n", proto)
 		impl.host.RemoveStreamHandler(proto)
 	}
 	return nil
@@ -223,15 +263,11 @@ func (impl *Libp2pQueryNetwork) StopHandlingRequests() error {
 
 func (impl *Libp2pQueryNetwork) handleNewQueryStream(s network.Stream) {
 	if impl.receiver == nil {
-		fmt.Printf("no receiver set")
+		impl.log.Error().Msg("no receiver set")
 		s.Reset()
 		return
 	}
-	remotePID := s.Conn().RemotePeer()
-	buffered := bufio.NewReaderSize(s, 16)
-	var qs QueryStream
-	qs = &queryStream{remotePID, s, buffered}
-	impl.receiver.HandleQueryStream(qs)
+	impl.receiver.HandleQueryStream(newQueryStream(s.Conn().RemotePeer(), s))
 }
 
 // ID returns the host peer ID
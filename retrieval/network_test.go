@@ -3,10 +3,14 @@ package retrieval
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
 	cid "github.com/ipfs/go-cid"
 	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/protocol"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/myelnet/pop/internal/testutil"
 	"github.com/myelnet/pop/retrieval/deal"
@@ -19,6 +23,7 @@ type testhandler struct {
 	net  QueryNetwork
 	root cid.Cid
 	t    *testing.T
+	key  crypto.PrivKey
 }
 
 func (h *testhandler) HandleQueryStream(stream QueryStream) {
@@ -37,7 +42,10 @@ func (h *testhandler) HandleQueryStream(stream QueryStream) {
 		MinPricePerByte:            deal.DefaultPricePerByte,
 		MaxPaymentInterval:         deal.DefaultPaymentInterval,
 		MaxPaymentIntervalIncrease: deal.DefaultPaymentIntervalIncrease,
+		Peers:                      []string{"/ip4/127.0.0.1/tcp/41505/p2p/12D3KooWSpyoi7KghH98SWDfDFMyAwuvtP8MWWGDcC1e1uHWzjSm"},
+		Expiry:                     uint64(time.Now().Add(time.Minute).Unix()),
 	}
+	require.NoError(h.t, answer.Sign(h.key))
 	err = stream.WriteQueryResponse(answer)
 	require.NoError(h.t, err)
 }
@@ -55,7 +63,7 @@ func TestNetwork(t *testing.T) {
 	cnet := NewQueryNetwork(cnode.Host)
 	pnet := NewQueryNetwork(pnode.Host)
 
-	phandler := &testhandler{pnet, root, t}
+	phandler := &testhandler{pnet, root, t, pnode.Host.Peerstore().PrivKey(pnode.Host.ID())}
 	pnet.SetDelegate(phandler)
 
 	require.NoError(t, mn.LinkAll())
@@ -76,6 +84,55 @@ func TestNetwork(t *testing.T) {
 	require.NoError(t, err)
 
 	require.Equal(t, res.Status, deal.QueryResponseAvailable)
+	require.Len(t, res.Peers, 1)
+	require.False(t, res.Expired(time.Now()))
+
+	// The signature covers every field of the response
+	pub := pnode.Host.Peerstore().PubKey(pnode.Host.ID())
+	require.NoError(t, res.Verify(pnode.Host.ID(), pub))
+	require.Error(t, res.Verify(cnode.Host.ID(), pub))
+	res.MinPricePerByte = big.Zero()
+	require.Equal(t, deal.ErrInvalidAskSignature, res.Verify(pnode.Host.ID(), pub))
+}
+
+func TestNetworkV0(t *testing.T) {
+	bgCtx := context.Background()
+
+	mn := mocknet.New(bgCtx)
+
+	root := blockGenerator.Next().Cid()
+
+	cnode := testutil.NewTestNode(mn, t)
+	pnode := testutil.NewTestNode(mn, t)
+
+	// Clients of the first query protocol get responses they can decode
+	cnet := NewQueryNetwork(cnode.Host, SupportedProtocols([]protocol.ID{PopQueryV0ProtocolID}))
+	pnet := NewQueryNetwork(pnode.Host)
+
+	phandler := &testhandler{pnet, root, t, pnode.Host.Peerstore().PrivKey(pnode.Host.ID())}
+	pnet.SetDelegate(phandler)
+
+	require.NoError(t, mn.LinkAll())
+
+	require.NoError(t, mn.ConnectAllButSelf())
+
+	stream, err := cnet.NewQueryStream(pnode.Host.ID())
+	require.NoError(t, err)
+	defer stream.Close()
+
+	err = stream.WriteQuery(deal.Query{
+		PayloadCID:  root,
+		QueryParams: deal.QueryParams{},
+	})
+	require.NoError(t, err)
+
+	res, err := stream.ReadQueryResponse()
+	require.NoError(t, err)
+
+	require.Equal(t, res.Status, deal.QueryResponseAvailable)
+	require.Equal(t, deal.DefaultPricePerByte, res.MinPricePerByte)
+	require.Empty(t, res.Peers)
+	require.Equal(t, deal.ErrInvalidAskSignature, res.Verify(pnode.Host.ID(), nil))
 }
 
 /****
@@ -0,0 +1,214 @@
+package retrieval
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/rs/zerolog"
+
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/retrieval/provider"
+)
+
+// ErrQuotaExceeded is returned when a peer already retrieved its daily quota of bytes from us
+var ErrQuotaExceeded = errors.New("daily retrieval quota exceeded")
+
+// ErrBandwidthCapped is returned when we already upload at our maximum rate
+var ErrBandwidthCapped = errors.New("upload bandwidth cap reached, try again later")
+
+// rateWindow is the number of seconds we average our upload rate over
+const rateWindow = 5
+
+// Policy decides which peers and content we serve for free and bounds the bandwidth we spend serving
+// content. Quotas and the bandwidth cap are checked before accepting a deal so deals in progress
+// always complete.
+type Policy struct {
+	// FreePeers can retrieve any of our content without paying
+	FreePeers []peer.ID
+	// FreeRoots can be retrieved by anyone without paying
+	FreeRoots []cid.Cid
+	// DailyQuota is how many bytes each peer can retrieve from us per day. Zero means no quota.
+	DailyQuota uint64
+	// MaxUploadRate is how many bytes per second we serve to all peers. Zero means no cap.
+	MaxUploadRate uint64
+	// AuditQuota is how many bytes publishers can retrieve for free per day from the content they
+	// published to audit us. Zero means publishers pay like anyone else.
+	AuditQuota uint64
+}
+
+// Free returns whether a peer can retrieve a content without paying
+func (p Policy) Free(k peer.ID, root cid.Cid) bool {
+	for _, fp := range p.FreePeers {
+		if fp == k {
+			return true
+		}
+	}
+	for _, fr := range p.FreeRoots {
+		if fr.Equals(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// peerUsage is the bytes a peer retrieved during a day
+type peerUsage struct {
+	Day   string
+	Bytes uint64
+}
+
+// bandwidth enforces the policy of the provider. It counts the bytes each peer retrieves per day and
+// measures our upload rate.
+type bandwidth struct {
+	ds  datastore.Batching
+	log zerolog.Logger
+
+	mu     sync.Mutex
+	policy Policy
+	day    string
+	usage  map[peer.ID]uint64
+	// buckets are the bytes sent during each of the last seconds
+	buckets [rateWindow]uint64
+	secs    [rateWindow]int64
+}
+
+func today() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+// newBandwidth loads the usage of each peer today
+func newBandwidth(ds datastore.Batching, logger zerolog.Logger) (*bandwidth, error) {
+	b := &bandwidth{
+		ds:    namespace.Wrap(ds, datastore.NewKey("/retrieval/usage")),
+		log:   logger,
+		day:   today(),
+		usage: make(map[peer.ID]uint64),
+	}
+	res, err := b.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		var u peerUsage
+		if err := json.Unmarshal(e.Value, &u); err != nil {
+			return nil, err
+		}
+		if u.Day != b.day {
+			continue
+		}
+		k, err := peer.IDB58Decode(datastore.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		b.usage[k] = u.Bytes
+	}
+	return b, nil
+}
+
+// rollover resets the usage of all peers when the day changed. It must be called with the lock held.
+func (b *bandwidth) rollover() {
+	if d := today(); d != b.day {
+		b.day = d
+		b.usage = make(map[peer.ID]uint64)
+	}
+}
+
+// sent counts bytes we sent to a peer
+func (b *bandwidth) sent(k peer.ID, n uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	b.usage[k] += n
+
+	s := time.Now().Unix()
+	i := s % rateWindow
+	if b.secs[i] != s {
+		b.secs[i] = s
+		b.buckets[i] = 0
+	}
+	b.buckets[i] += n
+}
+
+// rate returns our upload rate in bytes per second. It must be called with the lock held.
+func (b *bandwidth) rate() uint64 {
+	s := time.Now().Unix()
+	var total uint64
+	for i := range b.buckets {
+		if s-b.secs[i] < rateWindow {
+			total += b.buckets[i]
+		}
+	}
+	return total / rateWindow
+}
+
+// check returns an error if we cannot accept a new deal from a peer
+func (b *bandwidth) check(k peer.ID) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rollover()
+	if b.policy.DailyQuota > 0 && b.usage[k] >= b.policy.DailyQuota {
+		return ErrQuotaExceeded
+	}
+	if b.policy.MaxUploadRate > 0 && b.rate() >= b.policy.MaxUploadRate {
+		return ErrBandwidthCapped
+	}
+	return nil
+}
+
+// persistUsage saves the usage of peers once their deals are over so quotas hold across restarts
+func (b *bandwidth) persistUsage(event provider.Event, state deal.ProviderState) {
+	if !providerFinal(state.Status) {
+		return
+	}
+	b.mu.Lock()
+	u := peerUsage{Day: b.day, Bytes: b.usage[state.Receiver]}
+	b.mu.Unlock()
+	v, err := json.Marshal(u)
+	if err == nil {
+		err = b.ds.Put(datastore.NewKey(state.Receiver.String()), v)
+	}
+	if err != nil {
+		b.log.Error().Err(err).Msg("failed to persist retrieval usage")
+	}
+}
+
+// Policy returns the policy deciding which retrievals are free and bounding our bandwidth
+func (p *Provider) Policy() Policy {
+	p.bandwidth.mu.Lock()
+	defer p.bandwidth.mu.Unlock()
+	return p.bandwidth.policy
+}
+
+// SetPolicy replaces the policy deciding which retrievals are free and bounding our bandwidth
+func (p *Provider) SetPolicy(policy Policy) {
+	p.bandwidth.mu.Lock()
+	defer p.bandwidth.mu.Unlock()
+	p.bandwidth.policy = policy
+}
+
+// FreeAudit returns whether a publisher retrieving its own content can do so for free to audit us
+func (p *Provider) FreeAudit(publisher peer.ID) bool {
+	p.bandwidth.mu.Lock()
+	defer p.bandwidth.mu.Unlock()
+	p.bandwidth.rollover()
+	return p.bandwidth.policy.AuditQuota > 0 && p.bandwidth.usage[publisher] < p.bandwidth.policy.AuditQuota
+}
+
+// Usage returns how many bytes a peer retrieved from us today
+func (p *Provider) Usage(k peer.ID) uint64 {
+	p.bandwidth.mu.Lock()
+	defer p.bandwidth.mu.Unlock()
+	p.bandwidth.rollover()
+	return p.bandwidth.usage[k]
+}
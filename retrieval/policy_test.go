@@ -0,0 +1,67 @@
+package retrieval
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	peer "github.com/libp2p/go-libp2p-peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/retrieval/provider"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func testPeerID(t *testing.T, i int) peer.ID {
+	h, err := multihash.Sum([]byte{byte(i)}, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return peer.ID(h)
+}
+
+func TestPolicyFree(t *testing.T) {
+	root := blockGen.Next().Cid()
+	other := blockGen.Next().Cid()
+	friend := peer.ID("friend")
+	stranger := peer.ID("stranger")
+
+	policy := Policy{FreePeers: []peer.ID{friend}, FreeRoots: []cid.Cid{root}}
+	require.True(t, policy.Free(friend, other))
+	require.True(t, policy.Free(stranger, root))
+	require.False(t, policy.Free(stranger, other))
+	require.False(t, Policy{}.Free(friend, root))
+}
+
+func TestBandwidth(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	b, err := newBandwidth(ds, zerolog.Nop())
+	require.NoError(t, err)
+
+	p1 := testPeerID(t, 1)
+	p2 := testPeerID(t, 2)
+
+	// Without limits we accept everything
+	b.sent(p1, 10000)
+	require.NoError(t, b.check(p1))
+
+	b.policy = Policy{DailyQuota: 8000}
+	require.Equal(t, ErrQuotaExceeded, b.check(p1))
+	require.NoError(t, b.check(p2))
+
+	b.policy = Policy{MaxUploadRate: 1000}
+	require.Equal(t, ErrBandwidthCapped, b.check(p2))
+	b.policy = Policy{MaxUploadRate: 1 << 20}
+	require.NoError(t, b.check(p2))
+
+	// Usage is persisted once deals are over
+	b.persistUsage(provider.EventComplete, deal.ProviderState{Receiver: p1, Status: deal.StatusCompleted})
+	b, err = newBandwidth(ds, zerolog.Nop())
+	require.NoError(t, err)
+	require.Equal(t, uint64(10000), b.usage[p1])
+
+	// Usage resets every day
+	b.day = "2006-01-02"
+	b.rollover()
+	require.Equal(t, uint64(0), b.usage[p1])
+}
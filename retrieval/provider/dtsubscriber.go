@@ -7,6 +7,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-statemachine/fsm"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog"
 )
 
 // EventReceiver is any thing that can receive FSM events
@@ -36,8 +37,8 @@ func eventFromDataTransfer(event datatransfer.Event, channelState datatransfer.C
 // transfer received by a provider -- it reads the voucher to verify this event occurred
 // in a storage market deal, then, based on the data transfer event that occurred, it generates
 // and update message for the deal -- either moving to staged for a completion
-// event or moving to error if a data transfer error occurs
-func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
+// event or moving to error if a data transfer error occurs. Failures to process events are reported to the logger.
+func DataTransferSubscriber(deals EventReceiver, log zerolog.Logger) datatransfer.Subscriber {
 	return func(event datatransfer.Event, channelState datatransfer.ChannelState) {
 		dealProposal, ok := deal.ProposalFromVoucher(channelState.Voucher())
 		// if this event is for a transfer not related to storage, ignore
@@ -52,7 +53,7 @@ func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
 		if channelState.Status() == datatransfer.Completed {
 			err := deals.Send(deal.ProviderDealIdentifier{DealID: dealProposal.ID, Receiver: channelState.Recipient()}, EventComplete)
 			if err != nil {
-				fmt.Println("processing provider dt event:", err)
+				log.Error().Err(err).Msg("processing provider dt event")
 			}
 		}
 
@@ -63,7 +64,7 @@ func DataTransferSubscriber(deals EventReceiver) datatransfer.Subscriber {
 
 		err := deals.Send(deal.ProviderDealIdentifier{DealID: dealProposal.ID, Receiver: channelState.Recipient()}, retrievalEvent, params...)
 		if err != nil {
-			fmt.Printf("processing provider dt event %s: %v\n", datatransfer.Events[event.Code], err)
+			log.Error().Err(err).Str("event", datatransfer.Events[event.Code]).Msg("processing provider dt event")
 		}
 
 	}
@@ -14,7 +14,7 @@ import (
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
 	peer "github.com/libp2p/go-libp2p-peer"
-	"github.com/myelnet/pop/payments"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval/deal"
 	"github.com/myelnet/pop/retrieval/provider"
 )
@@ -133,9 +133,11 @@ func (rv *ProviderRequestValidator) acceptDeal(d *deal.ProviderState) (deal.Stat
 // RevalidatorEnvironment are the dependencies needed to
 // build the logic of revalidation -- essentially, access to the node at statemachines
 type RevalidatorEnvironment interface {
-	Payments() payments.Manager
+	Payments() paychmgr.Manager
 	SendEvent(dealID deal.ProviderDealIdentifier, evt provider.Event, args ...interface{}) error
 	Get(dealID deal.ProviderDealIdentifier) (deal.ProviderState, error)
+	// SentBytes counts the bytes sent to a peer against its quota and our bandwidth cap
+	SentBytes(k peer.ID, n uint64)
 }
 
 type channelData struct {
@@ -305,6 +307,7 @@ func (pr *ProviderRevalidator) OnPullDataSent(chid datatransfer.ChannelID, addit
 	}
 
 	channel.totalSent += additionalBytesSent
+	pr.env.SentBytes(channel.dealID.Receiver, additionalBytesSent)
 	if channel.pricePerByte.IsZero() || channel.totalSent-channel.totalPaidFor < channel.interval {
 		return true, nil, pr.env.SendEvent(channel.dealID, provider.EventBlockSent, channel.totalSent)
 	}
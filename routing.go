@@ -0,0 +1,175 @@
+package pop
+
+import (
+	"context"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/myelnet/pop/supply"
+)
+
+// DefaultReprovideInterval is how often we publish provider records for all our content again.
+// DHT provider records expire after 24 hours.
+const DefaultReprovideInterval = 12 * time.Hour
+
+// RoutingProviders is how many providers we look up on the content routing system before querying them
+const RoutingProviders = 5
+
+// routingJoinWait is how long we wait for the providers found on the content routing system to
+// join our region topics
+const routingJoinWait = 2 * time.Second
+
+// announce publishes a provider record for a root we cache on the content routing system
+func (e *Exchange) announce(ctx context.Context, root cid.Cid) {
+	if e.routing == nil {
+		return
+	}
+	if err := e.routing.Provide(ctx, root, true); err != nil {
+		e.log.Debug().Err(err).Str("root", root.String()).Msg("failed to provide content")
+	}
+}
+
+// Reprovide publishes provider records for all the content we cache and returns how many we published
+func (e *Exchange) Reprovide(ctx context.Context) (int, error) {
+	if e.routing == nil {
+		return 0, nil
+	}
+	infos, _, err := e.supply.ListContent(supply.ListOptions{})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, info := range infos {
+		if err := e.routing.Provide(ctx, info.Root, true); err != nil {
+			if ctx.Err() != nil {
+				return count, ctx.Err()
+			}
+			e.log.Debug().Err(err).Str("root", info.Root.String()).Msg("failed to provide content")
+			continue
+		}
+		count++
+	}
+	return count, nil
+}
+
+// KnownProviders returns the peers we know provide a root without querying the network: ourselves if we
+// have it, the providers whose offers haven't expired and the caches which pulled it when we dispatched
+// it. Their addresses come from our peerstore.
+func (e *Exchange) KnownProviders(root cid.Cid) []peer.AddrInfo {
+	var ps []peer.ID
+	seen := make(map[peer.ID]bool)
+	add := func(p peer.ID) {
+		if !seen[p] {
+			seen[p] = true
+			ps = append(ps, p)
+		}
+	}
+	if _, err := e.supply.GetStoreID(root); err == nil {
+		add(e.h.ID())
+	}
+	for _, offer := range e.offers.Get(root) {
+		add(offer.PeerID)
+	}
+	if caches, err := e.supply.Caches(root); err == nil {
+		for _, p := range caches {
+			add(p)
+		}
+	}
+	infos := make([]peer.AddrInfo, 0, len(ps))
+	for _, p := range ps {
+		info := e.h.Peerstore().PeerInfo(p)
+		if p == e.h.ID() {
+			info.Addrs = e.h.Addrs()
+		}
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// startReprovider announces the content we pull as soon as the transfer completes and publishes
+// provider records for all our content on an interval so they don't expire
+func (e *Exchange) startReprovider(ctx context.Context, interval time.Duration) {
+	unsub := e.dataTransfer.SubscribeToEvents(func(event datatransfer.Event, state datatransfer.ChannelState) {
+		if state.Status() != datatransfer.Completed || state.Recipient() != e.h.ID() {
+			return
+		}
+		root := state.BaseCID()
+		// Retrievals also complete here, we only announce the content we cache
+		if _, err := e.supply.Inspect(root); err != nil {
+			return
+		}
+		go e.announce(ctx, root)
+	})
+	go func() {
+		defer unsub()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			count, err := e.Reprovide(ctx)
+			if err != nil && ctx.Err() == nil {
+				e.log.Error().Err(err).Msg("failed to reprovide content")
+			} else if count > 0 {
+				e.log.Info().Int("count", count).Msg("reprovided content")
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// QueryRouting looks up the providers of the root on the content routing system when none of the peers
+// we are connected to has it. We connect to the providers we find so they receive our gossip query
+// and send their offer.
+func (s *Session) QueryRouting(ctx context.Context) (*deal.Offer, error) {
+	if s.routing == nil {
+		return nil, routing.ErrNotSupported
+	}
+	found := make(map[peer.ID]bool)
+	for info := range s.routing.FindProvidersAsync(ctx, s.root, RoutingProviders) {
+		if info.ID == s.h.ID() {
+			continue
+		}
+		if err := s.h.Connect(ctx, info); err != nil {
+			continue
+		}
+		found[info.ID] = true
+	}
+	if len(found) == 0 {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, routing.ErrNotFound
+	}
+	s.waitTopicPeers(ctx, found)
+	return s.QueryGossip(ctx)
+}
+
+// waitTopicPeers waits a little for the providers we just connected to to share their region
+// subscriptions so our query reaches them
+func (s *Session) waitTopicPeers(ctx context.Context, providers map[peer.ID]bool) {
+	ctx, cancel := context.WithTimeout(ctx, routingJoinWait)
+	defer cancel()
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		for _, topic := range s.regionTopics {
+			for _, p := range topic.ListPeers() {
+				if providers[p] {
+					return
+				}
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
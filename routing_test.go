@@ -0,0 +1,123 @@
+package pop
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	cid "github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/myelnet/pop/supply"
+	"github.com/stretchr/testify/require"
+)
+
+// testRecords are the provider records shared by all the test routers
+type testRecords struct {
+	mu    sync.Mutex
+	provs map[cid.Cid][]peer.AddrInfo
+}
+
+// testRouter publishes provider records for a host
+type testRouter struct {
+	h       host.Host
+	records *testRecords
+}
+
+func (r testRouter) Provide(ctx context.Context, c cid.Cid, announce bool) error {
+	r.records.mu.Lock()
+	defer r.records.mu.Unlock()
+	for _, info := range r.records.provs[c] {
+		if info.ID == r.h.ID() {
+			return nil
+		}
+	}
+	r.records.provs[c] = append(r.records.provs[c], peer.AddrInfo{ID: r.h.ID(), Addrs: r.h.Addrs()})
+	return nil
+}
+
+func (r testRouter) FindProvidersAsync(ctx context.Context, c cid.Cid, max int) <-chan peer.AddrInfo {
+	r.records.mu.Lock()
+	defer r.records.mu.Unlock()
+	out := make(chan peer.AddrInfo, len(r.records.provs[c]))
+	for i, info := range r.records.provs[c] {
+		if i == max {
+			break
+		}
+		out <- info
+	}
+	close(out)
+	return out
+}
+
+func TestContentRouting(t *testing.T) {
+	bgCtx := context.Background()
+
+	ctx, cancel := context.WithTimeout(bgCtx, 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(bgCtx)
+	records := &testRecords{provs: make(map[cid.Cid][]peer.AddrInfo)}
+
+	var nodes []*testutil.TestNode
+	var exchs []*Exchange
+	for i := 0; i < 2; i++ {
+		n := testutil.NewTestNode(mn, t)
+		n.SetupGraphSync(ctx)
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+
+		exch, err := NewExchange(bgCtx, Settings{
+			Datastore:  n.Ds,
+			Blockstore: n.Bs,
+			MultiStore: n.Ms,
+			Host:       n.Host,
+			PubSub:     ps,
+			GraphSync:  n.Gs,
+			RepoPath:   n.DTTmpDir,
+			Keystore:   keystore.NewMemKeystore(),
+			Regions:    []supply.Region{supply.Regions["Global"]},
+			Routing:    testRouter{h: n.Host, records: records},
+		})
+		require.NoError(t, err)
+		nodes = append(nodes, n)
+		exchs = append(exchs, exch)
+	}
+	// The peers can reach each other but aren't connected
+	require.NoError(t, mn.LinkAll())
+
+	pnode, provider, client := nodes[1], exchs[1], exchs[0]
+
+	fname := pnode.CreateRandomFile(t, 56000)
+	link, storeID, _ := pnode.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+	require.NoError(t, provider.Supply().Register(root, storeID))
+
+	count, err := provider.Reprovide(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	session, err := client.NewSession(ctx, root)
+	require.NoError(t, err)
+	defer session.Close()
+
+	offer, err := session.QueryRouting(ctx)
+	require.NoError(t, err)
+	require.Equal(t, pnode.Host.ID(), offer.PeerID)
+
+	// Content no one provides isn't found
+	gen := blocksutil.NewBlockGenerator()
+	other, err := client.NewSession(ctx, gen.Next().Cid())
+	require.NoError(t, err)
+	defer other.Close()
+	_, err = other.QueryRouting(ctx)
+	require.Equal(t, routing.ErrNotFound, err)
+}
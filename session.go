@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	"github.com/filecoin-project/go-multistore"
@@ -13,10 +15,16 @@ import (
 	basicnode "github.com/ipld/go-ipld-prime/node/basic"
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	"github.com/libp2p/go-libp2p-core/host"
 	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/peerstore"
+	"github.com/libp2p/go-libp2p-core/routing"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/filecoin/paychmgr"
 	"github.com/myelnet/pop/retrieval"
+	"github.com/myelnet/pop/retrieval/client"
 	"github.com/myelnet/pop/retrieval/deal"
+	"github.com/rs/zerolog"
 )
 
 // Session to exchange multiple blocks with a set of connected peers
@@ -25,12 +33,25 @@ type Session struct {
 	storeID multistore.StoreID
 	// regionTopics are all the region gossip subscriptions this session can query to find the content
 	regionTopics map[string]*pubsub.Topic
+	// peers is where we add the region members providers share in their offers
+	peers peerstore.Peerstore
+	self  peer.ID
+	// offers caches the verified offers of providers so we don't query the network for them again
+	offers *OfferCache
+	// discovery ranks offers and measures how fast providers answer, nil ranks offers by price
+	discovery *Discovery
+	// routing finds the providers of the content we aren't connected to, nil if disabled
+	routing routing.ContentRouting
+	h       host.Host
 	// net is the network procotol used by providers to send their offers
 	net retrieval.QueryNetwork
 	// retriever manages the state of the transfer once we have a good offer
 	retriever *retrieval.Client
 	// clientAddr is the address that will be used to make any payment for retrieving the content
 	clientAddr address.Address
+	// payer limits the funds we spend when another address pays for our retrievals
+	payer *paychmgr.Delegation
+	log   zerolog.Logger
 	// root is the root cid of the dag we are retrieving during this session
 	root cid.Cid
 	// sel is the selector used to select specific nodes only to retrieve. if not provided we select
@@ -48,10 +69,54 @@ type Session struct {
 	responses map[peer.ID]deal.QueryResponse
 	// dealID is the ID of any ongoing deal we might have with a provider during this session
 	dealID *deal.ID
+	// race is set while deals with several providers compete for the transfer
+	race *race
+	// group shares providers and payment channels with related sessions, nil if the session is alone
+	group *Group
+}
+
+// handleEvent reports the end of the deal of the session and the progress of racing deals
+func (s *Session) handleEvent(event client.Event, state deal.ClientState) {
+	s.mu.Lock()
+	if s.race != nil {
+		s.race.update(state)
+		if s.race.winner != nil {
+			s.dealID = s.race.winner
+		}
+	}
+	ours := s.dealID != nil && *s.dealID == state.ID
+	s.mu.Unlock()
+	if ours {
+		s.finish(state)
+	}
+}
+
+// finish reports the end of the deal of the session
+func (s *Session) finish(state deal.ClientState) {
+	switch state.Status {
+	case deal.StatusCompleted:
+		if s.group != nil {
+			s.group.record(state.Sender, true)
+		}
+		s.done <- nil
+	case deal.StatusCancelled, deal.StatusErrored:
+		if s.group != nil && state.Status == deal.StatusErrored {
+			s.group.record(state.Sender, false)
+		}
+		s.done <- fmt.Errorf("retrieval: %v, %v", deal.Statuses[state.Status], state.Message)
+	}
 }
 
 type gossipSourcing struct {
-	offers chan deal.Offer // stream of offers coming from a gossip query
+	root   cid.Cid
+	offers chan deal.Offer     // stream of offers coming from a gossip query
+	peers  peerstore.Peerstore // peers shared by providers are added to our peerstore
+	self   peer.ID
+	cache  *OfferCache // verified offers are cached until they expire
+	// discovery records how long providers took to answer since we sent the query
+	discovery *Discovery
+	sent      time.Time
+	log       zerolog.Logger
 }
 
 // HandleQueryStream for direct provider queries
@@ -61,16 +126,37 @@ func (g *gossipSourcing) HandleQueryStream(stream retrieval.QueryStream) {
 
 	response, err := stream.ReadQueryResponse()
 	if err != nil {
-		fmt.Println("unable to read query response", err)
+		g.log.Error().Err(err).Str("peer", stream.OtherPeer().String()).Msg("unable to read query response")
 		return
 	}
 
-	fmt.Printf("received an offer\n")
+	g.log.Debug().Str("peer", stream.OtherPeer().String()).Msg("received an offer")
 
-	g.offers <- deal.Offer{
+	offer := deal.Offer{
 		PeerID:   stream.OtherPeer(),
 		Response: response,
 	}
+	// Offers must be signed by the provider so intermediaries cannot spoof prices
+	if err := verifyOffer(g.peers, offer); err != nil {
+		g.log.Debug().Err(err).Str("peer", offer.PeerID.String()).Msg("dropping offer")
+		return
+	}
+
+	if g.peers != nil {
+		addPEXPeers(g.peers, g.self, response.Peers)
+	}
+	if g.cache != nil {
+		g.cache.Add(g.root, offer)
+	}
+	if g.discovery != nil {
+		g.discovery.RecordRTT(offer.PeerID, time.Since(g.sent))
+	}
+
+	// Drop the offers arriving once the session has all it needs
+	select {
+	case g.offers <- offer:
+	default:
+	}
 }
 
 // QueryMiner asks a storage miner for retrieval conditions
@@ -99,11 +185,18 @@ func (s *Session) QueryMiner(ctx context.Context, pid peer.ID) (*deal.Offer, err
 	}, nil
 }
 
-// QueryGossip asks the gossip network of providers if anyone can provide the blocks we're looking for
-// it blocks execution until our conditions are satisfied
-func (s *Session) QueryGossip(ctx context.Context) (*deal.Offer, error) {
-	offers := make(chan deal.Offer, 1)
-	disc := &gossipSourcing{offers}
+// publishQuery sends a query for the root to all the regions and delivers the offers of the providers
+func (s *Session) publishQuery(ctx context.Context, offers chan deal.Offer) error {
+	disc := &gossipSourcing{
+		root:      s.root,
+		offers:    offers,
+		peers:     s.peers,
+		self:      s.self,
+		cache:     s.offers,
+		discovery: s.discovery,
+		sent:      time.Now(),
+		log:       s.log,
+	}
 	s.net.SetDelegate(disc)
 
 	m := deal.Query{
@@ -113,18 +206,30 @@ func (s *Session) QueryGossip(ctx context.Context) (*deal.Offer, error) {
 
 	buf := new(bytes.Buffer)
 	if err := m.MarshalCBOR(buf); err != nil {
-		return nil, err
+		return err
 	}
 
 	// publish to all regions this exchange joined
 	for _, topic := range s.regionTopics {
 		if err := topic.Publish(ctx, buf.Bytes()); err != nil {
-			return nil, err
+			return err
 		}
 	}
+	return nil
+}
 
-	// TODO: add custom logic to select the right offer
-	// for now we always take the first one we get = lowest latency
+// QueryGossip asks the gossip network of providers if anyone can provide the blocks we're looking for
+// it blocks execution until our conditions are satisfied
+func (s *Session) QueryGossip(ctx context.Context) (*deal.Offer, error) {
+	if cached := s.cachedOffers(); len(cached) > 0 {
+		return &cached[0], nil
+	}
+	offers := make(chan deal.Offer, 1)
+	if err := s.publishQuery(ctx, offers); err != nil {
+		return nil, err
+	}
+
+	// The first offer we get has the lowest latency. Use QueryOffers to compare prices.
 	for {
 		select {
 		case offer := <-offers:
@@ -135,18 +240,136 @@ func (s *Session) QueryGossip(ctx context.Context) (*deal.Offer, error) {
 	}
 }
 
-// SyncBlocks will trigger a retrieval without returning the blocks
-func (s *Session) SyncBlocks(ctx context.Context, of *deal.Offer) error {
+// QueryProvider asks the gossip network for the content and waits for the offer of the given provider
+func (s *Session) QueryProvider(ctx context.Context, p peer.ID) (*deal.Offer, error) {
+	for _, offer := range s.cachedOffers() {
+		if offer.PeerID == p {
+			return &offer, nil
+		}
+	}
+	offers := make(chan deal.Offer, 8)
+	if err := s.publishQuery(ctx, offers); err != nil {
+		return nil, err
+	}
+	for {
+		select {
+		case offer := <-offers:
+			if offer.PeerID == p {
+				return &offer, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// QueryOffers asks the gossip network of providers for the content and collects up to max offers,
+// waiting at most wait after the first one. Offers are returned best first as ranked by the discovery
+// or cheapest first, the fastest providers first at the same price, without discovery.
+func (s *Session) QueryOffers(ctx context.Context, max int, wait time.Duration) ([]deal.Offer, error) {
+	res := s.cachedOffers()
+	if len(res) >= max {
+		return s.rank(res[:max]), nil
+	}
+	// Providers we already have an offer from will answer again
+	seen := make(map[peer.ID]bool, len(res))
+	for _, offer := range res {
+		seen[offer.PeerID] = true
+	}
+	offers := make(chan deal.Offer, max)
+	if err := s.publishQuery(ctx, offers); err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if len(res) > 0 {
+		timeout = time.After(wait)
+	}
+	for len(res) < max {
+		select {
+		case offer := <-offers:
+			if seen[offer.PeerID] {
+				continue
+			}
+			seen[offer.PeerID] = true
+			if len(res) == 0 {
+				timeout = time.After(wait)
+			}
+			res = append(res, offer)
+		case <-timeout:
+			return s.rank(res), nil
+		case <-ctx.Done():
+			if len(res) > 0 {
+				return s.rank(res), nil
+			}
+			return nil, ctx.Err()
+		}
+	}
+	return s.rank(res), nil
+}
+
+// cachedOffers returns the offers for the root of the session we received recently, best first
+func (s *Session) cachedOffers() []deal.Offer {
+	if s.offers == nil {
+		return nil
+	}
+	return s.rank(s.offers.Get(s.root))
+}
+
+// rank sorts offers with the discovery if any or by price. The providers which served the group of the
+// session come first.
+func (s *Session) rank(offers []deal.Offer) []deal.Offer {
+	var res []deal.Offer
+	if s.discovery == nil {
+		res = RankOffers(offers)
+	} else {
+		ranked := s.discovery.Rank(offers)
+		res = make([]deal.Offer, len(ranked))
+		for i, r := range ranked {
+			res[i] = r.Offer
+		}
+	}
+	if s.group != nil {
+		res = s.group.prefer(res)
+	}
+	return res
+}
+
+// RankOffers sorts offers by total price keeping the order they arrived in, fastest first, at the
+// same price
+func RankOffers(offers []deal.Offer) []deal.Offer {
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].Response.PieceRetrievalPrice().LessThan(offers[j].Response.PieceRetrievalPrice())
+	})
+	return offers
+}
+
+// retrieve starts a deal with the provider of the offer
+func (s *Session) retrieve(ctx context.Context, of *deal.Offer) (deal.ID, error) {
 	params, err := deal.NewParams(
 		of.Response.MinPricePerByte,
 		of.Response.MaxPaymentInterval,
 		of.Response.MaxPaymentIntervalIncrease,
-		AllSelector(),
+		s.sel,
 		nil,
 		of.Response.UnsealPrice,
 	)
+	if err != nil {
+		return 0, err
+	}
 
-	id, err := s.retriever.Retrieve(
+	if s.payer != nil && s.clientAddr == s.payer.Payer() {
+		if err := s.payer.Reserve(of.Response.PieceRetrievalPrice()); err != nil {
+			return 0, err
+		}
+	}
+	if s.group != nil {
+		if err := s.group.fund(ctx, s.clientAddr, of); err != nil {
+			return 0, err
+		}
+	}
+
+	return s.retriever.Retrieve(
 		ctx,
 		s.root,
 		params,
@@ -156,6 +379,11 @@ func (s *Session) SyncBlocks(ctx context.Context, of *deal.Offer) error {
 		of.Response.PaymentAddress,
 		&s.storeID,
 	)
+}
+
+// SyncBlocks will trigger a retrieval without returning the blocks
+func (s *Session) SyncBlocks(ctx context.Context, of *deal.Offer) error {
+	id, err := s.retrieve(ctx, of)
 	if err != nil {
 		return err
 	}
@@ -165,7 +393,12 @@ func (s *Session) SyncBlocks(ctx context.Context, of *deal.Offer) error {
 	return nil
 }
 
-// AllSelector to get all the nodes for now. TODO` support custom selectors
+// SetSelector changes the selector of the next retrievals so only part of the DAG is transferred
+func (s *Session) SetSelector(sel iprime.Node) {
+	s.sel = sel
+}
+
+// AllSelector selects all the nodes of a DAG
 func AllSelector() iprime.Node {
 	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
 	return ssb.ExploreRecursive(selector.RecursionLimitNone(),
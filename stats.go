@@ -0,0 +1,294 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+)
+
+//go:generate cbor-gen-for StatsReport
+
+// StatsTopic is the gossip topic where caches publish their stats in a region
+const StatsTopic = "/myel/pop/stats/1.0"
+
+// StatsInterval is how often caches publish their stats
+const StatsInterval = 5 * time.Minute
+
+// StatsTTL is how long we keep stats from a cache we haven't heard about again
+const StatsTTL = 3 * StatsInterval
+
+// StatsReport is an anonymized summary of a cache activity in a region. It doesn't include the provider ID
+// and counters are totals since the cache started. Reports are still signed pubsub messages so we only keep
+// a salted hash of the cache publishing them.
+type StatsReport struct {
+	Region string
+	// Capacity is the space available in bytes
+	Capacity uint64
+	// Queries is the number of content queries the cache received in the region
+	Queries uint64
+	// Hits is the number of queries for content the cache had
+	Hits uint64
+	// BytesServed is the number of bytes the cache sent in retrieval deals
+	BytesServed uint64
+}
+
+// RegionHealth aggregates the stats of all the caches we heard from in a region
+type RegionHealth struct {
+	Region      string
+	Caches      int
+	Capacity    uint64
+	Queries     uint64
+	Hits        uint64
+	HitRate     float64
+	BytesServed uint64
+}
+
+// reporterID identifies the cache a report came from without keeping its peer ID
+type reporterID [sha256.Size]byte
+
+type statsEntry struct {
+	StatsReport
+	seen time.Time
+}
+
+type regionCounters struct {
+	queries uint64
+	hits    uint64
+}
+
+// RegionStats collects our own stats and the stats caches publish in our regions
+type RegionStats struct {
+	h   host.Host
+	ps  *pubsub.PubSub
+	log zerolog.Logger
+	// salt is hashed with the peer ID of the caches so their reports cannot be traced back to them
+	salt []byte
+
+	mu       sync.Mutex
+	topics   map[string]*pubsub.Topic
+	subs     map[string]*pubsub.Subscription
+	reports  map[string]map[reporterID]statsEntry
+	counters map[string]*regionCounters
+	served   uint64
+}
+
+// NewRegionStats creates a new RegionStats and joins the stats topics of the given regions
+func NewRegionStats(ctx context.Context, h host.Host, ps *pubsub.PubSub, regions []supply.Region, log zerolog.Logger) (*RegionStats, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	s := &RegionStats{
+		h:        h,
+		ps:       ps,
+		log:      log,
+		salt:     salt,
+		topics:   make(map[string]*pubsub.Topic),
+		subs:     make(map[string]*pubsub.Subscription),
+		reports:  make(map[string]map[reporterID]statsEntry),
+		counters: make(map[string]*regionCounters),
+	}
+	for _, r := range regions {
+		if err := s.joinRegion(ctx, r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// joinRegion starts publishing our stats and collecting the stats of the caches in a region
+func (s *RegionStats) joinRegion(ctx context.Context, r supply.Region) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.topics[r.Name]; ok {
+		return nil
+	}
+	topic, err := s.ps.Join(fmt.Sprintf("%s/%s", StatsTopic, r.Name))
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		topic.Close()
+		return err
+	}
+	s.topics[r.Name] = topic
+	s.subs[r.Name] = sub
+	go s.statsLoop(ctx, sub, r)
+	return nil
+}
+
+// leaveRegion stops publishing our stats in a region and forgets the stats we collected there
+func (s *RegionStats) leaveRegion(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.reports, name)
+	if sub, ok := s.subs[name]; ok {
+		sub.Cancel()
+		delete(s.subs, name)
+	}
+	if topic, ok := s.topics[name]; ok {
+		delete(s.topics, name)
+		return topic.Close()
+	}
+	return nil
+}
+
+func (s *RegionStats) statsLoop(ctx context.Context, sub *pubsub.Subscription, r supply.Region) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		if msg.ReceivedFrom == s.h.ID() {
+			continue
+		}
+		var rep StatsReport
+		if err := rep.UnmarshalCBOR(bytes.NewReader(msg.Data)); err != nil {
+			continue
+		}
+		if rep.Region != r.Name {
+			continue
+		}
+		// A new report from a cache replaces its previous one
+		s.put(msg.GetFrom(), rep)
+	}
+}
+
+// reporter hashes the peer ID of a cache with our salt
+func (s *RegionStats) reporter(p peer.ID) reporterID {
+	return sha256.Sum256(append(append([]byte{}, s.salt...), p...))
+}
+
+func (s *RegionStats) put(p peer.ID, rep StatsReport) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reports[rep.Region] == nil {
+		s.reports[rep.Region] = make(map[reporterID]statsEntry)
+	}
+	s.reports[rep.Region][s.reporter(p)] = statsEntry{rep, time.Now()}
+}
+
+// RecordQuery counts a content query we received in a region and if we had the content
+func (s *RegionStats) RecordQuery(region string, hit bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[region]
+	if !ok {
+		c = &regionCounters{}
+		s.counters[region] = c
+	}
+	c.queries++
+	if hit {
+		c.hits++
+	}
+}
+
+// RecordServed counts bytes we sent in a retrieval deal. As retrievals aren't tied to a region,
+// they are reported in all our regions.
+func (s *RegionStats) RecordServed(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.served += n
+}
+
+// report returns our own stats in a region
+func (s *RegionStats) report(region string, capacity uint64) StatsReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rep := StatsReport{
+		Region:      region,
+		Capacity:    capacity,
+		BytesServed: s.served,
+	}
+	if c, ok := s.counters[region]; ok {
+		rep.Queries = c.queries
+		rep.Hits = c.hits
+	}
+	return rep
+}
+
+// Publish sends our stats in all our regions at regular intervals until the context is cancelled.
+// Capacity returns the space we currently have available.
+func (s *RegionStats) Publish(ctx context.Context, capacity func() uint64) {
+	publish := func() {
+		s.mu.Lock()
+		topics := make(map[string]*pubsub.Topic, len(s.topics))
+		for name, topic := range s.topics {
+			topics[name] = topic
+		}
+		s.mu.Unlock()
+		free := capacity()
+		for name, topic := range topics {
+			rep := s.report(name, free)
+			// Count ourselves in the region health
+			s.put(s.h.ID(), rep)
+			buf := new(bytes.Buffer)
+			if err := rep.MarshalCBOR(buf); err != nil {
+				continue
+			}
+			if err := topic.Publish(ctx, buf.Bytes()); err != nil {
+				s.log.Warn().Err(err).Str("region", name).Msg("failed to publish stats")
+			}
+		}
+	}
+	ticker := time.NewTicker(StatsInterval)
+	defer ticker.Stop()
+	publish()
+	for {
+		select {
+		case <-ticker.C:
+			publish()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Health aggregates the recent stats of the caches in a region. An empty region returns the health
+// of all the regions we heard from sorted by name.
+func (s *RegionStats) Health(region string) []RegionHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []RegionHealth
+	now := time.Now()
+	for rname, reps := range s.reports {
+		if region != "" && rname != region {
+			continue
+		}
+		h := RegionHealth{Region: rname}
+		for p, e := range reps {
+			if now.Sub(e.seen) > StatsTTL {
+				delete(reps, p)
+				continue
+			}
+			h.Caches++
+			h.Capacity += e.Capacity
+			h.Queries += e.Queries
+			h.Hits += e.Hits
+			h.BytesServed += e.BytesServed
+		}
+		if h.Caches == 0 {
+			continue
+		}
+		if h.Queries > 0 {
+			h.HitRate = float64(h.Hits) / float64(h.Queries)
+		}
+		out = append(out, h)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Region < out[j].Region
+	})
+	return out
+}
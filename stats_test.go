@@ -0,0 +1,101 @@
+package pop
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+	"time"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/myelnet/pop/supply"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegionHealth(t *testing.T) {
+	s := &RegionStats{
+		salt:     []byte("salt"),
+		topics:   make(map[string]*pubsub.Topic),
+		reports:  make(map[string]map[reporterID]statsEntry),
+		counters: make(map[string]*regionCounters),
+	}
+
+	s.RecordQuery("Europe", true)
+	s.RecordQuery("Europe", false)
+	s.RecordQuery("Asia", false)
+	s.RecordServed(512)
+
+	rep := s.report("Europe", 1024)
+	require.Equal(t, StatsReport{Region: "Europe", Capacity: 1024, Queries: 2, Hits: 1, BytesServed: 512}, rep)
+
+	buf := new(bytes.Buffer)
+	require.NoError(t, rep.MarshalCBOR(buf))
+	var dec StatsReport
+	require.NoError(t, dec.UnmarshalCBOR(buf))
+	require.Equal(t, rep, dec)
+
+	s.put(peer.ID("a"), rep)
+	s.put(peer.ID("b"), StatsReport{Region: "Europe", Capacity: 2048, Queries: 2, Hits: 2})
+	// A new report from the same cache replaces the previous one
+	s.put(peer.ID("b"), StatsReport{Region: "Europe", Capacity: 1024, Queries: 6, Hits: 5})
+	s.put(peer.ID("c"), StatsReport{Region: "Asia", Capacity: 100})
+	// Reports are only kept under a salted hash of the cache
+	_, ok := s.reports["Asia"][sha256.Sum256([]byte(peer.ID("c")))]
+	require.False(t, ok)
+	_, ok = s.reports["Asia"][s.reporter(peer.ID("c"))]
+	require.True(t, ok)
+	// Stale reports are ignored
+	s.reports["Asia"][s.reporter(peer.ID("d"))] = statsEntry{StatsReport{Region: "Asia", Capacity: 100}, time.Now().Add(-2 * StatsTTL)}
+
+	health := s.Health("")
+	require.Equal(t, []RegionHealth{
+		{Region: "Asia", Caches: 1, Capacity: 100},
+		{Region: "Europe", Caches: 2, Capacity: 2048, Queries: 8, Hits: 6, HitRate: 0.75, BytesServed: 512},
+	}, health)
+
+	require.Equal(t, health[1:], s.Health("Europe"))
+	require.Len(t, s.Health("Africa"), 0)
+}
+
+func TestRegionStatsMembership(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	europe := supply.Regions["Europe"]
+
+	var stats []*RegionStats
+	for _, regions := range [][]supply.Region{nil, {europe}} {
+		n := testutil.NewTestNode(mn, t)
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+		s, err := NewRegionStats(ctx, n.Host, ps, regions, zerolog.Nop())
+		require.NoError(t, err)
+		stats = append(stats, s)
+	}
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+
+	// A region joined at runtime gets our stats
+	require.NoError(t, stats[0].joinRegion(ctx, europe))
+	// Wait for the gossip mesh to form
+	time.Sleep(time.Second)
+	go stats[0].Publish(ctx, func() uint64 { return 1024 })
+
+	require.Eventually(t, func() bool {
+		h := stats[1].Health("Europe")
+		return len(h) == 1 && h[0].Capacity == 1024
+	}, 5*time.Second, 50*time.Millisecond)
+	require.Len(t, stats[0].Health("Europe"), 1)
+
+	// We stop publishing in a region we left and forget its stats
+	require.NoError(t, stats[0].leaveRegion("Europe"))
+	require.Len(t, stats[0].Health("Europe"), 0)
+	stats[0].mu.Lock()
+	require.NotContains(t, stats[0].topics, "Europe")
+	stats[0].mu.Unlock()
+}
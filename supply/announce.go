@@ -0,0 +1,195 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// AnnounceTopic is the gossip topic where publishers announce new content to the caches of a region
+const AnnounceTopic = "/myel/supply/announce/1.0"
+
+// AnnounceTimeout is how long publishers usually wait for caches to pull announced content
+const AnnounceTimeout = time.Minute
+
+// Announcement is a dispatch request gossiped to all the caches in a region
+type Announcement struct {
+	Request Request
+	// Addrs are the multiaddrs of the publisher so caches we aren't connected to can pull from us
+	Addrs [][]byte
+}
+
+// EnableAnnouncements joins the announcement topics of our regions so we can announce content
+// and pull content announced by other publishers
+func (s *Supply) EnableAnnouncements(ctx context.Context, ps *pubsub.PubSub) error {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	s.ps = ps
+	s.topics = make(map[string]*pubsub.Topic)
+	s.subs = make(map[string]*pubsub.Subscription)
+	for _, r := range s.regions {
+		if err := s.joinTopic(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// joinTopic subscribes to the announcement topic of a region. Must hold the regions lock.
+func (s *Supply) joinTopic(ctx context.Context, r Region) error {
+	topic, err := s.ps.Join(fmt.Sprintf("%s/%s", AnnounceTopic, r.Name))
+	if err != nil {
+		return err
+	}
+	sub, err := topic.Subscribe()
+	if err != nil {
+		return err
+	}
+	s.topics[r.Name] = topic
+	s.subs[r.Name] = sub
+	go s.announcementLoop(ctx, r.Name, sub)
+	return nil
+}
+
+// leaveTopic cancels our subscription to the announcement topic of a region. Must hold the regions lock.
+func (s *Supply) leaveTopic(name string) error {
+	if sub, ok := s.subs[name]; ok {
+		sub.Cancel()
+		delete(s.subs, name)
+	}
+	if topic, ok := s.topics[name]; ok {
+		delete(s.topics, name)
+		return topic.Close()
+	}
+	return nil
+}
+
+// topic returns the announcement topic of a region we are part of
+func (s *Supply) topic(name string) (*pubsub.Topic, bool) {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	t, ok := s.topics[name]
+	return t, ok
+}
+
+// Announce publishes a request on the announcement topics of our regions. Unlike Dispatch, any cache
+// in our regions may pull the content including the ones we aren't connected to, until MaxReceiverCount
+// caches did. As we don't know how many caches will answer, Done may never be closed and callers
+// should use a deadline.
+func (s *Supply) Announce(ctx context.Context, r Request) (*Response, error) {
+	s.rmu.RLock()
+	var topics []*pubsub.Topic
+	for _, topic := range s.topics {
+		topics = append(topics, topic)
+	}
+	s.rmu.RUnlock()
+	if len(topics) == 0 {
+		return nil, ErrNoPeers
+	}
+	if err := CheckCodec(r.PayloadCID); err != nil {
+		return nil, err
+	}
+
+	res := newResponse()
+	res.unsub = s.watchDispatch(res, r.PayloadCID, r.PayloadCID)
+	res.watch(ctx)
+	res.setAttempted(MaxReceiverCount)
+
+	return res, s.announce(ctx, r, topics)
+}
+
+// newAnnouncement creates an announcement for the request with our addresses
+func (s *Supply) newAnnouncement(r Request) Announcement {
+	a := Announcement{Request: s.signRequest(r)}
+	for _, addr := range s.h.Addrs() {
+		a.Addrs = append(a.Addrs, addr.Bytes())
+	}
+	return a
+}
+
+// announce authorizes any cache to pull the content and publishes the request on the given topics
+func (s *Supply) announce(ctx context.Context, r Request, topics []*pubsub.Topic) error {
+	a := s.newAnnouncement(r)
+	buf := new(bytes.Buffer)
+	if err := a.MarshalCBOR(buf); err != nil {
+		return err
+	}
+	s.validation.AuthorizeAny(r.PayloadCID, MaxReceiverCount)
+	for _, topic := range topics {
+		if err := topic.Publish(ctx, buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Supply) announcementLoop(ctx context.Context, region string, sub *pubsub.Subscription) {
+	for {
+		msg, err := sub.Next(ctx)
+		if err != nil {
+			return
+		}
+		from := msg.GetFrom()
+		if from == s.h.ID() {
+			continue
+		}
+		var a Announcement
+		if err := a.UnmarshalCBOR(bytes.NewReader(msg.Data)); err != nil {
+			continue
+		}
+		// Skip content we already have or can't serve
+		if _, err := s.store.GetRecord(a.Request.PayloadCID); err == nil {
+			continue
+		}
+		if CheckCodec(a.Request.PayloadCID) != nil {
+			continue
+		}
+		if ok, _ := s.throttle.allowRequest(from, s.quotas.publisher(a.Request, from)); !ok {
+			s.log.Debug().Str("publisher", from.String()).Msg("throttled announcement")
+			continue
+		}
+		go s.pullAnnounced(ctx, from, region, a)
+	}
+}
+
+// pullAnnounced connects to the publisher if needed and pulls the announced content
+func (s *Supply) pullAnnounced(ctx context.Context, from peer.ID, region string, a Announcement) {
+	info := peer.AddrInfo{ID: from}
+	for _, b := range a.Addrs {
+		addr, err := ma.NewMultiaddrBytes(b)
+		if err != nil {
+			continue
+		}
+		info.Addrs = append(info.Addrs, addr)
+	}
+	cctx, cancel := context.WithTimeout(ctx, SendTimeout)
+	defer cancel()
+	if err := s.h.Connect(cctx, info); err != nil {
+		s.log.Warn().Err(err).Str("publisher", from.String()).Msg("failed to connect to publisher")
+		return
+	}
+	if err := s.pulls.add(queuedPull{Peer: from, Region: region, Request: a.Request}); err != nil {
+		s.log.Warn().Err(err).Str("root", a.Request.PayloadCID.String()).Msg("failed to queue announced content")
+	}
+}
+
+// AuthorizeAny lets the first n peers asking for the content pull it without payment
+func (v *Validator) AuthorizeAny(k cid.Cid, n int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.open[k] += n
+}
+
+// authorized checks if a peer is allowed to pull the content without payment
+func (v *Validator) authorized(k cid.Cid, p peer.ID) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	set, ok := v.auth[k]
+	return ok && set.Contains(p)
+}
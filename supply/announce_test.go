@@ -0,0 +1,77 @@
+package supply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnounce(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+
+	var nodes []*testutil.TestNode
+	var supplies []*Supply
+	for i := 0; i < 3; i++ {
+		n := testutil.NewTestNode(mn, t)
+		n.SetupDataTransfer(ctx, t)
+		t.Cleanup(func() {
+			err := n.Dt.Stop(ctx)
+			require.NoError(t, err)
+		})
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+
+		s := New(n.Host, n.Dt, n.Ds, n.Ms, regions, nil)
+		require.NoError(t, s.EnableAnnouncements(ctx, ps))
+		nodes = append(nodes, n)
+		supplies = append(supplies, s)
+	}
+
+	require.NoError(t, mn.LinkAll())
+	// The publisher is only connected to the first cache which relays the announcement to the second one
+	_, err := mn.ConnectPeers(nodes[0].Host.ID(), nodes[1].Host.ID())
+	require.NoError(t, err)
+	_, err = mn.ConnectPeers(nodes[1].Host.ID(), nodes[2].Host.ID())
+	require.NoError(t, err)
+
+	// Give some time for the gossip mesh to form
+	time.Sleep(2 * time.Second)
+
+	fname := nodes[0].CreateRandomFile(t, 256000)
+	link, storeID, origBytes := nodes[0].LoadFileToNewStore(ctx, t, fname)
+	rootCid := link.(cidlink.Link).Cid
+	require.NoError(t, supplies[0].Register(rootCid, storeID))
+
+	res, err := supplies[0].Announce(ctx, Request{PayloadCID: rootCid, Size: nodes[0].DAGSize(ctx, t, storeID, rootCid)})
+	require.NoError(t, err)
+	defer res.Close()
+
+	got := make(map[string]bool)
+	for len(got) < 2 {
+		rec, err := res.Next(ctx)
+		require.NoError(t, err)
+		got[rec.Provider.String()] = true
+	}
+	for i := 1; i < 3; i++ {
+		require.True(t, got[nodes[i].Host.ID().String()])
+		store, err := supplies[i].GetStore(rootCid)
+		require.NoError(t, err)
+		nodes[i].VerifyFileTransferred(ctx, t, store.DAG, rootCid, origBytes)
+	}
+}
@@ -0,0 +1,47 @@
+package supply
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// ErrUnsupportedCodec is returned when dispatching content caches can't verify or traverse
+var ErrUnsupportedCodec = errors.New("not supported by caches")
+
+// SupportedHashes are the multihash functions caches can verify, by name
+var SupportedHashes = map[string]uint64{
+	"sha2-256":    mh.SHA2_256,
+	"blake2b-256": mh.BLAKE2B_MIN + 31,
+	"blake3":      mh.BLAKE3,
+}
+
+// SupportedCodecs are the IPLD codecs caches can traverse, by name
+var SupportedCodecs = map[string]uint64{
+	"dag-pb":   cid.DagProtobuf,
+	"dag-cbor": cid.DagCBOR,
+	"raw":      cid.Raw,
+}
+
+func supported(m map[string]uint64, code uint64) bool {
+	for _, c := range m {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckCodec makes sure caches can serve content with the given root
+func CheckCodec(root cid.Cid) error {
+	prefix := root.Prefix()
+	if !supported(SupportedHashes, prefix.MhType) {
+		return fmt.Errorf("hash function %x %w", prefix.MhType, ErrUnsupportedCodec)
+	}
+	if !supported(SupportedCodecs, prefix.Codec) {
+		return fmt.Errorf("codec %x %w", prefix.Codec, ErrUnsupportedCodec)
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package supply
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	mh "github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCodec(t *testing.T) {
+	data := []byte("hello")
+	for name, code := range SupportedHashes {
+		c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: code, MhLength: -1}.Sum(data)
+		require.NoError(t, err, name)
+		require.NoError(t, CheckCodec(c), name)
+	}
+
+	c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: mh.SHA3_256, MhLength: -1}.Sum(data)
+	require.NoError(t, err)
+	require.True(t, errors.Is(CheckCodec(c), ErrUnsupportedCodec))
+
+	c, err = cid.Prefix{Version: 1, Codec: cid.GitRaw, MhType: mh.SHA2_256, MhLength: -1}.Sum(data)
+	require.NoError(t, err)
+	require.True(t, errors.Is(CheckCodec(c), ErrUnsupportedCodec))
+}
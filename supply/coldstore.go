@@ -0,0 +1,354 @@
+package supply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// KCold is the label of content offloaded to our cold store. Its value is the key of the object
+// holding the CAR of the content.
+const KCold = "cold"
+
+// ErrNoColdStore is returned when offloading content without a cold store
+var ErrNoColdStore = errors.New("no cold store")
+
+// ErrObjectNotFound is returned by object stores when a key doesn't exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ObjectStore is a remote blob storage like an S3 or GCS bucket where we offload cold content
+type ObjectStore interface {
+	// Put writes an object under the given key
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns a reader over an object
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object
+	Delete(ctx context.Context, key string) error
+}
+
+// DirObjectStore keeps objects as files in a directory, for instance a mounted network drive
+type DirObjectStore struct {
+	dir string
+}
+
+// NewDirObjectStore creates the directory if needed
+func NewDirObjectStore(dir string) (*DirObjectStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DirObjectStore{dir}, nil
+}
+
+// Put writes an object to a file
+func (d *DirObjectStore) Put(ctx context.Context, key string, r io.Reader) error {
+	// Write to a temporary file first so we never leave a partial object behind
+	tmp := filepath.Join(d.dir, key+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(d.dir, key))
+}
+
+// Get opens the file of an object
+func (d *DirObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.dir, key))
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	return f, err
+}
+
+// Delete removes the file of an object
+func (d *DirObjectStore) Delete(ctx context.Context, key string) error {
+	err := os.Remove(filepath.Join(d.dir, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// HTTPObjectStore reads and writes objects with PUT, GET and DELETE requests to a bucket endpoint.
+// Requests are signed with AWS signature version 4 when a signer is set, as S3 buckets and GCS HMAC
+// keys require, or authenticated with a static header like a GCS OAuth bearer token. Objects are
+// staged in a temporary file before uploading so the request has a length and a payload hash.
+type HTTPObjectStore struct {
+	Endpoint string
+	// Header is added to all the requests, usually for an Authorization header
+	Header http.Header
+	// Signer signs all the requests if set
+	Signer *SigV4
+	// TempDir is where objects are staged before uploading, the default temporary directory when empty
+	TempDir string
+	Client  *http.Client
+}
+
+// do sends a request with a body of the given size and hex encoded SHA256
+func (h *HTTPObjectStore) do(ctx context.Context, method, key string, body io.Reader, size int64, payloadHash string) (*http.Response, error) {
+	req, err := http.NewRequest(method, strings.TrimSuffix(h.Endpoint, "/")+"/"+key, body)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	// Buckets reject uploads of unknown length
+	req.ContentLength = size
+	if size == 0 {
+		req.Body = http.NoBody
+	}
+	for k, v := range h.Header {
+		req.Header[k] = v
+	}
+	if h.Signer != nil {
+		h.Signer.Sign(req, payloadHash, time.Now())
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotFound {
+		res.Body.Close()
+		return nil, ErrObjectNotFound
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s %s: %s", method, key, res.Status)
+	}
+	return res, nil
+}
+
+// Put stages an object in a temporary file to get its length and hash then uploads it
+func (h *HTTPObjectStore) Put(ctx context.Context, key string, r io.Reader) error {
+	f, err := ioutil.TempFile(h.TempDir, "pop-object-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, hash), r)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	// The client closes the body once sent
+	res, err := h.do(ctx, http.MethodPut, key, ioutil.NopCloser(f), size, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Get downloads an object
+func (h *HTTPObjectStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	res, err := h.do(ctx, http.MethodGet, key, nil, 0, emptyPayloadHash)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// Delete removes an object
+func (h *HTTPObjectStore) Delete(ctx context.Context, key string) error {
+	res, err := h.do(ctx, http.MethodDelete, key, nil, 0, emptyPayloadHash)
+	if errors.Is(err, ErrObjectNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// ParseObjectStore returns an object store from an http(s) bucket URL or a local directory path.
+// An auth value formatted as aws4:<access key>:<secret key>:<region> signs http requests, any other
+// value is sent as their Authorization header.
+func ParseObjectStore(uri string, auth string) (ObjectStore, error) {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		if signer, ok := ParseSigV4(auth); ok {
+			return &HTTPObjectStore{Endpoint: uri, Signer: signer}, nil
+		}
+		header := http.Header{}
+		if auth != "" {
+			header.Set("Authorization", auth)
+		}
+		return &HTTPObjectStore{Endpoint: uri, Header: header}, nil
+	}
+	return NewDirObjectStore(strings.TrimPrefix(uri, "file://"))
+}
+
+// SetColdStore offloads evicted content to the given object store instead of deleting it.
+// Offloaded content is pulled back the next time we need its store.
+func (s *Supply) SetColdStore(store ObjectStore) {
+	s.cold = store
+}
+
+// Offload moves a content and all the content sharing its store to our cold store and frees the local store
+func (s *Supply) Offload(ctx context.Context, root cid.Cid) error {
+	if s.cold == nil {
+		return ErrNoColdStore
+	}
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	from, err := s.getStoreID(root)
+	if err != nil {
+		return err
+	}
+	store, err := s.ms.Get(from)
+	if err != nil {
+		return err
+	}
+	recs, err := s.store.Records()
+	if err != nil {
+		return err
+	}
+	sid := strconv.FormatUint(uint64(from), 10)
+	moved := make(map[cid.Cid]*ContentRecord)
+	var roots []cid.Cid
+	for c, rec := range recs {
+		if rec.Labels[KStoreID] == sid {
+			moved[c] = rec
+			roots = append(roots, c)
+		}
+	}
+	key := root.String() + ".car"
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(car.WriteCar(ctx, store.DAG, roots, pw))
+	}()
+	if err := s.cold.Put(ctx, key, pr); err != nil {
+		pr.CloseWithError(err)
+		return err
+	}
+	for _, rec := range moved {
+		delete(rec.Labels, KStoreID)
+		rec.Labels[KCold] = key
+	}
+	if err := s.store.PutRecords(moved); err != nil {
+		return err
+	}
+	s.dropHot(roots...)
+	s.recordMove(TierWarm, TierCold, recordSize(moved[root]))
+	return s.ms.Delete(from)
+}
+
+// Recall loads a content offloaded to our cold store back in a new local store
+func (s *Supply) Recall(ctx context.Context, root cid.Cid) error {
+	if s.cold == nil {
+		return ErrNoColdStore
+	}
+	// Concurrent recalls of the same content would load it twice
+	s.cmu.Lock()
+	defer s.cmu.Unlock()
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return err
+	}
+	key, ok := rec.Labels[KCold]
+	if !ok {
+		return nil
+	}
+	r, err := s.cold.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	storeID := s.ms.Next()
+	store, err := s.ms.Get(storeID)
+	if err != nil {
+		return err
+	}
+	if _, err := car.LoadCar(store.Bstore, r); err != nil {
+		s.ms.Delete(storeID)
+		return err
+	}
+	recs, err := s.store.Records()
+	if err != nil {
+		s.ms.Delete(storeID)
+		return err
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	moved := make(map[cid.Cid]*ContentRecord)
+	for c, rec := range recs {
+		if rec.Labels[KCold] == key {
+			delete(rec.Labels, KCold)
+			rec.Labels[KStoreID] = strconv.FormatUint(uint64(storeID), 10)
+			// Recalled content is hot again so it isn't offloaded right away
+			rec.Labels[KLastAccess] = now
+			moved[c] = rec
+		}
+	}
+	if err := s.store.PutRecords(moved); err != nil {
+		s.ms.Delete(storeID)
+		return err
+	}
+	s.metrics.Count(MetricTierHits, 1, "tier", string(TierCold))
+	s.recordMove(TierCold, TierWarm, recordSize(moved[root]))
+	if err := s.cold.Delete(ctx, key); err != nil {
+		s.log.Warn().Err(err).Str("key", key).Msg("failed to delete recalled object")
+	}
+	return nil
+}
+
+// recallCold pulls back a content if it was offloaded
+func (s *Supply) recallCold(root cid.Cid) error {
+	if s.cold == nil {
+		return nil
+	}
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return nil
+	}
+	if _, ok := rec.Labels[KCold]; !ok {
+		return nil
+	}
+	return s.Recall(context.TODO(), root)
+}
+
+// removeCold deletes an offloaded content. The object is kept while other content still needs it.
+func (s *Supply) removeCold(root cid.Cid, key string) error {
+	if err := s.store.RemoveRecord(root); err != nil {
+		return err
+	}
+	recs, err := s.store.Records()
+	if err != nil {
+		return err
+	}
+	for _, rec := range recs {
+		if rec.Labels[KCold] == key {
+			return nil
+		}
+	}
+	if s.cold == nil {
+		return nil
+	}
+	return s.cold.Delete(context.TODO(), key)
+}
@@ -0,0 +1,119 @@
+package supply
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestColdStore(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, origBytes := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	require.NoError(t, s.Register(root, storeID))
+	require.Equal(t, ErrNoColdStore, s.Offload(ctx, root))
+
+	cold, err := ParseObjectStore(t.TempDir(), "")
+	require.NoError(t, err)
+	s.SetColdStore(cold)
+
+	require.NoError(t, s.Offload(ctx, root))
+	require.False(t, s.hasStore(storeID))
+	// Offloaded content doesn't count in our usage
+	usage, err := s.Usage()
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), usage)
+
+	rec, err := s.store.GetRecord(root)
+	require.NoError(t, err)
+	key := rec.Labels[KCold]
+	require.Equal(t, root.String()+".car", key)
+
+	// Getting the store pulls the content back
+	store, err := s.GetStore(root)
+	require.NoError(t, err)
+	n.VerifyFileTransferred(ctx, t, store.DAG, root, origBytes)
+
+	_, err = cold.Get(ctx, key)
+	require.Equal(t, ErrObjectNotFound, err)
+
+	// Removing offloaded content deletes the object
+	require.NoError(t, s.Offload(ctx, root))
+	require.NoError(t, s.RemoveContent(root))
+	_, err = cold.Get(ctx, key)
+	require.Equal(t, ErrObjectNotFound, err)
+	_, err = s.store.GetRecord(root)
+	require.Error(t, err)
+}
+
+func TestHTTPObjectStore(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			// Uploads have a length and the hash of their payload
+			if r.ContentLength < 0 {
+				w.WriteHeader(http.StatusLengthRequired)
+				return
+			}
+			b, err := ioutil.ReadAll(r.Body)
+			sum := sha256.Sum256(b)
+			if err != nil || int64(len(b)) != r.ContentLength || hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			objects[r.URL.Path] = b
+		case http.MethodGet:
+			b, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(b)
+		case http.MethodDelete:
+			delete(objects, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	store, err := ParseObjectStore(srv.URL+"/bucket", "aws4:key:secret:us-east-1")
+	require.NoError(t, err)
+	require.NoError(t, store.Put(ctx, "root.car", strings.NewReader("car bytes")))
+	r, err := store.Get(ctx, "root.car")
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, "car bytes", string(b))
+
+	require.NoError(t, store.Delete(ctx, "root.car"))
+	_, err = store.Get(ctx, "root.car")
+	require.Equal(t, ErrObjectNotFound, err)
+}
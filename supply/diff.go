@@ -0,0 +1,319 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-ipld-prime"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// KPrevious is the label of a content root pointing to the root of its previous version
+	KPrevious = "previous"
+	// KNext is the label of a content root pointing to the root of the version replacing it
+	KNext = "next"
+)
+
+// Diff lists the blocks added by a new version of a DAG. It is dispatched to caches holding the
+// previous version so they only pull the blocks they don't have yet.
+type Diff struct {
+	Previous cid.Cid
+	Root     cid.Cid
+	Blocks   []cid.Cid
+}
+
+// DiffSelector reaches all the blocks listed in a Diff without following their links
+func DiffSelector() ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	// Blocks is the third field of the Diff tuple
+	return ssb.ExploreIndex(2, ssb.ExploreAll(ssb.Matcher())).Node()
+}
+
+// DiffDAG returns the blocks reachable from the new root which are not part of the previous DAG.
+// Subtrees shared by both versions are skipped entirely as they are content addressed.
+func DiffDAG(ctx context.Context, prevDAG ipldformat.NodeGetter, prev cid.Cid, newDAG ipldformat.NodeGetter, root cid.Cid) ([]cid.Cid, error) {
+	old := cid.NewSet()
+	err := merkledag.Walk(ctx, merkledag.GetLinksWithDAG(prevDAG), prev, old.Visit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk previous DAG: %w", err)
+	}
+	var added []cid.Cid
+	seen := cid.NewSet()
+	err = merkledag.Walk(ctx, merkledag.GetLinksWithDAG(newDAG), root, func(c cid.Cid) bool {
+		if old.Has(c) || !seen.Visit(c) {
+			return false
+		}
+		added = append(added, c)
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk new DAG: %w", err)
+	}
+	return added, nil
+}
+
+func cacheKey(root cid.Cid, p peer.ID) datastore.Key {
+	return datastore.NewKey(root.String()).ChildString(p.String())
+}
+
+// recordCache remembers a provider pulled a content we dispatched
+func (s *Supply) recordCache(root cid.Cid, p peer.ID) {
+	if err := s.caches.Put(cacheKey(root, p), []byte{}); err != nil {
+		s.log.Error().Err(err).Msg("failed to record cache")
+	}
+}
+
+// Caches returns the providers who confirmed they pulled a content we dispatched
+func (s *Supply) Caches(root cid.Cid) ([]peer.ID, error) {
+	res, err := s.caches.Query(query.Query{
+		Prefix:   datastore.NewKey(root.String()).String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	var peers []peer.ID
+	for _, e := range entries {
+		p, err := peer.Decode(datastore.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			continue
+		}
+		peers = append(peers, p)
+	}
+	return peers, nil
+}
+
+// DispatchedRoots returns the roots of the content we dispatched which at least one cache pulled
+func (s *Supply) DispatchedRoots() ([]cid.Cid, error) {
+	res, err := s.caches.Query(query.Query{KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[cid.Cid]bool)
+	var roots []cid.Cid
+	for _, e := range entries {
+		root, err := cid.Decode(datastore.RawKey(e.Key).Parent().BaseNamespace())
+		if err != nil || seen[root] {
+			continue
+		}
+		seen[root] = true
+		roots = append(roots, root)
+	}
+	return roots, nil
+}
+
+// Scores returns the audit records of the caches we dispatched content to
+func (s *Supply) Scores() *CacheScores {
+	return s.scores
+}
+
+// Successor returns the root of the version replacing the given content if any
+func (s *Supply) Successor(root cid.Cid) (cid.Cid, error) {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return cid.Undef, err
+	}
+	next, ok := rec.Labels[KNext]
+	if !ok {
+		return cid.Undef, datastore.ErrNotFound
+	}
+	return cid.Decode(next)
+}
+
+// linkVersions records the old -> new root link on both content records
+func (s *Supply) linkVersions(prev, root cid.Cid) error {
+	if err := s.store.AddLabel(prev, KNext, root.String()); err != nil {
+		return err
+	}
+	return s.store.AddLabel(root, KPrevious, prev.String())
+}
+
+// DispatchUpdate dispatches a new version of a previously dispatched content. Connected caches holding
+// the previous version only pull the new blocks. If none of them are available we fall back to
+// a regular dispatch.
+func (s *Supply) DispatchUpdate(ctx context.Context, r Request, prev cid.Cid) (*Response, error) {
+	if err := CheckCodec(r.PayloadCID); err != nil {
+		return nil, err
+	}
+	providers, err := s.Caches(prev)
+	if err != nil {
+		return nil, err
+	}
+	providers = s.connected(providers)
+	if len(providers) == 0 {
+		return s.Dispatch(ctx, r)
+	}
+
+	prevStore, err := s.GetStore(prev)
+	if err != nil {
+		// We can't compute a diff without the previous version
+		return s.Dispatch(ctx, r)
+	}
+	store, err := s.GetStore(r.PayloadCID)
+	if err != nil {
+		return nil, err
+	}
+	added, err := DiffDAG(ctx, prevStore.DAG, prev, store.DAG, r.PayloadCID)
+	if err != nil {
+		return nil, err
+	}
+	diff := &Diff{
+		Previous: prev,
+		Root:     r.PayloadCID,
+		Blocks:   added,
+	}
+	// The diff is stored with the new version so it can be served from the same store
+	buf := new(bytes.Buffer)
+	if err := diff.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	dc, err := cid.Prefix{
+		Version:  1,
+		Codec:    cid.DagCBOR,
+		MhType:   multihash.SHA2_256,
+		MhLength: -1,
+	}.Sum(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	blk, err := blocks.NewBlockWithCid(buf.Bytes(), dc)
+	if err != nil {
+		return nil, err
+	}
+	if err := store.Bstore.Put(blk); err != nil {
+		return nil, err
+	}
+	if err := s.linkVersions(prev, r.PayloadCID); err != nil {
+		return nil, err
+	}
+
+	r.Previous = &prev
+	r.Diff = &dc
+
+	res := newResponse()
+	res.Diff = diff
+	res.unsub = s.watchDispatch(res, dc, r.PayloadCID)
+	res.watch(ctx)
+	s.send(ctx, res, r, dc, providers)
+	return res, nil
+}
+
+// connected filters the providers we are currently connected to and who support the dispatch protocol
+func (s *Supply) connected(providers []peer.ID) []peer.ID {
+	var protos []string
+	for _, p := range protoRegions(RequestProtocol, s.Regions()) {
+		protos = append(protos, string(p))
+	}
+	var peers []peer.ID
+	for _, p := range providers {
+		if len(s.h.Network().ConnsToPeer(p)) == 0 {
+			continue
+		}
+		supported, err := s.h.Peerstore().SupportsProtocols(p, protos...)
+		if err != nil || len(supported) == 0 {
+			continue
+		}
+		peers = append(peers, p)
+		if len(peers) == MaxReceiverCount {
+			break
+		}
+	}
+	return peers
+}
+
+// pullDiff prepares a store to receive the blocks of a new version on top of our copy of the
+// previous version. It returns false if we don't have the previous version.
+func (h *handler) pullDiff(ctx context.Context, p peer.ID, region string, req Request) bool {
+	if req.Previous == nil || req.Diff == nil {
+		return false
+	}
+	prev, err := h.s.GetRecord(*req.Previous)
+	if err != nil {
+		return false
+	}
+	sid, ok := prev.Labels[KStoreID]
+	if !ok {
+		return false
+	}
+	if h.accept(p, region, req) != nil {
+		return false
+	}
+	// Only the growth of the shared store counts towards the quota of the publisher
+	pub := h.quotas.publisher(req, p)
+	var grow uint64
+	if prevSize, _ := strconv.ParseUint(prev.Labels[KSize], 10, 64); req.Size > prevSize {
+		grow = req.Size - prevSize
+	}
+	admitted, err := h.quotas.admit(pub, grow)
+	if err != nil {
+		return false
+	}
+	// Both versions share the same store so the new version is complete once the new blocks are in
+	rec := newRecord(req, sid, region)
+	rec.Labels[KPrevious] = req.Previous.String()
+	rec.Labels[KPublisher] = pub.String()
+	err = h.s.PutRecord(req.PayloadCID, rec)
+	admitted()
+	if err != nil {
+		return false
+	}
+	if err := h.s.AddLabel(*req.Previous, KNext, req.PayloadCID.String()); err != nil {
+		return false
+	}
+	_, err = h.dt.OpenPullDataChannel(ctx, p, &req, *req.Diff, DiffSelector())
+	if err != nil {
+		h.s.RemoveRecord(req.PayloadCID)
+		return false
+	}
+	return true
+}
+
+// sharesStore checks if any other content uses the same store. Versions of a content may share a store
+// with others which are not adjacent to it so we count all the records pointing at the store. If the
+// records cannot be read we assume the store is shared and keep it.
+func (s *Supply) sharesStore(root cid.Cid, rec *ContentRecord) bool {
+	sid, ok := rec.Labels[KStoreID]
+	if !ok {
+		return false
+	}
+	recs, err := s.store.Records()
+	if err != nil {
+		return true
+	}
+	for c, other := range recs {
+		if !c.Equals(root) && other.Labels[KStoreID] == sid {
+			return true
+		}
+	}
+	return false
+}
+
+// requestRoot returns the content root of a transfer dispatched with a Request
+func requestRoot(state datatransfer.ChannelState) (cid.Cid, bool) {
+	req, ok := state.Voucher().(*Request)
+	if !ok {
+		return cid.Undef, false
+	}
+	return req.PayloadCID, true
+}
@@ -0,0 +1,118 @@
+package supply
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"testing"
+	"time"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchUpdate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(ctx, t)
+	t.Cleanup(func() {
+		err := n1.Dt.Stop(ctx)
+		require.NoError(t, err)
+	})
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+
+	// The new version appends a few chunks to the previous one
+	fname := n1.CreateRandomFile(t, 256000)
+	link1, storeID1, _ := n1.LoadFileToNewStore(ctx, t, fname)
+	root1 := link1.(cidlink.Link).Cid
+
+	extra := make([]byte, 10000)
+	rand.New(rand.NewSource(time.Now().UnixNano())).Read(extra)
+	f, err := os.OpenFile(fname, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.Write(extra)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	link2, storeID2, bytes2 := n1.LoadFileToNewStore(ctx, t, fname)
+	root2 := link2.(cidlink.Link).Cid
+
+	hn := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
+	require.NoError(t, hn.Register(root1, storeID1))
+	require.NoError(t, hn.Register(root2, storeID2))
+
+	var receivers []*Supply
+	var nodes []*testutil.TestNode
+	for i := 0; i < 2; i++ {
+		tnode := testutil.NewTestNode(mn, t)
+		tnode.SetupDataTransfer(ctx, t)
+		t.Cleanup(func() {
+			err := tnode.Dt.Stop(ctx)
+			require.NoError(t, err)
+		})
+		receivers = append(receivers, New(tnode.Host, tnode.Dt, tnode.Ds, tnode.Ms, regions, nil))
+		nodes = append(nodes, tnode)
+	}
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	time.Sleep(10 * time.Millisecond)
+
+	res, err := hn.Dispatch(ctx, Request{PayloadCID: root1, Size: n1.DAGSize(ctx, t, storeID1, root1)})
+	require.NoError(t, err)
+	select {
+	case <-res.Done():
+	case <-ctx.Done():
+		t.Fatal("dispatch not done")
+	}
+	require.Equal(t, 2, res.Confirmed())
+	res.Close()
+
+	caches, err := hn.Caches(root1)
+	require.NoError(t, err)
+	require.Len(t, caches, 2)
+
+	res, err = hn.DispatchUpdate(ctx, Request{PayloadCID: root2, Size: n1.DAGSize(ctx, t, storeID2, root2)}, root1)
+	require.NoError(t, err)
+	defer res.Close()
+	require.NotNil(t, res.Diff)
+	// 10 new leaves and the new root
+	require.Len(t, res.Diff.Blocks, 11)
+
+	for i := 0; i < 2; i++ {
+		rec, err := res.Next(ctx)
+		require.NoError(t, err)
+		require.Equal(t, root2, rec.PayloadCID)
+	}
+
+	next, err := hn.Successor(root1)
+	require.NoError(t, err)
+	require.Equal(t, root2, next)
+
+	for i, rcv := range receivers {
+		next, err := rcv.Successor(root1)
+		require.NoError(t, err)
+		require.Equal(t, root2, next)
+
+		store, err := rcv.GetStore(root2)
+		require.NoError(t, err)
+		nodes[i].VerifyFileTransferred(ctx, t, store.DAG, root2, bytes2)
+
+		// Removing the previous version keeps the blocks of the new one
+		require.NoError(t, rcv.RemoveContent(root1))
+		store, err = rcv.GetStore(root2)
+		require.NoError(t, err)
+		nodes[i].VerifyFileTransferred(ctx, t, store.DAG, root2, bytes2)
+	}
+}
@@ -0,0 +1,163 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DispatchTTL is how long we keep tracking a dispatch across restarts if it never completes
+const DispatchTTL = 24 * time.Hour
+
+// dispatchState is what we persist of an outstanding dispatch so caches can still pull the content
+// and we keep counting confirmations after a restart
+type dispatchState struct {
+	Root       cid.Cid
+	Base       cid.Cid
+	Attempted  int
+	Authorized []peer.ID
+	// Open is the number of unknown peers who may still pull announced content
+	Open      int
+	Confirmed []peer.ID
+	// Failures maps the encoded peer IDs of failed providers to the reason
+	Failures map[string]string
+	Started  int64
+}
+
+// track persists the state of the response every time it changes
+func (r *Response) track(base, root cid.Cid, persist func(dispatchState)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.base = base
+	r.root = root
+	r.started = time.Now()
+	r.persist = persist
+}
+
+// save persists the current state if tracked. Must hold the lock.
+func (r *Response) save() {
+	if r.persist == nil {
+		return
+	}
+	st := dispatchState{
+		Root:      r.root,
+		Base:      r.base,
+		Attempted: r.attempted,
+		Failures:  make(map[string]string, len(r.failures)),
+		Started:   r.started.Unix(),
+	}
+	for p := range r.settled {
+		if err, ok := r.failures[p]; ok {
+			st.Failures[peer.Encode(p)] = err.Error()
+			continue
+		}
+		st.Confirmed = append(st.Confirmed, p)
+	}
+	r.persist(st)
+}
+
+func dispatchKey(base cid.Cid) datastore.Key {
+	return datastore.NewKey(base.String())
+}
+
+// saveDispatch persists a dispatch with the peers authorized to pull it or forgets it once it's done
+func (s *Supply) saveDispatch(st dispatchState) {
+	key := dispatchKey(st.Base)
+	if len(st.Confirmed)+len(st.Failures) >= st.Attempted {
+		if err := s.dispatches.Delete(key); err != nil {
+			s.log.Error().Err(err).Str("root", st.Root.String()).Msg("failed to delete dispatch state")
+		}
+		return
+	}
+	st.Authorized, st.Open = s.validation.authorization(st.Base)
+	b, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	if err := s.dispatches.Put(key, b); err != nil {
+		s.log.Error().Err(err).Str("root", st.Root.String()).Msg("failed to save dispatch state")
+	}
+}
+
+// ResumeDispatches restores the authorizations of the dispatches which were still in progress when we
+// stopped and continues tracking their confirmations. It should be called once at startup.
+// Cancelling the context stops listening for confirmations.
+func (s *Supply) ResumeDispatches(ctx context.Context) ([]*Response, error) {
+	res, err := s.dispatches.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	var resumed []*Response
+	for _, e := range entries {
+		var st dispatchState
+		if err := json.Unmarshal(e.Value, &st); err != nil {
+			return resumed, err
+		}
+		started := time.Unix(st.Started, 0)
+		if time.Since(started) > DispatchTTL {
+			s.dispatches.Delete(datastore.NewKey(e.Key))
+			continue
+		}
+		for _, p := range st.Authorized {
+			s.validation.Authorize(st.Base, p)
+		}
+		s.validation.allowOpen(st.Base, st.Open)
+
+		r := newResponse()
+		r.attempted = st.Attempted
+		r.counted = true
+		r.Count = st.Attempted
+		for _, p := range st.Confirmed {
+			r.settled[p] = true
+			r.confirmed++
+		}
+		for id, reason := range st.Failures {
+			p, err := peer.Decode(id)
+			if err != nil {
+				continue
+			}
+			r.settled[p] = true
+			r.failures[p] = errors.New(reason)
+			r.failed++
+		}
+		r.unsub = s.watchDispatch(r, st.Base, st.Root)
+		r.mu.Lock()
+		r.started = started
+		r.checkDone()
+		r.mu.Unlock()
+		r.watch(ctx)
+		resumed = append(resumed, r)
+	}
+	return resumed, nil
+}
+
+// authorization returns the peers authorized to pull a content and how many unknown peers still can
+func (v *Validator) authorization(k cid.Cid) ([]peer.ID, int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var peers []peer.ID
+	if set, ok := v.auth[k]; ok {
+		peers = set.Peers()
+	}
+	return peers, v.open[k]
+}
+
+// allowOpen lets n more unknown peers pull a content
+func (v *Validator) allowOpen(k cid.Cid, n int) {
+	if n <= 0 {
+		return
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.open[k] += n
+}
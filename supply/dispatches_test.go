@@ -0,0 +1,58 @@
+package supply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-datastore/query"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/test"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResumeDispatches(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	p1 := test.RandPeerIDFatal(t)
+	p2 := test.RandPeerIDFatal(t)
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	res := newResponse()
+	res.unsub = s.watchDispatch(res, root, root)
+	s.validation.Authorize(root, p1)
+	s.validation.Authorize(root, p2)
+	res.setAttempted(2)
+	res.confirm(PRecord{Provider: p1, PayloadCID: root})
+	res.Close()
+
+	// Restarting loses the authorizations we keep in memory
+	s = New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	require.False(t, s.validation.authorized(root, p2))
+
+	resumed, err := s.ResumeDispatches(ctx)
+	require.NoError(t, err)
+	require.Len(t, resumed, 1)
+	require.True(t, s.validation.authorized(root, p2))
+
+	r := resumed[0]
+	require.Equal(t, 2, r.Attempted())
+	require.Equal(t, 1, r.Confirmed())
+
+	// The dispatch is forgotten once all the providers settled
+	r.fail(p2, errors.New("transfer failed"))
+	<-r.Done()
+	q, err := s.dispatches.Query(query.Query{})
+	require.NoError(t, err)
+	entries, err := q.Rest()
+	require.NoError(t, err)
+	require.Len(t, entries, 0)
+}
@@ -0,0 +1,144 @@
+package supply
+
+import (
+	"sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+)
+
+// EventHandler is called for data transfer events a subscriber is interested in
+type EventHandler func(datatransfer.Event, datatransfer.ChannelState)
+
+type subscriber struct {
+	id int
+	fn EventHandler
+}
+
+// EventManager subscribes once to the data transfer manager and routes events to handlers
+// registered for a given base CID or channel ID. Handlers registered with cid.Undef receive all events.
+type EventManager struct {
+	unsub datatransfer.Unsubscribe
+
+	mu       sync.Mutex
+	nextID   int
+	byCID    map[cid.Cid][]subscriber
+	byChanID map[datatransfer.ChannelID][]subscriber
+}
+
+// NewEventManager creates a new EventManager listening to the given data transfer manager
+func NewEventManager(dt datatransfer.Manager) *EventManager {
+	m := &EventManager{
+		byCID:    make(map[cid.Cid][]subscriber),
+		byChanID: make(map[datatransfer.ChannelID][]subscriber),
+	}
+	m.unsub = dt.SubscribeToEvents(m.route)
+	return m
+}
+
+func (m *EventManager) route(event datatransfer.Event, state datatransfer.ChannelState) {
+	m.mu.Lock()
+	// Copy the handlers so they can unsubscribe or subscribe while being called
+	var handlers []EventHandler
+	for _, s := range m.byCID[cid.Undef] {
+		handlers = append(handlers, s.fn)
+	}
+	for _, s := range m.byCID[state.BaseCID()] {
+		handlers = append(handlers, s.fn)
+	}
+	for _, s := range m.byChanID[state.ChannelID()] {
+		handlers = append(handlers, s.fn)
+	}
+	m.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(event, state)
+	}
+}
+
+// Subscribe to events for transfers of a given root CID. The returned function removes the handler
+// and can be called multiple times.
+func (m *EventManager) Subscribe(root cid.Cid, fn EventHandler) datatransfer.Unsubscribe {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	m.byCID[root] = append(m.byCID[root], subscriber{id, fn})
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.byCID[root] = remove(m.byCID[root], id)
+		if len(m.byCID[root]) == 0 {
+			delete(m.byCID, root)
+		}
+	}
+}
+
+// SubscribeChannel to events for a single data transfer channel
+func (m *EventManager) SubscribeChannel(chid datatransfer.ChannelID, fn EventHandler) datatransfer.Unsubscribe {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	id := m.nextID
+	m.nextID++
+	m.byChanID[chid] = append(m.byChanID[chid], subscriber{id, fn})
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.byChanID[chid] = remove(m.byChanID[chid], id)
+		if len(m.byChanID[chid]) == 0 {
+			delete(m.byChanID, chid)
+		}
+	}
+}
+
+// Close stops listening to data transfer events
+func (m *EventManager) Close() {
+	m.unsub()
+}
+
+func remove(subs []subscriber, id int) []subscriber {
+	for i, s := range subs {
+		if s.id == id {
+			return append(subs[:i:i], subs[i+1:]...)
+		}
+	}
+	return subs
+}
+
+// ContentListener is called when content is added to our supply or removed from it
+type ContentListener func(root cid.Cid, added bool)
+
+// contentListeners notifies the subsystems tracking the content we hold
+type contentListeners struct {
+	mu     sync.Mutex
+	nextID int
+	fns    map[int]ContentListener
+}
+
+func (l *contentListeners) subscribe(fn ContentListener) func() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.fns == nil {
+		l.fns = make(map[int]ContentListener)
+	}
+	id := l.nextID
+	l.nextID++
+	l.fns[id] = fn
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.fns, id)
+	}
+}
+
+func (l *contentListeners) notify(root cid.Cid, added bool) {
+	l.mu.Lock()
+	fns := make([]ContentListener, 0, len(l.fns))
+	for _, fn := range l.fns {
+		fns = append(fns, fn)
+	}
+	l.mu.Unlock()
+	for _, fn := range fns {
+		fn(root, added)
+	}
+}
@@ -0,0 +1,243 @@
+package supply
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+)
+
+const (
+	// KLastAccess is the unix time when the content was last retrieved from us or added
+	KLastAccess = "last-access"
+	// KAccessCount is the number of times the content was retrieved from us
+	KAccessCount = "access-count"
+	// KPinned marks content we published ourselves which is never evicted
+	KPinned = "pinned"
+)
+
+const (
+	// HighWaterMark is the fraction of the capacity above which we start evicting content
+	HighWaterMark = 0.9
+	// LowWaterMark is the fraction of the capacity we evict content down to
+	LowWaterMark = 0.75
+)
+
+// EvictionPolicy decides which content is the least valuable to keep
+type EvictionPolicy int
+
+const (
+	// NoEviction never evicts content automatically
+	NoEviction EvictionPolicy = iota
+	// LRU evicts the least recently accessed content first
+	LRU
+	// LFU evicts the least frequently accessed content first
+	LFU
+)
+
+// ParseEvictionPolicy returns an eviction policy from its name
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch name {
+	case "", "none":
+		return NoEviction, nil
+	case "lru":
+		return LRU, nil
+	case "lfu":
+		return LFU, nil
+	}
+	return NoEviction, fmt.Errorf("unknown eviction policy %s", name)
+}
+
+// storeUsage groups the content sharing a store as they can only be evicted together
+type storeUsage struct {
+	roots      []cid.Cid
+	size       uint64
+	lastAccess int64
+	accesses   uint64
+	pinned     bool
+}
+
+type evictor struct {
+	mu       sync.Mutex
+	policy   EvictionPolicy
+	capacity uint64
+}
+
+// EnableEviction starts evicting the least valuable content according to the policy whenever our
+// usage crosses the high water mark of the given capacity in bytes
+func (s *Supply) EnableEviction(policy EvictionPolicy, capacity uint64) {
+	s.emu.Lock()
+	defer s.emu.Unlock()
+	if policy == NoEviction || capacity == 0 {
+		s.evictor = nil
+		return
+	}
+	s.evictor = &evictor{policy: policy, capacity: capacity}
+}
+
+// RecordAccess updates the access stats of a content after it was retrieved from us
+func (s *Supply) RecordAccess(root cid.Cid) error {
+	s.emu.Lock()
+	defer s.emu.Unlock()
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return err
+	}
+	count, _ := strconv.ParseUint(rec.Labels[KAccessCount], 10, 64)
+	rec.Labels[KAccessCount] = strconv.FormatUint(count+1, 10)
+	rec.Labels[KLastAccess] = strconv.FormatInt(time.Now().Unix(), 10)
+	return s.store.PutRecord(root, rec)
+}
+
+// Pin prevents a content from being evicted
+func (s *Supply) Pin(root cid.Cid) error {
+	s.emu.Lock()
+	defer s.emu.Unlock()
+	return s.store.AddLabel(root, KPinned, "true")
+}
+
+// Usage returns the number of bytes used by the content in our supply
+func (s *Supply) Usage() (uint64, error) {
+	stores, err := s.storeUsage()
+	if err != nil {
+		return 0, err
+	}
+	var total uint64
+	for _, st := range stores {
+		total += st.size
+	}
+	return total, nil
+}
+
+func (s *Supply) storeUsage() (map[string]*storeUsage, error) {
+	recs, err := s.store.Records()
+	if err != nil {
+		return nil, err
+	}
+	stores := make(map[string]*storeUsage)
+	for root, rec := range recs {
+		sid, ok := rec.Labels[KStoreID]
+		if !ok {
+			continue
+		}
+		st, ok := stores[sid]
+		if !ok {
+			st = &storeUsage{}
+			stores[sid] = st
+		}
+		st.roots = append(st.roots, root)
+		// Versions sharing a store include the blocks of the previous versions
+		if size := s.contentSize(root, rec); size > st.size {
+			st.size = size
+		}
+		if last, err := strconv.ParseInt(rec.Labels[KLastAccess], 10, 64); err == nil && last > st.lastAccess {
+			st.lastAccess = last
+		}
+		if count, err := strconv.ParseUint(rec.Labels[KAccessCount], 10, 64); err == nil {
+			st.accesses += count
+		}
+		if _, ok := rec.Labels[KPinned]; ok {
+			st.pinned = true
+		}
+	}
+	return stores, nil
+}
+
+// contentSize returns the size of a content from its record or computes it from the blocks in store
+func (s *Supply) contentSize(root cid.Cid, rec *ContentRecord) uint64 {
+	if size, err := strconv.ParseUint(rec.Labels[KSize], 10, 64); err == nil {
+		return size
+	}
+	store, err := s.GetStore(root)
+	if err != nil {
+		return 0
+	}
+	ctx := context.TODO()
+	var size uint64
+	err = merkledag.Walk(ctx, func(ctx context.Context, c cid.Cid) ([]*ipldformat.Link, error) {
+		nd, err := store.DAG.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		size += uint64(len(nd.RawData()))
+		return nd.Links(), nil
+	}, root, cid.NewSet().Visit)
+	if err != nil {
+		return 0
+	}
+	// Remember the size so we don't walk the DAG again
+	if err := s.store.AddLabel(root, KSize, strconv.FormatUint(size, 10)); err != nil {
+		s.log.Error().Err(err).Str("root", root.String()).Msg("failed to record content size")
+	}
+	return size
+}
+
+// Evict removes the least valuable content until our usage is below the low water mark if it crossed
+// the high water mark. Content is offloaded instead if we have a cold store. It returns the roots of the
+// evicted content.
+func (s *Supply) Evict() ([]cid.Cid, error) {
+	s.emu.Lock()
+	e := s.evictor
+	s.emu.Unlock()
+	if e == nil {
+		return nil, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	stores, err := s.storeUsage()
+	if err != nil {
+		return nil, err
+	}
+	var usage uint64
+	var candidates []*storeUsage
+	for _, st := range stores {
+		usage += st.size
+		if !st.pinned {
+			candidates = append(candidates, st)
+		}
+	}
+	if float64(usage) <= HighWaterMark*float64(e.capacity) {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if e.policy == LFU && a.accesses != b.accesses {
+			return a.accesses < b.accesses
+		}
+		if a.lastAccess != b.lastAccess {
+			return a.lastAccess < b.lastAccess
+		}
+		return a.accesses < b.accesses
+	})
+	target := uint64(LowWaterMark * float64(e.capacity))
+	var evicted []cid.Cid
+	for _, st := range candidates {
+		if usage <= target {
+			break
+		}
+		if s.cold != nil {
+			// Offloading moves all the content sharing the store at once
+			if err := s.Offload(context.TODO(), st.roots[0]); err != nil {
+				return evicted, err
+			}
+			evicted = append(evicted, st.roots...)
+			usage -= st.size
+			continue
+		}
+		for _, root := range st.roots {
+			if err := s.RemoveContent(root); err != nil {
+				return evicted, err
+			}
+			evicted = append(evicted, root)
+		}
+		usage -= st.size
+	}
+	return evicted, nil
+}
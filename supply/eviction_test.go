@@ -0,0 +1,138 @@
+package supply
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEviction(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+
+	testCases := []struct {
+		name    string
+		policy  EvictionPolicy
+		evicted []int
+	}{
+		{
+			name:   "LRU",
+			policy: LRU,
+			// The oldest content goes first
+			evicted: []int{0, 1},
+		},
+		{
+			name:   "LFU",
+			policy: LFU,
+			// The least retrieved content goes first
+			evicted: []int{1, 2},
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			s := New(n.Host, n.Dt, n.Ds, n.Ms, regions, nil)
+			s.EnableEviction(testCase.policy, 1000)
+
+			var roots []cid.Cid
+			for i := 0; i < 4; i++ {
+				fname := n.CreateRandomFile(t, 1000)
+				link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+				root := link.(cidlink.Link).Cid
+				require.NoError(t, s.store.PutRecord(root, &ContentRecord{Labels: map[string]string{
+					KStoreID:     fmt.Sprintf("%d", storeID),
+					KSize:        "300",
+					KLastAccess:  strconv.Itoa(1000 + i),
+					KAccessCount: strconv.Itoa([]int{5, 1, 3, 4}[i]),
+				}}))
+				roots = append(roots, root)
+			}
+			// Pinned content is never evicted even if it is the least valuable
+			require.NoError(t, s.store.PutRecord(roots[3], &ContentRecord{Labels: map[string]string{
+				KStoreID:     "999",
+				KSize:        "300",
+				KLastAccess:  "1",
+				KAccessCount: "0",
+			}}))
+			require.NoError(t, s.Pin(roots[3]))
+
+			usage, err := s.Usage()
+			require.NoError(t, err)
+			require.Equal(t, uint64(1200), usage)
+
+			evicted, err := s.Evict()
+			require.NoError(t, err)
+			// 1200 bytes is above 900 so we evict down to 750
+			require.Len(t, evicted, 2)
+			for _, i := range testCase.evicted {
+				require.Contains(t, evicted, roots[i])
+			}
+			require.NotContains(t, evicted, roots[3])
+
+			usage, err = s.Usage()
+			require.NoError(t, err)
+			require.Equal(t, uint64(600), usage)
+
+			// Nothing to evict below the high water mark
+			evicted, err = s.Evict()
+			require.NoError(t, err)
+			require.Len(t, evicted, 0)
+
+			for _, root := range roots {
+				s.store.RemoveRecord(root)
+			}
+		})
+	}
+}
+
+func TestRecordAccessConcurrent(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{{Name: "TestRegion", Code: CustomRegion}}, nil)
+	s.EnableEviction(LFU, 1000)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+	require.NoError(t, s.store.PutRecord(root, &ContentRecord{Labels: map[string]string{
+		KStoreID: fmt.Sprintf("%d", storeID),
+		KSize:    "300",
+	}}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.NoError(t, s.RecordAccess(root))
+		}()
+	}
+	wg.Wait()
+
+	// No access is lost to concurrent updates of the record
+	rec, err := s.store.GetRecord(root)
+	require.NoError(t, err)
+	require.Equal(t, "20", rec.Labels[KAccessCount])
+}
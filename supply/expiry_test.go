@@ -0,0 +1,83 @@
+package supply
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpiry(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, regions, nil)
+
+	var roots []cid.Cid
+	var storeIDs []multistore.StoreID
+	for i := 0; i < 3; i++ {
+		fname := n.CreateRandomFile(t, 1000)
+		link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+		roots = append(roots, link.(cidlink.Link).Cid)
+		storeIDs = append(storeIDs, storeID)
+	}
+
+	now := time.Now()
+	// Already expired
+	require.NoError(t, s.store.PutRecord(roots[0], &ContentRecord{Labels: map[string]string{
+		KStoreID: fmt.Sprintf("%d", storeIDs[0]),
+		KExpires: strconv.FormatInt(now.Add(-time.Minute).Unix(), 10),
+	}}))
+	// Expires in a week
+	rec := &ContentRecord{Labels: map[string]string{
+		KStoreID: fmt.Sprintf("%d", storeIDs[1]),
+	}}
+	setExpiry(rec, uint64((7 * 24 * time.Hour).Seconds()))
+	require.NoError(t, s.store.PutRecord(roots[1], rec))
+	// Never expires
+	require.NoError(t, s.store.PutRecord(roots[2], &ContentRecord{Labels: map[string]string{
+		KStoreID: fmt.Sprintf("%d", storeIDs[2]),
+	}}))
+
+	expired, err := s.store.Expired(now)
+	require.NoError(t, err)
+	require.Equal(t, []cid.Cid{roots[0]}, expired)
+
+	expired, err = s.store.Expired(now.Add(8 * 24 * time.Hour))
+	require.NoError(t, err)
+	require.Len(t, expired, 2)
+	require.NotContains(t, expired, roots[2])
+
+	s.StartJanitor(ctx, 10*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		_, err := s.store.GetRecord(roots[0])
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+	// The store is dropped with the record
+	require.NotContains(t, n.Ms.List(), storeIDs[0])
+
+	_, err = s.GetStore(roots[1])
+	require.NoError(t, err)
+	_, err = s.GetStore(roots[2])
+	require.NoError(t, err)
+}
@@ -0,0 +1,166 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/myelnet/pop/internal/mmdb"
+)
+
+// DefaultGeoService returns the location of the requesting address in JSON
+const DefaultGeoService = "https://ipapi.co/json/"
+
+// ErrNoPublicIP is returned when locating a node without a public address
+var ErrNoPublicIP = errors.New("no public IP address")
+
+// continentRegions maps continent codes to the region serving them
+var continentRegions = map[string]string{
+	"AF": "Africa",
+	"AS": "Asia",
+	"EU": "Europe",
+	"NA": "NorthAmerica",
+	"OC": "Oceania",
+	"SA": "SouthAmerica",
+}
+
+// RegionForContinent returns the region of a two letter continent code. Continents without
+// a region such as Antarctica use the Global region.
+func RegionForContinent(code string) Region {
+	if name, ok := continentRegions[strings.ToUpper(code)]; ok {
+		if r, ok := lookupRegion(name); ok {
+			return r
+		}
+	}
+	r, _ := lookupRegion("Global")
+	return r
+}
+
+// Locator finds the continent a node is in
+type Locator interface {
+	Continent(ctx context.Context) (string, error)
+}
+
+// DetectRegion returns the region we are most likely in
+func DetectRegion(ctx context.Context, l Locator) (Region, error) {
+	code, err := l.Continent(ctx)
+	if err != nil {
+		return Region{}, err
+	}
+	return RegionForContinent(code), nil
+}
+
+// MMDBLocator looks up our public IP in a MaxMind country or city database
+type MMDBLocator struct {
+	Path string
+	// IP is our public address. We look for one on our network interfaces if nil.
+	IP net.IP
+}
+
+// Continent reads the continent code of our IP from the database
+func (m MMDBLocator) Continent(ctx context.Context) (string, error) {
+	ip := m.IP
+	if ip == nil {
+		var err error
+		ip, err = publicIP()
+		if err != nil {
+			return "", err
+		}
+	}
+	r, err := mmdb.Open(m.Path)
+	if err != nil {
+		return "", err
+	}
+	rec, err := r.Lookup(ip)
+	if err != nil {
+		return "", err
+	}
+	if fields, ok := rec.(map[string]interface{}); ok {
+		if c, ok := fields["continent"].(map[string]interface{}); ok {
+			if code, ok := c["code"].(string); ok {
+				return code, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no continent for %s", ip)
+}
+
+// publicIP returns the first public address of our network interfaces
+func publicIP() (net.IP, error) {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range addrs {
+		ipn, ok := a.(*net.IPNet)
+		if !ok {
+			continue
+		}
+		ip := ipn.IP
+		if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || isPrivate(ip) {
+			continue
+		}
+		return ip, nil
+	}
+	return nil, ErrNoPublicIP
+}
+
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+func isPrivate(ip net.IP) bool {
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTTPLocator asks a geolocation service where the requests come from. The service must return
+// a JSON object with a continent_code field like ipapi.co does.
+type HTTPLocator struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// Continent requests the continent code of our address from the service
+func (h HTTPLocator) Continent(ctx context.Context) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, h.Endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("geolocation service: %s", res.Status)
+	}
+	var loc struct {
+		ContinentCode string `json:"continent_code"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&loc); err != nil {
+		return "", err
+	}
+	if loc.ContinentCode == "" {
+		return "", errors.New("geolocation service returned no continent")
+	}
+	return loc.ContinentCode, nil
+}
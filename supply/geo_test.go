@@ -0,0 +1,30 @@
+package supply
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectRegion(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"ip": "81.2.69.160", "country": "GB", "continent_code": "EU"}`))
+	}))
+	defer srv.Close()
+
+	r, err := DetectRegion(ctx, HTTPLocator{Endpoint: srv.URL})
+	require.NoError(t, err)
+	require.Equal(t, "Europe", r.Name)
+
+	// Continents without a region use the Global region
+	require.Equal(t, "Global", RegionForContinent("AN").Name)
+	require.Equal(t, "SouthAmerica", RegionForContinent("sa").Name)
+
+	_, err = DetectRegion(ctx, MMDBLocator{Path: "missing.mmdb", IP: []byte{81, 2, 69, 160}})
+	require.Error(t, err)
+}
@@ -0,0 +1,209 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// DefaultSharedReadBytes is how many bytes of blocks read for the content being served we keep so the
+// other transfers of the same content don't read them again
+const DefaultSharedReadBytes = 8 << 20
+
+// flightCall is a call in progress or completed for the callers who joined it
+type flightCall struct {
+	wg  sync.WaitGroup
+	val interface{}
+	err error
+}
+
+// flightGroup runs a function once for all the concurrent callers with the same key
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[cid.Cid]*flightCall
+}
+
+// do runs fn unless a call for the key is in progress in which case it waits and returns its result.
+// shared is true for the callers who joined another call.
+func (g *flightGroup) do(key cid.Cid, fn func() (interface{}, error)) (val interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[cid.Cid]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(flightCall)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, c.err, false
+}
+
+// readShare holds the blocks of a content read while it is being served
+type readShare struct {
+	transfers int
+	blocks    map[cid.Cid][]byte
+	size      uint64
+	reads     flightGroup
+}
+
+// sharedReads lets the transfers of the same content served at the same time share the blocks read from
+// the store instead of reading each block once per transfer. Blocks are dropped once no transfer of the
+// content is in progress.
+type sharedReads struct {
+	mu     sync.Mutex
+	max    uint64
+	size   uint64
+	shares map[cid.Cid]*readShare
+}
+
+func newSharedReads(max uint64) *sharedReads {
+	return &sharedReads{
+		max:    max,
+		shares: make(map[cid.Cid]*readShare),
+	}
+}
+
+func (r *sharedReads) start(root cid.Cid) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sh, ok := r.shares[root]
+	if !ok {
+		sh = &readShare{blocks: make(map[cid.Cid][]byte)}
+		r.shares[root] = sh
+	}
+	sh.transfers++
+}
+
+func (r *sharedReads) end(root cid.Cid) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	sh, ok := r.shares[root]
+	if !ok {
+		return
+	}
+	sh.transfers--
+	if sh.transfers <= 0 {
+		delete(r.shares, root)
+		r.size -= sh.size
+	}
+}
+
+// share returns the blocks of a content being served or nil if the reads aren't shared
+func (r *sharedReads) share(root cid.Cid) *readShare {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.max == 0 {
+		return nil
+	}
+	return r.shares[root]
+}
+
+// get returns a block another transfer read
+func (r *sharedReads) get(sh *readShare, c cid.Cid) ([]byte, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b, ok := sh.blocks[c]
+	return b, ok
+}
+
+// put keeps a block for the other transfers while we are under the size limit. A share is dropped
+// from the map once its last transfer ends so its blocks are only counted while it's there.
+func (r *sharedReads) put(root cid.Cid, sh *readShare, c cid.Cid, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shares[root] != sh || r.size+uint64(len(b)) > r.max {
+		return
+	}
+	if _, ok := sh.blocks[c]; !ok {
+		sh.blocks[c] = b
+		sh.size += uint64(len(b))
+		r.size += uint64(len(b))
+	}
+}
+
+// loader reads the blocks of a content once for all the transfers serving it. Transfers of content nobody
+// else is serving read straight from the store.
+func (r *sharedReads) loader(root cid.Cid, fallback ipld.Loader, hit func()) ipld.Loader {
+	return func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		cl, ok := lnk.(cidlink.Link)
+		sh := r.share(root)
+		if !ok || sh == nil {
+			return fallback(lnk, lnkCtx)
+		}
+		if b, ok := r.get(sh, cl.Cid); ok {
+			hit()
+			return bytes.NewReader(b), nil
+		}
+		val, err, shared := sh.reads.do(cl.Cid, func() (interface{}, error) {
+			rd, err := fallback(lnk, lnkCtx)
+			if err != nil {
+				return nil, err
+			}
+			b, err := ioutil.ReadAll(rd)
+			if err != nil {
+				return nil, err
+			}
+			r.put(root, sh, cl.Cid, b)
+			return b, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if shared {
+			hit()
+		}
+		return bytes.NewReader(val.([]byte)), nil
+	}
+}
+
+// handleReadEvent tracks the transfers of the content we serve to share their reads
+func (s *Supply) handleReadEvent(event datatransfer.Event, state datatransfer.ChannelState) {
+	if state.Sender() != s.h.ID() {
+		return
+	}
+	switch event.Code {
+	case datatransfer.Open:
+		s.reads.start(state.BaseCID())
+	case datatransfer.Complete, datatransfer.Error, datatransfer.Cancel:
+		s.reads.end(state.BaseCID())
+	}
+}
+
+// SetSharedReadBytes changes how many bytes of blocks we keep in memory for the transfers of the content
+// we serve. Zero disables sharing the reads.
+func (s *Supply) SetSharedReadBytes(max uint64) {
+	s.reads.mu.Lock()
+	defer s.reads.mu.Unlock()
+	s.reads.max = max
+}
+
+// getStoreIDOnce finds the store of a content recalling or unsealing it once for all the deals asking for
+// it at the same time
+func (s *Supply) getStoreIDOnce(ctx context.Context, id cid.Cid) (multistore.StoreID, error) {
+	val, err, _ := s.lookups.do(id, func() (interface{}, error) {
+		return s.lookupStoreID(ctx, id)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return val.(multistore.StoreID), nil
+}
@@ -0,0 +1,116 @@
+package supply
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlightGroup(t *testing.T) {
+	var g flightGroup
+	gen := blocksutil.NewBlockGenerator()
+	key := gen.Next().Cid()
+
+	var calls int32
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err, sh := g.do(key, func() (interface{}, error) {
+				atomic.AddInt32(&calls, 1)
+				<-release
+				return 42, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, 42, val)
+			if sh {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	// Let the callers join the first call
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&calls))
+	require.Equal(t, int32(3), atomic.LoadInt32(&shared))
+
+	// Completed calls are not reused
+	val, _, sh := g.do(key, func() (interface{}, error) { return 7, nil })
+	require.Equal(t, 7, val)
+	require.False(t, sh)
+}
+
+func TestSharedReads(t *testing.T) {
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	blks := map[cid.Cid][]byte{}
+	var links []ipld.Link
+	for i := 0; i < 3; i++ {
+		b := gen.Next()
+		blks[b.Cid()] = b.RawData()
+		links = append(links, cidlink.Link{Cid: b.Cid()})
+	}
+	var reads int
+	fallback := func(lnk ipld.Link, _ ipld.LinkContext) (io.Reader, error) {
+		reads++
+		return bytes.NewReader(blks[lnk.(cidlink.Link).Cid]), nil
+	}
+	var hits int
+	r := newSharedReads(DefaultSharedReadBytes)
+	load := r.loader(root, fallback, func() { hits++ })
+
+	readAll := func() {
+		for _, l := range links {
+			rd, err := load(l, ipld.LinkContext{})
+			require.NoError(t, err)
+			b, err := ioutil.ReadAll(rd)
+			require.NoError(t, err)
+			require.Equal(t, blks[l.(cidlink.Link).Cid], b)
+		}
+	}
+
+	// Nothing is shared until a transfer of the content starts
+	readAll()
+	require.Equal(t, 3, reads)
+	require.Equal(t, uint64(0), r.size)
+
+	// Two transfers read each block once
+	r.start(root)
+	r.start(root)
+	readAll()
+	readAll()
+	require.Equal(t, 6, reads)
+	require.Equal(t, 3, hits)
+
+	// Blocks are dropped once the last transfer ends
+	r.end(root)
+	r.end(root)
+	require.Equal(t, uint64(0), r.size)
+	readAll()
+	require.Equal(t, 9, reads)
+
+	// We don't keep more than the limit
+	r = newSharedReads(uint64(len(blks[links[0].(cidlink.Link).Cid])))
+	load = r.loader(root, fallback, func() { hits++ })
+	r.start(root)
+	reads, hits = 0, 0
+	readAll()
+	readAll()
+	require.Equal(t, 5, reads)
+	require.Equal(t, 1, hits)
+}
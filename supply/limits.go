@@ -0,0 +1,119 @@
+package supply
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-ipld-prime"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ErrBlockTooLarge is returned when a block exceeds the maximum block size
+var ErrBlockTooLarge = errors.New("block too large")
+
+// ErrTooManyLinks is returned when a node has more links than allowed
+var ErrTooManyLinks = errors.New("too many links")
+
+// ErrDAGTooDeep is returned when a DAG is deeper than allowed
+var ErrDAGTooDeep = errors.New("DAG too deep")
+
+// DAGLimits bounds the shape of the DAGs we ingest so pathological DAGs can't exhaust our memory
+// while traversing them. A zero value disables the limit.
+type DAGLimits struct {
+	// MaxBlockSize is the maximum size of a block in bytes
+	MaxBlockSize uint64
+	// MaxLinks is the maximum number of links of a single node
+	MaxLinks int
+	// MaxDepth is the maximum number of links between the root and any block
+	MaxDepth int
+}
+
+// DefaultDAGLimits allow the blocks accepted by bitswap and DAGs much deeper than unixfs files need
+var DefaultDAGLimits = DAGLimits{
+	MaxBlockSize: 2 << 20,
+	MaxLinks:     16384,
+	MaxDepth:     256,
+}
+
+// Selector reaches all the blocks up to the maximum depth
+func (l DAGLimits) Selector() ipld.Node {
+	if l.MaxDepth <= 0 {
+		return AllSelector()
+	}
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return ssb.ExploreRecursive(selector.RecursionLimitDepth(int64(l.MaxDepth)),
+		ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node()
+}
+
+// CheckBlock returns an error if a block of the given size and number of links is over the limits
+func (l DAGLimits) CheckBlock(size uint64, links int) error {
+	if l.MaxBlockSize > 0 && size > l.MaxBlockSize {
+		return fmt.Errorf("%w: %d bytes over %d", ErrBlockTooLarge, size, l.MaxBlockSize)
+	}
+	if l.MaxLinks > 0 && links > l.MaxLinks {
+		return fmt.Errorf("%w: %d over %d", ErrTooManyLinks, links, l.MaxLinks)
+	}
+	return nil
+}
+
+// CheckDAG walks a DAG and returns an error as soon as a block is over the limits. Blocks past the
+// maximum depth are never loaded and blocks shared by multiple parents are checked once.
+func (l DAGLimits) CheckDAG(ctx context.Context, ng ipldformat.NodeGetter, root cid.Cid) error {
+	getLinks := func(ctx context.Context, c cid.Cid) ([]*ipldformat.Link, error) {
+		nd, err := ng.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.CheckBlock(uint64(len(nd.RawData())), len(nd.Links())); err != nil {
+			return nil, fmt.Errorf("%s: %w", c, err)
+		}
+		return nd.Links(), nil
+	}
+	var tooDeep error
+	seen := cid.NewSet()
+	err := merkledag.WalkDepth(ctx, getLinks, root, func(c cid.Cid, depth int) bool {
+		if l.MaxDepth > 0 && depth > l.MaxDepth {
+			tooDeep = fmt.Errorf("%w: %s at depth %d", ErrDAGTooDeep, c, depth)
+			return false
+		}
+		// Shared subtrees are only checked once
+		return seen.Visit(c)
+	})
+	if err != nil {
+		return err
+	}
+	return tooDeep
+}
+
+// BlockHook terminates graphsync requests as soon as we receive a block over the maximum size
+// so we don't keep loading a pathological DAG
+func (l DAGLimits) BlockHook() graphsync.OnIncomingBlockHook {
+	return func(p peer.ID, res graphsync.ResponseData, block graphsync.BlockData, ha graphsync.IncomingBlockHookActions) {
+		if err := l.CheckBlock(block.BlockSize(), 0); err != nil {
+			ha.TerminateWithError(fmt.Errorf("%s from %s: %w", block.Link(), p, err))
+		}
+	}
+}
+
+// SetDAGLimits changes the limits enforced on the content we pull
+func (s *Supply) SetDAGLimits(l DAGLimits) {
+	s.limits = l
+	s.net.SetDelegate(s.handler())
+}
+
+// CheckLimits checks the content we store for a given root is within our DAG limits
+func (s *Supply) CheckLimits(ctx context.Context, root cid.Cid) error {
+	store, err := s.GetStore(root)
+	if err != nil {
+		return err
+	}
+	return s.limits.CheckDAG(ctx, store.DAG, root)
+}
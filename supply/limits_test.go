@@ -0,0 +1,45 @@
+package supply
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-merkledag"
+	dstest "github.com/ipfs/go-merkledag/test"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckDAG(t *testing.T) {
+	ctx := context.Background()
+	dag := dstest.Mock()
+
+	// A chain of 5 nodes with a wide node at the bottom
+	wide := merkledag.NodeWithData([]byte("wide"))
+	for i := 0; i < 10; i++ {
+		leaf := merkledag.NewRawNode([]byte{byte(i)})
+		require.NoError(t, dag.Add(ctx, leaf))
+		require.NoError(t, wide.AddNodeLink("", leaf))
+	}
+	require.NoError(t, dag.Add(ctx, wide))
+	root := wide
+	for i := 0; i < 4; i++ {
+		parent := merkledag.NodeWithData([]byte("chain"))
+		require.NoError(t, parent.AddNodeLink("", root))
+		require.NoError(t, dag.Add(ctx, parent))
+		root = parent
+	}
+
+	require.NoError(t, DAGLimits{}.CheckDAG(ctx, dag, root.Cid()))
+	require.NoError(t, DefaultDAGLimits.CheckDAG(ctx, dag, root.Cid()))
+	require.NoError(t, DAGLimits{MaxDepth: 5, MaxLinks: 10}.CheckDAG(ctx, dag, root.Cid()))
+
+	err := DAGLimits{MaxDepth: 4}.CheckDAG(ctx, dag, root.Cid())
+	require.True(t, errors.Is(err, ErrDAGTooDeep))
+
+	err = DAGLimits{MaxLinks: 9}.CheckDAG(ctx, dag, root.Cid())
+	require.True(t, errors.Is(err, ErrTooManyLinks))
+
+	err = DAGLimits{MaxBlockSize: 8}.CheckDAG(ctx, dag, root.Cid())
+	require.True(t, errors.Is(err, ErrBlockTooLarge))
+}
@@ -0,0 +1,122 @@
+package supply
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+)
+
+// ContentInfo describes a content in our supply
+type ContentInfo struct {
+	Root    cid.Cid
+	Size    uint64
+	StoreID multistore.StoreID
+	// Region is the region we received the content for, empty if we added it ourselves
+	Region     string
+	ReceivedAt time.Time
+	Labels     map[string]string
+}
+
+// contentInfo decodes the labels of a record
+func contentInfo(root cid.Cid, rec *ContentRecord) ContentInfo {
+	info := ContentInfo{
+		Root:   root,
+		Region: rec.Labels[KRegion],
+		Labels: rec.Labels,
+	}
+	info.Size, _ = strconv.ParseUint(rec.Labels[KSize], 10, 64)
+	if sid, err := strconv.ParseUint(rec.Labels[KStoreID], 10, 64); err == nil {
+		info.StoreID = multistore.StoreID(sid)
+	}
+	if at, err := strconv.ParseInt(rec.Labels[KReceivedAt], 10, 64); err == nil {
+		info.ReceivedAt = time.Unix(at, 0)
+	}
+	return info
+}
+
+// ListOptions paginates and filters the content listed in our supply
+type ListOptions struct {
+	Offset int
+	// Limit is the maximum number of results, zero for no limit
+	Limit int
+	// Labels only matches records with all the given labels. An empty value matches any value.
+	Labels map[string]string
+}
+
+// matches checks if a record has all the labels we are filtering by
+func (o ListOptions) matches(rec *ContentRecord) bool {
+	for k, v := range o.Labels {
+		l, ok := rec.Labels[k]
+		if !ok {
+			return false
+		}
+		if v != "" && l != v {
+			return false
+		}
+	}
+	return true
+}
+
+// List returns a page of the records matching the options, most recently received first,
+// and the total number of matching records
+func (s *Store) List(opts ListOptions) ([]ContentInfo, int, error) {
+	recs, err := s.Records()
+	if err != nil {
+		return nil, 0, err
+	}
+	var infos []ContentInfo
+	for root, rec := range recs {
+		if !opts.matches(rec) {
+			continue
+		}
+		infos = append(infos, contentInfo(root, rec))
+	}
+	// Sort by root too so pages are stable for content received at the same time
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].ReceivedAt.Equal(infos[j].ReceivedAt) {
+			return infos[i].ReceivedAt.After(infos[j].ReceivedAt)
+		}
+		return infos[i].Root.String() < infos[j].Root.String()
+	})
+	total := len(infos)
+	if opts.Offset >= total {
+		return nil, total, nil
+	}
+	infos = infos[opts.Offset:]
+	if opts.Limit > 0 && opts.Limit < len(infos) {
+		infos = infos[:opts.Limit]
+	}
+	return infos, total, nil
+}
+
+// ListContent returns a page of the content we are currently providing and the total number
+// of content matching the options
+func (s *Supply) ListContent(opts ListOptions) ([]ContentInfo, int, error) {
+	infos, total, err := s.store.List(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i, info := range infos {
+		// Content we added ourselves may not have a size yet
+		if info.Size == 0 {
+			infos[i].Size = s.contentSize(info.Root, &ContentRecord{Labels: info.Labels})
+		}
+	}
+	return infos, total, nil
+}
+
+// Inspect returns the info of a single content in our supply
+func (s *Supply) Inspect(root cid.Cid) (ContentInfo, error) {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return ContentInfo{}, err
+	}
+	info := contentInfo(root, rec)
+	if info.Size == 0 {
+		info.Size = s.contentSize(root, rec)
+	}
+	return info, nil
+}
@@ -0,0 +1,60 @@
+package supply
+
+import (
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStoreList(t *testing.T) {
+	s := &Store{dssync.MutexWrap(datastore.NewMapDatastore())}
+
+	var roots []cid.Cid
+	for i, region := range []string{"Europe", "Asia", "Europe", ""} {
+		h, err := multihash.Sum([]byte{byte(i)}, multihash.SHA2_256, -1)
+		require.NoError(t, err)
+		root := cid.NewCidV1(cid.Raw, h)
+		rec := newRecord(Request{PayloadCID: root, Size: uint64(100 * (i + 1))}, "1", region)
+		// Make sure the receive times are ordered
+		rec.Labels[KReceivedAt] = []string{"10", "20", "30", "40"}[i]
+		require.NoError(t, s.PutRecord(root, rec))
+		roots = append(roots, root)
+	}
+
+	infos, total, err := s.List(ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Len(t, infos, 4)
+	// Most recent first
+	require.Equal(t, roots[3], infos[0].Root)
+	require.Equal(t, uint64(400), infos[0].Size)
+	require.Equal(t, "", infos[0].Region)
+	require.Equal(t, int64(40), infos[0].ReceivedAt.Unix())
+
+	infos, total, err = s.List(ListOptions{Offset: 1, Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Len(t, infos, 2)
+	require.Equal(t, roots[2], infos[0].Root)
+	require.Equal(t, roots[1], infos[1].Root)
+
+	infos, total, err = s.List(ListOptions{Labels: map[string]string{KRegion: "Europe"}})
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, roots[2], infos[0].Root)
+	require.Equal(t, roots[0], infos[1].Root)
+
+	// Empty values only check the label is present
+	_, total, err = s.List(ListOptions{Labels: map[string]string{KRegion: ""}})
+	require.NoError(t, err)
+	require.Equal(t, 3, total)
+
+	infos, total, err = s.List(ListOptions{Offset: 10})
+	require.NoError(t, err)
+	require.Equal(t, 4, total)
+	require.Len(t, infos, 0)
+}
@@ -0,0 +1,103 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/ipfs/go-datastore"
+)
+
+// ErrAlreadyInRegion is returned when joining a region we are already part of
+var ErrAlreadyInRegion = errors.New("already in region")
+
+// ErrNotInRegion is returned when leaving a region we are not part of
+var ErrNotInRegion = errors.New("not in region")
+
+var regionsKey = datastore.NewKey("active")
+
+// loadRegions returns the regions we were part of last time we joined or left a region
+func loadRegions(ds datastore.Batching) ([]Region, error) {
+	b, err := ds.Get(regionsKey)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(b, &names); err != nil {
+		return nil, err
+	}
+	return ParseRegions(names), nil
+}
+
+// saveRegions persists the regions we are part of. Must hold the regions lock.
+func (s *Supply) saveRegions() error {
+	names := make([]string, len(s.regions))
+	for i, r := range s.regions {
+		names[i] = r.Name
+	}
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+	return s.regionsDs.Put(regionsKey, b)
+}
+
+// Regions returns the regions we are currently part of
+func (s *Supply) Regions() []Region {
+	s.rmu.RLock()
+	defer s.rmu.RUnlock()
+	regions := make([]Region, len(s.regions))
+	copy(regions, s.regions)
+	return regions
+}
+
+// JoinRegion starts receiving dispatches and announcements for a new region without restarting.
+// Sub-regions such as Europe/France are regions with their own protocols and topics.
+// The context bounds how long we listen to announcements in the region.
+func (s *Supply) JoinRegion(ctx context.Context, r Region) error {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	for _, region := range s.regions {
+		if region.Name == r.Name {
+			return ErrAlreadyInRegion
+		}
+	}
+	if s.ps != nil {
+		if err := s.joinTopic(ctx, r); err != nil {
+			return err
+		}
+	}
+	s.regions = append(s.regions, r)
+	s.net.addRegion(r)
+	if s.relayer != nil {
+		s.h.SetStreamHandler(protoRegions(RelayProtocol, []Region{r})[0], s.handleRelayStream)
+	}
+	s.validation.setPPB(minPPB(s.regions))
+	return s.saveRegions()
+}
+
+// LeaveRegion stops receiving dispatches and announcements for a region. Content we received
+// in the region is kept.
+func (s *Supply) LeaveRegion(name string) error {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	idx := -1
+	for i, region := range s.regions {
+		if region.Name == name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return ErrNotInRegion
+	}
+	r := s.regions[idx]
+	s.regions = append(s.regions[:idx:idx], s.regions[idx+1:]...)
+	s.net.removeRegion(r)
+	s.h.RemoveStreamHandler(protoRegions(RelayProtocol, []Region{r})[0])
+	if err := s.leaveTopic(name); err != nil {
+		return err
+	}
+	s.validation.setPPB(minPPB(s.regions))
+	return s.saveRegions()
+}
@@ -0,0 +1,57 @@
+package supply
+
+import (
+	"context"
+	"testing"
+
+	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJoinLeaveRegion(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+	ps, err := pubsub.NewGossipSub(ctx, n.Host)
+	require.NoError(t, err)
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Europe"]}, nil)
+	require.NoError(t, s.EnableAnnouncements(ctx, ps))
+
+	handles := func(name string) bool {
+		proto := protoRegions(RequestProtocol, []Region{Regions[name]})[0]
+		for _, p := range n.Host.Mux().Protocols() {
+			if protocol.ID(p) == proto {
+				return true
+			}
+		}
+		return false
+	}
+	require.True(t, handles("Europe"))
+	require.False(t, handles("Asia"))
+
+	require.NoError(t, s.JoinRegion(ctx, Regions["Asia"]))
+	require.Equal(t, ErrAlreadyInRegion, s.JoinRegion(ctx, Regions["Asia"]))
+	require.Equal(t, []Region{Regions["Europe"], Regions["Asia"]}, s.Regions())
+	require.True(t, handles("Asia"))
+	_, ok := s.topic("Asia")
+	require.True(t, ok)
+
+	require.NoError(t, s.LeaveRegion("Europe"))
+	require.Equal(t, ErrNotInRegion, s.LeaveRegion("Europe"))
+	require.Equal(t, []Region{Regions["Asia"]}, s.Regions())
+	require.False(t, handles("Europe"))
+	_, ok = s.topic("Europe")
+	require.False(t, ok)
+
+	// The active regions are restored on restart
+	s = New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Europe"]}, nil)
+	require.Equal(t, []Region{Regions["Asia"]}, s.Regions())
+}
@@ -0,0 +1,110 @@
+package supply
+
+import (
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+)
+
+// Names of the metrics we report
+const (
+	// MetricDispatchesSent counts the dispatch requests delivered to caches
+	MetricDispatchesSent = "pop_supply_dispatches_sent_total"
+	// MetricDispatchesAccepted counts the caches who pulled dispatched content
+	MetricDispatchesAccepted = "pop_supply_dispatches_accepted_total"
+	// MetricTransfersCompleted counts the content we finished pulling
+	MetricTransfersCompleted = "pop_supply_transfers_completed_total"
+	// MetricTransfersFailed counts the content we failed to pull
+	MetricTransfersFailed = "pop_supply_transfers_failed_total"
+	// MetricBytesIngested counts the bytes we pulled in each region
+	MetricBytesIngested = "pop_supply_ingested_bytes_total"
+	// MetricBytesCached is the size of all the content we cache
+	MetricBytesCached = "pop_supply_cached_bytes"
+	// MetricTransferDuration observes how long pulling content took in seconds
+	MetricTransferDuration = "pop_supply_transfer_duration_seconds"
+	// MetricTierHits counts the blocks served from memory or disk and the content recalled from our cold store
+	MetricTierHits = "pop_supply_tier_hits_total"
+	// MetricTierMoves counts the content moved between tiers
+	MetricTierMoves = "pop_supply_tier_moves_total"
+	// MetricTierMovedBytes counts the bytes moved between tiers
+	MetricTierMovedBytes = "pop_supply_tier_moved_bytes_total"
+	// MetricBytesHot is the size of the content kept in memory
+	MetricBytesHot = "pop_supply_hot_bytes"
+	// MetricSharedReads counts the blocks served from a read of another transfer of the same content
+	MetricSharedReads = "pop_supply_shared_reads_total"
+)
+
+// Metrics records the activity of our supply. Labels are passed as key value pairs.
+type Metrics interface {
+	// Count adds a value to a counter
+	Count(name string, v float64, labels ...string)
+	// Gauge sets the current value of a gauge
+	Gauge(name string, v float64, labels ...string)
+	// Observe records a value in a histogram
+	Observe(name string, v float64, labels ...string)
+}
+
+// NopMetrics discards all the metrics. It is the default.
+type NopMetrics struct{}
+
+// Count does nothing
+func (NopMetrics) Count(string, float64, ...string) {}
+
+// Gauge does nothing
+func (NopMetrics) Gauge(string, float64, ...string) {}
+
+// Observe does nothing
+func (NopMetrics) Observe(string, float64, ...string) {}
+
+// SetMetrics reports our activity to the given metrics
+func (s *Supply) SetMetrics(m Metrics) {
+	s.metrics = m
+}
+
+// transferTimer keeps track of when we started pulling content
+type transferTimer struct {
+	mu      sync.Mutex
+	started map[datatransfer.ChannelID]time.Time
+}
+
+func (t *transferTimer) start(chid datatransfer.ChannelID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.started[chid] = time.Now()
+}
+
+// stop returns how long the transfer took if we saw it start
+func (t *transferTimer) stop(chid datatransfer.ChannelID) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	start, ok := t.started[chid]
+	delete(t.started, chid)
+	return time.Since(start), ok
+}
+
+// recordPulled reports a transfer we received in the given region
+func (s *Supply) recordPulled(state datatransfer.ChannelState, region string, err bool) {
+	if err {
+		s.metrics.Count(MetricTransfersFailed, 1, "region", region)
+	} else {
+		s.metrics.Count(MetricTransfersCompleted, 1, "region", region)
+		s.metrics.Count(MetricBytesIngested, float64(state.Received()), "region", region)
+	}
+	if d, ok := s.timer.stop(state.ChannelID()); ok {
+		s.metrics.Observe(MetricTransferDuration, d.Seconds(), "region", region)
+	}
+	if usage, uerr := s.Usage(); uerr == nil {
+		s.metrics.Gauge(MetricBytesCached, float64(usage))
+	}
+}
+
+// contentRegion returns the region we received content in if any
+func (s *Supply) contentRegion(root cid.Cid) string {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return ""
+	}
+	return rec.Labels[KRegion]
+}
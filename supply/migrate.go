@@ -0,0 +1,106 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/filecoin-project/go-multistore"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-merkledag"
+)
+
+// PutRecords writes multiple records in a single batch so they are all updated or none is
+func (s *Store) PutRecords(recs map[cid.Cid]*ContentRecord) error {
+	batch, err := s.ds.Batch()
+	if err != nil {
+		return err
+	}
+	for id, r := range recs {
+		rec, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if err := batch.Put(datastore.NewKey(id.String()), rec); err != nil {
+			return err
+		}
+	}
+	return batch.Commit()
+}
+
+// MoveContent transfers a content to another store. All the contents sharing the source store, like
+// other versions of the same content, are moved with it. The blocks are copied and verified to be
+// complete in the destination store before the records are updated and the source store is deleted.
+// Callers keeping track of store IDs must use the new one once it returns.
+func (s *Supply) MoveContent(ctx context.Context, root cid.Cid, to multistore.StoreID) error {
+	from, err := s.getStoreID(root)
+	if err != nil {
+		return err
+	}
+	if from == to {
+		return nil
+	}
+	if !s.hasStore(to) {
+		return ErrStoreNotFound
+	}
+	src, err := s.ms.Get(from)
+	if err != nil {
+		return err
+	}
+	dst, err := s.ms.Get(to)
+	if err != nil {
+		return err
+	}
+	recs, err := s.store.Records()
+	if err != nil {
+		return err
+	}
+	sid := fmt.Sprintf("%d", from)
+	moved := make(map[cid.Cid]*ContentRecord)
+	for c, rec := range recs {
+		if rec.Labels[KStoreID] == sid {
+			moved[c] = rec
+		}
+	}
+	for c := range moved {
+		if err := copyDAG(ctx, src, dst, c); err != nil {
+			return fmt.Errorf("copying %s: %w", c, err)
+		}
+	}
+	// The destination store only reads local blocks so walking it fails if any block is missing
+	for c := range moved {
+		if err := merkledag.Walk(ctx, merkledag.GetLinksWithDAG(dst.DAG), c, cid.NewSet().Visit); err != nil {
+			return fmt.Errorf("verifying %s: %w", c, err)
+		}
+	}
+	for _, rec := range moved {
+		rec.Labels[KStoreID] = fmt.Sprintf("%d", to)
+	}
+	if err := s.store.PutRecords(moved); err != nil {
+		return err
+	}
+	return s.ms.Delete(from)
+}
+
+// copyDAG copies all the blocks of a DAG between stores
+func copyDAG(ctx context.Context, src, dst *multistore.Store, root cid.Cid) error {
+	var perr error
+	seen := cid.NewSet()
+	err := merkledag.Walk(ctx, merkledag.GetLinksWithDAG(src.DAG), root, func(c cid.Cid) bool {
+		if perr != nil || !seen.Visit(c) {
+			return false
+		}
+		blk, err := src.Bstore.Get(c)
+		if err != nil {
+			perr = err
+			return false
+		}
+		perr = dst.Bstore.Put(blk)
+		return perr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return perr
+}
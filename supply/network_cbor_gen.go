@@ -7,7 +7,9 @@ import (
 	"io"
 	"sort"
 
+	big "github.com/filecoin-project/go-state-types/big"
 	cid "github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
 	cbg "github.com/whyrusleeping/cbor-gen"
 	xerrors "golang.org/x/xerrors"
 )
@@ -16,7 +18,7 @@ var _ = xerrors.Errorf
 var _ = cid.Undef
 var _ = sort.Sort
 
-var lengthBufRequest = []byte{130}
+var lengthBufRequest = []byte{137}
 
 func (t *Request) MarshalCBOR(w io.Writer) error {
 	if t == nil {
@@ -41,6 +43,85 @@ func (t *Request) MarshalCBOR(w io.Writer) error {
 		return err
 	}
 
+	// t.Previous (cid.Cid) (struct)
+
+	if t.Previous == nil {
+		if _, err := w.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCidBuf(scratch, w, *t.Previous); err != nil {
+			return xerrors.Errorf("failed to write cid field t.Previous: %w", err)
+		}
+	}
+
+	// t.Diff (cid.Cid) (struct)
+
+	if t.Diff == nil {
+		if _, err := w.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := cbg.WriteCidBuf(scratch, w, *t.Diff); err != nil {
+			return xerrors.Errorf("failed to write cid field t.Diff: %w", err)
+		}
+	}
+
+	// t.TTL (uint64) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.TTL)); err != nil {
+		return err
+	}
+
+	// t.PricePerByte (big.Int) (struct)
+
+	if t.PricePerByte == nil {
+		if _, err := w.Write(cbg.CborNull); err != nil {
+			return err
+		}
+	} else {
+		if err := t.PricePerByte.MarshalCBOR(w); err != nil {
+			return err
+		}
+	}
+
+	// t.Schema ([]uint8) (slice)
+	if len(t.Schema) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field t.Schema was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Schema))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(t.Schema[:]); err != nil {
+		return err
+	}
+
+	// t.Publisher (peer.ID) (string)
+	if len(t.Publisher) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Publisher was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Publisher))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Publisher)); err != nil {
+		return err
+	}
+
+	// t.Signature ([]uint8) (slice)
+	if len(t.Signature) > cbg.ByteArrayMaxLen {
+		return xerrors.Errorf("Byte array in field t.Signature was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(t.Signature))); err != nil {
+		return err
+	}
+
+	if _, err := w.Write(t.Signature[:]); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -58,7 +139,7 @@ func (t *Request) UnmarshalCBOR(r io.Reader) error {
 		return fmt.Errorf("cbor input should be of type array")
 	}
 
-	if extra != 2 {
+	if extra != 9 {
 		return fmt.Errorf("cbor input had wrong number of fields")
 	}
 
@@ -87,6 +168,559 @@ func (t *Request) UnmarshalCBOR(r io.Reader) error {
 		}
 		t.Size = uint64(extra)
 
+	}
+	// t.Previous (cid.Cid) (struct)
+
+	{
+
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != cbg.CborNull[0] {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+
+			c, err := cbg.ReadCid(br)
+			if err != nil {
+				return xerrors.Errorf("failed to read cid field t.Previous: %w", err)
+			}
+
+			t.Previous = &c
+		}
+
+	}
+	// t.Diff (cid.Cid) (struct)
+
+	{
+
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != cbg.CborNull[0] {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+
+			c, err := cbg.ReadCid(br)
+			if err != nil {
+				return xerrors.Errorf("failed to read cid field t.Diff: %w", err)
+			}
+
+			t.Diff = &c
+		}
+
+	}
+	// t.TTL (uint64) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.TTL = uint64(extra)
+
+	}
+	// t.PricePerByte (big.Int) (struct)
+
+	{
+
+		b, err := br.ReadByte()
+		if err != nil {
+			return err
+		}
+		if b != cbg.CborNull[0] {
+			if err := br.UnreadByte(); err != nil {
+				return err
+			}
+			t.PricePerByte = new(big.Int)
+			if err := t.PricePerByte.UnmarshalCBOR(br); err != nil {
+				return xerrors.Errorf("unmarshaling t.PricePerByte pointer: %w", err)
+			}
+		}
+
+	}
+	// t.Schema ([]uint8) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.ByteArrayMaxLen {
+		return fmt.Errorf("t.Schema: byte array too large (%d)", extra)
+	}
+	if maj != cbg.MajByteString {
+		return fmt.Errorf("expected byte array")
+	}
+
+	if extra > 0 {
+		t.Schema = make([]uint8, extra)
+	}
+
+	if _, err := io.ReadFull(br, t.Schema[:]); err != nil {
+		return err
+	}
+	// t.Publisher (peer.ID) (string)
+
+	{
+		sval, err := cbg.ReadStringBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+
+		t.Publisher = peer.ID(sval)
+	}
+	// t.Signature ([]uint8) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.ByteArrayMaxLen {
+		return fmt.Errorf("t.Signature: byte array too large (%d)", extra)
+	}
+	if maj != cbg.MajByteString {
+		return fmt.Errorf("expected byte array")
+	}
+
+	if extra > 0 {
+		t.Signature = make([]uint8, extra)
+	}
+
+	if _, err := io.ReadFull(br, t.Signature[:]); err != nil {
+		return err
+	}
+	return nil
+}
+
+var lengthBufRequestResult = []byte{131}
+
+func (t *RequestResult) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufRequestResult); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Status (supply.ValidationStatus) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Status)); err != nil {
+		return err
+	}
+
+	// t.Message (string) (string)
+	if len(t.Message) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Message was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Message))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Message)); err != nil {
+		return err
+	}
+
+	// t.PricePerByte (big.Int) (struct)
+	if err := t.PricePerByte.MarshalCBOR(w); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *RequestResult) UnmarshalCBOR(r io.Reader) error {
+	*t = RequestResult{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 3 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Status (supply.ValidationStatus) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.Status = ValidationStatus(extra)
+
+	}
+	// t.Message (string) (string)
+
+	{
+		sval, err := cbg.ReadStringBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+
+		t.Message = string(sval)
+	}
+	// t.PricePerByte (big.Int) (struct)
+
+	{
+
+		if err := t.PricePerByte.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.PricePerByte: %w", err)
+		}
+
+	}
+	return nil
+}
+
+var lengthBufDiff = []byte{131}
+
+func (t *Diff) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufDiff); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Previous (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.Previous); err != nil {
+		return xerrors.Errorf("failed to write cid field t.Previous: %w", err)
+	}
+
+	// t.Root (cid.Cid) (struct)
+
+	if err := cbg.WriteCidBuf(scratch, w, t.Root); err != nil {
+		return xerrors.Errorf("failed to write cid field t.Root: %w", err)
+	}
+
+	// t.Blocks ([]cid.Cid) (slice)
+	if len(t.Blocks) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.Blocks was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.Blocks))); err != nil {
+		return err
+	}
+	for _, v := range t.Blocks {
+		if err := cbg.WriteCidBuf(scratch, w, v); err != nil {
+			return xerrors.Errorf("failed writing cid field t.Blocks: %w", err)
+		}
+	}
+	return nil
+}
+
+func (t *Diff) UnmarshalCBOR(r io.Reader) error {
+	*t = Diff{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 3 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Previous (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.Previous: %w", err)
+		}
+
+		t.Previous = c
+
+	}
+	// t.Root (cid.Cid) (struct)
+
+	{
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("failed to read cid field t.Root: %w", err)
+		}
+
+		t.Root = c
+
+	}
+	// t.Blocks ([]cid.Cid) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("t.Blocks: array too large (%d)", extra)
+	}
+
+	if maj != cbg.MajArray {
+		return fmt.Errorf("expected cbor array")
+	}
+
+	if extra > 0 {
+		t.Blocks = make([]cid.Cid, extra)
+	}
+
+	for i := 0; i < int(extra); i++ {
+
+		c, err := cbg.ReadCid(br)
+		if err != nil {
+			return xerrors.Errorf("reading cid field t.Blocks failed: %w", err)
+		}
+		t.Blocks[i] = c
+	}
+
+	return nil
+}
+
+var lengthBufAnnouncement = []byte{130}
+
+func (t *Announcement) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufAnnouncement); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Request (supply.Request) (struct)
+	if err := t.Request.MarshalCBOR(w); err != nil {
+		return err
+	}
+
+	// t.Addrs ([][]uint8) (slice)
+	if len(t.Addrs) > cbg.MaxLength {
+		return xerrors.Errorf("Slice value in field t.Addrs was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajArray, uint64(len(t.Addrs))); err != nil {
+		return err
+	}
+	for _, v := range t.Addrs {
+		if len(v) > cbg.ByteArrayMaxLen {
+			return xerrors.Errorf("Byte array in field v was too long")
+		}
+
+		if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajByteString, uint64(len(v))); err != nil {
+			return err
+		}
+
+		if _, err := w.Write(v[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Announcement) UnmarshalCBOR(r io.Reader) error {
+	*t = Announcement{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 2 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Request (supply.Request) (struct)
+
+	{
+
+		if err := t.Request.UnmarshalCBOR(br); err != nil {
+			return xerrors.Errorf("unmarshaling t.Request: %w", err)
+		}
+
+	}
+	// t.Addrs ([][]uint8) (slice)
+
+	maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+
+	if extra > cbg.MaxLength {
+		return fmt.Errorf("t.Addrs: array too large (%d)", extra)
+	}
+
+	if maj != cbg.MajArray {
+		return fmt.Errorf("expected cbor array")
+	}
+
+	if extra > 0 {
+		t.Addrs = make([][]uint8, extra)
+	}
+
+	for i := 0; i < int(extra); i++ {
+		{
+			var maj byte
+			var extra uint64
+			var err error
+
+			maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+			if err != nil {
+				return err
+			}
+
+			if extra > cbg.ByteArrayMaxLen {
+				return fmt.Errorf("t.Addrs[i]: byte array too large (%d)", extra)
+			}
+			if maj != cbg.MajByteString {
+				return fmt.Errorf("expected byte array")
+			}
+
+			if extra > 0 {
+				t.Addrs[i] = make([]uint8, extra)
+			}
+
+			if _, err := io.ReadFull(br, t.Addrs[i][:]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+var lengthBufDispatchResult = []byte{131}
+
+func (t *DispatchResult) MarshalCBOR(w io.Writer) error {
+	if t == nil {
+		_, err := w.Write(cbg.CborNull)
+		return err
+	}
+	if _, err := w.Write(lengthBufDispatchResult); err != nil {
+		return err
+	}
+
+	scratch := make([]byte, 9)
+
+	// t.Status (supply.ValidationStatus) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.Status)); err != nil {
+		return err
+	}
+
+	// t.Message (string) (string)
+	if len(t.Message) > cbg.MaxLength {
+		return xerrors.Errorf("Value in field t.Message was too long")
+	}
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajTextString, uint64(len(t.Message))); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, string(t.Message)); err != nil {
+		return err
+	}
+
+	// t.RetryAfter (uint64) (uint64)
+
+	if err := cbg.WriteMajorTypeHeaderBuf(scratch, w, cbg.MajUnsignedInt, uint64(t.RetryAfter)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (t *DispatchResult) UnmarshalCBOR(r io.Reader) error {
+	*t = DispatchResult{}
+
+	br := cbg.GetPeeker(r)
+	scratch := make([]byte, 8)
+
+	maj, extra, err := cbg.CborReadHeaderBuf(br, scratch)
+	if err != nil {
+		return err
+	}
+	if maj != cbg.MajArray {
+		return fmt.Errorf("cbor input should be of type array")
+	}
+
+	if extra != 3 {
+		return fmt.Errorf("cbor input had wrong number of fields")
+	}
+
+	// t.Status (supply.ValidationStatus) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.Status = ValidationStatus(extra)
+
+	}
+	// t.Message (string) (string)
+
+	{
+		sval, err := cbg.ReadStringBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+
+		t.Message = string(sval)
+	}
+	// t.RetryAfter (uint64) (uint64)
+
+	{
+
+		maj, extra, err = cbg.CborReadHeaderBuf(br, scratch)
+		if err != nil {
+			return err
+		}
+		if maj != cbg.MajUnsignedInt {
+			return fmt.Errorf("wrong type for uint64 field")
+		}
+		t.RetryAfter = uint64(extra)
+
 	}
 	return nil
 }
@@ -0,0 +1,186 @@
+package supply
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets in seconds used for transfer durations
+var DefaultBuckets = []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+
+type metricKind string
+
+const (
+	counterKind   metricKind = "counter"
+	gaugeKind     metricKind = "gauge"
+	histogramKind metricKind = "histogram"
+)
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+type family struct {
+	kind metricKind
+	// series are keyed by their formatted labels
+	values     map[string]float64
+	histograms map[string]*histogram
+}
+
+// PrometheusMetrics keeps metrics in memory and serves them in the Prometheus text format
+type PrometheusMetrics struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+// NewPrometheusMetrics creates a new PrometheusMetrics. Histograms use the given buckets or DefaultBuckets.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets:  buckets,
+		families: make(map[string]*family),
+	}
+}
+
+func (m *PrometheusMetrics) family(name string, kind metricKind) *family {
+	f, ok := m.families[name]
+	if !ok {
+		f = &family{
+			kind:       kind,
+			values:     make(map[string]float64),
+			histograms: make(map[string]*histogram),
+		}
+		m.families[name] = f
+	}
+	return f
+}
+
+// Count adds a value to a counter
+func (m *PrometheusMetrics) Count(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.family(name, counterKind).values[formatLabels(labels)] += v
+}
+
+// Gauge sets the current value of a gauge
+func (m *PrometheusMetrics) Gauge(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.family(name, gaugeKind).values[formatLabels(labels)] = v
+}
+
+// Observe records a value in a histogram
+func (m *PrometheusMetrics) Observe(name string, v float64, labels ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := m.family(name, histogramKind)
+	key := formatLabels(labels)
+	h, ok := f.histograms[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(m.buckets))}
+		f.histograms[key] = h
+	}
+	for i, b := range m.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// WriteTo writes all the metrics in the Prometheus text format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	names := make([]string, 0, len(m.families))
+	for name := range m.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := m.families[name]
+		fmt.Fprintf(&b, "# TYPE %s %s\n", name, f.kind)
+		if f.kind != histogramKind {
+			for _, key := range sortedKeys(f.values) {
+				fmt.Fprintf(&b, "%s%s %s\n", name, key, formatValue(f.values[key]))
+			}
+			continue
+		}
+		keys := make([]string, 0, len(f.histograms))
+		for key := range f.histograms {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			h := f.histograms[key]
+			for i, bound := range m.buckets {
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", formatValue(bound)), h.counts[i])
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", name, withLabel(key, "le", "+Inf"), h.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", name, key, formatValue(h.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", name, key, h.count)
+		}
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP serves the metrics to a Prometheus scraper
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// formatLabels formats key value pairs as {k1="v1",k2="v2"} sorted by key
+func formatLabels(labels []string) string {
+	if len(labels) < 2 {
+		return ""
+	}
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", labels[i], strconv.Quote(labels[i+1])))
+	}
+	sort.Strings(pairs)
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// withLabel appends a label to formatted labels
+func withLabel(key, name, value string) string {
+	l := fmt.Sprintf("%s=%s", name, strconv.Quote(value))
+	if key == "" {
+		return "{" + l + "}"
+	}
+	return key[:len(key)-1] + "," + l + "}"
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
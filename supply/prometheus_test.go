@@ -0,0 +1,40 @@
+package supply
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := NewPrometheusMetrics(1, 10)
+
+	m.Count(MetricDispatchesSent, 1)
+	m.Count(MetricDispatchesSent, 2)
+	m.Count(MetricBytesIngested, 1024, "region", "Europe")
+	m.Count(MetricBytesIngested, 512, "region", "Asia")
+	m.Gauge(MetricBytesCached, 100)
+	m.Gauge(MetricBytesCached, 50)
+	m.Observe(MetricTransferDuration, 0.5, "region", "Europe")
+	m.Observe(MetricTransferDuration, 5, "region", "Europe")
+	m.Observe(MetricTransferDuration, 20, "region", "Europe")
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	require.Equal(t, `# TYPE pop_supply_cached_bytes gauge
+pop_supply_cached_bytes 50
+# TYPE pop_supply_dispatches_sent_total counter
+pop_supply_dispatches_sent_total 3
+# TYPE pop_supply_ingested_bytes_total counter
+pop_supply_ingested_bytes_total{region="Asia"} 512
+pop_supply_ingested_bytes_total{region="Europe"} 1024
+# TYPE pop_supply_transfer_duration_seconds histogram
+pop_supply_transfer_duration_seconds_bucket{region="Europe",le="1"} 1
+pop_supply_transfer_duration_seconds_bucket{region="Europe",le="10"} 2
+pop_supply_transfer_duration_seconds_bucket{region="Europe",le="+Inf"} 3
+pop_supply_transfer_duration_seconds_sum{region="Europe"} 25.5
+pop_supply_transfer_duration_seconds_count{region="Europe"} 3
+`, rec.Body.String())
+}
@@ -0,0 +1,329 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/rs/zerolog"
+)
+
+// DefaultMaxPulls is how many dispatched contents we pull at the same time by default
+const DefaultMaxPulls = 8
+
+// DefaultPullTimeout is how long a pull can hold a slot before we give up on it
+const DefaultPullTimeout = 30 * time.Minute
+
+// ErrPullQueued is returned when we are already pulling or waiting to pull a content
+var ErrPullQueued = errors.New("content already queued for pulling")
+
+// ErrInvalidPull is returned when a request cannot be persisted in the pull queue
+var ErrInvalidPull = errors.New("cannot queue pull request")
+
+// queuedPull is a dispatch request waiting for a free slot
+type queuedPull struct {
+	Peer    peer.ID
+	Region  string
+	Request Request
+}
+
+// pullQueue bounds how many contents we pull at the same time. Dispatched, relayed and announced
+// requests over the limit wait in a persisted queue so a burst of them doesn't open unlimited channels
+// and pending requests survive restarts. A slot is released once the transfer completes, fails or is
+// cleaned up, or when it times out.
+type pullQueue struct {
+	ds datastore.Batching
+	// start opens the transfer and returns whether it started
+	start func(queuedPull) bool
+	// expire stops a transfer which held its slot for too long
+	expire func(cid.Cid)
+	log    zerolog.Logger
+
+	mu      sync.Mutex
+	seq     uint64
+	max     int
+	timeout time.Duration
+	// active maps the contents we are pulling to when their transfer started
+	active map[cid.Cid]time.Time
+	queued map[cid.Cid]struct{}
+}
+
+func newPullQueue(ds datastore.Batching, max int, start func(queuedPull) bool, log zerolog.Logger) *pullQueue {
+	q := &pullQueue{
+		ds:      ds,
+		start:   start,
+		expire:  func(cid.Cid) {},
+		log:     log,
+		max:     max,
+		timeout: DefaultPullTimeout,
+		active:  make(map[cid.Cid]time.Time),
+		queued:  make(map[cid.Cid]struct{}),
+	}
+	keys, _ := q.keys()
+	// Keep appending after the last request we had
+	for _, k := range keys {
+		var seq uint64
+		if _, err := fmt.Sscanf(k.Name(), "%020d", &seq); err == nil && seq >= q.seq {
+			q.seq = seq + 1
+		}
+		b, err := q.ds.Get(k)
+		if err != nil {
+			continue
+		}
+		var p queuedPull
+		if err := json.Unmarshal(b, &p); err == nil {
+			q.queued[p.Request.PayloadCID] = struct{}{}
+		}
+	}
+	return q
+}
+
+func (q *pullQueue) keys() ([]datastore.Key, error) {
+	res, err := q.ds.Query(query.Query{KeysOnly: true, Orders: []query.Order{query.OrderByKey{}}})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]datastore.Key, len(entries))
+	for i, e := range entries {
+		keys[i] = datastore.NewKey(e.Key)
+	}
+	return keys, nil
+}
+
+// push persists a request at the end of the queue. It returns ErrPullQueued if we are already
+// pulling or waiting to pull the same content.
+func (q *pullQueue) push(p queuedPull) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	// Reject the requests we couldn't read back from the queue instead of dropping them later
+	if err := json.Unmarshal(b, &queuedPull{}); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPull, err)
+	}
+	root := p.Request.PayloadCID
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.active[root]; ok {
+		return ErrPullQueued
+	}
+	if _, ok := q.queued[root]; ok {
+		return ErrPullQueued
+	}
+	// Zero padded keys are returned in the order they were added
+	key := datastore.NewKey(fmt.Sprintf("%020d", q.seq))
+	q.seq++
+	if err := q.ds.Put(key, b); err != nil {
+		return err
+	}
+	q.queued[root] = struct{}{}
+	return nil
+}
+
+// add queues a request and starts it right away if we are under the limit
+func (q *pullQueue) add(p queuedPull) error {
+	if err := q.push(p); err != nil {
+		return err
+	}
+	q.schedule()
+	return nil
+}
+
+// next pops the queued requests we have room for and marks them active
+func (q *pullQueue) next() []queuedPull {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.max > 0 && len(q.active) >= q.max {
+		return nil
+	}
+	keys, err := q.keys()
+	if err != nil {
+		q.log.Error().Err(err).Msg("failed to read pull queue")
+		return nil
+	}
+	var ready []queuedPull
+	for _, k := range keys {
+		if q.max > 0 && len(q.active) >= q.max {
+			break
+		}
+		b, err := q.ds.Get(k)
+		if err != nil {
+			continue
+		}
+		var p queuedPull
+		if err := json.Unmarshal(b, &p); err != nil {
+			q.log.Error().Err(err).Str("key", k.String()).Msg("dropping invalid queued pull")
+			q.ds.Delete(k)
+			continue
+		}
+		root := p.Request.PayloadCID
+		// Leave the request queued until the ongoing pull of the same content is over
+		if _, ok := q.active[root]; ok {
+			q.log.Debug().Str("root", root.String()).Msg("content already pulling")
+			continue
+		}
+		if err := q.ds.Delete(k); err != nil {
+			q.log.Error().Err(err).Msg("failed to remove queued pull")
+			continue
+		}
+		delete(q.queued, root)
+		started := time.Now()
+		q.active[root] = started
+		if q.timeout > 0 {
+			time.AfterFunc(q.timeout, func() { q.timedOut(root, started) })
+		}
+		ready = append(ready, p)
+	}
+	return ready
+}
+
+// timedOut frees the slot of a transfer if it is still the one started at the given time and stops it
+func (q *pullQueue) timedOut(root cid.Cid, started time.Time) {
+	q.mu.Lock()
+	t, ok := q.active[root]
+	if !ok || !t.Equal(started) {
+		q.mu.Unlock()
+		return
+	}
+	delete(q.active, root)
+	q.mu.Unlock()
+	q.log.Warn().Str("root", root.String()).Msg("pull timed out")
+	q.expire(root)
+	q.schedule()
+}
+
+// schedule starts queued requests while we are under the limit
+func (q *pullQueue) schedule() {
+	for {
+		ready := q.next()
+		if len(ready) == 0 {
+			return
+		}
+		failed := false
+		for _, p := range ready {
+			if !q.start(p) {
+				q.done(p.Request.PayloadCID)
+				failed = true
+			}
+		}
+		// Failed requests freed their slot for the next ones
+		if !failed {
+			return
+		}
+	}
+}
+
+// done frees the slot of a content we are no longer pulling
+func (q *pullQueue) done(root cid.Cid) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, ok := q.active[root]; !ok {
+		return false
+	}
+	delete(q.active, root)
+	return true
+}
+
+// release frees the slot of a finished transfer and starts the next request
+func (q *pullQueue) release(root cid.Cid) {
+	if q.done(root) {
+		q.schedule()
+	}
+}
+
+// setTimeout changes how long a pull can hold its slot. Zero or less means no timeout.
+func (q *pullQueue) setTimeout(timeout time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.timeout = timeout
+}
+
+// setMax changes the number of concurrent pulls. Zero or less means no limit.
+func (q *pullQueue) setMax(max int) {
+	q.mu.Lock()
+	q.max = max
+	q.mu.Unlock()
+	q.schedule()
+}
+
+// pending returns the number of requests waiting for a slot
+func (q *pullQueue) pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	keys, err := q.keys()
+	if err != nil {
+		return 0
+	}
+	return len(keys)
+}
+
+// startPull pulls a queued request, only the new blocks if we have the previous version. The transfer
+// runs for as long as its context so it isn't bound to the call, the queue stops it if it holds its slot
+// for too long.
+func (h *handler) startPull(p queuedPull) error {
+	ctx := context.Background()
+	if h.pullDiff(ctx, p.Peer, p.Region, p.Request) {
+		return nil
+	}
+	return h.pull(ctx, p.Peer, p.Region, p.Request)
+}
+
+// startQueued starts a pull once it gets a slot. Relays waiting for a pull which failed to start
+// are dropped.
+func (s *Supply) startQueued(p queuedPull) bool {
+	if err := s.handler().startPull(p); err != nil {
+		s.log.Warn().Err(err).Str("root", p.Request.PayloadCID.String()).Msg("failed to start pull")
+		s.popRelay(p.Request.PayloadCID)
+		return false
+	}
+	return true
+}
+
+// expirePull stops the inbound transfer of a content which held its slot for too long and drops
+// what we received
+func (s *Supply) expirePull(root cid.Cid) {
+	ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+	defer cancel()
+	chans, err := s.dt.InProgressChannels(ctx)
+	if err != nil {
+		s.log.Error().Err(err).Msg("failed to list transfers")
+	}
+	for chid, state := range chans {
+		if r, ok := requestRoot(state); !ok || !r.Equals(root) || state.Recipient() != s.h.ID() {
+			continue
+		}
+		if err := s.dt.CloseDataTransferChannel(ctx, chid); err != nil {
+			s.log.Error().Err(err).Str("root", root.String()).Msg("failed to stop pull")
+		}
+	}
+	s.RemoveContent(root)
+	s.popRelay(root)
+}
+
+// SetMaxPulls changes how many dispatched contents we pull at the same time. Requests over the limit
+// are queued until a transfer finishes. Zero or less means no limit.
+func (s *Supply) SetMaxPulls(max int) {
+	s.pulls.setMax(max)
+}
+
+// SetPullTimeout changes how long a pull can run before we stop it and free its slot. Zero or less
+// means no timeout.
+func (s *Supply) SetPullTimeout(timeout time.Duration) {
+	s.pulls.setTimeout(timeout)
+}
+
+// PendingPulls returns the number of requests waiting for a free slot
+func (s *Supply) PendingPulls() int {
+	return s.pulls.pending()
+}
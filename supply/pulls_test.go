@@ -0,0 +1,159 @@
+package supply
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/test"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPullQueue(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	gen := blocksutil.NewBlockGenerator()
+	pid := test.RandPeerIDFatal(t)
+
+	var mu sync.Mutex
+	var started []queuedPull
+	start := func(p queuedPull) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, p)
+		return true
+	}
+
+	q := newPullQueue(ds, 2, start, zerolog.Nop())
+
+	var reqs []Request
+	for i := 0; i < 4; i++ {
+		reqs = append(reqs, Request{PayloadCID: gen.Next().Cid(), Size: uint64(i)})
+	}
+	for _, r := range reqs[:3] {
+		require.NoError(t, q.add(queuedPull{Peer: pid, Region: "Global", Request: r}))
+	}
+	// Only 2 pulls run at the same time
+	require.Len(t, started, 2)
+	require.Equal(t, 1, q.pending())
+
+	// Finishing a transfer starts the next request
+	q.release(reqs[0].PayloadCID)
+	require.Len(t, started, 3)
+	require.Equal(t, reqs[2], started[2].Request)
+	require.Equal(t, 0, q.pending())
+
+	// Releasing a content we didn't start does nothing
+	q.release(reqs[0].PayloadCID)
+	require.Len(t, started, 3)
+
+	// Content we are already pulling or waiting for is not queued again
+	require.Equal(t, ErrPullQueued, q.add(queuedPull{Peer: pid, Region: "Global", Request: reqs[1]}))
+	require.NoError(t, q.add(queuedPull{Peer: pid, Region: "Global", Request: reqs[3]}))
+	require.Equal(t, ErrPullQueued, q.add(queuedPull{Peer: pid, Region: "Global", Request: reqs[3]}))
+	require.Equal(t, 1, q.pending())
+
+	// Queued requests survive restarts
+	started = nil
+	q = newPullQueue(ds, 2, start, zerolog.Nop())
+	require.Equal(t, ErrPullQueued, q.add(queuedPull{Peer: pid, Region: "Global", Request: reqs[3]}))
+	require.NoError(t, q.add(queuedPull{Peer: pid, Region: "Global", Request: reqs[0]}))
+	require.Len(t, started, 2)
+	require.Equal(t, reqs[3], started[0].Request)
+	require.Equal(t, reqs[0], started[1].Request)
+
+	// Failed transfers free their slot
+	started = nil
+	failing := newPullQueue(dssync.MutexWrap(datastore.NewMapDatastore()), 1, func(p queuedPull) bool {
+		started = append(started, p)
+		return false
+	}, zerolog.Nop())
+	require.NoError(t, failing.add(queuedPull{Peer: pid, Request: reqs[0]}))
+	require.NoError(t, failing.add(queuedPull{Peer: pid, Request: reqs[1]}))
+	require.Len(t, started, 2)
+	require.Equal(t, 0, failing.pending())
+}
+
+func TestPullQueueRoundTrip(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	gen := blocksutil.NewBlockGenerator()
+	pid := test.RandPeerIDFatal(t)
+
+	var started []queuedPull
+	start := func(p queuedPull) bool {
+		started = append(started, p)
+		return true
+	}
+	unsigned := Request{PayloadCID: gen.Next().Cid(), Size: 10}
+	signed := Request{PayloadCID: gen.Next().Cid(), Size: 20, Publisher: pid, Signature: []byte("sig")}
+
+	// Push persists the requests without starting them
+	q := newPullQueue(ds, 0, start, zerolog.Nop())
+	require.NoError(t, q.push(queuedPull{Peer: pid, Region: "Global", Request: unsigned}))
+	require.NoError(t, q.push(queuedPull{Peer: pid, Region: "Global", Request: signed}))
+
+	q = newPullQueue(ds, 0, start, zerolog.Nop())
+	q.schedule()
+	require.Len(t, started, 2)
+	require.Equal(t, unsigned, started[0].Request)
+	require.Empty(t, started[0].Request.Publisher)
+	require.Equal(t, signed, started[1].Request)
+	require.Equal(t, 0, q.pending())
+
+	// Requests we couldn't decode from the queue are rejected right away
+	invalid := Request{PayloadCID: gen.Next().Cid(), Publisher: peer.ID("invalid")}
+	err := q.push(queuedPull{Peer: pid, Request: invalid})
+	require.True(t, errors.Is(err, ErrInvalidPull))
+	require.Equal(t, 0, q.pending())
+}
+
+func TestPullQueueTimeout(t *testing.T) {
+	gen := blocksutil.NewBlockGenerator()
+	pid := test.RandPeerIDFatal(t)
+
+	var mu sync.Mutex
+	var started []queuedPull
+	var expired []cid.Cid
+	q := newPullQueue(dssync.MutexWrap(datastore.NewMapDatastore()), 1, func(p queuedPull) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, p)
+		return true
+	}, zerolog.Nop())
+	q.expire = func(root cid.Cid) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, root)
+	}
+	q.setTimeout(50 * time.Millisecond)
+
+	stuck := Request{PayloadCID: gen.Next().Cid()}
+	next := Request{PayloadCID: gen.Next().Cid()}
+	require.NoError(t, q.add(queuedPull{Peer: pid, Request: stuck}))
+	require.NoError(t, q.add(queuedPull{Peer: pid, Request: next}))
+	require.Equal(t, 1, q.pending())
+
+	// A transfer holding its slot for too long is stopped and the next request starts
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(started) == 2
+	}, time.Second, 10*time.Millisecond)
+	mu.Lock()
+	require.Equal(t, []cid.Cid{stuck.PayloadCID}, expired)
+	require.Equal(t, next, started[1].Request)
+	mu.Unlock()
+
+	// Releasing before the timeout keeps the transfer running
+	q.release(next.PayloadCID)
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	require.Len(t, expired, 1)
+	mu.Unlock()
+}
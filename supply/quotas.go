@@ -0,0 +1,298 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// KPublisher is the peer who published a content we cached
+const KPublisher = "publisher"
+
+// ErrQuotaExceeded is returned when pulling a content would put its publisher over their quota
+var ErrQuotaExceeded = errors.New("publisher quota exceeded")
+
+// ErrInvalidRequestSignature is returned when a request isn't signed by its publisher
+var ErrInvalidRequestSignature = errors.New("invalid request signature")
+
+// signingBytes returns the bytes the publisher signs
+func (r Request) signingBytes() ([]byte, error) {
+	r.Signature = nil
+	buf := new(bytes.Buffer)
+	if err := r.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign sets the publisher of the request to the owner of the key and signs it
+func (r *Request) Sign(key crypto.PrivKey) error {
+	id, err := peer.IDFromPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	r.Publisher = id
+	b, err := r.signingBytes()
+	if err != nil {
+		return err
+	}
+	r.Signature, err = key.Sign(b)
+	return err
+}
+
+// Verify checks the request was signed by its publisher. The public key must be inlined in the peer ID
+// or given.
+func (r Request) Verify(pub crypto.PubKey) error {
+	if r.Publisher == "" || len(r.Signature) == 0 {
+		return ErrInvalidRequestSignature
+	}
+	if pub == nil {
+		var err error
+		pub, err = r.Publisher.ExtractPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequestSignature, err)
+		}
+	}
+	if !r.Publisher.MatchesPublicKey(pub) {
+		return ErrInvalidRequestSignature
+	}
+	b, err := r.signingBytes()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(b, r.Signature)
+	if err != nil || !ok {
+		return ErrInvalidRequestSignature
+	}
+	return nil
+}
+
+// signRequest signs requests we publish. Relayed requests keep the signature of their publisher.
+func (s *Supply) signRequest(r Request) Request {
+	if len(r.Signature) > 0 {
+		return r
+	}
+	// Caches validate the content with the schema we attached to it
+	if r.Schema == nil {
+		enc, err := s.schemas.encoded(r.PayloadCID)
+		if err != nil {
+			s.log.Warn().Err(err).Msg("failed to read schema")
+		}
+		r.Schema = enc
+	}
+	key := s.h.Peerstore().PrivKey(s.h.ID())
+	if key == nil {
+		return r
+	}
+	if err := r.Sign(key); err != nil {
+		s.log.Warn().Err(err).Msg("failed to sign request")
+	}
+	return r
+}
+
+// Quotas caps the bytes each publisher can have in our cache so a single publisher cannot crowd out others
+type Quotas struct {
+	// Default is the quota in bytes of every publisher. Zero means no limit.
+	Default uint64
+	// Publishers overrides the quota of some publishers. Only their signed requests are charged to them
+	// wherever they come from, other requests are charged to the peer who sent them.
+	Publishers map[peer.ID]uint64
+}
+
+// limit returns the quota of a publisher or 0 if unlimited
+func (q Quotas) limit(p peer.ID) uint64 {
+	if l, ok := q.Publishers[p]; ok {
+		return l
+	}
+	return q.Default
+}
+
+// quotaKeeper enforces the quotas of the content we pull
+type quotaKeeper struct {
+	// mu is held from checking the usage of a publisher until the record of the new content is written
+	mu     sync.Mutex
+	qmu    sync.RWMutex
+	quotas Quotas
+	store  *Store
+	// keys returns the public key of a peer if we know it
+	keys func(peer.ID) crypto.PubKey
+}
+
+func (k *quotaKeeper) set(q Quotas) {
+	k.qmu.Lock()
+	defer k.qmu.Unlock()
+	k.quotas = q
+}
+
+func (k *quotaKeeper) get() Quotas {
+	k.qmu.RLock()
+	defer k.qmu.RUnlock()
+	return k.quotas
+}
+
+// signer returns who signed the request if the signature is valid or the peer who sent it to us
+func (k *quotaKeeper) signer(req Request, from peer.ID) peer.ID {
+	if req.Publisher == "" {
+		return from
+	}
+	var pub crypto.PubKey
+	if k.keys != nil {
+		pub = k.keys(req.Publisher)
+	}
+	if req.Verify(pub) == nil {
+		return req.Publisher
+	}
+	return from
+}
+
+// publisher returns who is charged for a request. It is the signer of the request if we set a quota for
+// it or the peer who sent it to us. Any peer can sign requests with a new key so other signers would get
+// a new quota every time.
+func (k *quotaKeeper) publisher(req Request, from peer.ID) peer.ID {
+	if _, ok := k.get().Publishers[req.Publisher]; !ok {
+		return from
+	}
+	return k.signer(req, from)
+}
+
+// admit checks the publisher has room for the content. On success the returned function must be called
+// once the record of the content is written.
+func (k *quotaKeeper) admit(pub peer.ID, size uint64) (func(), error) {
+	limit := k.get().limit(pub)
+	if limit == 0 {
+		return func() {}, nil
+	}
+	k.mu.Lock()
+	usage, err := k.store.publisherUsage()
+	if err != nil {
+		k.mu.Unlock()
+		return nil, err
+	}
+	if usage[pub]+size > limit {
+		k.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s uses %d of %d bytes", ErrQuotaExceeded, pub, usage[pub], limit)
+	}
+	return k.mu.Unlock, nil
+}
+
+// publisherUsage sums the bytes we cache for each publisher. Versions sharing a store are only counted once
+// and content offloaded to the cold store isn't counted.
+func (s *Store) publisherUsage() (map[peer.ID]uint64, error) {
+	recs, err := s.Records()
+	if err != nil {
+		return nil, err
+	}
+	type storeKey struct {
+		pub   peer.ID
+		store string
+	}
+	sizes := make(map[storeKey]uint64)
+	for _, rec := range recs {
+		id, ok := rec.Labels[KPublisher]
+		if !ok {
+			continue
+		}
+		if _, cold := rec.Labels[KCold]; cold {
+			continue
+		}
+		pub, err := peer.Decode(id)
+		if err != nil {
+			continue
+		}
+		size, _ := strconv.ParseUint(rec.Labels[KSize], 10, 64)
+		k := storeKey{pub, rec.Labels[KStoreID]}
+		if size > sizes[k] {
+			sizes[k] = size
+		}
+	}
+	usage := make(map[peer.ID]uint64)
+	for k, size := range sizes {
+		usage[k.pub] += size
+	}
+	return usage, nil
+}
+
+// SetQuotas changes the quotas of the publishers. Content already cached is kept when lowering a quota.
+func (s *Supply) SetQuotas(q Quotas) {
+	s.quotas.set(q)
+}
+
+// PublisherUsage returns the bytes we cache for each publisher
+func (s *Supply) PublisherUsage() (map[peer.ID]uint64, error) {
+	return s.store.publisherUsage()
+}
+
+// ErrSizeExceeded is returned when a pull sends more bytes than the publisher declared
+var ErrSizeExceeded = errors.New("content larger than declared")
+
+// pullLimit is the most bytes we receive for a pull. Publishers declare the size of their content so we
+// stop pulls going over it, or over the max size of our rules if the size is unknown. Diffs carry the
+// Diff block listing the new blocks on top of them. Zero means no limit.
+func (s *Supply) pullLimit(req *Request) uint64 {
+	limit := req.Size
+	if max := s.rules.get().MaxSize; limit == 0 || (max > 0 && max < limit) {
+		limit = max
+	}
+	if limit > 0 && req.Diff != nil {
+		limit += s.limits.MaxBlockSize
+	}
+	return limit
+}
+
+// checkPullSize stops a pull as soon as it goes over the size its publisher declared
+func (s *Supply) checkPullSize(state datatransfer.ChannelState) {
+	req, ok := state.Voucher().(*Request)
+	if !ok {
+		return
+	}
+	limit := s.pullLimit(req)
+	if limit == 0 || state.Received() <= limit {
+		return
+	}
+	// Many blocks may arrive before the transfer is closed
+	if _, stopping := s.oversized.LoadOrStore(state.ChannelID(), struct{}{}); stopping {
+		return
+	}
+	s.log.Warn().
+		Str("root", req.PayloadCID.String()).
+		Uint64("received", state.Received()).
+		Uint64("declared", req.Size).
+		Msg("stopping pull over the declared size")
+	go func() {
+		defer s.oversized.Delete(state.ChannelID())
+		ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+		defer cancel()
+		if err := s.dt.CloseDataTransferChannel(ctx, state.ChannelID()); err != nil {
+			s.log.Error().Err(err).Msg("failed to stop oversized pull")
+		}
+		s.recordPulled(state, s.contentRegion(req.PayloadCID), true)
+		s.RemoveContent(req.PayloadCID)
+		s.popRelay(req.PayloadCID)
+		s.pulls.release(req.PayloadCID)
+	}()
+}
+
+// recordPullSize replaces the size the publisher declared with the bytes we actually received so
+// quotas, eviction and our usage count the real size of the content
+func (s *Supply) recordPullSize(state datatransfer.ChannelState) error {
+	req, ok := state.Voucher().(*Request)
+	if !ok {
+		return nil
+	}
+	size := state.Received()
+	// A new version only brings the blocks it doesn't share with the previous one
+	if req.Diff != nil && req.Previous != nil {
+		if prev, err := s.store.GetRecord(*req.Previous); err == nil {
+			prevSize, _ := strconv.ParseUint(prev.Labels[KSize], 10, 64)
+			size += prevSize
+		}
+	}
+	return s.store.AddLabel(req.PayloadCID, KSize, strconv.FormatUint(size, 10))
+}
@@ -0,0 +1,196 @@
+package supply
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/multiformats/go-multihash"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func testPeer(t *testing.T) (crypto.PrivKey, peer.ID) {
+	priv, _, err := crypto.GenerateEd25519Key(rand.Reader)
+	require.NoError(t, err)
+	id, err := peer.IDFromPrivateKey(priv)
+	require.NoError(t, err)
+	return priv, id
+}
+
+func testRoot(t *testing.T, i int) cid.Cid {
+	h, err := multihash.Sum([]byte{byte(i)}, multihash.SHA2_256, -1)
+	require.NoError(t, err)
+	return cid.NewCidV1(cid.Raw, h)
+}
+
+func TestRequestSignature(t *testing.T) {
+	priv, id := testPeer(t)
+	_, other := testPeer(t)
+
+	req := Request{PayloadCID: testRoot(t, 0), Size: 1000}
+	require.Equal(t, ErrInvalidRequestSignature, req.Verify(nil))
+
+	require.NoError(t, req.Sign(priv))
+	require.Equal(t, id, req.Publisher)
+	require.NoError(t, req.Verify(nil))
+	require.NoError(t, req.Verify(priv.GetPublic()))
+
+	// Signatures cover every field
+	tampered := req
+	tampered.Size = 10
+	require.Equal(t, ErrInvalidRequestSignature, tampered.Verify(nil))
+
+	tampered = req
+	tampered.Publisher = other
+	require.Equal(t, ErrInvalidRequestSignature, tampered.Verify(nil))
+
+	k := &quotaKeeper{}
+	require.Equal(t, id, k.signer(req, other))
+	// Signers without a quota are not trusted and the peer who sent the request is charged
+	require.Equal(t, other, k.publisher(req, other))
+	k.set(Quotas{Publishers: map[peer.ID]uint64{id: 1000}})
+	require.Equal(t, id, k.publisher(req, other))
+	// Invalid signatures are attributed to the peer who sent the request
+	tampered = req
+	tampered.Size = 10
+	require.Equal(t, other, k.signer(tampered, other))
+	require.Equal(t, other, k.publisher(tampered, other))
+	require.Equal(t, other, k.publisher(Request{PayloadCID: req.PayloadCID}, other))
+}
+
+func TestPublisherQuotas(t *testing.T) {
+	s := &Store{dssync.MutexWrap(datastore.NewMapDatastore())}
+	k := &quotaKeeper{store: s}
+
+	_, p1 := testPeer(t)
+	_, p2 := testPeer(t)
+
+	put := func(i int, pub peer.ID, storeID string, size uint64) {
+		rec := newRecord(Request{PayloadCID: testRoot(t, i), Size: size}, storeID, "")
+		rec.Labels[KPublisher] = pub.String()
+		require.NoError(t, s.PutRecord(testRoot(t, i), rec))
+	}
+
+	// No limit by default
+	admitted, err := k.admit(p1, 1<<40)
+	require.NoError(t, err)
+	admitted()
+
+	put(0, p1, "1", 600)
+	// A new version sharing the store of the previous one only counts once
+	put(1, p1, "1", 700)
+	put(2, p2, "2", 300)
+
+	usage, err := s.publisherUsage()
+	require.NoError(t, err)
+	require.Equal(t, uint64(700), usage[p1])
+	require.Equal(t, uint64(300), usage[p2])
+
+	k.set(Quotas{Default: 1000, Publishers: map[peer.ID]uint64{p2: 2000}})
+
+	_, err = k.admit(p1, 400)
+	require.True(t, errors.Is(err, ErrQuotaExceeded))
+
+	admitted, err = k.admit(p1, 300)
+	require.NoError(t, err)
+	admitted()
+
+	admitted, err = k.admit(p2, 1500)
+	require.NoError(t, err)
+	admitted()
+
+	// Content offloaded to the cold store frees the quota
+	rec, err := s.GetRecord(testRoot(t, 1))
+	require.NoError(t, err)
+	rec.Labels[KCold] = "1"
+	require.NoError(t, s.PutRecord(testRoot(t, 1), rec))
+	rec, err = s.GetRecord(testRoot(t, 0))
+	require.NoError(t, err)
+	rec.Labels[KCold] = "1"
+	require.NoError(t, s.PutRecord(testRoot(t, 0), rec))
+
+	admitted, err = k.admit(p1, 1000)
+	require.NoError(t, err)
+	admitted()
+}
+
+func TestPullSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+	regions := []Region{{Name: "TestRegion", Code: CustomRegion}}
+
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(ctx, t)
+	publisher := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
+
+	n2 := testutil.NewTestNode(mn, t)
+	n2.SetupDataTransfer(ctx, t)
+	cache := New(n2.Host, n2.Dt, n2.Ds, n2.Ms, regions, nil)
+	t.Cleanup(func() {
+		require.NoError(t, n1.Dt.Stop(ctx))
+		require.NoError(t, n2.Dt.Stop(ctx))
+	})
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	time.Sleep(10 * time.Millisecond)
+
+	// The size we record is what we received
+	link, storeID, _ := n1.LoadFileToNewStore(ctx, t, n1.CreateRandomFile(t, 512000))
+	root := link.(cidlink.Link).Cid
+	size := n1.DAGSize(ctx, t, storeID, root)
+	require.NoError(t, publisher.Register(root, storeID))
+
+	res, err := publisher.Dispatch(ctx, Request{PayloadCID: root, Size: size * 2})
+	require.NoError(t, err)
+	defer res.Close()
+	_, err = res.Next(ctx)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		rec, err := cache.store.GetRecord(root)
+		return err == nil && rec.Labels[KSize] == strconv.FormatUint(size, 10)
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Pulls going over the declared size are stopped
+	link, storeID, _ = n1.LoadFileToNewStore(ctx, t, n1.CreateRandomFile(t, 512000))
+	root = link.(cidlink.Link).Cid
+	require.NoError(t, publisher.Register(root, storeID))
+
+	stopped := make(chan struct{}, 1)
+	unsub := cache.SubscribeToTransfers(root, func(event datatransfer.Event, state datatransfer.ChannelState) {
+		if event.Code == datatransfer.Cancel {
+			select {
+			case stopped <- struct{}{}:
+			default:
+			}
+		}
+	})
+	defer unsub()
+
+	res, err = publisher.Dispatch(ctx, Request{PayloadCID: root, Size: n1.DAGSize(ctx, t, storeID, root) / 4})
+	require.NoError(t, err)
+	defer res.Close()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		t.Fatal("pull not stopped")
+	}
+	require.Eventually(t, func() bool {
+		_, err := cache.store.GetRecord(root)
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+}
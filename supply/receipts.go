@@ -0,0 +1,367 @@
+package supply
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ReceiptProtocol is the protocol for requesting the receipts a provider countersigned for some content
+const ReceiptProtocol = "/myel/pop/receipt/1.1"
+
+// IssueReceiptProtocol is the protocol clients send the receipts they sign to the provider who served them
+const IssueReceiptProtocol = "/myel/pop/receipt/issue/1.0"
+
+// receiptWait bounds how long a provider waits for its own end of a transfer to complete before
+// countersigning a receipt for it
+const receiptWait = 10 * time.Second
+
+// ErrInvalidReceipt is returned when a receipt isn't signed by both its client and its provider
+var ErrInvalidReceipt = errors.New("invalid receipt signature")
+
+// ErrUnservedReceipt is returned when a client issues a receipt for more bytes than we served it
+var ErrUnservedReceipt = errors.New("receipt for bytes we did not serve")
+
+// Receipt is a proof that a provider served some bytes of a content to a client. The client who received
+// the bytes issues it and the provider countersigns it so neither can claim bytes on its own.
+type Receipt struct {
+	Provider          peer.ID
+	Client            peer.ID
+	PayloadCID        cid.Cid
+	Bytes             uint64
+	Time              int64
+	ClientSignature   []byte
+	ProviderSignature []byte
+}
+
+// signingBytes returns the bytes both the client and the provider sign
+func (r Receipt) signingBytes() ([]byte, error) {
+	r.ClientSignature = nil
+	r.ProviderSignature = nil
+	buf := new(bytes.Buffer)
+	if err := r.MarshalCBOR(buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func verifySignature(p peer.ID, data, sig []byte) error {
+	pub, err := p.ExtractPublicKey()
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(data, sig)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidReceipt
+	}
+	return nil
+}
+
+// verifyClient checks the receipt was issued by its client
+func (r Receipt) verifyClient() error {
+	b, err := r.signingBytes()
+	if err != nil {
+		return err
+	}
+	return verifySignature(r.Client, b, r.ClientSignature)
+}
+
+// Verify checks the receipt was issued by its client and countersigned by its provider
+func (r Receipt) Verify() error {
+	b, err := r.signingBytes()
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(r.Client, b, r.ClientSignature); err != nil {
+		return err
+	}
+	return verifySignature(r.Provider, b, r.ProviderSignature)
+}
+
+// ReceiptRequest asks a provider for all the receipts for a given content
+type ReceiptRequest struct {
+	PayloadCID cid.Cid
+}
+
+// ReceiptResponse lists the receipts a provider countersigned for a content
+type ReceiptResponse struct {
+	Receipts []Receipt
+}
+
+// AggregateReceipts sums the bytes served by each provider. Receipts missing a valid signature are ignored.
+func AggregateReceipts(rcpts []Receipt) map[peer.ID]uint64 {
+	total := make(map[peer.ID]uint64)
+	for _, r := range rcpts {
+		if r.Verify() != nil {
+			continue
+		}
+		total[r.Provider] += r.Bytes
+	}
+	return total
+}
+
+// receiptKey is where a countersigned receipt is stored
+func receiptKey(r Receipt) datastore.Key {
+	sum := sha256.Sum256(r.ClientSignature)
+	return datastore.NewKey(r.PayloadCID.String()).ChildString(hex.EncodeToString(sum[:16]))
+}
+
+// servedKey is where we count the bytes we served a client which it didn't issue receipts for yet
+func servedKey(root cid.Cid, client peer.ID) datastore.Key {
+	return datastore.NewKey("served").ChildString(root.String()).ChildString(peer.Encode(client))
+}
+
+// servedLedger counts the bytes we served each client so we only countersign receipts for them
+type servedLedger struct {
+	mu sync.Mutex
+	ds datastore.Datastore
+}
+
+func (l *servedLedger) get(k datastore.Key) (uint64, error) {
+	b, err := l.ds.Get(k)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(string(b), 10, 64)
+}
+
+func (l *servedLedger) put(k datastore.Key, n uint64) error {
+	if n == 0 {
+		return l.ds.Delete(k)
+	}
+	return l.ds.Put(k, []byte(strconv.FormatUint(n, 10)))
+}
+
+// add counts bytes we served a client
+func (l *servedLedger) add(root cid.Cid, client peer.ID, n uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := servedKey(root, client)
+	served, err := l.get(k)
+	if err != nil {
+		return err
+	}
+	return l.put(k, served+n)
+}
+
+// settle deducts the bytes of a receipt from what we served the client. It returns false if the client
+// claims more than we served it.
+func (l *servedLedger) settle(root cid.Cid, client peer.ID, n uint64) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	k := servedKey(root, client)
+	served, err := l.get(k)
+	if err != nil {
+		return false, err
+	}
+	if n > served {
+		return false, nil
+	}
+	return true, l.put(k, served-n)
+}
+
+// trackReceipts counts the bytes we serve and issues receipts for the bytes we receive
+func (s *Supply) trackReceipts(event datatransfer.Event, state datatransfer.ChannelState) {
+	switch {
+	case event.Code == datatransfer.Complete && state.Sender() == s.h.ID():
+		if err := s.served.add(state.BaseCID(), state.Recipient(), state.Sent()); err != nil {
+			s.log.Error().Err(err).Msg("failed to count served bytes")
+		}
+	// The recipient of a pull never gets a Complete event, its channel is completed once cleaned up
+	case state.Status() == datatransfer.Completed && state.Recipient() == s.h.ID():
+		r := Receipt{
+			Provider:   state.Sender(),
+			Client:     s.h.ID(),
+			PayloadCID: state.BaseCID(),
+			Bytes:      state.Received(),
+			Time:       time.Now().Unix(),
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), receiptWait+SendTimeout)
+			defer cancel()
+			if err := s.issueReceipt(ctx, r); err != nil {
+				s.log.Debug().Err(err).Str("provider", r.Provider.String()).Msg("failed to issue receipt")
+			}
+		}()
+	}
+}
+
+// issueReceipt signs a receipt for the bytes we received and sends it to the provider to countersign
+func (s *Supply) issueReceipt(ctx context.Context, r Receipt) error {
+	b, err := r.signingBytes()
+	if err != nil {
+		return err
+	}
+	r.ClientSignature, err = s.h.Peerstore().PrivKey(s.h.ID()).Sign(b)
+	if err != nil {
+		return err
+	}
+	stream, err := s.h.NewStream(ctx, r.Provider, IssueReceiptProtocol)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(dl)
+	}
+	if err := cborutil.WriteCborRPC(stream, &r); err != nil {
+		return err
+	}
+	var signed Receipt
+	if err := signed.UnmarshalCBOR(bufio.NewReader(stream)); err != nil {
+		return err
+	}
+	if signed.Provider != r.Provider || !bytes.Equal(signed.ClientSignature, r.ClientSignature) {
+		return ErrInvalidReceipt
+	}
+	return signed.Verify()
+}
+
+// countersign checks a client issued a receipt for bytes we served it and signs it. It waits for our end
+// of the transfer to complete as the client may issue the receipt first.
+func (s *Supply) countersign(ctx context.Context, from peer.ID, r Receipt) (Receipt, error) {
+	if r.Provider != s.h.ID() || r.Client != from {
+		return Receipt{}, ErrInvalidReceipt
+	}
+	if err := r.verifyClient(); err != nil {
+		return Receipt{}, err
+	}
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		ok, err := s.served.settle(r.PayloadCID, r.Client, r.Bytes)
+		if err != nil {
+			return Receipt{}, err
+		}
+		if ok {
+			break
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return Receipt{}, ErrUnservedReceipt
+		}
+	}
+	b, err := r.signingBytes()
+	if err != nil {
+		return Receipt{}, err
+	}
+	r.ProviderSignature, err = s.h.Peerstore().PrivKey(s.h.ID()).Sign(b)
+	if err != nil {
+		return Receipt{}, err
+	}
+	buf := new(bytes.Buffer)
+	if err := r.MarshalCBOR(buf); err != nil {
+		return Receipt{}, err
+	}
+	if err := s.receipts.Put(receiptKey(r), buf.Bytes()); err != nil {
+		return Receipt{}, err
+	}
+	return r, nil
+}
+
+func (s *Supply) handleIssueReceiptStream(stream network.Stream) {
+	defer stream.Close()
+	var r Receipt
+	if err := r.UnmarshalCBOR(bufio.NewReader(stream)); err != nil {
+		stream.Reset()
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), receiptWait)
+	defer cancel()
+	signed, err := s.countersign(ctx, stream.Conn().RemotePeer(), r)
+	if err != nil {
+		s.log.Debug().Err(err).Str("client", r.Client.String()).Msg("rejected receipt")
+		stream.Reset()
+		return
+	}
+	if err := cborutil.WriteCborRPC(stream, &signed); err != nil {
+		stream.Reset()
+	}
+}
+
+// Receipts returns all the receipts we countersigned for a given content
+func (s *Supply) Receipts(root cid.Cid) ([]Receipt, error) {
+	res, err := s.receipts.Query(query.Query{Prefix: datastore.NewKey(root.String()).String()})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	rcpts := make([]Receipt, 0, len(entries))
+	for _, e := range entries {
+		var r Receipt
+		if err := r.UnmarshalCBOR(bytes.NewReader(e.Value)); err != nil {
+			return nil, err
+		}
+		rcpts = append(rcpts, r)
+	}
+	return rcpts, nil
+}
+
+// FetchReceipts requests the receipts a provider countersigned for a given content and verifies them
+func (s *Supply) FetchReceipts(ctx context.Context, p peer.ID, root cid.Cid) ([]Receipt, error) {
+	stream, err := s.h.NewStream(ctx, p, ReceiptProtocol)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		stream.SetDeadline(dl)
+	}
+	if err := cborutil.WriteCborRPC(stream, &ReceiptRequest{PayloadCID: root}); err != nil {
+		return nil, err
+	}
+	var res ReceiptResponse
+	if err := res.UnmarshalCBOR(bufio.NewReader(stream)); err != nil {
+		return nil, err
+	}
+	for _, r := range res.Receipts {
+		if r.Provider != p || !r.PayloadCID.Equals(root) {
+			return nil, ErrInvalidReceipt
+		}
+		if err := r.Verify(); err != nil {
+			return nil, err
+		}
+	}
+	return res.Receipts, nil
+}
+
+func (s *Supply) handleReceiptStream(stream network.Stream) {
+	defer stream.Close()
+	var req ReceiptRequest
+	if err := req.UnmarshalCBOR(bufio.NewReader(stream)); err != nil {
+		stream.Reset()
+		return
+	}
+	rcpts, err := s.Receipts(req.PayloadCID)
+	if err != nil {
+		stream.Reset()
+		return
+	}
+	if err := cborutil.WriteCborRPC(stream, &ReceiptResponse{Receipts: rcpts}); err != nil {
+		stream.Reset()
+	}
+}
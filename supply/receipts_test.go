@@ -0,0 +1,65 @@
+package supply
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountersignReceipt(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	pn := testutil.NewTestNode(mn, t)
+	pn.SetupDataTransfer(ctx, t)
+	cn := testutil.NewTestNode(mn, t)
+
+	regions := []Region{{Name: "TestRegion", Code: CustomRegion}}
+	sp := New(pn.Host, pn.Dt, pn.Ds, pn.Ms, regions, nil)
+
+	gen := blocksutil.NewBlockGenerator()
+	root := gen.Next().Cid()
+	client := cn.Host.ID()
+	r := Receipt{
+		Provider:   pn.Host.ID(),
+		Client:     client,
+		PayloadCID: root,
+		Bytes:      100,
+		Time:       time.Now().Unix(),
+	}
+	b, err := r.signingBytes()
+	require.NoError(t, err)
+	r.ClientSignature, err = cn.Host.Peerstore().PrivKey(client).Sign(b)
+	require.NoError(t, err)
+
+	// Only the client can issue its receipts
+	_, err = sp.countersign(ctx, pn.Host.ID(), r)
+	require.True(t, errors.Is(err, ErrInvalidReceipt))
+
+	require.NoError(t, sp.served.add(root, client, 60))
+	wctx, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+	_, err = sp.countersign(wctx, client, r)
+	require.True(t, errors.Is(err, ErrUnservedReceipt))
+
+	require.NoError(t, sp.served.add(root, client, 40))
+	signed, err := sp.countersign(ctx, client, r)
+	require.NoError(t, err)
+	require.NoError(t, signed.Verify())
+
+	rcpts, err := sp.Receipts(root)
+	require.NoError(t, err)
+	require.Len(t, rcpts, 1)
+	require.Equal(t, map[peer.ID]uint64{pn.Host.ID(): 100}, AggregateReceipts(rcpts))
+
+	// The bytes can only be claimed once
+	_, err = sp.countersign(wctx, client, r)
+	require.True(t, errors.Is(err, ErrUnservedReceipt))
+}
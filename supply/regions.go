@@ -136,7 +136,7 @@ var (
 	}
 )
 
-// Regions is a list of preset regions
+// Regions is a list of preset regions. Use LoadRegions to update them at runtime.
 var Regions = map[string]Region{
 	"Global":       global,
 	"Asia":         asia,
@@ -151,7 +151,7 @@ var Regions = map[string]Region{
 func ParseRegions(list []string) []Region {
 	var regions []Region
 	for _, rstring := range list {
-		if r := Regions[rstring]; r.Name != "" {
+		if r, ok := lookupRegion(rstring); ok {
 			regions = append(regions, r)
 			continue
 		}
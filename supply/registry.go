@@ -0,0 +1,207 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/filecoin-project/go-state-types/big"
+)
+
+// RegionRefreshInterval is how often we fetch region definitions from a registry
+const RegionRefreshInterval = time.Hour
+
+// regionsMu guards the preset Regions as they can be updated from a registry at runtime
+var regionsMu sync.RWMutex
+
+// lookupRegion returns the definition of a preset region
+func lookupRegion(name string) (Region, bool) {
+	regionsMu.RLock()
+	defer regionsMu.RUnlock()
+	r, ok := Regions[name]
+	return r, ok
+}
+
+// RegionProvider supplies region definitions so miner lists and prices can change without a new release
+type RegionProvider interface {
+	Regions(ctx context.Context) (map[string]Region, error)
+}
+
+// RegionDef is how a region is described in a config file or registry. PPB is in attoFIL.
+type RegionDef struct {
+	Name          string   `json:"name" toml:"name"`
+	Code          uint64   `json:"code,omitempty" toml:"code"`
+	PPB           string   `json:"ppb,omitempty" toml:"ppb"`
+	StorageMiners []string `json:"storageMiners,omitempty" toml:"storage_miners"`
+}
+
+// RegionDefs is the document listing all the regions
+type RegionDefs struct {
+	Regions []RegionDef `json:"regions" toml:"regions"`
+}
+
+// Parse converts the definitions to regions. Regions without a code keep the code of the preset
+// region with the same name or are custom regions.
+func (d RegionDefs) Parse() (map[string]Region, error) {
+	regions := make(map[string]Region, len(d.Regions))
+	for _, def := range d.Regions {
+		if def.Name == "" {
+			return nil, fmt.Errorf("region without a name")
+		}
+		r := Region{
+			Name:          def.Name,
+			Code:          RegionCode(def.Code),
+			PPB:           big.Zero(),
+			StorageMiners: def.StorageMiners,
+		}
+		if def.Code == 0 {
+			r.Code = CustomRegion
+			if preset, ok := lookupRegion(def.Name); ok {
+				r.Code = preset.Code
+			}
+		}
+		if def.PPB != "" {
+			ppb, err := big.FromString(def.PPB)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ppb for region %s: %w", def.Name, err)
+			}
+			r.PPB = ppb
+		}
+		regions[def.Name] = r
+	}
+	return regions, nil
+}
+
+func decodeRegionDefs(r io.Reader, isToml bool) (map[string]Region, error) {
+	var defs RegionDefs
+	if isToml {
+		if _, err := toml.DecodeReader(r, &defs); err != nil {
+			return nil, err
+		}
+	} else if err := json.NewDecoder(r).Decode(&defs); err != nil {
+		return nil, err
+	}
+	return defs.Parse()
+}
+
+// FileRegionProvider reads region definitions from a JSON or TOML file depending on its extension
+type FileRegionProvider struct {
+	Path string
+}
+
+// Regions reads the file every time so edits are picked up on the next refresh
+func (f FileRegionProvider) Regions(ctx context.Context) (map[string]Region, error) {
+	file, err := os.Open(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return decodeRegionDefs(file, filepath.Ext(f.Path) == ".toml")
+}
+
+// HTTPRegionProvider fetches region definitions in JSON from a registry endpoint
+type HTTPRegionProvider struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// Regions requests the latest definitions from the registry
+func (h HTTPRegionProvider) Regions(ctx context.Context) (map[string]Region, error) {
+	req, err := http.NewRequest(http.MethodGet, h.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		io.Copy(ioutil.Discard, res.Body)
+		return nil, fmt.Errorf("region registry: %s", res.Status)
+	}
+	return decodeRegionDefs(res.Body, false)
+}
+
+// ParseRegionProvider returns a registry provider for http(s) URLs or a file provider for paths
+func ParseRegionProvider(uri string) RegionProvider {
+	if strings.HasPrefix(uri, "http://") || strings.HasPrefix(uri, "https://") {
+		return HTTPRegionProvider{Endpoint: uri}
+	}
+	return FileRegionProvider{Path: strings.TrimPrefix(uri, "file://")}
+}
+
+// LoadRegions updates the preset regions with the definitions of the provider. The Global region
+// includes the miners of all the other regions unless the provider defines it.
+func LoadRegions(ctx context.Context, rp RegionProvider) (map[string]Region, error) {
+	defs, err := rp.Regions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	regionsMu.Lock()
+	defer regionsMu.Unlock()
+	for name, r := range defs {
+		Regions[name] = r
+	}
+	if _, ok := defs["Global"]; !ok {
+		g := Regions["Global"]
+		var miners []string
+		for name, r := range Regions {
+			if name != "Global" {
+				miners = append(miners, r.StorageMiners...)
+			}
+		}
+		g.StorageMiners = miners
+		Regions["Global"] = g
+	}
+	return defs, nil
+}
+
+// RefreshRegions loads the definitions of the provider and applies them to the regions we are part of
+func (s *Supply) RefreshRegions(ctx context.Context, rp RegionProvider) error {
+	if _, err := LoadRegions(ctx, rp); err != nil {
+		return err
+	}
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	for i, r := range s.regions {
+		if def, ok := lookupRegion(r.Name); ok {
+			s.regions[i] = def
+		}
+	}
+	s.validation.setPPB(minPPB(s.regions))
+	return nil
+}
+
+// StartRegionRefresh periodically refreshes the region definitions from the provider until the
+// context is cancelled. Failures keep the previous definitions.
+func (s *Supply) StartRegionRefresh(ctx context.Context, rp RegionProvider, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.RefreshRegions(ctx, rp); err != nil {
+					s.log.Warn().Err(err).Msg("failed to refresh regions")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,95 @@
+package supply
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func restorePresets(t *testing.T) {
+	presets := make(map[string]Region, len(Regions))
+	for k, v := range Regions {
+		presets[k] = v
+	}
+	t.Cleanup(func() {
+		regionsMu.Lock()
+		defer regionsMu.Unlock()
+		Regions = presets
+	})
+}
+
+func TestFileRegionProvider(t *testing.T) {
+	ctx := context.Background()
+	restorePresets(t)
+
+	dir := t.TempDir()
+	jsonPath := filepath.Join(dir, "regions.json")
+	require.NoError(t, ioutil.WriteFile(jsonPath, []byte(`{"regions": [
+		{"name": "Europe", "ppb": "2", "storageMiners": ["f01000"]},
+		{"name": "Mars", "storageMiners": ["f01001"]}
+	]}`), 0644))
+	tomlPath := filepath.Join(dir, "regions.toml")
+	require.NoError(t, ioutil.WriteFile(tomlPath, []byte(`
+[[regions]]
+name = "Europe"
+ppb = "2"
+storage_miners = ["f01000"]
+
+[[regions]]
+name = "Mars"
+storage_miners = ["f01001"]
+`), 0644))
+
+	for _, path := range []string{jsonPath, tomlPath} {
+		defs, err := ParseRegionProvider(path).Regions(ctx)
+		require.NoError(t, err)
+		require.Len(t, defs, 2)
+		require.Equal(t, EuropeRegion, defs["Europe"].Code)
+		require.Equal(t, abi.NewTokenAmount(2), defs["Europe"].PPB)
+		require.Equal(t, []string{"f01000"}, defs["Europe"].StorageMiners)
+		require.Equal(t, RegionCode(CustomRegion), defs["Mars"].Code)
+	}
+
+	_, err := LoadRegions(ctx, FileRegionProvider{Path: jsonPath})
+	require.NoError(t, err)
+	mars := ParseRegions([]string{"Mars"})[0]
+	require.Equal(t, []string{"f01001"}, mars.StorageMiners)
+	// Global includes the new miners
+	require.Contains(t, ParseRegions([]string{"Global"})[0].StorageMiners, "f01001")
+}
+
+func TestRefreshRegions(t *testing.T) {
+	ctx := context.Background()
+	restorePresets(t)
+	mn := mocknet.New(ctx)
+
+	var miners atomic.Value
+	miners.Store(`["f01000"]`)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"regions": [{"name": "Europe", "ppb": "1", "storageMiners": ` + miners.Load().(string) + `}]}`))
+	}))
+	defer srv.Close()
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Europe"]}, nil)
+
+	rp := ParseRegionProvider(srv.URL)
+	require.NoError(t, s.RefreshRegions(ctx, rp))
+	require.Equal(t, []string{"f01000"}, s.Regions()[0].StorageMiners)
+
+	miners.Store(`["f01000", "f01002"]`)
+	require.NoError(t, s.RefreshRegions(ctx, rp))
+	addrs, err := s.ListMiners(ctx)
+	require.NoError(t, err)
+	require.Len(t, addrs, 2)
+}
@@ -0,0 +1,171 @@
+package supply
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"sync"
+
+	cborutil "github.com/filecoin-project/go-cbor-util"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/network"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+)
+
+// RelayProtocol is the protocol publishers use to ask gateway caches to relay a dispatch to their region
+const RelayProtocol = "/myel/supply/relay/1.0"
+
+// relay is a dispatch a gateway pulls before announcing it to its region
+type relay struct {
+	req    Request
+	region string
+}
+
+// relayer keeps track of the dispatches we are relaying as a gateway
+type relayer struct {
+	mu      sync.Mutex
+	pending map[cid.Cid]relay
+}
+
+// SetGateways sets the gateway caches we relay dispatches through when we have no peers in a region
+func (s *Supply) SetGateways(gateways []peer.AddrInfo) {
+	s.gateways = gateways
+}
+
+// EnableGateway lets publishers outside our regions relay their dispatches through us. We pull the content
+// then announce it to the caches of the region it was relayed to. Announcements must be enabled.
+func (s *Supply) EnableGateway() {
+	s.rmu.Lock()
+	defer s.rmu.Unlock()
+	s.relayer = &relayer{pending: make(map[cid.Cid]relay)}
+	for _, proto := range protoRegions(RelayProtocol, s.regions) {
+		s.h.SetStreamHandler(proto, s.handleRelayStream)
+	}
+}
+
+func (s *Supply) handleRelayStream(stream network.Stream) {
+	defer stream.Close()
+
+	region := strings.TrimPrefix(string(stream.Protocol()), RelayProtocol+"/")
+	topic, ok := s.topic(region)
+	if !ok {
+		stream.Reset()
+		return
+	}
+	var a Announcement
+	if err := a.UnmarshalCBOR(bufio.NewReader(stream)); err != nil {
+		return
+	}
+	if CheckCodec(a.Request.PayloadCID) != nil {
+		return
+	}
+	from := stream.Conn().RemotePeer()
+	if ok, _ := s.throttle.allowRequest(from, s.quotas.publisher(a.Request, from)); !ok {
+		return
+	}
+	// If we already have the content we can announce it right away
+	if _, err := s.store.GetRecord(a.Request.PayloadCID); err == nil {
+		go s.announceRelay(a.Request, topic)
+		return
+	}
+
+	s.relayer.mu.Lock()
+	s.relayer.pending[a.Request.PayloadCID] = relay{a.Request, region}
+	s.relayer.mu.Unlock()
+
+	// Relayed pulls wait for a slot like dispatched ones
+	if err := s.pulls.add(queuedPull{Peer: from, Region: region, Request: a.Request}); err != nil {
+		s.log.Debug().Err(err).Str("root", a.Request.PayloadCID.String()).Msg("failed to queue relayed pull")
+		s.popRelay(a.Request.PayloadCID)
+	}
+}
+
+// popRelay returns and forgets the relay pending for the given content if any
+func (s *Supply) popRelay(root cid.Cid) (relay, bool) {
+	if s.relayer == nil {
+		return relay{}, false
+	}
+	s.relayer.mu.Lock()
+	defer s.relayer.mu.Unlock()
+	rl, ok := s.relayer.pending[root]
+	delete(s.relayer.pending, root)
+	return rl, ok
+}
+
+// relayPulled announces relayed content to our region once we pulled it from the publisher
+func (s *Supply) relayPulled(root cid.Cid) {
+	rl, ok := s.popRelay(root)
+	if !ok {
+		return
+	}
+	if topic, ok := s.topic(rl.region); ok {
+		s.announceRelay(rl.req, topic)
+	}
+}
+
+func (s *Supply) announceRelay(r Request, topic *pubsub.Topic) {
+	ctx, cancel := context.WithTimeout(context.Background(), SendTimeout)
+	defer cancel()
+	if err := s.announce(ctx, r, []*pubsub.Topic{topic}); err != nil {
+		s.log.Warn().Err(err).Str("root", r.PayloadCID.String()).Msg("failed to relay")
+	}
+}
+
+// selectGateways returns the region of each gateway we could reach which relays to the given regions
+func (s *Supply) selectGateways(ctx context.Context, regions []string) map[string]peer.ID {
+	gateways := make(map[string]peer.ID)
+	for _, info := range s.gateways {
+		if info.ID == s.h.ID() {
+			continue
+		}
+		cctx, cancel := context.WithTimeout(ctx, SendTimeout)
+		err := s.h.Connect(cctx, info)
+		cancel()
+		if err != nil {
+			continue
+		}
+		for _, name := range regions {
+			if _, ok := gateways[name]; ok {
+				continue
+			}
+			supported, err := s.h.Peerstore().SupportsProtocols(info.ID, string(relayProtocol(name)))
+			if err == nil && len(supported) > 0 {
+				gateways[name] = info.ID
+				// A gateway relays a single region for us so caches are counted once
+				break
+			}
+		}
+	}
+	return gateways
+}
+
+func relayProtocol(region string) protocol.ID {
+	return protoRegions(RelayProtocol, ParseRegions([]string{region}))[0]
+}
+
+// sendRelay asks the gateway to pull the content and announce it to the given region
+func (s *Supply) sendRelay(ctx context.Context, r Request, p peer.ID, region string) error {
+	ctx, cancel := context.WithTimeout(ctx, SendTimeout)
+	defer cancel()
+	stream, err := s.h.NewStream(ctx, p, relayProtocol(region))
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	a := s.newAnnouncement(r)
+	return cborutil.WriteCborRPC(stream, &a)
+}
+
+// Relays returns the gateway we relayed the dispatch through for each region we had no peers in.
+// Caches pulling from the gateways aren't counted in the response.
+func (r *Response) Relays() map[string]peer.ID {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	relays := make(map[string]peer.ID, len(r.relays))
+	for name, p := range r.relays {
+		relays[name] = p
+	}
+	return relays
+}
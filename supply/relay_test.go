@@ -0,0 +1,97 @@
+package supply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayThroughGateway(t *testing.T) {
+	testRelayThroughGateway(t, "Europe", func(ctx context.Context, s *Supply, r Request) (*Response, error) {
+		return s.DispatchRegions(ctx, r, ReplicationPolicy{
+			"Asia": 2,
+		})
+	})
+}
+
+func TestDispatchRelayThroughGateway(t *testing.T) {
+	// Publishers without peers in their own region relay plain dispatches through a gateway
+	testRelayThroughGateway(t, "Asia", func(ctx context.Context, s *Supply, r Request) (*Response, error) {
+		return s.Dispatch(ctx, r)
+	})
+}
+
+func testRelayThroughGateway(t *testing.T, region string, dispatch func(context.Context, *Supply, Request) (*Response, error)) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(ctx)
+
+	var nodes []*testutil.TestNode
+	var supplies []*Supply
+	// The gateway and the cache are in Asia
+	for _, name := range []string{region, "Asia", "Asia"} {
+		n := testutil.NewTestNode(mn, t)
+		n.SetupDataTransfer(ctx, t)
+		t.Cleanup(func() {
+			err := n.Dt.Stop(ctx)
+			require.NoError(t, err)
+		})
+		ps, err := pubsub.NewGossipSub(ctx, n.Host)
+		require.NoError(t, err)
+
+		s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions[name]}, nil)
+		require.NoError(t, s.EnableAnnouncements(ctx, ps))
+		nodes = append(nodes, n)
+		supplies = append(supplies, s)
+	}
+	publisher, gateway, cache := supplies[0], supplies[1], supplies[2]
+	gateway.EnableGateway()
+
+	require.NoError(t, mn.LinkAll())
+	// Only the gateway is connected to the cache
+	_, err := mn.ConnectPeers(nodes[1].Host.ID(), nodes[2].Host.ID())
+	require.NoError(t, err)
+	// Give some time for the gossip mesh to form
+	time.Sleep(2 * time.Second)
+
+	publisher.SetGateways([]peer.AddrInfo{{
+		ID:    nodes[1].Host.ID(),
+		Addrs: nodes[1].Host.Addrs(),
+	}})
+
+	fname := nodes[0].CreateRandomFile(t, 256000)
+	link, storeID, origBytes := nodes[0].LoadFileToNewStore(ctx, t, fname)
+	rootCid := link.(cidlink.Link).Cid
+	require.NoError(t, publisher.Register(rootCid, storeID))
+
+	res, err := dispatch(ctx, publisher, Request{PayloadCID: rootCid, Size: nodes[0].DAGSize(ctx, t, storeID, rootCid)})
+	require.NoError(t, err)
+	defer res.Close()
+	require.Equal(t, map[string]peer.ID{"Asia": nodes[1].Host.ID()}, res.Relays())
+
+	select {
+	case <-res.Done():
+	case <-ctx.Done():
+		t.Fatal("dispatch not done")
+	}
+	require.Equal(t, 1, res.Confirmed())
+	require.Equal(t, map[string]int{"Asia": 1}, res.RegionConfirmed())
+
+	// The gateway announced the content to the cache in its region
+	require.Eventually(t, func() bool {
+		// The access label is set once the transfer completed
+		rec, err := cache.store.GetRecord(rootCid)
+		return err == nil && rec.Labels[KLastAccess] != ""
+	}, 5*time.Second, 50*time.Millisecond)
+	store, err := cache.GetStore(rootCid)
+	require.NoError(t, err)
+	nodes[2].VerifyFileTransferred(ctx, t, store.DAG, rootCid, origBytes)
+}
@@ -0,0 +1,204 @@
+package supply
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ReplicationPolicy is the number of caches we want the content replicated to in each region
+// e.g. 5 in Europe and 3 in Asia
+type ReplicationPolicy map[string]int
+
+// ParseReplicationPolicy parses a comma separated list of region=rf pairs such as "Europe=5,Asia=3"
+func ParseReplicationPolicy(s string) (ReplicationPolicy, error) {
+	policy := make(ReplicationPolicy)
+	if s == "" {
+		return policy, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		sp := strings.SplitN(kv, "=", 2)
+		if len(sp) != 2 || sp[0] == "" {
+			return nil, fmt.Errorf("invalid replication factor %q, expected <region>=<rf>", kv)
+		}
+		rf, err := strconv.Atoi(sp[1])
+		if err != nil || rf < 0 {
+			return nil, fmt.Errorf("invalid replication factor for %s: %s", sp[0], sp[1])
+		}
+		policy[sp[0]] = rf
+	}
+	return policy, nil
+}
+
+// regionNames returns the regions of the policy with a positive replication factor in a stable order
+func (p ReplicationPolicy) regionNames() []string {
+	var names []string
+	for name, rf := range p {
+		if rf > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DispatchRegions sends the request to caches in each region of the policy independently so every region
+// gets its own replication factor. A cache is only counted in a single region. The replication factor of
+// each region is capped to MaxReceiverCount. Regions don't need to be part of our own regions.
+// Regions we have no peers in are relayed through a gateway if we know one.
+func (s *Supply) DispatchRegions(ctx context.Context, r Request, policy ReplicationPolicy) (*Response, error) {
+	res := newResponse()
+	if err := CheckCodec(r.PayloadCID); err != nil {
+		return res, err
+	}
+	names := policy.regionNames()
+	res.targets = make(map[string]int, len(names))
+	res.regionConfirmed = make(map[string]int, len(names))
+	for _, name := range names {
+		rf := policy[name]
+		if rf > MaxReceiverCount {
+			rf = MaxReceiverCount
+		}
+		res.targets[name] = rf
+	}
+	targets := s.selectRegionProviders(ctx, r, names, res.targets)
+	var missing []string
+	for _, name := range names {
+		if _, ok := targets[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	var relays map[string]peer.ID
+	if len(missing) > 0 && len(s.gateways) > 0 {
+		relays = s.selectGateways(ctx, missing)
+	}
+	res.regions = make(map[peer.ID]string)
+	for name, peers := range targets {
+		for _, p := range peers {
+			res.regions[p] = name
+		}
+	}
+	for name, p := range relays {
+		res.regions[p] = name
+	}
+	if len(res.regions) == 0 {
+		res.setAttempted(0)
+		return res, ErrNoPeers
+	}
+	res.unsub = s.watchDispatch(res, r.PayloadCID, r.PayloadCID)
+	res.watch(ctx)
+	s.sendRegions(ctx, res, r, r.PayloadCID, targets, relays)
+	return res, nil
+}
+
+// selectRegionProviders selects up to the target number of connected providers supporting each region.
+// Regions are served in order and providers already selected for a region are skipped in the next.
+func (s *Supply) selectRegionProviders(ctx context.Context, r Request, names []string, targets map[string]int) map[string][]peer.ID {
+	selected := make(map[peer.ID]bool)
+	providers := make(map[string][]peer.ID)
+	for _, name := range names {
+		proto := string(protoRegions(RequestProtocol, ParseRegions([]string{name}))[0])
+		var candidates []peer.ID
+		for _, pid := range s.h.Network().Peers() {
+			if pid == s.h.ID() || selected[pid] {
+				continue
+			}
+			supported, err := s.h.Peerstore().SupportsProtocols(pid, proto)
+			if err != nil || len(supported) == 0 {
+				continue
+			}
+			candidates = append(candidates, pid)
+		}
+		peers := s.strategy.Select(ctx, r, candidates, targets[name])
+		if len(peers) > targets[name] {
+			peers = peers[:targets[name]]
+		}
+		for _, p := range peers {
+			selected[p] = true
+		}
+		if len(peers) > 0 {
+			providers[name] = peers
+		}
+	}
+	return providers
+}
+
+// sendRegions authorizes the providers to pull the base CID and sends them the request over the
+// protocol of the region they were selected for. Gateways get the request over the relay protocol.
+func (s *Supply) sendRegions(ctx context.Context, res *Response, r Request, base cid.Cid, targets map[string][]peer.ID, relays map[string]peer.ID) {
+	attempted := len(relays)
+	for _, peers := range targets {
+		for _, p := range peers {
+			s.validation.Authorize(base, p)
+		}
+		attempted += len(peers)
+	}
+	res.mu.Lock()
+	res.relays = relays
+	res.mu.Unlock()
+	for _, p := range relays {
+		s.validation.Authorize(base, p)
+	}
+	res.setAttempted(attempted)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, peers := range targets {
+		wg.Add(1)
+		go func(region Region, peers []peer.ID) {
+			defer wg.Done()
+			sent := s.sendAllRequests(ctx, r, peers, region)
+			mu.Lock()
+			res.Sent = append(res.Sent, sent...)
+			mu.Unlock()
+		}(ParseRegions([]string{name})[0], peers)
+	}
+	for name, p := range relays {
+		wg.Add(1)
+		go func(region string, p peer.ID) {
+			defer wg.Done()
+			err := s.sendRelay(ctx, r, p, region)
+			mu.Lock()
+			res.Sent = append(res.Sent, SendResult{Provider: p, Err: err, Attempts: 1})
+			mu.Unlock()
+		}(name, p)
+	}
+	wg.Wait()
+	for _, sr := range res.Sent {
+		if sr.Err != nil {
+			res.fail(sr.Provider, sr.Err)
+		}
+	}
+}
+
+// RegionConfirmed returns the number of caches who pulled the content so far in each region
+// when dispatching with a replication policy
+func (r *Response) RegionConfirmed() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	confirmed := make(map[string]int, len(r.targets))
+	for name := range r.targets {
+		confirmed[name] = r.regionConfirmed[name]
+	}
+	return confirmed
+}
+
+// Shortfalls returns the number of caches missing to reach the replication factor of each region
+// that didn't reach it. It is only final once the response is done.
+func (r *Response) Shortfalls() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	shortfalls := make(map[string]int)
+	for name, rf := range r.targets {
+		if missing := rf - r.regionConfirmed[name]; missing > 0 {
+			shortfalls[name] = missing
+		}
+	}
+	return shortfalls
+}
@@ -0,0 +1,94 @@
+package supply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplicationPolicy(t *testing.T) {
+	policy, err := ParseReplicationPolicy("Europe=5,Asia=3")
+	require.NoError(t, err)
+	require.Equal(t, ReplicationPolicy{"Europe": 5, "Asia": 3}, policy)
+	require.Equal(t, []string{"Asia", "Europe"}, policy.regionNames())
+
+	_, err = ParseReplicationPolicy("Europe")
+	require.Error(t, err)
+	_, err = ParseReplicationPolicy("Europe=-1")
+	require.Error(t, err)
+}
+
+func TestDispatchRegions(t *testing.T) {
+	bgCtx := context.Background()
+
+	ctx, cancel := context.WithTimeout(bgCtx, 10*time.Second)
+	defer cancel()
+
+	mn := mocknet.New(bgCtx)
+
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(bgCtx, t)
+	t.Cleanup(func() {
+		err := n1.Dt.Stop(ctx)
+		require.NoError(t, err)
+	})
+
+	fname := n1.CreateRandomFile(t, 256000)
+	link, storeID, _ := n1.LoadFileToNewStore(bgCtx, t, fname)
+	rootCid := link.(cidlink.Link).Cid
+
+	// The publisher is only in Europe but can still replicate to Asia
+	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, []Region{Regions["Europe"]}, nil)
+	require.NoError(t, supply.Register(rootCid, storeID))
+
+	providers := map[string]int{"Europe": 3, "Asia": 2}
+	stores := make(map[string][]*Supply)
+	for name, count := range providers {
+		for i := 0; i < count; i++ {
+			n := testutil.NewTestNode(mn, t)
+			n.SetupDataTransfer(bgCtx, t)
+			t.Cleanup(func() {
+				err := n.Dt.Stop(ctx)
+				require.NoError(t, err)
+			})
+			stores[name] = append(stores[name], New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions[name]}, nil))
+		}
+	}
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	time.Sleep(10 * time.Millisecond)
+
+	res, err := supply.DispatchRegions(ctx, Request{PayloadCID: rootCid, Size: n1.DAGSize(ctx, t, storeID, rootCid)}, ReplicationPolicy{
+		"Europe": 2,
+		"Asia":   3,
+	})
+	defer res.Close()
+	require.NoError(t, err)
+	require.Equal(t, 4, res.Attempted())
+
+	select {
+	case <-res.Done():
+	case <-ctx.Done():
+		t.Fatal("dispatch not done")
+	}
+	require.Equal(t, map[string]int{"Europe": 2, "Asia": 2}, res.RegionConfirmed())
+	// There are only 2 caches in Asia
+	require.Equal(t, map[string]int{"Asia": 1}, res.Shortfalls())
+
+	// Each cache recorded the region it received the content for
+	for name, ss := range stores {
+		for _, s := range ss {
+			rec, err := s.store.GetRecord(rootCid)
+			if err != nil {
+				continue
+			}
+			require.Equal(t, name, rec.Labels[KRegion])
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package supply
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ErrRequestRejected is returned when a dispatch request doesn't match our accept rules
+var ErrRequestRejected = errors.New("request rejected")
+
+var rulesKey = datastore.NewKey("rules")
+
+// AcceptRules decide which dispatch requests we pull. Zero values accept everything so the default
+// rules accept all the requests.
+type AcceptRules struct {
+	// MaxSize is the largest content in bytes we pull
+	MaxSize uint64 `json:"max-size,omitempty"`
+	// Regions we accept requests for. Requests for our other regions are rejected.
+	Regions []string `json:"regions,omitempty"`
+	// Publishers we accept content from. Content from other publishers is rejected.
+	Publishers []peer.ID `json:"publishers,omitempty"`
+	// MinPricePerByte is the lowest price per byte publishers must offer to cache their content
+	MinPricePerByte abi.TokenAmount `json:"min-price-per-byte"`
+}
+
+// Check returns an error wrapping ErrRequestRejected if the request of a publisher in the given region
+// doesn't match the rules
+func (r AcceptRules) Check(req Request, publisher peer.ID, region string) error {
+	if r.MaxSize > 0 && req.Size > r.MaxSize {
+		return fmt.Errorf("%w: size %d over %d bytes", ErrRequestRejected, req.Size, r.MaxSize)
+	}
+	if len(r.Regions) > 0 && !containsString(r.Regions, region) {
+		return fmt.Errorf("%w: region %s not accepted", ErrRequestRejected, region)
+	}
+	if len(r.Publishers) > 0 && !containsPeer(r.Publishers, publisher) {
+		return fmt.Errorf("%w: publisher %s not accepted", ErrRequestRejected, publisher)
+	}
+	if !r.MinPricePerByte.Nil() && r.MinPricePerByte.GreaterThan(abi.NewTokenAmount(0)) {
+		if req.PricePerByte == nil || req.PricePerByte.LessThan(r.MinPricePerByte) {
+			return fmt.Errorf("%w: price per byte under %s", ErrRequestRejected, r.MinPricePerByte)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPeer(list []peer.ID, p peer.ID) bool {
+	for _, e := range list {
+		if e == p {
+			return true
+		}
+	}
+	return false
+}
+
+// ruleKeeper holds the accept rules we apply to incoming requests and persists them
+type ruleKeeper struct {
+	mu    sync.RWMutex
+	rules AcceptRules
+	ds    datastore.Batching
+}
+
+// newRuleKeeper loads the rules we set last time if any
+func newRuleKeeper(ds datastore.Batching) *ruleKeeper {
+	k := &ruleKeeper{ds: ds}
+	if b, err := ds.Get(rulesKey); err == nil {
+		json.Unmarshal(b, &k.rules)
+	}
+	return k
+}
+
+func (k *ruleKeeper) get() AcceptRules {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.rules
+}
+
+func (k *ruleKeeper) set(r AcceptRules) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.rules = r
+	return k.ds.Put(rulesKey, b)
+}
+
+// accept evaluates our rules against a request received from a peer
+func (h *handler) accept(p peer.ID, region string, req Request) error {
+	return h.rules.get().Check(req, h.quotas.signer(req, p), region)
+}
+
+// SetAcceptRules replaces the rules deciding which requests we pull. Rules are persisted and
+// reloaded when restarting.
+func (s *Supply) SetAcceptRules(r AcceptRules) error {
+	return s.rules.set(r)
+}
+
+// AcceptRules returns the rules deciding which requests we pull
+func (s *Supply) AcceptRules() AcceptRules {
+	return s.rules.get()
+}
@@ -0,0 +1,82 @@
+package supply
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptRules(t *testing.T) {
+	_, p1 := testPeer(t)
+	_, p2 := testPeer(t)
+	req := Request{PayloadCID: testRoot(t, 0), Size: 1000}
+
+	// The default rules accept everything
+	require.NoError(t, AcceptRules{}.Check(req, p1, "Europe"))
+
+	rules := AcceptRules{
+		MaxSize:    1000,
+		Regions:    []string{"Europe"},
+		Publishers: []peer.ID{p1},
+	}
+	require.NoError(t, rules.Check(req, p1, "Europe"))
+
+	large := req
+	large.Size = 1001
+	require.True(t, errors.Is(rules.Check(large, p1, "Europe"), ErrRequestRejected))
+	require.True(t, errors.Is(rules.Check(req, p1, "Asia"), ErrRequestRejected))
+	require.True(t, errors.Is(rules.Check(req, p2, "Europe"), ErrRequestRejected))
+
+	rules = AcceptRules{MinPricePerByte: abi.NewTokenAmount(10)}
+	require.True(t, errors.Is(rules.Check(req, p1, "Europe"), ErrRequestRejected))
+	low := abi.NewTokenAmount(9)
+	req.PricePerByte = &low
+	require.True(t, errors.Is(rules.Check(req, p1, "Europe"), ErrRequestRejected))
+	enough := abi.NewTokenAmount(10)
+	req.PricePerByte = &enough
+	require.NoError(t, rules.Check(req, p1, "Europe"))
+
+	// The offer survives the wire
+	buf := new(bytes.Buffer)
+	require.NoError(t, req.MarshalCBOR(buf))
+	var dec Request
+	require.NoError(t, dec.UnmarshalCBOR(buf))
+	require.True(t, enough.Equals(*dec.PricePerByte))
+
+	req.PricePerByte = nil
+	buf.Reset()
+	require.NoError(t, req.MarshalCBOR(buf))
+	dec = Request{}
+	require.NoError(t, dec.UnmarshalCBOR(buf))
+	require.Nil(t, dec.PricePerByte)
+}
+
+func TestRuleKeeper(t *testing.T) {
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	_, p1 := testPeer(t)
+
+	k := newRuleKeeper(ds)
+	require.Equal(t, uint64(0), k.get().MaxSize)
+
+	rules := AcceptRules{
+		MaxSize:         1 << 30,
+		Regions:         []string{"Europe", "Asia"},
+		Publishers:      []peer.ID{p1},
+		MinPricePerByte: abi.NewTokenAmount(5),
+	}
+	require.NoError(t, k.set(rules))
+
+	// Rules are reloaded after restarting
+	k = newRuleKeeper(ds)
+	got := k.get()
+	require.Equal(t, rules.MaxSize, got.MaxSize)
+	require.Equal(t, rules.Regions, got.Regions)
+	require.Equal(t, rules.Publishers, got.Publishers)
+	require.True(t, rules.MinPricePerByte.Equals(got.MinPricePerByte))
+}
@@ -0,0 +1,302 @@
+package supply
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	dagpb "github.com/ipld/go-ipld-prime-proto"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+)
+
+// ErrSchemaMismatch is returned when a DAG does not conform to the schema attached to its root
+var ErrSchemaMismatch = errors.New("DAG does not match schema")
+
+// Kinds supported in a schema type definition. "struct" is a map with known fields
+// while "any" skips validation for that part of the tree.
+const (
+	KindAny    = "any"
+	KindBool   = "bool"
+	KindInt    = "int"
+	KindFloat  = "float"
+	KindString = "string"
+	KindBytes  = "bytes"
+	KindLink   = "link"
+	KindList   = "list"
+	KindMap    = "map"
+	KindStruct = "struct"
+)
+
+// SchemaField describes a single field of a struct type
+type SchemaField struct {
+	Type     string
+	Optional bool
+	Nullable bool
+}
+
+// SchemaType describes the shape of a node. Elem is the type name of list items or map values
+// and Fields the expected fields of a struct.
+type SchemaType struct {
+	Kind   string
+	Elem   string                 `json:",omitempty"`
+	Fields map[string]SchemaField `json:",omitempty"`
+}
+
+// Schema is a minimal subset of IPLD schemas publishers can attach to a root so caches and clients
+// can check the data they receive is what the application expects. Links are not followed so
+// the schema only applies to the root block.
+type Schema struct {
+	Root  string
+	Types map[string]SchemaType
+}
+
+// Validate checks a node against the root type of the schema
+func (s *Schema) Validate(n ipld.Node) error {
+	if _, ok := s.Types[s.Root]; !ok && !isBuiltinKind(s.Root) {
+		return fmt.Errorf("root type %s not defined", s.Root)
+	}
+	return s.validate(s.Root, n, s.Root)
+}
+
+func isBuiltinKind(k string) bool {
+	switch k {
+	case KindAny, KindBool, KindInt, KindFloat, KindString, KindBytes, KindLink:
+		return true
+	}
+	return false
+}
+
+func (s *Schema) validate(tname string, n ipld.Node, path string) error {
+	mismatch := func(expected string) error {
+		return fmt.Errorf("%w: %s expected %s", ErrSchemaMismatch, path, expected)
+	}
+	t, ok := s.Types[tname]
+	if !ok {
+		// Builtin kinds can be referenced directly by name
+		if !isBuiltinKind(tname) {
+			return fmt.Errorf("type %s not defined", tname)
+		}
+		t = SchemaType{Kind: tname}
+	}
+	switch t.Kind {
+	case KindAny:
+		return nil
+	case KindBool:
+		if n.Kind() != ipld.Kind_Bool {
+			return mismatch(t.Kind)
+		}
+	case KindInt:
+		if n.Kind() != ipld.Kind_Int {
+			return mismatch(t.Kind)
+		}
+	case KindFloat:
+		if n.Kind() != ipld.Kind_Float {
+			return mismatch(t.Kind)
+		}
+	case KindString:
+		if n.Kind() != ipld.Kind_String {
+			return mismatch(t.Kind)
+		}
+	case KindBytes:
+		if n.Kind() != ipld.Kind_Bytes {
+			return mismatch(t.Kind)
+		}
+	case KindLink:
+		if n.Kind() != ipld.Kind_Link {
+			return mismatch(t.Kind)
+		}
+	case KindList:
+		if n.Kind() != ipld.Kind_List {
+			return mismatch(t.Kind)
+		}
+		it := n.ListIterator()
+		for !it.Done() {
+			i, v, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if err := s.validate(t.Elem, v, fmt.Sprintf("%s/%d", path, i)); err != nil {
+				return err
+			}
+		}
+	case KindMap:
+		if n.Kind() != ipld.Kind_Map {
+			return mismatch(t.Kind)
+		}
+		it := n.MapIterator()
+		for !it.Done() {
+			k, v, err := it.Next()
+			if err != nil {
+				return err
+			}
+			ks, err := k.AsString()
+			if err != nil {
+				return err
+			}
+			if err := s.validate(t.Elem, v, path+"/"+ks); err != nil {
+				return err
+			}
+		}
+	case KindStruct:
+		if n.Kind() != ipld.Kind_Map {
+			return mismatch(t.Kind)
+		}
+		for name, f := range t.Fields {
+			v, err := n.LookupByString(name)
+			if err != nil || v == nil || v.IsAbsent() {
+				if f.Optional {
+					continue
+				}
+				return fmt.Errorf("%w: %s/%s is missing", ErrSchemaMismatch, path, name)
+			}
+			if v.IsNull() {
+				if f.Nullable {
+					continue
+				}
+				return fmt.Errorf("%w: %s/%s is null", ErrSchemaMismatch, path, name)
+			}
+			if err := s.validate(f.Type, v, path+"/"+name); err != nil {
+				return err
+			}
+		}
+		it := n.MapIterator()
+		for !it.Done() {
+			k, _, err := it.Next()
+			if err != nil {
+				return err
+			}
+			ks, err := k.AsString()
+			if err != nil {
+				return err
+			}
+			if _, ok := t.Fields[ks]; !ok {
+				return fmt.Errorf("%w: %s/%s is not a field of %s", ErrSchemaMismatch, path, ks, tname)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown kind %s", t.Kind)
+	}
+	return nil
+}
+
+// ParseSchema decodes a JSON encoded schema and checks all the types it references are defined
+func ParseSchema(b []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	defined := func(name string) bool {
+		_, ok := s.Types[name]
+		return ok || isBuiltinKind(name)
+	}
+	if !defined(s.Root) {
+		return nil, fmt.Errorf("root type %s not defined", s.Root)
+	}
+	for name, t := range s.Types {
+		switch t.Kind {
+		case KindList, KindMap:
+			if !defined(t.Elem) {
+				return nil, fmt.Errorf("type %s not defined in %s", t.Elem, name)
+			}
+		case KindStruct:
+			for fname, f := range t.Fields {
+				if !defined(f.Type) {
+					return nil, fmt.Errorf("type %s not defined in %s.%s", f.Type, name, fname)
+				}
+			}
+		}
+	}
+	return &s, nil
+}
+
+// SchemaRegistry persists the schemas attached to content roots
+type SchemaRegistry struct {
+	ds datastore.Batching
+}
+
+// NewSchemaRegistry creates a new registry in the given datastore
+func NewSchemaRegistry(ds datastore.Batching) *SchemaRegistry {
+	return &SchemaRegistry{ds}
+}
+
+// Attach a schema to a given root
+func (r *SchemaRegistry) Attach(root cid.Cid, s *Schema) error {
+	enc, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return r.ds.Put(datastore.NewKey(root.String()), enc)
+}
+
+// Get the schema attached to a given root. Returns datastore.ErrNotFound if none is attached.
+func (r *SchemaRegistry) Get(root cid.Cid) (*Schema, error) {
+	enc, err := r.ds.Get(datastore.NewKey(root.String()))
+	if err != nil {
+		return nil, err
+	}
+	var s Schema
+	if err := json.Unmarshal(enc, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// encoded returns the JSON encoding of the schema attached to a root to send along a dispatch request.
+// It returns nil if the root has no schema.
+func (r *SchemaRegistry) encoded(root cid.Cid) ([]byte, error) {
+	enc, err := r.ds.Get(datastore.NewKey(root.String()))
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil, nil
+	}
+	return enc, err
+}
+
+// Detach removes the schema attached to a root if any
+func (r *SchemaRegistry) Detach(root cid.Cid) error {
+	return r.ds.Delete(datastore.NewKey(root.String()))
+}
+
+// Validate loads the root block with the given loader and checks it against the attached schema.
+// Roots without schema are always valid.
+func (r *SchemaRegistry) Validate(ctx context.Context, root cid.Cid, loader ipld.Loader) error {
+	s, err := r.Get(root)
+	if errors.Is(err, datastore.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	link := cidlink.Link{Cid: root}
+	chooser := dagpb.AddDagPBSupportToChooser(func(ipld.Link, ipld.LinkContext) (ipld.NodePrototype, error) {
+		return basicnode.Prototype.Any, nil
+	})
+	proto, err := chooser(link, ipld.LinkContext{})
+	if err != nil {
+		return err
+	}
+	nb := proto.NewBuilder()
+	if err := link.Load(ctx, ipld.LinkContext{}, nb, loader); err != nil {
+		return err
+	}
+	return s.Validate(nb.Build())
+}
+
+// attachRequestSchema attaches the schema a publisher sent with a dispatch request so the content
+// it pulled can be validated against it
+func (s *Supply) attachRequestSchema(state datatransfer.ChannelState) error {
+	req, ok := state.Voucher().(*Request)
+	if !ok || len(req.Schema) == 0 {
+		return nil
+	}
+	sch, err := ParseSchema(req.Schema)
+	if err != nil {
+		return err
+	}
+	return s.schemas.Attach(req.PayloadCID, sch)
+}
@@ -0,0 +1,76 @@
+package supply
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-ipld-prime/fluent"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaValidate(t *testing.T) {
+	s := &Schema{
+		Root: "Meta",
+		Types: map[string]SchemaType{
+			"Meta": {
+				Kind: KindStruct,
+				Fields: map[string]SchemaField{
+					"name":  {Type: KindString},
+					"tags":  {Type: "Tags", Optional: true},
+					"image": {Type: KindLink},
+				},
+			},
+			"Tags": {Kind: KindList, Elem: KindString},
+		},
+	}
+	c, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+
+	valid := fluent.MustBuildMap(basicnode.Prototype.Map, 3, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("name").AssignString("Myel")
+		ma.AssembleEntry("image").AssignLink(cidlink.Link{Cid: c})
+		ma.AssembleEntry("tags").CreateList(1, func(la fluent.ListAssembler) {
+			la.AssembleValue().AssignString("cdn")
+		})
+	})
+	require.NoError(t, s.Validate(valid))
+
+	invalid := fluent.MustBuildMap(basicnode.Prototype.Map, 2, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("name").AssignInt(1)
+		ma.AssembleEntry("image").AssignLink(cidlink.Link{Cid: c})
+	})
+	require.True(t, errors.Is(s.Validate(invalid), ErrSchemaMismatch))
+
+	missing := fluent.MustBuildMap(basicnode.Prototype.Map, 1, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("name").AssignString("Myel")
+	})
+	require.True(t, errors.Is(s.Validate(missing), ErrSchemaMismatch))
+
+	// Unknown fields are rejected even when optional fields are left out
+	unknown := fluent.MustBuildMap(basicnode.Prototype.Map, 3, func(ma fluent.MapAssembler) {
+		ma.AssembleEntry("name").AssignString("Myel")
+		ma.AssembleEntry("image").AssignLink(cidlink.Link{Cid: c})
+		ma.AssembleEntry("extra").AssignBool(true)
+	})
+	require.True(t, errors.Is(s.Validate(unknown), ErrSchemaMismatch))
+
+	enc, err := json.Marshal(s)
+	require.NoError(t, err)
+	parsed, err := ParseSchema(enc)
+	require.NoError(t, err)
+	require.Equal(t, s, parsed)
+	_, err = ParseSchema([]byte(`{"Root":"Meta","Types":{"Meta":{"Kind":"list","Elem":"Tag"}}}`))
+	require.Error(t, err)
+
+	reg := NewSchemaRegistry(dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, reg.Attach(c, s))
+	got, err := reg.Get(c)
+	require.NoError(t, err)
+	require.Equal(t, s, got)
+}
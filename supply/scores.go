@@ -0,0 +1,167 @@
+package supply
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultCacheHalfLife is how long it takes for the weight of past audits of a cache to halve
+const DefaultCacheHalfLife = 7 * 24 * time.Hour
+
+// DefaultMinCacheScore is the score under which we stop dispatching content to a cache
+const DefaultMinCacheScore = 0.25
+
+// minCacheObservations is the weight of audits we need before skipping a cache so a single failure
+// doesn't exclude anyone
+const minCacheObservations = 3
+
+// CacheRecord is what we remember about how reliably a cache serves the content we dispatched to it
+type CacheRecord struct {
+	Peer peer.ID
+	// Successes and Failures are decayed counts of audits
+	Successes float64
+	Failures  float64
+	// LastError describes the last failure and LastFailure when it happened
+	LastError   string
+	LastFailure time.Time
+	Updated     time.Time
+}
+
+// Score is the likelihood of the cache serving our content from 0 to 1. Caches we know nothing about
+// score 0.5.
+func (r CacheRecord) Score() float64 {
+	return (r.Successes + 1) / (r.Successes + r.Failures + 2)
+}
+
+// CacheScores records the audits of the caches holding our content so dispatches skip the caches
+// failing to serve it. Records are persisted in the datastore.
+type CacheScores struct {
+	// HalfLife is how fast past audits lose weight
+	HalfLife time.Duration
+	// MinScore is the score under which caches are skipped
+	MinScore float64
+
+	ds  datastore.Batching
+	now func() time.Time
+
+	mu   sync.Mutex
+	recs map[peer.ID]*CacheRecord
+}
+
+// NewCacheScores creates cache scores persisted in the datastore
+func NewCacheScores(ds datastore.Batching) *CacheScores {
+	return &CacheScores{
+		HalfLife: DefaultCacheHalfLife,
+		MinScore: DefaultMinCacheScore,
+		ds:       namespace.Wrap(ds, datastore.NewKey("/cache-scores")),
+		now:      time.Now,
+		recs:     make(map[peer.ID]*CacheRecord),
+	}
+}
+
+// decay reduces the weight of past audits since the last update
+func (cs *CacheScores) decay(r *CacheRecord, now time.Time) {
+	if !r.Updated.IsZero() && cs.HalfLife > 0 {
+		elapsed := now.Sub(r.Updated)
+		if elapsed > 0 {
+			f := math.Pow(0.5, float64(elapsed)/float64(cs.HalfLife))
+			r.Successes *= f
+			r.Failures *= f
+		}
+	}
+	r.Updated = now
+}
+
+// load returns the record of a cache from memory or the datastore. Must be called with the lock.
+func (cs *CacheScores) load(p peer.ID) *CacheRecord {
+	if r, ok := cs.recs[p]; ok {
+		return r
+	}
+	r := &CacheRecord{Peer: p}
+	if b, err := cs.ds.Get(datastore.NewKey(p.String())); err == nil {
+		if err := json.Unmarshal(b, r); err != nil {
+			r = &CacheRecord{Peer: p}
+		}
+	}
+	cs.recs[p] = r
+	return r
+}
+
+func (cs *CacheScores) update(p peer.ID, fn func(r *CacheRecord)) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	r := cs.load(p)
+	cs.decay(r, cs.now())
+	fn(r)
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return cs.ds.Put(datastore.NewKey(p.String()), b)
+}
+
+// RecordSuccess counts an audit the cache passed
+func (cs *CacheScores) RecordSuccess(p peer.ID) error {
+	return cs.update(p, func(r *CacheRecord) {
+		r.Successes++
+	})
+}
+
+// RecordFailure counts an audit the cache failed
+func (cs *CacheScores) RecordFailure(p peer.ID, reason error) error {
+	return cs.update(p, func(r *CacheRecord) {
+		r.Failures++
+		r.LastFailure = cs.now()
+		if reason != nil {
+			r.LastError = reason.Error()
+		}
+	})
+}
+
+// Record returns what we know about a cache with decay applied
+func (cs *CacheScores) Record(p peer.ID) CacheRecord {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	r := *cs.load(p)
+	cs.decay(&r, cs.now())
+	return r
+}
+
+// Skip tells if a cache failed enough audits recently that we shouldn't dispatch content to it
+func (cs *CacheScores) Skip(p peer.ID) bool {
+	r := cs.Record(p)
+	return r.Successes+r.Failures >= minCacheObservations && r.Score() < cs.MinScore
+}
+
+// List returns the records of all the caches we audited sorted by score
+func (cs *CacheScores) List() ([]CacheRecord, error) {
+	res, err := cs.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var recs []CacheRecord
+	for e := range res.Next() {
+		if e.Error != nil {
+			return nil, e.Error
+		}
+		var r CacheRecord
+		if err := json.Unmarshal(e.Value, &r); err != nil {
+			continue
+		}
+		recs = append(recs, cs.Record(r.Peer))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Score() > recs[j].Score()
+	})
+	return recs, nil
+}
@@ -0,0 +1,65 @@
+package supply
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dss "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheScores(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	now := time.Now()
+	cs := NewCacheScores(ds)
+	cs.now = func() time.Time { return now }
+
+	_, good := testPeer(t)
+	_, bad := testPeer(t)
+
+	// Unknown caches are neutral
+	require.Equal(t, 0.5, cs.Record(good).Score())
+	require.False(t, cs.Skip(good))
+
+	require.NoError(t, cs.RecordSuccess(good))
+	require.NoError(t, cs.RecordFailure(bad, errors.New("no offer")))
+	// A single failed audit doesn't exclude a cache
+	require.False(t, cs.Skip(bad))
+	require.NoError(t, cs.RecordFailure(bad, errors.New("no offer")))
+	require.NoError(t, cs.RecordFailure(bad, errors.New("missing block")))
+	require.True(t, cs.Skip(bad))
+	require.Equal(t, "missing block", cs.Record(bad).LastError)
+	require.Equal(t, now.Unix(), cs.Record(bad).LastFailure.Unix())
+
+	// Failures are forgotten over time
+	now = now.Add(2 * DefaultCacheHalfLife)
+	require.False(t, cs.Skip(bad))
+
+	// Records persist in the datastore
+	cs2 := NewCacheScores(ds)
+	cs2.now = func() time.Time { return now }
+	recs, err := cs2.List()
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+	require.Equal(t, good, recs[0].Peer)
+}
+
+func TestDispatchedRoots(t *testing.T) {
+	ds := dss.MutexWrap(datastore.NewMapDatastore())
+	s := &Supply{caches: ds}
+
+	_, p1 := testPeer(t)
+	_, p2 := testPeer(t)
+	root1, root2 := testRoot(t, 1), testRoot(t, 2)
+
+	s.recordCache(root1, p1)
+	s.recordCache(root1, p2)
+	s.recordCache(root2, p1)
+
+	roots, err := s.DispatchedRoots()
+	require.NoError(t, err)
+	require.ElementsMatch(t, roots, []cid.Cid{root1, root2})
+}
@@ -0,0 +1,220 @@
+package supply
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+)
+
+// KUnsealed is the label of content served from an unsealed sector. Its value is the piece CID.
+const KUnsealed = "unsealed"
+
+// ErrNoSectorAccess is returned when trying to unseal content without a sector accessor
+var ErrNoSectorAccess = errors.New("no sector accessor")
+
+// ErrPieceNotFound is returned when no piece holds a payload
+var ErrPieceNotFound = errors.New("piece not found")
+
+// UnsealTimeout bounds how long we wait for a sector to be unsealed when looking up a store
+const UnsealTimeout = 10 * time.Minute
+
+// UnsealedGrace is how long we keep unsealed content no transfer is serving before dropping it
+const UnsealedGrace = time.Minute
+
+// PieceInfo locates a payload in a piece stored by a miner
+type PieceInfo struct {
+	PieceCID    cid.Cid
+	PayloadSize uint64
+}
+
+// SectorAccessor gives a cache colocated with a storage miner access to the miner's sectors
+// so content can be served without keeping a duplicate copy in our blockstore
+type SectorAccessor interface {
+	// FindPiece returns the piece in which a payload is stored
+	FindPiece(ctx context.Context, payload cid.Cid) (PieceInfo, error)
+	// UnsealedReader returns a reader over the CAR file of a piece, unsealing the sector if needed
+	UnsealedReader(ctx context.Context, piece cid.Cid) (io.ReadCloser, error)
+}
+
+// sectorServer keeps track of the content unsealed while it is being served
+type sectorServer struct {
+	sa SectorAccessor
+	// grace is how long unsealed content is kept without any transfer
+	grace time.Duration
+
+	mu     sync.Mutex
+	active map[cid.Cid]int
+}
+
+// SetSectorAccessor enables serving content from unsealed sectors when we don't have it in store
+func (s *Supply) SetSectorAccessor(sa SectorAccessor) {
+	s.sectors = &sectorServer{
+		sa:     sa,
+		grace:  UnsealedGrace,
+		active: make(map[cid.Cid]int),
+	}
+	s.events.Subscribe(cid.Undef, s.handleSectorEvent)
+}
+
+// FindUnsealable checks if the content can be served from the miner's sectors
+func (s *Supply) FindUnsealable(ctx context.Context, root cid.Cid) (PieceInfo, error) {
+	if s.sectors == nil {
+		return PieceInfo{}, ErrNoSectorAccess
+	}
+	return s.sectors.sa.FindPiece(ctx, root)
+}
+
+// unseal loads the content of a piece in a new store so it can be served. The store is dropped
+// once all the transfers serving it are over.
+func (s *Supply) unseal(ctx context.Context, root cid.Cid) error {
+	info, err := s.FindUnsealable(ctx, root)
+	if err != nil {
+		return err
+	}
+	r, err := s.sectors.sa.UnsealedReader(ctx, info.PieceCID)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	storeID := s.ms.Next()
+	store, err := s.ms.Get(storeID)
+	if err != nil {
+		return err
+	}
+	if _, err := car.LoadCar(store.Bstore, r); err != nil {
+		s.ms.Delete(storeID)
+		return err
+	}
+	err = s.store.PutRecord(root, &ContentRecord{Labels: map[string]string{
+		KStoreID:  fmt.Sprintf("%d", storeID),
+		KSize:     fmt.Sprintf("%d", info.PayloadSize),
+		KUnsealed: info.PieceCID.String(),
+	}})
+	if err != nil {
+		return err
+	}
+	// Content looked up outside of a transfer, e.g. by the gateway, has no transfer ending to drop it
+	time.AfterFunc(s.sectors.grace, func() {
+		ss := s.sectors
+		ss.mu.Lock()
+		defer ss.mu.Unlock()
+		if ss.active[root] == 0 {
+			s.dropUnsealed(root)
+		}
+	})
+	return nil
+}
+
+// dropUnsealed removes the store of content we unsealed. The caller must hold the lock of the sector server.
+func (s *Supply) dropUnsealed(root cid.Cid) {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return
+	}
+	if _, ok := rec.Labels[KUnsealed]; !ok {
+		return
+	}
+	if err := s.RemoveContent(root); err != nil {
+		s.log.Error().Err(err).Str("root", root.String()).Msg("failed to drop unsealed content")
+	}
+}
+
+// handleSectorEvent drops unsealed content once we're done serving it
+func (s *Supply) handleSectorEvent(event datatransfer.Event, state datatransfer.ChannelState) {
+	if state.Sender() != s.h.ID() {
+		return
+	}
+	root := state.BaseCID()
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return
+	}
+	if _, ok := rec.Labels[KUnsealed]; !ok {
+		return
+	}
+	ss := s.sectors
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	switch event.Code {
+	case datatransfer.Open:
+		ss.active[root]++
+	case datatransfer.Complete, datatransfer.Error, datatransfer.Cancel:
+		ss.active[root]--
+		if ss.active[root] > 0 {
+			return
+		}
+		delete(ss.active, root)
+		s.dropUnsealed(root)
+	}
+}
+
+// DirSectorAccessor serves the unsealed pieces a miner exports to a directory as <piece cid>.car files
+type DirSectorAccessor struct {
+	dir string
+}
+
+// NewDirSectorAccessor checks the directory of unsealed pieces exists
+func NewDirSectorAccessor(dir string) (*DirSectorAccessor, error) {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &DirSectorAccessor{dir}, nil
+}
+
+// FindPiece reads the header of the piece files to find the one rooted at the payload
+func (d *DirSectorAccessor) FindPiece(ctx context.Context, payload cid.Cid) (PieceInfo, error) {
+	matches, err := filepath.Glob(filepath.Join(d.dir, "*.car"))
+	if err != nil {
+		return PieceInfo{}, err
+	}
+	for _, m := range matches {
+		if err := ctx.Err(); err != nil {
+			return PieceInfo{}, err
+		}
+		piece, err := cid.Decode(strings.TrimSuffix(filepath.Base(m), ".car"))
+		if err != nil {
+			continue
+		}
+		f, err := os.Open(m)
+		if err != nil {
+			continue
+		}
+		h, _, err := car.ReadHeader(bufio.NewReader(f))
+		st, serr := f.Stat()
+		f.Close()
+		if err != nil || serr != nil {
+			continue
+		}
+		for _, r := range h.Roots {
+			if r.Equals(payload) {
+				return PieceInfo{PieceCID: piece, PayloadSize: uint64(st.Size())}, nil
+			}
+		}
+	}
+	return PieceInfo{}, ErrPieceNotFound
+}
+
+// UnsealedReader opens the file of a piece
+func (d *DirSectorAccessor) UnsealedReader(ctx context.Context, piece cid.Cid) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(d.dir, piece.String()+".car"))
+	if os.IsNotExist(err) {
+		return nil, ErrPieceNotFound
+	}
+	return f, err
+}
@@ -0,0 +1,124 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSectors holds a single unsealed piece in memory
+type fakeSectors struct {
+	piece   cid.Cid
+	payload cid.Cid
+	data    []byte
+	unseals int
+}
+
+func (f *fakeSectors) FindPiece(ctx context.Context, payload cid.Cid) (PieceInfo, error) {
+	if !payload.Equals(f.payload) {
+		return PieceInfo{}, ErrPieceNotFound
+	}
+	return PieceInfo{PieceCID: f.piece, PayloadSize: uint64(len(f.data))}, nil
+}
+
+func (f *fakeSectors) UnsealedReader(ctx context.Context, piece cid.Cid) (io.ReadCloser, error) {
+	if !piece.Equals(f.piece) {
+		return nil, ErrPieceNotFound
+	}
+	f.unseals++
+	return ioutil.NopCloser(bytes.NewReader(f.data)), nil
+}
+
+func TestUnsealFromSectors(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	miner := testutil.NewTestNode(mn, t)
+	fname := miner.CreateRandomFile(t, 1000)
+	link, storeID, origBytes := miner.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+	store, err := miner.Ms.Get(storeID)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	require.NoError(t, car.WriteCar(ctx, store.DAG, []cid.Cid{root}, buf))
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+
+	_, err = s.FindUnsealable(ctx, root)
+	require.Equal(t, ErrNoSectorAccess, err)
+
+	sectors := &fakeSectors{piece: testRoot(t, 1), payload: root, data: buf.Bytes()}
+	s.SetSectorAccessor(sectors)
+	s.sectors.grace = 50 * time.Millisecond
+
+	info, err := s.FindUnsealable(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, sectors.piece, info.PieceCID)
+
+	sid, err := s.GetStoreIDContext(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, 1, sectors.unseals)
+	unsealed, err := s.GetStore(root)
+	require.NoError(t, err)
+	n.VerifyFileTransferred(ctx, t, unsealed.DAG, root, origBytes)
+
+	// Without any transfer serving it the unsealed content is dropped after the grace period
+	require.Eventually(t, func() bool {
+		return !s.hasStore(sid)
+	}, time.Second, 10*time.Millisecond)
+	_, err = s.store.GetRecord(root)
+	require.Error(t, err)
+
+	// Content we don't have and which isn't in a sector is not found
+	_, err = s.GetStoreIDContext(ctx, testRoot(t, 2))
+	require.Error(t, err)
+}
+
+func TestDirSectorAccessor(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+	store, err := n.Ms.Get(storeID)
+	require.NoError(t, err)
+	buf := new(bytes.Buffer)
+	require.NoError(t, car.WriteCar(ctx, store.DAG, []cid.Cid{root}, buf))
+
+	dir := t.TempDir()
+	piece := testRoot(t, 1)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, piece.String()+".car"), buf.Bytes(), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.car"), []byte("not a piece"), 0644))
+
+	sa, err := NewDirSectorAccessor(dir)
+	require.NoError(t, err)
+	info, err := sa.FindPiece(ctx, root)
+	require.NoError(t, err)
+	require.Equal(t, piece, info.PieceCID)
+	require.Equal(t, uint64(buf.Len()), info.PayloadSize)
+
+	_, err = sa.FindPiece(ctx, testRoot(t, 2))
+	require.Equal(t, ErrPieceNotFound, err)
+
+	r, err := sa.UnsealedReader(ctx, piece)
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	require.Equal(t, buf.Bytes(), b)
+}
@@ -0,0 +1,189 @@
+package supply
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	peer "github.com/libp2p/go-libp2p-core/peer"
+)
+
+// ProviderSelectionStrategy picks which providers we dispatch content to among the connected
+// providers supporting our regions
+type ProviderSelectionStrategy interface {
+	// Select returns at most n providers from the candidates
+	Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID
+}
+
+// FirstConnected selects the first n connected providers. It is the default strategy.
+type FirstConnected struct{}
+
+// Select implements ProviderSelectionStrategy
+func (FirstConnected) Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID {
+	if len(candidates) > n {
+		return candidates[:n]
+	}
+	return candidates
+}
+
+// RandomSelection selects n providers at random so content is spread evenly over time
+type RandomSelection struct{}
+
+// Select implements ProviderSelectionStrategy
+func (RandomSelection) Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID {
+	weights := make([]float64, len(candidates))
+	for i := range weights {
+		weights[i] = 1
+	}
+	return weightedSample(candidates, weights, n)
+}
+
+// LatencyWeighted favors providers with a low latency to us. Providers we haven't measured
+// get the average weight.
+type LatencyWeighted struct {
+	h host.Host
+}
+
+// NewLatencyWeighted creates a strategy using the latency measured by the host peerstore
+func NewLatencyWeighted(h host.Host) *LatencyWeighted {
+	return &LatencyWeighted{h}
+}
+
+// Select implements ProviderSelectionStrategy
+func (s *LatencyWeighted) Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID {
+	weights := make([]float64, len(candidates))
+	for i, p := range candidates {
+		if l := s.h.Peerstore().LatencyEWMA(p); l > 0 {
+			weights[i] = 1 / float64(l/time.Microsecond+1)
+		}
+	}
+	fillUnknown(weights)
+	return weightedSample(candidates, weights, n)
+}
+
+// CapacityWeighted favors providers with more free space
+type CapacityWeighted struct {
+	// Capacity returns the free space advertised by a provider or 0 if unknown
+	Capacity func(peer.ID) uint64
+}
+
+// Select implements ProviderSelectionStrategy
+func (s *CapacityWeighted) Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID {
+	weights := make([]float64, len(candidates))
+	for i, p := range candidates {
+		c := s.Capacity(p)
+		// Skip providers who don't have enough room for the content
+		if c > 0 && c < r.Size {
+			weights[i] = -1
+			continue
+		}
+		weights[i] = float64(c)
+	}
+	fillUnknown(weights)
+	return weightedSample(candidates, weights, n)
+}
+
+// RegionAffinity favors providers in our regions ordered by preference. Providers supporting
+// the first region are selected first.
+type RegionAffinity struct {
+	h       host.Host
+	regions []Region
+}
+
+// NewRegionAffinity creates a strategy preferring the given regions in order
+func NewRegionAffinity(h host.Host, regions []Region) *RegionAffinity {
+	return &RegionAffinity{h, regions}
+}
+
+// Select implements ProviderSelectionStrategy
+func (s *RegionAffinity) Select(ctx context.Context, r Request, candidates []peer.ID, n int) []peer.ID {
+	rank := make(map[peer.ID]int, len(candidates))
+	for _, p := range candidates {
+		rank[p] = len(s.regions)
+		for i, proto := range protoRegions(RequestProtocol, s.regions) {
+			supported, err := s.h.Peerstore().SupportsProtocols(p, string(proto))
+			if err == nil && len(supported) > 0 {
+				rank[p] = i
+				break
+			}
+		}
+	}
+	sorted := make([]peer.ID, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return rank[sorted[i]] < rank[sorted[j]]
+	})
+	return FirstConnected{}.Select(ctx, r, sorted, n)
+}
+
+// ParseSelectionStrategy returns a strategy from its name. Capacity weighted selection needs
+// to know the capacity of providers so it must be built by the caller.
+func ParseSelectionStrategy(name string, h host.Host, regions []Region) (ProviderSelectionStrategy, error) {
+	switch name {
+	case "", "first":
+		return FirstConnected{}, nil
+	case "random":
+		return RandomSelection{}, nil
+	case "latency":
+		return NewLatencyWeighted(h), nil
+	case "region":
+		return NewRegionAffinity(h, regions), nil
+	}
+	return nil, fmt.Errorf("unknown selection strategy %s", name)
+}
+
+// fillUnknown gives the average weight to candidates with an unknown weight (0). Negative weights are excluded.
+func fillUnknown(weights []float64) {
+	var sum float64
+	var known int
+	for _, w := range weights {
+		if w > 0 {
+			sum += w
+			known++
+		}
+	}
+	avg := 1.0
+	if known > 0 {
+		avg = sum / float64(known)
+	}
+	for i, w := range weights {
+		if w == 0 {
+			weights[i] = avg
+		}
+	}
+}
+
+// weightedSample picks n candidates without replacement with a probability proportional to their weight.
+// Candidates with a negative weight are never picked.
+func weightedSample(candidates []peer.ID, weights []float64, n int) []peer.ID {
+	var pool []peer.ID
+	var ws []float64
+	for i, p := range candidates {
+		if weights[i] > 0 {
+			pool = append(pool, p)
+			ws = append(ws, weights[i])
+		}
+	}
+	var out []peer.ID
+	for len(out) < n && len(pool) > 0 {
+		var total float64
+		for _, w := range ws {
+			total += w
+		}
+		x := rand.Float64() * total
+		i := 0
+		for ; i < len(ws)-1; i++ {
+			x -= ws[i]
+			if x < 0 {
+				break
+			}
+		}
+		out = append(out, pool[i])
+		pool = append(pool[:i], pool[i+1:]...)
+		ws = append(ws[:i], ws[i+1:]...)
+	}
+	return out
+}
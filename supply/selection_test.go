@@ -0,0 +1,40 @@
+package supply
+
+import (
+	"context"
+	"testing"
+
+	peer "github.com/libp2p/go-libp2p-core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectionStrategies(t *testing.T) {
+	ctx := context.Background()
+	candidates := []peer.ID{"a", "b", "c", "d"}
+	req := Request{Size: 100}
+
+	require.Equal(t, candidates[:2], FirstConnected{}.Select(ctx, req, candidates, 2))
+	require.Equal(t, candidates, FirstConnected{}.Select(ctx, req, candidates, 7))
+
+	sel := RandomSelection{}.Select(ctx, req, candidates, 3)
+	require.Len(t, sel, 3)
+	seen := make(map[peer.ID]bool)
+	for _, p := range sel {
+		require.False(t, seen[p])
+		seen[p] = true
+	}
+
+	capacities := map[peer.ID]uint64{
+		"a": 50,
+		"b": 1000,
+		"c": 0,
+		"d": 2000,
+	}
+	cw := &CapacityWeighted{Capacity: func(p peer.ID) uint64 { return capacities[p] }}
+	for i := 0; i < 10; i++ {
+		sel := cw.Select(ctx, req, candidates, 4)
+		// a doesn't have room for the content
+		require.Len(t, sel, 3)
+		require.NotContains(t, sel, peer.ID("a"))
+	}
+}
@@ -1,10 +1,15 @@
 package supply
 
 import (
+	"context"
 	"encoding/json"
+	"strconv"
+	"time"
 
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -12,8 +17,17 @@ const (
 	KStoreID = "store"
 	// KSize is the full content size
 	KSize = "size"
+	// KReceivedAt is the unix time when we received or added the content
+	KReceivedAt = "received-at"
+	// KRegion is the name of the region we received the content for
+	KRegion = "region"
+	// KExpires is the unix time after which the content is removed. Content without it never expires.
+	KExpires = "expires"
 )
 
+// JanitorInterval is how often we look for expired content by default
+const JanitorInterval = time.Hour
+
 // ContentRecord is a map of labels associated with a content ID
 // lind of like a mini database for that content activity
 type ContentRecord struct {
@@ -74,6 +88,85 @@ func (s *Store) AddLabel(id cid.Cid, key, value string) error {
 	return s.ds.Put(dsk, r)
 }
 
+// Records returns all the content records by content ID
+func (s *Store) Records() (map[cid.Cid]*ContentRecord, error) {
+	res, err := s.ds.Query(query.Query{})
+	if err != nil {
+		return nil, err
+	}
+	entries, err := res.Rest()
+	if err != nil {
+		return nil, err
+	}
+	recs := make(map[cid.Cid]*ContentRecord, len(entries))
+	for _, e := range entries {
+		c, err := cid.Decode(datastore.RawKey(e.Key).BaseNamespace())
+		if err != nil {
+			continue
+		}
+		var rec ContentRecord
+		if err := json.Unmarshal(e.Value, &rec); err != nil {
+			return nil, err
+		}
+		recs[c] = &rec
+	}
+	return recs, nil
+}
+
+// setExpiry labels a record to expire after the given number of seconds if not zero
+func setExpiry(rec *ContentRecord, ttl uint64) {
+	if ttl == 0 {
+		return
+	}
+	rec.Labels[KExpires] = strconv.FormatInt(time.Now().Add(time.Duration(ttl)*time.Second).Unix(), 10)
+}
+
+// Expired returns the content IDs of the records past their expiry
+func (s *Store) Expired(now time.Time) ([]cid.Cid, error) {
+	recs, err := s.Records()
+	if err != nil {
+		return nil, err
+	}
+	var expired []cid.Cid
+	for c, rec := range recs {
+		exp, ok := rec.Labels[KExpires]
+		if !ok {
+			continue
+		}
+		t, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil {
+			continue
+		}
+		if now.Unix() >= t {
+			expired = append(expired, c)
+		}
+	}
+	return expired, nil
+}
+
+// Janitor calls remove with every expired content until the context is cancelled. Failures are reported to the logger.
+func (s *Store) Janitor(ctx context.Context, interval time.Duration, remove func(cid.Cid) error, log zerolog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			expired, err := s.Expired(time.Now())
+			if err != nil {
+				log.Error().Err(err).Msg("failed to list expired content")
+				continue
+			}
+			for _, c := range expired {
+				if err := remove(c); err != nil {
+					log.Error().Err(err).Str("root", c.String()).Msg("failed to remove expired content")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // RemoveRecord removes a record entirely from our manifest
 func (s *Store) RemoveRecord(id cid.Cid) error {
 	if err := s.ds.Delete(datastore.NewKey(id.String())); err != nil {
@@ -3,14 +3,21 @@ package supply
 import (
 	"bufio"
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-address"
 	cborutil "github.com/filecoin-project/go-cbor-util"
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/go-multistore"
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/filecoin-project/go-state-types/big"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
@@ -19,10 +26,13 @@ import (
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/libp2p/go-libp2p-core/host"
-	"github.com/libp2p/go-libp2p-core/mux"
 	"github.com/libp2p/go-libp2p-core/network"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/protocol"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/myelnet/pop/internal/utils"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 )
 
 // ErrNoPeers when no peers are available to get or send supply to
@@ -32,6 +42,26 @@ var ErrNoPeers = fmt.Errorf("no peers available for supply")
 // we currently do not allow tweaking that number manually so users aren't tempted to DDOS the network
 const MaxReceiverCount = 7
 
+// SendTimeout is the maximum time we wait to deliver a request to a single provider
+const SendTimeout = 10 * time.Second
+
+// RetryPolicy configures how we retry delivering a dispatch request to a provider
+type RetryPolicy struct {
+	// Attempts is the maximum number of times we try to deliver the request to a single provider
+	Attempts int
+	// Backoff is the delay before the first retry. It doubles after each failed attempt.
+	Backoff time.Duration
+	// Deadline bounds the time spent delivering the request to all the providers including retries
+	Deadline time.Duration
+}
+
+// DefaultRetryPolicy retries delivering a request twice within a minute
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts: 3,
+	Backoff:  time.Second,
+	Deadline: time.Minute,
+}
+
 // RequestProtocol labels our network for announcing new content to the network
 const RequestProtocol = "/myel/supply/dispatch/1.0"
 
@@ -47,6 +77,22 @@ func protoRegions(proto string, regions []Region) []protocol.ID {
 type Request struct {
 	PayloadCID cid.Cid
 	Size       uint64
+	// Previous is the root of the previous version of the content if the request is an update
+	Previous *cid.Cid
+	// Diff is the root of the Diff listing the new blocks to pull on top of the previous version
+	Diff *cid.Cid
+	// TTL is the number of seconds caches should keep the content for. Zero means no expiry.
+	TTL uint64
+	// PricePerByte is what the publisher offers caches per byte to keep the content. Nil for free caching.
+	PricePerByte *abi.TokenAmount
+	// Schema is the JSON encoded schema the publisher attached to the root. Caches reject content not
+	// conforming to it. Empty when the content has no schema.
+	Schema []byte
+	// Publisher signs the request so caches can account for the content of each publisher
+	// even when it is relayed by other peers. Omitted from the JSON of unsigned requests as an empty
+	// peer ID cannot be decoded.
+	Publisher peer.ID `json:",omitempty"`
+	Signature []byte
 }
 
 // Type defines AddRequest as a datatransfer voucher for pulling the data from the request
@@ -60,36 +106,265 @@ type PRecord struct {
 	PayloadCID cid.Cid
 }
 
-// Response is an async collection of confirmations from data transfers to cache providers
-// it also provides the number of peers we messaged
+// SendResult reports if a request was delivered to a provider
+type SendResult struct {
+	Provider peer.ID
+	Err      error
+	// Attempts is the number of times we tried to deliver the request
+	Attempts int
+}
+
+// ErrDispatchDone is returned by Response.Next once all the providers have either confirmed or failed
+var ErrDispatchDone = errors.New("dispatch done")
+
+// Response is an async collection of confirmations from data transfers to cache providers.
+// Counters are updated live as providers pull the content or fail to.
 type Response struct {
-	recordChan chan PRecord
-	unsub      datatransfer.Unsubscribe
+	unsub     datatransfer.Unsubscribe
+	unsubOnce sync.Once
+	done      chan struct{}
+	// notify signals new records are queued without ever blocking the senders
+	notify    chan struct{}
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu        sync.Mutex
+	records   []PRecord
+	attempted int
+	// counted is set once we know how many providers we attempt so a dispatch to none is done too
+	counted   bool
+	settled   map[peer.ID]bool
+	failures  map[peer.ID]error
+	confirmed int
+	failed    int
+	closed    bool
+	// regions maps providers to the region we sent the request for when dispatching per region
+	regions map[peer.ID]string
+	// targets is the replication factor we aim for in each region
+	targets         map[string]int
+	regionConfirmed map[string]int
+	// relays are the gateways we relayed the dispatch through for each region
+	relays map[string]peer.ID
+	// persist saves the state of the dispatch so we can resume it after a restart
+	persist    func(dispatchState)
+	base, root cid.Cid
+	started    time.Time
 
+	// Sent is the report of each request we sent to a selected provider
+	Sent []SendResult
+	// Diff lists the blocks sent when dispatching an update to caches holding the previous version
+	Diff *Diff
+	// Count is the number of providers we sent the request to.
+	//
+	// Deprecated: use Attempted, which is safe to call while the dispatch is running.
 	Count int
 }
 
-// Next returns the next record from a new cache
-func (r *Response) Next(ctx context.Context) (PRecord, error) {
+func newResponse() *Response {
+	return &Response{
+		done:     make(chan struct{}),
+		notify:   make(chan struct{}, 1),
+		closing:  make(chan struct{}),
+		settled:  make(map[peer.ID]bool),
+		failures: make(map[peer.ID]error),
+	}
+}
+
+// setAttempted sets the number of providers we are sending the request to
+func (r *Response) setAttempted(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attempted = n
+	r.counted = true
+	r.Count = n
+	r.checkDone()
+	r.save()
+}
+
+// confirm records a provider successfully pulled the content
+func (r *Response) confirm(rec PRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settled[rec.Provider] || r.closed {
+		return
+	}
+	r.settled[rec.Provider] = true
+	r.confirmed++
+	if region, ok := r.regions[rec.Provider]; ok {
+		if r.regionConfirmed == nil {
+			r.regionConfirmed = make(map[string]int)
+		}
+		r.regionConfirmed[region]++
+	}
+	// Records are queued so data transfer events are never blocked by a slow reader
+	r.records = append(r.records, rec)
 	select {
-	case r := <-r.recordChan:
-		return r, nil
-	case <-ctx.Done():
-		return PRecord{}, ctx.Err()
+	case r.notify <- struct{}{}:
+	default:
 	}
+	r.checkDone()
+	r.save()
 }
 
-// Close stops listening for cache confirmations
+// fail records a provider didn't receive the request or failed to pull the content
+func (r *Response) fail(p peer.ID, reason error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.settled[p] || r.closed {
+		return
+	}
+	r.settled[p] = true
+	r.failures[p] = reason
+	r.failed++
+	r.checkDone()
+	r.save()
+}
+
+// checkDone closes the done channel once all the attempted providers are settled. Must hold the lock.
+func (r *Response) checkDone() {
+	if r.counted && r.confirmed+r.failed == r.attempted {
+		select {
+		case <-r.done:
+		default:
+			close(r.done)
+		}
+	}
+}
+
+// Attempted returns the number of providers we sent the request to
+func (r *Response) Attempted() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempted
+}
+
+// Confirmed returns the number of providers who pulled the content so far
+func (r *Response) Confirmed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.confirmed
+}
+
+// Failed returns the number of providers who didn't receive the request or failed to pull the content
+func (r *Response) Failed() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.failed
+}
+
+// Failures returns the providers who didn't receive the request or failed to pull the content
+// with the reason so callers can decide to dispatch to other providers instead
+func (r *Response) Failures() map[peer.ID]error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	failures := make(map[peer.ID]error, len(r.failures))
+	for p, err := range r.failures {
+		failures[p] = err
+	}
+	return failures
+}
+
+// Done is closed when all the attempted providers have either confirmed or definitively failed
+func (r *Response) Done() <-chan struct{} {
+	return r.done
+}
+
+// pop returns the next queued record if any and whether no more records can be queued
+func (r *Response) pop() (PRecord, bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.records) > 0 {
+		rec := r.records[0]
+		r.records = r.records[1:]
+		return rec, true, false
+	}
+	select {
+	case <-r.done:
+		return PRecord{}, false, true
+	default:
+	}
+	return PRecord{}, false, r.closed
+}
+
+// Next returns the next record from a new cache or ErrDispatchDone if no more records are expected
+// or the response was closed
+func (r *Response) Next(ctx context.Context) (PRecord, error) {
+	for {
+		rec, ok, over := r.pop()
+		if ok {
+			return rec, nil
+		}
+		if over {
+			return PRecord{}, ErrDispatchDone
+		}
+		select {
+		case <-r.notify:
+		case <-r.done:
+		case <-r.closing:
+		case <-ctx.Done():
+			return PRecord{}, ctx.Err()
+		}
+	}
+}
+
+// WaitFor collects the records of up to n caches, or of all the caches if n is zero or less.
+// It returns early with the records it has once the dispatch is done, or with the context error
+// if the context expires first.
+func (r *Response) WaitFor(ctx context.Context, n int) ([]PRecord, error) {
+	var recs []PRecord
+	for n <= 0 || len(recs) < n {
+		rec, err := r.Next(ctx)
+		if errors.Is(err, ErrDispatchDone) {
+			break
+		}
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, rec)
+	}
+	return recs, nil
+}
+
+// stop unsubscribes from data transfer events. Counters are no longer updated.
+func (r *Response) stop() {
+	r.unsubOnce.Do(func() {
+		if r.unsub != nil {
+			r.unsub()
+		}
+	})
+}
+
+// watch stops listening for cache confirmations once the context is done
+func (r *Response) watch(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.stop()
+		case <-r.done:
+		}
+	}()
+}
+
+// Close stops listening for cache confirmations. It is safe to call multiple times and concurrently
+// with confirmations still being received. Readers waiting in Next return ErrDispatchDone.
 func (r *Response) Close() {
-	r.unsub()
-	close(r.recordChan)
+	r.stop()
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		close(r.closing)
+	})
 }
 
 // Network handles all the different messaging protocols
 // related to content supply
 type Network struct {
-	host      host.Host
-	receiver  StreamReceiver
+	host     host.Host
+	receiver StreamReceiver
+	log      zerolog.Logger
+
+	mu        sync.Mutex
 	protocols []protocol.ID
 }
 
@@ -98,31 +373,69 @@ func NewNetwork(h host.Host, regions []Region) *Network {
 	sn := &Network{
 		host:      h,
 		protocols: protoRegions(RequestProtocol, regions),
+		log:       log.Logger,
 	}
 	return sn
 }
 
-// NewRequestStream to send AddRequest messages to
-func (n *Network) NewRequestStream(dest peer.ID) (RequestStreamer, error) {
-	s, err := n.host.NewStream(context.Background(), dest, n.protocols...)
+// NewRequestStream to send AddRequest messages to. The stream deadline is set from the context if any.
+// The stream uses the protocol of the first given region the peer supports or any of our regions if none.
+func (n *Network) NewRequestStream(ctx context.Context, dest peer.ID, regions ...Region) (RequestStreamer, error) {
+	n.mu.Lock()
+	protocols := n.protocols
+	n.mu.Unlock()
+	if len(regions) > 0 {
+		protocols = protoRegions(RequestProtocol, regions)
+	}
+	s, err := n.host.NewStream(ctx, dest, protocols...)
 	if err != nil {
 		return nil, err
 	}
+	if dl, ok := ctx.Deadline(); ok {
+		s.SetDeadline(dl)
+	}
 	buffered := bufio.NewReaderSize(s, 16)
 	return &requestStream{p: dest, rw: s, buffered: buffered}, nil
 }
 
 // SetDelegate assigns a handler for all the protocols
 func (n *Network) SetDelegate(sr StreamReceiver) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
 	n.receiver = sr
 	for _, proto := range n.protocols {
 		n.host.SetStreamHandler(proto, n.handleStream)
 	}
 }
 
+// addRegion starts handling the protocol of a new region
+func (n *Network) addRegion(r Region) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	proto := protoRegions(RequestProtocol, []Region{r})[0]
+	n.protocols = append(n.protocols, proto)
+	if n.receiver != nil {
+		n.host.SetStreamHandler(proto, n.handleStream)
+	}
+}
+
+// removeRegion stops handling the protocol of a region we left
+func (n *Network) removeRegion(r Region) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	proto := protoRegions(RequestProtocol, []Region{r})[0]
+	for i, p := range n.protocols {
+		if p == proto {
+			n.protocols = append(n.protocols[:i:i], n.protocols[i+1:]...)
+			break
+		}
+	}
+	n.host.RemoveStreamHandler(proto)
+}
+
 func (n *Network) handleStream(s network.Stream) {
 	if n.receiver == nil {
-		fmt.Printf("no receiver set")
+		n.log.Error().Msg("no receiver set")
 		s.Reset()
 		return
 	}
@@ -141,13 +454,18 @@ type StreamReceiver interface {
 type RequestStreamer interface {
 	ReadRequest() (Request, error)
 	WriteRequest(Request) error
+	// ReadResult and WriteResult exchange the result of a request once it is read
+	ReadResult() (DispatchResult, error)
+	WriteResult(DispatchResult) error
 	OtherPeer() peer.ID
+	// Region is the name of the region the stream protocol is for
+	Region() string
 	Close() error
 }
 
 type requestStream struct {
 	p        peer.ID
-	rw       mux.MuxedStream
+	rw       network.Stream
 	buffered *bufio.Reader
 }
 
@@ -163,6 +481,18 @@ func (a *requestStream) WriteRequest(m Request) error {
 	return cborutil.WriteCborRPC(a.rw, &m)
 }
 
+func (a *requestStream) ReadResult() (DispatchResult, error) {
+	var m DispatchResult
+	if err := m.UnmarshalCBOR(a.buffered); err != nil {
+		return DispatchResult{}, err
+	}
+	return m, nil
+}
+
+func (a *requestStream) WriteResult(m DispatchResult) error {
+	return cborutil.WriteCborRPC(a.rw, &m)
+}
+
 func (s *requestStream) Close() error {
 	return s.rw.Close()
 }
@@ -171,10 +501,19 @@ func (s *requestStream) OtherPeer() peer.ID {
 	return s.p
 }
 
+func (s *requestStream) Region() string {
+	return strings.TrimPrefix(string(s.rw.Protocol()), RequestProtocol+"/")
+}
+
 type handler struct {
-	ms *multistore.MultiStore
-	dt datatransfer.Manager
-	s  *Store
+	ms       *multistore.MultiStore
+	dt       datatransfer.Manager
+	s        *Store
+	limits   DAGLimits
+	pulls    *pullQueue
+	quotas   *quotaKeeper
+	rules    *ruleKeeper
+	throttle *dispatchThrottle
 }
 
 // AllSelector is the default selector that reaches all the blocks
@@ -192,25 +531,86 @@ func (h *handler) HandleRequest(stream RequestStreamer) {
 	if err != nil {
 		return
 	}
+	reject := func(err error) {
+		stream.WriteResult(DispatchResult{Status: RequestRejected, Message: err.Error()})
+	}
+	if err := CheckCodec(req.PayloadCID); err != nil {
+		reject(err)
+		return
+	}
+	// Rejected requests count too so a publisher cannot flood us with requests we would reject
+	if ok, wait := h.throttle.allowRequest(stream.OtherPeer(), h.quotas.publisher(req, stream.OtherPeer())); !ok {
+		stream.WriteResult(DispatchResult{
+			Status:     RequestThrottled,
+			Message:    "too many requests",
+			RetryAfter: uint64(math.Ceil(wait.Seconds())),
+		})
+		return
+	}
 
-	// TODO: run custom logic to validate the presence of a storage deal for this block
-	// we may need to request deal info in the message
-	// + check if we have room to store it
+	// Don't queue requests we would reject anyway
+	if err := h.accept(stream.OtherPeer(), stream.Region(), req); err != nil {
+		reject(err)
+		return
+	}
+	// Requests over our concurrency limit wait for a transfer to finish
+	if err := h.pulls.push(queuedPull{Peer: stream.OtherPeer(), Region: stream.Region(), Request: req}); err != nil {
+		reject(err)
+		return
+	}
+	// The publisher doesn't need to wait for the pull to start
+	stream.WriteResult(DispatchResult{Status: RequestAccepted})
+	h.pulls.schedule()
+}
 
+// newRecord creates the record of a content received in the given region
+func newRecord(req Request, storeID string, region string) *ContentRecord {
+	rec := &ContentRecord{Labels: map[string]string{
+		KStoreID:    storeID,
+		KSize:       fmt.Sprintf("%d", req.Size),
+		KReceivedAt: strconv.FormatInt(time.Now().Unix(), 10),
+	}}
+	if region != "" {
+		rec.Labels[KRegion] = region
+	}
+	setExpiry(rec, req.TTL)
+	return rec
+}
+
+// pull all the blocks of the requested content from the given peer. The transfer is stopped
+// if the context is cancelled.
+func (h *handler) pull(ctx context.Context, p peer.ID, region string, req Request) error {
+	if err := h.accept(p, region, req); err != nil {
+		return err
+	}
+	pub := h.quotas.publisher(req, p)
+	admitted, err := h.quotas.admit(pub, req.Size)
+	if err != nil {
+		return err
+	}
 	// Create a new store to receive our new blocks
 	// It will be automatically picked up in the TransportConfigurer
 	storeID := h.ms.Next()
-	err = h.s.PutRecord(req.PayloadCID, &ContentRecord{Labels: map[string]string{
-		KStoreID: fmt.Sprintf("%d", storeID),
-		KSize:    fmt.Sprintf("%d", req.Size),
-	}})
+	// Create the store before recording it so the record never points at a missing store
+	if _, err := h.ms.Get(storeID); err != nil {
+		admitted()
+		return err
+	}
+	rec := newRecord(req, fmt.Sprintf("%d", storeID), region)
+	rec.Labels[KPublisher] = pub.String()
+	err = h.s.PutRecord(req.PayloadCID, rec)
+	admitted()
 	if err != nil {
-		return
+		h.ms.Delete(storeID)
+		return err
 	}
-	_, err = h.dt.OpenPullDataChannel(context.TODO(), stream.OtherPeer(), &req, req.PayloadCID, AllSelector())
+	// Never traverse past the maximum depth
+	_, err = h.dt.OpenPullDataChannel(ctx, p, &req, req.PayloadCID, h.limits.Selector())
 	if err != nil {
-		return
+		h.s.RemoveRecord(req.PayloadCID)
+		h.ms.Delete(storeID)
 	}
+	return err
 }
 
 // Supply keeps track of the content we store and provide on the network
@@ -221,21 +621,80 @@ type Supply struct {
 	ms         *multistore.MultiStore
 	net        *Network
 	store      *Store
+	events     *EventManager
+	sectors    *sectorServer
+	receipts   datastore.Batching
+	served     *servedLedger
+	caches     datastore.Batching
+	dispatches datastore.Batching
+	scores     *CacheScores
+	schemas    *SchemaRegistry
 	validation *Validator
-	regions    []Region
+	strategy   ProviderSelectionStrategy
+	retry      RetryPolicy
+	evictor    *evictor
+	// emu guards the evictor and the access labels of the records which are updated by reading and
+	// rewriting the whole record
+	emu       sync.Mutex
+	pulls     *pullQueue
+	limits    DAGLimits
+	metrics   Metrics
+	timer     *transferTimer
+	quotas    *quotaKeeper
+	throttle  *dispatchThrottle
+	rules     *ruleKeeper
+	listeners contentListeners
+	log       zerolog.Logger
+	// oversized are the pulls we are stopping as they went over their declared size
+	oversized sync.Map
+	// cold is where we offload content we have no room for
+	cold ObjectStore
+	cmu  sync.Mutex
+	// hot keeps the most accessed content in memory when tiering is enabled
+	hot     *hotTier
+	tiering TieringPolicy
+	// reads shares the blocks read for the content served to multiple peers at the same time
+	reads *sharedReads
+	// lookups recall or unseal a content once for all the deals asking for it at the same time
+	lookups flightGroup
+	// gateways relay our dispatches to the regions we have no peers in
+	gateways []peer.AddrInfo
+	relayer  *relayer
+
+	// rmu guards the regions we are part of and their announcement topics as we can join and leave at runtime
+	rmu     sync.RWMutex
+	regions []Region
+	// regionsDs persists the regions we are part of
+	regionsDs datastore.Batching
+	ps        *pubsub.PubSub
+	// topics are the announcement topics of our regions
+	topics map[string]*pubsub.Topic
+	subs   map[string]*pubsub.Subscription
 }
 
-// New instance of the SupplyManager
+// New instance of the SupplyManager. The strategy selects which providers we dispatch to and defaults
+// to the first connected providers when nil. The regions we joined or left at runtime are restored from
+// the datastore and take precedence over the given regions.
 func New(
 	h host.Host,
 	dt datatransfer.Manager,
 	ds datastore.Batching,
 	ms *multistore.MultiStore,
 	regions []Region,
+	strategy ProviderSelectionStrategy,
 ) *Supply {
+	if strategy == nil {
+		strategy = FirstConnected{}
+	}
 	store := &Store{namespace.Wrap(ds, datastore.NewKey("/supply"))}
+	regionsDs := namespace.Wrap(ds, datastore.NewKey("/supply-regions"))
+	if saved, err := loadRegions(regionsDs); err == nil {
+		regions = saved
+	}
 	v := &Validator{
 		auth: make(map[cid.Cid]*peer.Set),
+		open: make(map[cid.Cid]int),
+		ppb:  minPPB(regions),
 	}
 	s := &Supply{
 		h:          h,
@@ -243,68 +702,262 @@ func New(
 		ms:         ms,
 		net:        NewNetwork(h, regions),
 		store:      store,
+		events:     NewEventManager(dt),
+		receipts:   namespace.Wrap(ds, datastore.NewKey("/receipts")),
+		caches:     namespace.Wrap(ds, datastore.NewKey("/caches")),
+		dispatches: namespace.Wrap(ds, datastore.NewKey("/dispatches")),
+		scores:     NewCacheScores(ds),
+		schemas:    NewSchemaRegistry(namespace.Wrap(ds, datastore.NewKey("/schemas"))),
 		regions:    regions,
+		regionsDs:  regionsDs,
+		strategy:   strategy,
+		retry:      DefaultRetryPolicy,
 		validation: v,
+		limits:     DefaultDAGLimits,
+		metrics:    NopMetrics{},
+		timer:      &transferTimer{started: make(map[datatransfer.ChannelID]time.Time)},
+		quotas:     &quotaKeeper{store: store, keys: h.Peerstore().PubKey},
+		throttle:   newDispatchThrottle(DefaultDispatchRate),
+		reads:      newSharedReads(DefaultSharedReadBytes),
+		rules:      newRuleKeeper(namespace.Wrap(ds, datastore.NewKey("/supply-rules"))),
+		log:        log.Logger,
+	}
+	v.has = func(k cid.Cid) bool {
+		_, err := store.GetRecord(k)
+		return err == nil
 	}
 	s.dt.RegisterVoucherType(&Request{}, v)
+	s.dt.RegisterVoucherResultType(&RequestResult{})
 	s.dt.RegisterTransportConfigurer(&Request{}, TransportConfigurer(s))
-	s.net.SetDelegate(&handler{ms, dt, store})
+	s.pulls = newPullQueue(namespace.Wrap(ds, datastore.NewKey("/supply-pulls")), DefaultMaxPulls, s.startQueued, s.log)
+	s.pulls.expire = s.expirePull
+	s.net.SetDelegate(s.handler())
+	// Resume the requests we queued before restarting
+	go s.pulls.schedule()
+
+	// Issue receipts for the content we receive and countersign the receipts for the content we serve
+	s.served = &servedLedger{ds: s.receipts}
+	s.events.Subscribe(cid.Undef, s.trackReceipts)
+	s.events.Subscribe(cid.Undef, s.handleReadEvent)
+	h.SetStreamHandler(ReceiptProtocol, s.handleReceiptStream)
+	h.SetStreamHandler(IssueReceiptProtocol, s.handleIssueReceiptStream)
 
-	// TODO: clean this up
-	dt.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+	s.events.Subscribe(cid.Undef, func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+		if event.Code == datatransfer.Open && channelState.Recipient() == h.ID() {
+			if _, ok := requestRoot(channelState); ok {
+				s.timer.start(channelState.ChannelID())
+			}
+		}
 		if event.Code == datatransfer.Error && channelState.Recipient() == h.ID() {
+			if res, ok := channelState.LastVoucherResult().(*RequestResult); ok && res.Status != RequestAccepted {
+				s.log.Warn().Str("root", channelState.BaseCID().String()).Str("result", res.Error()).Msg("failed to pull")
+			}
 			// If transfers fail and we're the recipient we need to remove it from our index
-			store.RemoveRecord(channelState.BaseCID())
+			if root, ok := requestRoot(channelState); ok {
+				s.recordPulled(channelState, s.contentRegion(root), true)
+				store.RemoveRecord(root)
+				s.popRelay(root)
+				s.pulls.release(root)
+			}
+		}
+		if (event.Code == datatransfer.Cancel || event.Code == datatransfer.CleanupComplete) && channelState.Recipient() == h.ID() {
+			if root, ok := requestRoot(channelState); ok {
+				s.pulls.release(root)
+			}
+		}
+		if event.Code == datatransfer.DataReceived && channelState.Recipient() == h.ID() {
+			s.checkPullSize(channelState)
+		}
+		if channelState.Status() == datatransfer.Completed && channelState.Recipient() == h.ID() {
+			root, ok := requestRoot(channelState)
+			if !ok {
+				return
+			}
+			s.recordPulled(channelState, s.contentRegion(root), false)
+			s.pulls.release(root)
+			if err := s.recordPullSize(channelState); err != nil {
+				s.log.Error().Err(err).Str("root", root.String()).Msg("failed to record content size")
+			}
+			if err := s.attachRequestSchema(channelState); err != nil {
+				s.log.Warn().Err(err).Str("root", root.String()).Msg("rejecting content with invalid schema")
+				s.RemoveContent(root)
+				return
+			}
+			// Reject DAGs over our limits and content not conforming to the schema attached to its root
+			if err := s.ValidateContent(context.TODO(), root); err != nil {
+				s.log.Warn().Err(err).Str("root", root.String()).Msg("rejecting content")
+				s.RemoveContent(root)
+				return
+			}
+			// New content starts as recently accessed so it isn't evicted right away
+			s.emu.Lock()
+			store.AddLabel(root, KLastAccess, strconv.FormatInt(time.Now().Unix(), 10))
+			s.emu.Unlock()
+			s.listeners.notify(root, true)
+			go s.relayPulled(root)
+			go func() {
+				if _, err := s.Evict(); err != nil {
+					s.log.Error().Err(err).Msg("failed to evict content")
+				}
+			}()
 		}
 	})
 	return s
 }
 
+// handler pulls the content we are dispatched
+func (s *Supply) handler() *handler {
+	return &handler{s.ms, s.dt, s.store, s.limits, s.pulls, s.quotas, s.rules, s.throttle}
+}
+
+// StartJanitor periodically removes the content past its expiry
+func (s *Supply) StartJanitor(ctx context.Context, interval time.Duration) {
+	go s.store.Janitor(ctx, interval, s.RemoveContent, s.log)
+}
+
+// SetRetryPolicy changes how we retry delivering dispatch requests to providers
+func (s *Supply) SetRetryPolicy(p RetryPolicy) {
+	s.retry = p
+}
+
+// SetLogger routes the warnings and errors of the supply and its network to the given logger
+func (s *Supply) SetLogger(l zerolog.Logger) {
+	s.log = l
+	s.net.log = l
+	s.pulls.log = l
+}
+
+// minPPB returns the lowest price per byte across our regions
+func minPPB(regions []Region) abi.TokenAmount {
+	var ppb abi.TokenAmount
+	for _, r := range regions {
+		if r.PPB.Nil() {
+			continue
+		}
+		if ppb.Nil() || r.PPB.LessThan(ppb) {
+			ppb = r.PPB
+		}
+	}
+	if ppb.Nil() {
+		return big.Zero()
+	}
+	return ppb
+}
+
 // Register a new content record in our supply
 func (s *Supply) Register(key cid.Cid, sid multistore.StoreID) error {
+	// The record must never point at a store we don't have
+	if !s.hasStore(sid) {
+		return ErrStoreNotFound
+	}
 	// Store a record of the content in our supply
-	return s.store.PutRecord(key, &ContentRecord{Labels: map[string]string{
-		KStoreID: fmt.Sprintf("%d", sid),
+	err := s.store.PutRecord(key, &ContentRecord{Labels: map[string]string{
+		KStoreID:    fmt.Sprintf("%d", sid),
+		KReceivedAt: strconv.FormatInt(time.Now().Unix(), 10),
 	}})
+	if err != nil {
+		return err
+	}
+	s.listeners.notify(key, true)
+	return nil
 }
 
-// Dispatch requests to the network until we have propagated the content to enough peers
-func (s *Supply) Dispatch(r Request) (*Response, error) {
-	res := &Response{
-		recordChan: make(chan PRecord),
+// SubscribeToContent calls the listener whenever content is added to our supply or removed from it.
+// The returned function removes the listener.
+func (s *Supply) SubscribeToContent(fn ContentListener) func() {
+	return s.listeners.subscribe(fn)
+}
+
+// Dispatch requests to the network until we have propagated the content to enough peers.
+// Cancelling the context aborts requests being sent and stops listening for confirmations.
+func (s *Supply) Dispatch(ctx context.Context, r Request) (*Response, error) {
+	res := newResponse()
+	if err := CheckCodec(r.PayloadCID); err != nil {
+		return res, err
 	}
+	res.unsub = s.watchDispatch(res, r.PayloadCID, r.PayloadCID)
+	res.watch(ctx)
 
-	// listen for datatransfer events to identify the peers who pulled the content
-	res.unsub = s.dt.SubscribeToEvents(func(event datatransfer.Event, chState datatransfer.ChannelState) {
-		if chState.Status() == datatransfer.Completed {
-			root := chState.BaseCID()
-			if root != r.PayloadCID {
-				return
-			}
-			// The recipient is the provider who received our content
-			rec := chState.Recipient()
-			res.recordChan <- PRecord{
+	// Select the providers we want to send to
+	providers, err := s.selectProviders(ctx, r)
+	if errors.Is(err, ErrNoPeers) && len(s.gateways) > 0 {
+		// Relay through gateways in our regions instead
+		var names []string
+		for _, region := range s.Regions() {
+			names = append(names, region.Name)
+		}
+		relays := s.selectGateways(ctx, names)
+		if len(relays) == 0 {
+			res.setAttempted(0)
+			return res, err
+		}
+		res.mu.Lock()
+		res.regions = make(map[peer.ID]string, len(relays))
+		res.targets = make(map[string]int, len(relays))
+		res.regionConfirmed = make(map[string]int, len(relays))
+		for name, p := range relays {
+			res.regions[p] = name
+			// Each gateway counts as a single copy of its region
+			res.targets[name] = 1
+		}
+		res.mu.Unlock()
+		s.sendRegions(ctx, res, r, r.PayloadCID, nil, relays)
+		return res, nil
+	}
+	if err != nil {
+		res.setAttempted(0)
+		return res, err
+	}
+	s.send(ctx, res, r, r.PayloadCID, providers)
+	return res, nil
+}
+
+// SubscribeToTransfers calls fn with the data transfer events of the transfers with the given base CID
+// e.g. the root of the content we retrieve or caches pull from us
+func (s *Supply) SubscribeToTransfers(base cid.Cid, fn EventHandler) datatransfer.Unsubscribe {
+	return s.events.Subscribe(base, fn)
+}
+
+// watchDispatch listens for datatransfer events to identify the peers who pulled the content.
+// The base CID is the root of the transfer which differs from the content root for updates.
+// The state of the dispatch is persisted until it's done so it can be resumed after a restart.
+func (s *Supply) watchDispatch(res *Response, base cid.Cid, root cid.Cid) datatransfer.Unsubscribe {
+	res.track(base, root, s.saveDispatch)
+	return s.events.Subscribe(base, func(event datatransfer.Event, chState datatransfer.ChannelState) {
+		// The recipient is the provider who received our content
+		rec := chState.Recipient()
+		switch chState.Status() {
+		case datatransfer.Completed:
+			s.metrics.Count(MetricDispatchesAccepted, 1)
+			s.recordCache(root, rec)
+			res.confirm(PRecord{
 				Provider:   rec,
 				PayloadCID: root,
+			})
+		case datatransfer.Failed, datatransfer.Cancelled:
+			// Peers we didn't authorize were rejected and don't count as failed caches
+			if s.validation.authorized(base, rec) {
+				res.fail(rec, fmt.Errorf("transfer %s: %s", datatransfer.Statuses[chState.Status()], chState.Message()))
 			}
 		}
 	})
+}
 
-	// Select the providers we want to send to
-	providers, err := s.selectProviders()
-	if err != nil {
-		return res, err
-	}
-	// Authorize the transfer
+// send authorizes the providers to pull the base CID and sends them the request
+func (s *Supply) send(ctx context.Context, res *Response, r Request, base cid.Cid, providers []peer.ID) {
 	for _, p := range providers {
-		s.validation.Authorize(r.PayloadCID, p)
+		s.validation.Authorize(base, p)
+	}
+	res.setAttempted(len(providers))
+	res.Sent = s.sendAllRequests(ctx, r, providers)
+	for _, sr := range res.Sent {
+		if sr.Err != nil {
+			res.fail(sr.Provider, sr.Err)
+		}
 	}
-	res.Count = len(providers)
-	s.sendAllRequests(r, providers)
-	return res, nil
 }
 
-func (s *Supply) selectProviders() ([]peer.ID, error) {
+func (s *Supply) selectProviders(ctx context.Context, r Request) ([]peer.ID, error) {
 	var peers []peer.ID
 	// Get the current connected peers
 	for _, pconn := range s.h.Network().Conns() {
@@ -313,7 +966,7 @@ func (s *Supply) selectProviders() ([]peer.ID, error) {
 		if pid != s.h.ID() {
 			// Make sure our peer supports the retrieval dispatch protocol
 			var protos []string
-			for _, p := range protoRegions(RequestProtocol, s.regions) {
+			for _, p := range protoRegions(RequestProtocol, s.Regions()) {
 				protos = append(protos, string(p))
 			}
 			supported, err := s.h.Peerstore().SupportsProtocols(
@@ -323,6 +976,10 @@ func (s *Supply) selectProviders() ([]peer.ID, error) {
 			if err != nil || len(supported) == 0 {
 				continue
 			}
+			// Skip the caches failing our audits
+			if s.scores.Skip(pid) {
+				continue
+			}
 			peers = append(peers, pid)
 		}
 	}
@@ -331,6 +988,10 @@ func (s *Supply) selectProviders() ([]peer.ID, error) {
 		return nil, ErrNoPeers
 	}
 	// If we have less peers we adjust accordingly
+	peers = s.strategy.Select(ctx, r, peers, MaxReceiverCount)
+	if len(peers) == 0 {
+		return nil, ErrNoPeers
+	}
 	if len(peers) > MaxReceiverCount {
 		peers = peers[:MaxReceiverCount]
 	}
@@ -338,22 +999,103 @@ func (s *Supply) selectProviders() ([]peer.ID, error) {
 	return peers, nil
 }
 
-func (s *Supply) sendAllRequests(r Request, peers []peer.ID) {
-	for _, p := range peers {
-		stream, err := s.net.NewRequestStream(p)
-		if err != nil {
-			continue
+// sendAllRequests sends the request to all the peers concurrently and reports which ones received it.
+// Failed deliveries are retried according to our retry policy.
+func (s *Supply) sendAllRequests(ctx context.Context, r Request, peers []peer.ID, regions ...Region) []SendResult {
+	ctx, cancel := context.WithTimeout(ctx, s.retry.Deadline)
+	defer cancel()
+
+	results := make([]SendResult, len(peers))
+	var wg sync.WaitGroup
+	for i, p := range peers {
+		wg.Add(1)
+		go func(i int, p peer.ID) {
+			defer wg.Done()
+			attempts, err := s.sendWithRetry(ctx, r, p, regions...)
+			results[i] = SendResult{
+				Provider: p,
+				Err:      err,
+				Attempts: attempts,
+			}
+		}(i, p)
+	}
+	wg.Wait()
+	return results
+}
+
+// sendWithRetry tries to deliver the request until it succeeds, we run out of attempts or the context
+// expires. It returns the number of attempts and the last error.
+func (s *Supply) sendWithRetry(ctx context.Context, r Request, p peer.ID, regions ...Region) (int, error) {
+	backoff := s.retry.Backoff
+	attempts := 0
+	for {
+		attempts++
+		err := s.sendRequest(ctx, r, p, regions...)
+		// Retrying a throttled request would only make it worse and a rejected one would be rejected again
+		if err == nil || errors.Is(err, ErrDispatchThrottled) || errors.Is(err, ErrDispatchRejected) ||
+			attempts >= s.retry.Attempts {
+			return attempts, err
 		}
-		err = stream.WriteRequest(r)
-		stream.Close()
-		if err != nil {
-			continue
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return attempts, fmt.Errorf("%w: %v", ctx.Err(), err)
+		}
+	}
+}
+
+func (s *Supply) sendRequest(ctx context.Context, r Request, p peer.ID, regions ...Region) error {
+	ctx, cancel := context.WithTimeout(ctx, SendTimeout)
+	defer cancel()
+	stream, err := s.net.NewRequestStream(ctx, p, regions...)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	if err := stream.WriteRequest(s.signRequest(r)); err != nil {
+		return err
+	}
+	// Providers who don't send results close the stream once they read the request
+	res, err := stream.ReadResult()
+	if err == nil {
+		if err := res.Err(); err != nil {
+			return err
 		}
 	}
+	s.metrics.Count(MetricDispatchesSent, 1)
+	return nil
 }
 
-// GetStoreID returns the StoreID of the store which has the given content
+// GetStoreID returns the StoreID of the store which has the given content. If we have a sector accessor
+// and we don't have the content in store we try to unseal it from the miner's sectors. Content offloaded
+// to our cold store is recalled first. Concurrent deals for the same content share the recall or unsealing.
 func (s *Supply) GetStoreID(id cid.Cid) (multistore.StoreID, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), UnsealTimeout)
+	defer cancel()
+	return s.getStoreIDOnce(ctx, id)
+}
+
+// GetStoreIDContext is GetStoreID with a context cancelling the unsealing of the content
+func (s *Supply) GetStoreIDContext(ctx context.Context, id cid.Cid) (multistore.StoreID, error) {
+	return s.getStoreIDOnce(ctx, id)
+}
+
+func (s *Supply) lookupStoreID(ctx context.Context, id cid.Cid) (multistore.StoreID, error) {
+	if err := s.recallCold(id); err != nil {
+		return 0, err
+	}
+	storeID, err := s.getStoreID(id)
+	if errors.Is(err, datastore.ErrNotFound) && s.sectors != nil {
+		if uerr := s.unseal(ctx, id); uerr != nil {
+			return 0, err
+		}
+		return s.getStoreID(id)
+	}
+	return storeID, err
+}
+
+func (s *Supply) getStoreID(id cid.Cid) (multistore.StoreID, error) {
 	rec, err := s.store.GetRecord(id)
 	if err != nil {
 		return 0, err
@@ -366,12 +1108,52 @@ func (s *Supply) GetStoreID(id cid.Cid) (multistore.StoreID, error) {
 	if err != nil {
 		return 0, err
 	}
+	if !s.hasStore(multistore.StoreID(storeID)) {
+		return 0, ErrStoreNotFound
+	}
 	return multistore.StoreID(storeID), nil
 }
 
+// hasStore checks if the multistore has a store with the given ID
+func (s *Supply) hasStore(id multistore.StoreID) bool {
+	for _, sid := range s.ms.List() {
+		if sid == id {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachSchema attaches an IPLD schema to a root so the content can be validated upon retrieval.
+// The schema is sent to the caches along with the requests we dispatch for the root.
+func (s *Supply) AttachSchema(root cid.Cid, sch *Schema) error {
+	return s.schemas.Attach(root, sch)
+}
+
+// Schemas exposes the schema registry
+func (s *Supply) Schemas() *SchemaRegistry {
+	return s.schemas
+}
+
+// ValidateContent checks the content we store for a given root is within our DAG limits and
+// conforms to its schema if any
+func (s *Supply) ValidateContent(ctx context.Context, root cid.Cid) error {
+	if err := s.CheckLimits(ctx, root); err != nil {
+		return err
+	}
+	store, err := s.GetStore(root)
+	if err != nil {
+		return err
+	}
+	return s.schemas.Validate(ctx, root, store.Loader)
+}
+
 // GetStore returns the correct multistore associated with a data CID
 func (s *Supply) GetStore(id cid.Cid) (*multistore.Store, error) {
-	storeID, err := s.GetStoreID(id)
+	if err := s.recallCold(id); err != nil {
+		return nil, err
+	}
+	storeID, err := s.getStoreID(id)
 	if err != nil {
 		return nil, err
 	}
@@ -382,9 +1164,35 @@ func (s *Supply) GetStore(id cid.Cid) (*multistore.Store, error) {
 	return store, nil
 }
 
-// RemoveContent removes all content linked to a root CID by completed dropping the store
+// RemoveContent removes all content linked to a root CID by completed dropping the store.
+// The store is kept if another version of the content still uses it.
 func (s *Supply) RemoveContent(root cid.Cid) error {
-	storeID, err := s.GetStoreID(root)
+	if err := s.removeContent(root); err != nil {
+		return err
+	}
+	s.listeners.notify(root, false)
+	return nil
+}
+
+func (s *Supply) removeContent(root cid.Cid) error {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return err
+	}
+	if s.hot != nil {
+		s.hot.drop(root)
+	}
+	if key, ok := rec.Labels[KCold]; ok {
+		return s.removeCold(root, key)
+	}
+	if s.sharesStore(root, rec) {
+		return s.store.RemoveRecord(root)
+	}
+	storeID, err := s.getStoreID(root)
+	// Drop records left pointing at a missing store
+	if errors.Is(err, ErrStoreNotFound) {
+		return s.store.RemoveRecord(root)
+	}
 	if err != nil {
 		return err
 	}
@@ -399,7 +1207,7 @@ func (s *Supply) RemoveContent(root cid.Cid) error {
 // We keep a context as this could also query a remote service or API
 func (s *Supply) ListMiners(ctx context.Context) ([]address.Address, error) {
 	var strList []string
-	for _, r := range s.regions {
+	for _, r := range s.Regions() {
 		// Global region is already a list of miners in all regions
 		if r.Name == "Global" {
 			strList = r.StorageMiners
@@ -424,11 +1232,16 @@ type StoreConfigurableTransport interface {
 	UseStore(datatransfer.ChannelID, ipld.Loader, ipld.Storer) error
 }
 
+// StoreConfigFailures counts how many times we failed to configure a store for a dispatch transfer
+var StoreConfigFailures = expvar.NewInt("supply_store_config_failures")
+
 // TransportConfigurer configurers the graphsync transport to use a custom blockstore per content
 func TransportConfigurer(s *Supply) datatransfer.TransportConfigurer {
+	warner := utils.NewChannelWarner(s.log, time.Minute)
 	return func(channelID datatransfer.ChannelID, voucher datatransfer.Voucher, transport datatransfer.Transport) {
 		warn := func(err error) {
-			fmt.Println("attempting to configure data store:", err)
+			StoreConfigFailures.Add(1)
+			warner.Warn(channelID, "attempting to configure data store", err)
 		}
 		request, ok := voucher.(*Request)
 		if !ok {
@@ -443,18 +1256,82 @@ func TransportConfigurer(s *Supply) datatransfer.TransportConfigurer {
 			warn(err)
 			return
 		}
-		err = gsTransport.UseStore(channelID, store.Loader, store.Storer)
+		err = gsTransport.UseStore(channelID, s.CachedLoader(request.PayloadCID, store.Loader), store.Storer)
 		if err != nil {
 			warn(err)
 		}
 	}
 }
 
+// ValidationStatus tells a recipient if their request was accepted
+type ValidationStatus uint64
+
+const (
+	// RequestAccepted means the peer is authorized to pull the content for free
+	RequestAccepted ValidationStatus = iota
+	// RequestRejected means the request was rejected, see the message for the reason
+	RequestRejected
+	// PaymentRequired means the content is available but must be retrieved with a paid retrieval deal
+	PaymentRequired
+	// RequestThrottled means the publisher sent too many requests, see the result for when to retry
+	RequestThrottled
+)
+
+// ValidationStatuses maps validation statuses to human readable names
+var ValidationStatuses = map[ValidationStatus]string{
+	RequestAccepted:  "accepted",
+	RequestRejected:  "rejected",
+	PaymentRequired:  "payment required",
+	RequestThrottled: "throttled",
+}
+
+// RequestResult is the voucher result sent back to a peer pulling content dispatched with a Request
+type RequestResult struct {
+	Status  ValidationStatus
+	Message string
+	// PricePerByte is the minimum price to retrieve the content when payment is required
+	PricePerByte abi.TokenAmount
+}
+
+// Type defines RequestResult as a datatransfer voucher result
+func (RequestResult) Type() datatransfer.TypeIdentifier {
+	return "DispatchRequestResult"
+}
+
+func (r *RequestResult) Error() string {
+	return fmt.Sprintf("%s: %s", ValidationStatuses[r.Status], r.Message)
+}
+
+// ErrPushNotAccepted is returned when a peer tries to push content to us
+var ErrPushNotAccepted = errors.New("no push accepted")
+
+// ErrNotAuthorized is returned when a peer tries to pull content they were not dispatched
+var ErrNotAuthorized = errors.New("not authorized")
+
+// ErrUnknownContent is returned when a peer tries to pull content we have no dispatch for
+var ErrUnknownContent = errors.New("unknown CID")
+
+// ErrStoreNotFound is returned when the store recorded for a content doesn't exist
+var ErrStoreNotFound = errors.New("store not found")
+
 // Validator implements the validation interface for the data transfer manager
 // We can authorize peers to retrieve content from us by adding them to the set
 type Validator struct {
 	mu   sync.Mutex
 	auth map[cid.Cid]*peer.Set
+	// open is the number of unknown peers who may still pull announced content
+	open map[cid.Cid]int
+	// ppb is the price we would charge for a paid retrieval of content we have
+	ppb abi.TokenAmount
+	// has checks if we have the content in our supply
+	has func(cid.Cid) bool
+}
+
+// setPPB updates the price we charge for paid retrievals when our regions change
+func (v *Validator) setPPB(ppb abi.TokenAmount) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.ppb = ppb
 }
 
 // Authorize adds a peer to a set giving authorization to pull content without payment
@@ -471,16 +1348,25 @@ func (v *Validator) Authorize(k cid.Cid, p peer.ID) {
 	v.auth[k] = set
 }
 
-// ValidatePush returns a stubbed result for a push validation
+func rejected(err error) (datatransfer.VoucherResult, error) {
+	return &RequestResult{
+		Status:       RequestRejected,
+		Message:      err.Error(),
+		PricePerByte: big.Zero(),
+	}, err
+}
+
+// ValidatePush rejects all pushes as providers pull dispatched content
 func (v *Validator) ValidatePush(
 	sender peer.ID,
 	voucher datatransfer.Voucher,
 	baseCid cid.Cid,
 	selector ipld.Node) (datatransfer.VoucherResult, error) {
-	return nil, fmt.Errorf("no pushed accepted")
+	return rejected(ErrPushNotAccepted)
 }
 
-// ValidatePull returns a stubbed result for a pull validation
+// ValidatePull accepts pulls from peers we dispatched the content to. Other peers are told if they
+// can retrieve it with a paid deal instead.
 func (v *Validator) ValidatePull(
 	receiver peer.ID,
 	voucher datatransfer.Voucher,
@@ -489,11 +1375,28 @@ func (v *Validator) ValidatePull(
 	v.mu.Lock()
 	defer v.mu.Unlock()
 	set, ok := v.auth[baseCid]
-	if !ok {
-		return nil, fmt.Errorf("unknown CID")
+	if ok && set.Contains(receiver) {
+		return &RequestResult{Status: RequestAccepted, PricePerByte: big.Zero()}, nil
+	}
+	// Announced content can be pulled by the first peers asking for it
+	if v.open[baseCid] > 0 {
+		v.open[baseCid]--
+		if !ok {
+			set = peer.NewSet()
+			v.auth[baseCid] = set
+		}
+		set.Add(receiver)
+		return &RequestResult{Status: RequestAccepted, PricePerByte: big.Zero()}, nil
 	}
-	if !set.Contains(receiver) {
-		return nil, fmt.Errorf("not authorized")
+	if v.has != nil && v.has(baseCid) {
+		return &RequestResult{
+			Status:       PaymentRequired,
+			Message:      "content must be retrieved with a retrieval deal",
+			PricePerByte: v.ppb,
+		}, ErrNotAuthorized
+	}
+	if !ok {
+		return rejected(ErrUnknownContent)
 	}
-	return nil, nil
+	return rejected(ErrNotAuthorized)
 }
@@ -1,11 +1,17 @@
 package supply
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/filecoin-project/go-state-types/abi"
+	"github.com/ipfs/go-cid"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	peer "github.com/libp2p/go-libp2p-core/peer"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
@@ -41,8 +47,10 @@ func TestMultiRequestStreams(t *testing.T) {
 				},
 			}
 
-			hn := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions)
+			hn := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
 			hn.Register(rootCid, storeID)
+			// The schema is sent along the request
+			require.NoError(t, hn.AttachSchema(rootCid, &Schema{Root: KindAny}))
 
 			var testData []*testutil.TestNode
 			receivers := make(map[peer.ID]*Supply)
@@ -55,7 +63,7 @@ func TestMultiRequestStreams(t *testing.T) {
 					require.NoError(t, err)
 				})
 
-				hn1 := New(tnode.Host, tnode.Dt, tnode.Ds, tnode.Ms, regions)
+				hn1 := New(tnode.Host, tnode.Dt, tnode.Ds, tnode.Ms, regions, nil)
 				receivers[tnode.Host.ID()] = hn1
 				testData = append(testData, tnode)
 			}
@@ -69,16 +77,53 @@ func TestMultiRequestStreams(t *testing.T) {
 			// This delay is required to let the host register all the peers and protocols
 			time.Sleep(10 * time.Millisecond)
 
-			res, err := hn.Dispatch(Request{rootCid, uint64(len(origBytes))})
+			res, err := hn.Dispatch(ctx, Request{PayloadCID: rootCid, Size: n1.DAGSize(ctx, t, storeID, rootCid)})
 			defer res.Close()
 			require.NoError(t, err)
+			require.Len(t, res.Sent, 7)
+			for _, sr := range res.Sent {
+				require.NoError(t, sr.Err)
+			}
 
 			var recs []PRecord
-			for len(recs) < res.Count {
+			for len(recs) < res.Attempted() {
 				rec, err := res.Next(ctx)
 				require.NoError(t, err)
 				recs = append(recs, rec)
 			}
+			select {
+			case <-res.Done():
+			case <-ctx.Done():
+				t.Fatal("dispatch not done")
+			}
+			require.Equal(t, 7, res.Confirmed())
+			_, err = res.Next(ctx)
+			require.Equal(t, ErrDispatchDone, err)
+
+			for _, rcv := range receivers {
+				require.Eventually(t, func() bool {
+					sch, err := rcv.Schemas().Get(rootCid)
+					return err == nil && sch.Root == KindAny
+				}, 2*time.Second, 10*time.Millisecond)
+			}
+
+			// Every provider issued a receipt the publisher countersigned
+			require.Eventually(t, func() bool {
+				rcpts, err := hn.Receipts(rootCid)
+				return err == nil && len(rcpts) == 7
+			}, 2*time.Second, 10*time.Millisecond)
+			for _, rcv := range receivers {
+				rcpts, err := rcv.FetchReceipts(ctx, hn.h.ID(), rootCid)
+				require.NoError(t, err)
+				require.Len(t, rcpts, 7)
+				require.Greater(t, AggregateReceipts(rcpts)[hn.h.ID()], uint64(len(origBytes)))
+
+				// The publisher cannot claim more bytes than the client signed for
+				forged := rcpts[0]
+				forged.Bytes *= 2
+				require.Error(t, forged.Verify())
+				break
+			}
 
 		})
 	}
@@ -106,12 +151,127 @@ func TestSendRequestNoPeers(t *testing.T) {
 		},
 	}
 
-	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions)
+	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
 	supply.Register(rootCid, storeID)
 
-	res, err := supply.Dispatch(Request{rootCid, uint64(len(origBytes))})
+	res, err := supply.Dispatch(bgCtx, Request{PayloadCID: rootCid, Size: uint64(len(origBytes))})
 	defer res.Close()
 	require.EqualError(t, err, ErrNoPeers.Error())
+	select {
+	case <-res.Done():
+	default:
+		t.Fatal("response should be done without any provider")
+	}
+}
+
+func TestRegisterMissingStore(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	require.Equal(t, ErrStoreNotFound, s.Register(root, storeID+100))
+	require.NoError(t, s.Register(root, storeID))
+
+	sid, err := s.GetStoreID(root)
+	require.NoError(t, err)
+	require.Equal(t, storeID, sid)
+
+	// A record left pointing at a deleted store is never returned
+	require.NoError(t, n.Ms.Delete(storeID))
+	_, err = s.GetStoreID(root)
+	require.Equal(t, ErrStoreNotFound, err)
+	require.NoError(t, s.RemoveContent(root))
+}
+
+func TestMoveContent(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, origBytes := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	require.NoError(t, s.Register(root, storeID))
+
+	to := n.Ms.Next()
+	require.Equal(t, ErrStoreNotFound, s.MoveContent(ctx, root, to))
+
+	_, err := n.Ms.Get(to)
+	require.NoError(t, err)
+	require.NoError(t, s.MoveContent(ctx, root, to))
+
+	sid, err := s.GetStoreID(root)
+	require.NoError(t, err)
+	require.Equal(t, to, sid)
+	// The source store is deleted once the blocks are in the new store
+	require.False(t, s.hasStore(storeID))
+
+	store, err := s.GetStore(root)
+	require.NoError(t, err)
+	n.VerifyFileTransferred(ctx, t, store.DAG, root, origBytes)
+}
+
+func TestSendRequestRetries(t *testing.T) {
+	bgCtx := context.Background()
+
+	mn := mocknet.New(bgCtx)
+
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(bgCtx, t)
+	// n2 is never linked so all our attempts fail
+	n2 := testutil.NewTestNode(mn, t)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+
+	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
+	supply.SetRetryPolicy(RetryPolicy{
+		Attempts: 3,
+		Backoff:  10 * time.Millisecond,
+		Deadline: time.Second,
+	})
+
+	res := newResponse()
+	defer res.Close()
+	supply.send(bgCtx, res, Request{Size: 1}, cid.Undef, []peer.ID{n2.Host.ID()})
+
+	require.Len(t, res.Sent, 1)
+	require.Equal(t, 3, res.Sent[0].Attempts)
+	require.Error(t, res.Sent[0].Err)
+
+	select {
+	case <-res.Done():
+	default:
+		t.Fatal("response should be done once all the providers failed")
+	}
+	require.Equal(t, 1, res.Failed())
+	failures := res.Failures()
+	require.Len(t, failures, 1)
+	require.Equal(t, res.Sent[0].Err, failures[n2.Host.ID()])
+
+	// Cancelling the context stops retrying
+	ctx, cancel := context.WithCancel(bgCtx)
+	cancel()
+	res = newResponse()
+	defer res.Close()
+	supply.send(ctx, res, Request{Size: 1}, cid.Undef, []peer.ID{n2.Host.ID()})
+	require.Equal(t, 1, res.Sent[0].Attempts)
+	require.True(t, errors.Is(res.Sent[0].Err, context.Canceled))
 }
 
 // The role of this test is to make sure we never dispatch content to unwanted regions
@@ -140,7 +300,7 @@ func TestSendRequestDiffRegions(t *testing.T) {
 		Regions["Asia"],
 	}
 
-	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, asia)
+	supply := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, asia, nil)
 
 	asiaNodes := make(map[peer.ID]*testutil.TestNode)
 	asiaSupplies := make(map[peer.ID]*Supply)
@@ -154,7 +314,7 @@ func TestSendRequestDiffRegions(t *testing.T) {
 		})
 
 		// Create a supply for each node
-		s := New(n.Host, n.Dt, n.Ds, n.Ms, asia)
+		s := New(n.Host, n.Dt, n.Ds, n.Ms, asia, nil)
 
 		asiaNodes[n.Host.ID()] = n
 		asiaSupplies[n.Host.ID()] = s
@@ -176,7 +336,7 @@ func TestSendRequestDiffRegions(t *testing.T) {
 		})
 
 		// Create a supply for each node
-		s := New(n.Host, n.Dt, n.Ds, n.Ms, africa)
+		s := New(n.Host, n.Dt, n.Ds, n.Ms, africa, nil)
 
 		africaNodes[n.Host.ID()] = n
 		africaSupplies = append(africaSupplies, s)
@@ -190,12 +350,12 @@ func TestSendRequestDiffRegions(t *testing.T) {
 
 	require.NoError(t, supply.Register(rootCid, storeID))
 
-	res, err := supply.Dispatch(Request{rootCid, uint64(len(origBytes))})
+	res, err := supply.Dispatch(ctx, Request{PayloadCID: rootCid, Size: n1.DAGSize(ctx, t, storeID, rootCid)})
 	defer res.Close()
 	require.NoError(t, err)
 
 	var recipients []PRecord
-	for len(recipients) < res.Count {
+	for len(recipients) < res.Attempted() {
 		rec, err := res.Next(ctx)
 		require.NoError(t, err)
 		recipients = append(recipients, rec)
@@ -207,3 +367,151 @@ func TestSendRequestDiffRegions(t *testing.T) {
 		asiaNodes[p.Provider].VerifyFileTransferred(ctx, t, store.DAG, rootCid, origBytes)
 	}
 }
+
+func TestValidatorResults(t *testing.T) {
+	root, err := cid.Parse("bafkqaaa")
+	require.NoError(t, err)
+	p1 := peer.ID("authorized")
+	p2 := peer.ID("other")
+
+	v := &Validator{
+		auth: make(map[cid.Cid]*peer.Set),
+		open: make(map[cid.Cid]int),
+		ppb:  abi.NewTokenAmount(2),
+	}
+
+	res, err := v.ValidatePull(p1, &Request{}, root, AllSelector())
+	require.Equal(t, ErrUnknownContent, err)
+	require.Equal(t, RequestRejected, res.(*RequestResult).Status)
+
+	v.Authorize(root, p1)
+	res, err = v.ValidatePull(p1, &Request{}, root, AllSelector())
+	require.NoError(t, err)
+	require.Equal(t, RequestAccepted, res.(*RequestResult).Status)
+
+	v.has = func(cid.Cid) bool { return true }
+	res, err = v.ValidatePull(p2, &Request{}, root, AllSelector())
+	require.Equal(t, ErrNotAuthorized, err)
+	rr := res.(*RequestResult)
+	require.Equal(t, PaymentRequired, rr.Status)
+
+	// Announced content can be pulled by a limited number of unknown peers
+	v.AuthorizeAny(root, 1)
+	res, err = v.ValidatePull(p2, &Request{}, root, AllSelector())
+	require.NoError(t, err)
+	require.Equal(t, RequestAccepted, res.(*RequestResult).Status)
+	require.True(t, v.authorized(root, p2))
+	_, err = v.ValidatePull(peer.ID("late"), &Request{}, root, AllSelector())
+	require.Equal(t, ErrNotAuthorized, err)
+
+	// Make sure the result survives the wire
+	buf := new(bytes.Buffer)
+	require.NoError(t, rr.MarshalCBOR(buf))
+	var dec RequestResult
+	require.NoError(t, dec.UnmarshalCBOR(buf))
+	require.Equal(t, rr.Status, dec.Status)
+	require.Equal(t, rr.Message, dec.Message)
+	require.True(t, rr.PricePerByte.Equals(dec.PricePerByte))
+}
+
+func TestResponseWaitFor(t *testing.T) {
+	ctx := context.Background()
+	p1 := peer.ID("p1")
+	p2 := peer.ID("p2")
+	p3 := peer.ID("p3")
+
+	res := newResponse()
+	res.setAttempted(3)
+	go res.confirm(PRecord{Provider: p1})
+	go res.confirm(PRecord{Provider: p2})
+
+	recs, err := res.WaitFor(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, recs, 2)
+
+	// Returns what it has once the context expires
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	recs, err = res.WaitFor(tctx, 2)
+	require.Equal(t, context.DeadlineExceeded, err)
+	require.Len(t, recs, 0)
+
+	// Returns early once the dispatch is done
+	res.fail(p3, errors.New("failed"))
+	recs, err = res.WaitFor(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+
+	// A dispatch to no provider is done right away
+	res = newResponse()
+	select {
+	case <-res.Done():
+		t.Fatal("response should not be done before knowing the providers")
+	default:
+	}
+	res.setAttempted(0)
+	tctx, cancel = context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	recs, err = res.WaitFor(tctx, 0)
+	require.NoError(t, err)
+	require.Len(t, recs, 0)
+
+	// Closing is safe while providers are still confirming
+	res = newResponse()
+	res.setAttempted(MaxReceiverCount * 2)
+	var wg sync.WaitGroup
+	for i := 0; i < MaxReceiverCount*2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res.confirm(PRecord{Provider: peer.ID(fmt.Sprintf("p%d", i))})
+		}(i)
+	}
+	go res.Close()
+	res.Close()
+	wg.Wait()
+	for {
+		_, err := res.Next(ctx)
+		if err != nil {
+			require.Equal(t, ErrDispatchDone, err)
+			break
+		}
+	}
+}
+
+func TestRemoveSharedStore(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	require.NoError(t, s.Register(root, storeID))
+
+	// Three versions share the store of the first one
+	v2, v3 := testRoot(t, 2), testRoot(t, 3)
+	sid := strconv.FormatUint(uint64(storeID), 10)
+	require.NoError(t, s.store.AddLabel(root, KNext, v2.String()))
+	require.NoError(t, s.store.PutRecord(v2, &ContentRecord{Labels: map[string]string{
+		KStoreID:  sid,
+		KPrevious: root.String(),
+		KNext:     v3.String(),
+	}}))
+	require.NoError(t, s.store.PutRecord(v3, &ContentRecord{Labels: map[string]string{
+		KStoreID:  sid,
+		KPrevious: v2.String(),
+	}}))
+
+	// The first version no longer links to the last one once the middle one is gone
+	require.NoError(t, s.RemoveContent(v2))
+	require.NoError(t, s.RemoveContent(root))
+	require.True(t, s.hasStore(storeID))
+
+	require.NoError(t, s.RemoveContent(v3))
+	require.False(t, s.hasStore(storeID))
+}
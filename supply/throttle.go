@@ -0,0 +1,136 @@
+package supply
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+// DefaultDispatchRate is how many dispatch requests per minute we accept from a single publisher by default
+const DefaultDispatchRate = 60
+
+// ErrDispatchThrottled is returned when a provider throttles the dispatch requests of a publisher
+var ErrDispatchThrottled = errors.New("dispatch throttled")
+
+// ErrDispatchRejected is returned when a provider rejects a dispatch request e.g. for its codec, rules or quotas
+var ErrDispatchRejected = errors.New("dispatch rejected")
+
+// maxIdleBuckets is how many publishers we track before forgetting those who didn't send recent requests
+const maxIdleBuckets = 1024
+
+// bucket holds the requests a publisher can still send us
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// dispatchThrottle rate limits the requests of each publisher so a flood of dispatches or announcements
+// cannot fill our pull queue. Each publisher has a bucket of rate requests refilled over a minute.
+type dispatchThrottle struct {
+	mu      sync.Mutex
+	rate    int
+	buckets map[peer.ID]*bucket
+	now     func() time.Time
+}
+
+func newDispatchThrottle(rate int) *dispatchThrottle {
+	return &dispatchThrottle{
+		rate:    rate,
+		buckets: make(map[peer.ID]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (t *dispatchThrottle) setRate(rate int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rate = rate
+	t.buckets = make(map[peer.ID]*bucket)
+}
+
+// refill adds the tokens earned since the last request without going over the rate
+func (t *dispatchThrottle) refill(b *bucket, now time.Time) {
+	b.tokens += now.Sub(b.last).Minutes() * float64(t.rate)
+	if b.tokens > float64(t.rate) {
+		b.tokens = float64(t.rate)
+	}
+	b.last = now
+}
+
+// allow takes a token from the bucket of the publisher. When it is empty it returns how long
+// the publisher should wait before sending another request.
+func (t *dispatchThrottle) allow(p peer.ID) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate <= 0 {
+		return true, 0
+	}
+	now := t.now()
+	b, ok := t.buckets[p]
+	if !ok {
+		t.prune(now)
+		b = &bucket{tokens: float64(t.rate), last: now}
+		t.buckets[p] = b
+	}
+	t.refill(b, now)
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / float64(t.rate) * float64(time.Minute))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// allowRequest takes a token from the peer who sent a request and from its publisher if someone else
+// signed it. Charging the sender keeps a peer signing each request with a new key from getting a full
+// bucket every time.
+func (t *dispatchThrottle) allowRequest(from, pub peer.ID) (bool, time.Duration) {
+	ok, wait := t.allow(from)
+	if !ok || pub == from {
+		return ok, wait
+	}
+	return t.allow(pub)
+}
+
+// prune forgets the publishers whose bucket is full again as they behave like new publishers
+func (t *dispatchThrottle) prune(now time.Time) {
+	if len(t.buckets) < maxIdleBuckets {
+		return
+	}
+	for p, b := range t.buckets {
+		t.refill(b, now)
+		if b.tokens >= float64(t.rate) {
+			delete(t.buckets, p)
+		}
+	}
+}
+
+// DispatchResult is sent back to the peer who sent us a dispatch request. Providers not sending
+// any result accept all the requests.
+type DispatchResult struct {
+	Status  ValidationStatus
+	Message string
+	// RetryAfter is the number of seconds to wait before sending another request when throttled
+	RetryAfter uint64
+}
+
+// Err returns the error of a throttled or rejected request or nil
+func (r DispatchResult) Err() error {
+	switch r.Status {
+	case RequestThrottled:
+		return fmt.Errorf("%w: retry after %ds", ErrDispatchThrottled, r.RetryAfter)
+	case RequestRejected:
+		return fmt.Errorf("%w: %s", ErrDispatchRejected, r.Message)
+	default:
+		return nil
+	}
+}
+
+// SetDispatchRate changes how many dispatch requests per minute we accept from a single publisher.
+// Zero or less means no limit.
+func (s *Supply) SetDispatchRate(rate int) {
+	s.throttle.setRate(rate)
+}
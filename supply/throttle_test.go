@@ -0,0 +1,152 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	blocksutil "github.com/ipfs/go-ipfs-blocksutil"
+	"github.com/libp2p/go-libp2p-core/test"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDispatchThrottle(t *testing.T) {
+	now := time.Now()
+	th := newDispatchThrottle(2)
+	th.now = func() time.Time { return now }
+	p1 := test.RandPeerIDFatal(t)
+	p2 := test.RandPeerIDFatal(t)
+
+	ok, _ := th.allow(p1)
+	require.True(t, ok)
+	ok, _ = th.allow(p1)
+	require.True(t, ok)
+	ok, wait := th.allow(p1)
+	require.False(t, ok)
+	require.Equal(t, 30*time.Second, wait)
+
+	// Each publisher has its own bucket
+	ok, _ = th.allow(p2)
+	require.True(t, ok)
+
+	// Tokens are refilled over a minute
+	now = now.Add(30 * time.Second)
+	ok, _ = th.allow(p1)
+	require.True(t, ok)
+	ok, _ = th.allow(p1)
+	require.False(t, ok)
+
+	// Requests signed by other publishers are charged to the peer who sent them too
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		ok, _ = th.allowRequest(p1, test.RandPeerIDFatal(t))
+		require.True(t, ok)
+	}
+	ok, _ = th.allowRequest(p1, test.RandPeerIDFatal(t))
+	require.False(t, ok)
+
+	th.setRate(0)
+	for i := 0; i < 10; i++ {
+		ok, _ = th.allow(p1)
+		require.True(t, ok)
+	}
+}
+
+func TestDispatchResultEncoding(t *testing.T) {
+	res := DispatchResult{Status: RequestThrottled, Message: "too many requests", RetryAfter: 12}
+	buf := new(bytes.Buffer)
+	require.NoError(t, res.MarshalCBOR(buf))
+	var dec DispatchResult
+	require.NoError(t, dec.UnmarshalCBOR(buf))
+	require.Equal(t, res, dec)
+	require.True(t, errors.Is(dec.Err(), ErrDispatchThrottled))
+	require.True(t, errors.Is(DispatchResult{Status: RequestRejected}.Err(), ErrDispatchRejected))
+	require.NoError(t, DispatchResult{Status: RequestAccepted}.Err())
+}
+
+func TestSendRequestThrottled(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(ctx, t)
+	publisher := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
+
+	n2 := testutil.NewTestNode(mn, t)
+	n2.SetupDataTransfer(ctx, t)
+	provider := New(n2.Host, n2.Dt, n2.Ds, n2.Ms, regions, nil)
+	provider.SetDispatchRate(1)
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	time.Sleep(10 * time.Millisecond)
+
+	gen := blocksutil.NewBlockGenerator()
+	require.NoError(t, publisher.sendRequest(ctx, Request{PayloadCID: gen.Next().Cid(), Size: 1}, n2.Host.ID()))
+
+	err := publisher.sendRequest(ctx, Request{PayloadCID: gen.Next().Cid(), Size: 1}, n2.Host.ID())
+	require.True(t, errors.Is(err, ErrDispatchThrottled))
+
+	// Throttled requests are not retried
+	attempts, err := publisher.sendWithRetry(ctx, Request{PayloadCID: gen.Next().Cid(), Size: 1}, n2.Host.ID())
+	require.Equal(t, 1, attempts)
+	require.True(t, errors.Is(err, ErrDispatchThrottled))
+}
+
+func TestDispatchRejected(t *testing.T) {
+	ctx := context.Background()
+	mn := mocknet.New(ctx)
+
+	regions := []Region{
+		{
+			Name: "TestRegion",
+			Code: CustomRegion,
+		},
+	}
+	n1 := testutil.NewTestNode(mn, t)
+	n1.SetupDataTransfer(ctx, t)
+	publisher := New(n1.Host, n1.Dt, n1.Ds, n1.Ms, regions, nil)
+	publisher.SetRetryPolicy(RetryPolicy{
+		Attempts: 3,
+		Backoff:  10 * time.Millisecond,
+		Deadline: time.Second,
+	})
+
+	n2 := testutil.NewTestNode(mn, t)
+	n2.SetupDataTransfer(ctx, t)
+	provider := New(n2.Host, n2.Dt, n2.Ds, n2.Ms, regions, nil)
+	require.NoError(t, provider.SetAcceptRules(AcceptRules{MaxSize: 1}))
+
+	require.NoError(t, mn.LinkAll())
+	require.NoError(t, mn.ConnectAllButSelf())
+	time.Sleep(10 * time.Millisecond)
+
+	gen := blocksutil.NewBlockGenerator()
+	res, err := publisher.Dispatch(ctx, Request{PayloadCID: gen.Next().Cid(), Size: 2})
+	require.NoError(t, err)
+	defer res.Close()
+
+	// Rejected requests are not retried and the provider counts as failed with its reason
+	require.Len(t, res.Sent, 1)
+	require.Equal(t, 1, res.Sent[0].Attempts)
+	require.True(t, errors.Is(res.Sent[0].Err, ErrDispatchRejected))
+	select {
+	case <-res.Done():
+	case <-time.After(time.Second):
+		t.Fatal("response should be done once the provider rejected the request")
+	}
+	require.Equal(t, 1, res.Failed())
+	reason := res.Failures()[n2.Host.ID()]
+	require.True(t, errors.Is(reason, ErrDispatchRejected))
+	require.Contains(t, reason.Error(), "size 2 over 1 bytes")
+}
@@ -0,0 +1,328 @@
+package supply
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-multistore"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	ipldformat "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-merkledag"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+)
+
+// Tier is where the blocks of a content are kept
+type Tier string
+
+const (
+	// TierHot content is kept in memory on top of the local disk
+	TierHot Tier = "hot"
+	// TierWarm content is on the local disk
+	TierWarm Tier = "warm"
+	// TierCold content is offloaded to our cold store and recalled on demand
+	TierCold Tier = "cold"
+)
+
+// TieringPolicy decides which tier content belongs to from its access stats
+type TieringPolicy struct {
+	// HotMinAccesses is the number of retrievals since the last rebalance above which content is kept in memory
+	HotMinAccesses uint64
+	// HotCapacity is the maximum number of bytes kept in memory
+	HotCapacity uint64
+	// ColdAfter is how long content can go without being accessed before it's offloaded. Zero never offloads.
+	ColdAfter time.Duration
+	// Interval is how often content is moved between tiers
+	Interval time.Duration
+}
+
+// DefaultTieringPolicy keeps the most popular content in 64MiB of memory and offloads content unused for a week
+var DefaultTieringPolicy = TieringPolicy{
+	HotMinAccesses: 10,
+	HotCapacity:    64 << 20,
+	ColdAfter:      7 * 24 * time.Hour,
+	Interval:       10 * time.Minute,
+}
+
+// hotTier keeps the blocks of the hottest content in memory
+type hotTier struct {
+	mu     sync.RWMutex
+	blocks map[cid.Cid]blocks.Block
+	// roots lists the blocks of each content so they can be dropped together
+	roots map[cid.Cid][]cid.Cid
+	refs  map[cid.Cid]int
+	size  uint64
+	// accesses is the access count of each store at the last rebalance
+	accesses map[string]uint64
+}
+
+func newHotTier() *hotTier {
+	return &hotTier{
+		blocks:   make(map[cid.Cid]blocks.Block),
+		roots:    make(map[cid.Cid][]cid.Cid),
+		refs:     make(map[cid.Cid]int),
+		accesses: make(map[string]uint64),
+	}
+}
+
+func (h *hotTier) get(c cid.Cid) (blocks.Block, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	blk, ok := h.blocks[c]
+	return blk, ok
+}
+
+func (h *hotTier) has(root cid.Cid) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.roots[root]
+	return ok
+}
+
+// load copies all the blocks of a content in memory and returns the number of bytes loaded
+func (h *hotTier) load(ctx context.Context, root cid.Cid, store *multistore.Store) (uint64, error) {
+	var blks []blocks.Block
+	var size uint64
+	seen := cid.NewSet()
+	err := merkledag.Walk(ctx, func(ctx context.Context, c cid.Cid) ([]*ipldformat.Link, error) {
+		nd, err := store.DAG.Get(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		blks = append(blks, nd)
+		size += uint64(len(nd.RawData()))
+		return nd.Links(), nil
+	}, root, seen.Visit)
+	if err != nil {
+		return 0, err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.roots[root]; ok {
+		return 0, nil
+	}
+	keys := make([]cid.Cid, 0, len(blks))
+	for _, blk := range blks {
+		// Blocks shared between contents are only counted once
+		if h.refs[blk.Cid()] == 0 {
+			h.blocks[blk.Cid()] = blk
+			h.size += uint64(len(blk.RawData()))
+		}
+		h.refs[blk.Cid()]++
+		keys = append(keys, blk.Cid())
+	}
+	h.roots[root] = keys
+	return size, nil
+}
+
+// drop removes the blocks of a content from memory and returns the number of bytes freed
+func (h *hotTier) drop(root cid.Cid) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	keys, ok := h.roots[root]
+	if !ok {
+		return 0
+	}
+	var freed uint64
+	for _, k := range keys {
+		h.refs[k]--
+		if h.refs[k] > 0 {
+			continue
+		}
+		delete(h.refs, k)
+		if blk, ok := h.blocks[k]; ok {
+			freed += uint64(len(blk.RawData()))
+			h.size -= uint64(len(blk.RawData()))
+			delete(h.blocks, k)
+		}
+	}
+	delete(h.roots, root)
+	return freed
+}
+
+// CachedLoader serves the blocks of hot content from memory and falls back to the given loader. Blocks
+// read from the loader are shared with the other transfers of the same content.
+func (s *Supply) CachedLoader(root cid.Cid, fallback ipld.Loader) ipld.Loader {
+	h := s.hot
+	if h == nil || !h.has(root) {
+		fallback = s.reads.loader(root, fallback, func() {
+			s.metrics.Count(MetricSharedReads, 1)
+		})
+		return func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+			s.metrics.Count(MetricTierHits, 1, "tier", string(TierWarm))
+			return fallback(lnk, lnkCtx)
+		}
+	}
+	return func(lnk ipld.Link, lnkCtx ipld.LinkContext) (io.Reader, error) {
+		if cl, ok := lnk.(cidlink.Link); ok {
+			if blk, ok := h.get(cl.Cid); ok {
+				s.metrics.Count(MetricTierHits, 1, "tier", string(TierHot))
+				return bytes.NewReader(blk.RawData()), nil
+			}
+		}
+		s.metrics.Count(MetricTierHits, 1, "tier", string(TierWarm))
+		return fallback(lnk, lnkCtx)
+	}
+}
+
+// ContentTier returns the tier a content is currently in
+func (s *Supply) ContentTier(root cid.Cid) (Tier, error) {
+	rec, err := s.store.GetRecord(root)
+	if err != nil {
+		return "", err
+	}
+	if _, ok := rec.Labels[KCold]; ok {
+		return TierCold, nil
+	}
+	if s.hot != nil && s.hot.has(root) {
+		return TierHot, nil
+	}
+	return TierWarm, nil
+}
+
+// recordMove reports a content moving between tiers
+func (s *Supply) recordMove(from, to Tier, size uint64) {
+	s.metrics.Count(MetricTierMoves, 1, "from", string(from), "to", string(to))
+	s.metrics.Count(MetricTierMovedBytes, float64(size), "from", string(from), "to", string(to))
+}
+
+// EnableTiering periodically moves content between memory, the local disk and our cold store
+// according to the policy until the context is cancelled. Content is only offloaded if we have a cold store.
+func (s *Supply) EnableTiering(ctx context.Context, policy TieringPolicy) {
+	if policy.Interval <= 0 {
+		policy.Interval = DefaultTieringPolicy.Interval
+	}
+	s.tiering = policy
+	s.hot = newHotTier()
+	go func() {
+		ticker := time.NewTicker(policy.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Rebalance(ctx); err != nil {
+					s.log.Error().Err(err).Msg("failed to rebalance tiers")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Rebalance moves the content accessed the most since the last rebalance in memory and offloads
+// the content no one accessed for a while
+func (s *Supply) Rebalance(ctx context.Context) error {
+	h := s.hot
+	if h == nil {
+		return nil
+	}
+	p := s.tiering
+	stores, err := s.storeUsage()
+	if err != nil {
+		return err
+	}
+	type candidate struct {
+		st    *storeUsage
+		delta uint64
+	}
+	var hot []candidate
+	now := time.Now().Unix()
+	for sid, st := range stores {
+		h.mu.Lock()
+		delta := st.accesses - h.accesses[sid]
+		if st.accesses < h.accesses[sid] {
+			delta = st.accesses
+		}
+		h.accesses[sid] = st.accesses
+		h.mu.Unlock()
+
+		if delta > 0 && delta >= p.HotMinAccesses {
+			hot = append(hot, candidate{st, delta})
+			continue
+		}
+		if p.ColdAfter > 0 && s.cold != nil && !st.pinned && st.lastAccess > 0 &&
+			time.Duration(now-st.lastAccess)*time.Second > p.ColdAfter {
+			if err := s.Offload(ctx, st.roots[0]); err != nil {
+				return err
+			}
+		}
+	}
+	// The most accessed content gets the memory first
+	sort.Slice(hot, func(i, j int) bool {
+		return hot[i].delta > hot[j].delta
+	})
+	keep := make(map[cid.Cid]bool)
+	var budget uint64
+	for _, c := range hot {
+		if budget+c.st.size > p.HotCapacity {
+			continue
+		}
+		budget += c.st.size
+		for _, root := range c.st.roots {
+			keep[root] = true
+		}
+	}
+	// Make room before loading the new hot content
+	h.mu.RLock()
+	var cooled []cid.Cid
+	for root := range h.roots {
+		if !keep[root] {
+			cooled = append(cooled, root)
+		}
+	}
+	h.mu.RUnlock()
+	s.dropHot(cooled...)
+	for root := range keep {
+		if h.has(root) {
+			continue
+		}
+		store, err := s.GetStore(root)
+		if err != nil {
+			continue
+		}
+		size, err := h.load(ctx, root, store)
+		if err != nil {
+			s.log.Warn().Err(err).Str("root", root.String()).Msg("failed to load content in memory")
+			continue
+		}
+		if size > 0 {
+			s.recordMove(TierWarm, TierHot, size)
+		}
+	}
+	s.metrics.Gauge(MetricBytesHot, float64(h.hotSize()))
+	return nil
+}
+
+func (h *hotTier) hotSize() uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.size
+}
+
+// dropHot frees the memory used by content leaving the hot tier
+func (s *Supply) dropHot(roots ...cid.Cid) {
+	if s.hot == nil {
+		return
+	}
+	for _, root := range roots {
+		if freed := s.hot.drop(root); freed > 0 {
+			s.recordMove(TierHot, TierWarm, freed)
+		}
+	}
+}
+
+// recordSize returns the size of a content from its record without walking the DAG
+func recordSize(rec *ContentRecord) uint64 {
+	if rec == nil {
+		return 0
+	}
+	size, _ := strconv.ParseUint(rec.Labels[KSize], 10, 64)
+	return size
+}
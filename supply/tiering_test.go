@@ -0,0 +1,91 @@
+package supply
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	"github.com/myelnet/pop/internal/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiering(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mn := mocknet.New(ctx)
+
+	n := testutil.NewTestNode(mn, t)
+	n.SetupDataTransfer(ctx, t)
+
+	fname := n.CreateRandomFile(t, 1000)
+	link, storeID, _ := n.LoadFileToNewStore(ctx, t, fname)
+	root := link.(cidlink.Link).Cid
+
+	s := New(n.Host, n.Dt, n.Ds, n.Ms, []Region{Regions["Global"]}, nil)
+	m := NewPrometheusMetrics()
+	s.SetMetrics(m)
+	require.NoError(t, s.Register(root, storeID))
+
+	s.EnableTiering(ctx, TieringPolicy{
+		HotMinAccesses: 2,
+		HotCapacity:    1 << 20,
+		ColdAfter:      time.Hour,
+		Interval:       time.Hour,
+	})
+
+	// Frequently retrieved content is moved in memory
+	require.NoError(t, s.RecordAccess(root))
+	require.NoError(t, s.RecordAccess(root))
+	require.NoError(t, s.Rebalance(ctx))
+	tier, err := s.ContentTier(root)
+	require.NoError(t, err)
+	require.Equal(t, TierHot, tier)
+
+	// Hot blocks never reach the store
+	loader := s.CachedLoader(root, func(ipld.Link, ipld.LinkContext) (io.Reader, error) {
+		return nil, errors.New("not in memory")
+	})
+	r, err := loader(cidlink.Link{Cid: root}, ipld.LinkContext{})
+	require.NoError(t, err)
+	b, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	require.NotEmpty(t, b)
+
+	// Content no one retrieved since the last rebalance cools down
+	require.NoError(t, s.Rebalance(ctx))
+	tier, err = s.ContentTier(root)
+	require.NoError(t, err)
+	require.Equal(t, TierWarm, tier)
+
+	// Idle content is only offloaded when we have a cold store
+	old := strconv.FormatInt(time.Now().Add(-2*time.Hour).Unix(), 10)
+	require.NoError(t, s.store.AddLabel(root, KLastAccess, old))
+	require.NoError(t, s.Rebalance(ctx))
+	tier, err = s.ContentTier(root)
+	require.NoError(t, err)
+	require.Equal(t, TierWarm, tier)
+
+	cold, err := ParseObjectStore(t.TempDir(), "")
+	require.NoError(t, err)
+	s.SetColdStore(cold)
+	require.NoError(t, s.Rebalance(ctx))
+	tier, err = s.ContentTier(root)
+	require.NoError(t, err)
+	require.Equal(t, TierCold, tier)
+
+	rec := httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	out := rec.Body.String()
+	require.Contains(t, out, `pop_supply_tier_moves_total{from="warm",to="hot"} 1`)
+	require.Contains(t, out, `pop_supply_tier_moves_total{from="hot",to="warm"} 1`)
+	require.Contains(t, out, `pop_supply_tier_moves_total{from="warm",to="cold"} 1`)
+	require.Contains(t, out, `pop_supply_tier_hits_total{tier="hot"} 1`)
+}
@@ -0,0 +1,88 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// ErrNotConfirmed is returned when a message was not approved before signing
+var ErrNotConfirmed = errors.New("message not confirmed")
+
+// ConfirmFunc approves a message before it is signed by returning nil. Integrators can prompt the
+// user in a GUI, check a TOTP code or apply their own policy.
+type ConfirmFunc func(ctx context.Context, msg *fil.Message) error
+
+// MessageSigner is implemented by drivers who need to know the content of the messages they sign
+type MessageSigner interface {
+	SignMessage(ctx context.Context, msg *fil.Message) (*fil.SignedMessage, error)
+}
+
+// SignMessage signs a chain message with the key of its sender. All the messages we send should be
+// signed with it so drivers implementing MessageSigner can inspect them.
+func SignMessage(ctx context.Context, d Driver, msg *fil.Message) (*fil.SignedMessage, error) {
+	if ms, ok := d.(MessageSigner); ok {
+		return ms.SignMessage(ctx, msg)
+	}
+	mbl, err := msg.ToStorageBlock()
+	if err != nil {
+		return nil, err
+	}
+	sig, err := d.Sign(ctx, msg.From, mbl.Cid().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	return &fil.SignedMessage{
+		Message:   *msg,
+		Signature: *sig,
+	}, nil
+}
+
+// Confirming is a driver asking for confirmation before signing messages transferring at least
+// a threshold value. Other payloads such as deal proposals and vouchers are signed without it.
+type Confirming struct {
+	Driver
+	fAPI      fil.API
+	threshold fil.BigInt
+	confirm   ConfirmFunc
+}
+
+// NewConfirming wraps a driver so messages with a value of at least the threshold must be confirmed.
+// A zero threshold confirms every message.
+func NewConfirming(d Driver, f fil.API, threshold fil.BigInt, confirm ConfirmFunc) *Confirming {
+	if threshold.Int == nil {
+		threshold = big.Zero()
+	}
+	return &Confirming{
+		Driver:    d,
+		fAPI:      f,
+		threshold: threshold,
+		confirm:   confirm,
+	}
+}
+
+// SignMessage calls the confirmation hook if the message value reaches the threshold then signs it
+func (c *Confirming) SignMessage(ctx context.Context, msg *fil.Message) (*fil.SignedMessage, error) {
+	value := msg.Value
+	if value.Int == nil {
+		value = big.Zero()
+	}
+	if value.GreaterThanEqual(c.threshold) {
+		if err := c.confirm(ctx, msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrNotConfirmed, err)
+		}
+	}
+	return SignMessage(ctx, c.Driver, msg)
+}
+
+// Transfer FIL from one of our addresses once confirmed
+func (c *Confirming) Transfer(ctx context.Context, from address.Address, to address.Address, amount string) error {
+	if c.fAPI == nil {
+		return ErrNoAPI
+	}
+	return transfer(ctx, c.fAPI, c, from, to, amount)
+}
@@ -0,0 +1,67 @@
+package wallet
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/filecoin-project/go-state-types/big"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmingSigner(t *testing.T) {
+	ctx := context.Background()
+
+	local := NewIPFS(keystore.NewMemKeystore(), nil)
+	from, err := local.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+	to, err := local.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+
+	var confirmed []*fil.Message
+	approve := true
+	w := NewConfirming(local, nil, big.NewInt(1000), func(ctx context.Context, msg *fil.Message) error {
+		confirmed = append(confirmed, msg)
+		if !approve {
+			return errors.New("rejected by user")
+		}
+		return nil
+	})
+
+	// Below the threshold
+	small := &fil.Message{From: from, To: to, Value: big.NewInt(999)}
+	smsg, err := SignMessage(ctx, w, small)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 0)
+
+	mbl, err := small.ToStorageBlock()
+	require.NoError(t, err)
+	ok, err := local.Verify(ctx, from, mbl.Cid().Bytes(), &smsg.Signature)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	large := &fil.Message{From: from, To: to, Value: big.NewInt(1000)}
+	_, err = SignMessage(ctx, w, large)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 1)
+	require.Equal(t, large, confirmed[0])
+
+	approve = false
+	_, err = SignMessage(ctx, w, large)
+	require.True(t, errors.Is(err, ErrNotConfirmed))
+	require.Len(t, confirmed, 2)
+
+	// A message without value is below the threshold
+	_, err = SignMessage(ctx, w, &fil.Message{From: from, To: to})
+	require.NoError(t, err)
+	require.Len(t, confirmed, 2)
+
+	// Raw payloads are signed directly
+	_, err = w.Sign(ctx, from, []byte("voucher"))
+	require.NoError(t, err)
+	require.Len(t, confirmed, 2)
+
+	require.Equal(t, ErrNoAPI, w.Transfer(ctx, from, to, "1"))
+}
@@ -0,0 +1,72 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/crypto"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// Delegated is a driver signing for a payer address with the driver of the payer, for instance the
+// remote signer of an application sponsoring our retrievals. Other addresses use our own driver.
+type Delegated struct {
+	Driver
+	payer address.Address
+	pd    Driver
+}
+
+// NewDelegated wraps our driver so payments from the payer address are signed by the payer driver
+func NewDelegated(d Driver, payer address.Address, pd Driver) *Delegated {
+	return &Delegated{
+		Driver: d,
+		payer:  payer,
+		pd:     pd,
+	}
+}
+
+// Payer returns the address funding our payments
+func (d *Delegated) Payer() address.Address {
+	return d.payer
+}
+
+// List returns our addresses and the payer address
+func (d *Delegated) List() ([]address.Address, error) {
+	addrs, err := d.Driver.List()
+	if err != nil {
+		return nil, err
+	}
+	return append(addrs, d.payer), nil
+}
+
+// Sign signs the bytes with the payer driver if the address is the payer
+func (d *Delegated) Sign(ctx context.Context, addr address.Address, msg []byte) (*crypto.Signature, error) {
+	if addr == d.payer {
+		return d.pd.Sign(ctx, addr, msg)
+	}
+	return d.Driver.Sign(ctx, addr, msg)
+}
+
+// SignMessage signs messages sent by the payer with the payer driver
+func (d *Delegated) SignMessage(ctx context.Context, msg *fil.Message) (*fil.SignedMessage, error) {
+	if msg.From == d.payer {
+		return SignMessage(ctx, d.pd, msg)
+	}
+	return SignMessage(ctx, d.Driver, msg)
+}
+
+// Verify checks signatures of the payer with the payer driver
+func (d *Delegated) Verify(ctx context.Context, k address.Address, msg []byte, sig *crypto.Signature) (bool, error) {
+	if k == d.payer {
+		return d.pd.Verify(ctx, k, msg, sig)
+	}
+	return d.Driver.Verify(ctx, k, msg, sig)
+}
+
+// Balance returns the balance of the payer from the payer driver
+func (d *Delegated) Balance(ctx context.Context, addr address.Address) (fil.BigInt, error) {
+	if addr == d.payer {
+		return d.pd.Balance(ctx, addr)
+	}
+	return d.Driver.Balance(ctx, addr)
+}
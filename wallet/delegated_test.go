@@ -0,0 +1,51 @@
+package wallet
+
+import (
+	"context"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelegatedSigner(t *testing.T) {
+	ctx := context.Background()
+
+	local := NewIPFS(keystore.NewMemKeystore(), nil)
+	client, err := local.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+
+	sponsor := NewIPFS(keystore.NewMemKeystore(), nil)
+	payer, err := sponsor.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+
+	w := NewDelegated(local, payer, sponsor)
+	require.Equal(t, payer, w.Payer())
+	require.Equal(t, client, w.DefaultAddress())
+
+	addrs, err := w.List()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []address.Address{client, payer}, addrs)
+
+	// Messages from the payer are signed by the sponsor
+	msg := &fil.Message{From: payer, To: client}
+	smsg, err := SignMessage(ctx, w, msg)
+	require.NoError(t, err)
+	mbl, err := msg.ToStorageBlock()
+	require.NoError(t, err)
+	ok, err := sponsor.Verify(ctx, payer, mbl.Cid().Bytes(), &smsg.Signature)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Our own addresses are still signed locally
+	sig, err := w.Sign(ctx, client, []byte("hello"))
+	require.NoError(t, err)
+	ok, err = w.Verify(ctx, client, []byte("hello"), sig)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = local.Sign(ctx, payer, []byte("hello"))
+	require.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package wallet
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// DriverConstructor creates a driver from a wallet URI. The keystore is the local repo keystore
+// and the API may be nil when the node runs without a Filecoin connection.
+type DriverConstructor func(uri *url.URL, ks keystore.Keystore, f fil.API) (Driver, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = map[string]DriverConstructor{
+		"keystore": func(_ *url.URL, ks keystore.Keystore, f fil.API) (Driver, error) {
+			return NewIPFS(ks, f), nil
+		},
+		"unix": func(uri *url.URL, _ keystore.Keystore, f fil.API) (Driver, error) {
+			if uri.Path == "" {
+				return nil, fmt.Errorf("missing socket path in %s", uri)
+			}
+			return NewRemote(uri.Path, f), nil
+		},
+	}
+)
+
+// RegisterDriver makes a driver available under a URI scheme. It replaces any driver registered
+// under the same scheme.
+func RegisterDriver(scheme string, c DriverConstructor) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	drivers[scheme] = c
+}
+
+// Open returns the driver for a wallet URI such as unix:///run/signer.sock. An empty URI opens
+// the local keystore.
+func Open(uri string, ks keystore.Keystore, f fil.API) (Driver, error) {
+	if uri == "" {
+		uri = "keystore:"
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+	driversMu.RLock()
+	c, ok := drivers[u.Scheme]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no wallet driver for scheme %q", u.Scheme)
+	}
+	return c(u, ks, f)
+}
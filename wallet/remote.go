@@ -0,0 +1,267 @@
+package wallet
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/filecoin-project/go-address"
+	"github.com/filecoin-project/go-state-types/big"
+	"github.com/filecoin-project/go-state-types/crypto"
+	fil "github.com/myelnet/pop/filecoin"
+)
+
+// Methods of the signer protocol
+const (
+	SignerNewKey            = "NewKey"
+	SignerDefaultAddress    = "DefaultAddress"
+	SignerSetDefaultAddress = "SetDefaultAddress"
+	SignerList              = "List"
+	SignerImportKey         = "ImportKey"
+	SignerSign              = "Sign"
+)
+
+// SignerTimeout bounds how long we wait for a signer to answer a request without deadline
+const SignerTimeout = 30 * time.Second
+
+// SignerRequest is a JSON line sent to a signer. Each connection carries a single request.
+type SignerRequest struct {
+	Method  string   `json:"method"`
+	Address string   `json:"address,omitempty"`
+	KeyType KeyType  `json:"keyType,omitempty"`
+	Key     *KeyInfo `json:"key,omitempty"`
+	// Data are the bytes to sign
+	Data []byte `json:"data,omitempty"`
+}
+
+// SignerResponse is the JSON line a signer answers with. Addresses are encoded as strings and
+// an empty address means there is none.
+type SignerResponse struct {
+	Address   string            `json:"address,omitempty"`
+	Addresses []string          `json:"addresses,omitempty"`
+	Signature *crypto.Signature `json:"signature,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Remote is a wallet driver whose keys are held by a signer daemon listening on a unix socket.
+// The node never sees the private keys, it only asks the signer to sign messages.
+type Remote struct {
+	path string
+	fAPI fil.API
+}
+
+// NewRemote creates a driver talking to the signer listening on the socket path
+func NewRemote(path string, f fil.API) *Remote {
+	return &Remote{path: path, fAPI: f}
+}
+
+func (r *Remote) call(ctx context.Context, req SignerRequest) (*SignerResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, SignerTimeout)
+		defer cancel()
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach signer: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var res SignerResponse
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&res); err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, errors.New(res.Error)
+	}
+	return &res, nil
+}
+
+// NewKey asks the signer to generate a key
+func (r *Remote) NewKey(ctx context.Context, kt KeyType) (address.Address, error) {
+	res, err := r.call(ctx, SignerRequest{Method: SignerNewKey, KeyType: kt})
+	if err != nil {
+		return address.Undef, err
+	}
+	return parseSignerAddress(res.Address)
+}
+
+// DefaultAddress returns the default address of the signer or address.Undef if it cannot be reached
+func (r *Remote) DefaultAddress() address.Address {
+	res, err := r.call(context.Background(), SignerRequest{Method: SignerDefaultAddress})
+	if err != nil {
+		return address.Undef
+	}
+	addr, err := parseSignerAddress(res.Address)
+	if err != nil {
+		return address.Undef
+	}
+	return addr
+}
+
+// SetDefaultAddress changes the default address of the signer
+func (r *Remote) SetDefaultAddress(addr address.Address) error {
+	_, err := r.call(context.Background(), SignerRequest{Method: SignerSetDefaultAddress, Address: addr.String()})
+	return err
+}
+
+// List returns the addresses of the keys held by the signer
+func (r *Remote) List() ([]address.Address, error) {
+	res, err := r.call(context.Background(), SignerRequest{Method: SignerList})
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]address.Address, len(res.Addresses))
+	for i, a := range res.Addresses {
+		addrs[i], err = parseSignerAddress(a)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return addrs, nil
+}
+
+// ImportKey sends a private key to the signer
+func (r *Remote) ImportKey(ctx context.Context, k *KeyInfo) (address.Address, error) {
+	res, err := r.call(ctx, SignerRequest{Method: SignerImportKey, Key: k})
+	if err != nil {
+		return address.Undef, err
+	}
+	return parseSignerAddress(res.Address)
+}
+
+// Sign asks the signer to sign the message with the key of the address
+func (r *Remote) Sign(ctx context.Context, addr address.Address, msg []byte) (*crypto.Signature, error) {
+	res, err := r.call(ctx, SignerRequest{Method: SignerSign, Address: addr.String(), Data: msg})
+	if err != nil {
+		return nil, err
+	}
+	if res.Signature == nil {
+		return nil, errors.New("signer returned no signature")
+	}
+	return res.Signature, nil
+}
+
+func parseSignerAddress(s string) (address.Address, error) {
+	if s == "" {
+		return address.Undef, nil
+	}
+	return address.NewFromString(s)
+}
+
+func signerAddressString(addr address.Address) string {
+	if addr == address.Undef {
+		return ""
+	}
+	return addr.String()
+}
+
+// Verify checks a signature locally as it doesn't need the private key
+func (r *Remote) Verify(ctx context.Context, k address.Address, msg []byte, sig *crypto.Signature) (bool, error) {
+	signer, err := SigTypeSig(sig.Type)
+	if err != nil {
+		return false, err
+	}
+	if err := signer.Verify(sig.Data, k, msg); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Balance for a given address
+func (r *Remote) Balance(ctx context.Context, addr address.Address) (fil.BigInt, error) {
+	if r.fAPI == nil {
+		return big.Zero(), ErrNoAPI
+	}
+	state, err := r.fAPI.StateReadState(ctx, addr, fil.EmptyTSK)
+	if err != nil {
+		return big.Zero(), err
+	}
+	return state.Balance, nil
+}
+
+// Transfer FIL from an address of the signer. Blocks until the transaction was seen on chain.
+func (r *Remote) Transfer(ctx context.Context, from address.Address, to address.Address, amount string) error {
+	if r.fAPI == nil {
+		return ErrNoAPI
+	}
+	return transfer(ctx, r.fAPI, r, from, to, amount)
+}
+
+// ServeSigner answers signing requests from remote drivers with the keys of the given driver until
+// the listener is closed. It is the reference signer implementation, usually serving a keystore on
+// a machine or in a process separate from the node.
+func ServeSigner(l net.Listener, d Driver) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveSignerConn(conn, d)
+	}
+}
+
+func serveSignerConn(conn net.Conn, d Driver) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(SignerTimeout))
+	var req SignerRequest
+	if err := json.NewDecoder(bufio.NewReader(conn)).Decode(&req); err != nil {
+		return
+	}
+	res := handleSignerRequest(context.Background(), d, req)
+	json.NewEncoder(conn).Encode(res)
+}
+
+func handleSignerRequest(ctx context.Context, d Driver, req SignerRequest) SignerResponse {
+	var res SignerResponse
+	var addr address.Address
+	var err error
+	switch req.Method {
+	case SignerNewKey:
+		addr, err = d.NewKey(ctx, req.KeyType)
+		res.Address = signerAddressString(addr)
+	case SignerDefaultAddress:
+		res.Address = signerAddressString(d.DefaultAddress())
+	case SignerSetDefaultAddress:
+		addr, err = address.NewFromString(req.Address)
+		if err != nil {
+			break
+		}
+		err = d.SetDefaultAddress(addr)
+	case SignerList:
+		var addrs []address.Address
+		addrs, err = d.List()
+		for _, a := range addrs {
+			res.Addresses = append(res.Addresses, a.String())
+		}
+	case SignerImportKey:
+		if req.Key == nil {
+			err = errors.New("missing key")
+			break
+		}
+		addr, err = d.ImportKey(ctx, req.Key)
+		res.Address = signerAddressString(addr)
+	case SignerSign:
+		addr, err = address.NewFromString(req.Address)
+		if err != nil {
+			break
+		}
+		res.Signature, err = d.Sign(ctx, addr, req.Data)
+	default:
+		err = fmt.Errorf("unknown method %s", req.Method)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
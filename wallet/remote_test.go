@@ -0,0 +1,85 @@
+package wallet
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/go-address"
+	keystore "github.com/ipfs/go-ipfs-keystore"
+	fil "github.com/myelnet/pop/filecoin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemoteSigner(t *testing.T) {
+	ctx := context.Background()
+
+	local := NewIPFS(keystore.NewMemKeystore(), nil)
+
+	sock := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", sock)
+	require.NoError(t, err)
+	defer l.Close()
+	go ServeSigner(l, local)
+
+	w, err := Open("unix://"+sock, nil, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, address.Undef, w.DefaultAddress())
+
+	addr1, err := w.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+	require.Equal(t, addr1, w.DefaultAddress())
+	require.Equal(t, addr1, local.DefaultAddress())
+
+	addr2, err := local.NewKey(ctx, KTSecp256k1)
+	require.NoError(t, err)
+	addrs, err := w.List()
+	require.NoError(t, err)
+	require.ElementsMatch(t, []address.Address{addr1, addr2}, addrs)
+
+	require.NoError(t, w.SetDefaultAddress(addr2))
+	require.Equal(t, addr2, local.DefaultAddress())
+
+	msg := []byte("hello signer")
+	sig, err := w.Sign(ctx, addr1, msg)
+	require.NoError(t, err)
+	ok, err := w.Verify(ctx, addr1, msg, sig)
+	require.NoError(t, err)
+	require.True(t, ok)
+	ok, err = local.Verify(ctx, addr1, msg, sig)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Errors from the signer are returned to the driver
+	_, err = w.Sign(ctx, address.TestAddress, msg)
+	require.Error(t, err)
+
+	_, err = w.Balance(ctx, addr1)
+	require.Equal(t, ErrNoAPI, err)
+}
+
+func TestOpenDriver(t *testing.T) {
+	ks := keystore.NewMemKeystore()
+
+	w, err := Open("", ks, nil)
+	require.NoError(t, err)
+	require.IsType(t, &IPFS{}, w)
+
+	_, err = Open("kms://key", ks, nil)
+	require.Error(t, err)
+
+	RegisterDriver("kms", func(uri *url.URL, ks keystore.Keystore, f fil.API) (Driver, error) {
+		return NewRemote(uri.Host, f), nil
+	})
+	defer func() {
+		driversMu.Lock()
+		delete(drivers, "kms")
+		driversMu.Unlock()
+	}()
+	w, err = Open("kms://key", ks, nil)
+	require.NoError(t, err)
+	require.Equal(t, "key", w.(*Remote).path)
+}
@@ -163,15 +163,23 @@ type Signer interface {
 	Verify(sig []byte, a address.Address, msg []byte) error
 }
 
-//Driver is a lightweight interface to control any available keychain and interact with blockchains
+//Driver is a lightweight interface to control any available keychain and interact with blockchains.
+// Implementations keeping keys outside of the node such as a remote signer, a KMS or an HSM can be
+// registered with RegisterDriver and selected with a wallet URI.
 type Driver interface {
+	// NewKey generates a key of the given type and returns its address. The first key becomes the default.
 	NewKey(context.Context, KeyType) (address.Address, error)
+	// DefaultAddress returns the address we pay and get paid with or address.Undef if there is none
 	DefaultAddress() address.Address
 	SetDefaultAddress(address.Address) error
+	// List returns the addresses of all the keys
 	List() ([]address.Address, error)
+	// ImportKey adds an existing private key. Drivers who cannot hold exported keys return an error.
 	ImportKey(context.Context, *KeyInfo) (address.Address, error)
+	// Sign returns a Filecoin signature of the bytes with the key of the address
 	Sign(context.Context, address.Address, []byte) (*crypto.Signature, error)
 	Verify(context.Context, address.Address, []byte, *crypto.Signature) (bool, error)
+	// Balance and Transfer require a Filecoin API
 	Balance(context.Context, address.Address) (fil.BigInt, error)
 	Transfer(ctx context.Context, from address.Address, to address.Address, amount string) error
 }
@@ -449,7 +457,11 @@ func (i *IPFS) Transfer(ctx context.Context, from address.Address, to address.Ad
 	if _, err := i.getKey(from); err != nil {
 		return err
 	}
+	return transfer(ctx, i.fAPI, i, from, to, amount)
+}
 
+// transfer sends FIL with a message signed by the driver and waits for it to be included on chain
+func transfer(ctx context.Context, api fil.API, d Driver, from address.Address, to address.Address, amount string) error {
 	val, err := fil.ParseFIL(amount)
 	if err != nil {
 		return err
@@ -463,37 +475,27 @@ func (i *IPFS) Transfer(ctx context.Context, from address.Address, to address.Ad
 		Method: method,
 	}
 
-	msg, err = i.fAPI.GasEstimateMessageGas(ctx, msg, nil, fil.EmptyTSK)
+	msg, err = api.GasEstimateMessageGas(ctx, msg, nil, fil.EmptyTSK)
 	if err != nil {
 		return err
 	}
 
-	act, err := i.fAPI.StateGetActor(ctx, msg.From, fil.EmptyTSK)
+	act, err := api.StateGetActor(ctx, msg.From, fil.EmptyTSK)
 	if err != nil {
 		return err
 	}
 	msg.Nonce = act.Nonce
 
-	mbl, err := msg.ToStorageBlock()
+	smsg, err := SignMessage(ctx, d, msg)
 	if err != nil {
 		return err
 	}
 
-	sig, err := i.Sign(ctx, msg.From, mbl.Cid().Bytes())
-	if err != nil {
-		return err
-	}
-
-	smsg := &fil.SignedMessage{
-		Message:   *msg,
-		Signature: *sig,
-	}
-
-	if _, err := i.fAPI.MpoolPush(ctx, smsg); err != nil {
+	if _, err := api.MpoolPush(ctx, smsg); err != nil {
 		return fmt.Errorf("MpoolPush failed with error: %v", err)
 	}
 
-	mwait, err := i.fAPI.StateWaitMsg(ctx, smsg.Cid(), uint64(5))
+	mwait, err := api.StateWaitMsg(ctx, smsg.Cid(), uint64(5))
 	if err != nil {
 		return fmt.Errorf("Failed to wait for msg: %s", err)
 	}